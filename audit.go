@@ -0,0 +1,137 @@
+package xlsx
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditOperation names the kind of mutation recorded by an AuditEntry.
+type AuditOperation string
+
+const (
+	AuditSetValue   AuditOperation = "SetValue"
+	AuditSetFormula AuditOperation = "SetFormula"
+	AuditSetFormat  AuditOperation = "SetFormat"
+	AuditSetStyle   AuditOperation = "SetStyle"
+	AuditMerge      AuditOperation = "Merge"
+	AuditAddSheet   AuditOperation = "AddSheet"
+	AuditAddRow     AuditOperation = "AddRow"
+	AuditRemoveRow  AuditOperation = "RemoveRow"
+	AuditInsertCol  AuditOperation = "InsertCol"
+	AuditRemoveCol  AuditOperation = "RemoveCol"
+	// AuditRenameSheet is recorded under the new name of the sheet,
+	// with the old name as the old value.
+	AuditRenameSheet AuditOperation = "RenameSheet"
+	// AuditMoveSheet is recorded with the old and new index of the
+	// sheet as the old and new values.
+	AuditMoveSheet   AuditOperation = "MoveSheet"
+	AuditRemoveSheet AuditOperation = "RemoveSheet"
+)
+
+// AuditEntry describes a single mutation of a File.  Sheet and Ref
+// are empty when they don't apply to the Operation, for example Ref
+// is empty for AuditAddSheet.
+type AuditEntry struct {
+	Time      time.Time      `json:"time"`
+	Operation AuditOperation `json:"op"`
+	Sheet     string         `json:"sheet,omitempty"`
+	Ref       string         `json:"ref,omitempty"`
+	OldValue  string         `json:"old,omitempty"`
+	NewValue  string         `json:"new,omitempty"`
+}
+
+// auditLog receives the AuditEntry values recorded against a File.
+type auditLog interface {
+	record(entry AuditEntry)
+}
+
+// auditNow is the clock used to timestamp AuditEntry values.
+var auditNow = time.Now
+
+// jsonAuditLog writes each AuditEntry as a line of JSON.
+type jsonAuditLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (l *jsonAuditLog) record(entry AuditEntry) {
+	l.mu.Lock()
+	// The audit log is best effort, a failing writer must not
+	// prevent the workbook from being edited.
+	_ = l.enc.Encode(entry)
+	l.mu.Unlock()
+}
+
+// WithAuditLog is a FileOption that writes every mutation of the File
+// to w, as JSON lines.  Reading a file is not recorded, only the edits
+// made to it afterwards.
+func WithAuditLog(w io.Writer) FileOption {
+	return func(f *File) {
+		enc := json.NewEncoder(w)
+		// Formulas are full of & < and >, keep them readable.
+		enc.SetEscapeHTML(false)
+		f.auditLog = &jsonAuditLog{enc: enc}
+	}
+}
+
+// AuditCollector gathers the AuditEntry values recorded against a File
+// in memory.
+type AuditCollector struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+func (a *AuditCollector) record(entry AuditEntry) {
+	a.mu.Lock()
+	a.entries = append(a.entries, entry)
+	a.mu.Unlock()
+}
+
+// Entries returns the AuditEntry values collected so far, in the
+// order they were recorded.
+func (a *AuditCollector) Entries() []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entries := make([]AuditEntry, len(a.entries))
+	copy(entries, a.entries)
+	return entries
+}
+
+// WithAuditCollector is a FileOption that records every mutation of
+// the File in the given AuditCollector.
+func WithAuditCollector(a *AuditCollector) FileOption {
+	return func(f *File) {
+		f.auditLog = a
+	}
+}
+
+// audit records a mutation against the File, if it has an audit log.
+func (f *File) audit(op AuditOperation, sheet, ref, oldValue, newValue string) {
+	if f == nil || f.auditLog == nil {
+		return
+	}
+	f.auditLog.record(AuditEntry{
+		Time:      auditNow(),
+		Operation: op,
+		Sheet:     sheet,
+		Ref:       ref,
+		OldValue:  oldValue,
+		NewValue:  newValue,
+	})
+}
+
+// auditing returns true if mutations of the Cell are being recorded.
+func (c *Cell) auditing() bool {
+	return c.Row != nil && c.Row.Sheet != nil && c.Row.Sheet.File != nil && c.Row.Sheet.File.auditLog != nil
+}
+
+// audit records a mutation of the Cell against its File.
+func (c *Cell) audit(op AuditOperation, oldValue, newValue string) {
+	if !c.auditing() {
+		return
+	}
+	sheet := c.Row.Sheet
+	sheet.File.audit(op, sheet.Name, GetCellIDStringFromCoords(c.num, c.Row.num), oldValue, newValue)
+}
@@ -0,0 +1,98 @@
+package xlsx
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAuditLog(t *testing.T) {
+	c := qt.New(t)
+
+	fixed := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	auditNow = func() time.Time { return fixed }
+	c.Cleanup(func() { auditNow = time.Now })
+
+	// edit performs a known editing session against the File.
+	edit := func(c *qt.C, f *File) {
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		cell := row.AddCell()
+		cell.SetString("hello")
+		cell.SetString("goodbye")
+		cell = row.AddCell()
+		cell.SetInt(42)
+		cell.SetFormula("A1&\"!\"")
+		cell.SetStyle(NewStyle())
+		sheet.AddRow()
+		c.Assert(sheet.RemoveRowAtIndex(1), qt.IsNil)
+	}
+
+	c.Run("JSON lines", func(c *qt.C) {
+		var buf bytes.Buffer
+		f := NewFile(WithAuditLog(&buf))
+		edit(c, f)
+		expected := strings.Join([]string{
+			`{"time":"2020-01-02T03:04:05Z","op":"AddSheet","sheet":"Sheet1"}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"AddRow","sheet":"Sheet1","ref":"1"}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"SetValue","sheet":"Sheet1","ref":"A1","new":"hello"}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"SetValue","sheet":"Sheet1","ref":"A1","old":"hello","new":"goodbye"}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"SetValue","sheet":"Sheet1","ref":"B1","new":"42"}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"SetFormula","sheet":"Sheet1","ref":"B1","new":"A1&\"!\""}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"SetStyle","sheet":"Sheet1","ref":"B1"}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"AddRow","sheet":"Sheet1","ref":"2"}`,
+			`{"time":"2020-01-02T03:04:05Z","op":"RemoveRow","sheet":"Sheet1","ref":"2"}`,
+			``,
+		}, "\n")
+		c.Assert(buf.String(), qt.Equals, expected)
+	})
+
+	c.Run("Collector", func(c *qt.C) {
+		collector := &AuditCollector{}
+		f := NewFile(WithAuditCollector(collector))
+		edit(c, f)
+		entries := collector.Entries()
+		c.Assert(entries, qt.HasLen, 9)
+		c.Assert(entries[3], qt.DeepEquals, AuditEntry{
+			Time:      fixed,
+			Operation: AuditSetValue,
+			Sheet:     "Sheet1",
+			Ref:       "A1",
+			OldValue:  "hello",
+			NewValue:  "goodbye",
+		})
+	})
+
+	csRunO(c, "Reading is not recorded", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell := sheet.AddRow().AddCell()
+		cell.SetString("original")
+		cell.SetStyle(NewStyle())
+		path := filepath.Join(c.Mkdir(), "audit.xlsx")
+		c.Assert(f.Save(path), qt.IsNil)
+
+		collector := &AuditCollector{}
+		f, err = OpenFile(path, option, WithAuditCollector(collector))
+		c.Assert(err, qt.IsNil)
+		c.Assert(collector.Entries(), qt.HasLen, 0)
+
+		cell, err = f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("changed")
+		c.Assert(collector.Entries(), qt.DeepEquals, []AuditEntry{{
+			Time:      fixed,
+			Operation: AuditSetValue,
+			Sheet:     "Sheet1",
+			Ref:       "A1",
+			OldValue:  "original",
+			NewValue:  "changed",
+		}})
+	})
+}
@@ -0,0 +1,345 @@
+package xlsx
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// TextMeasurer returns the width of text shown in font, in the unit
+// that column widths are given in: the width of a digit in the font of
+// the normal style, whose size is normalSize points.  font is nil for
+// text in the normal font.
+type TextMeasurer func(text string, font *Font, normalSize float64) float64
+
+// maxColWidth is the widest column that Excel allows.
+const maxColWidth = 255
+
+// autoFitPadding is the margin that Excel adds to the width of the
+// content of a column, 5 pixels in the 7 pixels of a digit of its
+// default font.
+const autoFitPadding = 5.0 / 7.0
+
+// charWidths are the widths of the ASCII characters that aren't as
+// wide as a digit, relative to it, in a typical proportional font such
+// as Arial or Calibri.
+var charWidths = map[rune]float64{
+	' ': 0.43, '!': 0.43, '\'': 0.43, ',': 0.43, '.': 0.43, ':': 0.43, ';': 0.43, '|': 0.43, '`': 0.43,
+	'i': 0.43, 'j': 0.43, 'l': 0.43, 'I': 0.43,
+	'"': 0.57, '(': 0.57, ')': 0.57, '-': 0.57, '/': 0.57, '[': 0.57, '\\': 0.57, ']': 0.57, '{': 0.57, '}': 0.57,
+	'f': 0.57, 'r': 0.57, 't': 0.57, 'J': 0.57,
+	'c': 0.86, 'k': 0.86, 's': 0.71, 'v': 0.86, 'x': 0.86, 'y': 0.86, 'z': 0.71, '*': 0.71,
+	'm': 1.43, 'w': 1.29, '%': 1.43, '@': 1.71,
+	'A': 1.14, 'B': 1.14, 'C': 1.14, 'D': 1.29, 'G': 1.29, 'H': 1.29, 'K': 1.14, 'N': 1.29, 'O': 1.43, 'Q': 1.43,
+	'R': 1.14, 'U': 1.29, 'V': 1.14, 'M': 1.71, 'W': 1.71,
+}
+
+// DefaultTextMeasurer is the TextMeasurer that AutoFitCol uses unless
+// it is given another.  It uses a table of the widths of characters,
+// relative to that of a digit, that suits the usual proportional
+// fonts, and counts the characters of East Asian scripts as two
+// digits wide.  The width is scaled by the size of font, relative to
+// normalSize, and is a little wider for a bold font.  Of text of
+// several lines, the longest line is measured.
+func DefaultTextMeasurer(text string, font *Font, normalSize float64) float64 {
+	widest := 0.0
+	for _, line := range strings.Split(text, "\n") {
+		width := 0.0
+		for _, r := range line {
+			width += runeWidth(r)
+		}
+		widest = math.Max(widest, width)
+	}
+	if font != nil {
+		if font.Size > 0 && normalSize > 0 {
+			widest *= font.Size / normalSize
+		}
+		if font.Bold {
+			widest *= 1.1
+		}
+	}
+	return widest
+}
+
+// runeWidth returns the width of r relative to that of a digit.
+func runeWidth(r rune) float64 {
+	if w, ok := charWidths[r]; ok {
+		return w
+	}
+	switch {
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul),
+		r >= 0xff01 && r <= 0xff60, r >= 0xffe0 && r <= 0xffe6, r >= 0x3000 && r <= 0x303f:
+		return 2.0
+	case unicode.Is(unicode.Mn, r):
+		// Combining marks take no space of their own.
+		return 0
+	}
+	return 1.0
+}
+
+// RowHeightEstimator returns the height, in points, that text shown in
+// font needs in a cell width wide, in the unit that column widths are
+// given in, when it is wrapped if wrap is set.  font is nil for text in
+// the normal font, whose size is normalSize points.
+type RowHeightEstimator func(text string, font *Font, normalSize, width float64, wrap bool) float64
+
+// lineHeight is the height of a line of text, relative to the size of
+// its font, that gives the 12.85 points of the default row height for
+// the 10 point font it goes with.
+const lineHeight = 1.285
+
+// DefaultRowHeightEstimator is the RowHeightEstimator that
+// Sheet.AutoFitRowHeights and Row.SetAutoHeight use unless they are
+// given another.  It counts the lines of text with CountWrappedLines,
+// measuring it with DefaultTextMeasurer, and allows each line 1.285
+// times the size of font, rounded up to whole pixels.
+func DefaultRowHeightEstimator(text string, font *Font, normalSize, width float64, wrap bool) float64 {
+	lines := 1
+	if wrap {
+		lines = CountWrappedLines(text, font, normalSize, width, DefaultTextMeasurer)
+	}
+	size := normalSize
+	if font != nil && font.Size > 0 {
+		size = font.Size
+	}
+	// A pixel is 0.75 points.
+	return math.Ceil(float64(lines)*size*lineHeight/0.75) * 0.75
+}
+
+// CountWrappedLines returns the number of lines that text shown in font
+// takes up in a cell width wide, wrapped at spaces as Excel does, with
+// a new line for each newline in text.  A word wider than the cell is
+// broken over as many lines as it needs.  The text is measured with
+// measurer; normalSize is passed on to it.
+func CountWrappedLines(text string, font *Font, normalSize, width float64, measurer TextMeasurer) int {
+	// The margins of the cell aren't available for text.
+	width -= autoFitPadding
+	lines := 0
+	for _, line := range strings.Split(text, "\n") {
+		lines++
+		if width <= 0 {
+			continue
+		}
+		space := measurer(" ", font, normalSize)
+		used := 0.0
+		for i, word := range strings.Split(line, " ") {
+			w := measurer(word, font, normalSize)
+			if i > 0 {
+				if used+space+w <= width {
+					used += space + w
+					continue
+				}
+				lines++
+			}
+			// The word starts a line, and takes up more than one if
+			// it's too wide.
+			for w > width {
+				lines++
+				w -= width
+			}
+			used = w
+		}
+	}
+	return lines
+}
+
+// autoFitFlags holds the settings of AutoFitCol, AutoFitAllCols,
+// AutoFitRowHeights and Row.SetAutoHeight.
+type autoFitFlags struct {
+	maxWidth  float64
+	measurer  TextMeasurer
+	estimator RowHeightEstimator
+}
+
+func newAutoFitFlags(options []AutoFitOption) *autoFitFlags {
+	flags := &autoFitFlags{maxWidth: maxColWidth, measurer: DefaultTextMeasurer, estimator: DefaultRowHeightEstimator}
+	for _, opt := range options {
+		opt(flags)
+	}
+	return flags
+}
+
+// AutoFitOption describes a function that can set values in an
+// autoFitFlags struct to affect the way AutoFitCol and AutoFitAllCols
+// operate.
+type AutoFitOption func(flags *autoFitFlags)
+
+// AutoFitMaxWidth is an AutoFitOption that caps the width of the
+// columns at width, in place of 255, the widest that Excel allows.
+func AutoFitMaxWidth(width float64) AutoFitOption {
+	return func(flags *autoFitFlags) {
+		flags.maxWidth = width
+	}
+}
+
+// AutoFitMeasurer is an AutoFitOption that measures the content of the
+// cells with measurer, in place of DefaultTextMeasurer, such as for
+// fonts whose characters have other widths.
+func AutoFitMeasurer(measurer TextMeasurer) AutoFitOption {
+	return func(flags *autoFitFlags) {
+		flags.measurer = measurer
+	}
+}
+
+// AutoFitRowHeightEstimator is an AutoFitOption that works out the
+// heights of rows with estimator, in place of
+// DefaultRowHeightEstimator.
+func AutoFitRowHeightEstimator(estimator RowHeightEstimator) AutoFitOption {
+	return func(flags *autoFitFlags) {
+		flags.estimator = estimator
+	}
+}
+
+// AutoFitCol sets the width of the column at the zero based colIdx, as
+// for Sheet.Cell, to fit the widest of its cells.  The width of a cell
+// is that of its formatted value, shown in its font, and merged cells
+// aren't measured.  The rows are visited one at a time, so that the
+// rows of a Sheet with a CellStore that persists them aren't all
+// loaded.  A column without any cells to measure is left as it is.
+func (s *Sheet) AutoFitCol(colIdx int, options ...AutoFitOption) error {
+	return s.autoFit(func(col int) bool { return col == colIdx }, options)
+}
+
+// AutoFitAllCols sets the width of each column of the Sheet to fit the
+// widest of its cells, as AutoFitCol does, in a single pass over its
+// rows.
+func (s *Sheet) AutoFitAllCols(options ...AutoFitOption) error {
+	return s.autoFit(func(int) bool { return true }, options)
+}
+
+// autoFit sets the width of the columns for which fits returns true.
+func (s *Sheet) autoFit(fits func(col int) bool, options []AutoFitOption) error {
+	s.mustBeOpen()
+	flags := newAutoFitFlags(options)
+	normalSize := s.normalFontSize()
+
+	widths := make(map[int]float64)
+	colStyles := make(map[int]*Style)
+	err := s.ForEachRow(func(r *Row) error {
+		return r.ForEachCell(func(c *Cell) error {
+			if !fits(c.num) || c.HMerge > 0 || c.VMerge > 0 {
+				return nil
+			}
+			text := c.autoFitText()
+			if text == "" {
+				return nil
+			}
+			var font *Font
+			if style := s.autoFitStyle(c, colStyles); style != nil {
+				font = &style.Font
+			}
+			width := flags.measurer(text, font, normalSize)
+			if width > widths[c.num] {
+				widths[c.num] = width
+			}
+			return nil
+		}, SkipEmptyCells)
+	}, SkipEmptyRows)
+	if err != nil {
+		return err
+	}
+
+	for col, width := range widths {
+		// Excel keeps widths to 1/256 of a character.
+		width = math.Trunc((width+autoFitPadding)*256) / 256
+		s.SetColWidth(col+1, col+1, math.Min(width, flags.maxWidth))
+	}
+	return nil
+}
+
+// AutoFitRowHeights sets the height of each Row of the Sheet to fit
+// its cells, as Row.SetAutoHeight does.  The rows are visited one at a
+// time, as for AutoFitCol.
+func (s *Sheet) AutoFitRowHeights(options ...AutoFitOption) error {
+	s.mustBeOpen()
+	flags := newAutoFitFlags(options)
+	colStyles := make(map[int]*Style)
+	return s.ForEachRow(func(r *Row) error {
+		return r.autoHeight(flags, colStyles)
+	}, SkipEmptyRows)
+}
+
+// SetAutoHeight sets the height of the Row to fit the tallest of its
+// cells, so that text that wraps isn't cut off when the file is opened.
+// The number of lines of a cell whose Style has WrapText set is
+// estimated from the width of its column, or of the columns it's
+// merged over, and from its font; that of other cells is one line, in
+// their font.  Cells merged over several rows aren't measured.  A Row
+// whose cells need no more than the default height of the Sheet, or
+// than a line of text in the normal font, is left as it is.
+func (r *Row) SetAutoHeight(options ...AutoFitOption) error {
+	r.Sheet.mustBeOpen()
+	return r.autoHeight(newAutoFitFlags(options), make(map[int]*Style))
+}
+
+func (r *Row) autoHeight(flags *autoFitFlags, colStyles map[int]*Style) error {
+	s := r.Sheet
+	normalSize := s.normalFontSize()
+	height := 0.0
+	err := r.ForEachCell(func(c *Cell) error {
+		if c.VMerge > 0 {
+			return nil
+		}
+		text := c.autoFitText()
+		if text == "" {
+			return nil
+		}
+		var font *Font
+		wrap := false
+		if style := s.autoFitStyle(c, colStyles); style != nil {
+			font = &style.Font
+			wrap = style.Alignment.WrapText
+		}
+		width := 0.0
+		for col := c.num; col <= c.num+c.HMerge; col++ {
+			width += s.ColWidth(col)
+		}
+		height = math.Max(height, flags.estimator(text, font, normalSize, width, wrap))
+		return nil
+	}, SkipEmptyCells)
+	if err != nil {
+		return err
+	}
+	if height > math.Max(s.DefaultRowHeight(), flags.estimator("", nil, normalSize, 0, false)) {
+		r.SetHeight(height)
+	}
+	return nil
+}
+
+// normalFontSize returns the size of the font of the normal style of
+// the File of the Sheet.
+func (s *Sheet) normalFontSize() float64 {
+	if s.File != nil && s.File.defaultFontSize > 0 {
+		return s.File.defaultFontSize
+	}
+	return 11.0
+}
+
+// autoFitText returns the text that the cell shows.
+func (c *Cell) autoFitText() string {
+	text, err := c.FormattedValue()
+	if err != nil {
+		return c.Value
+	}
+	return text
+}
+
+// autoFitStyle returns the Style that the cell is shown in: its own,
+// or that of its Row or, failing that, its column.  The Styles of the
+// columns are kept in colStyles, so that each is only looked up once.
+func (s *Sheet) autoFitStyle(c *Cell, colStyles map[int]*Style) *Style {
+	if c.style != nil {
+		return c.style
+	}
+	if c.Row != nil && c.Row.style != nil {
+		return c.Row.style
+	}
+	colStyle, ok := colStyles[c.num]
+	if !ok {
+		if col := s.Col(c.num); col != nil {
+			colStyle = col.GetStyle()
+		}
+		colStyles[c.num] = colStyle
+	}
+	return colStyle
+}
@@ -0,0 +1,220 @@
+package xlsx
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAutoFit(t *testing.T) {
+	c := qt.New(t)
+
+	// colWidth returns the width of the column at the zero based
+	// colIdx, or 0 if it hasn't been set.
+	colWidth := func(sheet *Sheet, colIdx int) float64 {
+		col := sheet.Col(colIdx)
+		if col == nil || col.Width == nil {
+			return 0
+		}
+		return *col.Width
+	}
+
+	makeSheet := func(c *qt.C, option FileOption) *Sheet {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("AutoFit")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		cells := []struct {
+			row, col int
+			set      func(cell *Cell)
+		}{
+			{0, 0, func(cell *Cell) { cell.SetString("1234567890") }},
+			{1, 0, func(cell *Cell) { cell.SetString("12") }},
+			// The formatted value is measured, not the raw one.
+			{0, 1, func(cell *Cell) { cell.SetFloatWithFormat(1234.5, "0.00") }},
+			// A merged cell isn't measured.
+			{0, 2, func(cell *Cell) {
+				cell.SetString("a long title that spans two columns")
+				cell.Merge(1, 0)
+			}},
+			{1, 2, func(cell *Cell) { cell.SetString("ab") }},
+			{0, 4, func(cell *Cell) { cell.SetString("漢字") }},
+			{0, 5, func(cell *Cell) {
+				cell.SetString("12")
+				style := NewStyle()
+				style.Font = *NewFont(22, "Arial")
+				cell.SetStyle(style)
+			}},
+		}
+		for _, cc := range cells {
+			cell, err := sheet.Cell(cc.row, cc.col)
+			c.Assert(err, qt.IsNil)
+			cc.set(cell)
+		}
+		return sheet
+	}
+
+	csRunO(c, "AutoFitAllCols", func(c *qt.C, option FileOption) {
+		sheet := makeSheet(c, option)
+		c.Assert(sheet.AutoFitAllCols(), qt.IsNil)
+		// Ten digits and the margin Excel adds, to 1/256.
+		c.Assert(colWidth(sheet, 0), qt.Equals, 10.7109375)
+		// "1234.50" is six digits and a point.
+		c.Assert(colWidth(sheet, 1), qt.Equals, 7.140625)
+		c.Assert(colWidth(sheet, 2), qt.Equals, 2.7109375)
+		c.Assert(colWidth(sheet, 3), qt.Equals, 0.0)
+		// East Asian characters are two digits wide.
+		c.Assert(colWidth(sheet, 4), qt.Equals, 4.7109375)
+		// A font twice the size of the normal one is twice as wide.
+		c.Assert(colWidth(sheet, 5), qt.Equals, 4.7109375)
+	})
+
+	csRunO(c, "AutoFitCol", func(c *qt.C, option FileOption) {
+		sheet := makeSheet(c, option)
+		c.Assert(sheet.AutoFitCol(2), qt.IsNil)
+		c.Assert(colWidth(sheet, 0), qt.Equals, 0.0)
+		c.Assert(colWidth(sheet, 2), qt.Equals, 2.7109375)
+	})
+
+	csRunO(c, "MaxWidthAndMeasurer", func(c *qt.C, option FileOption) {
+		sheet := makeSheet(c, option)
+		cell, err := sheet.Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString(strings.Repeat("8", 300))
+		c.Assert(sheet.AutoFitCol(0), qt.IsNil)
+		c.Assert(colWidth(sheet, 0), qt.Equals, 255.0)
+		c.Assert(sheet.AutoFitCol(0, AutoFitMaxWidth(20)), qt.IsNil)
+		c.Assert(colWidth(sheet, 0), qt.Equals, 20.0)
+
+		// Every character is three digits wide in this font.
+		wide := func(text string, font *Font, normalSize float64) float64 {
+			return 3 * float64(len([]rune(text)))
+		}
+		c.Assert(sheet.AutoFitCol(2, AutoFitMeasurer(wide)), qt.IsNil)
+		c.Assert(colWidth(sheet, 2), qt.Equals, 6.7109375)
+	})
+}
+
+func TestCountWrappedLines(t *testing.T) {
+	c := qt.New(t)
+	// Each character is a digit wide, and the cells have room for ten.
+	measurer := func(text string, font *Font, normalSize float64) float64 {
+		return float64(len(text))
+	}
+	width := 10 + autoFitPadding
+	for _, tc := range []struct {
+		text  string
+		width float64
+		lines int
+	}{
+		{"", width, 1},
+		{"ten digits", width, 1},
+		{"eleven chars", width, 2},
+		{"one two three four", width, 2},
+		{"one\ntwo\n", width, 3},
+		// A word that doesn't fit is broken.
+		{"abcdefghijklmnopqrstuvwxy", width, 3},
+		{"ab abcdefghijklmnopqrstuvwxy", width, 4},
+		{"one two\nthree", 0, 2},
+	} {
+		c.Check(CountWrappedLines(tc.text, nil, 11, tc.width, measurer), qt.Equals, tc.lines, qt.Commentf("%q", tc.text))
+	}
+}
+
+func TestAutoFitRowHeights(t *testing.T) {
+	c := qt.New(t)
+
+	makeSheet := func(c *qt.C, option FileOption) (*File, *Sheet) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("AutoHeight")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		wrap := NewStyle()
+		wrap.Font.Size = 10
+		wrap.Alignment.WrapText = true
+		wrap.ApplyAlignment = true
+		sheet.SetColWidth(1, 3, 10)
+		cells := []struct {
+			row, col int
+			set      func(cell *Cell)
+		}{
+			{0, 0, func(cell *Cell) {
+				cell.SetString(strings.Repeat("wrapped text ", 6))
+				cell.SetStyle(wrap)
+			}},
+			{1, 0, func(cell *Cell) {
+				cell.SetString("short")
+				cell.SetStyle(wrap)
+			}},
+			// Without WrapText, a newline doesn't make a line.
+			{2, 0, func(cell *Cell) { cell.SetString("one\ntwo\nthree") }},
+			{3, 0, func(cell *Cell) {
+				cell.SetString("one\ntwo\nthree")
+				cell.SetStyle(wrap)
+			}},
+			{4, 1, func(cell *Cell) {
+				cell.SetString(strings.Repeat("wrapped text ", 6))
+				cell.SetStyle(wrap)
+				cell.Merge(1, 0)
+			}},
+			// Text merged over several rows doesn't count.
+			{5, 1, func(cell *Cell) {
+				cell.SetString(strings.Repeat("wrapped text ", 6))
+				cell.SetStyle(wrap)
+				cell.Merge(0, 1)
+			}},
+		}
+		for _, cc := range cells {
+			cell, err := sheet.Cell(cc.row, cc.col)
+			c.Assert(err, qt.IsNil)
+			cc.set(cell)
+		}
+		return f, sheet
+	}
+	rowHeight := func(c *qt.C, sheet *Sheet, rowIdx int) float64 {
+		row, err := sheet.Row(rowIdx)
+		c.Assert(err, qt.IsNil)
+		return row.height
+	}
+
+	csRunO(c, "AutoFitRowHeights", func(c *qt.C, option FileOption) {
+		f, sheet := makeSheet(c, option)
+		c.Assert(sheet.AutoFitRowHeights(), qt.IsNil)
+		// "wrapped text" doesn't fit on a line, so each word has one
+		// of its own: twelve lines of 12.85 points, rounded up to the
+		// pixel.
+		c.Assert(rowHeight(c, sheet, 0), qt.Equals, 154.5)
+		c.Assert(rowHeight(c, sheet, 1), qt.Equals, 0.0)
+		c.Assert(rowHeight(c, sheet, 2), qt.Equals, 0.0)
+		c.Assert(rowHeight(c, sheet, 3), qt.Equals, 39.0)
+		// Merged over two columns, three words fit on a line.
+		c.Assert(rowHeight(c, sheet, 4), qt.Equals, 51.75)
+		c.Assert(rowHeight(c, sheet, 5), qt.Equals, 0.0)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		sheetXML := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(sheetXML, qt.Matches, `(?s).*<row r="1" [^>]*ht="154.5" customHeight="(true|1)".*`)
+		c.Assert(sheetXML, qt.Matches, `(?s).*<row r="2" spans="1:1">.*`)
+	})
+
+	csRunO(c, "SetAutoHeight", func(c *qt.C, option FileOption) {
+		_, sheet := makeSheet(c, option)
+		var widths []float64
+		estimator := func(text string, font *Font, normalSize, width float64, wrap bool) float64 {
+			if text == "" {
+				// A line of text in the normal font.
+				return 10
+			}
+			widths = append(widths, width)
+			return 100
+		}
+		row, err := sheet.Row(4)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.SetAutoHeight(AutoFitRowHeightEstimator(estimator)), qt.IsNil)
+		c.Assert(row.height, qt.Equals, 100.0)
+		c.Assert(widths, qt.DeepEquals, []float64{20})
+		c.Assert(rowHeight(c, sheet, 0), qt.Equals, 0.0)
+	})
+}
@@ -0,0 +1,227 @@
+package benchmarks
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/xenking/xlsx/v3"
+)
+
+// cellStores returns the FileOptions that select each of the cell
+// stores.  The Redis store is backed by an in-process miniredis server,
+// which is shut down when the benchmark ends.
+func cellStores(b *testing.B) map[string]xlsx.FileOption {
+	server, err := miniredis.Run()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(server.Close)
+	return map[string]xlsx.FileOption{
+		"Memory": xlsx.UseMemoryCellStore,
+		"DiskV":  xlsx.UseDiskVCellStore,
+		"Redis": xlsx.UseRedisCellStore(xlsx.RedisCellStoreOption{
+			RedisAddr:      server.Addr(),
+			CommandTimeout: time.Second,
+			DialTimeout:    time.Second,
+		}),
+	}
+}
+
+// storeNames fixes the order in which the cell stores are benchmarked.
+var storeNames = []string{"Memory", "DiskV", "Redis"}
+
+// workbooks returns the generated workbooks that Open and Save are
+// benchmarked against.
+func workbooks(b *testing.B) map[string]*xlsx.File {
+	wide, err := WideNumeric(500, 50)
+	if err != nil {
+		b.Fatal(err)
+	}
+	tall, err := TallStrings(5000)
+	if err != nil {
+		b.Fatal(err)
+	}
+	styled, err := StyleHeavy(500, 20, 300)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sparse, err := Sparse(1000, 100, 0.01)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return map[string]*xlsx.File{
+		"WideNumeric": wide,
+		"TallStrings": tall,
+		"StyleHeavy":  styled,
+		"Sparse":      sparse,
+	}
+}
+
+// workbookNames fixes the order in which the workbooks are benchmarked.
+var workbookNames = []string{"WideNumeric", "TallStrings", "StyleHeavy", "Sparse"}
+
+func closeSheets(f *xlsx.File) {
+	for _, sheet := range f.Sheets {
+		sheet.Close()
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	files := workbooks(b)
+	for _, name := range workbookNames {
+		data, err := Marshal(files[name])
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				f, err := xlsx.OpenBinary(data)
+				if err != nil {
+					b.Fatal(err)
+				}
+				closeSheets(f)
+			}
+		})
+	}
+}
+
+func BenchmarkSave(b *testing.B) {
+	files := workbooks(b)
+	for _, name := range workbookNames {
+		f := files[name]
+		data, err := Marshal(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				err := f.Write(ioutil.Discard)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			// The size of the saved file, which the benchmarks
+			// don't check, but which is worth keeping an eye on.
+			b.ReportMetric(float64(len(data)), "B/file")
+		})
+	}
+}
+
+func BenchmarkForEachRow(b *testing.B) {
+	stores := cellStores(b)
+	for _, name := range storeNames {
+		b.Run(name, func(b *testing.B) {
+			f, err := WideNumeric(200, 20, stores[name])
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer closeSheets(f)
+			sheet := f.Sheets[0]
+			visit := func(r *xlsx.Row) error {
+				return r.ForEachCell(func(c *xlsx.Cell) error {
+					return nil
+				})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := sheet.ForEachRow(visit)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFormattedValue(b *testing.B) {
+	formats := []struct {
+		name, format string
+	}{
+		{"General", "general"},
+		{"Decimal", "0.00"},
+		{"Thousands", "#,##0"},
+		{"Percent", "0%"},
+		{"Scientific", "0.000E+00"},
+		{"Date", "yyyy-mm-dd"},
+		{"Time", "h:mm:ss"},
+		{"Text", "@"},
+	}
+	f := xlsx.NewFile()
+	sheet, err := f.AddSheet("FormattedValue")
+	if err != nil {
+		b.Fatal(err)
+	}
+	row := sheet.AddRow()
+	for _, format := range formats {
+		cell := row.AddCell()
+		cell.SetFloatWithFormat(43831.123456, format.format)
+		b.Run(format.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, err := cell.FormattedValue()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkWriteRow measures adding rows of ten cells to a sheet.
+// Adding a row writes the previous one to the cell store.
+func BenchmarkWriteRow(b *testing.B) {
+	stores := cellStores(b)
+	for _, name := range storeNames {
+		b.Run(name, func(b *testing.B) {
+			f := xlsx.NewFile(stores[name])
+			sheet, err := f.AddSheet("WriteRow")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer sheet.Close()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				row := sheet.AddRow()
+				for c := 0; c < 10; c++ {
+					row.AddCell().SetInt(i + c)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkReadRow measures reading rows of twenty cells back out of
+// the cell store, one after another.
+func BenchmarkReadRow(b *testing.B) {
+	stores := cellStores(b)
+	for _, name := range storeNames {
+		b.Run(name, func(b *testing.B) {
+			const rows = 200
+			f, err := WideNumeric(rows, 20, stores[name])
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer closeSheets(f)
+			sheet := f.Sheets[0]
+			// Visiting the rows stores the last one added.
+			err = sheet.ForEachRow(func(*xlsx.Row) error { return nil })
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := sheet.Row(i % rows)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
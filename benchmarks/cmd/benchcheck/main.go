@@ -0,0 +1,119 @@
+// Command benchcheck compares the output of "go test -bench" against a
+// baseline produced in the same way, and fails if any benchmark has
+// become slower than the baseline by more than a tolerance.
+//
+// Usage:
+//
+//	benchcheck [-tolerance percent] baseline.txt current.txt
+//
+// Benchmarks are matched by name, ignoring the GOMAXPROCS suffix.
+// Benchmarks that are only in one of the files are listed, but don't
+// cause a failure.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// procsSuffix matches the GOMAXPROCS suffix that "go test" appends to
+// the names of benchmarks, as in "BenchmarkOpen/Wide-8".
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// parse returns the ns/op of each benchmark in the output of
+// "go test -bench".  When a benchmark appears more than once, as with
+// -count, the fastest run is kept.
+func parse(r io.Reader) (map[string]float64, error) {
+	results := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		name := procsSuffix.ReplaceAllString(fields[0], "")
+		for i := 2; i < len(fields); i++ {
+			if fields[i] != "ns/op" {
+				continue
+			}
+			ns, err := strconv.ParseFloat(fields[i-1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if old, ok := results[name]; !ok || ns < old {
+				results[name] = ns
+			}
+			break
+		}
+	}
+	return results, scanner.Err()
+}
+
+func parseFile(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	results, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return results, nil
+}
+
+func main() {
+	tolerance := flag.Float64("tolerance", 25, "how many percent slower than the baseline a benchmark may be")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: benchcheck [-tolerance percent] baseline.txt current.txt")
+		os.Exit(2)
+	}
+	baseline, err := parseFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	current, err := parseFile(flag.Arg(1))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	names := make([]string, 0, len(current))
+	for name := range current {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var regressions int
+	for _, name := range names {
+		base, ok := baseline[name]
+		if !ok {
+			fmt.Printf("%-45s %14.0f ns/op  (not in baseline)\n", name, current[name])
+			continue
+		}
+		change := (current[name] - base) / base * 100
+		status := "ok"
+		if change > *tolerance {
+			status = "REGRESSION"
+			regressions++
+		}
+		fmt.Printf("%-45s %14.0f ns/op  %+7.1f%%  %s\n", name, current[name], change, status)
+	}
+	for name := range baseline {
+		if _, ok := current[name]; !ok {
+			fmt.Printf("%-45s missing from the current results\n", name)
+		}
+	}
+	if regressions > 0 {
+		fmt.Printf("%d benchmarks are more than %.0f%% slower than the baseline\n", regressions, *tolerance)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParse(t *testing.T) {
+	c := qt.New(t)
+
+	output := `goos: linux
+BenchmarkOpen/Wide-8      	       5	 243990195 ns/op	   0.85 MB/s	105526344 B/op	 1280928 allocs/op
+BenchmarkOpen/Wide-8      	       5	 203990195 ns/op	   0.85 MB/s	105526344 B/op	 1280928 allocs/op
+BenchmarkReadRow/Memory   	 1446364	       761.1 ns/op	      80 B/op	       4 allocs/op
+PASS
+ok  	github.com/xenking/xlsx/v3/benchmarks	139.285s
+`
+	results, err := parse(strings.NewReader(output))
+	c.Assert(err, qt.IsNil)
+	c.Assert(results, qt.DeepEquals, map[string]float64{
+		"BenchmarkOpen/Wide":      203990195,
+		"BenchmarkReadRow/Memory": 761.1,
+	})
+}
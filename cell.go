@@ -5,6 +5,8 @@ import (
 	"encoding/base64"
 	"fmt"
 	"math"
+	"math/big"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -27,7 +29,8 @@ const (
 	CellTypeNumeric
 	CellTypeBool
 	// CellTypeInline is not respected on save, all inline string cells will be saved as SharedStrings
-	// when saving to an XLSX file. This the same behavior as that found in Excel.
+	// when saving to an XLSX file. This the same behavior as that found in Excel.  The WriteInlineStrings
+	// option saves all string cells inline instead.
 	CellTypeInline
 	CellTypeError
 	// d (Date): Cell contains a date in the ISO 8601 format.
@@ -61,6 +64,7 @@ type Cell struct {
 	Row            *Row
 	Value          string
 	RichText       []RichTextRun
+	phonetic       *Phonetic
 	formula        string
 	style          *Style
 	NumFmt         string
@@ -77,6 +81,10 @@ type Cell struct {
 	origValue      string
 	origNumFmt     string
 	origRichText   []RichTextRun
+	// numFmtId is the id of the number format that the cell was read
+	// with, which NumFmtID returns for the built-in formats whose
+	// codes several ids share.
+	numFmtId int
 }
 
 // Return a representation of the Cell as a slice of bytes
@@ -141,6 +149,45 @@ func (c *Cell) Modified() bool {
 	return c.modified || c.Value != c.origValue || c.NumFmt != c.origNumFmt || !rtEq(c.RichText, c.origRichText)
 }
 
+// MarkModified marks the cell as modified, so that it is written to
+// its CellStore, and the Row it is in as well, whether or not anything
+// about it has changed.
+func (c *Cell) MarkModified() {
+	c.modified = true
+}
+
+// MarkClean marks the cell as not modified, as if it had just been
+// written to its CellStore, so that Modified returns false until it is
+// changed again.  With a CellStore that persists cells, such as the
+// DiskVCellStore or the RedisCellStore, the current cell of a Row is
+// only written back when another cell becomes the current one if it
+// is modified, so changes made to a cell before marking it clean are
+// then lost, and reading it again returns what was last written.  A
+// clean cell with a value is still written to the file when it is
+// saved.
+func (c *Cell) MarkClean() {
+	c.modified = false
+	c.origValue = c.Value
+	c.origNumFmt = c.NumFmt
+	c.origRichText = c.RichText
+}
+
+// isEmpty reports whether the cell is skipped when visited with
+// SkipEmptyCells: it is blank and hasn't been modified, so there is
+// nothing to persist either.
+func (c *Cell) isEmpty() bool {
+	return !c.Modified() && c.isBlank()
+}
+
+// isBlank reports whether the cell has nothing to write: no value,
+// formula, number format, style, data validation, hyperlink or merge.
+// Blank cells, such as those that have been cleared, are left out of
+// the worksheet.
+func (c *Cell) isBlank() bool {
+	return c.Value == "" && len(c.RichText) == 0 && c.formula == "" && c.NumFmt == "" &&
+		c.DataValidation == nil && c.Hyperlink == (Hyperlink{}) && c.HMerge == 0 && c.VMerge == 0 && c.style == nil
+}
+
 // Return a string repersenting a Cell in a way that can be used by the CellStore
 func (c *Cell) key() string {
 	return fmt.Sprintf("%s:%06d:%06d", c.Row.Sheet.Name, c.Row.num, c.num)
@@ -149,11 +196,18 @@ func (c *Cell) key() string {
 // Hyperlink is a structure to store link information
 // in-workbook links to cells or defined names are stored in Location
 // external links are stores in Link
+//
+// A link can cover a range of cells, whose first cell holds it.
+// HSpan and VSpan are the number of columns to the right of it and rows
+// below it that the link also covers, as HMerge and VMerge are for
+// merged cells.
 type Hyperlink struct {
 	DisplayString string
 	Link          string
 	Tooltip       string
 	Location      string
+	HSpan         int
+	VSpan         int
 }
 
 // CellInterface defines the public API of the Cell.
@@ -179,6 +233,9 @@ func (c *Cell) updatable() {
 // Merge with other cells, horizontally and/or vertically.
 func (c *Cell) Merge(hcells, vcells int) {
 	c.updatable()
+	if c.auditing() {
+		c.audit(AuditMerge, fmt.Sprintf("%d,%d", c.HMerge, c.VMerge), fmt.Sprintf("%d,%d", hcells, vcells))
+	}
 	c.HMerge = hcells
 	c.VMerge = vcells
 	c.modified = true
@@ -192,19 +249,40 @@ func (c *Cell) Type() CellType {
 // SetString sets the value of a cell to a string.
 func (c *Cell) SetString(s string) {
 	c.updatable()
+	c.audit(AuditSetValue, c.Value, s)
 	c.Value = s
 	c.RichText = nil
-	c.formula = ""
+	c.clearFormula()
 	c.cellType = CellTypeString
 	c.modified = true
 }
 
+// SetStringLiteral sets the value of a cell to a string that is
+// always treated as literal text.  If the string starts with "=" the
+// cell's Style is given a QuotePrefix, so that Excel doesn't treat the
+// value as a formula when it is edited.
+func (c *Cell) SetStringLiteral(s string) {
+	c.SetString(s)
+	if strings.HasPrefix(s, "=") {
+		style := c.GetStyle().Clone()
+		style.QuotePrefix = true
+		c.SetStyle(style)
+	}
+}
+
 // SetRichText sets the value of a cell to a set of the rich text.
 func (c *Cell) SetRichText(r []RichTextRun) {
 	c.updatable()
-	c.Value = ""
+	if c.auditing() {
+		var text strings.Builder
+		for _, run := range r {
+			text.WriteString(run.Text)
+		}
+		c.audit(AuditSetValue, c.Value, text.String())
+	}
+	c.Value = richTextToPlainText(r)
 	c.RichText = append([]RichTextRun(nil), r...)
-	c.formula = ""
+	c.clearFormula()
 	c.cellType = CellTypeString
 	c.modified = true
 }
@@ -259,16 +337,31 @@ func (c *Cell) SetFloatWithFormat(n float64, format string) {
 	c.updatable()
 	c.SetValue(n)
 	c.NumFmt = format
-	c.formula = ""
+	c.clearFormula()
 }
 
 // SetCellFormat set cell value  format
 func (c *Cell) SetFormat(format string) {
 	c.updatable()
+	c.audit(AuditSetFormat, c.NumFmt, format)
 	c.NumFmt = format
 	c.modified = true
 }
 
+// SetFormatChecked is like SetFormat, but it returns an error, and
+// leaves the cell's format alone, if format isn't a number format that
+// Excel would accept, such as one with an unmatched quote or bracket,
+// more than four sections, or a letter that isn't a format code.
+// SetFormat doesn't check the format, so that code that relies on it
+// keeps working.
+func (c *Cell) SetFormatChecked(format string) error {
+	if err := validateNumberFormat(format); err != nil {
+		return err
+	}
+	c.SetFormat(format)
+	return nil
+}
+
 // DateTimeOptions are additional options for exporting times
 type DateTimeOptions struct {
 	// Location allows calculating times in other timezones/locations
@@ -280,6 +373,7 @@ type DateTimeOptions struct {
 var (
 	DefaultDateFormat     = builtInNumFmt[14]
 	DefaultDateTimeFormat = builtInNumFmt[22]
+	DefaultDurationFormat = builtInNumFmt[46]
 
 	DefaultDateOptions = DateTimeOptions{
 		Location:        timeLocationUTC,
@@ -303,24 +397,60 @@ func (c *Cell) SetDateTime(t time.Time) {
 	c.SetDateWithOptions(t, DefaultDateTimeOptions)
 }
 
+// SetDateTimeInLocation sets the value of a cell to the date and time
+// that t shows on a clock in loc.  Excel stores dates and times with
+// no time zone, so a time is always written as the time of day in
+// some zone, which for SetDateTime is UTC.  A nil loc uses the zone t
+// already has, as given by t.Location.
+func (c *Cell) SetDateTimeInLocation(t time.Time, loc *time.Location) {
+	c.updatable()
+	if loc == nil {
+		loc = t.Location()
+	}
+	c.SetDateWithOptions(t, DateTimeOptions{
+		Location:        loc,
+		ExcelTimeFormat: DefaultDateTimeFormat,
+	})
+}
+
 // SetDateWithOptions allows for more granular control when exporting dates and times
 func (c *Cell) SetDateWithOptions(t time.Time, options DateTimeOptions) {
 	c.updatable()
-	_, offset := t.In(options.Location).Zone()
-	t = time.Unix(t.Unix()+int64(offset), 0)
-	c.SetDateTimeWithFormat(TimeToExcelTime(t.In(timeLocationUTC), c.date1904), options.ExcelTimeFormat)
+	if options.Location != nil {
+		t = t.In(options.Location)
+	}
+	// The clock time in the location, without its zone.
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), timeLocationUTC)
+	c.SetDateTimeWithFormat(TimeToExcelTime(t, c.date1904), options.ExcelTimeFormat)
 	c.modified = true
 }
 
 func (c *Cell) SetDateTimeWithFormat(n float64, format string) {
 	c.updatable()
-	c.Value = strconv.FormatFloat(n, 'f', -1, 64)
+	value := strconv.FormatFloat(n, 'f', -1, 64)
+	c.audit(AuditSetValue, c.Value, value)
+	c.Value = value
 	c.NumFmt = format
-	c.formula = ""
+	c.clearFormula()
 	c.cellType = CellTypeNumeric
 	c.modified = true
 }
 
+// SetDuration sets the value of a cell to a duration, as the fraction
+// of a day that Excel uses for times, shown in elapsed hours, minutes
+// and seconds, such as "53:10:00".
+func (c *Cell) SetDuration(d time.Duration) {
+	c.updatable()
+	c.SetDurationWithFormat(d, DefaultDurationFormat)
+}
+
+// SetDurationWithFormat sets the value of a cell to a duration, shown
+// with the given time format, such as "[mm]:ss".
+func (c *Cell) SetDurationWithFormat(d time.Duration, format string) {
+	c.updatable()
+	c.SetDateTimeWithFormat(float64(d)/float64(24*time.Hour), format)
+}
+
 // Float returns the value of cell as a number.
 func (c *Cell) Float() (float64, error) {
 	f, err := strconv.ParseFloat(c.Value, 64)
@@ -345,9 +475,9 @@ func (c *Cell) Int64() (int64, error) {
 	return f, nil
 }
 
-// GeneralNumeric returns the value of the cell as a string. It is formatted very closely to the the XLSX spec for how
-// to display values when the storage type is Number and the format type is General. It is not 100% identical to the
-// spec but is as close as you can get using the built in Go formatting tools.
+// GeneralNumeric returns the value of the cell as a string, formatted as Excel displays a Number with the General
+// format: with at most 11 characters, not counting the sign, and in scientific notation when the number doesn't fit
+// otherwise.
 func (c *Cell) GeneralNumeric() (string, error) {
 	return generalNumericScientific(c.Value, true)
 }
@@ -390,45 +520,238 @@ func (c *Cell) SetHyperlink(hyperlink string, displayText string, tooltip string
 	}
 }
 
-// SetInt sets a cell's value to an integer.
+// SetInternalHyperlink sets this cell to link to a location in the
+// workbook, such as "'Sheet 2'!A1" or a defined name, which isn't
+// written as a relationship of the sheet.  The cell's value isn't
+// changed.
+func (c *Cell) SetInternalHyperlink(location string) {
+	c.updatable()
+	c.Hyperlink = Hyperlink{Location: location}
+	c.modified = true
+}
+
+// SetValue sets a cell's value to n, choosing the type of the cell
+// from the type of n.  Integers and floats of every width become
+// numbers, as do *big.Int, *big.Float and *big.Rat, and any
+// fmt.Stringer, such as a decimal type, whose String is a plain
+// decimal number.  A float that is infinite or not a number, which
+// Excel can't hold, becomes the error value #NUM!.  bool, time.Time
+// and time.Duration are set with SetBool, SetDateTime and SetDuration.
+// nil, and a nil pointer, give an empty string.  Named types are
+// treated as the type they are based on, a pointer as what it points
+// to, and anything else is set as the string given by fmt.Sprint.
 func (c *Cell) SetValue(n interface{}) {
 	c.updatable()
 	switch t := n.(type) {
 	case time.Time:
 		c.SetDateTime(t)
 		return
+	case time.Duration:
+		c.SetDuration(t)
 	case int, int8, int16, int32, int64:
 		c.SetNumeric(fmt.Sprintf("%d", n))
+	case uint, uint8, uint16, uint32, uint64, uintptr:
+		c.SetNumeric(fmt.Sprintf("%d", n))
 	case float64:
-		// When formatting floats, do not use fmt.Sprintf("%v", n), this will cause numbers below 1e-4 to be printed in
-		// scientific notation. Scientific notation is not a valid way to store numbers in XML.
-		// Also not not use fmt.Sprintf("%f", n), this will cause numbers to be stored as X.XXXXXX. Which means that
-		// numbers will lose precision and numbers with fewer significant digits such as 0 will be stored as 0.000000
-		// which causes tests to fail.
-		c.SetNumeric(strconv.FormatFloat(t, 'f', -1, 64))
+		c.setFloatValue(t, 64)
 	case float32:
-		c.SetNumeric(strconv.FormatFloat(float64(t), 'f', -1, 32))
+		c.setFloatValue(float64(t), 32)
+	case bool:
+		c.SetBool(t)
+	case ErrValue:
+		c.SetError(t)
 	case string:
 		c.SetString(t)
 	case []byte:
 		c.SetString(string(t))
 	case nil:
 		c.SetString("")
+	case *big.Int:
+		if t == nil {
+			c.SetString("")
+			return
+		}
+		c.SetNumeric(t.String())
+	case *big.Float:
+		if t == nil {
+			c.SetString("")
+			return
+		}
+		if t.IsInf() {
+			c.SetError(ErrorNum)
+			return
+		}
+		c.SetNumeric(t.Text('f', -1))
+	case *big.Rat:
+		if t == nil {
+			c.SetString("")
+			return
+		}
+		f, _ := t.Float64()
+		c.setFloatValue(f, 64)
+	case fmt.Stringer:
+		v := reflect.ValueOf(n)
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			c.SetString("")
+			return
+		}
+		s := t.String()
+		if isDecimalString(s) {
+			c.SetNumeric(s)
+			return
+		}
+		c.SetString(s)
 	default:
-		c.SetString(fmt.Sprintf("%v", n))
+		v := reflect.ValueOf(n)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			c.SetNumeric(strconv.FormatInt(v.Int(), 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			c.SetNumeric(strconv.FormatUint(v.Uint(), 10))
+		case reflect.Float32:
+			c.setFloatValue(v.Float(), 32)
+		case reflect.Float64:
+			c.setFloatValue(v.Float(), 64)
+		case reflect.Bool:
+			c.SetBool(v.Bool())
+		case reflect.String:
+			c.SetString(v.String())
+		case reflect.Ptr:
+			if v.IsNil() {
+				c.SetString("")
+				return
+			}
+			c.SetValue(v.Elem().Interface())
+		default:
+			c.SetString(fmt.Sprint(n))
+		}
+	}
+}
+
+// setFloatValue sets a cell's value to f, which has the given bit
+// size, or to #NUM! if f is infinite or not a number.
+func (c *Cell) setFloatValue(f float64, bitSize int) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		c.SetError(ErrorNum)
+		return
+	}
+	// When formatting floats, do not use fmt.Sprintf("%v", n), this will cause numbers below 1e-4 to be printed in
+	// scientific notation. Scientific notation is not a valid way to store numbers in XML.
+	// Also not not use fmt.Sprintf("%f", n), this will cause numbers to be stored as X.XXXXXX. Which means that
+	// numbers will lose precision and numbers with fewer significant digits such as 0 will be stored as 0.000000
+	// which causes tests to fail.
+	c.SetNumeric(strconv.FormatFloat(f, 'f', -1, bitSize))
+}
+
+// isDecimalString reports whether s is a finite number written with
+// decimal digits, which can be stored as the value of a numeric cell.
+func isDecimalString(s string) bool {
+	if s == "" || strings.ContainsAny(s, "xX_") {
+		return false
 	}
+	f, err := strconv.ParseFloat(s, 64)
+	return err == nil && !math.IsInf(f, 0) && !math.IsNaN(f)
+}
+
+// ErrValue is one of the error values that a cell can hold, such as
+// the result of a formula that divides by zero.
+type ErrValue string
+
+// These are the standard error values of Excel.
+const (
+	ErrorNull  ErrValue = "#NULL!"
+	ErrorDiv0  ErrValue = "#DIV/0!"
+	ErrorValue ErrValue = "#VALUE!"
+	ErrorRef   ErrValue = "#REF!"
+	ErrorName  ErrValue = "#NAME?"
+	ErrorNum   ErrValue = "#NUM!"
+	ErrorNA    ErrValue = "#N/A"
+)
+
+// SetError sets a cell's value to an error value.
+func (c *Cell) SetError(e ErrValue) {
+	c.updatable()
+	c.audit(AuditSetValue, c.Value, string(e))
+	c.Value = string(e)
+	c.RichText = nil
+	c.clearFormula()
+	c.cellType = CellTypeError
+	c.modified = true
+}
+
+// IsError reports whether the cell holds an error value.
+func (c *Cell) IsError() bool {
+	return c.cellType == CellTypeError
+}
+
+// ErrorValue returns the error value that the cell holds, or "" if it
+// doesn't hold one.
+func (c *Cell) ErrorValue() ErrValue {
+	if c.cellType != CellTypeError {
+		return ""
+	}
+	return ErrValue(c.Value)
 }
 
 // SetNumeric sets a cell's value to a number
 func (c *Cell) SetNumeric(s string) {
 	c.updatable()
+	c.audit(AuditSetValue, c.Value, s)
 	c.Value = s
 	c.NumFmt = builtInNumFmt[builtInNumFmtIndex_GENERAL]
-	c.formula = ""
+	c.clearFormula()
 	c.cellType = CellTypeNumeric
 	c.modified = true
 }
 
+// SetNumericString sets a cell's value to the decimal number s, such
+// as "123456789012345678" or "-0.000000000000000001", which is stored
+// as it is, without the loss of precision that converting it to a
+// float64 would bring.  It returns an error, and leaves the cell alone,
+// if s isn't a decimal number: an optional minus sign and digits, with
+// an optional decimal point followed by more digits.  Note that Excel
+// itself only keeps 15 significant digits of a number it edits.
+func (c *Cell) SetNumericString(s string) error {
+	if !isPlainDecimal(s) {
+		return fmt.Errorf("Cell.SetNumericString: %q isn't a decimal number", s)
+	}
+	c.SetNumeric(s)
+	return nil
+}
+
+// RawNumeric returns the text of the value of a numeric cell as it is
+// stored, such as "123456789012345678", which Float and Int64 would
+// lose the last digits of.  It returns an empty string if the cell
+// isn't numeric.
+func (c *Cell) RawNumeric() string {
+	if c.cellType != CellTypeNumeric {
+		return ""
+	}
+	return strings.TrimSpace(c.Value)
+}
+
+// isPlainDecimal reports whether s is an optional minus sign and
+// digits, with an optional decimal point followed by more digits.
+func isPlainDecimal(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+		if fracPart == "" {
+			return false
+		}
+	}
+	if intPart == "" {
+		return false
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // Int returns the value of cell as integer.
 // Has max 53 bits of precision
 // See: float64(int64(math.MaxInt))
@@ -443,62 +766,239 @@ func (c *Cell) Int() (int, error) {
 // SetBool sets a cell's value to a boolean.
 func (c *Cell) SetBool(b bool) {
 	c.updatable()
+	value := "0"
 	if b {
-		c.Value = "1"
-	} else {
-		c.Value = "0"
+		value = "1"
 	}
+	c.audit(AuditSetValue, c.Value, value)
+	c.Value = value
+	c.clearFormula()
 	c.cellType = CellTypeBool
 	c.modified = true
 }
 
-// Bool returns a boolean from a cell's value.
-// TODO: Determine if the current return value is
-// appropriate for types other than CellTypeBool.
+// Bool returns a boolean from a cell's value.  A boolean cell holds 1
+// or 0, a numeric cell is true if it isn't zero, the text TRUE or
+// FALSE, in any case, is taken as what it says, and any other cell is
+// true if it isn't empty.  Use BoolChecked to find out whether the
+// value was really a boolean.
 func (c *Cell) Bool() bool {
-	// If bool, just return the value.
-	if c.cellType == CellTypeBool {
-		return c.Value == "1"
+	b, _ := c.BoolChecked()
+	return b
+}
+
+// BoolChecked returns a boolean from a cell's value in the same way as
+// Bool, along with an error if the value isn't a boolean, a number or
+// the text TRUE or FALSE.
+func (c *Cell) BoolChecked() (bool, error) {
+	switch {
+	case strings.EqualFold(c.Value, "TRUE"):
+		return true, nil
+	case strings.EqualFold(c.Value, "FALSE"):
+		return false, nil
+	}
+	switch c.cellType {
+	case CellTypeBool:
+		switch c.Value {
+		case "1":
+			return true, nil
+		case "0":
+			return false, nil
+		}
+		return false, fmt.Errorf("invalid value %q in bool cell", c.Value)
+	case CellTypeNumeric:
+		if c.Value == "" {
+			return false, nil
+		}
+		n, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil {
+			return c.Value != "0", err
+		}
+		return n != 0, nil
 	}
-	// If numeric, base it on a non-zero.
-	if c.cellType == CellTypeNumeric {
-		return c.Value != "0"
+	if c.Value == "" {
+		return false, nil
 	}
-	// Return whether there's an empty string.
-	return c.Value != ""
+	return true, fmt.Errorf("the value %q isn't a boolean", c.Value)
 }
 
-// SetFormula sets the format string for a cell.
+// SetFormula sets the formula of a cell, which gives a number.  The
+// cell's value, which is kept as the cached result of the formula, is
+// cleared, as it won't be the result of the new formula, and Excel is
+// asked to recalculate the workbook when it's opened.  Use
+// SetFormulaResult afterwards if the result is known.
 func (c *Cell) SetFormula(formula string) {
 	c.updatable()
+	c.audit(AuditSetFormula, c.formula, formula)
 	c.formula = formula
+	c.Value = ""
+	c.RichText = nil
 	c.cellType = CellTypeNumeric
 	c.modified = true
 }
 
+// SetStringFormula sets the formula of a cell, which gives a string.
+// As with SetFormula, the cell's cached result is cleared.
 func (c *Cell) SetStringFormula(formula string) {
 	c.updatable()
+	c.audit(AuditSetFormula, c.formula, formula)
 	c.formula = formula
+	c.Value = ""
+	c.RichText = nil
 	c.cellType = CellTypeStringFormula
 	c.modified = true
 }
 
+// SetFormulaResult sets the cached result of the cell's formula, which
+// is written as the cell's value, so that it can be shown without the
+// workbook being recalculated.  It doesn't change the formula.
+func (c *Cell) SetFormulaResult(value string) {
+	c.updatable()
+	c.audit(AuditSetValue, c.Value, value)
+	c.Value = value
+	c.modified = true
+}
+
+// SetFormulaAndValue sets the formula of a cell together with its
+// cached result, which is written as the cell's value, so that programs
+// that read the value rather than recalculating see the result.  The
+// type of value decides the type, and for times and durations the
+// number format, of the cell, just as with SetValue; a nil value leaves
+// the formula without a cached result, as SetFormula does.
+func (c *Cell) SetFormulaAndValue(formula string, value interface{}) {
+	c.updatable()
+	if value == nil {
+		c.SetFormula(formula)
+		return
+	}
+	// SetValue clears the formula, so it is set afterwards.
+	oldFormula := c.formula
+	c.SetValue(value)
+	c.audit(AuditSetFormula, oldFormula, formula)
+	c.formula = formula
+	if c.cellType == CellTypeString {
+		c.cellType = CellTypeStringFormula
+	}
+	c.modified = true
+}
+
+// SetFormulaAndFloat sets the formula of a cell, which gives a number,
+// together with its cached result.
+func (c *Cell) SetFormulaAndFloat(formula string, result float64) {
+	c.SetFormula(formula)
+	c.SetFormulaResult(strconv.FormatFloat(result, 'f', -1, 64))
+}
+
+// SetFormulaAndString sets the formula of a cell, which gives a
+// string, together with its cached result.
+func (c *Cell) SetFormulaAndString(formula string, result string) {
+	c.SetStringFormula(formula)
+	c.SetFormulaResult(result)
+}
+
+// SetFormulaAndBool sets the formula of a cell, which gives a boolean,
+// together with its cached result.
+func (c *Cell) SetFormulaAndBool(formula string, result bool) {
+	c.SetFormula(formula)
+	value := "0"
+	if result {
+		value = "1"
+	}
+	c.SetFormulaResult(value)
+	c.cellType = CellTypeBool
+}
+
+// ClearCachedResult clears the cached result of the cell's formula, so
+// that none is written and Excel recalculates the workbook when it's
+// opened.  It does nothing if the cell doesn't have a formula.
+func (c *Cell) ClearCachedResult() {
+	if c.formula == "" || c.Value == "" {
+		return
+	}
+	c.updatable()
+	c.audit(AuditSetValue, c.Value, "")
+	c.Value = ""
+	c.modified = true
+}
+
+// Clear removes the value of the cell and its formula, leaving it
+// without a type, so that it is written without one and isn't counted
+// by COUNTA.  Its style, number format, data validation and hyperlink
+// are kept; use ClearAll to remove those as well, or Row.RemoveCellAt
+// to remove the cell altogether.
+func (c *Cell) Clear() {
+	c.updatable()
+	c.audit(AuditSetValue, c.Value, "")
+	c.Value = ""
+	c.RichText = nil
+	c.clearFormula()
+	c.cellType = CellTypeString
+	c.modified = true
+}
+
+// ClearAll removes the value of the cell, as Clear does, and also its
+// style, number format, data validation and hyperlink.
+func (c *Cell) ClearAll() {
+	c.Clear()
+	if c.style != nil {
+		c.audit(AuditSetStyle, "", "")
+	}
+	c.style = nil
+	c.NumFmt = ""
+	c.parsedNumFmt = nil
+	c.DataValidation = nil
+	c.Hyperlink = Hyperlink{}
+}
+
 // Formula returns the formula string for the cell.
 func (c *Cell) Formula() string {
 	return c.formula
 }
 
+// clearFormula removes the cell's formula, when it's given a literal
+// value instead, and records against its File that the cached results
+// of any formulas that refer to the cell may now be out of date.
+func (c *Cell) clearFormula() {
+	c.formula = ""
+	if c.Row != nil && c.Row.Sheet != nil && c.Row.Sheet.File != nil {
+		c.Row.Sheet.File.formulaResultsStale = true
+	}
+}
+
 // GetStyle returns the Style associated with a Cell
 func (c *Cell) GetStyle() *Style {
 	if c.style == nil {
-		c.style = NewStyle()
+		if style, _ := c.defaultStyle(); style != nil {
+			c.style = style.Clone()
+		} else {
+			c.style = NewStyle()
+		}
 	}
 	return c.style
 }
 
+// defaultStyle returns the style and number format that a Cell
+// without a style of its own takes from its Row or, failing that, its
+// Col.
+func (c *Cell) defaultStyle() (*Style, string) {
+	if c.Row == nil {
+		return nil, ""
+	}
+	if c.Row.style != nil || c.Row.numFmt != "" {
+		return c.Row.style, c.Row.numFmt
+	}
+	if c.Row.Sheet != nil && c.Row.Sheet.Cols != nil {
+		if col := c.Row.Sheet.Col(c.num); col != nil {
+			return col.style, col.numFmt
+		}
+	}
+	return nil, ""
+}
+
 // SetStyle sets the style of a cell.
 func (c *Cell) SetStyle(style *Style) {
 	c.updatable()
+	c.audit(AuditSetStyle, "", "")
 	c.style = style
 	c.modified = true
 }
@@ -527,25 +1027,120 @@ func (c *Cell) formatToInt(format string) (string, error) {
 // getNumberFormat will update the parsedNumFmt struct if it has become out of date, since a cell's NumFmt string is a
 // public field that could be edited by clients.
 func (c *Cell) getNumberFormat() *parsedNumberFormat {
-	if c.parsedNumFmt == nil || c.parsedNumFmt.numFmt != c.NumFmt {
-		c.parsedNumFmt = parseFullNumberFormatString(c.NumFmt)
+	numFmt := c.NumFmt
+	if numFmt == "" && c.style == nil {
+		_, numFmt = c.defaultStyle()
+	}
+	if c.parsedNumFmt == nil || c.parsedNumFmt.numFmt != numFmt {
+		c.parsedNumFmt = parseFullNumberFormatString(numFmt)
 	}
 	return c.parsedNumFmt
 }
 
+// localizedDateNames reports whether the File of the cell was opened
+// with the LocalizedDateNames option.
+func (c *Cell) localizedDateNames() bool {
+	return c.Row != nil && c.Row.Sheet != nil && c.Row.Sheet.File != nil && c.Row.Sheet.File.localizedDateNames
+}
+
+// file returns the File that the cell belongs to, or nil if it doesn't
+// belong to one.
+func (c *Cell) file() *File {
+	if c.Row == nil || c.Row.Sheet == nil {
+		return nil
+	}
+	return c.Row.Sheet.File
+}
+
+// fillWidth returns the width that the File of the cell was opened with
+// the FillWidth option for, or 0.
+func (c *Cell) fillWidth() int {
+	if f := c.file(); f != nil {
+		return f.fillWidth
+	}
+	return 0
+}
+
+// rawValues reports whether the File of the cell was opened with the
+// RawCellValues option.
+func (c *Cell) rawValues() bool {
+	f := c.file()
+	return f != nil && f.rawCellValues
+}
+
+// RawValue returns the value that the cell stores, without applying its
+// number format: the text of a string, the number of a date, such as
+// "44197.5", or "1" or "0" for a boolean.  It is the same as the Value
+// field, and is the same with or without the RawCellValues option.
+func (c *Cell) RawValue() string {
+	return c.Value
+}
+
+// NumFmtID returns the id of the cell's number format: 0 for General,
+// the id that the specification gives the built-in formats, such as 14
+// for "mm-dd-yy", or the id of a custom format in the stylesheet of the
+// cell's File, which is 164 or more.  A cell read with one of the
+// built-in formats whose codes depend on the language of Excel, such
+// as 31, returns the id that it was read with while its NumFmt is
+// unchanged.  -1 is returned for a custom
+// format that isn't in the stylesheet, as when it has been given to
+// the cell since the File was read; it is added when the File is
+// saved.
+func (c *Cell) NumFmtID() int {
+	if compareFormatString(c.NumFmt, "general") {
+		return 0
+	}
+	if isLocaleBuiltInNumFmt(c.numFmtId) && builtInNumFmt[c.numFmtId] == c.NumFmt {
+		return c.numFmtId
+	}
+	if numFmtId, ok := builtInNumFmtInv[c.NumFmt]; ok {
+		return numFmtId
+	}
+	if f := c.file(); f != nil && f.styles != nil && f.styles.NumFmts != nil {
+		for _, numFmt := range f.styles.NumFmts.NumFmt {
+			if numFmt.FormatCode == c.NumFmt {
+				return numFmt.NumFmtId
+			}
+		}
+	}
+	return -1
+}
+
 // FormattedValue returns a value, and possibly an error condition
 // from a Cell.  If it is possible to apply a format to the cell
 // value, it will do so, if not then an error will be returned, along
-// with the raw value of the Cell.
+// with the raw value of the Cell.  If the File was opened with the
+// RawCellValues option, the raw value is returned without a format
+// being applied.
 func (c *Cell) FormattedValue() (string, error) {
+	// An error value is shown as it is, whatever the number format.
+	if c.rawValues() || c.cellType == CellTypeError {
+		return c.Value, nil
+	}
 	fullFormat := c.getNumberFormat()
 	returnVal, err := fullFormat.FormatValue(c)
+	returnVal = expandFill(returnVal, c.fillWidth())
 	if fullFormat.parseEncounteredError != nil {
 		return returnVal, *fullFormat.parseEncounteredError
 	}
 	return returnVal, err
 }
 
+// FormattedValueWithColor returns the same value and error as
+// FormattedValue, along with the color that the section of the number
+// format used for the value is displayed in, such as the [Red] of the
+// negative section of "#,##0.00;[Red](#,##0.00)".  The color is an
+// ARGB hex string, such as "FFFF0000", or empty if the section doesn't
+// have one.  [Color1] to [Color56] are mapped through the default
+// palette of indexed colors.
+func (c *Cell) FormattedValueWithColor() (string, string, error) {
+	value, err := c.FormattedValue()
+	if c.rawValues() || c.cellType == CellTypeError {
+		return value, "", err
+	}
+	return value, c.getNumberFormat().color(c), err
+}
+
 // SetDataValidation set data validation
 func (c *Cell) SetDataValidation(dd *xlsxDataValidation) {
 	c.updatable()
@@ -553,6 +1148,25 @@ func (c *Cell) SetDataValidation(dd *xlsxDataValidation) {
 	c.modified = true
 }
 
+// GetDataValidation returns the data validation that applies to the
+// cell: its own, if it has been given one with SetDataValidation, or
+// else the first of the DataValidations of its Sheet whose ranges
+// cover it, or nil if there is none.
+func (c *Cell) GetDataValidation() *xlsxDataValidation {
+	if c.DataValidation != nil {
+		return c.DataValidation
+	}
+	if c.Row == nil || c.Row.Sheet == nil {
+		return nil
+	}
+	for _, dv := range c.Row.Sheet.DataValidations {
+		if dv.covers(c.num, c.Row.num) {
+			return dv
+		}
+	}
+	return nil
+}
+
 // GetCoordinates returns a pair of integers representing the
 // cartesian coorindates of the Cell within the Sheet.  The
 // coordinates are zero based and a returned in order x,y where x is
@@ -562,3 +1176,8 @@ func (c *Cell) SetDataValidation(dd *xlsxDataValidation) {
 func (c *Cell) GetCoordinates() (int, int) {
 	return c.num, c.Row.num
 }
+
+// Ref returns the A1-style reference of the cell, such as "BD17".
+func (c *Cell) Ref() string {
+	return GetCellIDStringFromCoords(c.num, c.Row.num)
+}
@@ -1,7 +1,9 @@
 package xlsx
 
 import (
+	"bytes"
 	"math"
+	"math/big"
 	"path/filepath"
 	"testing"
 	"time"
@@ -406,9 +408,10 @@ func TestCell(t *testing.T) {
 		cell.NumFmt = "general"
 		c.Assert(cell.Modified(), qt.Equals, true)
 
-		fvc.Equals(cell, "37947.7500001")
+		// General shows at most 11 characters, not counting the sign.
+		fvc.Equals(cell, "37947.75")
 		negativeCell.NumFmt = "general"
-		fvc.Equals(negativeCell, "-37947.7500001")
+		fvc.Equals(negativeCell, "-37947.75")
 
 		// TODO: This test is currently broken.  For a string type cell, I
 		// don't think FormattedValue() should be doing a numeric conversion on the value
@@ -432,13 +435,15 @@ func TestCell(t *testing.T) {
 		// non-comma form.
 		fvc.Equals(cell, "37947.75")
 
+		// The space after the positive section lines its digits up
+		// with those of the negative section, inside the parentheses.
 		cell.NumFmt = "#,##0 ;(#,##0)"
-		fvc.Equals(cell, "37948")
+		fvc.Equals(cell, "37948 ")
 		negativeCell.NumFmt = "#,##0 ;(#,##0)"
 		fvc.Equals(negativeCell, "(37948)")
 
 		cell.NumFmt = "#,##0 ;[red](#,##0)"
-		fvc.Equals(cell, "37948")
+		fvc.Equals(cell, "37948 ")
 		negativeCell.NumFmt = "#,##0 ;[red](#,##0)"
 		fvc.Equals(negativeCell, "(37948)")
 
@@ -452,10 +457,10 @@ func TestCell(t *testing.T) {
 		fvc.Equals(cell, "3794775.00%")
 
 		cell.NumFmt = "0.00e+00"
-		fvc.Equals(cell, "3.794775e+04")
+		fvc.Equals(cell, "3.79E+04")
 
-		cell.NumFmt = "##0.0e+0" // This is wrong, but we'll use it for now.
-		fvc.Equals(cell, "3.794775e+04")
+		cell.NumFmt = "##0.0e+0"
+		fvc.Equals(cell, "37.9E+3")
 
 		cell.NumFmt = "mm-dd-yy"
 		fvc.Equals(cell, "11-22-03")
@@ -488,7 +493,7 @@ func TestCell(t *testing.T) {
 		cell.NumFmt = "h:mm"
 		fvc.Equals(cell, "18:00")
 		smallCell.NumFmt = "h:mm"
-		fvc.Equals(smallCell, "00:10")
+		fvc.Equals(smallCell, "0:10")
 		smallCell.NumFmt = "hh:mm"
 		fvc.Equals(smallCell, "00:10")
 
@@ -500,20 +505,20 @@ func TestCell(t *testing.T) {
 		smallCell.NumFmt = "hh:mm:ss"
 		fvc.Equals(smallCell, "00:10:04")
 		smallCell.NumFmt = "h:mm:ss"
-		fvc.Equals(smallCell, "00:10:04")
+		fvc.Equals(smallCell, "0:10:04")
 
 		cell.NumFmt = "m/d/yy h:mm"
 		fvc.Equals(cell, "11/22/03 18:00")
 		cell.NumFmt = "m/d/yy hh:mm"
 		fvc.Equals(cell, "11/22/03 18:00")
 		smallCell.NumFmt = "m/d/yy h:mm"
-		fvc.Equals(smallCell, "12/30/99 00:10")
+		fvc.Equals(smallCell, "12/30/99 0:10")
 		smallCell.NumFmt = "m/d/yy hh:mm"
 		fvc.Equals(smallCell, "12/30/99 00:10")
 		earlyCell.NumFmt = "m/d/yy hh:mm"
 		fvc.Equals(earlyCell, "1/1/00 02:24")
 		earlyCell.NumFmt = "m/d/yy h:mm"
-		fvc.Equals(earlyCell, "1/1/00 02:24")
+		fvc.Equals(earlyCell, "1/1/00 2:24")
 
 		cell.NumFmt = "mm:ss"
 		fvc.Equals(cell, "00:00")
@@ -521,29 +526,32 @@ func TestCell(t *testing.T) {
 		fvc.Equals(smallCell, "10:04")
 
 		cell.NumFmt = "[hh]:mm:ss"
-		fvc.Equals(cell, "18:00:00")
+		fvc.Equals(cell, "910746:00:00")
 		cell.NumFmt = "[h]:mm:ss"
-		fvc.Equals(cell, "18:00:00")
+		fvc.Equals(cell, "910746:00:00")
 		smallCell.NumFmt = "[h]:mm:ss"
-		fvc.Equals(smallCell, "10:04")
-
-		const (
-			expect1 = "0000.0086"
-			expect2 = "1004.8000"
-			format  = "mmss.0000"
-			tlen    = len(format)
-		)
-
-		for i := 0; i < 3; i++ {
-			tfmt := format[0 : tlen-i]
-			cell.NumFmt = tfmt
-			fvc.Equals(cell, expect1[0:tlen-i])
-			smallCell.NumFmt = tfmt
-			fvc.Equals(smallCell, expect2[0:tlen-i])
+		fvc.Equals(smallCell, "0:10:05")
+		smallCell.NumFmt = "[mm]:ss"
+		fvc.Equals(smallCell, "10:05")
+		earlyCell.NumFmt = "[h]:mm"
+		fvc.Equals(earlyCell, "50:24")
+
+		// Fractions of a second are rounded to the digits shown.
+		for _, tc := range []struct{ format, cell, small string }{
+			{"mmss.0000", "0000.0086", "1004.8000"},
+			{"mmss.000", "0000.009", "1004.800"},
+			{"mmss.00", "0000.01", "1004.80"},
+			{"mmss.0", "0000.0", "1004.8"},
+		} {
+			cell.NumFmt = tc.format
+			fvc.Equals(cell, tc.cell)
+			smallCell.NumFmt = tc.format
+			fvc.Equals(smallCell, tc.small)
 		}
 
+		// The backslashes escape the dashes, which are shown as they are.
 		cell.NumFmt = "yyyy\\-mm\\-dd"
-		fvc.Equals(cell, "2003\\-11\\-22")
+		fvc.Equals(cell, "2003-11-22")
 
 		cell.NumFmt = "dd/mm/yyyy hh:mm:ss"
 		fvc.Equals(cell, "22/11/2003 18:00:00")
@@ -559,7 +567,7 @@ func TestCell(t *testing.T) {
 		fvc.Equals(smallCell, "00:10:04")
 
 		cell.NumFmt = "dd/mm/yy\\ hh:mm"
-		fvc.Equals(cell, "22/11/03\\ 18:00")
+		fvc.Equals(cell, "22/11/03 18:00")
 
 		cell.NumFmt = "yyyy/mm/dd"
 		fvc.Equals(cell, "2003/11/22")
@@ -731,6 +739,57 @@ func TestCell(t *testing.T) {
 		c.Assert(cell.Bool(), qt.Equals, true)
 	})
 
+	// TestBoolChecked tests which values are taken as booleans.
+	c.Run("TestBoolChecked", func(c *qt.C) {
+		cell := Cell{}
+		for _, test := range []struct {
+			set      func()
+			expected bool
+			err      string
+		}{
+			{set: func() { cell.SetBool(true) }, expected: true},
+			{set: func() { cell.SetBool(false) }, expected: false},
+			{set: func() { cell.SetInt(2) }, expected: true},
+			{set: func() { cell.SetFloat(0) }, expected: false},
+			{set: func() { cell.SetString("true") }, expected: true},
+			{set: func() { cell.SetString("FALSE") }, expected: false},
+			{set: func() { cell.SetString("") }, expected: false},
+			{set: func() { cell.SetString("yes") }, expected: true, err: `the value "yes" isn't a boolean`},
+		} {
+			test.set()
+			b, err := cell.BoolChecked()
+			if test.err == "" {
+				c.Assert(err, qt.IsNil)
+			} else {
+				c.Assert(err, qt.ErrorMatches, test.err)
+			}
+			c.Assert(b, qt.Equals, test.expected)
+			c.Assert(cell.Bool(), qt.Equals, test.expected)
+		}
+	})
+
+	csRunO(c, "BoolRoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("BoolRoundTrip")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetBool(true)
+		row.AddCell().SetBool(false)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+
+		f, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		for col, expected := range []string{"TRUE", "FALSE"} {
+			cell, err := f.Sheets[0].Cell(0, col)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.Type(), qt.Equals, CellTypeBool)
+			value, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(value, qt.Equals, expected)
+		}
+	})
+
 	// TestSetValue tests whether SetValue handle properly for different type values.
 	c.Run("TestSetValue", func(c *qt.C) {
 		cell := Cell{}
@@ -830,6 +889,156 @@ func TestCell(t *testing.T) {
 		c.Assert(val, qt.Equals, TimeToExcelTime(time.Date(2016, 1, 1, 21, 0, 0, 0, time.UTC), false))
 	})
 
+	c.Run("TestSetValueTypes", func(c *qt.C) {
+		type myInt int
+		type myString string
+		num := 42
+		var nilInt *int
+		var nilBig *big.Int
+
+		tests := []struct {
+			value    interface{}
+			expected string
+			cellType CellType
+		}{
+			{uint(7), "7", CellTypeNumeric},
+			{uint8(7), "7", CellTypeNumeric},
+			{uint64(math.MaxUint64), "18446744073709551615", CellTypeNumeric},
+			{uintptr(7), "7", CellTypeNumeric},
+			{true, "1", CellTypeBool},
+			{false, "0", CellTypeBool},
+			{36 * time.Hour, "1.5", CellTypeNumeric},
+			{math.Inf(1), "#NUM!", CellTypeError},
+			{math.NaN(), "#NUM!", CellTypeError},
+			{big.NewInt(0).Lsh(big.NewInt(1), 70), "1180591620717411303424", CellTypeNumeric},
+			{big.NewFloat(1.25), "1.25", CellTypeNumeric},
+			{big.NewRat(1, 4), "0.25", CellTypeNumeric},
+			{nilBig, "", CellTypeString},
+			{myInt(3), "3", CellTypeNumeric},
+			{myString("text"), "text", CellTypeString},
+			{&num, "42", CellTypeNumeric},
+			{nilInt, "", CellTypeString},
+			{decimalStringer("12.50"), "12.50", CellTypeNumeric},
+			{decimalStringer("0x10"), "0x10", CellTypeString},
+			{decimalStringer("NaN"), "NaN", CellTypeString},
+			{struct{ A int }{1}, "{1}", CellTypeString},
+		}
+		for _, test := range tests {
+			cell := Cell{}
+			cell.SetValue(test.value)
+			c.Assert(cell.Value, qt.Equals, test.expected, qt.Commentf("%T", test.value))
+			c.Assert(cell.Type(), qt.Equals, test.cellType, qt.Commentf("%T", test.value))
+		}
+	})
+
+	c.Run("TestSetNumericString", func(c *qt.C) {
+		cell := Cell{}
+		c.Assert(cell.SetNumericString("123456789012345678"), qt.IsNil)
+		c.Assert(cell.Type(), qt.Equals, CellTypeNumeric)
+		c.Assert(cell.RawNumeric(), qt.Equals, "123456789012345678")
+		val, err := cell.Int64()
+		c.Assert(err, qt.IsNil)
+		c.Assert(val, qt.Equals, int64(123456789012345678))
+
+		for _, s := range []string{"", "-", "1.", ".5", "1e5", "+1", "1,000", "0x10", " 1"} {
+			err := cell.SetNumericString(s)
+			c.Assert(err, qt.ErrorMatches, `Cell.SetNumericString: ".*" isn't a decimal number`)
+		}
+		c.Assert(cell.RawNumeric(), qt.Equals, "123456789012345678")
+
+		cell.SetString("123")
+		c.Assert(cell.RawNumeric(), qt.Equals, "")
+	})
+
+	c.Run("TestFormattedValueOfNumericString", func(c *qt.C) {
+		tests := []struct {
+			value    string
+			format   string
+			expected string
+		}{
+			{"123456789012345678", "general", "123456789012345678"},
+			{"-00123456789012345678.500", "general", "-123456789012345678.5"},
+			{"0.1", "general", "0.1"},
+			{"123456789012", "general", "1.23457E+11"},
+			{"123456789012345678", "0", "123456789012345678"},
+			{"123456789012345678.5", "0", "123456789012345679"},
+			{"-123456789012345678.5", "0.00", "-123456789012345678.50"},
+			{"99999999999999999.995", "0.00", "100000000000000000.00"},
+			{"123456789012345678", "0.0%", "12345678901234567800.0%"},
+			{"123456789012345678", "0,", "123456789012346"},
+			{"-123456789012345678", "0;(0)", "(123456789012345678)"},
+			{"123456789012345678", "@", "123456789012345678"},
+		}
+		for _, test := range tests {
+			cell := Cell{}
+			c.Assert(cell.SetNumericString(test.value), qt.IsNil)
+			cell.NumFmt = test.format
+			val, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(val, qt.Equals, test.expected, qt.Commentf("%s with %s", test.value, test.format))
+		}
+	})
+
+	csRunO(c, "NumericStringRoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("NumericString")
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.AddRow().AddCell().SetNumericString("987654321098765432.1"), qt.IsNil)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		sheet.Close()
+
+		f, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.RawNumeric(), qt.Equals, "987654321098765432.1")
+	})
+
+	c.Run("TestSetDateTimeInLocation", func(c *qt.C) {
+		nyTZ, err := time.LoadLocation("America/New_York")
+		c.Assert(err, qt.IsNil)
+		t := time.Date(2016, 1, 1, 12, 0, 0, 500000000, time.UTC)
+
+		cell := Cell{}
+		cell.SetDateTimeInLocation(t, nyTZ)
+		c.Assert(cell.NumFmt, qt.Equals, DefaultDateTimeFormat)
+		val, err := cell.Float()
+		c.Assert(err, qt.IsNil)
+		c.Assert(val, qt.Equals, TimeToExcelTime(time.Date(2016, 1, 1, 7, 0, 0, 500000000, time.UTC), false))
+
+		// Without a location, the time is kept as it is shown in its own zone.
+		cell.SetDateTimeInLocation(t.In(nyTZ), nil)
+		val2, err := cell.Float()
+		c.Assert(err, qt.IsNil)
+		c.Assert(val2, qt.Equals, val)
+
+		cell.SetDateTime(t.In(nyTZ))
+		val, err = cell.Float()
+		c.Assert(err, qt.IsNil)
+		c.Assert(val, qt.Equals, TimeToExcelTime(t, false))
+	})
+
+	c.Run("TestSetDuration", func(c *qt.C) {
+		cell := Cell{}
+		cell.SetDuration(53*time.Hour + 10*time.Minute)
+		c.Assert(cell.Modified(), qt.IsTrue)
+		c.Assert(cell.Type(), qt.Equals, CellTypeNumeric)
+		c.Assert(cell.NumFmt, qt.Equals, "[h]:mm:ss")
+		val, err := cell.Float()
+		c.Assert(err, qt.IsNil)
+		c.Assert(math.Abs(val-2.2152777777777777) < 1e-12, qt.IsTrue)
+		formatted, err := cell.FormattedValue()
+		c.Assert(err, qt.IsNil)
+		c.Assert(formatted, qt.Equals, "53:10:00")
+
+		cell.SetDurationWithFormat(90*time.Second+250*time.Millisecond, "[mm]:ss.0")
+		formatted, err = cell.FormattedValue()
+		c.Assert(err, qt.IsNil)
+		c.Assert(formatted, qt.Equals, "01:30.3")
+	})
+
 	c.Run("TestIsTimeFormat", func(c *qt.C) {
 		c.Assert(isTimeFormat("yy"), qt.Equals, true)
 		c.Assert(isTimeFormat("hh"), qt.Equals, true)
@@ -955,3 +1164,290 @@ func TestCellMerge(t *testing.T) {
 		c.Assert(err, qt.Equals, nil)
 	})
 }
+
+func TestSetStringLiteral(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "QuotePrefixRoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Literal")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetStringLiteral("=A1")
+		row.AddCell().SetStringLiteral("plain")
+
+		path := filepath.Join(c.Mkdir(), "literal.xlsx")
+		c.Assert(f.Save(path), qt.IsNil)
+		f, err = OpenFile(path, option)
+		c.Assert(err, qt.IsNil)
+
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "=A1")
+		c.Assert(cell.Formula(), qt.Equals, "")
+		c.Assert(cell.GetStyle().QuotePrefix, qt.IsTrue)
+
+		cell, err = f.Sheets[0].Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "plain")
+		c.Assert(cell.GetStyle().QuotePrefix, qt.IsFalse)
+	})
+
+	c.Run("DoesNotChangeSharedStyle", func(c *qt.C) {
+		style := NewStyle()
+		cell := &Cell{}
+		cell.SetStyle(style)
+		cell.SetStringLiteral("=SUM(A1:A2)")
+		c.Assert(cell.GetStyle().QuotePrefix, qt.IsTrue)
+		c.Assert(style.QuotePrefix, qt.IsFalse)
+	})
+}
+
+func TestErrorValues(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Errors")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		cell := row.AddCell()
+		cell.SetError(ErrorDiv0)
+		c.Assert(cell.IsError(), qt.IsTrue)
+		c.Assert(cell.ErrorValue(), qt.Equals, ErrorDiv0)
+		// The number format doesn't apply to an error value.
+		cell.SetFormat("0.00")
+		value, err := cell.FormattedValue()
+		c.Assert(err, qt.IsNil)
+		c.Assert(value, qt.Equals, "#DIV/0!")
+		row.AddCell().SetValue(ErrorNA)
+		number := row.AddCell()
+		number.SetInt(1)
+		c.Assert(number.IsError(), qt.IsFalse)
+		c.Assert(number.ErrorValue(), qt.Equals, ErrValue(""))
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				written = string(body)
+			}
+			return name, body
+		})
+		streamed, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		for _, written := range []string{written, streamed["xl/worksheets/sheet1.xml"]} {
+			c.Assert(written, qt.Contains, `<c r="A1" s="1" t="e"><v>#DIV/0!</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="B1" t="e"><v>#N/A</v></c>`)
+		}
+
+		f, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		cell, err = f.Sheets[0].Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.ErrorValue(), qt.Equals, ErrorNA)
+		value, err = cell.FormattedValue()
+		c.Assert(err, qt.IsNil)
+		c.Assert(value, qt.Equals, "#N/A")
+	})
+}
+
+func TestSetFormatChecked(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "RejectsInvalidFormat", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Formats")
+		c.Assert(err, qt.IsNil)
+		cell := sheet.AddRow().AddCell()
+		cell.SetFloat(1.5)
+
+		c.Assert(cell.SetFormatChecked(`#,##0.00 "kr"`), qt.IsNil)
+		c.Assert(cell.GetNumberFormat(), qt.Equals, `#,##0.00 "kr"`)
+
+		err = cell.SetFormatChecked("0.00 kr")
+		c.Assert(err, qt.ErrorMatches, `invalid number format "0.00 kr": the letter 'k' must be quoted or escaped`)
+		c.Assert(cell.GetNumberFormat(), qt.Equals, `#,##0.00 "kr"`)
+
+		// SetFormat doesn't check the format, but it isn't added to
+		// the styles when the File is saved.
+		cell.SetFormat("0.00 kr")
+		var buf bytes.Buffer
+		err = f.Write(&buf)
+		c.Assert(err, qt.ErrorMatches, `.*cell A1: newNumFmt: invalid number format "0.00 kr": .*`)
+	})
+}
+
+func TestRawCellValues(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "ReadRaw", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("RawValues")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetFloatWithFormat(44197.5, "mm-dd-yy")
+		row.AddCell().SetFloatWithFormat(1234.5, `#,##0.00 "kr"`)
+		row.AddCell().SetString("text")
+		row.AddCell().SetFloat(2.0 / 3)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		sheet.Close()
+
+		check := func(f *File, expected []string) {
+			var values, raw []string
+			var ids []int
+			err := f.Sheets[0].ForEachRow(func(r *Row) error {
+				return r.ForEachCell(func(cell *Cell) error {
+					values = append(values, cell.String())
+					raw = append(raw, cell.RawValue())
+					ids = append(ids, cell.NumFmtID())
+					return nil
+				})
+			})
+			c.Assert(err, qt.IsNil)
+			c.Assert(values, qt.DeepEquals, expected)
+			c.Assert(raw, qt.DeepEquals, []string{"44197.5", "1234.5", "text", "0.6666666666666666"})
+			c.Assert(ids, qt.DeepEquals, []int{14, 164, 0, 0})
+		}
+
+		formatted, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		check(formatted, []string{"01-01-21", "1234.50 kr", "text", "0.666666667"})
+		formatted.Sheets[0].Close()
+
+		rawFile, err := OpenBinary(buf.Bytes(), option, RawCellValues())
+		c.Assert(err, qt.IsNil)
+		check(rawFile, []string{"44197.5", "1234.5", "text", "0.6666666666666666"})
+		// The formats were never parsed.
+		c.Assert(rawFile.styles.parsedNumFmtTable, qt.HasLen, 0)
+		cell, err := rawFile.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.GetNumberFormat(), qt.Equals, "mm-dd-yy")
+		value, color, err := cell.FormattedValueWithColor()
+		c.Assert(err, qt.IsNil)
+		c.Assert(value, qt.Equals, "44197.5")
+		c.Assert(color, qt.Equals, "")
+	})
+
+	c.Run("NumFmtIDWithoutFile", func(c *qt.C) {
+		cell := &Cell{}
+		c.Assert(cell.NumFmtID(), qt.Equals, 0)
+		cell.SetFormat("0.00")
+		c.Assert(cell.NumFmtID(), qt.Equals, 2)
+		cell.SetFormat("0.000")
+		c.Assert(cell.NumFmtID(), qt.Equals, -1)
+	})
+}
+
+// decimalStringer is a stand-in for a decimal type, which is set as a
+// number when its String is one.
+type decimalStringer string
+
+func (d decimalStringer) String() string {
+	return string(d)
+}
+
+func TestClear(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "ClearAndClearAll", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Clear")
+		c.Assert(err, qt.IsNil)
+		style := NewStyle()
+		style.Font.Bold = true
+		for col := 0; col < 2; col++ {
+			cell, err := sheet.Cell(0, col)
+			c.Assert(err, qt.IsNil)
+			cell.SetFormula("1+1")
+			cell.SetStyle(style)
+			cell.SetDataValidation(NewDataValidation(0, col, 0, col, true))
+			cell.SetInternalHyperlink("Clear!C1")
+		}
+
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.Clear()
+		c.Assert(cell.Value, qt.Equals, "")
+		c.Assert(cell.Formula(), qt.Equals, "")
+		c.Assert(cell.Type(), qt.Equals, CellTypeString)
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+		c.Assert(cell.DataValidation, qt.Not(qt.IsNil))
+		c.Assert(cell.Hyperlink.Location, qt.Equals, "Clear!C1")
+
+		cell, err = sheet.Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		cell.ClearAll()
+		c.Assert(cell.Formula(), qt.Equals, "")
+		c.Assert(cell.DataValidation, qt.IsNil)
+		c.Assert(cell.Hyperlink, qt.Equals, Hyperlink{})
+		c.Assert(cell.style, qt.IsNil)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		sheetXML := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(sheetXML, qt.Matches, `(?s).*<c r="A1" s="1"(/>|></c>).*`)
+		c.Assert(sheetXML, qt.Not(qt.Contains), `<c r="B1" s=`)
+		c.Assert(sheetXML, qt.Not(qt.Contains), `<c r="B1" t=`)
+		c.Assert(sheetXML, qt.Contains, `sqref="A1"`)
+		c.Assert(sheetXML, qt.Not(qt.Contains), `sqref="B1"`)
+		c.Assert(sheetXML, qt.Not(qt.Contains), `<f>`)
+	})
+}
+
+func TestMarkClean(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "MarkCleanAndMarkModified", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("MarkClean")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("a")
+		c.Assert(cell.Modified(), qt.IsTrue)
+		cell.MarkClean()
+		c.Assert(cell.Modified(), qt.IsFalse)
+		cell.SetString("b")
+		c.Assert(cell.Modified(), qt.IsTrue)
+		cell.MarkClean()
+		cell.MarkModified()
+		c.Assert(cell.Modified(), qt.IsTrue)
+		cell.MarkClean()
+
+		// A clean cell with a value is still written to the file.
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `<c r="A1" t="s"><v>0</v></c>`)
+		c.Assert(parts["xl/sharedStrings.xml"], qt.Contains, `<t>b</t>`)
+	})
+
+	// The DiskV and Redis cell stores only write the current cell of a
+	// row back when another cell becomes current if it is modified.
+	for name, option := range map[string]FileOption{
+		"DiskVCellStore": UseDiskVCellStore,
+		"RedisCellStore": UseRedisCellStore(RedisCellStoreOption{RedisAddr: "localhost"}),
+	} {
+		c.Run("CurrentCell/"+name, func(c *qt.C) {
+			f := NewFile(option)
+			sheet, err := f.AddSheet("MarkClean")
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(sheet.Close)
+			row := sheet.AddRow()
+			row.AddCell().SetString("a")
+			row.AddCell()
+
+			// A cell read back from the store is clean.
+			cell := row.GetCell(0)
+			c.Assert(cell.Value, qt.Equals, "a")
+			c.Assert(cell.Modified(), qt.IsFalse)
+
+			cell.SetString("b")
+			row.GetCell(1)
+			c.Assert(row.GetCell(0).Value, qt.Equals, "b")
+
+			// Changes to a cell that is marked clean aren't written.
+			cell = row.GetCell(0)
+			cell.SetString("c")
+			cell.MarkClean()
+			row.GetCell(1)
+			c.Assert(row.GetCell(0).Value, qt.Equals, "b")
+		})
+	}
+}
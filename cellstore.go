@@ -24,6 +24,26 @@ type CellStore interface {
 	Close() error
 }
 
+// sheetRenamer is implemented by the CellStores that key the rows of
+// their Sheet by its name, so that the keys can be moved to the new
+// name when the Sheet is renamed.  The current row of the Sheet must
+// have been written first.
+type sheetRenamer interface {
+	renameSheet(oldName, newName string) error
+}
+
+// cellGetter is implemented by the CellStoreRows whose GetCell can
+// fail, so that Sheet.Cell can return the error.
+type cellGetter interface {
+	getCell(colIdx int) (*Cell, error)
+}
+
+// cellRemover is implemented by the CellStoreRows that can remove a
+// cell altogether, for Row.RemoveCellAt.
+type cellRemover interface {
+	removeCell(colIdx int) error
+}
+
 // CellStoreConstructor defines the signature of a function that will
 // be used to return a new instance of the CellStore implementation,
 // you must pass this into
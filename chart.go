@@ -0,0 +1,246 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	chartRelationshipType RelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart"
+	chartContentType                       = "application/vnd.openxmlformats-officedocument.drawingml.chart+xml"
+	// defaultChartWidth and defaultChartHeight are the size in pixels
+	// of a chart with a OneCellAnchor that doesn't give one, which is
+	// the size of Excel's new charts.
+	defaultChartWidth  = 480
+	defaultChartHeight = 288
+)
+
+// ChartType is the kind of a chart.
+type ChartType int
+
+const (
+	// ChartTypeColumn is a clustered column chart, with vertical bars.
+	ChartTypeColumn ChartType = iota
+	// ChartTypeBar is a clustered bar chart, with horizontal bars.
+	ChartTypeBar
+	// ChartTypeLine is a line chart, with markers.
+	ChartTypeLine
+	// ChartTypePie is a pie chart of the first series.
+	ChartTypePie
+)
+
+// ChartSeries is a series of values plotted on a chart.  Each of its
+// references is to cells on a sheet, qualified with the sheet's name,
+// as in Sales!$B$2:$B$13 or 'Sales 2021'!$B$1, or is a name defined
+// with File.SetDefinedName that refers to cells, such as Units for a
+// name that the whole workbook can use, or Sales!Units for one scoped
+// to the sheet Sales.  The chart shows what is in the cells, so it
+// changes when they do.
+type ChartSeries struct {
+	// NameRef refers to the cell that holds the name of the series,
+	// shown in the legend, or is empty.
+	NameRef string
+	// CategoriesRef refers to the cells that hold the categories that
+	// the values are plotted against, or is empty to number them.
+	CategoriesRef string
+	// ValuesRef refers to the cells that hold the values.
+	ValuesRef string
+}
+
+// ChartSpec describes a chart to add to a sheet with Sheet.AddChart.
+type ChartSpec struct {
+	Type   ChartType
+	Title  string
+	Series []ChartSeries
+	// XAxisTitle and YAxisTitle are the titles of the category and
+	// value axes, or are empty.  A pie chart has no axes.
+	XAxisTitle string
+	YAxisTitle string
+	// Anchor is where the chart is placed, as for an image.  A chart
+	// with a OneCellAnchor that gives no size is 480 by 288 pixels.
+	Anchor ImageAnchor
+}
+
+// checkChartRef returns an error unless ref is a reference to cells on
+// a sheet, qualified with its name, or a name defined in f.
+func (f *File) checkChartRef(ref string) error {
+	sheetName, n := formulaRefSheet(ref)
+	if tokens, err := tokenizeFormula(ref[n:]); err == nil && len(tokens) == 1 && tokens[0].kind == formulaTokenName {
+		if f == nil {
+			return fmt.Errorf("name %q is not defined", ref)
+		}
+		scope, err := f.definedNameScope(sheetName)
+		if err != nil {
+			return fmt.Errorf("name %q: %w", ref, err)
+		}
+		if f.findDefinedName(ref[n:], scope) < 0 {
+			return fmt.Errorf("name %q is not defined", ref)
+		}
+		return nil
+	}
+	tokens, err := tokenizeFormula(ref)
+	if err != nil {
+		return err
+	}
+	if len(tokens) != 1 || tokens[0].kind != formulaTokenReference {
+		return fmt.Errorf("%q is not a reference to cells", ref)
+	}
+	if n == 0 {
+		return fmt.Errorf("reference %q has no sheet name", ref)
+	}
+	return nil
+}
+
+// chartRefFormula returns ref, a reference of a ChartSeries, as it is
+// written in a chart, where a name that the whole workbook can use is
+// qualified with "[0]", which stands for the workbook itself.
+func chartRefFormula(ref string) string {
+	if _, n := formulaRefSheet(ref); n > 0 {
+		return ref
+	}
+	if tokens, err := tokenizeFormula(ref); err == nil && len(tokens) == 1 && tokens[0].kind == formulaTokenName {
+		return "[0]!" + ref
+	}
+	return ref
+}
+
+// AddChart places a chart in the sheet, where the spec's Anchor says.
+// The chart is written to the file, with the drawing that places it,
+// when the file is saved.  Charts in a file that is opened aren't
+// read, but are written back out as they were, with the drawing that
+// places them.
+func (s *Sheet) AddChart(spec ChartSpec) error {
+	switch spec.Type {
+	case ChartTypeColumn, ChartTypeBar, ChartTypeLine, ChartTypePie:
+	default:
+		return fmt.Errorf("AddChart: unknown chart type %d", spec.Type)
+	}
+	if len(spec.Series) == 0 {
+		return errors.New("AddChart: the chart has no series")
+	}
+	series := make([]ChartSeries, len(spec.Series))
+	for i, ser := range spec.Series {
+		ser.NameRef = strings.TrimPrefix(ser.NameRef, "=")
+		ser.CategoriesRef = strings.TrimPrefix(ser.CategoriesRef, "=")
+		ser.ValuesRef = strings.TrimPrefix(ser.ValuesRef, "=")
+		if ser.ValuesRef == "" {
+			return fmt.Errorf("AddChart: series %d has no values", i+1)
+		}
+		for _, ref := range []string{ser.NameRef, ser.CategoriesRef, ser.ValuesRef} {
+			if ref == "" {
+				continue
+			}
+			if err := s.File.checkChartRef(ref); err != nil {
+				return fmt.Errorf("AddChart: series %d: %w", i+1, err)
+			}
+		}
+		series[i] = ser
+	}
+	spec.Series = series
+	if err := spec.Anchor.validate(); err != nil {
+		return fmt.Errorf("AddChart: %w", err)
+	}
+	if spec.Anchor.Type == OneCellAnchor && spec.Anchor.Width == 0 && spec.Anchor.Height == 0 {
+		spec.Anchor.Width, spec.Anchor.Height = defaultChartWidth, defaultChartHeight
+	}
+	s.charts = append(s.charts, &spec)
+	return nil
+}
+
+// writeChartTitle writes a title element with the text title.
+func writeChartTitle(b *strings.Builder, title string) {
+	b.WriteString(`<c:title><c:tx><c:rich><a:bodyPr/><a:lstStyle/><a:p><a:r><a:t>`)
+	b.WriteString(escapeXMLAttr(title))
+	b.WriteString(`</a:t></a:r></a:p></c:rich></c:tx><c:overlay val="0"/></c:title>`)
+}
+
+// writeChartSeries writes the ser elements of the series of spec.
+func writeChartSeries(b *strings.Builder, spec *ChartSpec) {
+	for i, ser := range spec.Series {
+		if spec.Type == ChartTypePie && i > 0 {
+			break
+		}
+		fmt.Fprintf(b, `<c:ser><c:idx val="%d"/><c:order val="%d"/>`, i, i)
+		if ser.NameRef != "" {
+			fmt.Fprintf(b, `<c:tx><c:strRef><c:f>%s</c:f></c:strRef></c:tx>`, escapeXMLAttr(chartRefFormula(ser.NameRef)))
+		}
+		switch spec.Type {
+		case ChartTypeColumn, ChartTypeBar:
+			b.WriteString(`<c:invertIfNegative val="0"/>`)
+		case ChartTypeLine:
+			b.WriteString(`<c:marker><c:symbol val="circle"/></c:marker>`)
+		}
+		if ser.CategoriesRef != "" {
+			fmt.Fprintf(b, `<c:cat><c:strRef><c:f>%s</c:f></c:strRef></c:cat>`, escapeXMLAttr(chartRefFormula(ser.CategoriesRef)))
+		}
+		fmt.Fprintf(b, `<c:val><c:numRef><c:f>%s</c:f></c:numRef></c:val>`, escapeXMLAttr(chartRefFormula(ser.ValuesRef)))
+		if spec.Type == ChartTypeLine {
+			b.WriteString(`<c:smooth val="0"/>`)
+		}
+		b.WriteString(`</c:ser>`)
+	}
+}
+
+// writeChartAxes writes the category and value axes of spec, whose ids
+// are 1 and 2.
+func writeChartAxes(b *strings.Builder, spec *ChartSpec) {
+	catPos, valPos := "b", "l"
+	if spec.Type == ChartTypeBar {
+		catPos, valPos = "l", "b"
+	}
+	fmt.Fprintf(b, `<c:catAx><c:axId val="1"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="%s"/>`, catPos)
+	if spec.XAxisTitle != "" {
+		writeChartTitle(b, spec.XAxisTitle)
+	}
+	b.WriteString(`<c:numFmt formatCode="General" sourceLinked="1"/><c:majorTickMark val="out"/><c:minorTickMark val="none"/><c:tickLblPos val="nextTo"/>`)
+	b.WriteString(`<c:crossAx val="2"/><c:crosses val="autoZero"/><c:auto val="1"/><c:lblAlgn val="ctr"/><c:lblOffset val="100"/><c:noMultiLvlLbl val="0"/></c:catAx>`)
+	fmt.Fprintf(b, `<c:valAx><c:axId val="2"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="%s"/><c:majorGridlines/>`, valPos)
+	if spec.YAxisTitle != "" {
+		writeChartTitle(b, spec.YAxisTitle)
+	}
+	b.WriteString(`<c:numFmt formatCode="General" sourceLinked="1"/><c:majorTickMark val="out"/><c:minorTickMark val="none"/><c:tickLblPos val="nextTo"/>`)
+	b.WriteString(`<c:crossAx val="1"/><c:crosses val="autoZero"/><c:crossBetween val="between"/></c:valAx>`)
+}
+
+// makeChart returns the chart part for spec.  The values of the
+// series aren't cached in it, so the application that opens the file
+// reads them from the cells.
+func makeChart(spec *ChartSpec) []byte {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<c:chartSpace xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`)
+	b.WriteString(`<c:roundedCorners val="0"/><c:chart>`)
+	if spec.Title != "" {
+		writeChartTitle(&b, spec.Title)
+		b.WriteString(`<c:autoTitleDeleted val="0"/>`)
+	} else {
+		b.WriteString(`<c:autoTitleDeleted val="1"/>`)
+	}
+	b.WriteString(`<c:plotArea><c:layout/>`)
+	switch spec.Type {
+	case ChartTypeColumn, ChartTypeBar:
+		barDir := "col"
+		if spec.Type == ChartTypeBar {
+			barDir = "bar"
+		}
+		fmt.Fprintf(&b, `<c:barChart><c:barDir val="%s"/><c:grouping val="clustered"/><c:varyColors val="0"/>`, barDir)
+		writeChartSeries(&b, spec)
+		b.WriteString(`<c:gapWidth val="150"/><c:axId val="1"/><c:axId val="2"/></c:barChart>`)
+		writeChartAxes(&b, spec)
+	case ChartTypeLine:
+		b.WriteString(`<c:lineChart><c:grouping val="standard"/><c:varyColors val="0"/>`)
+		writeChartSeries(&b, spec)
+		b.WriteString(`<c:marker val="1"/><c:axId val="1"/><c:axId val="2"/></c:lineChart>`)
+		writeChartAxes(&b, spec)
+	case ChartTypePie:
+		b.WriteString(`<c:pieChart><c:varyColors val="1"/>`)
+		writeChartSeries(&b, spec)
+		b.WriteString(`<c:firstSliceAng val="0"/></c:pieChart>`)
+	}
+	b.WriteString(`</c:plotArea>`)
+	b.WriteString(`<c:legend><c:legendPos val="r"/><c:overlay val="0"/></c:legend>`)
+	b.WriteString(`<c:plotVisOnly val="1"/><c:dispBlanksAs val="gap"/></c:chart></c:chartSpace>`)
+	return []byte(b.String())
+}
@@ -0,0 +1,206 @@
+package xlsx
+
+import (
+	"bytes"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAddChart(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sales 2021")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		for row, month := range []string{"Month", "Jan", "Feb", "Mar"} {
+			cell, err := sheet.Cell(row, 0)
+			c.Assert(err, qt.IsNil)
+			cell.SetString(month)
+			cell, err = sheet.Cell(row, 1)
+			c.Assert(err, qt.IsNil)
+			if row == 0 {
+				cell.SetString("Units")
+			} else {
+				cell.SetInt(row * 10)
+			}
+		}
+		err = sheet.AddImage(makeTestImage(c, "png", 4, 4), "png", ImageAnchor{})
+		c.Assert(err, qt.IsNil)
+		series := []ChartSeries{{
+			NameRef:       "'Sales 2021'!$B$1",
+			CategoriesRef: "='Sales 2021'!$A$2:$A$4",
+			ValuesRef:     "'Sales 2021'!$B$2:$B$4",
+		}}
+		err = sheet.AddChart(ChartSpec{
+			Type:       ChartTypeBar,
+			Title:      "Units & months",
+			Series:     series,
+			XAxisTitle: "Month",
+			Anchor:     ImageAnchor{From: ImageAnchorPoint{Col: 3, Row: 1}},
+		})
+		c.Assert(err, qt.IsNil)
+		err = sheet.AddChart(ChartSpec{
+			Type:   ChartTypePie,
+			Series: series,
+			Anchor: ImageAnchor{
+				Type: TwoCellAnchor,
+				From: ImageAnchorPoint{Col: 3, Row: 20},
+				To:   ImageAnchorPoint{Col: 9, Row: 35},
+			},
+		})
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.charts[0].Series[0].CategoriesRef, qt.Equals, "'Sales 2021'!$A$2:$A$4")
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		bar := parts["xl/charts/chart1.xml"]
+		c.Assert(bar, qt.Contains, `<c:barChart><c:barDir val="bar"/>`)
+		c.Assert(bar, qt.Contains, `<a:t>Units &amp; months</a:t>`)
+		c.Assert(bar, qt.Contains, `<c:tx><c:strRef><c:f>&#39;Sales 2021&#39;!$B$1</c:f></c:strRef></c:tx>`)
+		c.Assert(bar, qt.Contains, `<c:cat><c:strRef><c:f>&#39;Sales 2021&#39;!$A$2:$A$4</c:f></c:strRef></c:cat>`)
+		c.Assert(bar, qt.Contains, `<c:val><c:numRef><c:f>&#39;Sales 2021&#39;!$B$2:$B$4</c:f></c:numRef></c:val>`)
+		c.Assert(bar, qt.Contains, `<c:catAx><c:axId val="1"/><c:scaling><c:orientation val="minMax"/></c:scaling><c:delete val="0"/><c:axPos val="l"/><c:title>`)
+		pie := parts["xl/charts/chart2.xml"]
+		c.Assert(pie, qt.Contains, `<c:pieChart><c:varyColors val="1"/>`)
+		c.Assert(pie, qt.Contains, `<c:autoTitleDeleted val="1"/>`)
+		c.Assert(pie, qt.Not(qt.Contains), `<c:catAx>`)
+
+		drawing := parts["xl/drawings/drawing1.xml"]
+		c.Assert(drawing, qt.Contains, `<a:blip r:embed="rId1"/>`)
+		c.Assert(drawing, qt.Contains, `<xdr:oneCellAnchor><xdr:from><xdr:col>3</xdr:col><xdr:colOff>0</xdr:colOff><xdr:row>1</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:from><xdr:ext cx="4572000" cy="2743200"/><xdr:graphicFrame macro=""><xdr:nvGraphicFramePr><xdr:cNvPr id="3" name="Chart 1"/>`)
+		c.Assert(drawing, qt.Contains, `<c:chart xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" r:id="rId2"/>`)
+		c.Assert(drawing, qt.Contains, `<xdr:cNvPr id="4" name="Chart 2"/>`)
+		c.Assert(drawing, qt.Contains, `r:id="rId3"/></a:graphicData></a:graphic></xdr:graphicFrame><xdr:clientData/></xdr:twoCellAnchor>`)
+		drawingRels := parts["xl/drawings/_rels/drawing1.xml.rels"]
+		c.Assert(drawingRels, qt.Contains, `Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart1.xml"`)
+		c.Assert(drawingRels, qt.Contains, `Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart2.xml"`)
+		c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Override PartName="/xl/charts/chart2.xml" ContentType="application/vnd.openxmlformats-officedocument.drawingml.chart+xml">`)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*</sheetData>.*<drawing r:id="rId1">?(/>|</drawing>)</worksheet>`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		written := make(map[string]string)
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			written[name] = string(body)
+			return name, body
+		})
+		c.Assert(written["xl/charts/chart1.xml"], qt.Equals, bar)
+		c.Assert(written["xl/drawings/drawing1.xml"], qt.Equals, drawing)
+
+		// The image is still read from a file with charts.
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[0].Images(), qt.HasLen, 1)
+		c.Cleanup(f.Sheets[0].Close)
+	})
+
+	c.Run("ChartsInSeveralSheets", func(c *qt.C) {
+		f := NewFile()
+		for _, name := range []string{"One", "Two"} {
+			sheet, err := f.AddSheet(name)
+			c.Assert(err, qt.IsNil)
+			err = sheet.AddChart(ChartSpec{
+				Type:   ChartTypeLine,
+				Series: []ChartSeries{{ValuesRef: name + "!$A$1:$A$5"}},
+			})
+			c.Assert(err, qt.IsNil)
+		}
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/charts/chart2.xml"], qt.Contains, `<c:lineChart>`)
+		c.Assert(parts["xl/charts/chart2.xml"], qt.Contains, `<c:f>Two!$A$1:$A$5</c:f>`)
+		c.Assert(parts["xl/drawings/_rels/drawing2.xml.rels"], qt.Contains, `Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart2.xml"`)
+	})
+
+	csRunO(c, "RenameSheet", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		data, err := f.AddSheet("ChartData")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(data.Close)
+		report, err := f.AddSheet("ChartReport")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(report.Close)
+		err = report.AddChart(ChartSpec{
+			Series: []ChartSeries{{
+				NameRef:       "ChartData!$B$1",
+				CategoriesRef: "ChartData!$A$2:$A$3",
+				ValuesRef:     "ChartData!$B$2:$B$3",
+			}},
+		})
+		c.Assert(err, qt.IsNil)
+
+		// The chart follows the sheet it shows when that is renamed.
+		c.Assert(f.RenameSheet("ChartData", "Sales"), qt.IsNil)
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		chart := parts["xl/charts/chart1.xml"]
+		c.Assert(chart, qt.Contains, `<c:tx><c:strRef><c:f>&#39;Sales&#39;!$B$1</c:f></c:strRef></c:tx>`)
+		c.Assert(chart, qt.Contains, `<c:cat><c:strRef><c:f>&#39;Sales&#39;!$A$2:$A$3</c:f></c:strRef></c:cat>`)
+		c.Assert(chart, qt.Contains, `<c:val><c:numRef><c:f>&#39;Sales&#39;!$B$2:$B$3</c:f></c:numRef></c:val>`)
+		c.Assert(chart, qt.Not(qt.Contains), `ChartData`)
+	})
+
+	c.Run("DefinedNames", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Data")
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.SetDefinedName("Months", "Data!$A$2:$A$13"), qt.IsNil)
+		c.Assert(f.SetDefinedName("Units", "OFFSET(Data!$B$2,0,0,COUNT(Data!$B:$B),1)", DefinedNameSheet("Data")), qt.IsNil)
+		err = sheet.AddChart(ChartSpec{
+			Type: ChartTypeLine,
+			Series: []ChartSeries{{
+				NameRef:       "Data!$B$1",
+				CategoriesRef: "Months",
+				ValuesRef:     "Data!Units",
+			}},
+		})
+		c.Assert(err, qt.IsNil)
+
+		// A name that the whole workbook can use is qualified with the
+		// workbook, and one scoped to a sheet with the sheet.
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/charts/chart1.xml"], qt.Contains, `<c:cat><c:strRef><c:f>[0]!Months</c:f></c:strRef></c:cat>`)
+		c.Assert(parts["xl/charts/chart1.xml"], qt.Contains, `<c:val><c:numRef><c:f>Data!Units</c:f></c:numRef></c:val>`)
+
+		c.Assert(f.RenameSheet("Data", "Sales"), qt.IsNil)
+		parts, err = f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/charts/chart1.xml"], qt.Contains, `<c:f>[0]!Months</c:f>`)
+		c.Assert(parts["xl/charts/chart1.xml"], qt.Contains, `<c:f>&#39;Sales&#39;!Units</c:f>`)
+
+		// Names that aren't defined, or not for that scope, are refused.
+		for ref, message := range map[string]string{
+			"Weeks":        `AddChart: series 1: name "Weeks" is not defined`,
+			"Sales!Weeks":  `AddChart: series 1: name "Sales!Weeks" is not defined`,
+			"Sales!Months": `AddChart: series 1: name "Sales!Months" is not defined`,
+			"Other!Units":  `AddChart: series 1: name "Other!Units": sheet "Other" does not exist`,
+		} {
+			err = sheet.AddChart(ChartSpec{Series: []ChartSeries{{ValuesRef: ref}}})
+			c.Assert(err, qt.ErrorMatches, message)
+		}
+	})
+
+	c.Run("Errors", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Errors")
+		c.Assert(err, qt.IsNil)
+		values := []ChartSeries{{ValuesRef: "Errors!$A$1:$A$3"}}
+		err = sheet.AddChart(ChartSpec{Type: ChartType(9), Series: values})
+		c.Assert(err, qt.ErrorMatches, `AddChart: unknown chart type 9`)
+		err = sheet.AddChart(ChartSpec{})
+		c.Assert(err, qt.ErrorMatches, `AddChart: the chart has no series`)
+		err = sheet.AddChart(ChartSpec{Series: []ChartSeries{{NameRef: "Errors!$B$1"}}})
+		c.Assert(err, qt.ErrorMatches, `AddChart: series 1 has no values`)
+		err = sheet.AddChart(ChartSpec{Series: []ChartSeries{{ValuesRef: "$A$1:$A$3"}}})
+		c.Assert(err, qt.ErrorMatches, `AddChart: series 1: reference "\$A\$1:\$A\$3" has no sheet name`)
+		err = sheet.AddChart(ChartSpec{Series: []ChartSeries{{ValuesRef: "SUM(Errors!A1:A3)"}}})
+		c.Assert(err, qt.ErrorMatches, `AddChart: series 1: "SUM\(Errors!A1:A3\)" is not a reference to cells`)
+		err = sheet.AddChart(ChartSpec{Series: values, Anchor: ImageAnchor{From: ImageAnchorPoint{Row: -1}}})
+		c.Assert(err, qt.ErrorMatches, `AddChart: .* negative column, row or offset`)
+		c.Assert(sheet.charts, qt.HasLen, 0)
+	})
+}
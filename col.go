@@ -4,6 +4,8 @@ package xlsx
 const ColWidth = 9.5
 const Excel2006MaxRowCount = 1048576
 const Excel2006MaxRowIndex = Excel2006MaxRowCount - 1
+const Excel2006MaxColCount = 16384
+const Excel2006MaxColIndex = Excel2006MaxColCount - 1
 
 type Col struct {
 	Min          int
@@ -77,10 +79,75 @@ func (c *Col) SetStyle(style *Style) {
 	c.style = style
 }
 
+// SetOutlineLevel sets the outline level of the columns that have this
+// Col applied to them, which groups them with the neighbouring columns
+// of the same or a deeper level.
 func (c *Col) SetOutlineLevel(outlineLevel uint8) {
 	c.OutlineLevel = &outlineLevel
 }
 
+// GetOutlineLevel returns the outline level of the columns that have
+// this Col applied to them, which is 0 if they aren't grouped.
+func (c *Col) GetOutlineLevel() uint8 {
+	if c.OutlineLevel == nil {
+		return 0
+	}
+	return *c.OutlineLevel
+}
+
+// SetCollapsed sets whether the group of columns that the columns that
+// have this Col applied to them summarise is collapsed.
+func (c *Col) SetCollapsed(collapsed bool) {
+	c.Collapsed = &collapsed
+}
+
+// IsCollapsed reports whether the group of columns that the columns
+// that have this Col applied to them summarise is collapsed.
+func (c *Col) IsCollapsed() bool {
+	return c.Collapsed != nil && *c.Collapsed
+}
+
+// SetHidden sets whether the columns that have this Col applied to
+// them are hidden.
+func (c *Col) SetHidden(hidden bool) {
+	c.Hidden = &hidden
+}
+
+// IsHidden reports whether the columns that have this Col applied to
+// them are hidden.
+func (c *Col) IsHidden() bool {
+	return c.Hidden != nil && *c.Hidden
+}
+
+// sameBoolPtr reports whether a and b are both nil, or point to the
+// same value.
+func sameBoolPtr(a, b *bool) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sameAs reports whether c and other define the same attributes, other
+// than their range of columns, such that neighbouring Cols can be
+// written as one.
+func (c *Col) sameAs(other *Col) bool {
+	switch {
+	case (c.Width == nil) != (other.Width == nil),
+		c.Width != nil && *c.Width != *other.Width,
+		(c.OutlineLevel == nil) != (other.OutlineLevel == nil),
+		c.OutlineLevel != nil && *c.OutlineLevel != *other.OutlineLevel:
+		return false
+	}
+	return sameBoolPtr(c.Hidden, other.Hidden) &&
+		sameBoolPtr(c.Collapsed, other.Collapsed) &&
+		sameBoolPtr(c.BestFit, other.BestFit) &&
+		sameBoolPtr(c.CustomWidth, other.CustomWidth) &&
+		sameBoolPtr(c.Phonetic, other.Phonetic) &&
+		c.numFmt == other.numFmt &&
+		c.outXfID == other.outXfID
+}
+
 // copyToRange is an internal convenience function to make a copy of a
 // Col with a different Min and Max value, it is not intended as a
 // general purpose Col copying function as you must still insert the
@@ -0,0 +1,493 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	commentsRelationshipType   RelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments"
+	vmlDrawingRelationshipType RelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/vmlDrawing"
+	commentsContentType                         = "application/vnd.openxmlformats-officedocument.spreadsheetml.comments+xml"
+	vmlDrawingContentType                       = "application/vnd.openxmlformats-officedocument.vmlDrawing"
+)
+
+// Comment is a note attached to a cell, which Excel shows when the
+// mouse pointer is over the cell.
+type Comment struct {
+	Author string
+	Text   string
+}
+
+// SetComment attaches a comment by author to the cell, replacing any
+// comment it already had.  An empty text removes the comment.
+func (c *Cell) SetComment(author, text string) {
+	s := c.Row.Sheet
+	key := coord{x: c.num, y: c.Row.num}
+	if text == "" {
+		delete(s.comments, key)
+		return
+	}
+	if s.comments == nil {
+		s.comments = make(map[coord]Comment)
+	}
+	s.comments[key] = Comment{Author: author, Text: text}
+}
+
+// Comment returns the comment attached to the cell, or nil if it
+// doesn't have one.
+func (c *Cell) Comment() *Comment {
+	comment, ok := c.Row.Sheet.comments[coord{x: c.num, y: c.Row.num}]
+	if !ok {
+		return nil
+	}
+	return &comment
+}
+
+// moveCommentRows moves the comments on the rows from index onwards
+// down by delta rows, or up if delta is negative.
+func (s *Sheet) moveCommentRows(index, delta int) {
+	if len(s.comments) == 0 {
+		return
+	}
+	moved := make(map[coord]Comment, len(s.comments))
+	for key, comment := range s.comments {
+		if key.y >= index {
+			key.y += delta
+		}
+		moved[key] = comment
+	}
+	s.comments = moved
+}
+
+// moveCommentCols moves the comments of the cells from column index
+// onwards by delta columns, as moveCommentRows does for rows.
+func (s *Sheet) moveCommentCols(index, delta int) {
+	if len(s.comments) == 0 {
+		return
+	}
+	moved := make(map[coord]Comment, len(s.comments))
+	for key, comment := range s.comments {
+		if key.x >= index {
+			key.x += delta
+		}
+		moved[key] = comment
+	}
+	s.comments = moved
+}
+
+// sortedCommentCoords returns the cells that have comments, in row
+// order and then column order, which is the order Excel writes them in.
+func (s *Sheet) sortedCommentCoords() []coord {
+	coords := make([]coord, 0, len(s.comments))
+	for key := range s.comments {
+		coords = append(coords, key)
+	}
+	sort.Slice(coords, func(i, j int) bool {
+		if coords[i].y != coords[j].y {
+			return coords[i].y < coords[j].y
+		}
+		return coords[i].x < coords[j].x
+	})
+	return coords
+}
+
+// xlsxComments directly maps the comments element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxComments struct {
+	XMLName     xml.Name      `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main comments"`
+	Authors     []string      `xml:"authors>author"`
+	CommentList []xlsxComment `xml:"commentList>comment"`
+}
+
+// xlsxComment directly maps the comment element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main - the text
+// of a comment has the same form as a shared string.
+type xlsxComment struct {
+	Ref      string `xml:"ref,attr"`
+	AuthorId int    `xml:"authorId,attr"`
+	Text     xlsxSI `xml:"text"`
+}
+
+// xlsxLegacyDrawing directly maps the legacyDrawing element in the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main,
+// which refers to the VML drawing that holds the boxes of the comments.
+type xlsxLegacyDrawing struct {
+	RelationshipId string `xml:"id,attr"`
+}
+
+// makeXLSXComments returns the comments part of the Sheet.
+func (s *Sheet) makeXLSXComments() *xlsxComments {
+	xComments := &xlsxComments{}
+	authorIds := make(map[string]int)
+	for _, key := range s.sortedCommentCoords() {
+		comment := s.comments[key]
+		authorId, ok := authorIds[comment.Author]
+		if !ok {
+			authorId = len(xComments.Authors)
+			authorIds[comment.Author] = authorId
+			xComments.Authors = append(xComments.Authors, comment.Author)
+		}
+		xComments.CommentList = append(xComments.CommentList, xlsxComment{
+			Ref:      GetCellIDStringFromCoords(key.x, key.y),
+			AuthorId: authorId,
+			Text:     xlsxSI{T: &xlsxT{Text: comment.Text}},
+		})
+	}
+	return xComments
+}
+
+// vmlShapesPerBlock is the number of shapes that are given ids from
+// each of the blocks of 1024 VML shape ids that an o:idmap element
+// claims, whose first id isn't used.
+const vmlShapesPerBlock = 1023
+
+// commentShapeType is the VML shape type of the boxes of comments.
+const commentShapeType = `<v:shapetype id="_x0000_t202" coordsize="21600,21600" o:spt="202" path="m,l,21600r21600,l21600,xe"><v:stroke joinstyle="miter"/><v:path gradientshapeok="t" o:connecttype="rect"/></v:shapetype>`
+
+// commentShapeLayout is the format of the element that claims the
+// blocks of shape ids of a VML drawing, with the blocks.
+const commentShapeLayout = `<o:shapelayout v:ext="edit"><o:idmap v:ext="edit" data="%s"/></o:shapelayout>`
+
+// vmlShapeBlocks returns the number of blocks of shape ids needed for
+// n shapes.
+func vmlShapeBlocks(n int) int {
+	return (n + vmlShapesPerBlock - 1) / vmlShapesPerBlock
+}
+
+// vmlIdmapData returns blocks as the data of an o:idmap element.
+func vmlIdmapData(blocks []int) string {
+	data := make([]string, len(blocks))
+	for i, block := range blocks {
+		data[i] = strconv.Itoa(block)
+	}
+	return strings.Join(data, ",")
+}
+
+// makeCommentShapes returns the VML shapes of the hidden boxes of the
+// comments of the Sheet, which Excel shows when the mouse pointer is
+// over the cell.  The shapes are given ids from blocks, which must be
+// unique within the workbook, vmlShapesPerBlock to each.
+func (s *Sheet) makeCommentShapes(blocks []int) string {
+	var b strings.Builder
+	for i, key := range s.sortedCommentCoords() {
+		id := blocks[i/vmlShapesPerBlock]*1024 + i%vmlShapesPerBlock + 1
+		fmt.Fprintf(&b, `<v:shape id="_x0000_s%d" type="#_x0000_t202" style="position:absolute;margin-left:59.25pt;margin-top:1.5pt;width:108pt;height:59.25pt;z-index:%d;visibility:hidden" fillcolor="#ffffe1" o:insetmode="auto">`, id, i+1)
+		b.WriteString(`<v:fill color2="#ffffe1"/><v:shadow on="t" color="black" obscured="t"/><v:path o:connecttype="none"/><v:textbox style="mso-direction-alt:auto"><div style="text-align:left"></div></v:textbox>`)
+		// The anchor is the column, offset, row and offset of the
+		// top left and bottom right corners of the box.
+		fmt.Fprintf(&b, `<x:ClientData ObjectType="Note"><x:MoveWithCells/><x:SizeWithCells/><x:Anchor>%d, 15, %d, 2, %d, 15, %d, 16</x:Anchor><x:AutoFill>False</x:AutoFill><x:Row>%d</x:Row><x:Column>%d</x:Column></x:ClientData>`,
+			key.x+1, key.y, key.x+3, key.y+3, key.y, key.x)
+		b.WriteString(`</v:shape>`)
+	}
+	return b.String()
+}
+
+// makeCommentsVML returns the VML drawing with a hidden box for each
+// of the comments of the Sheet, whose shapes are given ids from blocks.
+func (s *Sheet) makeCommentsVML(blocks []int) []byte {
+	var b strings.Builder
+	b.WriteString(`<xml xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="urn:schemas-microsoft-com:office:office" xmlns:x="urn:schemas-microsoft-com:office:excel">`)
+	fmt.Fprintf(&b, commentShapeLayout, vmlIdmapData(blocks))
+	b.WriteString(commentShapeType)
+	b.WriteString(s.makeCommentShapes(blocks))
+	b.WriteString(`</xml>`)
+	return []byte(b.String())
+}
+
+// keptVML is the VML drawing of a sheet that has more in it than the
+// boxes of comments, such as form controls, which aren't read.  It is
+// written back out as it was read, but for the boxes of the comments,
+// which are taken out of it when it is read and made afresh from the
+// Sheet's comments when it is written.
+type keptVML struct {
+	name string
+	data []byte
+	rels []xlsxWorksheetRelation
+}
+
+var (
+	// vmlShape matches a VML shape and what is in it.
+	vmlShape = regexp.MustCompile(`(?s)<v:shape\b[^>]*/>|<v:shape\b[^>]*[^/]>.*?</v:shape>`)
+	// vmlOtherShape matches the start of any VML shape that isn't
+	// the box of a comment, once those have been taken out.
+	vmlOtherShape = regexp.MustCompile(`<v:(?:shape|rect|roundrect|oval|line|polyline|arc|curve|image|group)\b`)
+	// vmlIdmap matches the o:idmap element of a VML drawing, and the
+	// blocks of shape ids that it claims.
+	vmlIdmap = regexp.MustCompile(`<o:idmap\b[^>]*?\sdata="([^"]*)"`)
+	// vmlRoot matches the start tag of the root of a VML drawing.
+	vmlRoot = regexp.MustCompile(`<xml\b[^>]*>`)
+)
+
+// shapeBlocks returns the blocks of shape ids that the drawing claims.
+func (v *keptVML) shapeBlocks() []int {
+	var blocks []int
+	for _, m := range vmlIdmap.FindAllSubmatch(v.data, -1) {
+		for _, field := range strings.Split(string(m[1]), ",") {
+			if block, err := strconv.Atoi(strings.TrimSpace(field)); err == nil {
+				blocks = append(blocks, block)
+			}
+		}
+	}
+	return blocks
+}
+
+// withComments returns the drawing with shapes, the boxes of comments
+// whose ids are from blocks, placed after what was already in it, and
+// blocks added to those that it claims.
+func (v *keptVML) withComments(shapes string, blocks []int) []byte {
+	if len(blocks) == 0 {
+		return v.data
+	}
+	data := string(v.data)
+	ids := vmlIdmapData(blocks)
+	if m := vmlIdmap.FindStringSubmatchIndex(data); m != nil {
+		if m[3] > m[2] {
+			ids = "," + ids
+		}
+		data = data[:m[3]] + ids + data[m[3]:]
+	} else if m := vmlRoot.FindStringIndex(data); m != nil {
+		data = data[:m[1]] + fmt.Sprintf(commentShapeLayout, ids) + data[m[1]:]
+	}
+	if !strings.Contains(data, `id="_x0000_t202"`) {
+		shapes = commentShapeType + shapes
+	}
+	end := strings.LastIndex(data, "</")
+	if end < 0 {
+		return v.data
+	}
+	return []byte(data[:end] + shapes + data[end:])
+}
+
+// addComments passes the comments part and the VML drawing of the
+// Sheet, numbered sheetIndex, to writePart, and adds the relationships
+// to them to rels, which it returns.  The shapes of the comments are
+// given ids from blocks taken from next.  A VML drawing that was kept
+// when the Sheet was read is written as it was, with the boxes of the
+// comments placed after what was in it.  It does nothing for a Sheet
+// without comments or a kept VML drawing.
+func (s *Sheet) addComments(rels *xlsxWorksheetRels, types *xlsxTypes, sheetIndex int, next *drawingParts, writePart func(partName string, part []byte) error) (*xlsxWorksheetRels, error) {
+	if len(s.comments) == 0 && s.vml == nil {
+		return rels, nil
+	}
+	if rels == nil {
+		rels = &xlsxWorksheetRels{XMLName: xml.Name{Local: "Relationships"}}
+	}
+	if len(s.comments) > 0 {
+		body, err := xml.Marshal(s.makeXLSXComments())
+		if err != nil {
+			return rels, fmt.Errorf("xml.Marshal: %w", err)
+		}
+		partName := fmt.Sprintf("xl/comments%d.xml", sheetIndex)
+		err = writePart(partName, append([]byte(xml.Header), body...))
+		if err != nil {
+			return rels, err
+		}
+		types.Overrides = append(types.Overrides, xlsxOverride{
+			PartName:    "/" + partName,
+			ContentType: commentsContentType,
+		})
+		rels.Relationships = append(rels.Relationships, xlsxWorksheetRelation{
+			Id:     fmt.Sprintf("rId%d", len(rels.Relationships)+1),
+			Type:   commentsRelationshipType,
+			Target: fmt.Sprintf("../comments%d.xml", sheetIndex),
+		})
+	}
+
+	blocks := next.vmlBlocks(vmlShapeBlocks(len(s.comments)))
+	var partName string
+	var vml []byte
+	if s.vml != nil {
+		partName = s.vml.name
+		vml = s.vml.withComments(s.makeCommentShapes(blocks), blocks)
+		if len(s.vml.rels) > 0 {
+			body, err := xml.Marshal(&xlsxWorksheetRels{
+				XMLName:       xml.Name{Local: "Relationships"},
+				Relationships: s.vml.rels,
+			})
+			if err != nil {
+				return rels, fmt.Errorf("xml.Marshal: %w", err)
+			}
+			err = writePart(relsPartName(partName), append([]byte(xml.Header), body...))
+			if err != nil {
+				return rels, err
+			}
+		}
+	} else {
+		n := sheetIndex
+		partName = next.partName(&n, "xl/drawings/vmlDrawing%d.vml")
+		vml = s.makeCommentsVML(blocks)
+	}
+	err := writePart(partName, vml)
+	if err != nil {
+		return rels, err
+	}
+	hasVML := false
+	for _, def := range types.Defaults {
+		hasVML = hasVML || def.Extension == "vml"
+	}
+	if !hasVML {
+		types.Defaults = append(types.Defaults, xlsxDefault{
+			Extension:   "vml",
+			ContentType: vmlDrawingContentType,
+		})
+	}
+	rels.Relationships = append(rels.Relationships, xlsxWorksheetRelation{
+		Id:     newRelationshipID(rels),
+		Type:   vmlDrawingRelationshipType,
+		Target: partTarget(partName),
+	})
+	return rels, nil
+}
+
+// makeLegacyDrawing refers the worksheet to the VML drawing of the
+// comments, if relations has one.
+func (s *Sheet) makeLegacyDrawing(worksheet *xlsxWorksheet, relations *xlsxWorksheetRels) {
+	if relations == nil {
+		return
+	}
+	for _, rel := range relations.Relationships {
+		if rel.Type == vmlDrawingRelationshipType {
+			worksheet.LegacyDrawing = &xlsxLegacyDrawing{RelationshipId: rel.Id}
+			return
+		}
+	}
+}
+
+// readComments returns the comments in the comments part that the
+// relationships of a worksheet refer to.
+func readComments(fi *File, rsheet xlsxSheet, sheetXMLMap map[string]string) (map[coord]Comment, error) {
+	wrap := func(err error) (map[coord]Comment, error) {
+		return nil, fmt.Errorf("readComments: %w", err)
+	}
+
+	sheetName := worksheetNameForSheet(rsheet, sheetXMLMap)
+	relsFile, ok := fi.worksheetRels[sheetName]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := relsFile.Open()
+	if err != nil {
+		return wrap(fmt.Errorf("file.Open: %w", err))
+	}
+	defer rc.Close()
+	rels := new(xlsxWorksheetRels)
+	err = xml.NewDecoder(rc).Decode(rels)
+	if err != nil {
+		return wrap(fmt.Errorf("xml.Decoder.Decode: %w", err))
+	}
+
+	dir := path.Dir(normalisePartName(fi.worksheets[sheetName].Name))
+	var comments map[coord]Comment
+	for _, rel := range rels.Relationships {
+		if rel.Type != commentsRelationshipType {
+			continue
+		}
+		part, ok := fi.parts[resolveRelationshipTarget(dir, rel.Target)]
+		if !ok {
+			continue
+		}
+		content, err := readZipPart(part)
+		if err != nil {
+			return wrap(err)
+		}
+		xComments := new(xlsxComments)
+		err = xml.Unmarshal(content, xComments)
+		if err != nil {
+			return wrap(fmt.Errorf("xml.Unmarshal: %w", err))
+		}
+		for _, xComment := range xComments.CommentList {
+			x, y, err := GetCoordsFromCellIDString(xComment.Ref)
+			if err != nil {
+				return wrap(err)
+			}
+			var author string
+			if xComment.AuthorId >= 0 && xComment.AuthorId < len(xComments.Authors) {
+				author = xComments.Authors[xComment.AuthorId]
+			}
+			if comments == nil {
+				comments = make(map[coord]Comment)
+			}
+			comments[coord{x: x, y: y}] = Comment{Author: author, Text: commentText(xComment.Text)}
+		}
+	}
+	return comments, nil
+}
+
+// readLegacyDrawing returns the VML drawing that the legacyDrawing
+// element of worksheet refers to, if it has shapes in it other than
+// the boxes of comments, such as form controls, so that they can be
+// written back out.  The boxes of the comments are taken out of it.
+func readLegacyDrawing(fi *File, rsheet xlsxSheet, sheetXMLMap map[string]string, worksheet *xlsxWorksheet) (*keptVML, error) {
+	wrap := func(err error) (*keptVML, error) {
+		return nil, fmt.Errorf("readLegacyDrawing: %w", err)
+	}
+
+	if worksheet.LegacyDrawing == nil {
+		return nil, nil
+	}
+	part, ok := fi.worksheets[worksheetNameForSheet(rsheet, sheetXMLMap)]
+	if !ok {
+		return nil, nil
+	}
+	worksheetName := normalisePartName(part.Name)
+	rels, err := readRels(fi, worksheetName)
+	if err != nil {
+		return wrap(err)
+	}
+	if rels == nil {
+		return nil, nil
+	}
+	for _, rel := range rels.Relationships {
+		if rel.Id != worksheet.LegacyDrawing.RelationshipId || rel.Type != vmlDrawingRelationshipType {
+			continue
+		}
+		name := resolveRelationshipTarget(path.Dir(worksheetName), rel.Target)
+		part, ok := fi.parts[name]
+		if !ok {
+			return nil, nil
+		}
+		content, err := readZipPart(part)
+		if err != nil {
+			return wrap(err)
+		}
+		content = vmlShape.ReplaceAllFunc(content, func(shape []byte) []byte {
+			if bytes.Contains(shape, []byte(`ObjectType="Note"`)) {
+				return nil
+			}
+			return shape
+		})
+		if !vmlOtherShape.Match(content) {
+			return nil, nil
+		}
+		vmlRels, err := readRels(fi, name)
+		if err != nil {
+			return wrap(err)
+		}
+		vml := &keptVML{name: name, data: content}
+		if vmlRels != nil {
+			vml.rels = vmlRels.Relationships
+		}
+		return vml, nil
+	}
+	return nil, nil
+}
+
+// commentText returns the plain text of a comment, whose runs are
+// joined together.
+func commentText(si xlsxSI) string {
+	var b strings.Builder
+	if si.T != nil {
+		b.WriteString(si.T.Text)
+	}
+	for _, r := range si.R {
+		b.WriteString(r.T.Text)
+	}
+	return b.String()
+}
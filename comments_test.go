@@ -0,0 +1,213 @@
+package xlsx
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestComments(t *testing.T) {
+	c := qt.New(t)
+
+	// readParts returns the content of the parts of an XLSX file.
+	readParts := func(c *qt.C, b []byte) map[string]string {
+		parts := make(map[string]string)
+		rewriteXLSX(c, b, func(name string, body []byte) (string, []byte) {
+			parts[name] = string(body)
+			return name, body
+		})
+		return parts
+	}
+
+	csRunO(c, "SetComment", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(1, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Comment(), qt.IsNil)
+
+		cell.SetComment("Reviewer", "Check this total")
+		c.Assert(cell.Comment(), qt.DeepEquals, &Comment{Author: "Reviewer", Text: "Check this total"})
+		other, err := sheet.Cell(2, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(other.Comment(), qt.IsNil)
+
+		cell.SetComment("Reviewer", "")
+		c.Assert(cell.Comment(), qt.IsNil)
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(1, 2)
+		c.Assert(err, qt.IsNil)
+		cell.SetValue(42)
+		cell.SetComment("Reviewer", " Check this total ")
+		cell, err = sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetHyperlink("http://example.com", "Example", "")
+		cell.SetComment("Author", "A link & a note")
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		streamParts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		for _, parts := range []map[string]string{readParts(c, buf.Bytes()), streamParts} {
+			c.Assert(parts["xl/comments1.xml"], qt.Contains, `<authors><author>Author</author><author>Reviewer</author></authors>`)
+			c.Assert(parts["xl/comments1.xml"], qt.Contains, `<comment ref="A1" authorId="0"><text><t>A link &amp; a note</t></text></comment>`)
+			c.Assert(parts["xl/comments1.xml"], qt.Contains, `<comment ref="C2" authorId="1"><text><t xml:space="preserve"> Check this total </t></text></comment>`)
+			c.Assert(parts["xl/drawings/vmlDrawing1.vml"], qt.Contains, `visibility:hidden`)
+			c.Assert(parts["xl/drawings/vmlDrawing1.vml"], qt.Contains, `<x:Row>1</x:Row><x:Column>2</x:Column>`)
+			c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], qt.Contains, `Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/comments" Target="../comments1.xml"`)
+			c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], qt.Contains, `Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/vmlDrawing" Target="../drawings/vmlDrawing1.vml"`)
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*</sheetData>.*<legacyDrawing r:id="rId3">?(/>|</legacyDrawing>)</worksheet>`)
+			c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Override PartName="/xl/comments1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.comments+xml">`)
+			c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Default Extension="vml" ContentType="application/vnd.openxmlformats-officedocument.vmlDrawing">`)
+		}
+
+		// Saving a file that was read keeps its comments.
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet = f.Sheets[0]
+		cell, err = sheet.Cell(1, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Comment(), qt.DeepEquals, &Comment{Author: "Reviewer", Text: " Check this total "})
+		var resaved bytes.Buffer
+		c.Assert(f.Write(&resaved), qt.IsNil)
+		f, err = OpenBinary(resaved.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		cell, err = f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Comment(), qt.DeepEquals, &Comment{Author: "Author", Text: "A link & a note"})
+	})
+
+	csRunO(c, "ManyComments", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		for _, name := range []string{"Sheet1", "Sheet2"} {
+			sheet, err := f.AddSheet(name)
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(sheet.Close)
+		}
+		// More comments than a block of shape ids has room for.
+		for row := 0; row < 1100; row++ {
+			cell, err := f.Sheets[0].Cell(row, 0)
+			c.Assert(err, qt.IsNil)
+			cell.SetComment("", "note")
+		}
+		cell, err := f.Sheets[1].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetComment("", "note")
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		vml := parts["xl/drawings/vmlDrawing1.vml"]
+		c.Assert(vml, qt.Contains, `<o:idmap v:ext="edit" data="1,2"/>`)
+		ids := regexp.MustCompile(`<v:shape id="_x0000_s(\d+)"`).FindAllStringSubmatch(vml, -1)
+		c.Assert(ids, qt.HasLen, 1100)
+		c.Assert(ids[0][1], qt.Equals, "1025")
+		c.Assert(ids[1022][1], qt.Equals, "2047")
+		c.Assert(ids[1023][1], qt.Equals, "2049")
+		c.Assert(parts["xl/drawings/vmlDrawing2.vml"], qt.Contains, `<o:idmap v:ext="edit" data="3"/>`)
+		c.Assert(parts["xl/drawings/vmlDrawing2.vml"], qt.Contains, `<v:shape id="_x0000_s3073"`)
+	})
+
+	csRunO(c, "FormControls", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetComment("Author", "note")
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+
+		// A button, as Excel writes a form control, is added to the
+		// VML drawing with the box of the comment.
+		button := `<v:shape id="_x0000_s1026" type="#_x0000_t201" style="position:absolute;z-index:2" o:button="t"><x:ClientData ObjectType="Button"><x:Anchor>3, 0, 1, 0, 5, 0, 3, 0</x:Anchor><x:FmlaMacro>[0]!Macro1</x:FmlaMacro></x:ClientData></v:shape>`
+		withButton := rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/drawings/vmlDrawing1.vml" {
+				body = []byte(strings.Replace(string(body), "</xml>", button+"</xml>", 1))
+			}
+			return name, body
+		})
+
+		f, err = OpenBinary(withButton, option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		cell, err = f.Sheets[0].Cell(1, 1)
+		c.Assert(err, qt.IsNil)
+		cell.SetComment("Author", "another")
+		var resaved bytes.Buffer
+		c.Assert(f.Write(&resaved), qt.IsNil)
+		parts := readParts(c, resaved.Bytes())
+		vml := parts["xl/drawings/vmlDrawing1.vml"]
+		c.Assert(vml, qt.Contains, button)
+		// The boxes of the comments are made afresh, with ids from a
+		// block that the kept drawing didn't claim.
+		c.Assert(vml, qt.Contains, `<o:idmap v:ext="edit" data="1,2"/>`)
+		c.Assert(strings.Count(vml, `ObjectType="Note"`), qt.Equals, 2)
+		c.Assert(vml, qt.Contains, `<v:shape id="_x0000_s2049"`)
+		c.Assert(vml, qt.Contains, `<v:shape id="_x0000_s2050"`)
+		c.Assert(strings.Count(vml, `id="_x0000_t202"`), qt.Equals, 1)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*<legacyDrawing r:id="rId\d+".*`)
+
+		// Without its comments, the sheet keeps the button.
+		f, err = OpenBinary(resaved.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		for _, key := range f.Sheets[0].sortedCommentCoords() {
+			cell, err := f.Sheets[0].Cell(key.y, key.x)
+			c.Assert(err, qt.IsNil)
+			cell.SetComment("", "")
+		}
+		parts, err = f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/drawings/vmlDrawing1.vml"], qt.Contains, button)
+		c.Assert(parts["xl/drawings/vmlDrawing1.vml"], qt.Not(qt.Contains), `ObjectType="Note"`)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*<legacyDrawing r:id="rId\d+".*`)
+	})
+
+	c.Run("RichText", func(c *qt.C) {
+		text := xlsxSI{R: []xlsxR{{T: xlsxT{Text: "Reviewer:"}}, {T: xlsxT{Text: "\nCheck this"}}}}
+		c.Assert(commentText(text), qt.Equals, "Reviewer:\nCheck this")
+	})
+
+	csRunO(c, "RowsMoved", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		for row := 0; row < 3; row++ {
+			cell, err := sheet.Cell(row, 0)
+			c.Assert(err, qt.IsNil)
+			cell.SetString("row")
+			cell.SetComment("", string(rune('a'+row)))
+		}
+		// commentTexts returns the text of the comment in the first
+		// cell of each row, or "" for a cell without one.
+		commentTexts := func(c *qt.C) []string {
+			var texts []string
+			for row := 0; row < sheet.MaxRow; row++ {
+				cell, err := sheet.Cell(row, 0)
+				c.Assert(err, qt.IsNil)
+				text := ""
+				if comment := cell.Comment(); comment != nil {
+					text = comment.Text
+				}
+				texts = append(texts, text)
+			}
+			return texts
+		}
+
+		_, err = sheet.AddRowAtIndex(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(commentTexts(c), qt.DeepEquals, []string{"a", "", "b", "c"})
+
+		c.Assert(sheet.RemoveRowAtIndex(2), qt.IsNil)
+		c.Assert(commentTexts(c), qt.DeepEquals, []string{"a", "", "c"})
+	})
+}
@@ -0,0 +1,47 @@
+package xlsx
+
+// This file holds the parts of the API of github.com/tealeg/xlsx/v3
+// that this package otherwise provides under different names, so that
+// code written against it can be moved here by changing its import
+// path.  The rest of that API, including NewFile, OpenFile,
+// UseMemoryCellStore, UseDiskVCellStore and the methods of Row and
+// Cell, has the same names and signatures here.
+
+// NewMemoryCellStore returns a new, empty CellStore held in memory.
+// It is a CellStoreConstructor, so it can be passed to
+// File.AddSheetWithCellStore.
+//
+// Deprecated: use NewMemoryCellStoreConstructor, which returns a
+// CellStoreConstructor.
+func NewMemoryCellStore() (CellStore, error) {
+	return NewMemoryCellStoreConstructor()()
+}
+
+// NewDiskVCellStore returns a new, empty CellStore held on disk by
+// DiskV, in a temporary directory and with the default cache size.  It
+// is a CellStoreConstructor, so it can be passed to
+// File.AddSheetWithCellStore.
+//
+// Deprecated: use NewDiskVCellStoreConstructor, which returns a
+// CellStoreConstructor and accepts a DiskVCellStoreOption to set the
+// directory and cache size.
+func NewDiskVCellStore() (CellStore, error) {
+	return NewDiskVCellStoreConstructor()()
+}
+
+// ValueOnly is a FileOption that makes reading a file skip the cells
+// that have no value or formula, such as those that only have a style.
+// This saves memory and time when reading files in which a large
+// number of empty cells have been formatted, but the formatting of
+// those cells is lost if the File is saved.
+func ValueOnly() FileOption {
+	return func(f *File) {
+		f.valueOnly = true
+	}
+}
+
+// hasValue reports whether a cell read from a worksheet has a value or
+// a formula, as opposed to only a style.
+func (c *xlsxC) hasValue() bool {
+	return c.V != "" || c.F != nil || c.Is != nil
+}
@@ -0,0 +1,144 @@
+package xlsx
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// The declarations below pin the names and signatures of the entry
+// points that code written against github.com/tealeg/xlsx/v3 relies
+// on, so that a change to any of them fails to compile.
+var (
+	_ func(...FileOption) *File                              = NewFile
+	_ func(string, ...FileOption) (*File, error)             = OpenFile
+	_ func([]byte, ...FileOption) (*File, error)             = OpenBinary
+	_ func(io.ReaderAt, int64, ...FileOption) (*File, error) = OpenReaderAt
+	_ func(string, ...FileOption) ([][][]string, error)      = FileToSlice
+	_ func(string, ...FileOption) ([][][]string, error)      = FileToSliceUnmerged
+	_ func(int) FileOption                                   = RowLimit
+	_ func() FileOption                                      = ValueOnly
+	_ FileOption                                             = UseMemoryCellStore
+	_ FileOption                                             = UseDiskVCellStore
+	_ CellStoreConstructor                                   = NewMemoryCellStore
+	_ CellStoreConstructor                                   = NewDiskVCellStore
+
+	_ func(*File, string) (*Sheet, error)                       = (*File).AddSheet
+	_ func(*File, string, CellStoreConstructor) (*Sheet, error) = (*File).AddSheetWithCellStore
+	_ func(*File, Sheet, string) (*Sheet, error)                = (*File).AppendSheet
+	_ func(*File, string) error                                 = (*File).Save
+	_ func(*File, io.Writer) error                              = (*File).Write
+	_ func(*File) ([][][]string, error)                         = (*File).ToSlice
+
+	_ func(*Sheet) *Row                                       = (*Sheet).AddRow
+	_ func(*Sheet, int) (*Row, error)                         = (*Sheet).AddRowAtIndex
+	_ func(*Sheet, int) error                                 = (*Sheet).RemoveRowAtIndex
+	_ func(*Sheet, int) (*Row, error)                         = (*Sheet).Row
+	_ func(*Sheet, int, int) (*Cell, error)                   = (*Sheet).Cell
+	_ func(*Sheet, int) *Col                                  = (*Sheet).Col
+	_ func(*Sheet, RowVisitor, ...RowVisitorOption) error     = (*Sheet).ForEachRow
+	_ func(*Sheet, int, int, float64)                         = (*Sheet).SetColWidth
+	_ func(*Sheet, *Col)                                      = (*Sheet).SetColParameters
+	_ func(*Sheet, int, func(string) float64) error           = (*Sheet).SetColAutoWidth
+	_ func(*Sheet)                                            = (*Sheet).Close
+	_ func(*Row) *Cell                                        = (*Row).AddCell
+	_ func(*Row, int) *Cell                                   = (*Row).GetCell
+	_ func(*Row, CellVisitorFunc, ...CellVisitorOption) error = (*Row).ForEachCell
+	_ func(*Row) int                                          = (*Row).GetCoordinate
+	_ func(*Row, float64)                                     = (*Row).SetHeight
+	_ func(*Row, float64)                                     = (*Row).SetHeightCM
+	_ func(*Row) float64                                      = (*Row).GetHeight
+	_ func(*Row, uint8)                                       = (*Row).SetOutlineLevel
+	_ func(*Row) uint8                                        = (*Row).GetOutlineLevel
+	_ func(*Row, interface{}, int) int                        = (*Row).WriteSlice
+	_ func(*Row, interface{}, int) int                        = (*Row).WriteStruct
+	_ func(*Row, interface{}) error                           = (*Row).ReadStruct
+
+	_ func(*Cell, string)                     = (*Cell).SetString
+	_ func(*Cell) string                      = (*Cell).String
+	_ func(*Cell) (string, error)             = (*Cell).FormattedValue
+	_ func(*Cell, int)                        = (*Cell).SetInt
+	_ func(*Cell) (int, error)                = (*Cell).Int
+	_ func(*Cell, int64)                      = (*Cell).SetInt64
+	_ func(*Cell) (int64, error)              = (*Cell).Int64
+	_ func(*Cell, float64)                    = (*Cell).SetFloat
+	_ func(*Cell) (float64, error)            = (*Cell).Float
+	_ func(*Cell, float64, string)            = (*Cell).SetFloatWithFormat
+	_ func(*Cell, bool)                       = (*Cell).SetBool
+	_ func(*Cell) bool                        = (*Cell).Bool
+	_ func(*Cell, time.Time)                  = (*Cell).SetDate
+	_ func(*Cell, time.Time)                  = (*Cell).SetDateTime
+	_ func(*Cell, time.Time, DateTimeOptions) = (*Cell).SetDateWithOptions
+	_ func(*Cell, bool) (time.Time, error)    = (*Cell).GetTime
+	_ func(*Cell, string)                     = (*Cell).SetFormula
+	_ func(*Cell) string                      = (*Cell).Formula
+	_ func(*Cell, *Style)                     = (*Cell).SetStyle
+	_ func(*Cell) *Style                      = (*Cell).GetStyle
+	_ func(*Cell) string                      = (*Cell).GetNumberFormat
+	_ func(*Cell, string, string, string)     = (*Cell).SetHyperlink
+	_ func(*Cell, interface{})                = (*Cell).SetValue
+	_ func(*Cell) (int, int)                  = (*Cell).GetCoordinates
+	_ func(*Cell) CellType                    = (*Cell).Type
+	_ func(*Cell, int, int)                   = (*Cell).Merge
+)
+
+func TestCompat(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("CellStores", func(c *qt.C) {
+		for _, constructor := range []CellStoreConstructor{NewMemoryCellStore, NewDiskVCellStore} {
+			f := NewFile()
+			sheet, err := f.AddSheetWithCellStore("Sheet1", constructor)
+			c.Assert(err, qt.IsNil)
+			sheet.AddRow().AddCell().SetString("hello")
+			cell, err := sheet.Cell(0, 0)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.Value, qt.Equals, "hello")
+			sheet.Close()
+		}
+	})
+
+	csRunO(c, "ValueOnly", func(c *qt.C, option FileOption) {
+		f := NewFile()
+		sheet, err := f.AddSheet("ValueOnly")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetString("value")
+		style := NewStyle()
+		style.Font.Bold = true
+		style.ApplyFont = true
+		row.AddCell().SetStyle(style)
+		row.AddCell().SetFormula("1+1")
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+
+		count := func(f *File) int {
+			n := 0
+			err := f.Sheets[0].ForEachRow(func(r *Row) error {
+				return r.ForEachCell(func(*Cell) error {
+					n++
+					return nil
+				}, SkipEmptyCells)
+			})
+			c.Assert(err, qt.IsNil)
+			return n
+		}
+
+		all, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(count(all), qt.Equals, 3)
+		// Both Files hold a sheet of the same name, which the Redis
+		// store would otherwise share between them.
+		all.Sheets[0].Close()
+
+		values, err := OpenBinary(buf.Bytes(), option, ValueOnly())
+		c.Assert(err, qt.IsNil)
+		c.Assert(count(values), qt.Equals, 2)
+		cell, err := values.Sheets[0].Cell(0, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Formula(), qt.Equals, "1+1")
+	})
+}
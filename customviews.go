@@ -0,0 +1,209 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zip"
+)
+
+const (
+	namedSheetViewRelationshipType RelationshipType = "http://schemas.microsoft.com/office/2019/04/relationships/namedSheetView"
+	namedSheetViewContentType                       = "application/vnd.ms-excel.namedsheetviews+xml"
+)
+
+// HasCustomViews reports whether the File holds any custom views, or
+// any of the named sheet views that Excel Online creates.  The views
+// are written back out unchanged when the File is saved, except on a
+// Sheet into which rows have been inserted, or from which rows have
+// been removed: the cell references that the views hold would then be
+// wrong, so they are dropped from that Sheet, and a Warning with the
+// code WarningCustomViewsDropped is recorded.
+func (f *File) HasCustomViews() bool {
+	if f.customWorkbookViews != nil {
+		return true
+	}
+	for _, sheet := range f.Sheets {
+		if sheet.customSheetViews != nil || len(sheet.namedSheetViews) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// keepRawXML returns content, the inner XML of an element read from a
+// part in the spreadsheetml namespace, if it can be written back out
+// verbatim.  That isn't possible when it uses a namespace prefix that
+// was declared on an enclosing element, as the prefix won't be
+// declared in the written part, so nil is returned instead.
+func keepRawXML(content string) *string {
+	decoder := xml.NewDecoder(strings.NewReader(
+		`<x xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+			`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			content + `</x>`))
+	// Undeclared prefixes are left in place of the namespace, and
+	// unlike the namespace names they can't contain a colon.
+	declared := func(name xml.Name) bool {
+		return name.Space == "" || name.Space == "xmlns" || strings.Contains(name.Space, ":")
+	}
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return &content
+		}
+		if err != nil {
+			return nil
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if !declared(start.Name) {
+			return nil
+		}
+		for _, attr := range start.Attr {
+			if !declared(attr.Name) {
+				return nil
+			}
+		}
+	}
+}
+
+// keepCustomSheetViews returns the customSheetViews element read from
+// a worksheet, if it can be written back out.
+func keepCustomSheetViews(views *xlsxCustomSheetViews) *xlsxCustomSheetViews {
+	if views == nil {
+		return nil
+	}
+	content := keepRawXML(views.Content)
+	if content == nil {
+		return nil
+	}
+	return &xlsxCustomSheetViews{Content: *content}
+}
+
+// keepCustomWorkbookViews returns the customWorkbookViews element read
+// from a workbook, if it can be written back out.
+func keepCustomWorkbookViews(views *xlsxCustomWorkbookViews) *xlsxCustomWorkbookViews {
+	if views == nil {
+		return nil
+	}
+	content := keepRawXML(views.Content)
+	if content == nil {
+		return nil
+	}
+	return &xlsxCustomWorkbookViews{Content: *content}
+}
+
+// readNamedSheetViews returns the content of the named sheet view
+// parts that the relationships of a worksheet refer to.
+func readNamedSheetViews(fi *File, rsheet xlsxSheet, sheetXMLMap map[string]string) ([][]byte, error) {
+	wrap := func(err error) ([][]byte, error) {
+		return nil, fmt.Errorf("readNamedSheetViews: %w", err)
+	}
+
+	sheetName := worksheetNameForSheet(rsheet, sheetXMLMap)
+	relsFile, ok := fi.worksheetRels[sheetName]
+	if !ok {
+		return nil, nil
+	}
+	rc, err := relsFile.Open()
+	if err != nil {
+		return wrap(fmt.Errorf("file.Open: %w", err))
+	}
+	defer rc.Close()
+	rels := new(xlsxWorksheetRels)
+	err = xml.NewDecoder(rc).Decode(rels)
+	if err != nil {
+		return wrap(fmt.Errorf("xml.Decoder.Decode: %w", err))
+	}
+
+	dir := path.Dir(normalisePartName(fi.worksheets[sheetName].Name))
+	var views [][]byte
+	for _, rel := range rels.Relationships {
+		if rel.Type != namedSheetViewRelationshipType {
+			continue
+		}
+		part, ok := fi.parts[resolveRelationshipTarget(dir, rel.Target)]
+		if !ok {
+			continue
+		}
+		view, err := readZipPart(part)
+		if err != nil {
+			return wrap(err)
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
+
+// readZipPart returns the content of a part of a package.
+func readZipPart(part *zip.File) ([]byte, error) {
+	rc, err := part.Open()
+	if err != nil {
+		return nil, fmt.Errorf("file.Open: %w", err)
+	}
+	defer rc.Close()
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("ioutil.ReadAll: %w", err)
+	}
+	return content, nil
+}
+
+// keepsCustomViews reports whether the custom views and named sheet
+// views of the Sheet are to be written out.  They aren't once rows
+// have been inserted or removed, in which case a Warning is recorded
+// instead, against partName, the name of the Sheet's part.
+func (s *Sheet) keepsCustomViews(partName string) (bool, error) {
+	if s.customSheetViews == nil && len(s.namedSheetViews) == 0 {
+		return false, nil
+	}
+	if !s.structureChanged {
+		return true, nil
+	}
+	if s.File == nil {
+		return false, nil
+	}
+	err := fmt.Errorf("rows of sheet %q were inserted or removed, so the cell references of its custom views are out of date", s.Name)
+	return false, s.File.addWarning(Warning{
+		Code:     WarningCustomViewsDropped,
+		Severity: SeverityDataLoss,
+		Part:     partName,
+		Location: s.Name,
+		Message:  err.Error() + "; the views were dropped",
+		Err:      err,
+	})
+}
+
+// addNamedSheetViews passes a part for each of the named sheet views
+// of the Sheet to writePart, numbering them from next, and adds the
+// relationships to them to rels, which it returns.  The number to give
+// the next part is returned too.
+func (s *Sheet) addNamedSheetViews(rels *xlsxWorksheetRels, types *xlsxTypes, next int, writePart func(partName string, part []byte) error) (*xlsxWorksheetRels, int, error) {
+	for _, view := range s.namedSheetViews {
+		if rels == nil {
+			rels = &xlsxWorksheetRels{XMLName: xml.Name{Local: "Relationships"}}
+		}
+		partName := fmt.Sprintf("xl/namedSheetViews/namedSheetView%d.xml", next)
+		err := writePart(partName, view)
+		if err != nil {
+			return rels, next, err
+		}
+		types.Overrides = append(types.Overrides, xlsxOverride{
+			PartName:    "/" + partName,
+			ContentType: namedSheetViewContentType,
+		})
+		rels.Relationships = append(rels.Relationships, xlsxWorksheetRelation{
+			Id:     fmt.Sprintf("rId%d", len(rels.Relationships)+1),
+			Type:   namedSheetViewRelationshipType,
+			Target: fmt.Sprintf("../namedSheetViews/namedSheetView%d.xml", next),
+		})
+		next++
+	}
+	return rels, next, nil
+}
@@ -0,0 +1,122 @@
+package xlsx
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCustomViews(t *testing.T) {
+	c := qt.New(t)
+
+	const fixture = "./testdocs/custom_views.xlsx"
+	original, err := ioutil.ReadFile(fixture)
+	c.Assert(err, qt.IsNil)
+
+	// readParts returns the content of the parts of an XLSX file.
+	readParts := func(c *qt.C, b []byte) map[string]string {
+		parts := make(map[string]string)
+		rewriteXLSX(c, b, func(name string, body []byte) (string, []byte) {
+			parts[name] = string(body)
+			return name, body
+		})
+		return parts
+	}
+	originalParts := readParts(c, original)
+
+	// write saves f through both of the ways of writing a File, and
+	// returns the parts that were written.
+	write := func(c *qt.C, f *File) []map[string]string {
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		streamParts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		return []map[string]string{readParts(c, buf.Bytes()), streamParts}
+	}
+
+	c.Run("NewFile", func(c *qt.C) {
+		f := NewFile()
+		_, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.HasCustomViews(), qt.IsFalse)
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f, err := OpenFile(fixture, option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.HasCustomViews(), qt.IsTrue)
+
+		for _, parts := range write(c, f) {
+			c.Assert(parts["xl/workbook.xml"], qt.Contains, `<customWorkbookViews><customWorkbookView name="Finance review" guid="{6F2B1C3A-9D41-4E0B-8C55-0A7D2E9B1F11}" maximized="1" xWindow="-9" yWindow="-9" windowWidth="1938" windowHeight="1048" activeSheetId="1"/></customWorkbookViews>`)
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `<customSheetViews><customSheetView guid="{6F2B1C3A-9D41-4E0B-8C55-0A7D2E9B1F11}" filter="1" showAutoFilter="1"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+			c.Assert(parts["xl/worksheets/sheet2.xml"], qt.Contains, `<customSheetViews><customSheetView guid="{6F2B1C3A-9D41-4E0B-8C55-0A7D2E9B1F11}"><selection activeCell="A1" sqref="A1"/>`)
+			c.Assert(parts["xl/worksheets/sheet2.xml"], qt.Contains, `</customSheetView></customSheetViews>`)
+			c.Assert(parts["xl/namedSheetViews/namedSheetView1.xml"], qt.Equals, originalParts["xl/namedSheetViews/namedSheetView1.xml"])
+			c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], qt.Contains, `Type="http://schemas.microsoft.com/office/2019/04/relationships/namedSheetView" Target="../namedSheetViews/namedSheetView1.xml"`)
+			c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Override PartName="/xl/namedSheetViews/namedSheetView1.xml" ContentType="application/vnd.ms-excel.namedsheetviews+xml"></Override>`)
+		}
+		c.Assert(f.Warnings(), qt.HasLen, 0)
+
+		// The views survive being read back in again.
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err = OpenBinary(buf.Bytes(), option, StrictParsing)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.HasCustomViews(), qt.IsTrue)
+		c.Assert(f.Sheets[0].namedSheetViews, qt.HasLen, 1)
+		parts := write(c, f)[0]
+		c.Assert(parts["xl/namedSheetViews/namedSheetView1.xml"], qt.Equals, originalParts["xl/namedSheetViews/namedSheetView1.xml"])
+	})
+
+	csRunO(c, "RowsInserted", func(c *qt.C, option FileOption) {
+		f, err := OpenFile(fixture, option)
+		c.Assert(err, qt.IsNil)
+		_, err = f.Sheets[0].AddRowAtIndex(1)
+		c.Assert(err, qt.IsNil)
+
+		for _, parts := range write(c, f) {
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Not(qt.Contains), `customSheetView`)
+			c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], qt.Not(qt.Contains), `namedSheetView`)
+			c.Assert(parts["[Content_Types].xml"], qt.Not(qt.Contains), `namedSheetView`)
+			_, ok := parts["xl/namedSheetViews/namedSheetView1.xml"]
+			c.Assert(ok, qt.IsFalse)
+			// The other sheet is unchanged, so it keeps its view.
+			c.Assert(parts["xl/worksheets/sheet2.xml"], qt.Contains, `<customSheetViews>`)
+			c.Assert(parts["xl/workbook.xml"], qt.Contains, `<customWorkbookViews>`)
+		}
+
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 2)
+		for _, w := range warnings {
+			c.Assert(w.Code, qt.Equals, WarningCustomViewsDropped)
+			c.Assert(w.Severity, qt.Equals, SeverityDataLoss)
+			c.Assert(w.Part, qt.Equals, "xl/worksheets/sheet1.xml")
+			c.Assert(w.Location, qt.Equals, "Budget")
+			c.Assert(w.Message, qt.Equals, `rows of sheet "Budget" were inserted or removed, so the cell references of its custom views are out of date; the views were dropped`)
+		}
+		// The views are kept in memory, so they are still reported.
+		c.Assert(f.HasCustomViews(), qt.IsTrue)
+	})
+
+	csRunO(c, "RowRemovedAsError", func(c *qt.C, option FileOption) {
+		f, err := OpenFile(fixture, option, WarningsAsErrors(WarningCustomViewsDropped))
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[1].RemoveRowAtIndex(0), qt.IsNil)
+		var buf bytes.Buffer
+		err = f.Write(&buf)
+		var warningErr *WarningError
+		c.Assert(errors.As(err, &warningErr), qt.IsTrue)
+		c.Assert(warningErr.Warning.Location, qt.Equals, "Notes")
+	})
+
+	c.Run("UndeclaredPrefix", func(c *qt.C) {
+		c.Assert(keepRawXML(`<customSheetView guid="{1}"><selection activeCell="A1"/></customSheetView>`), qt.Not(qt.IsNil))
+		c.Assert(keepRawXML(`<customSheetView guid="{1}"><pageSetup r:id="rId1"/></customSheetView>`), qt.Not(qt.IsNil))
+		c.Assert(keepRawXML(`<customSheetView guid="{1}"><extLst><ext xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main" uri="{1}"><x14:foo/></ext></extLst></customSheetView>`), qt.Not(qt.IsNil))
+		c.Assert(keepRawXML(`<customSheetView guid="{1}" xr:uid="{2}"/>`), qt.IsNil)
+		c.Assert(keepRawXML(`<customSheetView guid="{1}"><x14:foo/></customSheetView>`), qt.IsNil)
+	})
+}
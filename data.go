@@ -0,0 +1,275 @@
+package xlsx
+
+import "bytes"
+
+// CellData is the content of a Cell as plain data, without the
+// references to its Row, Sheet and cell store that a Cell has, so that
+// it can be passed between systems, and serialized, cheaply.  The zero
+// CellData is an empty cell.
+//
+// A data validation isn't part of a CellData.
+type CellData struct {
+	Value    string   `json:"value,omitempty"`
+	Formula  string   `json:"formula,omitempty"`
+	Type     CellType `json:"type"`
+	NumFmt   string   `json:"numFmt,omitempty"`
+	Date1904 bool     `json:"date1904,omitempty"`
+	// Style is a copy of the cell's own Style, or nil if it uses the
+	// Style of its row, column or file.
+	Style     *Style        `json:"style,omitempty"`
+	Hyperlink *Hyperlink    `json:"hyperlink,omitempty"`
+	RichText  []RichTextRun `json:"richText,omitempty"`
+	Hidden    bool          `json:"hidden,omitempty"`
+	// HMerge and VMerge are the numbers of cells to the right, and
+	// below, that the cell is merged with.
+	HMerge int `json:"hMerge,omitempty"`
+	VMerge int `json:"vMerge,omitempty"`
+}
+
+// RowData is the content of a Row as plain data.  See CellData.
+type RowData struct {
+	// Cells are the cells of the row, in the order of their columns,
+	// starting with the first column.
+	Cells []CellData `json:"cells"`
+	// Height is the height of the row in points, or zero if the row
+	// hasn't got a height of its own.
+	Height       float64 `json:"height,omitempty"`
+	Hidden       bool    `json:"hidden,omitempty"`
+	OutlineLevel uint8   `json:"outlineLevel,omitempty"`
+	// Style and NumFmt are the defaults of the cells in the row that
+	// haven't got their own.  See Row.SetRowStyle.
+	Style  *Style `json:"style,omitempty"`
+	NumFmt string `json:"numFmt,omitempty"`
+}
+
+// ToData returns the content of the Cell as plain data.
+func (c *Cell) ToData() CellData {
+	d := CellData{
+		Value:    c.Value,
+		Formula:  c.formula,
+		Type:     c.cellType,
+		NumFmt:   c.NumFmt,
+		Date1904: c.date1904,
+		Hidden:   c.Hidden,
+		HMerge:   c.HMerge,
+		VMerge:   c.VMerge,
+	}
+	if c.style != nil {
+		d.Style = c.style.Clone()
+	}
+	if c.Hyperlink != (Hyperlink{}) {
+		hyperlink := c.Hyperlink
+		d.Hyperlink = &hyperlink
+	}
+	if c.RichText != nil {
+		d.RichText = append([]RichTextRun(nil), c.RichText...)
+	}
+	return d
+}
+
+// setData sets the content of the Cell to d.
+func (c *Cell) setData(d CellData) {
+	c.updatable()
+	c.Value = d.Value
+	c.formula = d.Formula
+	c.cellType = d.Type
+	c.NumFmt = d.NumFmt
+	c.parsedNumFmt = nil
+	c.date1904 = d.Date1904
+	c.Hidden = d.Hidden
+	c.HMerge = d.HMerge
+	c.VMerge = d.VMerge
+	c.style = nil
+	if d.Style != nil {
+		c.style = d.Style.Clone()
+	}
+	c.Hyperlink = Hyperlink{}
+	if d.Hyperlink != nil {
+		c.Hyperlink = *d.Hyperlink
+		if c.Hyperlink.Link != "" && c.Row != nil && c.Row.Sheet != nil {
+			c.Row.Sheet.addRelation(RelationshipTypeHyperlink, c.Hyperlink.Link, RelationshipTargetModeExternal)
+		}
+	}
+	c.RichText = nil
+	if d.RichText != nil {
+		c.RichText = append([]RichTextRun(nil), d.RichText...)
+	}
+	c.modified = true
+}
+
+// ToData returns the content of the Row, and of its cells, as plain
+// data.
+func (r *Row) ToData() (RowData, error) {
+	d := RowData{
+		Hidden:       r.Hidden,
+		OutlineLevel: r.outlineLevel,
+		NumFmt:       r.numFmt,
+	}
+	if r.isCustom {
+		d.Height = r.height
+	}
+	if r.style != nil {
+		d.Style = r.style.Clone()
+	}
+	err := r.ForEachCell(func(c *Cell) error {
+		for len(d.Cells) < c.num {
+			d.Cells = append(d.Cells, CellData{})
+		}
+		d.Cells = append(d.Cells, c.ToData())
+		return nil
+	})
+	return d, err
+}
+
+// AppendRowData adds a new Row to the end of the Sheet, with the
+// content of d, and returns it.
+func (s *Sheet) AppendRowData(d RowData) *Row {
+	row := s.AddRow()
+	if d.Height != 0 {
+		row.SetHeight(d.Height)
+	}
+	row.Hidden = d.Hidden
+	if d.OutlineLevel != 0 {
+		row.SetOutlineLevel(d.OutlineLevel)
+	}
+	if d.Style != nil {
+		row.SetRowStyle(d.Style.Clone())
+	}
+	row.cellStoreRow.Updatable()
+	row.numFmt = d.NumFmt
+	for _, cd := range d.Cells {
+		row.AddCell().setData(cd)
+	}
+	return row
+}
+
+// MarshalBinary encodes the CellData in the format that the DiskV and
+// Redis cell stores persist cells in.
+func (d CellData) MarshalBinary() ([]byte, error) {
+	c := &Cell{}
+	c.setData(d)
+	var buf bytes.Buffer
+	if err := writeCell(&buf, c); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a CellData encoded by MarshalBinary.
+func (d *CellData) UnmarshalBinary(data []byte) error {
+	c, err := readCell(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		*d = CellData{}
+		return nil
+	}
+	*d = c.ToData()
+	return nil
+}
+
+// MarshalBinary encodes the RowData with the codec that the DiskV and
+// Redis cell stores use.
+func (d RowData) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeRowData(&buf, d); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a RowData encoded by MarshalBinary.
+func (d *RowData) UnmarshalBinary(data []byte) error {
+	rd, err := readRowData(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	*d = rd
+	return nil
+}
+
+func writeRowData(buf *bytes.Buffer, d RowData) error {
+	var err error
+	if err = writeBool(buf, d.Hidden); err != nil {
+		return err
+	}
+	if err = writeFloat(buf, d.Height); err != nil {
+		return err
+	}
+	if err = writeInt(buf, int(d.OutlineLevel)); err != nil {
+		return err
+	}
+	if err = writeBool(buf, d.Style != nil); err != nil {
+		return err
+	}
+	if err = writeString(buf, d.NumFmt); err != nil {
+		return err
+	}
+	if err = writeInt(buf, len(d.Cells)); err != nil {
+		return err
+	}
+	if err = writeEndOfRecord(buf); err != nil {
+		return err
+	}
+	if d.Style != nil {
+		if err = writeStyle(buf, d.Style); err != nil {
+			return err
+		}
+	}
+	for _, cd := range d.Cells {
+		c := &Cell{}
+		c.setData(cd)
+		if err = writeCell(buf, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readRowData(reader *bytes.Reader) (RowData, error) {
+	var err error
+	var d RowData
+	var outlineLevel, cellCount int
+	var hasStyle bool
+	if d.Hidden, err = readBool(reader); err != nil {
+		return d, err
+	}
+	if d.Height, err = readFloat(reader); err != nil {
+		return d, err
+	}
+	if outlineLevel, err = readInt(reader); err != nil {
+		return d, err
+	}
+	d.OutlineLevel = uint8(outlineLevel)
+	if hasStyle, err = readBool(reader); err != nil {
+		return d, err
+	}
+	if d.NumFmt, err = readString(reader); err != nil {
+		return d, err
+	}
+	if cellCount, err = readInt(reader); err != nil {
+		return d, err
+	}
+	if err = readEndOfRecord(reader); err != nil {
+		return d, err
+	}
+	if hasStyle {
+		if d.Style, err = readStyle(reader); err != nil {
+			return d, err
+		}
+	}
+	if cellCount > 0 {
+		d.Cells = make([]CellData, cellCount)
+	}
+	for i := range d.Cells {
+		c, err := readCell(reader)
+		if err != nil {
+			return d, err
+		}
+		if c != nil {
+			d.Cells[i] = c.ToData()
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,142 @@
+package xlsx
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// makeTestRowData returns a RowData that uses every field of RowData
+// and CellData.
+func makeTestRowData() RowData {
+	namedStyleIndex := 2
+	style := NewStyle()
+	style.Font.Bold = true
+	style.Fill = *NewFill("solid", "FFFF0000", "FF00FF00")
+	style.ApplyFont = true
+	style.ApplyFill = true
+	style.QuotePrefix = true
+	style.NamedStyleIndex = &namedStyleIndex
+	rowStyle := NewStyle()
+	rowStyle.Alignment.WrapText = true
+	rowStyle.ApplyAlignment = true
+	return RowData{
+		Cells: []CellData{
+			{Value: "text", Type: CellTypeString},
+			{Value: "1.5", Type: CellTypeNumeric, NumFmt: "0.00", Style: style},
+			{Value: "3", Formula: "B1*2", Type: CellTypeNumeric},
+			{Value: "1", Type: CellTypeBool, Hidden: true},
+			{Value: "43831", Type: CellTypeNumeric, NumFmt: "yyyy-mm-dd", Date1904: true},
+			{
+				Type: CellTypeString,
+				RichText: []RichTextRun{
+					{Text: "plain"},
+					{Text: "red", Font: &RichTextFont{Name: "Arial", Size: 12, Bold: true, Color: NewRichTextColorFromARGB(255, 255, 0, 0)}},
+					{Text: "themed", Font: &RichTextFont{Color: NewRichTextColorFromThemeColor(3)}},
+				},
+			},
+			{},
+			{
+				Value:     "link",
+				Type:      CellTypeString,
+				Hyperlink: &Hyperlink{DisplayString: "link", Link: "https://example.com/", Tooltip: "Example", Location: "Sheet1!A1"},
+				HMerge:    1,
+				VMerge:    2,
+			},
+		},
+		Height:       30,
+		Hidden:       true,
+		OutlineLevel: 2,
+		Style:        rowStyle,
+		NumFmt:       "0.0",
+	}
+}
+
+func TestRowData(t *testing.T) {
+	c := qt.New(t)
+
+	assertSameData := func(c *qt.C, got, want interface{}) {
+		if !reflect.DeepEqual(got, want) {
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(want)
+			c.Fatalf("got %s\nwant %s", gotJSON, wantJSON)
+		}
+	}
+
+	csRunO(c, "TestAppendRowData", func(c *qt.C, option FileOption) {
+		data := makeTestRowData()
+		f := NewFile(option)
+		sheet, err := f.AddSheet("AppendRowData")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AppendRowData(data)
+		c.Assert(row.GetCoordinate(), qt.Equals, 0)
+		c.Assert(sheet.MaxCol, qt.Equals, len(data.Cells))
+		got, err := row.ToData()
+		c.Assert(err, qt.IsNil)
+		assertSameData(c, got, data)
+
+		// The data is copied, so changing the sheet doesn't change it.
+		row.GetCell(1).GetStyle().Font.Italic = true
+		c.Assert(data.Cells[1].Style.Font.Italic, qt.IsFalse)
+
+		other, err := f.AddSheet("AppendRowDataCopy")
+		c.Assert(err, qt.IsNil)
+		otherRow := other.AppendRowData(data)
+		got, err = otherRow.ToData()
+		c.Assert(err, qt.IsNil)
+		assertSameData(c, got, data)
+	})
+
+	csRunO(c, "TestRowToData", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("RowToData")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetString("a")
+		row.AddCell()
+		row.AddCell().SetInt(3)
+		data, err := row.ToData()
+		c.Assert(err, qt.IsNil)
+		c.Assert(data.Height, qt.Equals, 0.0)
+		c.Assert(data.Cells, qt.HasLen, 3)
+		c.Assert(data.Cells[0].Value, qt.Equals, "a")
+		assertSameData(c, data.Cells[1], CellData{})
+		c.Assert(data.Cells[2].Value, qt.Equals, "3")
+		c.Assert(data.Cells[2].Type, qt.Equals, CellTypeNumeric)
+	})
+
+	c.Run("TestJSON", func(c *qt.C) {
+		data := makeTestRowData()
+		b, err := json.Marshal(data)
+		c.Assert(err, qt.IsNil)
+		var got RowData
+		err = json.Unmarshal(b, &got)
+		c.Assert(err, qt.IsNil)
+		assertSameData(c, got, data)
+
+		b, err = json.Marshal(CellData{})
+		c.Assert(err, qt.IsNil)
+		c.Assert(string(b), qt.Equals, `{"type":0}`)
+	})
+
+	c.Run("TestBinary", func(c *qt.C) {
+		data := makeTestRowData()
+		b, err := data.MarshalBinary()
+		c.Assert(err, qt.IsNil)
+		var got RowData
+		err = got.UnmarshalBinary(b)
+		c.Assert(err, qt.IsNil)
+		assertSameData(c, got, data)
+
+		for _, cell := range data.Cells {
+			b, err := cell.MarshalBinary()
+			c.Assert(err, qt.IsNil)
+			var got CellData
+			err = got.UnmarshalBinary(b)
+			c.Assert(err, qt.IsNil)
+			assertSameData(c, got, cell)
+		}
+	})
+}
@@ -1,8 +1,13 @@
 package xlsx
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type DataValidationType int
@@ -21,13 +26,35 @@ const (
 	DataValidationTypeWhole
 )
 
+// The longest texts, in characters, that Excel accepts in a data
+// validation.
 const (
 	// dataValidationFormulaStrLen 255 characters+ 2 quotes
-	dataValidationFormulaStrLen = 257
-	// dataValidationFormulaStrLenErr
-	dataValidationFormulaStrLenErr = "data validation must be 0-255 characters"
+	dataValidationFormulaStrLen  = 257
+	dataValidationErrorTitleLen  = 32
+	dataValidationErrorLen       = 225
+	dataValidationPromptTitleLen = 32
+	dataValidationPromptLen      = 255
 )
 
+// ErrDataValidationTooLong is returned, wrapped, by the setters of a
+// data validation when a text is longer than Excel accepts, which
+// would make it truncate or reject the validation.  The validation is
+// left unchanged.
+var ErrDataValidationTooLong = errors.New("data validation text is too long")
+
+// checkDataValidationLen returns an error if s, which is what the
+// validation calls name, is longer than max characters.
+func checkDataValidationLen(name string, s *string, max int) error {
+	if s == nil {
+		return nil
+	}
+	if n := utf8.RuneCountInString(*s); n > max {
+		return fmt.Errorf("the %s is %d characters long, more than %d: %w", name, n, max, ErrDataValidationTooLong)
+	}
+	return nil
+}
+
 type DataValidationErrorStyle int
 
 // Data validation error styles
@@ -78,8 +105,152 @@ func NewDataValidation(startRow, startCol, endRow, endCol int, allowBlank bool)
 	}
 }
 
-// SetError set error notice
-func (dd *xlsxDataValidation) SetError(style DataValidationErrorStyle, title, msg *string) {
+// Ranges returns the ranges of cells that the validation applies to,
+// such as "A1:A10" and "C1:C10" for a validation of the discontiguous
+// cells "A1:A10 C1:C10".
+func (dd *xlsxDataValidation) Ranges() []string {
+	return strings.Fields(dd.Sqref)
+}
+
+// AddRange adds a range of cells, such as "C1:C10", or a single cell,
+// to those that the validation applies to.
+func (dd *xlsxDataValidation) AddRange(ref string) error {
+	r, err := parseRange(ref)
+	if err != nil {
+		return fmt.Errorf("AddRange: %w", err)
+	}
+	dd.Sqref = strings.TrimSpace(dd.Sqref + " " + r.sqrefString())
+	return nil
+}
+
+// covers reports whether the validation applies to the cell at col and
+// row.
+func (dd *xlsxDataValidation) covers(col, row int) bool {
+	for _, ref := range dd.Ranges() {
+		if r, err := parseRange(ref); err == nil && r.contains(col, row) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleKey returns a key that is the same for validations that are the
+// same rule, whatever the cells they apply to.
+func (dd *xlsxDataValidation) ruleKey() string {
+	str := func(s *string) string {
+		if s == nil {
+			return "nil"
+		}
+		return strconv.Quote(*s)
+	}
+	return fmt.Sprintf("%t %t %t %s %s %q %s %s %s %q %q %q",
+		dd.AllowBlank, dd.ShowInputMessage, dd.ShowErrorMessage, str(dd.ErrorStyle), str(dd.ErrorTitle),
+		dd.Operator, str(dd.Error), str(dd.PromptTitle), str(dd.Prompt), dd.Type, dd.Formula1, dd.Formula2)
+}
+
+// mergeDataValidations returns copies of dvs in which validations that
+// are the same rule are merged into one, and the ranges of each are
+// joined where they are next to each other, as Excel does, so that a
+// rule set on each cell of a column is written once, for "A1:A100".
+func mergeDataValidations(dvs []*xlsxDataValidation) []*xlsxDataValidation {
+	var merged []*xlsxDataValidation
+	var ranges [][]Range
+	var others [][]string
+	index := make(map[string]int)
+	for _, dv := range dvs {
+		key := dv.ruleKey()
+		i, ok := index[key]
+		if !ok {
+			i = len(merged)
+			index[key] = i
+			rule := *dv
+			merged = append(merged, &rule)
+			ranges = append(ranges, nil)
+			others = append(others, nil)
+		}
+		for _, ref := range dv.Ranges() {
+			r, err := parseRange(ref)
+			if err != nil {
+				// It is kept as it is.
+				others[i] = append(others[i], ref)
+				continue
+			}
+			ranges[i] = append(ranges[i], *r)
+		}
+	}
+	for i, rule := range merged {
+		var refs []string
+		for _, r := range coalesceRanges(ranges[i]) {
+			refs = append(refs, r.sqrefString())
+		}
+		rule.Sqref = strings.Join(append(refs, others[i]...), " ")
+	}
+	return merged
+}
+
+// coalesceRanges joins the ranges that span the same columns and are
+// on consecutive or overlapping rows, and then those that span the same
+// rows and are in consecutive or overlapping columns.
+func coalesceRanges(ranges []Range) []Range {
+	join := func(ranges []Range, less func(a, b *Range) bool, joins func(a, b *Range) bool, extend func(a, b *Range)) []Range {
+		sort.Slice(ranges, func(i, j int) bool { return less(&ranges[i], &ranges[j]) })
+		var joined []Range
+		for _, r := range ranges {
+			if n := len(joined); n > 0 && joins(&joined[n-1], &r) {
+				extend(&joined[n-1], &r)
+				continue
+			}
+			joined = append(joined, r)
+		}
+		return joined
+	}
+	ranges = join(ranges,
+		func(a, b *Range) bool {
+			if a.FirstCol != b.FirstCol {
+				return a.FirstCol < b.FirstCol
+			}
+			if a.LastCol != b.LastCol {
+				return a.LastCol < b.LastCol
+			}
+			return a.FirstRow < b.FirstRow
+		},
+		func(a, b *Range) bool {
+			return a.FirstCol == b.FirstCol && a.LastCol == b.LastCol && b.FirstRow <= a.LastRow+1
+		},
+		func(a, b *Range) {
+			if b.LastRow > a.LastRow {
+				a.LastRow = b.LastRow
+			}
+		})
+	return join(ranges,
+		func(a, b *Range) bool {
+			if a.FirstRow != b.FirstRow {
+				return a.FirstRow < b.FirstRow
+			}
+			if a.LastRow != b.LastRow {
+				return a.LastRow < b.LastRow
+			}
+			return a.FirstCol < b.FirstCol
+		},
+		func(a, b *Range) bool {
+			return a.FirstRow == b.FirstRow && a.LastRow == b.LastRow && b.FirstCol <= a.LastCol+1
+		},
+		func(a, b *Range) {
+			if b.LastCol > a.LastCol {
+				a.LastCol = b.LastCol
+			}
+		})
+}
+
+// SetError set error notice.  The title may be at most 32 characters
+// long and the message 225.
+func (dd *xlsxDataValidation) SetError(style DataValidationErrorStyle, title, msg *string) error {
+	if err := checkDataValidationLen("error title", title, dataValidationErrorTitleLen); err != nil {
+		return fmt.Errorf("SetError: %w", err)
+	}
+	if err := checkDataValidationLen("error message", msg, dataValidationErrorLen); err != nil {
+		return fmt.Errorf("SetError: %w", err)
+	}
 	dd.ShowErrorMessage = true
 	dd.Error = msg
 	dd.ErrorTitle = title
@@ -94,21 +265,33 @@ func (dd *xlsxDataValidation) SetError(style DataValidationErrorStyle, title, ms
 
 	}
 	dd.ErrorStyle = &strStyle
+	return nil
 }
 
-// SetInput set prompt notice
-func (dd *xlsxDataValidation) SetInput(title, msg *string) {
+// SetInput set prompt notice.  The title may be at most 32 characters
+// long and the message 255.
+func (dd *xlsxDataValidation) SetInput(title, msg *string) error {
+	if err := checkDataValidationLen("prompt title", title, dataValidationPromptTitleLen); err != nil {
+		return fmt.Errorf("SetInput: %w", err)
+	}
+	if err := checkDataValidationLen("prompt", msg, dataValidationPromptLen); err != nil {
+		return fmt.Errorf("SetInput: %w", err)
+	}
 	dd.ShowInputMessage = true
 	dd.PromptTitle = title
 	dd.Prompt = msg
+	return nil
 }
 
 // SetDropList sets a hard coded list of values that the drop down will choose from.
+// The values, joined by commas, may be at most 255 characters long; use
+// SetLongDropList or SetListFromRange for longer lists.
 // List validations do not work in Apple Numbers.
 func (dd *xlsxDataValidation) SetDropList(keys []string) error {
 	formula := "\"" + strings.Join(keys, ",") + "\""
-	if dataValidationFormulaStrLen < len(formula) {
-		return fmt.Errorf(dataValidationFormulaStrLenErr)
+	if n := utf8.RuneCountInString(formula); n > dataValidationFormulaStrLen {
+		return fmt.Errorf("SetDropList: the list is %d characters long, more than %d: %w; take the values from a range of cells with SetListFromRange or SetLongDropList instead",
+			n-2, dataValidationFormulaStrLen-2, ErrDataValidationTooLong)
 	}
 	dd.Formula1 = formula
 	dd.Type = convDataValidationType(dataValidationTypeList)
@@ -137,6 +320,156 @@ func (dd *xlsxDataValidation) SetInFileList(sheet string, x1, y1, x2, y2 int) er
 	return nil
 }
 
+// SetListFromRange sets the drop down to take its values from a range
+// of cells, such as "A1:A500", in the sheet called sheetName, or in the
+// sheet of the validation itself if sheetName is empty.  The reference
+// is written with fixed rows and columns, as in Lists!$A$1:$A$500, and
+// unlike a list given to SetDropList, its values aren't limited to 255
+// characters.
+// List validations do not work in Apple Numbers.
+func (dd *xlsxDataValidation) SetListFromRange(sheetName, rangeRef string) error {
+	first, last := rangeRef, rangeRef
+	if i := strings.Index(rangeRef, cellRangeChar); i >= 0 {
+		first, last = rangeRef[:i], rangeRef[i+1:]
+	}
+	x1, y1, err := getCoordsFromCellRef(first)
+	if err != nil {
+		return fmt.Errorf("SetListFromRange: %w", err)
+	}
+	x2, y2, err := getCoordsFromCellRef(last)
+	if err != nil {
+		return fmt.Errorf("SetListFromRange: %w", err)
+	}
+	formula := GetCellIDStringFromCoordsWithFixed(x1, y1, true, true) + cellRangeChar +
+		GetCellIDStringFromCoordsWithFixed(x2, y2, true, true)
+	if sheetName != "" {
+		// Single quotes are escaped by replacing them with two single quotes.
+		formula = "'" + strings.Replace(sheetName, "'", "''", -1) + "'" + externalSheetBangChar + formula
+	}
+	dd.Formula1 = formula
+	dd.Type = convDataValidationType(dataValidationTypeList)
+	return nil
+}
+
+// DataValidationListsSheetName is the name of the hidden sheet that
+// SetLongDropList writes the values of drop down lists into.
+const DataValidationListsSheetName = "DataValidationLists"
+
+// SetLongDropList sets the values that the drop down will choose from,
+// like SetDropList, but without its limit of 255 characters and with
+// values that may contain commas.  When the values don't fit in a
+// list of their own, they are written into a column of the hidden
+// sheet DataValidationListsSheetName of file, which is added if it
+// doesn't exist, and the drop down takes its values from there.
+// List validations do not work in Apple Numbers.
+func (dd *xlsxDataValidation) SetLongDropList(file *File, keys []string) error {
+	if len(keys) == 0 {
+		return errors.New("SetLongDropList: there are no values")
+	}
+	fits := true
+	for _, key := range keys {
+		fits = fits && !strings.ContainsAny(key, ",\"")
+	}
+	if fits && dd.SetDropList(keys) == nil {
+		return nil
+	}
+	sheet, ok := file.Sheet[DataValidationListsSheetName]
+	if !ok {
+		var err error
+		sheet, err = file.AddSheet(DataValidationListsSheetName)
+		if err != nil {
+			return fmt.Errorf("SetLongDropList: %w", err)
+		}
+		sheet.Hidden = true
+	}
+	col := sheet.MaxCol
+	for i, key := range keys {
+		cell, err := sheet.Cell(i, col)
+		if err != nil {
+			return fmt.Errorf("SetLongDropList: %w", err)
+		}
+		cell.SetString(key)
+	}
+	// The next list goes in the next column.
+	sheet.MaxCol = col + 1
+	ref := GetCellIDStringFromCoords(col, 0) + cellRangeChar + GetCellIDStringFromCoords(col, len(keys)-1)
+	return dd.SetListFromRange(DataValidationListsSheetName, ref)
+}
+
+// SetDateRange sets the validation to accept dates from min to max,
+// which are written as the days since 1900 that Excel stores dates as,
+// taking the date and time that they show in their own location.
+func (dd *xlsxDataValidation) SetDateRange(min, max time.Time) error {
+	serial := func(t time.Time) string {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		return strconv.FormatFloat(TimeToExcelTime(t, false), 'f', -1, 64)
+	}
+	if max.Before(min) {
+		min, max = max, min
+	}
+	dd.setBetween(DataValidationTypeDate, serial(min), serial(max))
+	return nil
+}
+
+// SetTimeRange sets the validation to accept times of day from min to
+// max, given as the time since midnight.
+func (dd *xlsxDataValidation) SetTimeRange(min, max time.Duration) error {
+	if min < 0 || max < 0 || min > 24*time.Hour || max > 24*time.Hour {
+		return errors.New("SetTimeRange: the times must be between midnight and the next midnight")
+	}
+	fraction := func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(24*time.Hour), 'f', -1, 64)
+	}
+	if max < min {
+		min, max = max, min
+	}
+	dd.setBetween(DataValidationTypeTime, fraction(min), fraction(max))
+	return nil
+}
+
+// SetTextLengthRange sets the validation to accept text that is from
+// min to max characters long.
+func (dd *xlsxDataValidation) SetTextLengthRange(min, max int) error {
+	if min < 0 || max < 0 {
+		return errors.New("SetTextLengthRange: the lengths can't be negative")
+	}
+	return dd.SetRange(min, max, DataValidationTypeTextLeng, DataValidationOperatorBetween)
+}
+
+// SetDecimalRange sets the validation to accept numbers from min to
+// max, which unlike those of SetRange needn't be whole.
+func (dd *xlsxDataValidation) SetDecimalRange(min, max float64) error {
+	if max < min {
+		min, max = max, min
+	}
+	dd.setBetween(DataValidationTypeDecimal,
+		strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64))
+	return nil
+}
+
+// SetCustomFormula sets the validation to accept a value when formula,
+// such as "ISNUMBER(A1)", is true for it.  A leading "=" is dropped.
+func (dd *xlsxDataValidation) SetCustomFormula(formula string) error {
+	formula = strings.TrimPrefix(formula, "=")
+	if formula == "" {
+		return errors.New("SetCustomFormula: the formula is empty")
+	}
+	dd.Formula1 = formula
+	dd.Formula2 = ""
+	dd.Type = convDataValidationType(DataValidationTypeCustom)
+	dd.Operator = ""
+	return nil
+}
+
+// setBetween sets the validation of type t to accept values between
+// formula1 and formula2.
+func (dd *xlsxDataValidation) setBetween(t DataValidationType, formula1, formula2 string) {
+	dd.Formula1 = formula1
+	dd.Formula2 = formula2
+	dd.Type = convDataValidationType(t)
+	dd.Operator = convDataValidationOperatior(DataValidationOperatorBetween)
+}
+
 // SetDropList data validation range
 func (dd *xlsxDataValidation) SetRange(f1, f2 int, t DataValidationType, o DataValidationOperator) error {
 	formula1 := fmt.Sprintf("%d", f1)
@@ -181,19 +514,36 @@ func convDataValidationType(t DataValidationType) string {
 
 }
 
+// dataValidationOperators maps each DataValidationOperator to its
+// name in the file.
+var dataValidationOperators = map[DataValidationOperator]string{
+	DataValidationOperatorBetween:            "between",
+	DataValidationOperatorEqual:              "equal",
+	DataValidationOperatorGreaterThan:        "greaterThan",
+	DataValidationOperatorGreaterThanOrEqual: "greaterThanOrEqual",
+	DataValidationOperatorLessThan:           "lessThan",
+	DataValidationOperatorLessThanOrEqual:    "lessThanOrEqual",
+	DataValidationOperatorNotBetween:         "notBetween",
+	DataValidationOperatorNotEqual:           "notEqual",
+}
+
 // convDataValidationOperatior get excel data validation operator
 func convDataValidationOperatior(o DataValidationOperator) string {
-	typeMap := map[DataValidationOperator]string{
-		DataValidationOperatorBetween:            "between",
-		DataValidationOperatorEqual:              "equal",
-		DataValidationOperatorGreaterThan:        "greaterThan",
-		DataValidationOperatorGreaterThanOrEqual: "greaterThanOrEqual",
-		DataValidationOperatorLessThan:           "lessThan",
-		DataValidationOperatorLessThanOrEqual:    "lessThanOrEqual",
-		DataValidationOperatorNotBetween:         "notBetween",
-		DataValidationOperatorNotEqual:           "notEqual",
-	}
-
-	return typeMap[o]
+	return dataValidationOperators[o]
+}
 
+// GetOperator returns the DataValidationOperator of the validation,
+// such as one read from a file.  A validation without an operator uses
+// DataValidationOperatorBetween, as Excel does.  It returns an error if
+// the operator isn't one of the DataValidationOperators.
+func (dd *xlsxDataValidation) GetOperator() (DataValidationOperator, error) {
+	if dd.Operator == "" {
+		return DataValidationOperatorBetween, nil
+	}
+	for o, name := range dataValidationOperators {
+		if name == dd.Operator {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("GetOperator: unknown data validation operator %q", dd.Operator)
 }
@@ -2,7 +2,11 @@ package xlsx
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 )
@@ -261,4 +265,277 @@ func TestDataValidation(t *testing.T) {
 		c.Assert(dd.Formula1, qt.Equals, expectedFormula)
 		c.Assert(dd.Type, qt.Equals, "list")
 	})
+
+	c.Run("ListFromRange", func(c *qt.C) {
+		dd := NewDataValidation(0, 0, 9, 0, true)
+		c.Assert(dd.SetListFromRange("Lists", "a1:A500"), qt.IsNil)
+		c.Assert(dd.Formula1, qt.Equals, "'Lists'!$A$1:$A$500")
+		c.Assert(dd.Type, qt.Equals, "list")
+
+		c.Assert(dd.SetListFromRange("", "$C$2:D3"), qt.IsNil)
+		c.Assert(dd.Formula1, qt.Equals, "$C$2:$D$3")
+
+		err := dd.SetListFromRange("Lists", "A1:nonsense")
+		c.Assert(err, qt.ErrorMatches, `SetListFromRange: invalid cell reference "nonsense": .*`)
+	})
+
+	csRunO(c, "LongDropList", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("LongDropList")
+		c.Assert(err, qt.IsNil)
+
+		short := NewDataValidation(0, 0, 9, 0, true)
+		c.Assert(short.SetLongDropList(file, []string{"a", "b"}), qt.IsNil)
+		c.Assert(short.Formula1, qt.Equals, `"a,b"`)
+		_, ok := file.Sheet[DataValidationListsSheetName]
+		c.Assert(ok, qt.IsFalse)
+
+		var keys []string
+		for i := 0; i < 300; i++ {
+			keys = append(keys, fmt.Sprintf("option %d", i))
+		}
+		long := NewDataValidation(0, 1, 9, 1, true)
+		c.Assert(long.SetLongDropList(file, keys), qt.IsNil)
+		c.Assert(long.Formula1, qt.Equals, "'DataValidationLists'!$A$1:$A$300")
+		commas := NewDataValidation(0, 2, 9, 2, true)
+		c.Assert(commas.SetLongDropList(file, []string{"1,000", "2,000"}), qt.IsNil)
+		c.Assert(commas.Formula1, qt.Equals, "'DataValidationLists'!$B$1:$B$2")
+		c.Assert(commas.SetLongDropList(file, nil), qt.ErrorMatches, "SetLongDropList: there are no values")
+		for _, dd := range []*xlsxDataValidation{short, long, commas} {
+			sheet.AddDataValidation(dd)
+		}
+
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		file, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		lists := file.Sheet[DataValidationListsSheetName]
+		c.Assert(lists.Hidden, qt.IsTrue)
+		cell, err := lists.Cell(299, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "option 299")
+		cell, err = lists.Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "1,000")
+		c.Assert(file.Sheet["LongDropList"].DataValidations[1].Formula1, qt.Equals, "'DataValidationLists'!$A$1:$A$300")
+	})
+
+	c.Run("TypedRanges", func(c *qt.C) {
+		dd := NewDataValidation(0, 0, 0, 0, true)
+
+		loc := time.FixedZone("UTC+5", 5*60*60)
+		err := dd.SetDateRange(time.Date(2021, 12, 31, 0, 0, 0, 0, loc), time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC))
+		c.Assert(err, qt.IsNil)
+		c.Assert([]string{dd.Type, dd.Operator, dd.Formula1, dd.Formula2}, qt.DeepEquals,
+			[]string{"date", "between", "44197.5", "44561"})
+
+		c.Assert(dd.SetTimeRange(17*time.Hour, 9*time.Hour), qt.IsNil)
+		c.Assert([]string{dd.Type, dd.Operator, dd.Formula1, dd.Formula2}, qt.DeepEquals,
+			[]string{"time", "between", "0.375", "0.7083333333333334"})
+		c.Assert(dd.SetTimeRange(-time.Hour, time.Hour), qt.ErrorMatches, "SetTimeRange: .*")
+
+		c.Assert(dd.SetTextLengthRange(1, 40), qt.IsNil)
+		c.Assert([]string{dd.Type, dd.Operator, dd.Formula1, dd.Formula2}, qt.DeepEquals,
+			[]string{"textLength", "between", "1", "40"})
+		c.Assert(dd.SetTextLengthRange(-1, 40), qt.ErrorMatches, "SetTextLengthRange: .*")
+
+		c.Assert(dd.SetDecimalRange(2.5, -0.25), qt.IsNil)
+		c.Assert([]string{dd.Type, dd.Operator, dd.Formula1, dd.Formula2}, qt.DeepEquals,
+			[]string{"decimal", "between", "-0.25", "2.5"})
+
+		c.Assert(dd.SetCustomFormula("=ISNUMBER(A1)"), qt.IsNil)
+		c.Assert([]string{dd.Type, dd.Operator, dd.Formula1, dd.Formula2}, qt.DeepEquals,
+			[]string{"custom", "", "ISNUMBER(A1)", ""})
+		c.Assert(dd.SetCustomFormula("="), qt.ErrorMatches, "SetCustomFormula: the formula is empty")
+	})
+
+	c.Run("MultipleRanges", func(c *qt.C) {
+		dd := NewDataValidation(0, 0, 9, 0, true)
+		c.Assert(dd.AddRange("c1:C10"), qt.IsNil)
+		c.Assert(dd.AddRange("$E$2"), qt.IsNil)
+		c.Assert(dd.Sqref, qt.Equals, "A1:A10 C1:C10 E2")
+		c.Assert(dd.Ranges(), qt.DeepEquals, []string{"A1:A10", "C1:C10", "E2"})
+		c.Assert(dd.AddRange("nonsense"), qt.ErrorMatches, `AddRange: invalid cell reference "nonsense": .*`)
+		c.Assert(dd.Sqref, qt.Equals, "A1:A10 C1:C10 E2")
+	})
+
+	csRunO(c, "ReadMultipleRanges", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("ReadMultipleRanges")
+		c.Assert(err, qt.IsNil)
+		dd := NewDataValidation(0, 0, 9, 0, true)
+		c.Assert(dd.AddRange("C1:C10"), qt.IsNil)
+		c.Assert(dd.SetDropList([]string{"yes", "no"}), qt.IsNil)
+		sheet.AddDataValidation(dd)
+		_, err = sheet.Cell(9, 3)
+		c.Assert(err, qt.IsNil)
+
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		sheet.Close()
+
+		file, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		sheet = file.Sheets[0]
+		c.Assert(sheet.DataValidations, qt.HasLen, 1)
+		c.Assert(sheet.DataValidations[0].Ranges(), qt.DeepEquals, []string{"A1:A10", "C1:C10"})
+		for _, test := range []struct {
+			row, col int
+			covered  bool
+		}{{0, 0, true}, {9, 0, true}, {4, 2, true}, {4, 1, false}, {9, 3, false}, {10, 2, false}} {
+			cell, err := sheet.Cell(test.row, test.col)
+			c.Assert(err, qt.IsNil)
+			if test.covered {
+				c.Assert(cell.GetDataValidation(), qt.Equals, sheet.DataValidations[0])
+			} else {
+				c.Assert(cell.GetDataValidation(), qt.IsNil)
+			}
+		}
+	})
+
+	csRunO(c, "MergeIdenticalRules", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("MergeIdenticalRules")
+		c.Assert(err, qt.IsNil)
+		shared := NewDataValidation(0, 0, 0, 0, true)
+		c.Assert(shared.SetDropList([]string{"yes", "no"}), qt.IsNil)
+		other := NewDataValidation(0, 0, 0, 0, false)
+		c.Assert(other.SetRange(1, 10, DataValidationTypeWhole, DataValidationOperatorBetween), qt.IsNil)
+		for y := 0; y < 5; y++ {
+			for x := 0; x < 2; x++ {
+				cell, err := sheet.Cell(y, x)
+				c.Assert(err, qt.IsNil)
+				if x == 0 {
+					cell.SetDataValidation(shared)
+				} else {
+					// An identical rule of its own is merged too.
+					dd := *shared
+					cell.SetDataValidation(&dd)
+				}
+			}
+		}
+		cell, err := sheet.Cell(6, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetDataValidation(shared)
+		cell, err = sheet.Cell(2, 3)
+		c.Assert(err, qt.IsNil)
+		cell.SetDataValidation(other)
+		cell, err = sheet.Cell(0, 5)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("merged")
+		cell.Merge(1, 0)
+
+		rules, err := sheet.DataValidationRules()
+		c.Assert(err, qt.IsNil)
+		c.Assert(rules, qt.HasLen, 2)
+		c.Assert(rules[0].Ranges(), qt.DeepEquals, []string{"A1:B5", "A7"})
+		c.Assert(rules[0].Formula1, qt.Equals, `"yes,no"`)
+		c.Assert(rules[1].Ranges(), qt.DeepEquals, []string{"D3"})
+		c.Assert(shared.Sqref, qt.Equals, "A1")
+
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				written = string(body)
+			}
+			return name, body
+		})
+		streamed, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		for _, written := range []string{written, streamed["xl/worksheets/sheet1.xml"]} {
+			c.Assert(written, qt.Contains, `<dataValidations count="2">`)
+			c.Assert(written, qt.Contains, `sqref="A1:B5 A7"`)
+			c.Assert(written, qt.Contains, `sqref="D3"`)
+			c.Assert(written, qt.Matches, `(?s).*<mergeCell ref="F1:G1"/?>.*`)
+		}
+		c.Assert(shared.Sqref, qt.Equals, "A1")
+	})
+
+	csRunO(c, "ReadOperators", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("ReadOperators")
+		c.Assert(err, qt.IsNil)
+		operators := []DataValidationOperator{
+			DataValidationOperatorBetween,
+			DataValidationOperatorEqual,
+			DataValidationOperatorGreaterThan,
+			DataValidationOperatorGreaterThanOrEqual,
+			DataValidationOperatorLessThan,
+			DataValidationOperatorLessThanOrEqual,
+			DataValidationOperatorNotBetween,
+			DataValidationOperatorNotEqual,
+		}
+		for i, o := range operators {
+			dd := NewDataValidation(i, 0, i, 0, true)
+			c.Assert(dd.SetRange(1, 10, DataValidationTypeWhole, o), qt.IsNil)
+			sheet.AddDataValidation(dd)
+		}
+
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		sheet.Close()
+
+		file, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		sheet = file.Sheets[0]
+		c.Assert(sheet.DataValidations, qt.HasLen, len(operators))
+		for i, o := range operators {
+			cell, err := sheet.Cell(i, 0)
+			c.Assert(err, qt.IsNil)
+			got, err := cell.GetDataValidation().GetOperator()
+			c.Assert(err, qt.IsNil)
+			c.Assert(got, qt.Equals, o)
+		}
+
+		dd := NewDataValidation(0, 0, 0, 0, true)
+		got, err := dd.GetOperator()
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.Equals, DataValidationOperator(DataValidationOperatorBetween))
+		dd.Operator = "sideways"
+		_, err = dd.GetOperator()
+		c.Assert(err, qt.ErrorMatches, `GetOperator: unknown data validation operator "sideways"`)
+	})
+
+	c.Run("TextLengths", func(c *qt.C) {
+		dd := NewDataValidation(0, 0, 0, 0, true)
+		// The limits count characters, and each of these is three bytes.
+		title := strings.Repeat("検", 32)
+		msg := strings.Repeat("検", 225)
+		c.Assert(dd.SetError(StyleStop, &title, &msg), qt.IsNil)
+		c.Assert(*dd.ErrorTitle, qt.Equals, title)
+
+		longTitle := title + "x"
+		err := dd.SetError(StyleWarning, &longTitle, &msg)
+		c.Assert(errors.Is(err, ErrDataValidationTooLong), qt.IsTrue)
+		c.Assert(err, qt.ErrorMatches, `SetError: the error title is 33 characters long, more than 32: .*`)
+		// The validation is left as it was.
+		c.Assert(*dd.ErrorTitle, qt.Equals, title)
+		c.Assert(*dd.ErrorStyle, qt.Equals, "stop")
+		longMsg := msg + "x"
+		err = dd.SetError(StyleStop, &title, &longMsg)
+		c.Assert(err, qt.ErrorMatches, `SetError: the error message is 226 characters long, more than 225: .*`)
+
+		prompt := strings.Repeat("検", 255)
+		c.Assert(dd.SetInput(&title, &prompt), qt.IsNil)
+		err = dd.SetInput(&longTitle, &prompt)
+		c.Assert(err, qt.ErrorMatches, `SetInput: the prompt title is 33 characters long, more than 32: .*`)
+		longPrompt := prompt + "x"
+		err = dd.SetInput(&title, &longPrompt)
+		c.Assert(errors.Is(err, ErrDataValidationTooLong), qt.IsTrue)
+		c.Assert(err, qt.ErrorMatches, `SetInput: the prompt is 256 characters long, more than 255: .*`)
+		c.Assert(dd.SetInput(nil, nil), qt.IsNil)
+
+		// 85 values of two characters joined by commas are 254 characters.
+		keys := make([]string, 85)
+		for i := range keys {
+			keys[i] = "検査"
+		}
+		c.Assert(dd.SetDropList(keys), qt.IsNil)
+		c.Assert(dd.SetDropList(append(keys[:84:84], "検")), qt.IsNil)
+		err = dd.SetDropList(append(keys, "検"))
+		c.Assert(errors.Is(err, ErrDataValidationTooLong), qt.IsTrue)
+		c.Assert(err, qt.ErrorMatches, `SetDropList: the list is 256 characters long, more than 255: .* SetListFromRange .*`)
+	})
 }
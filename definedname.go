@@ -0,0 +1,230 @@
+package xlsx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefinedName is a name defined in a workbook, which formulas can use
+// in place of the cells, formula or constant value that it refers to.
+type DefinedName struct {
+	// Name is the name, such as "TaxRate".
+	Name string
+	// RefersTo is what the name stands for, without a leading "=":
+	// a reference such as "Rates!$B$2", a formula, or a constant such
+	// as "0.2".
+	RefersTo string
+	// Sheet is the name of the Sheet that the name is scoped to, which
+	// is the only Sheet whose formulas can use it unqualified, or empty
+	// for a name that the whole workbook can use.
+	Sheet string
+	// Hidden hides the name from Excel's Name Manager.
+	Hidden bool
+	// Comment describes the name in Excel's Name Manager.
+	Comment string
+}
+
+// DefinedNameOption can be passed to File.SetDefinedName to set more
+// about the name than what it refers to.
+type DefinedNameOption func(dn *DefinedName)
+
+// DefinedNameSheet scopes a defined name to the Sheet called
+// sheetName, rather than to the whole workbook.
+func DefinedNameSheet(sheetName string) DefinedNameOption {
+	return func(dn *DefinedName) {
+		dn.Sheet = sheetName
+	}
+}
+
+// DefinedNameHidden hides a defined name from Excel's Name Manager.
+func DefinedNameHidden() DefinedNameOption {
+	return func(dn *DefinedName) {
+		dn.Hidden = true
+	}
+}
+
+// DefinedNameComment sets the comment of a defined name.
+func DefinedNameComment(comment string) DefinedNameOption {
+	return func(dn *DefinedName) {
+		dn.Comment = comment
+	}
+}
+
+var (
+	// cellRefLikeName matches names that look like A1 references.
+	cellRefLikeName = regexp.MustCompile(`^[A-Za-z]{1,3}[0-9]+$`)
+	// r1c1RefLikeName matches names that look like R1C1 references,
+	// such as "R", "C2" or "R1C1".
+	r1c1RefLikeName = regexp.MustCompile(`^([Rr][0-9]*)?([Cc][0-9]*)?$`)
+)
+
+// checkDefinedName returns an error if Excel wouldn't accept name as
+// a defined name: names start with a letter, "_" or "\", go on with
+// letters, digits, "_", "\", "." and "?", are at most 255 characters
+// long, and can't be taken for a cell reference.
+func checkDefinedName(name string) error {
+	if name == "" {
+		return fmt.Errorf("defined name is empty")
+	}
+	if n := utf8.RuneCountInString(name); n > 255 {
+		return fmt.Errorf("defined name must be 255 or fewer characters long.  It is currently '%d' characters long", n)
+	}
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r), r == '_', r == '\\':
+		case i > 0 && (unicode.IsDigit(r) || r == '.' || r == '?'):
+		default:
+			return fmt.Errorf("defined name %q can't contain %q there", name, r)
+		}
+	}
+	if r1c1RefLikeName.MatchString(name) {
+		return fmt.Errorf("defined name %q looks like an R1C1 cell reference", name)
+	}
+	if cellRefLikeName.MatchString(name) {
+		if col, row, err := GetCoordsFromCellIDString(name); err == nil &&
+			col <= Excel2006MaxColIndex && row < Excel2006MaxRowCount {
+			return fmt.Errorf("defined name %q looks like a cell reference", name)
+		}
+	}
+	return nil
+}
+
+// findDefinedName returns the index in definedNames of the name with
+// the scope localSheetID, which is nil for the workbook, or -1 if
+// there isn't one.  Names are compared regardless of case, as Excel
+// does.
+func (f *File) findDefinedName(name string, localSheetID *int) int {
+	for i, dn := range f.definedNames {
+		if !strings.EqualFold(dn.Name, name) {
+			continue
+		}
+		if (dn.LocalSheetID == nil) != (localSheetID == nil) {
+			continue
+		}
+		if localSheetID == nil || *dn.LocalSheetID == *localSheetID {
+			return i
+		}
+	}
+	return -1
+}
+
+// definedNameScope returns the localSheetId of the defined names
+// scoped to the Sheet called sheetName, or nil for an empty sheetName.
+func (f *File) definedNameScope(sheetName string) (*int, error) {
+	if sheetName == "" {
+		return nil, nil
+	}
+	sheet, ok := f.Sheet[sheetName]
+	if !ok {
+		return nil, fmt.Errorf("sheet %q does not exist", sheetName)
+	}
+	index := f.sheetIndex(sheet)
+	return &index, nil
+}
+
+// SetDefinedName defines name to refer to refersTo, which may be a
+// reference such as "Rates!$B$2:$B$9", a formula, or a constant such
+// as "0.2" or `"Draft"`.  A leading "=" is dropped.  The name is
+// scoped to the whole workbook unless DefinedNameSheet is passed, and
+// replaces any name that is the same, whatever its case, and has the
+// same scope.  Tables share their names with defined names, so the
+// name can't be that of a table.  Names can be used in formulas,
+// including those of data validations, and in the series of charts
+// added with Sheet.AddChart, once they are defined.
+func (f *File) SetDefinedName(name, refersTo string, options ...DefinedNameOption) error {
+	if err := checkDefinedName(name); err != nil {
+		return fmt.Errorf("SetDefinedName: %w", err)
+	}
+	for _, sheet := range f.Sheets {
+		for _, t := range sheet.tables {
+			if strings.EqualFold(t.DisplayName, name) {
+				return fmt.Errorf("SetDefinedName: there is already a table called %q", name)
+			}
+		}
+	}
+	refersTo = strings.TrimPrefix(refersTo, "=")
+	if refersTo == "" {
+		return fmt.Errorf("SetDefinedName: name %q refers to nothing", name)
+	}
+	if _, err := tokenizeFormula(refersTo); err != nil {
+		return fmt.Errorf("SetDefinedName: %w", err)
+	}
+	dn := DefinedName{Name: name, RefersTo: refersTo}
+	for _, option := range options {
+		option(&dn)
+	}
+	localSheetID, err := f.definedNameScope(dn.Sheet)
+	if err != nil {
+		return fmt.Errorf("SetDefinedName: %w", err)
+	}
+	if i := f.findDefinedName(name, localSheetID); i >= 0 {
+		// Keep whatever else was read with the name.
+		xdn := f.definedNames[i]
+		xdn.Name = name
+		xdn.Data = refersTo
+		xdn.Hidden = dn.Hidden
+		xdn.Comment = dn.Comment
+		return nil
+	}
+	f.definedNames = append(f.definedNames, &xlsxDefinedName{
+		Name:         name,
+		Data:         refersTo,
+		LocalSheetID: localSheetID,
+		Hidden:       dn.Hidden,
+		Comment:      dn.Comment,
+	})
+	return nil
+}
+
+// DefinedNames returns the names defined in the File, whether set by
+// SetDefinedName or read with the File, in the order they are written.
+func (f *File) DefinedNames() []DefinedName {
+	names := make([]DefinedName, 0, len(f.definedNames))
+	for _, xdn := range f.definedNames {
+		dn := DefinedName{
+			Name:     xdn.Name,
+			RefersTo: xdn.Data,
+			Hidden:   xdn.Hidden,
+			Comment:  xdn.Comment,
+		}
+		if id := xdn.LocalSheetID; id != nil && *id >= 0 && *id < len(f.Sheets) {
+			dn.Sheet = f.Sheets[*id].Name
+		}
+		names = append(names, dn)
+	}
+	return names
+}
+
+// RemoveDefinedName removes the defined name called name that is
+// scoped to the Sheet called sheetName, or to the whole workbook if
+// sheetName is empty.  Formulas that use the name are left as they
+// are.
+func (f *File) RemoveDefinedName(name, sheetName string) error {
+	localSheetID, err := f.definedNameScope(sheetName)
+	if err != nil {
+		return fmt.Errorf("RemoveDefinedName: %w", err)
+	}
+	i := f.findDefinedName(name, localSheetID)
+	if i < 0 {
+		return fmt.Errorf("RemoveDefinedName: name %q is not defined", name)
+	}
+	f.definedNames = append(f.definedNames[:i:i], f.definedNames[i+1:]...)
+	return nil
+}
+
+// makeDefinedNames returns the definedNames element to write for the
+// File.  Names scoped to Sheets that the File hasn't got are dropped,
+// as Excel would have to repair the workbook to open it.
+func (f *File) makeDefinedNames() xlsxDefinedNames {
+	var names xlsxDefinedNames
+	for _, dn := range f.definedNames {
+		if dn.LocalSheetID != nil && (*dn.LocalSheetID < 0 || *dn.LocalSheetID >= len(f.Sheets)) {
+			continue
+		}
+		names.DefinedName = append(names.DefinedName, *dn)
+	}
+	return names
+}
@@ -0,0 +1,85 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCheckDefinedName(t *testing.T) {
+	c := qt.New(t)
+
+	for _, name := range []string{"TaxRate", "_rate", `\path`, "Tax.Rate_2?", "XFE1", "Ümsatz", "R1C1x", "_xlnm.Print_Area", strings.Repeat("n", 255)} {
+		c.Assert(checkDefinedName(name), qt.IsNil, qt.Commentf(name))
+	}
+	for _, name := range []string{"", "Tax Rate", "1st", ".rate", "Tax-Rate", "A1", "xfd1048576", "R", "c", "R1C1", "RC2", strings.Repeat("n", 256)} {
+		c.Assert(checkDefinedName(name), qt.Not(qt.IsNil), qt.Commentf(name))
+	}
+}
+
+func TestDefinedNames(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		for _, name := range []string{"NamesData", "NamesOther"} {
+			sheet, err := f.AddSheet(name)
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(sheet.Close)
+			sheet.AddRow().AddCell().SetString(name)
+		}
+		c.Assert(f.SetDefinedName("Items", "NamesData!$A$1:$A$3"), qt.IsNil)
+		c.Assert(f.SetDefinedName("TaxRate", "=0.2", DefinedNameHidden(), DefinedNameComment("VAT")), qt.IsNil)
+		c.Assert(f.SetDefinedName("Status", `"Draft"`, DefinedNameSheet("NamesOther")), qt.IsNil)
+		// The same name in another scope is another name, and in the
+		// same scope, whatever its case, replaces it.
+		c.Assert(f.SetDefinedName("Items", "NamesOther!$A$1", DefinedNameSheet("NamesOther")), qt.IsNil)
+		c.Assert(f.SetDefinedName("ITEMS", "NamesData!$A$1:$A$9"), qt.IsNil)
+
+		c.Assert(f.SetDefinedName("A1", "1"), qt.ErrorMatches, `SetDefinedName: defined name "A1" looks like a cell reference`)
+		c.Assert(f.SetDefinedName("Tax Rate", "1"), qt.Not(qt.IsNil))
+		c.Assert(f.SetDefinedName("Other", "1", DefinedNameSheet("NoSuchSheet")), qt.ErrorMatches, `SetDefinedName: sheet "NoSuchSheet" does not exist`)
+		c.Assert(f.SetDefinedName("Other", ""), qt.Not(qt.IsNil))
+		c.Assert(f.SetDefinedName("Other", `"unterminated`), qt.Not(qt.IsNil))
+
+		expected := []DefinedName{
+			{Name: "ITEMS", RefersTo: "NamesData!$A$1:$A$9"},
+			{Name: "TaxRate", RefersTo: "0.2", Hidden: true, Comment: "VAT"},
+			{Name: "Status", RefersTo: `"Draft"`, Sheet: "NamesOther"},
+			{Name: "Items", RefersTo: "NamesOther!$A$1", Sheet: "NamesOther"},
+		}
+		c.Assert(f.DefinedNames(), qt.DeepEquals, expected)
+
+		c.Assert(f.RemoveDefinedName("Status", ""), qt.ErrorMatches, `RemoveDefinedName: name "Status" is not defined`)
+		c.Assert(f.RemoveDefinedName("status", "NamesOther"), qt.IsNil)
+		expected = append(expected[:2], expected[3])
+		c.Assert(f.DefinedNames(), qt.DeepEquals, expected)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/workbook.xml"], qt.Matches, `(?s).*<definedNames><definedName name="ITEMS">NamesData!\$A\$1:\$A\$9</definedName>`+
+			`<definedName name="TaxRate" comment="VAT" hidden="(true|1)">0.2</definedName>`+
+			`<definedName name="Items" localSheetId="1">NamesOther!\$A\$1</definedName></definedNames>.*`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, sheet := range f2.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		c.Assert(f2.DefinedNames(), qt.DeepEquals, expected)
+
+		// The names read with the file are written back.
+		buf.Reset()
+		c.Assert(f2.Write(&buf), qt.IsNil)
+		f3, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, sheet := range f3.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		c.Assert(f3.DefinedNames(), qt.DeepEquals, expected)
+	})
+}
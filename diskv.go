@@ -3,6 +3,7 @@ package xlsx
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -100,6 +101,9 @@ func (dvr *DiskVRow) readCell(key string) (*Cell, error) {
 	if c.NumFmt, err = readString(buf); err != nil {
 		return c, err
 	}
+	if c.numFmtId, err = readInt(buf); err != nil {
+		return c, err
+	}
 	if c.date1904, err = readBool(buf); err != nil {
 		return c, err
 	}
@@ -128,12 +132,24 @@ func (dvr *DiskVRow) readCell(key string) (*Cell, error) {
 	if c.Hyperlink.Tooltip, err = readString(buf); err != nil {
 		return c, err
 	}
+	if c.Hyperlink.Location, err = readString(buf); err != nil {
+		return c, err
+	}
+	if c.Hyperlink.HSpan, err = readInt(buf); err != nil {
+		return c, err
+	}
+	if c.Hyperlink.VSpan, err = readInt(buf); err != nil {
+		return c, err
+	}
 	if c.num, err = readInt(buf); err != nil {
 		return c, err
 	}
 	if c.RichText, err = readRichText(buf); err != nil {
 		return c, err
 	}
+	if c.phonetic, err = readPhonetic(buf); err != nil {
+		return c, err
+	}
 	if err = readEndOfRecord(buf); err != nil {
 		return c, err
 	}
@@ -147,6 +163,8 @@ func (dvr *DiskVRow) readCell(key string) (*Cell, error) {
 			return c, err
 		}
 	}
+	// The cell is as it was last written to the store.
+	c.MarkClean()
 	return c, nil
 }
 
@@ -175,6 +193,9 @@ func (dvr *DiskVRow) writeCell(c *Cell) error {
 	if err = writeString(&dvr.buf, c.NumFmt); err != nil {
 		return err
 	}
+	if err = writeInt(&dvr.buf, c.numFmtId); err != nil {
+		return err
+	}
 	if err = writeBool(&dvr.buf, c.date1904); err != nil {
 		return err
 	}
@@ -202,12 +223,24 @@ func (dvr *DiskVRow) writeCell(c *Cell) error {
 	if err = writeString(&dvr.buf, c.Hyperlink.Tooltip); err != nil {
 		return err
 	}
+	if err = writeString(&dvr.buf, c.Hyperlink.Location); err != nil {
+		return err
+	}
+	if err = writeInt(&dvr.buf, c.Hyperlink.HSpan); err != nil {
+		return err
+	}
+	if err = writeInt(&dvr.buf, c.Hyperlink.VSpan); err != nil {
+		return err
+	}
 	if err = writeInt(&dvr.buf, c.num); err != nil {
 		return err
 	}
 	if err = writeRichText(&dvr.buf, c.RichText); err != nil {
 		return err
 	}
+	if err = writePhonetic(&dvr.buf, c.phonetic); err != nil {
+		return err
+	}
 	if err = writeEndOfRecord(&dvr.buf); err != nil {
 		return err
 	}
@@ -232,9 +265,13 @@ func (dvr *DiskVRow) setCurrentCell(cell *Cell) {
 		if err != nil {
 			panic(err.Error())
 		}
+		// The cell is clean when it is read back, so the row keeps
+		// track of the change until it is written itself.
+		dvr.row.modified = true
 	}
 	if cell.num > dvr.maxCol {
 		dvr.maxCol = cell.num
+		dvr.row.modified = true
 	}
 	dvr.currentCell = cell
 
@@ -245,6 +282,35 @@ func (dvr *DiskVRow) PushCell(c *Cell) {
 	dvr.setCurrentCell(c)
 }
 
+// removeCell erases the persisted cell at colIdx, and forgets it if it
+// is the current cell, shrinking the row if it was the rightmost one.
+func (dvr *DiskVRow) removeCell(colIdx int) error {
+	if dvr.currentCell != nil && dvr.currentCell.num == colIdx {
+		dvr.currentCell = nil
+	}
+	key := dvr.row.makeCellKey(colIdx)
+	if dvr.store.Has(key) {
+		if err := dvr.store.Erase(key); err != nil {
+			return err
+		}
+	}
+	if colIdx == dvr.maxCol {
+		for dvr.maxCol >= 0 && !dvr.hasCell(dvr.maxCol) {
+			dvr.maxCol--
+		}
+	}
+	return nil
+}
+
+// hasCell reports whether there is a cell at colIdx, either persisted
+// or the current cell.
+func (dvr *DiskVRow) hasCell(colIdx int) bool {
+	if dvr.currentCell != nil && dvr.currentCell.num == colIdx {
+		return true
+	}
+	return dvr.store.Has(dvr.row.makeCellKey(colIdx))
+}
+
 func (dvr *DiskVRow) GetCell(colIdx int) *Cell {
 	if dvr.currentCell != nil {
 		if dvr.currentCell.num == colIdx {
@@ -254,6 +320,7 @@ func (dvr *DiskVRow) GetCell(colIdx int) *Cell {
 	key := dvr.row.makeCellKey(colIdx)
 	cell, err := dvr.readCell(key)
 	if err == nil {
+		cell.Row = dvr.row
 		dvr.setCurrentCell(cell)
 		return cell
 	}
@@ -274,7 +341,7 @@ func (dvr *DiskVRow) ForEachCell(cvf CellVisitorFunc, option ...CellVisitorOptio
 			}
 			c = dvr.GetCell(ci)
 		}
-		if !c.Modified() && flags.skipEmptyCells {
+		if c.isEmpty() && flags.skipEmptyCells {
 			return nil
 		}
 		c.Row = dvr.row
@@ -282,7 +349,16 @@ func (dvr *DiskVRow) ForEachCell(cvf CellVisitorFunc, option ...CellVisitorOptio
 		return cvf(c)
 	}
 
-	for ci := 0; ci <= dvr.maxCol; ci++ {
+	from, to := flags.span(0, dvr.maxCol+1)
+	for ci := from; ci < to; ci++ {
+		// The current cell may have changes that haven't been
+		// persisted yet, so it mustn't be replaced by what was.
+		if cell := dvr.currentCell; cell != nil && cell.num == ci {
+			if err := fn(ci, cell); err != nil {
+				return err
+			}
+			continue
+		}
 		var cell *Cell
 		key := dvr.row.makeCellKey(ci)
 		b, err := dvr.store.Read(key)
@@ -306,7 +382,8 @@ func (dvr *DiskVRow) ForEachCell(cvf CellVisitorFunc, option ...CellVisitorOptio
 	}
 
 	if !flags.skipEmptyCells {
-		for ci := dvr.maxCol + 1; ci < dvr.row.Sheet.MaxCol; ci++ {
+		from, to = flags.span(dvr.maxCol+1, dvr.row.Sheet.MaxCol)
+		for ci := from; ci < to; ci++ {
 			c := dvr.GetCell(ci)
 			err := cvf(c)
 			if err != nil {
@@ -469,6 +546,29 @@ func (cs *DiskVCellStore) MoveRow(r *Row, index int) error {
 	return cs.store.WriteStream(newKey, cs.buf, true)
 }
 
+// renameSheet moves the rows and cells keyed by oldName to newName.
+func (cs *DiskVCellStore) renameSheet(oldName, newName string) error {
+	// The keys are gathered before any are moved, so that the walk of
+	// the store doesn't see it change.
+	var keys []string
+	for key := range cs.store.KeysPrefix(oldName+":", nil) {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		b, err := cs.store.Read(key)
+		if err != nil {
+			return err
+		}
+		if err := cs.store.Write(newName+key[len(oldName):], b); err != nil {
+			return err
+		}
+		if err := cs.store.Erase(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // RemoveRow removes a Row from the Sheet's representation in the
 // persistent store.
 func (cs *DiskVCellStore) RemoveRow(key string) error {
@@ -849,6 +949,12 @@ func writeAlignment(buf *bytes.Buffer, a Alignment) error {
 	if err = writeBool(buf, a.WrapText); err != nil {
 		return err
 	}
+	if err = writeInt(buf, a.ReadingOrder); err != nil {
+		return err
+	}
+	if err = writeBool(buf, a.JustifyLastLine); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -873,6 +979,12 @@ func readAlignment(reader *bytes.Reader) (Alignment, error) {
 	if a.WrapText, err = readBool(reader); err != nil {
 		return a, err
 	}
+	if a.ReadingOrder, err = readInt(reader); err != nil {
+		return a, err
+	}
+	if a.JustifyLastLine, err = readBool(reader); err != nil {
+		return a, err
+	}
 	return a, nil
 }
 
@@ -902,6 +1014,17 @@ func writeStyle(buf *bytes.Buffer, s *Style) error {
 	if err = writeBool(buf, s.ApplyAlignment); err != nil {
 		return err
 	}
+	if err = writeBool(buf, s.QuotePrefix); err != nil {
+		return err
+	}
+	if err = writeBool(buf, s.NamedStyleIndex != nil); err != nil {
+		return err
+	}
+	if s.NamedStyleIndex != nil {
+		if err = writeInt(buf, *s.NamedStyleIndex); err != nil {
+			return err
+		}
+	}
 	if err = writeEndOfRecord(buf); err != nil {
 		return err
 	}
@@ -935,6 +1058,20 @@ func readStyle(reader *bytes.Reader) (*Style, error) {
 	if s.ApplyAlignment, err = readBool(reader); err != nil {
 		return s, err
 	}
+	if s.QuotePrefix, err = readBool(reader); err != nil {
+		return s, err
+	}
+	hasNamedStyle, err := readBool(reader)
+	if err != nil {
+		return s, err
+	}
+	if hasNamedStyle {
+		namedStyleIndex, err := readInt(reader)
+		if err != nil {
+			return s, err
+		}
+		s.NamedStyleIndex = &namedStyleIndex
+	}
 	if err = readEndOfRecord(reader); err != nil {
 		return s, err
 	}
@@ -1042,7 +1179,7 @@ func writeRow(buf *bytes.Buffer, r *Row) error {
 		return err
 	}
 	// We don't write the Sheet reference, it's always restorable from context.
-	if err = writeFloat(buf, r.GetHeight()); err != nil {
+	if err = writeFloat(buf, r.height); err != nil {
 		return err
 	}
 	if err = writeInt(buf, int(r.GetOutlineLevel())); err != nil {
@@ -1057,9 +1194,23 @@ func writeRow(buf *bytes.Buffer, r *Row) error {
 	if err = writeInt(buf, r.cellStoreRow.MaxCol()); err != nil {
 		return err
 	}
+	if err = writeBool(buf, r.style != nil); err != nil {
+		return err
+	}
+	if err = writeString(buf, r.numFmt); err != nil {
+		return err
+	}
+	if err = writeBool(buf, r.collapsed); err != nil {
+		return err
+	}
 	if err = writeEndOfRecord(buf); err != nil {
 		return err
 	}
+	if r.style != nil {
+		if err = writeStyle(buf, r.style); err != nil {
+			return err
+		}
+	}
 	return writeGroupSeparator(buf)
 }
 
@@ -1087,6 +1238,9 @@ func writeCell(buf *bytes.Buffer, c *Cell) error {
 	if err = writeString(buf, c.NumFmt); err != nil {
 		return err
 	}
+	if err = writeInt(buf, c.numFmtId); err != nil {
+		return err
+	}
 	if err = writeBool(buf, c.date1904); err != nil {
 		return err
 	}
@@ -1114,12 +1268,24 @@ func writeCell(buf *bytes.Buffer, c *Cell) error {
 	if err = writeString(buf, c.Hyperlink.Tooltip); err != nil {
 		return err
 	}
+	if err = writeString(buf, c.Hyperlink.Location); err != nil {
+		return err
+	}
+	if err = writeInt(buf, c.Hyperlink.HSpan); err != nil {
+		return err
+	}
+	if err = writeInt(buf, c.Hyperlink.VSpan); err != nil {
+		return err
+	}
 	if err = writeInt(buf, c.num); err != nil {
 		return err
 	}
 	if err = writeRichText(buf, c.RichText); err != nil {
 		return err
 	}
+	if err = writePhonetic(buf, c.phonetic); err != nil {
+		return err
+	}
 	if err = writeEndOfRecord(buf); err != nil {
 		return err
 	}
@@ -1174,10 +1340,28 @@ func readDiskVRow(reader *bytes.Reader, store *diskv.Diskv, sheet *Sheet) (*Row,
 	if err != nil {
 		return nil, err
 	}
+	hasStyle, err := readBool(reader)
+	if err != nil {
+		return nil, err
+	}
+	r.numFmt, err = readString(reader)
+	if err != nil {
+		return nil, err
+	}
+	r.collapsed, err = readBool(reader)
+	if err != nil {
+		return nil, err
+	}
 	err = readEndOfRecord(reader)
 	if err != nil {
 		return r, err
 	}
+	if hasStyle {
+		r.style, err = readStyle(reader)
+		if err != nil {
+			return r, err
+		}
+	}
 	return r, nil
 }
 
@@ -1208,6 +1392,9 @@ func readCell(reader *bytes.Reader) (*Cell, error) {
 	if c.NumFmt, err = readString(reader); err != nil {
 		return c, err
 	}
+	if c.numFmtId, err = readInt(reader); err != nil {
+		return c, err
+	}
 	if c.date1904, err = readBool(reader); err != nil {
 		return c, err
 	}
@@ -1236,12 +1423,24 @@ func readCell(reader *bytes.Reader) (*Cell, error) {
 	if c.Hyperlink.Tooltip, err = readString(reader); err != nil {
 		return c, err
 	}
+	if c.Hyperlink.Location, err = readString(reader); err != nil {
+		return c, err
+	}
+	if c.Hyperlink.HSpan, err = readInt(reader); err != nil {
+		return c, err
+	}
+	if c.Hyperlink.VSpan, err = readInt(reader); err != nil {
+		return c, err
+	}
 	if c.num, err = readInt(reader); err != nil {
 		return c, err
 	}
 	if c.RichText, err = readRichText(reader); err != nil {
 		return c, err
 	}
+	if c.phonetic, err = readPhonetic(reader); err != nil {
+		return c, err
+	}
 	if err = readEndOfRecord(reader); err != nil {
 		return c, err
 	}
@@ -1255,11 +1454,17 @@ func readCell(reader *bytes.Reader) (*Cell, error) {
 			return c, err
 		}
 	}
+	// The cell is as it was last written to the store.
+	c.MarkClean()
 	return c, nil
 }
 
-// WriteRow writes a Row to persistant storage.
+// WriteRow writes a Row to persistant storage.  A nil Row, as is
+// the current Row of a Sheet with no rows, is ignored.
 func (cs *DiskVCellStore) WriteRow(r *Row) error {
+	if r == nil {
+		return nil
+	}
 	dvr, ok := r.cellStoreRow.(*DiskVRow)
 	if !ok {
 		return fmt.Errorf("cellStoreRow for a DiskVCellStore is not DiskVRow (%T)!", r.cellStoreRow)
@@ -1275,6 +1480,7 @@ func (cs *DiskVCellStore) WriteRow(r *Row) error {
 	if err != nil {
 		return err
 	}
+	r.modified = false
 	key := r.key()
 	return cs.store.WriteStream(key, cs.buf, true)
 }
@@ -1572,3 +1778,103 @@ func readRichText(reader *bytes.Reader) ([]RichTextRun, error) {
 
 	return rt, nil
 }
+
+// writePhonetic writes the phonetic text of a cell to a CellStore
+// record.  A nil Phonetic is written as the absence of one.
+func writePhonetic(buf *bytes.Buffer, ph *Phonetic) error {
+	if err := writeBool(buf, ph != nil); err != nil || ph == nil {
+		return err
+	}
+	if err := writeString(buf, ph.text); err != nil {
+		return err
+	}
+	if err := writeInt(buf, len(ph.Runs)); err != nil {
+		return err
+	}
+	for _, run := range ph.Runs {
+		if err := writeInt(buf, run.Start); err != nil {
+			return err
+		}
+		if err := writeInt(buf, run.End); err != nil {
+			return err
+		}
+		if err := writeString(buf, run.Text); err != nil {
+			return err
+		}
+	}
+	if err := writeBool(buf, ph.Properties != nil); err != nil || ph.Properties == nil {
+		return err
+	}
+	if err := writeInt(buf, ph.Properties.FontID); err != nil {
+		return err
+	}
+	if err := writeString(buf, ph.Properties.Type); err != nil {
+		return err
+	}
+	if err := writeString(buf, ph.Properties.Alignment); err != nil {
+		return err
+	}
+	var font []byte
+	if ph.font != nil {
+		var err error
+		if font, err = xml.Marshal(ph.font); err != nil {
+			return err
+		}
+	}
+	return writeString(buf, string(font))
+}
+
+// readPhonetic reads the phonetic text of a cell written by
+// writePhonetic.
+func readPhonetic(reader *bytes.Reader) (*Phonetic, error) {
+	hasPhonetic, err := readBool(reader)
+	if err != nil || !hasPhonetic {
+		return nil, err
+	}
+	ph := &Phonetic{}
+	if ph.text, err = readString(reader); err != nil {
+		return nil, err
+	}
+	n, err := readInt(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		var run PhoneticRun
+		if run.Start, err = readInt(reader); err != nil {
+			return nil, err
+		}
+		if run.End, err = readInt(reader); err != nil {
+			return nil, err
+		}
+		if run.Text, err = readString(reader); err != nil {
+			return nil, err
+		}
+		ph.Runs = append(ph.Runs, run)
+	}
+	hasProperties, err := readBool(reader)
+	if err != nil || !hasProperties {
+		return ph, err
+	}
+	ph.Properties = &PhoneticProperties{}
+	if ph.Properties.FontID, err = readInt(reader); err != nil {
+		return nil, err
+	}
+	if ph.Properties.Type, err = readString(reader); err != nil {
+		return nil, err
+	}
+	if ph.Properties.Alignment, err = readString(reader); err != nil {
+		return nil, err
+	}
+	font, err := readString(reader)
+	if err != nil {
+		return nil, err
+	}
+	if font != "" {
+		ph.font = &xlsxFont{}
+		if err = xml.Unmarshal([]byte(font), ph.font); err != nil {
+			return nil, err
+		}
+	}
+	return ph, nil
+}
@@ -329,12 +329,14 @@ line!`)
 	c.Run("Write and Read Alignment", func(c *qt.C) {
 		buf := bytes.NewBufferString("")
 		b := Alignment{
-			Horizontal:   "left",
-			Indent:       1,
-			ShrinkToFit:  true,
-			TextRotation: 90,
-			Vertical:     "top",
-			WrapText:     true,
+			Horizontal:      "left",
+			Indent:          1,
+			JustifyLastLine: true,
+			ReadingOrder:    ReadingOrderRightToLeft,
+			ShrinkToFit:     true,
+			TextRotation:    90,
+			Vertical:        "top",
+			WrapText:        true,
 		}
 		writeAlignment(buf, b)
 		reader := bytes.NewReader(buf.Bytes())
@@ -385,6 +387,7 @@ line!`)
 			ApplyFill:      true,
 			ApplyFont:      true,
 			ApplyAlignment: true,
+			QuotePrefix:    true,
 		}
 		err := writeStyle(buf, &s)
 		c.Assert(err, qt.IsNil)
@@ -401,6 +404,7 @@ line!`)
 		c.Assert(s2.ApplyFill, qt.Equals, s.ApplyFill)
 		c.Assert(s2.ApplyFont, qt.Equals, s.ApplyFont)
 		c.Assert(s2.ApplyAlignment, qt.Equals, s.ApplyAlignment)
+		c.Assert(s2.QuotePrefix, qt.Equals, s.QuotePrefix)
 		_, err = readStyle(reader)
 		c.Assert(err, qt.Not(qt.IsNil))
 
@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"unicode/utf8"
 
 	"github.com/klauspost/compress/zip"
@@ -19,15 +20,54 @@ import (
 type File struct {
 	worksheets           map[string]*zip.File
 	worksheetRels        map[string]*zip.File
+	parts                map[string]*zip.File
 	referenceTable       *RefTable
 	Date1904             bool
 	styles               *xlsxStyleSheet
 	Sheets               []*Sheet
 	Sheet                map[string]*Sheet
 	theme                *theme
-	DefinedNames         []*xlsxDefinedName
+	definedNames         []*xlsxDefinedName
 	cellStoreConstructor CellStoreConstructor
 	rowLimit             int
+	strict               bool
+	warnings             []Warning
+	warningErrors        map[WarningCode]bool
+	warningsMU           sync.Mutex
+	// sharedStringsMissing records the Warning that the File has
+	// no shared string table only once.
+	sharedStringsMissing sync.Once
+	auditLog             auditLog
+	minimalStyles        bool
+	defaultFontName      string
+	defaultFontSize      float64
+	localizedDateNames   bool
+	fillWidth            int
+	rawCellValues        bool
+	valueOnly            bool
+	writeInlineStrings   bool
+	skipUnmodifiedRows   bool
+	workbookPr           xlsxWorkbookPr
+	customWorkbookViews  *xlsxCustomWorkbookViews
+	// contentTypes holds the [Content_Types].xml read with the File,
+	// which gives the content types of the parts that are kept.
+	// keptRels holds the relationships of the workbook to parts that
+	// aren't read, such as pivot caches, keptParts the parts that
+	// they lead to, and pivotCaches the element of the workbook that
+	// refers to the pivot caches.
+	contentTypes *xlsxTypes
+	keptRels     []xlsxWorksheetRelation
+	keptParts    []*keptPart
+	pivotCaches  *xlsxPivotCaches
+	// formulaResultsStale is set when a cell is given a value, which
+	// may leave the cached results of formulas that refer to it out
+	// of date.
+	formulaResultsStale bool
+	// wroteFormula and wroteFormulaWithoutResult record, while the
+	// File is being written, whether any cell with a formula has been
+	// written, and whether any of those lacked a cached result.
+	wroteFormula              bool
+	wroteFormulaWithoutResult bool
 }
 
 const NoRowLimit int = -1
@@ -42,13 +82,95 @@ func RowLimit(n int) FileOption {
 	}
 }
 
+// MinimalStyles is a FileOption that makes a File without any
+// formatting save the same minimal stylesheet that Excel writes for an
+// unformatted workbook, with Calibri 11 as the default font.  Files in
+// which any cell has a style or number format are saved as usual.
+func MinimalStyles() FileOption {
+	return func(f *File) {
+		f.minimalStyles = true
+	}
+}
+
+// WithDefaultFont is a FileOption that sets the font used for cells
+// without a style when the File is saved.  Without it the font is
+// Arial 11, or Calibri 11 with MinimalStyles.  An empty name or a size
+// of 0 leaves that part of the font at its default, so
+// WithDefaultFont("", 10) gives Arial 10, or Calibri 10 with
+// MinimalStyles.
+func WithDefaultFont(name string, size float64) FileOption {
+	return func(f *File) {
+		f.defaultFontName = name
+		f.defaultFontSize = size
+	}
+}
+
+// LocalizedDateNames is a FileOption that makes FormattedValue write
+// the names of months and days in the language of the locale that a
+// date format is annotated with, such as "[$-407]dddd, d. mmmm yyyy"
+// for German.  Without it, and for the locales that aren't known, the
+// names are in English.  German, English, Spanish, French, Italian and
+// Japanese are known.
+func LocalizedDateNames() FileOption {
+	return func(f *File) {
+		f.localizedDateNames = true
+	}
+}
+
+// FillWidth is a FileOption that makes FormattedValue repeat the fill
+// character of a number format, the x of *x, until the value is width
+// characters long, as Excel fills a cell with it.  The accounting
+// formats use "* " to push the currency symbol to the left of the cell
+// and the number to the right.  Without it, or with a width of 0, the
+// fill is left out.
+func FillWidth(width int) FileOption {
+	return func(f *File) {
+		f.fillWidth = width
+	}
+}
+
+// RawCellValues is a FileOption that makes Cell.String and
+// Cell.FormattedValue return the value that each cell stores, such as
+// "44197.5" for a date, rather than apply its number format.  The
+// number formats of the cells are still read, and are returned by
+// Cell.GetNumberFormat and Cell.NumFmtID, but aren't parsed, which
+// saves time when reading large files.
+func RawCellValues() FileOption {
+	return func(f *File) {
+		f.rawCellValues = true
+	}
+}
+
+// WriteInlineStrings is a FileOption that makes a File write the text
+// of string cells inline, in each cell, rather than in the shared
+// string table.  The file is larger, as each repeated string is
+// written in full, but the table doesn't have to be built in memory
+// while writing large files.  Inline strings are read either way.
+func WriteInlineStrings() FileOption {
+	return func(f *File) {
+		f.writeInlineStrings = true
+	}
+}
+
+// SkipUnmodifiedRows is a FileOption that makes a File with a
+// CellStore that persists its rows, such as the DiskVCellStore or the
+// RedisCellStore, write a row back to the store only if it has been
+// modified, as reported by Row.Modified, since it was last written.
+// Unchanged rows that are visited while reading a large file are then
+// left as they are in the store.
+func SkipUnmodifiedRows() FileOption {
+	return func(f *File) {
+		f.skipUnmodifiedRows = true
+	}
+}
+
 // NewFile creates a new File struct. You may pass it zero, one or
 // many FileOption functions that affect the behaviour of the file.
 func NewFile(options ...FileOption) *File {
 	f := &File{
 		Sheet:                make(map[string]*Sheet),
 		Sheets:               make([]*Sheet, 0),
-		DefinedNames:         make([]*xlsxDefinedName, 0),
+		definedNames:         make([]*xlsxDefinedName, 0),
 		rowLimit:             NoRowLimit,
 		cellStoreConstructor: NewMemoryCellStoreConstructor(),
 	}
@@ -167,6 +289,23 @@ func (f *File) Write(writer io.Writer) error {
 	return nil
 }
 
+// checkSheetName returns an error if sheetName can't be the name of a
+// sheet.
+func checkSheetName(sheetName string) error {
+	runeLength := utf8.RuneCountInString(sheetName)
+	if runeLength > 31 || runeLength == 0 {
+		return fmt.Errorf("sheet name must be 31 or fewer characters long.  It is currently '%d' characters long", runeLength)
+	}
+	// Iterate over the runes
+	for _, r := range sheetName {
+		// Excel forbids : \ / ? * [ ]
+		if r == ':' || r == '\\' || r == '/' || r == '?' || r == '*' || r == '[' || r == ']' {
+			return fmt.Errorf("sheet name must not contain any restricted characters : \\ / ? * [ ] but contains '%s'", string(r))
+		}
+	}
+	return nil
+}
+
 // AddSheet Add a new Sheet, with the provided name, to a File.
 // The minimum sheet name length is 1 character. If the sheet name length is less an error is thrown.
 // The maximum sheet name length is 31 characters. If the sheet name length is exceeded an error is thrown.
@@ -180,16 +319,8 @@ func (f *File) AddSheetWithCellStore(sheetName string, constructor CellStoreCons
 	if _, exists := f.Sheet[sheetName]; exists {
 		return nil, fmt.Errorf("duplicate sheet name '%s'.", sheetName)
 	}
-	runeLength := utf8.RuneCountInString(sheetName)
-	if runeLength > 31 || runeLength == 0 {
-		return nil, fmt.Errorf("sheet name must be 31 or fewer characters long.  It is currently '%d' characters long", runeLength)
-	}
-	// Iterate over the runes
-	for _, r := range sheetName {
-		// Excel forbids : \ / ? * [ ]
-		if r == ':' || r == '\\' || r == '/' || r == '?' || r == '*' || r == '[' || r == ']' {
-			return nil, fmt.Errorf("sheet name must not contain any restricted characters : \\ / ? * [ ] but contains '%s'", string(r))
-		}
+	if err := checkSheetName(sheetName); err != nil {
+		return nil, err
 	}
 	sheet := &Sheet{
 		Name:     sheetName,
@@ -204,6 +335,7 @@ func (f *File) AddSheetWithCellStore(sheetName string, constructor CellStoreCons
 	}
 	f.Sheet[sheetName] = sheet
 	f.Sheets = append(f.Sheets, sheet)
+	f.audit(AuditAddSheet, sheetName, "", "", "")
 	return sheet, nil
 }
 
@@ -217,16 +349,343 @@ func (f *File) AppendSheet(sheet Sheet, sheetName string) (*Sheet, error) {
 	sheet.Selected = len(f.Sheets) == 0
 	f.Sheet[sheetName] = &sheet
 	f.Sheets = append(f.Sheets, &sheet)
+	f.audit(AuditAddSheet, sheetName, "", "", "")
 	return &sheet, nil
 }
 
+// ImportSheetVerbatim adds a copy of the Sheet called sheetName in src
+// to the File, under the same name.  Unlike AppendSheet, which shares
+// the source Sheet's cells, the rows, cells and columns are copied into
+// the File's own cell store.  Their styles are copied with any theme
+// or indexed colours already resolved against the theme of src, so the
+// imported sheet looks the same in the File as it did in src, whatever
+// theme the File uses.
+//
+// The parts that the Sheet was read with and that aren't read, such as
+// its drawing, the charts in it and their media, are copied as they
+// were read, as are its tables.  Only the names of parts, and the ids
+// of tables, that the File already has are changed.  Pivot tables are
+// left out, as their pivot caches belong to src's workbook, and
+// charts that refer to other sheets of src go on referring to them by
+// name.  The tables of the Sheet mustn't share a name with a table or
+// defined name of the File.
+//
+// A RedisCellStore keeps the rows of a Sheet under keys named after
+// it, so a Sheet can't be imported from a File that keeps its rows on
+// the same Redis server as the File does: the two Sheets would share
+// their rows.
+func (f *File) ImportSheetVerbatim(src *File, sheetName string) (*Sheet, error) {
+	wrap := func(err error) (*Sheet, error) {
+		return nil, fmt.Errorf("ImportSheetVerbatim: %w", err)
+	}
+	srcSheet, ok := src.Sheet[sheetName]
+	if !ok {
+		return wrap(fmt.Errorf("sheet %q does not exist", sheetName))
+	}
+	shared, err := redisKeysShared(srcSheet, sheetName, f.cellStoreConstructor)
+	if err != nil {
+		return wrap(err)
+	}
+	if shared {
+		return wrap(fmt.Errorf("sheet %q would share its rows in Redis with the Sheet of src", sheetName))
+	}
+	for _, t := range srcSheet.tables {
+		if err := f.checkTableNameUnused(t.DisplayName); err != nil {
+			return wrap(err)
+		}
+	}
+	sheet, err := f.AddSheet(sheetName)
+	if err != nil {
+		return wrap(err)
+	}
+	err = srcSheet.copyTo(sheet)
+	if err != nil {
+		return wrap(err)
+	}
+	srcSheet.importTables(sheet)
+	err = srcSheet.importKeptParts(sheet)
+	if err != nil {
+		return wrap(err)
+	}
+	sheet.namedSheetViews = append([][]byte(nil), srcSheet.namedSheetViews...)
+	return sheet, nil
+}
+
+// CopySheet adds a copy of the Sheet called srcName, called dstName,
+// to the end of the File.  See Sheet.Clone.
+func (f *File) CopySheet(srcName, dstName string) (*Sheet, error) {
+	src, ok := f.Sheet[srcName]
+	if !ok {
+		return nil, fmt.Errorf("CopySheet: sheet %q does not exist", srcName)
+	}
+	sheet, err := src.Clone(f, dstName)
+	if err != nil {
+		return nil, fmt.Errorf("CopySheet: %w", err)
+	}
+	return sheet, nil
+}
+
+// RenameSheet renames the Sheet called oldName to newName, which no
+// other Sheet of the File may have, whatever its case, as Excel
+// compares sheet names regardless of case.  References to the Sheet in
+// the formulas, internal hyperlinks, data validations, sparklines and
+// charts of every Sheet, and in the File's defined names, are changed
+// to newName, and the Sheet's rows are moved to its new name in its
+// CellStore.  If any of them can't be read, RenameSheet returns an
+// error without changing anything, rather than leave references to a
+// sheet that no longer exists.
+func (f *File) RenameSheet(oldName, newName string) error {
+	sheet, ok := f.Sheet[oldName]
+	if !ok {
+		return fmt.Errorf("RenameSheet: sheet %q does not exist", oldName)
+	}
+	if err := checkSheetName(newName); err != nil {
+		return fmt.Errorf("RenameSheet: %w", err)
+	}
+	for _, other := range f.Sheets {
+		if other != sheet && strings.EqualFold(other.Name, newName) {
+			return fmt.Errorf("RenameSheet: duplicate sheet name %q", newName)
+		}
+	}
+	if newName == oldName {
+		return nil
+	}
+	// Every reference is checked before any is changed, so that a
+	// formula that can't be read leaves the File as it was.
+	for _, check := range []bool{true, false} {
+		r := sheetRefRenamer{oldName: oldName, newName: newName, check: check}
+		for _, s := range f.Sheets {
+			if err := s.renameSheetRefs(r); err != nil {
+				return fmt.Errorf("RenameSheet: sheet %q: %w", s.Name, err)
+			}
+		}
+		for _, dn := range f.definedNames {
+			data, err := r.formula(dn.Data)
+			if err != nil {
+				return fmt.Errorf("RenameSheet: defined name %q: %w", dn.Name, err)
+			}
+			dn.Data = data
+		}
+	}
+	// The current row has to be written under the old name before
+	// the rows are moved.
+	sheet.setCurrentRow(nil)
+	if renamer, ok := sheet.cellStore.(sheetRenamer); ok {
+		if err := renamer.renameSheet(oldName, newName); err != nil {
+			return fmt.Errorf("RenameSheet: %w", err)
+		}
+	}
+	sheet.Name = newName
+	delete(f.Sheet, oldName)
+	f.Sheet[newName] = sheet
+	f.audit(AuditRenameSheet, newName, "", oldName, newName)
+	return nil
+}
+
+// MoveSheet moves the Sheet called name to index toIndex in Sheets,
+// shifting the Sheets between its old and new places along by one.
+// The scope of the File's sheet-scoped defined names follows their
+// Sheets, and the active Sheet stays the same Sheet.
+func (f *File) MoveSheet(name string, toIndex int) error {
+	sheet, ok := f.Sheet[name]
+	if !ok {
+		return fmt.Errorf("MoveSheet: sheet %q does not exist", name)
+	}
+	if toIndex < 0 || toIndex >= len(f.Sheets) {
+		return fmt.Errorf("MoveSheet: index %d is out of range for %d sheets", toIndex, len(f.Sheets))
+	}
+	fromIndex := f.sheetIndex(sheet)
+	if fromIndex == toIndex {
+		return nil
+	}
+	sheets := append(f.Sheets[:fromIndex:fromIndex], f.Sheets[fromIndex+1:]...)
+	sheets = append(sheets[:toIndex], append([]*Sheet{sheet}, sheets[toIndex:]...)...)
+	f.Sheets = sheets
+	for _, dn := range f.definedNames {
+		if dn.LocalSheetID == nil {
+			continue
+		}
+		id := *dn.LocalSheetID
+		switch {
+		case id == fromIndex:
+			id = toIndex
+		case fromIndex < id && id <= toIndex:
+			id--
+		case toIndex <= id && id < fromIndex:
+			id++
+		}
+		dn.LocalSheetID = &id
+	}
+	f.audit(AuditMoveSheet, name, "", strconv.Itoa(fromIndex), strconv.Itoa(toIndex))
+	return nil
+}
+
+// RemoveSheet removes the Sheet called name from the File, along with
+// the defined names that are scoped to it, and closes it, so that the
+// rows in its CellStore are cleared away.  The worksheet is no longer
+// written, nor are its relationships and content type.  If the Sheet
+// was the active one, the next visible Sheet, or else the one before
+// it, becomes active.  A File must keep at least one visible Sheet, so
+// the last one can't be removed.  References to the Sheet from other
+// Sheets are left as they are.
+func (f *File) RemoveSheet(name string) error {
+	sheet, ok := f.Sheet[name]
+	if !ok {
+		return fmt.Errorf("RemoveSheet: sheet %q does not exist", name)
+	}
+	index := f.sheetIndex(sheet)
+	visible := -1
+	if !sheet.Hidden {
+		// The Sheet that becomes active in its place, if it was.
+		for i := index + 1; i < len(f.Sheets) && visible < 0; i++ {
+			if !f.Sheets[i].Hidden {
+				visible = i
+			}
+		}
+		for i := index - 1; i >= 0 && visible < 0; i-- {
+			if !f.Sheets[i].Hidden {
+				visible = i
+			}
+		}
+		if visible < 0 {
+			return fmt.Errorf("RemoveSheet: sheet %q is the last visible sheet", name)
+		}
+	}
+	if f.ActiveSheet() == index && visible >= 0 {
+		for i, s := range f.Sheets {
+			s.Selected = i == visible
+		}
+	}
+	f.Sheets = append(f.Sheets[:index:index], f.Sheets[index+1:]...)
+	delete(f.Sheet, name)
+	names := make([]*xlsxDefinedName, 0, len(f.definedNames))
+	for _, dn := range f.definedNames {
+		if dn.LocalSheetID != nil {
+			id := *dn.LocalSheetID
+			if id == index {
+				continue
+			}
+			if id > index {
+				id--
+				dn.LocalSheetID = &id
+			}
+		}
+		names = append(names, dn)
+	}
+	f.definedNames = names
+	f.audit(AuditRemoveSheet, name, "", "", "")
+	if sheet.cellStore != nil {
+		err := sheet.cellStore.Close()
+		sheet.cellStore = nil
+		if err != nil {
+			return fmt.Errorf("RemoveSheet: %w", err)
+		}
+	}
+	return nil
+}
+
+// sheetIndex returns the index of sheet in Sheets, or -1 if it isn't
+// one of the File's Sheets.
+func (f *File) sheetIndex(sheet *Sheet) int {
+	for i, s := range f.Sheets {
+		if s == sheet {
+			return i
+		}
+	}
+	return -1
+}
+
+// CodeName returns the code name of the workbook, which is the name
+// that VBA code refers to it by, as in ThisWorkbook, or empty if it
+// hasn't got one.
+func (f *File) CodeName() string {
+	return f.workbookPr.CodeName
+}
+
+// SetCodeName sets the code name of the workbook.  See CodeName.
+func (f *File) SetCodeName(name string) {
+	f.workbookPr.CodeName = name
+}
+
+// DefaultThemeVersion returns the version of the default theme of the
+// application that last saved the workbook, such as "164011", or
+// empty.  Excel uses it to decide how to treat the colors and fonts of
+// the workbook when it checks compatibility.
+func (f *File) DefaultThemeVersion() string {
+	return f.workbookPr.DefaultThemeVersion
+}
+
+// SetDefaultThemeVersion sets the default theme version of the
+// workbook.  See DefaultThemeVersion.
+func (f *File) SetDefaultThemeVersion(version string) {
+	f.workbookPr.DefaultThemeVersion = version
+}
+
+// makeWorkbookPr returns the workbookPr element to write for the
+// File: the one that was read with the File, if any, with its
+// date1904 attribute set from the Date1904 field.  Attributes from
+// other namespaces are dropped, because their prefixes aren't known.
+func (f *File) makeWorkbookPr() xlsxWorkbookPr {
+	pr := f.workbookPr
+	pr.Attrs = nil
+	for _, attr := range f.workbookPr.Attrs {
+		if attr.Name.Space == "" {
+			pr.Attrs = append(pr.Attrs, attr)
+		}
+	}
+	if pr.ShowObjects == "" {
+		pr.ShowObjects = "all"
+	}
+	pr.Date1904 = f.Date1904
+	return pr
+}
+
+// SetActiveSheet makes the Sheet at index in Sheets the one that is
+// shown, with its tab selected, when the File is opened.  A hidden
+// Sheet can't be made active.
+func (f *File) SetActiveSheet(index int) error {
+	if index < 0 || index >= len(f.Sheets) {
+		return fmt.Errorf("SetActiveSheet: index %d is out of range for %d sheets", index, len(f.Sheets))
+	}
+	if f.Sheets[index].Hidden {
+		return fmt.Errorf("SetActiveSheet: sheet %q is hidden", f.Sheets[index].Name)
+	}
+	for i, sheet := range f.Sheets {
+		sheet.Selected = i == index
+	}
+	return nil
+}
+
+// ActiveSheet returns the index in Sheets of the Sheet that is shown
+// when the File is opened: the first visible one that is Selected, or
+// else the first visible one.
+func (f *File) ActiveSheet() int {
+	first := -1
+	for i, sheet := range f.Sheets {
+		if sheet.Hidden {
+			continue
+		}
+		if sheet.Selected {
+			return i
+		}
+		if first < 0 {
+			first = i
+		}
+	}
+	if first < 0 {
+		return 0
+	}
+	return first
+}
+
 func (f *File) makeWorkbook() xlsxWorkbook {
 	return xlsxWorkbook{
 		FileVersion: xlsxFileVersion{AppName: "Go XLSX"},
-		WorkbookPr:  xlsxWorkbookPr{ShowObjects: "all"},
+		WorkbookPr:  f.makeWorkbookPr(),
 		BookViews: xlsxBookViews{
 			WorkBookView: []xlsxWorkBookView{
 				{
+					ActiveTab:            f.ActiveSheet(),
 					ShowHorizontalScroll: true,
 					ShowSheetTabs:        true,
 					ShowVerticalScroll:   true,
@@ -238,7 +697,8 @@ func (f *File) makeWorkbook() xlsxWorkbook {
 				},
 			},
 		},
-		Sheets: xlsxSheets{Sheet: make([]xlsxSheet, len(f.Sheets))},
+		Sheets:       xlsxSheets{Sheet: make([]xlsxSheet, len(f.Sheets))},
+		DefinedNames: f.makeDefinedNames(),
 		CalcPr: xlsxCalcPr{
 			IterateCount: 100,
 			RefMode:      "A1",
@@ -248,6 +708,24 @@ func (f *File) makeWorkbook() xlsxWorkbook {
 	}
 }
 
+// noteFormula records that a cell with a formula is being written.
+func (f *File) noteFormula(cell *Cell) {
+	if f == nil {
+		return
+	}
+	f.wroteFormula = true
+	if cell.Value == "" && len(cell.RichText) == 0 {
+		f.wroteFormulaWithoutResult = true
+	}
+}
+
+// fullCalcOnLoad reports whether the workbook being written should
+// ask Excel to recalculate every formula when it's opened, because
+// some of their cached results are missing or may be out of date.
+func (f *File) fullCalcOnLoad() bool {
+	return f.wroteFormulaWithoutResult || (f.wroteFormula && f.formulaResultsStale)
+}
+
 // Some tools that read XLSX files have very strict requirements about
 // the structure of the input XML.  In particular both Numbers on the Mac
 // and SAS dislike inline XML namespace declarations, or namespace
@@ -290,9 +768,23 @@ func addRelationshipNameSpaceToWorksheet(worksheetMarshal string) string {
 	oldHyperlink := `<hyperlink id=`
 	newHyperlink := `<hyperlink r:id=`
 	newSheetMarshall = strings.Replace(newSheetMarshall, oldHyperlink, newHyperlink, -1)
+	newSheetMarshall = strings.Replace(newSheetMarshall, `<drawing id=`, `<drawing r:id=`, 1)
+	newSheetMarshall = strings.Replace(newSheetMarshall, `<legacyDrawing id=`, `<legacyDrawing r:id=`, 1)
+	newSheetMarshall = strings.Replace(newSheetMarshall, `<tablePart id=`, `<tablePart r:id=`, -1)
 	return newSheetMarshall
 }
 
+// checkVisibleSheet returns an error unless at least one of the
+// sheets of the File is visible, as Excel requires.
+func (f *File) checkVisibleSheet() error {
+	for _, sheet := range f.Sheets {
+		if !sheet.Hidden {
+			return nil
+		}
+	}
+	return errors.New("Workbook must contain at least one visible worksheet")
+}
+
 // MakeStreamParts constructs a map of file name to XML content
 // representing the file in terms of the structure of an XLSX file.
 func (f *File) MakeStreamParts() (map[string]string, error) {
@@ -315,15 +807,26 @@ func (f *File) MakeStreamParts() (map[string]string, error) {
 	parts = make(map[string]string)
 	workbook = f.makeWorkbook()
 	sheetIndex := 1
-
-	if f.styles == nil {
-		f.styles = newXlsxStyleSheet(f.theme)
+	namedSheetViewIndex := 1
+	drawings := drawingParts{image: 1, chart: 1, used: f.keptPartNames(), usedVMLBlocks: f.keptVMLBlocks()}
+	written := make(map[string]bool)
+	tableIndex := 1
+	firstTableID := f.firstNewTableID()
+	keptCustomViews := false
+	addPart := func(partName string, part []byte) error {
+		parts[partName] = string(part)
+		return nil
 	}
-	f.styles.reset()
+
+	f.resetStyles()
+	f.wroteFormula, f.wroteFormulaWithoutResult = false, false
 	if len(f.Sheets) == 0 {
 		err := errors.New("Workbook must contains atleast one worksheet")
 		return nil, err
 	}
+	if err := f.checkVisibleSheet(); err != nil {
+		return nil, err
+	}
 	for _, sheet := range f.Sheets {
 		// Make sure we don't lose the current state!
 		err := sheet.cellStore.WriteRow(sheet.currentRow)
@@ -332,16 +835,46 @@ func (f *File) MakeStreamParts() (map[string]string, error) {
 		}
 
 		xSheetRels := sheet.makeXLSXSheetRelations()
-		xSheet := sheet.makeXLSXSheet(refTable, f.styles, xSheetRels)
+		xSheetRels, err = sheet.addComments(xSheetRels, &types, sheetIndex, &drawings, addPart)
+		if err != nil {
+			return nil, err
+		}
+		xSheetRels, err = sheet.addDrawing(xSheetRels, &types, sheetIndex, &drawings, addPart)
+		if err != nil {
+			return nil, err
+		}
+		xSheetRels, tableIndex, err = sheet.addTables(xSheetRels, &types, firstTableID, tableIndex, addPart)
+		if err != nil {
+			return nil, err
+		}
+		xSheetRels, err = sheet.addKeptParts(xSheetRels, &types, written, addPart)
+		if err != nil {
+			return nil, err
+		}
+		xSheet, err := sheet.makeXLSXSheet(refTable, f.styles, xSheetRels)
+		if err != nil {
+			return nil, err
+		}
 		rId := fmt.Sprintf("rId%d", sheetIndex)
 		sheetId := strconv.Itoa(sheetIndex)
 		sheetPath := fmt.Sprintf("worksheets/sheet%d.xml", sheetIndex)
 		partName := "xl/" + sheetPath
-		relPartName := fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", sheetIndex)
-		sheetState := sheetStateVisible
-		if sheet.Hidden {
-			sheetState = sheetStateHidden
+		keep, err := sheet.keepsCustomViews(partName)
+		if err != nil {
+			return nil, err
 		}
+		err = sheet.checkExtensions(partName)
+		if err != nil {
+			return nil, err
+		}
+		if keep {
+			keptCustomViews = keptCustomViews || xSheet.CustomSheetViews != nil
+			xSheetRels, namedSheetViewIndex, err = sheet.addNamedSheetViews(xSheetRels, &types, namedSheetViewIndex, addPart)
+			if err != nil {
+				return nil, err
+			}
+		}
+		relPartName := fmt.Sprintf("xl/worksheets/_rels/sheet%d.xml.rels", sheetIndex)
 		types.Overrides = append(
 			types.Overrides,
 			xlsxOverride{
@@ -352,7 +885,7 @@ func (f *File) MakeStreamParts() (map[string]string, error) {
 			Name:    sheet.Name,
 			SheetId: sheetId,
 			Id:      rId,
-			State:   sheetState}
+			State:   sheet.getState()}
 
 		worksheetMarshal, err := marshal(xSheet)
 		if err != nil {
@@ -369,6 +902,17 @@ func (f *File) MakeStreamParts() (map[string]string, error) {
 		sheetIndex++
 	}
 
+	workbook.CalcPr.FullCalcOnLoad = f.fullCalcOnLoad()
+	if keptCustomViews {
+		workbook.CustomWorkbookViews = f.customWorkbookViews
+	}
+	// The workbook's own relationships are those of its sheets, its
+	// shared strings, theme and styles, and then those it keeps.
+	keptRels := f.makeKeptWorkbookRels(&workbook, len(f.Sheets)+4)
+	err = writeKeptParts(f.keptParts, &types, written, addPart)
+	if err != nil {
+		return parts, err
+	}
 	workbookMarshal, err := marshal(workbook)
 	if err != nil {
 		return parts, err
@@ -392,6 +936,7 @@ func (f *File) MakeStreamParts() (map[string]string, error) {
 	}
 
 	xWRel := workbookRels.MakeXLSXWorkbookRels()
+	xWRel.Relationships = append(xWRel.Relationships, keptRels...)
 
 	parts["xl/_rels/workbook.xml.rels"], err = marshal(xWRel)
 	if err != nil {
@@ -403,9 +948,13 @@ func (f *File) MakeStreamParts() (map[string]string, error) {
 		return parts, err
 	}
 
-	parts["xl/styles.xml"], err = f.styles.Marshal()
-	if err != nil {
-		return parts, err
+	if f.minimalStyles && f.styles.unformatted() {
+		parts["xl/styles.xml"] = string(f.styles.MarshalMinimal())
+	} else {
+		parts["xl/styles.xml"], err = f.styles.Marshal()
+		if err != nil {
+			return parts, err
+		}
 	}
 
 	return parts, nil
@@ -451,15 +1000,22 @@ func (f *File) MarshallParts(zipWriter *zip.Writer) error {
 	// parts = make(map[string]string)
 	workbook = f.makeWorkbook()
 	sheetIndex := 1
-
-	if f.styles == nil {
-		f.styles = newXlsxStyleSheet(f.theme)
-	}
-	f.styles.reset()
+	namedSheetViewIndex := 1
+	drawings := drawingParts{image: 1, chart: 1, used: f.keptPartNames(), usedVMLBlocks: f.keptVMLBlocks()}
+	written := make(map[string]bool)
+	tableIndex := 1
+	firstTableID := f.firstNewTableID()
+	keptCustomViews := false
+
+	f.resetStyles()
+	f.wroteFormula, f.wroteFormulaWithoutResult = false, false
 	if len(f.Sheets) == 0 {
 		err := errors.New("MarshalParts: Workbook must contain at least one worksheet")
 		return wrap(err)
 	}
+	if err := f.checkVisibleSheet(); err != nil {
+		return wrap(err)
+	}
 	for _, sheet := range f.Sheets {
 		if sheet.currentRow != nil {
 			// Make sure we don't lose the current state!
@@ -487,6 +1043,34 @@ func (f *File) MarshallParts(zipWriter *zip.Writer) error {
 			Id:      rId,
 			State:   sheet.getState()}
 
+		keep, err := sheet.keepsCustomViews(partName)
+		if err != nil {
+			return wrap(err)
+		}
+		err = sheet.checkExtensions(partName)
+		if err != nil {
+			return wrap(err)
+		}
+		// The parts of the comments, drawing, tables and those that
+		// are kept are written
+		// before the worksheet, which refers to them, as only one part
+		// can be written at a time.
+		xSheetRels, err = sheet.addComments(xSheetRels, &types, sheetIndex, &drawings, writePart)
+		if err != nil {
+			return wrap(err)
+		}
+		xSheetRels, err = sheet.addDrawing(xSheetRels, &types, sheetIndex, &drawings, writePart)
+		if err != nil {
+			return wrap(err)
+		}
+		xSheetRels, tableIndex, err = sheet.addTables(xSheetRels, &types, firstTableID, tableIndex, writePart)
+		if err != nil {
+			return wrap(err)
+		}
+		xSheetRels, err = sheet.addKeptParts(xSheetRels, &types, written, writePart)
+		if err != nil {
+			return wrap(err)
+		}
 		w, err := zipWriter.Create(partName)
 		if err != nil {
 			return wrap(err)
@@ -495,6 +1079,13 @@ func (f *File) MarshallParts(zipWriter *zip.Writer) error {
 		if err != nil {
 			return wrap(err)
 		}
+		if keep {
+			keptCustomViews = keptCustomViews || sheet.customSheetViews != nil
+			xSheetRels, namedSheetViewIndex, err = sheet.addNamedSheetViews(xSheetRels, &types, namedSheetViewIndex, writePart)
+			if err != nil {
+				return wrap(err)
+			}
+		}
 
 		if xSheetRels != nil {
 			relPart, err := marshal(xSheetRels)
@@ -509,6 +1100,17 @@ func (f *File) MarshallParts(zipWriter *zip.Writer) error {
 		sheetIndex++
 	}
 
+	workbook.CalcPr.FullCalcOnLoad = f.fullCalcOnLoad()
+	if keptCustomViews {
+		workbook.CustomWorkbookViews = f.customWorkbookViews
+	}
+	// The workbook's own relationships are those of its sheets, its
+	// shared strings, theme and styles, and then those it keeps.
+	keptRels := f.makeKeptWorkbookRels(&workbook, len(f.Sheets)+4)
+	err = writeKeptParts(f.keptParts, &types, written, writePart)
+	if err != nil {
+		return err
+	}
 	workbookMarshal, err := marshal(workbook)
 	if err != nil {
 		return err
@@ -549,6 +1151,7 @@ func (f *File) MarshallParts(zipWriter *zip.Writer) error {
 	}
 
 	xWRel := workbookRels.MakeXLSXWorkbookRels()
+	xWRel.Relationships = append(xWRel.Relationships, keptRels...)
 	relPart, err := marshal(xWRel)
 	if err != nil {
 		return err
@@ -568,6 +1171,9 @@ func (f *File) MarshallParts(zipWriter *zip.Writer) error {
 		return err
 	}
 
+	if f.minimalStyles && f.styles.unformatted() {
+		return writePart("xl/styles.xml", f.styles.MarshalMinimal())
+	}
 	styles, err := f.styles.MarshalBytes()
 	if err != nil {
 		return err
@@ -576,6 +1182,54 @@ func (f *File) MarshallParts(zipWriter *zip.Writer) error {
 	return writePart("xl/styles.xml", styles)
 }
 
+// resetStyles empties the stylesheet, ready for the styles of the cells
+// being saved to be added to it.
+func (f *File) resetStyles() {
+	if f.styles == nil {
+		f.styles = newXlsxStyleSheet(f.theme)
+	}
+	f.styles.defaultFontName = f.defaultFontName
+	f.styles.defaultFontSize = f.defaultFontSize
+	f.styles.reset()
+}
+
+// StyleCount returns the number of cell styles in the File's
+// stylesheet: those read when the File was opened, or those written
+// when it was last saved.  Styles given to cells since then are only
+// counted once the File has been saved again.
+func (f *File) StyleCount() int {
+	if f.styles == nil {
+		return 0
+	}
+	return f.styles.CellXfs.Count
+}
+
+// StyleAt returns a copy of the cell style at index i of the File's
+// stylesheet, where i is less than StyleCount.  The copy can be
+// changed without affecting the cells that use the style.
+func (f *File) StyleAt(i int) (*Style, error) {
+	if i < 0 || i >= f.StyleCount() {
+		return nil, fmt.Errorf("StyleAt: index %d out of range, the file has %d styles", i, f.StyleCount())
+	}
+	return f.styles.getStyle(i), nil
+}
+
+// NumberFormats returns the custom number formats in the File's
+// stylesheet, keyed by their numFmtId.  Built in number formats, which
+// aren't stored in the file, aren't included.
+func (f *File) NumberFormats() map[int]string {
+	formats := make(map[int]string)
+	if f.styles == nil {
+		return formats
+	}
+	f.styles.numFmtRefTableMU.RLock()
+	defer f.styles.numFmtRefTableMU.RUnlock()
+	for id, numFmt := range f.styles.numFmtRefTable {
+		formats[id] = numFmt.FormatCode
+	}
+	return formats
+}
+
 // Return the raw data contained in the File as three
 // dimensional slice.  The first index represents the sheet number,
 // the second the row number, and the third the cell number.
@@ -1,12 +1,17 @@
 package xlsx
 
 import (
+	"bytes"
 	"encoding/xml"
+	"errors"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 )
@@ -462,11 +467,11 @@ func TestFile(t *testing.T) {
 
 		// sheets
 		expectedSheet1 := `<?xml version="1.0" encoding="UTF-8"?>
-<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"></pageSetUpPr></sheetPr><dimension ref="A1"></dimension><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="true" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"></selection></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"></sheetFormatPr><sheetData><row r="1" ht="0" customHeight="true"><c r="A1" t="s"><v>0</v></c></row></sheetData></worksheet>`
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"></pageSetUpPr></sheetPr><dimension ref="A1"></dimension><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="true" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"></selection></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"></sheetFormatPr><sheetData><row r="1" spans="1:1"><c r="A1" t="s"><v>0</v></c></row></sheetData></worksheet>`
 		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Equals, expectedSheet1)
 
 		expectedSheet2 := `<?xml version="1.0" encoding="UTF-8"?>
-<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"></pageSetUpPr></sheetPr><dimension ref="A1"></dimension><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="false" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"></selection></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"></sheetFormatPr><sheetData><row r="1" ht="0" customHeight="true"><c r="A1" t="s"><v>0</v></c></row></sheetData></worksheet>`
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"></pageSetUpPr></sheetPr><dimension ref="A1"></dimension><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="false" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"></selection></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"></sheetFormatPr><sheetData><row r="1" spans="1:1"><c r="A1" t="s"><v>0</v></c></row></sheetData></worksheet>`
 		c.Assert(parts["xl/worksheets/sheet2.xml"], qt.Equals, expectedSheet2)
 
 		// .rels.xml
@@ -926,6 +931,57 @@ func TestFile(t *testing.T) {
 		c.Assert(s.Hidden, qt.Equals, true)
 	})
 
+	csRunO(c, "SheetVisibility", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		for _, name := range []string{"Shown", "Hidden", "VeryHidden"} {
+			sheet, err := f.AddSheet(name)
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(sheet.Close)
+			sheet.AddRow().AddCell().SetString(name)
+		}
+		c.Assert(f.Sheet["Shown"].Visibility(), qt.Equals, SheetVisible)
+		c.Assert(f.Sheet["Hidden"].SetVisibility(SheetHidden), qt.IsNil)
+		c.Assert(f.Sheet["VeryHidden"].SetVisibility(SheetVeryHidden), qt.IsNil)
+		c.Assert(f.Sheet["Shown"].SetVisibility(SheetVisibility(3)), qt.ErrorMatches, `SetVisibility: invalid visibility 3`)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		workbookXML := parts["xl/workbook.xml"]
+		c.Assert(workbookXML, qt.Contains, `name="Shown" sheetId="1" r:id="rId1" state="visible"`)
+		c.Assert(workbookXML, qt.Contains, `name="Hidden" sheetId="2" r:id="rId2" state="hidden"`)
+		c.Assert(workbookXML, qt.Contains, `name="VeryHidden" sheetId="3" r:id="rId3" state="veryHidden"`)
+
+		// The visibility is kept through opening and saving again.
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		for i := 0; i < 2; i++ {
+			f, err = OpenBinary(buf.Bytes(), option)
+			c.Assert(err, qt.IsNil)
+			c.Assert(f.Sheet["Shown"].Visibility(), qt.Equals, SheetVisible)
+			c.Assert(f.Sheet["Hidden"].Visibility(), qt.Equals, SheetHidden)
+			c.Assert(f.Sheet["VeryHidden"].Visibility(), qt.Equals, SheetVeryHidden)
+			c.Assert(f.Sheet["VeryHidden"].Hidden, qt.IsTrue)
+			buf.Reset()
+			c.Assert(f.Write(&buf), qt.IsNil)
+			for _, sheet := range f.Sheets {
+				sheet.Close()
+			}
+		}
+
+		// At least one sheet has to stay visible.
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, sheet := range f.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		c.Assert(f.Sheet["Shown"].SetVisibility(SheetHidden), qt.IsNil)
+		_, err = f.MakeStreamParts()
+		c.Assert(err, qt.ErrorMatches, `Workbook must contain at least one visible worksheet`)
+		c.Assert(f.Write(&bytes.Buffer{}), qt.ErrorMatches, `.*Workbook must contain at least one visible worksheet`)
+		c.Assert(f.Sheet["VeryHidden"].SetVisibility(SheetVisible), qt.IsNil)
+		c.Assert(f.Write(&bytes.Buffer{}), qt.IsNil)
+	})
+
 	csRunO(c, "TestMarshalFileWithHiddenRow", func(c *qt.C, option FileOption) {
 		var f *File
 		f = NewFile(option)
@@ -1229,3 +1285,1152 @@ func TestSliceReader(t *testing.T) {
 	})
 
 }
+
+func TestMinimalStyles(t *testing.T) {
+	c := qt.New(t)
+
+	// partXML returns the named part of an xlsx file.
+	partXML := func(c *qt.C, data []byte, part string) string {
+		var body string
+		rewriteXLSX(c, data, func(name string, b []byte) (string, []byte) {
+			if name == part {
+				body = string(b)
+			}
+			return name, b
+		})
+		return body
+	}
+
+	// original.xlsx was saved by Excel without any formatting, so its
+	// styles.xml is the baseline that MinimalStyles has to match.
+	data, err := ioutil.ReadFile("./testdocs/original.xlsx")
+	c.Assert(err, qt.IsNil)
+	baseline := partXML(c, data, "xl/styles.xml")
+
+	// parseStyles reads a styles.xml part.
+	parseStyles := func(c *qt.C, body string) *xlsxStyleSheet {
+		styles := newXlsxStyleSheet(nil)
+		c.Assert(xml.Unmarshal([]byte(body), styles), qt.IsNil)
+		return styles
+	}
+
+	// assertMatches checks that got has the same fonts, fills, borders,
+	// xfs and cell styles as want.  Excel's own styles.xml also has an
+	// extension list, and names the Normal style in the language that
+	// Excel ran in, so the two are not compared byte for byte.
+	assertMatches := func(c *qt.C, got, want *xlsxStyleSheet) {
+		c.Assert(got.Fonts, qt.DeepEquals, want.Fonts)
+		c.Assert(got.Fills, qt.DeepEquals, want.Fills)
+		c.Assert(got.Borders, qt.DeepEquals, want.Borders)
+		c.Assert(got.CellStyleXfs, qt.DeepEquals, want.CellStyleXfs)
+		c.Assert(got.CellXfs, qt.DeepEquals, want.CellXfs)
+		c.Assert(got.CellStyles.Count, qt.Equals, want.CellStyles.Count)
+		c.Assert(got.NumFmts, qt.IsNil)
+		c.Assert(got.DXfs, qt.DeepEquals, want.DXfs)
+	}
+
+	makeFile := func(c *qt.C, options ...FileOption) *File {
+		f := NewFile(options...)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetString("value")
+		row.AddCell().SetInt(42)
+		return f
+	}
+
+	// stylesXML returns the styles.xml part that Write produces.
+	stylesXML := func(c *qt.C, f *File) string {
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		return partXML(c, buf.Bytes(), "xl/styles.xml")
+	}
+
+	c.Run("Baseline", func(c *qt.C) {
+		want := parseStyles(c, baseline)
+		c.Assert(want.Fonts.Count, qt.Equals, 1)
+		c.Assert(want.Fonts.Font[0].Name.Val, qt.Equals, "Calibri")
+		c.Assert(want.Fonts.Font[0].Sz.Val, qt.Equals, "11")
+		c.Assert(want.Fills.Count, qt.Equals, 2)
+		c.Assert(want.Borders.Count, qt.Equals, 1)
+		c.Assert(want.CellXfs.Count, qt.Equals, 1)
+	})
+
+	c.Run("Write", func(c *qt.C) {
+		f := makeFile(c, MinimalStyles())
+		assertMatches(c, parseStyles(c, stylesXML(c, f)), parseStyles(c, baseline))
+	})
+
+	c.Run("MakeStreamParts", func(c *qt.C) {
+		f := makeFile(c, MinimalStyles())
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		assertMatches(c, parseStyles(c, parts["xl/styles.xml"]), parseStyles(c, baseline))
+		c.Assert(parts["xl/styles.xml"], qt.Equals, stylesXML(c, makeFile(c, MinimalStyles())))
+	})
+
+	c.Run("Reopen", func(c *qt.C) {
+		f := makeFile(c, MinimalStyles())
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err := OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.styles.Fonts.Font[0].Name.Val, qt.Equals, "Calibri")
+		output, err := f.ToSlice()
+		c.Assert(err, qt.IsNil)
+		c.Assert(output, qt.DeepEquals, [][][]string{{{"value", "42"}}})
+	})
+
+	c.Run("Formatted", func(c *qt.C) {
+		f := makeFile(c, MinimalStyles())
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		style := NewStyle()
+		style.Font.Bold = true
+		style.ApplyFont = true
+		cell.SetStyle(style)
+		styles := stylesXML(c, f)
+		c.Assert(parseStyles(c, styles).CellXfs.Count > 1, qt.IsTrue)
+		c.Assert(styles, qt.Contains, `<name val="Arial"/>`)
+	})
+
+	c.Run("DefaultFont", func(c *qt.C) {
+		f := makeFile(c, WithDefaultFont("Segoe UI", 10.5))
+		styles := stylesXML(c, f)
+		c.Assert(styles, qt.Contains, `<font><sz val="10.5"/><name val="Segoe UI"/><family val="2"/>`)
+	})
+
+	c.Run("DefaultFontSizeOnly", func(c *qt.C) {
+		f := makeFile(c, WithDefaultFont("", 10))
+		c.Assert(stylesXML(c, f), qt.Contains, `<font><sz val="10"/><name val="Arial"/>`)
+
+		f = makeFile(c, MinimalStyles(), WithDefaultFont("", 10))
+		c.Assert(parseStyles(c, stylesXML(c, f)).Fonts.Font[0].Name.Val, qt.Equals, "Calibri")
+	})
+
+	c.Run("MinimalWithDefaultFont", func(c *qt.C) {
+		f := makeFile(c, MinimalStyles(), WithDefaultFont("Segoe UI", 10.5))
+		want := parseStyles(c, baseline)
+		want.Fonts.Font[0].Sz.Val = "10.5"
+		want.Fonts.Font[0].Name.Val = "Segoe UI"
+		assertMatches(c, parseStyles(c, stylesXML(c, f)), want)
+	})
+}
+
+func TestStyleEnumeration(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "Read", func(c *qt.C, option FileOption) {
+		// duplicate_styles.xlsx has 300 identical styles after the
+		// default one, each with its own "0.000" number format.
+		f, err := OpenFile("./testdocs/duplicate_styles.xlsx", option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.StyleCount(), qt.Equals, 301)
+
+		style, err := f.StyleAt(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(style.Font.Bold, qt.IsTrue)
+		c.Assert(style.Font.Color, qt.Equals, "FFFF0000")
+		c.Assert(style.Fill.FgColor, qt.Equals, "FFFFFF00")
+
+		// StyleAt returns a copy of the cached style.
+		style.Font.Bold = false
+		style, err = f.StyleAt(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(style.Font.Bold, qt.IsTrue)
+
+		_, err = f.StyleAt(301)
+		c.Assert(err, qt.ErrorMatches, "StyleAt: index 301 out of range, the file has 301 styles")
+		_, err = f.StyleAt(-1)
+		c.Assert(err, qt.Not(qt.IsNil))
+
+		formats := f.NumberFormats()
+		c.Assert(formats, qt.HasLen, 300)
+		c.Assert(formats[164], qt.Equals, "0.000")
+		c.Assert(formats[463], qt.Equals, "0.000")
+
+		// Every one of the identical styles is used by the cells in
+		// column A, and the default style by those in column B.
+		sheet := f.Sheets[0]
+		for _, i := range []int{1, 300} {
+			var refs []string
+			err = sheet.CellsWithStyle(i, func(cell *Cell) error {
+				x, y := cell.GetCoordinates()
+				refs = append(refs, GetCellIDStringFromCoords(x, y))
+				return nil
+			})
+			c.Assert(err, qt.IsNil)
+			c.Assert(refs, qt.HasLen, 300)
+			c.Assert(refs[0], qt.Equals, "A1")
+			c.Assert(refs[299], qt.Equals, "A300")
+		}
+		var count int
+		err = sheet.CellsWithStyle(0, func(cell *Cell) error {
+			x, _ := cell.GetCoordinates()
+			c.Assert(x, qt.Equals, 1)
+			count++
+			return nil
+		})
+		c.Assert(err, qt.IsNil)
+		c.Assert(count, qt.Equals, 300)
+
+		err = sheet.CellsWithStyle(301, func(cell *Cell) error { return nil })
+		c.Assert(err, qt.ErrorMatches, "CellsWithStyle: StyleAt: index 301 out of range.*")
+	})
+
+	csRunO(c, "AddedAfterLoad", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		c.Assert(f.StyleCount(), qt.Equals, 0)
+		c.Assert(f.NumberFormats(), qt.HasLen, 0)
+		sheet, err := f.AddSheet("Styled")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetFloatWithFormat(1.5, "0.0000")
+		style := NewStyle()
+		style.Font.Italic = true
+		style.ApplyFont = true
+		cell.SetStyle(style)
+
+		// Styles given to cells are counted once the file is saved.
+		c.Assert(f.StyleCount(), qt.Equals, 0)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		c.Assert(f.StyleCount(), qt.Equals, 2)
+		saved, err := f.StyleAt(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(saved.Font.Italic, qt.IsTrue)
+		c.Assert(f.NumberFormats(), qt.DeepEquals, map[int]string{164: "0.0000"})
+
+		var found []*Cell
+		err = sheet.CellsWithStyle(1, func(cell *Cell) error {
+			found = append(found, cell)
+			return nil
+		})
+		c.Assert(err, qt.IsNil)
+		c.Assert(found, qt.HasLen, 1)
+		c.Assert(found[0].Value, qt.Equals, "1.5")
+	})
+}
+
+func TestImportSheetVerbatim(t *testing.T) {
+	c := qt.New(t)
+
+	// readParts returns the parts that f is saved as.
+	readParts := func(c *qt.C, f *File) map[string]string {
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		parts := make(map[string]string)
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			parts[name] = string(body)
+			return name, body
+		})
+		return parts
+	}
+
+	// The source and destination files style their cells with the same
+	// theme colours, but their themes give those colours different values.
+	// The sources of these tests are read into memory, as a Sheet can't
+	// be imported from a File that keeps its rows on the same Redis
+	// server; see SharedRedisKeys.
+	csRunO(c, "DifferentThemes", func(c *qt.C, option FileOption) {
+		src, err := OpenFile("./testdocs/theme_import_source.xlsx", UseMemoryCellStore)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(src.Sheet["Imported"].Close)
+		dst, err := OpenFile("./testdocs/theme_import_dest.xlsx", option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(dst.Sheet["Local"].Close)
+		before := readParts(c, src)
+
+		sheet, err := dst.ImportSheetVerbatim(src, "Imported")
+		c.Assert(err, qt.IsNil)
+		c.Assert(dst.Sheets, qt.HasLen, 2)
+		c.Assert(dst.Sheets[1], qt.Equals, sheet)
+
+		var buf bytes.Buffer
+		c.Assert(dst.Write(&buf), qt.IsNil)
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		imported := saved.Sheet["Imported"]
+		c.Assert(imported, qt.Not(qt.IsNil))
+		c.Cleanup(imported.Close)
+
+		a1, err := imported.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(a1.Value, qt.Equals, "1.5")
+		c.Assert(a1.NumFmt, qt.Equals, "0.000")
+		style := a1.GetStyle()
+		c.Assert(style.Fill.FgColor, qt.Equals, "FF112233")
+		c.Assert(style.Font.Color, qt.Equals, "FF445566")
+		c.Assert(style.Font.Bold, qt.IsTrue)
+		c.Assert(style.Border.LeftColor, qt.Equals, "FF778899")
+		b1, err := imported.Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(b1.Value, qt.Equals, "source")
+
+		row, err := imported.Row(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.GetHeight(), qt.Equals, 30.0)
+		a2 := row.GetCell(0)
+		c.Assert(a2.Formula(), qt.Equals, "A1*2")
+		b2 := row.GetCell(1)
+		c.Assert(b2.HMerge, qt.Equals, 1)
+		col := imported.Col(1)
+		c.Assert(col, qt.Not(qt.IsNil))
+		c.Assert(*col.Width, qt.Equals, 20.0)
+
+		// The source is saved as it was before the import.
+		c.Assert(readParts(c, src), qt.DeepEquals, before)
+	})
+
+	// The destination is chart_and_pivot.xlsx with its sheets renamed,
+	// so it keeps parts with the same names as those of the Sheet that
+	// is imported from the original.
+	csRunO(c, "KeptParts", func(c *qt.C, option FileOption) {
+		fixture, err := ioutil.ReadFile("./testdocs/chart_and_pivot.xlsx")
+		c.Assert(err, qt.IsNil)
+		src, err := OpenBinary(fixture, UseMemoryCellStore)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(src.Sheet["Data"].Close)
+		c.Cleanup(src.Sheet["Report"].Close)
+		renamed := rewriteXLSX(c, fixture, func(name string, body []byte) (string, []byte) {
+			if name == "xl/workbook.xml" {
+				body = bytes.Replace(body, []byte(`name="Data"`), []byte(`name="LocalData"`), 1)
+				body = bytes.Replace(body, []byte(`name="Report"`), []byte(`name="LocalReport"`), 1)
+			}
+			return name, body
+		})
+		dst, err := OpenBinary(renamed, option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(dst.Sheet["LocalData"].Close)
+		c.Cleanup(dst.Sheet["LocalReport"].Close)
+		before := readParts(c, src)
+		original := make(map[string]string)
+		rewriteXLSX(c, fixture, func(name string, body []byte) (string, []byte) {
+			original[name] = string(body)
+			return name, body
+		})
+
+		_, err = dst.ImportSheetVerbatim(src, "Report")
+		c.Assert(err, qt.IsNil)
+		parts := readParts(c, dst)
+
+		// The destination's own parts are left where they were.
+		c.Assert(parts["xl/drawings/drawing1.xml"], qt.Equals, original["xl/drawings/drawing1.xml"])
+		c.Assert(parts["xl/charts/chart1.xml"], qt.Equals, original["xl/charts/chart1.xml"])
+		c.Assert(parts["xl/worksheets/_rels/sheet2.xml.rels"], qt.Contains, `Target="../drawings/drawing1.xml"`)
+		c.Assert(parts["xl/worksheets/_rels/sheet2.xml.rels"], qt.Contains, `Target="../pivotTables/pivotTable1.xml"`)
+
+		// The imported drawing and chart are copied as they were, under
+		// the next free names, and the relationships lead to them.
+		c.Assert(parts["xl/drawings/drawing2.xml"], qt.Equals, original["xl/drawings/drawing1.xml"])
+		c.Assert(parts["xl/charts/chart2.xml"], qt.Equals, original["xl/charts/chart1.xml"])
+		c.Assert(parts["xl/drawings/_rels/drawing2.xml.rels"], qt.Contains, `Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart2.xml"`)
+		c.Assert(parts["xl/worksheets/_rels/sheet3.xml.rels"], qt.Contains, `Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="../drawings/drawing2.xml"`)
+		c.Assert(parts["xl/worksheets/sheet3.xml"], qt.Contains, `<drawing r:id="rId1"`)
+		c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Override PartName="/xl/charts/chart2.xml" ContentType="application/vnd.openxmlformats-officedocument.drawingml.chart+xml">`)
+		c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Override PartName="/xl/drawings/drawing2.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml">`)
+
+		// The pivot table isn't imported without its pivot cache.
+		c.Assert(parts["xl/worksheets/_rels/sheet3.xml.rels"], qt.Not(qt.Contains), "pivotTable")
+		c.Assert(parts["xl/pivotTables/pivotTable2.xml"], qt.Equals, "")
+		c.Assert(parts["xl/pivotCache/pivotCacheDefinition2.xml"], qt.Equals, "")
+
+		c.Assert(readParts(c, src), qt.DeepEquals, before)
+
+		// Importing into the saved file renames the parts again.
+		var buf bytes.Buffer
+		c.Assert(dst.Write(&buf), qt.IsNil)
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(saved.Sheet["Report"], qt.Not(qt.IsNil))
+		c.Cleanup(saved.Sheet["Report"].Close)
+		c.Cleanup(saved.Sheet["LocalData"].Close)
+		c.Cleanup(saved.Sheet["LocalReport"].Close)
+		c.Assert(saved.Sheet["Report"].drawing, qt.Not(qt.IsNil))
+		c.Assert(saved.Sheet["Report"].drawing.name, qt.Equals, "xl/drawings/drawing2.xml")
+	})
+
+	csRunO(c, "Tables", func(c *qt.C, option FileOption) {
+		// makeTable returns a File saved and read back with a table,
+		// so that the table is kept as it was read, with the id 1.
+		makeTable := func(c *qt.C, option FileOption, sheetName, tableName string) *File {
+			f := NewFile(option)
+			sheet, err := f.AddSheet(sheetName)
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(sheet.Close)
+			sheet.AddRow().AddCell().SetString("Item")
+			sheet.AddRow().AddCell().SetString("tea")
+			c.Assert(sheet.AddTable("A1:A2", tableName, TableOptions{}), qt.IsNil)
+			var buf bytes.Buffer
+			c.Assert(f.Write(&buf), qt.IsNil)
+			f, err = OpenBinary(buf.Bytes(), option)
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(f.Sheet[sheetName].Close)
+			return f
+		}
+		src := makeTable(c, UseMemoryCellStore, "ImportTableSource", "Sales")
+		dst := makeTable(c, option, "ImportTableLocal", "Stock")
+
+		sheet, err := dst.ImportSheetVerbatim(src, "ImportTableSource")
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.Tables(), qt.HasLen, 1)
+		c.Assert(sheet.Tables()[0].Name, qt.Equals, "Sales")
+		parts := readParts(c, dst)
+		c.Assert(parts["xl/tables/table1.xml"], qt.Contains, `id="1" name="Stock"`)
+		c.Assert(parts["xl/tables/table2.xml"], qt.Contains, `id="2" name="Sales"`)
+		c.Assert(src.Sheet["ImportTableSource"].tables[0].ID, qt.Equals, 1)
+
+		// A table can't be imported into a File that has one with
+		// its name.
+		other := makeTable(c, option, "ImportTableOther", "sales")
+		_, err = other.ImportSheetVerbatim(src, "ImportTableSource")
+		c.Assert(err, qt.ErrorMatches, `ImportSheetVerbatim: there is already a table called "Sales"`)
+		c.Assert(other.Sheets, qt.HasLen, 1)
+	})
+
+	csRunO(c, "Errors", func(c *qt.C, option FileOption) {
+		src, err := OpenFile("./testdocs/theme_import_source.xlsx", UseMemoryCellStore)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(src.Sheet["Imported"].Close)
+
+		dst := NewFile(option)
+		_, err = dst.ImportSheetVerbatim(src, "Missing")
+		c.Assert(err, qt.ErrorMatches, `ImportSheetVerbatim: sheet "Missing" does not exist`)
+		sheet, err := dst.AddSheet("Imported")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		_, err = dst.ImportSheetVerbatim(src, "Imported")
+		c.Assert(err, qt.ErrorMatches, "ImportSheetVerbatim: duplicate sheet name 'Imported'.")
+	})
+
+	c.Run("SharedRedisKeys", func(c *qt.C) {
+		option := UseRedisCellStore(RedisCellStoreOption{RedisAddr: "localhost"})
+		src, err := OpenFile("./testdocs/theme_import_source.xlsx", option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(src.Sheet["Imported"].Close)
+		dst, err := OpenFile("./testdocs/theme_import_dest.xlsx", option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(dst.Sheet["Local"].Close)
+		before := readParts(c, src)
+
+		_, err = dst.ImportSheetVerbatim(src, "Imported")
+		c.Assert(err, qt.ErrorMatches, `ImportSheetVerbatim: sheet "Imported" would share its rows in Redis with the Sheet of src`)
+		c.Assert(dst.Sheets, qt.HasLen, 1)
+		c.Assert(readParts(c, src), qt.DeepEquals, before)
+
+		// A File that keeps its rows elsewhere can import the Sheet.
+		other := NewFile(UseDiskVCellStore)
+		sheet, err := other.ImportSheetVerbatim(src, "Imported")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		c.Assert(readParts(c, src), qt.DeepEquals, before)
+	})
+}
+
+func TestSaveWarnings(t *testing.T) {
+	c := qt.New(t)
+
+	makeFile := func(c *qt.C, options ...FileOption) *File {
+		f := NewFile(options...)
+		sheet, err := f.AddSheet("LongText")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		sheet.AddRow().AddCell().SetString(strings.Repeat("x", 40000))
+		return f
+	}
+
+	c.Run("Write", func(c *qt.C) {
+		f := makeFile(c)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 1)
+		c.Assert(warnings[0].Code, qt.Equals, WarningCellTextTooLong)
+		c.Assert(warnings[0].Severity, qt.Equals, SeverityDataLoss)
+		c.Assert(warnings[0].Location, qt.Equals, "LongText!A1")
+		c.Assert(warnings[0].Message, qt.Equals, `cell A1 in sheet "LongText" has 40000 characters, more than the 32767 that Excel allows; Excel will truncate it`)
+	})
+
+	c.Run("MakeStreamParts", func(c *qt.C) {
+		f := makeFile(c)
+		_, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Warnings(), qt.HasLen, 1)
+	})
+
+	c.Run("AsError", func(c *qt.C) {
+		f := makeFile(c, WarningsAsErrors(WarningCellTextTooLong))
+		var buf bytes.Buffer
+		err := f.Write(&buf)
+		var warningErr *WarningError
+		c.Assert(errors.As(err, &warningErr), qt.IsTrue)
+		c.Assert(warningErr.Warning.Code, qt.Equals, WarningCellTextTooLong)
+		c.Assert(f.Warnings(), qt.HasLen, 0)
+	})
+}
+
+func TestWorkbookPr(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "MacroWorkbook", func(c *qt.C, option FileOption) {
+		f, err := OpenFile("./testdocs/macro_workbook.xlsm", option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.CodeName(), qt.Equals, "ThisWorkbook")
+		c.Assert(f.DefaultThemeVersion(), qt.Equals, "164011")
+		c.Assert(f.Date1904, qt.IsFalse)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/workbook.xml"], qt.Contains, `<workbookPr defaultThemeVersion="164011" showObjects="all" codeName="ThisWorkbook" date1904="false" checkCompatibility="1" autoCompressPictures="0"></workbookPr>`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(saved.CodeName(), qt.Equals, "ThisWorkbook")
+		c.Assert(saved.DefaultThemeVersion(), qt.Equals, "164011")
+	})
+
+	csRunO(c, "NewFile", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell().SetInt(1)
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/workbook.xml"], qt.Contains, `<workbookPr showObjects="all" date1904="false"></workbookPr>`)
+
+		f.SetCodeName("Book")
+		f.SetDefaultThemeVersion("124226")
+		f.Date1904 = true
+		parts, err = f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/workbook.xml"], qt.Contains, `<workbookPr defaultThemeVersion="124226" showObjects="all" codeName="Book" date1904="true"></workbookPr>`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(saved.CodeName(), qt.Equals, "Book")
+		c.Assert(saved.Date1904, qt.IsTrue)
+	})
+}
+
+func TestFormulaCachedResults(t *testing.T) {
+	c := qt.New(t)
+
+	// writtenParts returns the parts of the File as written by both
+	// MakeStreamParts and Write.
+	writtenParts := func(c *qt.C, f *File) []map[string]string {
+		streamed, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		written := make(map[string]string)
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			written[name] = string(body)
+			return name, body
+		})
+		return []map[string]string{streamed, written}
+	}
+
+	csRunO(c, "Transitions", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("FormulaTransitions")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell()
+		// The cell is looked up for each change, as saving the File
+		// writes its row out to the cell store.
+		var cell *Cell
+
+		transitions := []struct {
+			about    string
+			change   func()
+			expected string
+		}{{
+			about:    "literal",
+			change:   func() { cell.SetInt(5) },
+			expected: `<c r="A1"><v>5</v></c>`,
+		}, {
+			about:    "formula replaces literal",
+			change:   func() { cell.SetFormula("2+3") },
+			expected: `<c r="A1"><f>2+3</f></c>`,
+		}, {
+			about:    "formula result",
+			change:   func() { cell.SetFormulaResult("5") },
+			expected: `<c r="A1"><f>2+3</f><v>5</v></c>`,
+		}, {
+			about:    "cleared result",
+			change:   func() { cell.ClearCachedResult() },
+			expected: `<c r="A1"><f>2+3</f></c>`,
+		}, {
+			about: "string formula",
+			change: func() {
+				cell.SetStringFormula(`"a"&"b"`)
+				cell.SetFormulaResult("ab")
+			},
+			expected: `<c r="A1" t="str"><f>&#34;a&#34;&amp;&#34;b&#34;</f><v>ab</v></c>`,
+		}, {
+			about:    "string replaces formula",
+			change:   func() { cell.SetString("x") },
+			expected: `<c r="A1" t="s"><v>0</v></c>`,
+		}, {
+			about: "bool replaces formula",
+			change: func() {
+				cell.SetFormula("TRUE")
+				cell.SetBool(true)
+			},
+			expected: `<c r="A1" t="b"><v>1</v></c>`,
+		}}
+		for _, transition := range transitions {
+			c.Run(transition.about, func(c *qt.C) {
+				cell, err = sheet.Cell(0, 0)
+				c.Assert(err, qt.IsNil)
+				transition.change()
+				for _, parts := range writtenParts(c, f) {
+					c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, transition.expected)
+				}
+			})
+		}
+		cell, err = sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Formula(), qt.Equals, "")
+	})
+
+	csRunO(c, "FormulaAndValue", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("FormulaAndValue")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetFormulaAndValue("1/4", 0.25)
+		row.AddCell().SetFormulaAndValue("2*3", 6)
+		row.AddCell().SetFormulaAndValue(`"a"&"b"`, "ab")
+		row.AddCell().SetFormulaAndValue("1<2", true)
+		row.AddCell().SetFormulaAndBool("1>2", false)
+		row.AddCell().SetFormulaAndValue("A1*2", nil)
+		row.AddCell().SetFormulaAndValue("DATE(2020,1,2)", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC))
+		row.AddCell().SetFormulaAndValue("TIME(1,30,0)", 90*time.Minute)
+		row.AddCell().SetFormulaAndValue("2^40", uint64(1<<40))
+		row.AddCell().SetFormulaAndValue("1/0", ErrorDiv0)
+		row.AddCell().SetFormulaAndValue("10^20", new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil))
+		for _, parts := range writtenParts(c, f) {
+			written := parts["xl/worksheets/sheet1.xml"]
+			c.Assert(written, qt.Contains, `<c r="A1"><f>1/4</f><v>0.25</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="B1"><f>2*3</f><v>6</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="C1" t="str"><f>&#34;a&#34;&amp;&#34;b&#34;</f><v>ab</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="D1" t="b"><f>1&lt;2</f><v>1</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="E1" t="b"><f>1&gt;2</f><v>0</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="F1"><f>A1*2</f></c>`)
+			c.Assert(written, qt.Matches, `(?s).*<c r="G1" s="\d+"><f>DATE\(2020,1,2\)</f><v>43832</v></c>.*`)
+			c.Assert(written, qt.Matches, `(?s).*<c r="H1" s="\d+"><f>TIME\(1,30,0\)</f><v>0.0625</v></c>.*`)
+			c.Assert(written, qt.Contains, `<c r="I1"><f>2^40</f><v>1099511627776</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="J1" t="e"><f>1/0</f><v>#DIV/0!</v></c>`)
+			c.Assert(written, qt.Contains, `<c r="K1"><f>10^20</f><v>100000000000000000000</v></c>`)
+		}
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		cell, err := f.Sheets[0].Cell(0, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Formula(), qt.Equals, `"a"&"b"`)
+		c.Assert(cell.Value, qt.Equals, "ab")
+		cell, err = f.Sheets[0].Cell(0, 3)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Bool(), qt.IsTrue)
+		cell, err = f.Sheets[0].Cell(0, 6)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Formula(), qt.Equals, "DATE(2020,1,2)")
+		c.Assert(cell.IsTime(), qt.IsTrue)
+	})
+
+	csRunO(c, "FullCalcOnLoad", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("FullCalcOnLoad")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell().SetInt(1)
+		for _, parts := range writtenParts(c, f) {
+			c.Assert(parts["xl/workbook.xml"], qt.Not(qt.Contains), "fullCalcOnLoad")
+		}
+
+		// A formula without a cached result needs calculating.
+		formula, err := sheet.Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		formula.SetFormula("A1*2")
+		for _, parts := range writtenParts(c, f) {
+			c.Assert(parts["xl/workbook.xml"], qt.Contains, `fullCalcOnLoad="true"`)
+		}
+	})
+
+	csRunO(c, "ReadFormulas", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("ReadFormulas")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetInt(1)
+		formula := row.AddCell()
+		formula.SetFormula("A1*2")
+		formula.SetFormulaResult("2")
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+
+		// Cached results read from a file are kept as they are...
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, parts := range writtenParts(c, f) {
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `<f>A1*2</f><v>2</v></c>`)
+			c.Assert(parts["xl/workbook.xml"], qt.Not(qt.Contains), "fullCalcOnLoad")
+		}
+
+		// ... until a value that they might depend on changes.
+		a1, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		a1.SetInt(4)
+		for _, parts := range writtenParts(c, f) {
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `<f>A1*2</f><v>2</v></c>`)
+			c.Assert(parts["xl/workbook.xml"], qt.Contains, `fullCalcOnLoad="true"`)
+		}
+	})
+}
+
+func TestInternalAndRangedHyperlinks(t *testing.T) {
+	c := qt.New(t)
+
+	// sheetParts returns the worksheet part and its relationships
+	// written for the File through both of the ways of writing one.
+	sheetParts := func(c *qt.C, f *File) [][2]string {
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var written [2]string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			switch name {
+			case "xl/worksheets/sheet1.xml":
+				written[0] = string(body)
+			case "xl/worksheets/_rels/sheet1.xml.rels":
+				written[1] = string(body)
+			}
+			return name, body
+		})
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		streamed := [2]string{parts["xl/worksheets/sheet1.xml"], parts["xl/worksheets/_rels/sheet1.xml.rels"]}
+		return [][2]string{written, streamed}
+	}
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Links")
+		c.Assert(err, qt.IsNil)
+		_, err = f.AddSheet("Sheet 2")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("Go to Sheet 2")
+		cell.SetInternalHyperlink("'Sheet 2'!A1")
+		cell, err = sheet.Cell(1, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetHyperlink("https://example.com/", "Example", "")
+		cell.Hyperlink.HSpan = 2
+		cell.Hyperlink.VSpan = 1
+
+		for _, parts := range sheetParts(c, f) {
+			c.Assert(parts[0], qt.Matches, `(?s).*<hyperlink ref="A1" location="(&#39;|')Sheet 2(&#39;|')!A1"(/>|>).*`)
+			c.Assert(parts[0], qt.Matches, `(?s).*<hyperlink r:id="rId1" ref="A2:C3" display="Example"(/>|>).*`)
+			c.Assert(parts[1], qt.Contains, `Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/" TargetMode="External"`)
+		}
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		sheet = f.Sheets[0]
+		cell, err = sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Hyperlink, qt.Equals, Hyperlink{Location: "'Sheet 2'!A1"})
+		cell, err = sheet.Cell(1, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Hyperlink, qt.Equals, Hyperlink{DisplayString: "Example", Link: "https://example.com/", HSpan: 2, VSpan: 1})
+
+		// The links read are written again, and follow their cells
+		// when rows are removed.
+		c.Assert(sheet.RemoveRowAtIndex(0), qt.IsNil)
+		for _, parts := range sheetParts(c, f) {
+			c.Assert(parts[0], qt.Not(qt.Contains), `location=`)
+			c.Assert(parts[0], qt.Matches, `(?s).*<hyperlink r:id="rId1" ref="A1:C2" display="Example"(/>|>).*`)
+			c.Assert(parts[1], qt.Contains, `Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://example.com/" TargetMode="External"`)
+		}
+	})
+}
+
+func TestActiveSheet(t *testing.T) {
+	c := qt.New(t)
+
+	f := NewFile()
+	for _, name := range []string{"First", "Hidden", "Input"} {
+		sheet, err := f.AddSheet(name)
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell().SetString(name)
+	}
+	f.Sheets[1].Hidden = true
+	c.Assert(f.ActiveSheet(), qt.Equals, 0)
+	c.Assert(f.SetActiveSheet(3), qt.Not(qt.IsNil))
+	c.Assert(f.SetActiveSheet(1), qt.Not(qt.IsNil))
+	c.Assert(f.SetActiveSheet(2), qt.IsNil)
+	c.Assert(f.ActiveSheet(), qt.Equals, 2)
+	c.Assert(f.Sheets[0].Selected, qt.IsFalse)
+
+	parts, err := f.MakeStreamParts()
+	c.Assert(err, qt.IsNil)
+	c.Assert(parts["xl/workbook.xml"], qt.Contains, `<workbookView activeTab="2"`)
+	c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `tabSelected="false"`)
+	c.Assert(parts["xl/worksheets/sheet3.xml"], qt.Contains, `tabSelected="true"`)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), qt.IsNil)
+	f2, err := OpenBinary(buf.Bytes())
+	c.Assert(err, qt.IsNil)
+	c.Assert(f2.ActiveSheet(), qt.Equals, 2)
+	c.Assert(f2.Sheets[2].Selected, qt.IsTrue)
+	c.Assert(f2.Sheets[0].Selected, qt.IsFalse)
+}
+
+func TestCopySheet(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "SameFile", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		src, err := f.AddSheet("CopySource")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(src.Close)
+		row := src.AddRow()
+		row.SetHeight(30)
+		cell := row.AddCell()
+		cell.SetString("merged")
+		cell.HMerge = 1
+		style := NewStyle()
+		style.Font.Bold = true
+		style.ApplyFont = true
+		cell.SetStyle(style)
+		dv := NewDataValidation(0, 0, 0, 0, true)
+		c.Assert(dv.SetDropList([]string{"a", "b"}), qt.IsNil)
+		cell.SetDataValidation(dv)
+		row.AddCell()
+		link := src.AddRow().AddCell()
+		link.SetHyperlink("https://example.com", "Example", "")
+		src.SetColWidth(1, 1, 25)
+		c.Assert(src.SetPageSetup(PageSetup{Orientation: OrientationLandscape}), qt.IsNil)
+
+		dst, err := f.CopySheet("CopySource", "CopyDest")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(dst.Close)
+		_, err = f.CopySheet("NoSuchSheet", "Other")
+		c.Assert(err, qt.Not(qt.IsNil))
+		_, err = f.CopySheet("CopySource", "CopyDest")
+		c.Assert(err, qt.Not(qt.IsNil))
+
+		// Changing the copy leaves the source alone.
+		copied, err := dst.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(copied.Value, qt.Equals, "merged")
+		copied.SetString("changed")
+		copied.SetStyle(NewStyle())
+		original, err := src.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(original.Value, qt.Equals, "merged")
+		c.Assert(original.GetStyle().Font.Bold, qt.IsTrue)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f2.Sheets, qt.HasLen, 2)
+		for _, sheet := range f2.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		dst2 := f2.Sheet["CopyDest"]
+		c.Assert(dst2, qt.Not(qt.IsNil))
+		cell2, err := dst2.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell2.Value, qt.Equals, "changed")
+		c.Assert(cell2.HMerge, qt.Equals, 1)
+		c.Assert(cell2.GetStyle().Font.Bold, qt.IsFalse)
+		c.Assert(dst2.ColWidth(0), qt.Equals, 25.0)
+		c.Assert(dst2.PageSetup().Orientation, qt.Equals, OrientationLandscape)
+		c.Assert(dst2.DataValidations, qt.HasLen, 1)
+		link2, err := dst2.Cell(1, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(link2.Hyperlink.Link, qt.Equals, "https://example.com")
+		row2, err := dst2.Row(0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row2.GetHeight(), qt.Equals, 30.0)
+		src2, err := f2.Sheet["CopySource"].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(src2.Value, qt.Equals, "merged")
+		c.Assert(src2.GetStyle().Font.Bold, qt.IsTrue)
+	})
+
+	csRunO(c, "OtherFile", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		src, err := f.AddSheet("CloneSource")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(src.Close)
+		cell := src.AddRow().AddCell()
+		cell.SetString("styled")
+		style := NewStyle()
+		style.Fill = *NewFill(Solid_Cell_Fill, "FFFF0000", "FF000000")
+		style.ApplyFill = true
+		cell.SetStyle(style)
+
+		other := NewFile(option)
+		first, err := other.AddSheet("CloneOther")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(first.Close)
+		first.AddRow().AddCell().SetString("already here")
+		dst, err := src.Clone(other, "CloneDest")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(dst.Close)
+		c.Assert(other.Sheets, qt.HasLen, 2)
+		c.Assert(dst.File, qt.Equals, other)
+
+		var buf bytes.Buffer
+		c.Assert(other.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, sheet := range f2.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		cell2, err := f2.Sheet["CloneDest"].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell2.Value, qt.Equals, "styled")
+		c.Assert(cell2.GetStyle().Fill.FgColor, qt.Equals, "FFFF0000")
+	})
+
+	csRunO(c, "Charts", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		src, err := f.AddSheet("ChartSource")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(src.Close)
+		lookup, err := f.AddSheet("ChartLookup")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(lookup.Close)
+		err = src.AddChart(ChartSpec{
+			Series: []ChartSeries{{
+				CategoriesRef: "ChartLookup!$A$1:$A$3",
+				ValuesRef:     "ChartSource!$B$1:$B$3",
+			}},
+		})
+		c.Assert(err, qt.IsNil)
+
+		dst, err := f.CopySheet("ChartSource", "ChartCopy")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(dst.Close)
+		// Changing the copy's chart leaves the Sheet's alone.
+		dst.charts[0].Title = "Copy"
+		c.Assert(src.charts[0].Title, qt.Equals, "")
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		charts := 0
+		for name := range parts {
+			if strings.HasPrefix(name, "xl/charts/chart") {
+				charts++
+			}
+		}
+		c.Assert(charts, qt.Equals, 2)
+		c.Assert(parts["xl/charts/chart1.xml"], qt.Contains, `<c:f>ChartSource!$B$1:$B$3</c:f>`)
+		// The copy's chart shows the copy, but still takes its
+		// categories from the other sheet.
+		c.Assert(parts["xl/charts/chart2.xml"], qt.Contains, `<c:f>ChartLookup!$A$1:$A$3</c:f>`)
+		c.Assert(parts["xl/charts/chart2.xml"], qt.Contains, `<c:f>&#39;ChartCopy&#39;!$B$1:$B$3</c:f>`)
+		c.Assert(parts["xl/worksheets/_rels/sheet3.xml.rels"], qt.Contains, `Target="../drawings/drawing3.xml"`)
+	})
+}
+
+func TestRenameSheet(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		data, err := f.AddSheet("RenameData")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(data.Close)
+		for _, value := range []string{"a", "b", "c"} {
+			data.AddRow().AddCell().SetString(value)
+		}
+		summary, err := f.AddSheet("RenameSummary")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(summary.Close)
+		row := summary.AddRow()
+		choice := row.AddCell()
+		dv := NewDataValidation(0, 0, 0, 0, true)
+		c.Assert(dv.SetListFromRange("RenameData", "A1:A3"), qt.IsNil)
+		choice.SetDataValidation(dv)
+		row.AddCell().SetFormula("RenameData!A1&\"RenameData!A1\"")
+		row.AddCell().SetInternalHyperlink("RenameData!A2")
+		f.definedNames = append(f.definedNames, &xlsxDefinedName{Name: "Items", Data: "RenameData!$A$1:$A$3"})
+
+		c.Assert(f.RenameSheet("NoSuchSheet", "Other"), qt.Not(qt.IsNil))
+		c.Assert(f.RenameSheet("RenameData", "Bad/Name"), qt.Not(qt.IsNil))
+		c.Assert(f.RenameSheet("RenameData", "renamesummary"), qt.Not(qt.IsNil))
+		c.Assert(f.RenameSheet("RenameData", "Renamed Data"), qt.IsNil)
+
+		c.Assert(f.Sheet["RenameData"], qt.IsNil)
+		c.Assert(f.Sheet["Renamed Data"], qt.Equals, data)
+		c.Assert(data.Name, qt.Equals, "Renamed Data")
+		// The rows were moved to the new name in the CellStore.
+		moved, err := data.Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(moved.Value, qt.Equals, "c")
+		c.Assert(f.definedNames[0].Data, qt.Equals, "'Renamed Data'!$A$1:$A$3")
+
+		check := func(sheet *Sheet) {
+			cell, err := sheet.Cell(0, 1)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.Formula(), qt.Equals, "'Renamed Data'!A1&\"RenameData!A1\"")
+			cell, err = sheet.Cell(0, 2)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.Hyperlink.Location, qt.Equals, "'Renamed Data'!A2")
+		}
+		check(summary)
+		cell, err := summary.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.DataValidation.Formula1, qt.Equals, "'Renamed Data'!$A$1:$A$3")
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, sheet := range f2.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		c.Assert(f2.Sheets[0].Name, qt.Equals, "Renamed Data")
+		cell, err = f2.Sheets[0].Cell(1, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "b")
+		summary2 := f2.Sheet["RenameSummary"]
+		check(summary2)
+		// Validations are read into the Sheet's DataValidations.
+		c.Assert(summary2.DataValidations, qt.HasLen, 1)
+		c.Assert(summary2.DataValidations[0].Formula1, qt.Equals, "'Renamed Data'!$A$1:$A$3")
+	})
+
+	csRunO(c, "Unreadable", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		data, err := f.AddSheet("RenameData")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(data.Close)
+		row := data.AddRow()
+		row.AddCell().SetFormula("RenameData!A2")
+		row.AddCell().SetFormula("RenameData!A2&\"")
+		f.definedNames = append(f.definedNames, &xlsxDefinedName{Name: "Items", Data: "RenameData!$A$1"})
+
+		// A formula that can't be read would keep a reference to the
+		// old name, so nothing is renamed.
+		c.Assert(f.RenameSheet("RenameData", "Renamed"), qt.ErrorMatches, `RenameSheet: sheet "RenameData": cell B1: .*`)
+		c.Assert(f.Sheet["RenameData"], qt.Equals, data)
+		c.Assert(data.Name, qt.Equals, "RenameData")
+		cell, err := data.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Formula(), qt.Equals, "RenameData!A2")
+		c.Assert(f.definedNames[0].Data, qt.Equals, "RenameData!$A$1")
+	})
+}
+
+func TestMoveAndRemoveSheet(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		for _, name := range []string{"OrderA", "OrderB", "OrderC", "OrderD"} {
+			sheet, err := f.AddSheet(name)
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(func() {
+				// RemoveSheet closes the Sheets that it removes.
+				if sheet.cellStore != nil {
+					sheet.Close()
+				}
+			})
+			sheet.AddRow().AddCell().SetString(name)
+		}
+		f.Sheet["OrderC"].Hidden = true
+		c.Assert(f.SetActiveSheet(1), qt.IsNil)
+		local := func(id int) *int { return &id }
+		f.definedNames = append(f.definedNames,
+			&xlsxDefinedName{Name: "Everywhere", Data: "OrderD!$A$1"},
+			&xlsxDefinedName{Name: "OnA", Data: "OrderA!$A$1", LocalSheetID: local(0)},
+			&xlsxDefinedName{Name: "OnC", Data: "OrderC!$A$1", LocalSheetID: local(2)},
+		)
+		scopes := func() map[string]int {
+			scopes := map[string]int{}
+			for _, dn := range f.definedNames {
+				scopes[dn.Name] = -1
+				if dn.LocalSheetID != nil {
+					scopes[dn.Name] = *dn.LocalSheetID
+				}
+			}
+			return scopes
+		}
+		// save writes the File and checks that it opens with the
+		// Sheets in order, and returns its parts.
+		save := func(names ...string) map[string]string {
+			var buf bytes.Buffer
+			c.Assert(f.Write(&buf), qt.IsNil)
+			parts := map[string]string{}
+			rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+				parts[name] = string(body)
+				return name, body
+			})
+			f2, err := OpenBinary(buf.Bytes(), option)
+			c.Assert(err, qt.IsNil)
+			c.Assert(f2.Sheets, qt.HasLen, len(names))
+			for i, sheet := range f2.Sheets {
+				c.Cleanup(sheet.Close)
+				c.Assert(sheet.Name, qt.Equals, names[i])
+				cell, err := sheet.Cell(0, 0)
+				c.Assert(err, qt.IsNil)
+				c.Assert(cell.Value, qt.Equals, names[i])
+			}
+			c.Assert(f2.ActiveSheet(), qt.Equals, f.ActiveSheet())
+			return parts
+		}
+
+		c.Assert(f.MoveSheet("NoSuchSheet", 0), qt.Not(qt.IsNil))
+		c.Assert(f.MoveSheet("OrderA", 4), qt.Not(qt.IsNil))
+		c.Assert(f.MoveSheet("OrderA", 2), qt.IsNil)
+		c.Assert(f.ActiveSheet(), qt.Equals, 0)
+		c.Assert(scopes(), qt.DeepEquals, map[string]int{"Everywhere": -1, "OnA": 2, "OnC": 1})
+		parts := save("OrderB", "OrderC", "OrderA", "OrderD")
+		c.Assert(parts["xl/workbook.xml"], qt.Matches, `(?s).*<workbookView (activeTab="0" )?showHorizontalScroll.*`)
+
+		// Removing the active Sheet makes the next visible one active.
+		removed := f.Sheet["OrderB"]
+		c.Assert(f.RemoveSheet("NoSuchSheet"), qt.Not(qt.IsNil))
+		c.Assert(f.RemoveSheet("OrderB"), qt.IsNil)
+		c.Assert(removed.cellStore, qt.IsNil)
+		c.Assert(f.Sheet["OrderB"], qt.IsNil)
+		c.Assert(f.ActiveSheet(), qt.Equals, 1)
+		c.Assert(scopes(), qt.DeepEquals, map[string]int{"Everywhere": -1, "OnA": 1, "OnC": 0})
+		parts = save("OrderC", "OrderA", "OrderD")
+		c.Assert(parts["xl/workbook.xml"], qt.Contains, `<workbookView activeTab="1"`)
+		c.Assert(parts["xl/workbook.xml"], qt.Not(qt.Contains), "OrderB")
+		c.Assert(parts["xl/worksheets/sheet3.xml"], qt.Not(qt.Equals), "")
+		_, ok := parts["xl/worksheets/sheet4.xml"]
+		c.Assert(ok, qt.IsFalse)
+		c.Assert(parts["[Content_Types].xml"], qt.Not(qt.Contains), "sheet4.xml")
+		c.Assert(parts["xl/_rels/workbook.xml.rels"], qt.Not(qt.Contains), "sheet4.xml")
+
+		// Removing a hidden Sheet takes its defined names with it, and
+		// the last visible Sheet can't be removed.
+		c.Assert(f.RemoveSheet("OrderC"), qt.IsNil)
+		c.Assert(scopes(), qt.DeepEquals, map[string]int{"Everywhere": -1, "OnA": 0})
+		c.Assert(f.RemoveSheet("OrderA"), qt.IsNil)
+		c.Assert(f.RemoveSheet("OrderD"), qt.ErrorMatches, `RemoveSheet: sheet "OrderD" is the last visible sheet`)
+		c.Assert(scopes(), qt.DeepEquals, map[string]int{"Everywhere": -1})
+		parts = save("OrderD")
+		c.Assert(parts["xl/workbook.xml"], qt.Matches, `(?s).*<workbookView (activeTab="0" )?showHorizontalScroll.*`)
+		_, ok = parts["xl/worksheets/sheet2.xml"]
+		c.Assert(ok, qt.IsFalse)
+	})
+}
@@ -4,8 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"math/big"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Do not edit these attributes once this struct is created. This struct should only be created by
@@ -20,6 +25,14 @@ type parsedNumberFormat struct {
 	zeroFormat                    *formatOptions
 	textFormat                    *formatOptions
 	parseEncounteredError         *error
+	// timeColor is the ARGB color that a time format is displayed in,
+	// or empty.  Time formats have only one section.
+	timeColor string
+	// conditionalSections holds the sections that numbers are shown
+	// with, when any of them has a condition such as [>=1000].  They
+	// are then chosen by their conditions rather than by the sign of
+	// the number.
+	conditionalSections []*formatOptions
 }
 
 type formatOptions struct {
@@ -29,6 +42,75 @@ type formatOptions struct {
 	reducedFormatString string
 	prefix              string
 	suffix              string
+	fraction            *fractionFormat
+	scientific          *scientificFormat
+	interleaved         *interleavedFormat
+	// color is the ARGB color that the section is displayed in, such
+	// as "FFFF0000" for [Red], or empty.
+	color string
+	// scale is the number of commas after the last digit placeholder,
+	// as in "#,##0,," for millions.  Each divides the value by 1000.
+	scale int
+	// condition is the comparison that picks the section, such as
+	// [>=1000], or nil.
+	condition *numFmtCondition
+}
+
+// numFmtCondition is the condition of a section of a number format,
+// such as [>=1000], which the section is used for the numbers that
+// meet.
+type numFmtCondition struct {
+	operator string
+	value    float64
+}
+
+// matches reports whether value meets the condition.
+func (condition *numFmtCondition) matches(value float64) bool {
+	switch condition.operator {
+	case "<":
+		return value < condition.value
+	case "<=":
+		return value <= condition.value
+	case ">":
+		return value > condition.value
+	case ">=":
+		return value >= condition.value
+	case "=":
+		return value == condition.value
+	case "<>":
+		return value != condition.value
+	}
+	return false
+}
+
+// onlyNegative reports whether the condition is only met by negative
+// numbers, as with [<0].  Like the negative section of a format
+// without conditions, such a section shows the number without its
+// sign, leaving the format to show it if it wants to.
+func (condition *numFmtCondition) onlyNegative() bool {
+	switch condition.operator {
+	case "<":
+		return condition.value <= 0
+	case "<=":
+		return condition.value < 0
+	}
+	return false
+}
+
+// parseNumFmtCondition parses the text of a bracket in a number format,
+// such as ">=1000", as a condition.
+func parseNumFmtCondition(text string) (*numFmtCondition, bool) {
+	for _, operator := range []string{"<=", ">=", "<>", "<", ">", "="} {
+		if !strings.HasPrefix(text, operator) {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(text[len(operator):]), 64)
+		if err != nil {
+			return nil, false
+		}
+		return &numFmtCondition{operator: operator, value: value}, true
+	}
+	return nil, false
 }
 
 // FormatValue returns a value, and possibly an error condition
@@ -73,13 +155,14 @@ func (fullFormat *parsedNumberFormat) FormatValue(cell *Cell) (string, error) {
 		// There will be text in the cell's value that can be shown, something ugly like #NAME? or #######
 		return cell.Value, nil
 	case CellTypeBool:
-		if cell.Value == "0" {
-			return "FALSE", nil
-		} else if cell.Value == "1" {
-			return "TRUE", nil
-		} else {
+		b, err := cell.BoolChecked()
+		if err != nil {
 			return cell.Value, errors.New("invalid value in bool cell")
 		}
+		if b {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
 	case CellTypeString:
 		fallthrough
 	case CellTypeInline:
@@ -118,6 +201,217 @@ func (fullFormat *parsedNumberFormat) FormatValue(cell *Cell) (string, error) {
 	}
 }
 
+// maxParsedNumFmtCache is the number of formats that parsedNumFmtCache
+// holds at most.  It is emptied when it is full, so that a program that
+// formats values with many different codes, such as codes that it
+// makes up, doesn't hold on to all of them.
+const maxParsedNumFmtCache = 1024
+
+// parsedNumFmtCache holds the number formats that FormatValue and
+// FormatText have parsed, by their format code, so that each code is
+// only parsed once while it is held.
+var (
+	parsedNumFmtCache   = map[string]*parsedNumberFormat{}
+	parsedNumFmtCacheMU sync.RWMutex
+)
+
+// cachedNumberFormat returns the parsed form of a number format code,
+// from parsedNumFmtCache if it has been parsed before.
+func cachedNumberFormat(code string) *parsedNumberFormat {
+	if code == "" {
+		code = builtInNumFmt[builtInNumFmtIndex_GENERAL]
+	}
+	parsedNumFmtCacheMU.RLock()
+	parsedFmt, ok := parsedNumFmtCache[code]
+	parsedNumFmtCacheMU.RUnlock()
+	if ok {
+		return parsedFmt
+	}
+	parsedFmt = parseFullNumberFormatString(code)
+	parsedNumFmtCacheMU.Lock()
+	if len(parsedNumFmtCache) >= maxParsedNumFmtCache {
+		parsedNumFmtCache = make(map[string]*parsedNumberFormat, maxParsedNumFmtCache)
+	}
+	parsedNumFmtCache[code] = parsedFmt
+	parsedNumFmtCacheMU.Unlock()
+	return parsedFmt
+}
+
+// FormatValue returns value formatted with the number format code, such
+// as "#,##0.00" or "yyyy-mm-dd", without the need for a Cell to hold
+// it.  date1904 reports whether a date format counts days from 1904,
+// rather than 1900, as in a File whose Date1904 field is set.  The text
+// and error are the same as FormattedValue returns for a numeric Cell
+// with the same value and format.
+func FormatValue(code string, value float64, date1904 bool) (string, error) {
+	return formatWithCode(code, &Cell{
+		Value:    strconv.FormatFloat(value, 'f', -1, 64),
+		cellType: CellTypeNumeric,
+		date1904: date1904,
+	})
+}
+
+// FormatText returns text formatted with the text section of the number
+// format code, as FormattedValue does for a string Cell with that
+// format.
+func FormatText(code string, text string) (string, error) {
+	return formatWithCode(code, &Cell{
+		Value:    text,
+		cellType: CellTypeString,
+	})
+}
+
+// formatWithCode returns the value of a Cell that isn't part of a
+// Sheet, formatted with the number format code.
+func formatWithCode(code string, cell *Cell) (string, error) {
+	cell.NumFmt = code
+	cell.parsedNumFmt = cachedNumberFormat(code)
+	returnVal, err := cell.parsedNumFmt.FormatValue(cell)
+	returnVal = expandFill(returnVal, 0)
+	if cell.parsedNumFmt.parseEncounteredError != nil {
+		return returnVal, *cell.parsedNumFmt.parseEncounteredError
+	}
+	return returnVal, err
+}
+
+// numericSection returns the section of the format that is used for a
+// number. There can be different formats for positive, negative, and zero numbers.
+// Excel only uses the zero format if the value is literally zero, even if the number is so small that it shows
+// up as "0" when the positive format is used.
+func (fullFormat *parsedNumberFormat) numericSection(floatVal float64) *formatOptions {
+	if fullFormat.conditionalSections != nil {
+		return fullFormat.conditionalSection(floatVal)
+	}
+	if floatVal > 0 {
+		return fullFormat.positiveFormat
+	} else if floatVal < 0 {
+		return fullFormat.negativeFormat
+	}
+	return fullFormat.zeroFormat
+}
+
+// conditionalSection returns the section of a format with conditions
+// that is used for a number.  The first section whose condition the
+// number meets is used, or failing that the first section without a
+// condition.  If there is neither, as when 5 is shown with
+// "[>100]0;[<-100]0", the number is shown as General.
+func (fullFormat *parsedNumberFormat) conditionalSection(floatVal float64) *formatOptions {
+	for _, section := range fullFormat.conditionalSections {
+		if section.condition != nil && section.condition.matches(floatVal) {
+			return section
+		}
+	}
+	for _, section := range fullFormat.conditionalSections {
+		if section.condition == nil {
+			return section
+		}
+	}
+	return fallbackErrorFormat
+}
+
+// expectsPositive reports whether a negative number is made positive
+// before it is shown with the section numberFormat.
+func (fullFormat *parsedNumberFormat) expectsPositive(numberFormat *formatOptions) bool {
+	if fullFormat.conditionalSections != nil {
+		return numberFormat.condition != nil && numberFormat.condition.onlyNegative()
+	}
+	return fullFormat.negativeFormatExpectsPositive
+}
+
+// color returns the ARGB color of the section of the format that is
+// used for the value of cell, or empty if the section has no color.
+func (fullFormat *parsedNumberFormat) color(cell *Cell) string {
+	switch cell.cellType {
+	case CellTypeString, CellTypeInline, CellTypeStringFormula:
+		return fullFormat.textFormat.color
+	case CellTypeNumeric:
+		rawValue := strings.TrimSpace(cell.Value)
+		if rawValue == "" {
+			return ""
+		}
+		if fullFormat.isTimeFormat {
+			return fullFormat.timeColor
+		}
+		floatVal, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return ""
+		}
+		return fullFormat.numericSection(floatVal).color
+	}
+	return ""
+}
+
+// numFmtNamedColors are the ARGB values of the colors that can be
+// named in a number format, such as [Red].
+var numFmtNamedColors = map[string]string{
+	"black":   "FF000000",
+	"white":   "FFFFFFFF",
+	"red":     "FFFF0000",
+	"green":   "FF00FF00",
+	"blue":    "FF0000FF",
+	"yellow":  "FFFFFF00",
+	"magenta": "FFFF00FF",
+	"cyan":    "FF00FFFF",
+}
+
+// numFmtSectionColor returns the ARGB color that a section of a number
+// format is annotated with, such as [Red] or [Color10], or empty if it
+// has none.  [Color1] to [Color56] are the colors of the default
+// palette, after its first eight fixed colors.
+func numFmtSectionColor(section string) string {
+	for _, bracket := range numFmtBrackets(section) {
+		name := strings.ToLower(bracket)
+		if color, ok := numFmtNamedColors[name]; ok {
+			return color
+		}
+		if strings.HasPrefix(name, "color") {
+			if n, err := strconv.Atoi(name[len("color"):]); err == nil && n >= 1 && n <= 56 {
+				return xlsxIndexedColors[n+7]
+			}
+		}
+	}
+	return ""
+}
+
+// numFmtSectionCondition returns the condition that a section of a
+// number format is annotated with, such as [>=1000], or nil if it has
+// none.
+func numFmtSectionCondition(section string) *numFmtCondition {
+	for _, bracket := range numFmtBrackets(section) {
+		if condition, ok := parseNumFmtCondition(bracket); ok {
+			return condition
+		}
+	}
+	return nil
+}
+
+// numFmtBrackets returns the text inside each of the brackets in a
+// section of a number format, other than those in quoted or escaped
+// literals.
+func numFmtBrackets(section string) []string {
+	var brackets []string
+	for i := 0; i < len(section); i++ {
+		switch section[i] {
+		case '\\':
+			i++
+		case '"':
+			end := strings.IndexByte(section[i+1:], '"')
+			if end < 0 {
+				return brackets
+			}
+			i += end + 1
+		case '[':
+			end := strings.IndexByte(section[i:], ']')
+			if end < 0 {
+				return brackets
+			}
+			brackets = append(brackets, section[i+1:i+end])
+			i += end
+		}
+	}
+	return brackets
+}
+
 func (fullFormat *parsedNumberFormat) formatNumericCell(cell *Cell) (string, error) {
 	rawValue := strings.TrimSpace(cell.Value)
 	// If there wasn't a value in the cell, it shouldn't have been marked as Numeric.
@@ -127,29 +421,29 @@ func (fullFormat *parsedNumberFormat) formatNumericCell(cell *Cell) (string, err
 	}
 
 	if fullFormat.isTimeFormat {
-		return fullFormat.parseTime(rawValue, cell.date1904)
+		return fullFormat.parseTime(rawValue, cell.date1904, cell.localizedDateNames())
 	}
-	var numberFormat *formatOptions
 	floatVal, floatErr := strconv.ParseFloat(rawValue, 64)
 	if floatErr != nil {
 		return rawValue, floatErr
 	}
-	// Choose the correct format. There can be different formats for positive, negative, and zero numbers.
-	// Excel only uses the zero format if the value is literally zero, even if the number is so small that it shows
-	// up as "0" when the positive format is used.
-	if floatVal > 0 {
-		numberFormat = fullFormat.positiveFormat
-	} else if floatVal < 0 {
-		// If format string specified a different format for negative numbers, then the number should be made positive
-		// before getting formatted. The format string itself will contain formatting that denotes a negative number and
-		// this formatting will end up in the prefix or suffix. Commonly if there is a negative format specified, the
-		// number will get surrounded by parenthesis instead of showing it with a minus sign.
-		if fullFormat.negativeFormatExpectsPositive {
+	numberFormat := fullFormat.numericSection(floatVal)
+	// If format string specified a different format for negative numbers, then the number should be made positive
+	// before getting formatted. The format string itself will contain formatting that denotes a negative number and
+	// this formatting will end up in the prefix or suffix. Commonly if there is a negative format specified, the
+	// number will get surrounded by parenthesis instead of showing it with a minus sign.
+	// Otherwise, as when the format only has one section, the minus sign goes in front of everything that the section
+	// shows, as in "-$5.00" for "$0.00", so the number is still made positive, and sign put in front of it all.
+	// Sections with conditions keep the sign with the number.
+	sign := ""
+	if floatVal < 0 {
+		switch {
+		case fullFormat.expectsPositive(numberFormat):
+			floatVal = math.Abs(floatVal)
+		case fullFormat.conditionalSections == nil:
+			sign = "-"
 			floatVal = math.Abs(floatVal)
 		}
-		numberFormat = fullFormat.negativeFormat
-	} else {
-		numberFormat = fullFormat.zeroFormat
 	}
 
 	// When showPercent is true, multiply the number by 100.
@@ -158,6 +452,26 @@ func (fullFormat *parsedNumberFormat) formatNumericCell(cell *Cell) (string, err
 	if numberFormat.showPercent {
 		floatVal = 100 * floatVal
 	}
+	if numberFormat.scale > 0 {
+		floatVal = floatVal / math.Pow(1000, float64(numberFormat.scale))
+	}
+
+	// A value with more digits than a float64 holds, such as one set
+	// with SetNumericString, is shown from its text, as it is for the
+	// General format, or through a big.Float when the format needs
+	// arithmetic that Go's fmt can't do exactly.
+	if decimal, exact := exactDecimal(rawValue); exact {
+		if floatVal >= 0 {
+			decimal = strings.TrimPrefix(decimal, "-")
+		}
+		if numberFormat.reducedFormatString == builtInNumFmt[builtInNumFmtIndex_GENERAL] {
+			return sign + decimal, nil
+		}
+		if places, ok := fixedDecimalPlaces(numberFormat.reducedFormatString); ok {
+			formattedNum := formatBigDecimal(decimal, places, numberFormat.showPercent, numberFormat.scale)
+			return sign + numberFormat.prefix + formattedNum + numberFormat.suffix, nil
+		}
+	}
 
 	// Only the most common format strings are supported here.
 	// Eventually this switch needs to be replaced with a more general solution.
@@ -167,37 +481,171 @@ func (fullFormat *parsedNumberFormat) formatNumericCell(cell *Cell) (string, err
 	// everything else has been stripped out before and will be placed in the prefix or suffix.
 	// The formatting characters can have non-formatting characters mixed in with them and those should be maintained.
 	// However, at this time we fail to parse those formatting codes and they get replaced with "General"
+	if numberFormat.fraction != nil {
+		return sign + numberFormat.prefix + numberFormat.fraction.format(floatVal) + numberFormat.suffix, nil
+	}
+	if numberFormat.scientific != nil {
+		return sign + numberFormat.prefix + numberFormat.scientific.format(floatVal) + numberFormat.suffix, nil
+	}
+	if numberFormat.interleaved != nil {
+		return sign + numberFormat.prefix + numberFormat.interleaved.format(floatVal), nil
+	}
+
+	if placeholders := numberFormat.reducedFormatString; placeholders != "" && strings.Trim(placeholders, "?") == "" {
+		// ? is a digit placeholder that shows a space in place of a leading zero, so that the digits of numbers
+		// line up.  The zero sections of the accounting formats use it to line up their dash with the digits
+		// of other numbers, as in _(* "-"??_).
+		digits := fmt.Sprintf("%.0f", numberFormat.round(floatVal, 0))
+		if digits == "0" {
+			digits = ""
+		}
+		if len(digits) < len(placeholders) {
+			digits = strings.Repeat(" ", len(placeholders)-len(digits)) + digits
+		}
+		return sign + numberFormat.prefix + digits + numberFormat.suffix, nil
+	}
+
 	var formattedNum string
 	switch numberFormat.reducedFormatString {
 	case builtInNumFmt[builtInNumFmtIndex_GENERAL]: // General is literally "general"
 		// prefix, showPercent, and suffix cannot apply to the general format
 		// The logic for showing numbers when the format is "general" is much more complicated than the rest of these.
-		generalFormatted, err := generalNumericScientific(cell.Value, true)
-		if err != nil {
-			return rawValue, nil
-		}
-		return generalFormatted, nil
+		return sign + generalNumber(floatVal), nil
 	case builtInNumFmt[builtInNumFmtIndex_STRING]: // String is "@"
-		formattedNum = cell.Value
+		formattedNum = rawValue
+		if floatVal >= 0 {
+			formattedNum = strings.TrimPrefix(rawValue, "-")
+		}
 	case builtInNumFmt[builtInNumFmtIndex_INT], "#,##0": // Int is "0"
 		// Previously this case would cast to int and print with %d, but that will not round the value correctly.
-		formattedNum = fmt.Sprintf("%.0f", floatVal)
+		formattedNum = fmt.Sprintf("%.0f", numberFormat.round(floatVal, 0))
 	case "0.0", "#,##0.0":
-		formattedNum = fmt.Sprintf("%.1f", floatVal)
+		formattedNum = fmt.Sprintf("%.1f", numberFormat.round(floatVal, 1))
 	case builtInNumFmt[builtInNumFmtIndex_FLOAT], "#,##0.00": // Float is "0.00"
-		formattedNum = fmt.Sprintf("%.2f", floatVal)
+		formattedNum = fmt.Sprintf("%.2f", numberFormat.round(floatVal, 2))
 	case "0.000", "#,##0.000":
-		formattedNum = fmt.Sprintf("%.3f", floatVal)
+		formattedNum = fmt.Sprintf("%.3f", numberFormat.round(floatVal, 3))
 	case "0.0000", "#,##0.0000":
-		formattedNum = fmt.Sprintf("%.4f", floatVal)
-	case "0.00e+00", "##0.0e+0":
-		formattedNum = fmt.Sprintf("%e", floatVal)
+		formattedNum = fmt.Sprintf("%.4f", numberFormat.round(floatVal, 4))
 	case "":
 		// Do nothing.
 	default:
 		return rawValue, nil
 	}
-	return numberFormat.prefix + formattedNum + numberFormat.suffix, nil
+	return sign + numberFormat.prefix + formattedNum + numberFormat.suffix, nil
+}
+
+// fixedDecimalPlaces returns the number of decimal places that the
+// reduced format string of a section shows, if it is one of those
+// that formatNumericCell formats with a fixed number of them.
+func fixedDecimalPlaces(reducedFormatString string) (int, bool) {
+	switch reducedFormatString {
+	case builtInNumFmt[builtInNumFmtIndex_INT], "#,##0":
+		return 0, true
+	case "0.0", "#,##0.0":
+		return 1, true
+	case builtInNumFmt[builtInNumFmtIndex_FLOAT], "#,##0.00":
+		return 2, true
+	case "0.000", "#,##0.000":
+		return 3, true
+	case "0.0000", "#,##0.0000":
+		return 4, true
+	}
+	return 0, false
+}
+
+// exactDecimal returns rawValue without leading zeros in its whole
+// part and trailing zeros in its fraction, and whether it is a plain
+// decimal number whose significant digits a float64 can't hold, as
+// the digits of the float64 nearest to it differ from them.
+func exactDecimal(rawValue string) (string, bool) {
+	if !isPlainDecimal(rawValue) {
+		return rawValue, false
+	}
+	sign, digits := "", rawValue
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	intPart, fracPart := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		intPart, fracPart = digits[:i], digits[i+1:]
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	decimal := sign + intPart
+	if fracPart = strings.TrimRight(fracPart, "0"); fracPart != "" {
+		decimal += "." + fracPart
+	}
+	f, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		return decimal, false
+	}
+	significant := strings.Trim(intPart+fracPart, "0")
+	if significant == "" {
+		return decimal, false
+	}
+	mantissa := strconv.FormatFloat(math.Abs(f), 'e', len(significant)-1, 64)
+	mantissa = strings.Replace(mantissa[:strings.IndexByte(mantissa, 'e')], ".", "", 1)
+	return decimal, mantissa != significant
+}
+
+// formatBigDecimal returns the decimal number text, multiplied by 100
+// if percent is set and divided by 1000 for each scale, rounded half
+// away from zero to the given number of decimal places.
+func formatBigDecimal(text string, places int, percent bool, scale int) string {
+	f, _, err := big.ParseFloat(text, 10, 512, big.ToNearestEven)
+	if err != nil {
+		return text
+	}
+	if percent {
+		f.Mul(f, big.NewFloat(100))
+	}
+	for i := 0; i < scale; i++ {
+		f.Quo(f, big.NewFloat(1000))
+	}
+	// The extra digits leave the rounding to roundDecimalText, which
+	// rounds halves the way Excel does.
+	return roundDecimalText(f.Text('f', places+20), places)
+}
+
+// roundDecimalText rounds the decimal number text half away from zero
+// to the given number of decimal places.
+func roundDecimalText(text string, places int) string {
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+	intPart, fracPart := text, ""
+	if i := strings.IndexByte(text, '.'); i >= 0 {
+		intPart, fracPart = text[:i], text[i+1:]
+	}
+	if len(fracPart) <= places {
+		fracPart += strings.Repeat("0", places+1-len(fracPart))
+	}
+	roundUp := fracPart[places] >= '5'
+	digits := []byte(intPart + fracPart[:places])
+	for i := len(digits) - 1; roundUp && i >= 0; i-- {
+		if digits[i] == '9' {
+			digits[i] = '0'
+			continue
+		}
+		digits[i]++
+		roundUp = false
+	}
+	if roundUp {
+		digits = append([]byte{'1'}, digits...)
+	}
+	result := string(digits)
+	if places > 0 {
+		result = result[:len(result)-places] + "." + result[len(result)-places:]
+	}
+	if strings.Trim(result, "0.") == "" {
+		// A negative number that rounds to zero is shown without its sign.
+		sign = ""
+	}
+	return sign + result
 }
 
 func generalNumericScientific(value string, allowScientific bool) (string, error) {
@@ -209,13 +657,7 @@ func generalNumericScientific(value string, allowScientific bool) (string, error
 		return value, err
 	}
 	if allowScientific {
-		absF := math.Abs(f)
-		// When using General format, numbers that are less than 1e-9 (0.000000001) and greater than or equal to
-		// 1e11 (100,000,000,000) should be shown in scientific notation.
-		// Numbers less than the number after zero, are assumed to be zero.
-		if (absF >= math.SmallestNonzeroFloat64 && absF < minNonScientificNumber) || absF >= maxNonScientificNumber {
-			return strconv.FormatFloat(f, 'E', -1, 64), nil
-		}
+		return generalNumber(f), nil
 	}
 	// This format (fmt="f", prec=-1) will prevent padding with zeros and will never switch to scientific notation.
 	// However, it will show more than 11 characters for very precise numbers, and this cannot be changed.
@@ -225,6 +667,61 @@ func generalNumericScientific(value string, allowScientific bool) (string, error
 	return strconv.FormatFloat(f, 'f', -1, 64), nil
 }
 
+// generalNumberWidth is the number of characters, not counting a minus
+// sign, that Excel shows a number in with the General format, in a
+// column of the default width.
+const generalNumberWidth = 11
+
+// generalNumber returns f as Excel shows it with the General format.
+// Numbers from 1e-9 up to 1e11 are shown as decimals, rounded to fit in
+// generalNumberWidth characters and without trailing zeros, so that
+// 0.1+0.2 is shown as "0.3" and 2/3 as "0.666666667".  Those below 1e-4
+// aren't rounded though: if they don't fit, they are shown in
+// scientific notation, as are all other numbers, with as many digits
+// as fit, as in "1.23457E+11".
+func generalNumber(f float64) string {
+	if f == 0 {
+		return "0"
+	}
+	fits := func(s string) bool {
+		return len(strings.TrimPrefix(s, "-")) <= generalNumberWidth
+	}
+	absF := math.Abs(f)
+	if absF >= minNonScientificNumber && absF < maxNonScientificNumber {
+		decimals := 12
+		if absF >= 1e-4 {
+			// One character goes on the decimal point.
+			intDigits := len(strconv.FormatFloat(math.Trunc(absF), 'f', 0, 64))
+			decimals = generalNumberWidth - 1 - intDigits
+			if decimals < 0 {
+				decimals = 0
+			}
+		}
+		// Like Excel, and unlike strconv, round halves away from zero.
+		rounded := math.Round(f*math.Pow10(decimals)) / math.Pow10(decimals)
+		if s := trimDecimalZeros(strconv.FormatFloat(rounded, 'f', decimals, 64)); fits(s) {
+			return s
+		}
+	}
+	for decimals := 5; ; decimals-- {
+		s := strconv.FormatFloat(f, 'E', decimals, 64)
+		e := strings.IndexByte(s, 'E')
+		s = trimDecimalZeros(s[:e]) + s[e:]
+		if decimals == 0 || fits(s) {
+			return s
+		}
+	}
+}
+
+// trimDecimalZeros removes the trailing zeros after the decimal point
+// of a number, and the decimal point itself if no digits follow it.
+func trimDecimalZeros(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
 // Format strings are a little strange to compare because empty string
 // needs to be taken as general, and general needs to be compared case
 // insensitively.
@@ -249,6 +746,7 @@ func parseFullNumberFormatString(numFmt string) *parsedNumberFormat {
 		// Time formats cannot have multiple groups separated by semicolons, there is only one format.
 		// Strings are unaffected by the time format.
 		parsedNumFmt.isTimeFormat = true
+		parsedNumFmt.timeColor = numFmtSectionColor(numFmt)
 		parsedNumFmt.textFormat, _ = parseNumberFormatSection("general")
 		return parsedNumFmt
 	}
@@ -257,11 +755,20 @@ func parseFullNumberFormatString(numFmt string) *parsedNumberFormat {
 	formats, err := splitFormatOnSemicolon(numFmt)
 	if err == nil {
 		for _, formatSection := range formats {
+			if formatSection == "" && len(formats) > 1 {
+				// An empty section hides the values that it is for, as the zero
+				// section of "0;-0;" does, rather than show them as General.
+				fmtOptions = append(fmtOptions, &formatOptions{})
+				continue
+			}
 			parsedFormat, err := parseNumberFormatSection(formatSection)
 			if err != nil {
 				// If an invalid number section is found, fall back to general
 				parsedFormat = fallbackErrorFormat
 				parsedNumFmt.parseEncounteredError = &err
+			} else {
+				parsedFormat.color = numFmtSectionColor(formatSection)
+				parsedFormat.condition = numFmtSectionCondition(formatSection)
 			}
 			fmtOptions = append(fmtOptions, parsedFormat)
 		}
@@ -313,6 +820,18 @@ func parseFullNumberFormatString(numFmt string) *parsedNumberFormat {
 		parsedNumFmt.zeroFormat = fmtOptions[2]
 		parsedNumFmt.textFormat = fmtOptions[3]
 	}
+	// Only the first three sections are for numbers, the fourth is
+	// always for text.
+	numeric := fmtOptions
+	if len(numeric) > 3 {
+		numeric = numeric[:3]
+	}
+	for _, section := range numeric {
+		if section.condition != nil {
+			parsedNumFmt.conditionalSections = numeric
+			break
+		}
+	}
 	return parsedNumFmt
 }
 
@@ -340,6 +859,150 @@ func splitFormatOnSemicolon(format string) ([]string, error) {
 	return append(formats, format[prevIndex:]), nil
 }
 
+// numFmtLetterTokens are the words that a number format can hold
+// without quoting them, other than the single letters of
+// numFmtLetters.  They are matched regardless of case.
+var numFmtLetterTokens = []string{"general", "am/pm", "a/p"}
+
+// numFmtLetters are the letters that a number format can hold without
+// quoting them, regardless of case: the date and time codes, "e" for
+// the exponent of scientific notation or the era year, "g" for the
+// era, and "b" for the Buddhist calendar.
+const numFmtLetters = "ymdhsegb"
+
+// validateNumberFormat returns an error describing the first problem
+// found in a number format, or nil if Excel would accept it.  It is
+// stricter than parseFullNumberFormatString, which falls back to the
+// General format rather than fail, but it accepts the valid formats
+// that FormatValue can't yet apply.
+func validateNumberFormat(format string) error {
+	wrap := func(reason string) error {
+		return fmt.Errorf("invalid number format %q: %s", format, reason)
+	}
+
+	sections, err := splitFormatOnSemicolon(format)
+	if err != nil {
+		return wrap("unmatched double quote")
+	}
+	if len(sections) > 4 {
+		return wrap(fmt.Sprintf("%d sections, where at most 4 are allowed", len(sections)))
+	}
+	for _, section := range sections {
+		if reason := numFmtSectionProblem(section); reason != "" {
+			return wrap(reason)
+		}
+	}
+	return nil
+}
+
+// numFmtSectionProblem returns a description of the first problem
+// found in a section of a number format, or "" if there is none.
+func numFmtSectionProblem(section string) string {
+	for i := 0; i < len(section); i++ {
+		switch c := section[i]; {
+		case c == '\\' || c == '_' || c == '*':
+			if i+1 == len(section) {
+				return fmt.Sprintf("%q at the end of a section, without a character after it", c)
+			}
+			_, size := utf8.DecodeRuneInString(section[i+1:])
+			i += size
+		case c == '"':
+			// splitFormatOnSemicolon has checked that the quote is closed.
+			i += strings.IndexByte(section[i+1:], '"') + 1
+		case c == '[':
+			end := strings.IndexByte(section[i:], ']')
+			if end < 0 {
+				return "unmatched '['"
+			}
+			if reason := numFmtBracketProblem(section[i+1 : i+end]); reason != "" {
+				return reason
+			}
+			i += end
+		case c == ']':
+			return "unmatched ']'"
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			token := numFmtLetterToken(section[i:])
+			if token == "" {
+				return fmt.Sprintf("the letter %q must be quoted or escaped", c)
+			}
+			i += len(token) - 1
+		}
+	}
+	return ""
+}
+
+// numFmtLetterToken returns the letter, or the word of
+// numFmtLetterTokens, at the start of text that a number format can
+// hold without quoting it, or "" if there is none.
+func numFmtLetterToken(text string) string {
+	for _, token := range numFmtLetterTokens {
+		if len(text) >= len(token) && strings.EqualFold(text[:len(token)], token) {
+			return text[:len(token)]
+		}
+	}
+	if strings.IndexByte(numFmtLetters, text[0]|0x20) >= 0 {
+		return text[:1]
+	}
+	return ""
+}
+
+// numFmtBracketProblem returns a description of what is wrong with the
+// text of a bracket in a number format, or "" if nothing is.  Brackets
+// hold a color, a condition, an elapsed time code such as [h], or a
+// locale or currency such as [$€-407]; other text is left for Excel to
+// judge.
+func numFmtBracketProblem(text string) string {
+	if text == "" {
+		return "empty brackets"
+	}
+	if strings.IndexAny(text[:1], "<>=") == 0 {
+		if _, ok := parseNumFmtCondition(text); !ok {
+			return fmt.Sprintf("invalid condition [%s]", text)
+		}
+		return ""
+	}
+	if len(text) > 5 && strings.EqualFold(text[:5], "color") {
+		n, err := strconv.Atoi(text[5:])
+		if err != nil || n < 1 || n > 56 {
+			return fmt.Sprintf("invalid color [%s], the number must be from 1 to 56", text)
+		}
+	}
+	return ""
+}
+
+// round returns value rounded to the given number of decimal places,
+// when the section scales the value.  Scaling by thousands often
+// leaves a value exactly halfway between two displayed values, such
+// as 2500 in "0," and Excel rounds those away from zero, where the
+// fmt package would round to even.  The value is first taken to 15
+// significant digits, as Excel keeps, so that the division doesn't
+// leave it just short of the half.
+func (numberFormat *formatOptions) round(value float64, places int) float64 {
+	if numberFormat.scale == 0 {
+		return value
+	}
+	digits := strconv.FormatFloat(value, 'e', 14, 64)
+	i := strings.IndexByte(digits, 'e')
+	exponent, err := strconv.Atoi(digits[i+1:])
+	if err != nil {
+		return value
+	}
+	shifted, err := strconv.ParseFloat(digits[:i]+"e"+strconv.Itoa(exponent+places), 64)
+	if err != nil {
+		return value
+	}
+	return math.Round(shifted) / math.Pow10(places)
+}
+
+// splitScalingCommas returns the number format with any commas that
+// follow its last digit placeholder removed, and the number of them.
+// Commas between digit placeholders, as in "#,##0", ask for thousands
+// separators instead and are left alone.
+func splitScalingCommas(format string) (string, int) {
+	trimmed := strings.TrimRight(format, ",")
+	return trimmed, len(format) - len(trimmed)
+}
+
 var fallbackErrorFormat = &formatOptions{
 	fullFormatString:    "general",
 	reducedFormatString: "general",
@@ -365,22 +1028,50 @@ var fallbackErrorFormat = &formatOptions{
 // when formatting the string. The string there will be reduced to only the things in the formattingCharacters array.
 // Everything not in that array has been parsed out and put into formatOptions.
 func parseNumberFormatSection(fullFormat string) (*formatOptions, error) {
-	reducedFormat := strings.TrimSpace(fullFormat)
-
 	// general is the only format that does not use the normal format symbols notations
-	if compareFormatString(reducedFormat, "general") {
+	if compareFormatString(strings.TrimSpace(fullFormat), "general") {
 		return &formatOptions{
 			fullFormatString:    "general",
 			reducedFormatString: "general",
 		}, nil
 	}
 
-	prefix, reducedFormat, showPercent1, err := parseLiterals(reducedFormat)
+	// Spaces are kept, as they are shown: the space at the end of the first section of "#,##0 ;(#,##0)" lines up
+	// positive numbers with the negative ones in parentheses.
+	prefix, reducedFormat, showPercent1, err := parseLiterals(fullFormat)
 	if err != nil {
 		return nil, err
 	}
 
+	// Scientific and fraction formats are parsed in full here, rather
+	// than being left in the reduced format string.
+	scientific, rest, ok := parseScientificFormat(reducedFormat)
+	var fraction *fractionFormat
+	if !ok {
+		fraction, rest, ok = parseFractionFormat(reducedFormat)
+	}
+	if ok {
+		suffix, remaining, showPercent2, err := parseLiterals(rest)
+		if err != nil {
+			return nil, err
+		}
+		if len(remaining) > 0 {
+			return nil, errors.New("invalid or unsupported format string")
+		}
+		return &formatOptions{
+			fullFormatString:    fullFormat,
+			reducedFormatString: reducedFormat[:len(reducedFormat)-len(rest)],
+			prefix:              prefix,
+			suffix:              suffix,
+			showPercent:         showPercent1 || showPercent2,
+			fraction:            fraction,
+			scientific:          scientific,
+		}, nil
+	}
+
+	numberAndSuffix := reducedFormat
 	reducedFormat, suffixFormat := splitFormatAndSuffixFormat(reducedFormat)
+	reducedFormat, scale := splitScalingCommas(reducedFormat)
 
 	suffix, remaining, showPercent2, err := parseLiterals(suffixFormat)
 	if err != nil {
@@ -391,7 +1082,18 @@ func parseNumberFormatSection(fullFormat string) (*formatOptions, error) {
 		// actually be intertwined. Though 99% of the time number formats will not do this.
 		// Excel uses this format string for Social Security Numbers: 000\-00\-0000
 		// and this for US phone numbers: [<=9999999]###\-####;\(###\)\ ###\-####
-		return nil, errors.New("invalid or unsupported format string")
+		// Whole numbers are supported in these, but not decimals, percentages or thousands separators.
+		interleaved, ok := parseInterleavedFormat(numberAndSuffix)
+		if !ok {
+			return nil, errors.New("invalid or unsupported format string")
+		}
+		return &formatOptions{
+			fullFormatString:    fullFormat,
+			reducedFormatString: numberAndSuffix,
+			prefix:              prefix,
+			showPercent:         showPercent1,
+			interleaved:         interleaved,
+		}, nil
 	}
 
 	return &formatOptions{
@@ -401,9 +1103,403 @@ func parseNumberFormatSection(fullFormat string) (*formatOptions, error) {
 		prefix:              prefix,
 		suffix:              suffix,
 		showPercent:         showPercent1 || showPercent2,
+		scale:               scale,
 	}, nil
 }
 
+// interleavedFormat is the parsed form of a format for whole numbers
+// that has literal text between its digit placeholders, such as the
+// "000\-00\-0000" of social security numbers.
+type interleavedFormat struct {
+	parts []interleavedPart
+}
+
+// interleavedPart is a digit placeholder (0, # or ?) of an
+// interleavedFormat, or, when placeholder is zero, a piece of its
+// literal text.
+type interleavedPart struct {
+	placeholder byte
+	text        string
+}
+
+// parseInterleavedFormat parses format as an interleavedFormat.  ok is
+// false if it has anything other than digit placeholders and literal
+// text, such as a decimal point.
+func parseInterleavedFormat(format string) (interleaved *interleavedFormat, ok bool) {
+	interleaved = &interleavedFormat{}
+	for format != "" {
+		n := 0
+		for n < len(format) && strings.IndexByte("0#?", format[n]) >= 0 {
+			interleaved.parts = append(interleaved.parts, interleavedPart{placeholder: format[n]})
+			n++
+		}
+		format = format[n:]
+		if format == "" {
+			break
+		}
+		text, rest, showPercent, err := parseLiterals(format)
+		if err != nil || showPercent || len(rest) == len(format) {
+			return nil, false
+		}
+		if rest != "" && strings.IndexByte("0#?", rest[0]) < 0 {
+			return nil, false
+		}
+		interleaved.parts = append(interleaved.parts, interleavedPart{text: text})
+		format = rest
+	}
+	return interleaved, true
+}
+
+// format returns value rounded to a whole number, with its digits put
+// in the placeholders from the right, and the literal text between
+// them.  As with other formats, the leftmost placeholder takes any
+// digits that there are no placeholders for.
+func (interleaved *interleavedFormat) format(value float64) string {
+	digits := strconv.FormatFloat(math.Round(value), 'f', 0, 64)
+	if digits == "0" {
+		digits = ""
+	}
+	leftmost := -1
+	for i, part := range interleaved.parts {
+		if part.placeholder != 0 {
+			leftmost = i
+			break
+		}
+	}
+	texts := make([]string, len(interleaved.parts))
+	for i := len(interleaved.parts) - 1; i >= 0; i-- {
+		part := interleaved.parts[i]
+		switch {
+		case part.placeholder == 0:
+			texts[i] = part.text
+		case i == leftmost && len(digits) > 1:
+			texts[i] = digits
+			digits = ""
+		case digits != "":
+			texts[i] = digits[len(digits)-1:]
+			digits = digits[:len(digits)-1]
+		case part.placeholder == '0':
+			texts[i] = "0"
+		case part.placeholder == '?':
+			texts[i] = " "
+		}
+	}
+	return strings.Join(texts, "")
+}
+
+// scientificFormat is the parsed form of a scientific format such as
+// "0.00E+00", or an engineering format such as "##0.0E+0".  Each part
+// holds the digit placeholders (0, # or ?) that the format gives it.
+type scientificFormat struct {
+	integer string
+	decimal string
+	// hasPoint is true if the format has a decimal point, even if no
+	// decimal placeholders follow it.
+	hasPoint bool
+	// alwaysSign is true for E+, which shows the sign of positive
+	// exponents too, and false for E-, which only shows a minus sign.
+	alwaysSign bool
+	exponent   string
+}
+
+// parseScientificFormat parses the scientific format at the start of
+// format, returning it along with the rest of format.  ok is false if
+// format doesn't start with a scientific format.
+func parseScientificFormat(format string) (scientific *scientificFormat, rest string, ok bool) {
+	placeholders := func(s string) string {
+		i := 0
+		for i < len(s) && strings.IndexByte("0#?", s[i]) >= 0 {
+			i++
+		}
+		return s[:i]
+	}
+
+	scientific = &scientificFormat{}
+	rest = format
+	scientific.integer = placeholders(rest)
+	rest = rest[len(scientific.integer):]
+	if strings.HasPrefix(rest, ".") {
+		scientific.hasPoint = true
+		scientific.decimal = placeholders(rest[1:])
+		rest = rest[1+len(scientific.decimal):]
+	}
+	if scientific.integer == "" && scientific.decimal == "" {
+		return nil, format, false
+	}
+	if len(rest) < 2 || (rest[0] != 'E' && rest[0] != 'e') || (rest[1] != '+' && rest[1] != '-') {
+		return nil, format, false
+	}
+	scientific.alwaysSign = rest[1] == '+'
+	rest = rest[2:]
+	scientific.exponent = placeholders(rest)
+	if scientific.exponent == "" {
+		return nil, format, false
+	}
+	return scientific, rest[len(scientific.exponent):], true
+}
+
+// format returns value in scientific notation.  As in Excel, if the
+// whole number part of the format has more than one placeholder and
+// any of them is # or ?, the exponent is kept to a multiple of the
+// number of placeholders, which gives engineering notation with
+// "##0.0E+0".  Otherwise the mantissa has as many whole number digits
+// as the format has placeholders.
+func (scientific *scientificFormat) format(value float64) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+	intDigits := len(scientific.integer)
+	if intDigits == 0 {
+		intDigits = 1
+	}
+	engineering := intDigits > 1 && strings.ContainsAny(scientific.integer, "#?")
+
+	exponent := 0
+	if value != 0 {
+		exponent = int(math.Floor(math.Log10(value)))
+		if engineering {
+			exponent = int(math.Floor(float64(exponent)/float64(intDigits))) * intDigits
+		} else {
+			exponent -= intDigits - 1
+		}
+	}
+	mantissa := strconv.FormatFloat(value/math.Pow10(exponent), 'f', len(scientific.decimal), 64)
+	// Rounding can carry the mantissa over into another digit, in which
+	// case the exponent has to go up instead.
+	if value != 0 && strings.IndexByte(mantissa+".", '.') > intDigits {
+		if engineering {
+			exponent += intDigits
+		} else {
+			exponent++
+		}
+		mantissa = strconv.FormatFloat(value/math.Pow10(exponent), 'f', len(scientific.decimal), 64)
+	}
+
+	integer, decimal := mantissa, ""
+	if point := strings.IndexByte(mantissa, '.'); point >= 0 {
+		integer, decimal = mantissa[:point], mantissa[point+1:]
+	}
+	if integer == "0" && !strings.Contains(scientific.integer, "0") {
+		integer = ""
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	b.WriteString(padPlaceholders(integer, scientific.integer, true))
+	if scientific.hasPoint {
+		b.WriteByte('.')
+		b.WriteString(trimDecimalPlaceholders(decimal, scientific.decimal))
+	}
+	// Excel writes the exponent with a capital E, however the
+	// format has it.
+	b.WriteByte('E')
+	switch {
+	case exponent < 0:
+		b.WriteByte('-')
+		exponent = -exponent
+	case scientific.alwaysSign:
+		b.WriteByte('+')
+	}
+	b.WriteString(padPlaceholders(strconv.Itoa(exponent), scientific.exponent, true))
+	return b.String()
+}
+
+// trimDecimalPlaceholders removes the trailing zeros of the decimal
+// digits that fall on # placeholders, and replaces those that fall on
+// ? placeholders with spaces.  digits has one digit per placeholder.
+func trimDecimalPlaceholders(digits, placeholders string) string {
+	end := len(digits)
+	var padding string
+	for end > 0 && digits[end-1] == '0' && placeholders[end-1] != '0' {
+		if placeholders[end-1] == '?' {
+			padding += " "
+		}
+		end--
+	}
+	return digits[:end] + padding
+}
+
+// fractionFormat is the parsed form of a fraction format such as
+// "# ?/?", "# ??/??", "?/?" or "# ?/8".  Each part holds the digit
+// placeholders (0, # or ?) that the format gives it.
+type fractionFormat struct {
+	// integer holds the placeholders of the whole number part, or is
+	// empty if the format shows the value as an improper fraction.
+	integer string
+	// separator is what goes between the whole number and the fraction.
+	separator   string
+	numerator   string
+	denominator string
+	// fixedDenominator is the denominator written in the format, as
+	// in "# ?/8", or 0 if the format has placeholders for it instead.
+	fixedDenominator int
+}
+
+// parseFractionFormat parses the fraction format at the start of
+// format, returning it along with the rest of format.  ok is false if
+// format doesn't start with a fraction.
+func parseFractionFormat(format string) (fraction *fractionFormat, rest string, ok bool) {
+	placeholders := func(s string, allowed string) string {
+		i := 0
+		for i < len(s) && strings.IndexByte(allowed, s[i]) >= 0 {
+			i++
+		}
+		return s[:i]
+	}
+
+	fraction = &fractionFormat{}
+	rest = format
+	first := placeholders(rest, "0#?,")
+	if first == "" {
+		return nil, format, false
+	}
+	rest = rest[len(first):]
+	if strings.HasPrefix(rest, "/") {
+		fraction.numerator = first
+	} else {
+		separator := placeholders(rest, " ")
+		if separator == "" {
+			return nil, format, false
+		}
+		rest = rest[len(separator):]
+		fraction.integer = strings.Replace(first, ",", "", -1)
+		fraction.separator = separator
+		fraction.numerator = placeholders(rest, "0#?")
+		rest = rest[len(fraction.numerator):]
+	}
+	if fraction.numerator == "" || strings.Contains(fraction.numerator, ",") || !strings.HasPrefix(rest, "/") {
+		return nil, format, false
+	}
+	rest = rest[1:]
+
+	if fixed := placeholders(rest, "0123456789"); fixed != "" && fixed[0] != '0' {
+		fraction.fixedDenominator, _ = strconv.Atoi(fixed)
+		return fraction, rest[len(fixed):], true
+	}
+	fraction.denominator = placeholders(rest, "0#?")
+	if fraction.denominator == "" {
+		return nil, format, false
+	}
+	return fraction, rest[len(fraction.denominator):], true
+}
+
+// format returns value as a fraction.  The numerator is the closest
+// that can be had with a denominator of no more digits than the format
+// allows, or with the format's fixed denominator.  As in Excel, a whole
+// number with a format that has a whole number part is shown without
+// the fraction, but padded with spaces to the same width.
+func (fraction *fractionFormat) format(value float64) string {
+	sign := ""
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	var whole float64
+	if fraction.integer != "" {
+		whole = math.Floor(value)
+		value -= whole
+	}
+	var num, den int64
+	if fraction.fixedDenominator > 0 {
+		den = int64(fraction.fixedDenominator)
+		num = int64(math.Round(value * float64(den)))
+	} else {
+		maxDen := int64(math.Pow10(len(fraction.denominator))) - 1
+		num, den = closestFraction(value, maxDen)
+	}
+	if fraction.integer != "" && num == den {
+		whole++
+		num = 0
+	}
+
+	if fraction.integer == "" {
+		return sign + fraction.fractionText(num, den)
+	}
+	if num == 0 {
+		// Excel shows a zero whole number part, rather than nothing
+		// at all, if there isn't a fraction either.
+		integer := strconv.FormatFloat(whole, 'f', 0, 64)
+		width := len(fraction.separator) + len(fraction.fractionText(0, den))
+		return sign + padPlaceholders(integer, fraction.integer, true) + strings.Repeat(" ", width)
+	}
+	integer := ""
+	if whole > 0 {
+		integer = strconv.FormatFloat(whole, 'f', 0, 64)
+	}
+	return sign + padPlaceholders(integer, fraction.integer, true) + fraction.separator + fraction.fractionText(num, den)
+}
+
+// fractionText returns the numerator and denominator, each padded as
+// the placeholders of the format ask.
+func (fraction *fractionFormat) fractionText(num, den int64) string {
+	numerator := padPlaceholders(strconv.FormatInt(num, 10), fraction.numerator, true)
+	if fraction.fixedDenominator > 0 {
+		return numerator + "/" + strconv.Itoa(fraction.fixedDenominator)
+	}
+	return numerator + "/" + padPlaceholders(strconv.FormatInt(den, 10), fraction.denominator, false)
+}
+
+// padPlaceholders pads digits to the number of placeholders, with a
+// zero for each unused 0 placeholder, a space for each ? and nothing
+// for each #.  The digits are right aligned, by padding them on the
+// left, unless alignRight is false.
+func padPlaceholders(digits, placeholders string, alignRight bool) string {
+	if len(digits) >= len(placeholders) {
+		return digits
+	}
+	var unused string
+	if alignRight {
+		unused = placeholders[:len(placeholders)-len(digits)]
+	} else {
+		unused = placeholders[len(digits):]
+	}
+	padding := strings.NewReplacer("0", "0", "?", " ", "#", "").Replace(unused)
+	if alignRight {
+		return padding + digits
+	}
+	return digits + padding
+}
+
+// closestFraction returns the fraction, with a denominator of at most
+// maxDen, that is closest to value, which must not be negative.  It
+// works through the continued fraction of value, finishing with the
+// best semiconvergent, so its result is the best approximation there
+// is.  Where two fractions are equally close, the one with the smaller
+// denominator is chosen.
+func closestFraction(value float64, maxDen int64) (num, den int64) {
+	p0, q0, p1, q1 := int64(0), int64(1), int64(1), int64(0)
+	x := value
+	for i := 0; i < 64; i++ {
+		a := math.Floor(x)
+		if a > math.MaxInt32 {
+			break
+		}
+		q2 := q0 + int64(a)*q1
+		if q2 > maxDen {
+			break
+		}
+		p0, q0, p1, q1 = p1, q1, p0+int64(a)*p1, q2
+		remainder := x - a
+		if remainder < 1e-9 {
+			return p1, q1
+		}
+		x = 1 / remainder
+	}
+	if q1 == 0 {
+		return int64(math.Round(value)), 1
+	}
+	k := (maxDen - q0) / q1
+	num1, den1 := p0+k*p1, q0+k*q1
+	err1 := math.Abs(value - float64(num1)/float64(den1))
+	err2 := math.Abs(value - float64(p1)/float64(q1))
+	if err1 < err2 || (err1 == err2 && den1 < q1) {
+		return num1, den1
+	}
+	return p1, q1
+}
+
 // formattingCharacters will be left in the reducedNumberFormat
 // It is important that these be looked for in order so that the slash cases are handled correctly.
 // / (slash) is a fraction format if preceded by 0, #, or ?, otherwise it is not a formatting character
@@ -411,7 +1507,8 @@ func parseNumberFormatSection(fullFormat string) (*formatOptions, error) {
 // \ (back slash) makes the next character a literal (not formatting)
 // " Anything in double quotes is not a formatting character
 // _ (underscore) skips the width of the next character, so the next character cannot be formatting
-var formattingCharacters = []string{"0/", "#/", "?/", "E-", "E+", "e-", "e+", "0", "#", "?", ".", ",", "@", "*"}
+// * (asterisk) repeats the next character to fill the cell, which is done with the literals by parseLiterals
+var formattingCharacters = []string{"0/", "#/", "?/", "E-", "E+", "e-", "e+", "0", "#", "?", ".", ",", "@"}
 
 // The following are also time format characters, but since this is only used for detecting, not decoding, they are
 // redundant here: ee, gg, ggg, rr, ss, mm, hh, yyyy, dd, ddd, dddd, mm, mmm, mmmm, mmmmm, ss.0000, ss.000, ss.00, ss.0
@@ -455,13 +1552,23 @@ func parseLiterals(format string) (string, string, bool, error) {
 				prefix += curReducedFormat[1:2]
 			}
 		case '_':
-			// If there is an underscore, skip the next character, but don't add it to the prefix
+			// An underscore leaves a space as wide as the next character, which is used to line up
+			// numbers with those that have a parenthesis or other symbol after them.
+			// Characters don't differ in width here, so it is added to the prefix as a single space.
 			if len(curReducedFormat) > 1 {
-				i++
+				_, size := utf8.DecodeRuneInString(curReducedFormat[1:])
+				i += size
+				prefix += " "
 			}
 		case '*':
 			// Asterisks are used to repeat the next character to fill the full cell width.
-			// There isn't really a cell size in this context, so this will be ignored.
+			// The character is added to the prefix behind a fillMarker, and expandFill either
+			// repeats it or removes it once the value has been formatted.
+			if len(curReducedFormat) > 1 {
+				_, size := utf8.DecodeRuneInString(curReducedFormat[1:])
+				prefix += string(fillMarker) + curReducedFormat[1:1+size]
+				i += size
+			}
 		case '"':
 			// If there is a quote skip to the next quote, and add the quoted characters to the prefix
 			endQuoteIndex := strings.Index(curReducedFormat[1:], "\"")
@@ -482,16 +1589,11 @@ func parseLiterals(format string) (string, string, bool, error) {
 				return "", "", false, errors.New("invalid formatting code, invalid brackets")
 			}
 			// Currencies in Excel are annotated with this format: [$<Currency String>-<Language Info>]
-			// Currency String is something like $, ¥, €, or £
-			// Language Info is three hexadecimal characters
-			if len(curReducedFormat) > 2 && curReducedFormat[1] == '$' {
-				dashIndex := strings.Index(curReducedFormat, "-")
-				if dashIndex != -1 && dashIndex < bracketIndex {
-					// Get the currency symbol, and skip to the end of the currency format
-					prefix += curReducedFormat[2:dashIndex]
-				} else {
-					return "", "", false, errors.New("invalid formatting code, invalid currency annotation")
-				}
+			// Currency String is something like $, ¥, €, £ or USD, and may be empty
+			// Language Info is usually hexadecimal, as in [$-409], but can be omitted or be a name such as x-euro2
+			// Only the currency symbol is written; the locale doesn't change how a number looks here.
+			if symbol, _, ok := parseLocaleBracket(curReducedFormat[1:bracketIndex]); ok {
+				prefix += symbol
 			}
 			i += bracketIndex
 		case '$', '-', '+', '/', '(', ')', ':', '!', '^', '&', '\'', '~', '{', '}', '<', '>', '=', ' ':
@@ -511,67 +1613,540 @@ func parseLiterals(format string) (string, string, bool, error) {
 	return prefix, "", showPercent, nil
 }
 
-// parseTime returns a string parsed using time.Time
-func (fullFormat *parsedNumberFormat) parseTime(value string, date1904 bool) (string, error) {
+// fillMarker comes before the fill character of a number format, the x
+// of *x, in the values that FormatValue returns.  Cell values can't
+// hold it, as it isn't allowed in XML.
+const fillMarker = '\x00'
+
+// expandFill returns a value formatted by FormatValue with its fill
+// character repeated so that it is width characters long, or removed
+// if width is 0 or the value is already that long.  Only the first
+// fill character counts, as Excel only allows one in each section.
+func expandFill(value string, width int) string {
+	i := strings.IndexByte(value, fillMarker)
+	if i < 0 {
+		return value
+	}
+	_, size := utf8.DecodeRuneInString(value[i+1:])
+	fill := value[i+1 : i+1+size]
+	before := value[:i]
+	after := strings.ReplaceAll(value[i+1+size:], string(fillMarker), "")
+	n := width - utf8.RuneCountInString(before) - utf8.RuneCountInString(after)
+	if n <= 0 {
+		return before + after
+	}
+	return before + strings.Repeat(fill, n) + after
+}
+
+// parseTime returns a string parsed using time.Time.  When localized
+// is set, the names of months and days are in the language of the
+// locale that the format is annotated with, such as [$-407] for German.
+func (fullFormat *parsedNumberFormat) parseTime(value string, date1904, localized bool) (string, error) {
 	f, err := strconv.ParseFloat(value, 64)
 	if err != nil {
 		return value, err
 	}
+	if parts, ok := parseDurationFormat(fullFormat.numFmt); ok {
+		return formatDuration(parts, f), nil
+	}
 	val := TimeFromExcelTime(f, date1904)
-	format := fullFormat.numFmt
+	format, literals, lcid := protectTimeLiterals(fullFormat.numFmt)
+	format = replaceEraTokens(format)
+	names := englishDateNames
+	if localized {
+		names = namesForLCID(lcid)
+	}
+	format = excelTimeLayout(format)
+	// If the hour is optional, strip it out, along with the
+	// possible dangling colon that would remain.
+	if val.Hour() < 1 {
+		format = strings.Replace(format, "]:", "]", 1)
+		format = strings.Replace(format, "[03]", "", 1)
+		format = strings.Replace(format, "[3]", "", 1)
+		format = strings.Replace(format, "[15]", "", 1)
+		format = strings.Replace(format, "["+string(placeholderHour)+"]", "", 1)
+	} else {
+		format = strings.Replace(format, "[3]", "3", 1)
+		format = strings.Replace(format, "[15]", "15", 1)
+		format = strings.Replace(format, "["+string(placeholderHour)+"]", string(placeholderHour), 1)
+	}
+	return restoreTimePlaceholders(val.Format(format), val, names, literals), nil
+}
+
+// ToGoTimeLayout converts an Excel date or time format code, such as
+// "dd/mm/yyyy hh:mm AM/PM", into the equivalent layout for the time
+// package, in this case "02/01/2006 03:04 PM".  As in Excel, m and mm
+// are minutes rather than months when they come after the hours or
+// before the seconds, mmm and mmmm are the English names of months, and
+// quoted or escaped text is kept as it is.  The hour of a 24-hour clock
+// is always 15, which has a leading zero where an h doesn't.
+//
+// Only the first section of a format with several is used.  ok is
+// false when that isn't a date or time format, or when it has
+// something that a Go layout can't represent: elapsed times such as
+// [h]:mm, the A/P indicator, the first letter of a month's name
+// (mmmmm), Japanese eras, and literal text that time.Format would take
+// for part of the layout, such as "Mon".  Note that time.Format
+// truncates fractions of a second, where Excel rounds them.
+func ToGoTimeLayout(formatCode string) (layout string, ok bool) {
+	// Dates are positive numbers, so only the first section of the
+	// format is used, as in "[$-409]m/d/yy h:mm AM/PM;@".
+	sections, err := splitFormatOnSemicolon(formatCode)
+	if err != nil {
+		return "", false
+	}
+	formatCode = sections[0]
+	if !isTimeFormat(formatCode) {
+		return "", false
+	}
+	if parts, isDuration := parseDurationFormat(formatCode); isDuration {
+		for _, part := range parts {
+			if part.elapsed {
+				return "", false
+			}
+		}
+	}
+	// Escaped characters are quoted, so that they are kept as
+	// literal text.
+	var quoted strings.Builder
+	runes := []rune(formatCode)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '"':
+			end, err := skipToRune(runes[i:], '"')
+			if err != nil {
+				return "", false
+			}
+			quoted.WriteString(string(runes[i : i+end+1]))
+			i += end
+		case runes[i] == '\\' && i+1 < len(runes):
+			quoted.WriteString(`"` + string(runes[i+1]) + `"`)
+			i++
+		default:
+			quoted.WriteRune(runes[i])
+		}
+	}
+	format, literals, _ := protectTimeLiterals(quoted.String())
+	// The units can be written in upper case, except for the AM/PM
+	// indicator, whose case is shown.  Any other letter can't be
+	// represented.
+	var normal strings.Builder
+	runes = []rune(format)
+	for i := 0; i < len(runes); i++ {
+		rest := string(runes[i:])
+		n, _, short := amPmToken(rest)
+		switch {
+		case n > 0 && !short:
+			normal.WriteString(rest[:n])
+			i += n - 1
+		case strings.ContainsRune("ymdhsYMDHS", runes[i]):
+			normal.WriteRune(unicode.ToLower(runes[i]))
+		case runes[i] == '[' || (runes[i] < unicode.MaxASCII && unicode.IsLetter(runes[i])):
+			return "", false
+		default:
+			normal.WriteRune(runes[i])
+		}
+	}
+	// The first letter of the name of a month, mmmmm, has no layout.
+	if strings.Contains(normal.String(), "mmmmm") {
+		return "", false
+	}
+	withPlaceholders := excelTimeLayout(normal.String())
+
+	var b strings.Builder
+	for _, r := range withPlaceholders {
+		switch {
+		case r == placeholderMonth:
+			b.WriteString("January")
+		case r == placeholderShortMonth:
+			b.WriteString("Jan")
+		case r == placeholderDay:
+			b.WriteString("Monday")
+		case r == placeholderShortDay:
+			b.WriteString("Mon")
+		case r == placeholderHour:
+			b.WriteString("15")
+		case r == placeholderAMPM:
+			b.WriteString("PM")
+		case r == placeholderAMPMLower:
+			b.WriteString("pm")
+		case r >= placeholderLiteral && int(r-placeholderLiteral) < len(literals):
+			b.WriteString(literals[r-placeholderLiteral])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	layout = b.String()
+	// Literal text, or the digits of a unit next to it, might form
+	// part of the layout, so the layout is checked against the way
+	// that FormatValue shows the same times.
+	for _, t := range []time.Time{
+		time.Date(2012, time.December, 22, 13, 44, 55, 123456789, time.UTC),
+		time.Date(2003, time.January, 5, 6, 7, 8, 0, time.UTC),
+	} {
+		want := restoreTimePlaceholders(t.Format(strings.ReplaceAll(withPlaceholders, string(placeholderHour), "15")), t, englishDateNames, literals)
+		if t.Format(layout) != want {
+			return "", false
+		}
+	}
+	return layout, true
+}
+
+// excelTimeLayout converts a time format, whose literal text has been
+// protected, into a Go time layout in which the names of months and
+// days are placeholders.
+func excelTimeLayout(format string) string {
 	// Replace Excel placeholders with Go time placeholders.
 	// For example, replace yyyy with 2006. These are in a specific order,
 	// due to the fact that m is used in month, minute, and am/pm. It would
 	// be easier to fix that with regular expressions, but if it's possible
 	// to keep this simple it would be easier to maintain.
-	// Full-length month and days (e.g. March, Tuesday) have letters in them that would be replaced
-	// by other characters below (such as the 'h' in March, or the 'd' in Tuesday) below.
-	// First we convert them to arbitrary characters unused in Excel Date formats, and then at the end,
-	// turn them to what they should actually be.
+	// The names of months and days (e.g. March, Tuesday) have letters in them that would be replaced
+	// by other characters below (such as the 'h' in March, or the 'd' in Tuesday) below, so they
+	// are converted to placeholders, which are replaced with the names once the time is formatted.
+	// The AM/PM and A/P indicators are placeholders too, as they have an
+	// m in them, and their letters can be in either case.
 	// Based off: http://www.ozgrid.com/Excel/CustomFormats.htm
 	replacements := []struct{ xltime, gotime string }{
 		{"yyyy", "2006"},
 		{"yy", "06"},
-		{"mmmm", "%%%%"},
-		{"dddd", "&&&&"},
+		{"mmmm", string(placeholderMonth)},
+		{"dddd", string(placeholderDay)},
+		{"ddd", string(placeholderShortDay)},
 		{"dd", "02"},
 		{"d", "2"},
-		{"mmm", "Jan"},
+		{"mmm", string(placeholderShortMonth)},
 		{"mmss", "0405"},
 		{"ss", "05"},
+		{"s", "5"},
 		{"mm:", "04:"},
 		{":mm", ":04"},
 		{"mm", "01"},
-		{"am/pm", "pm"},
 		{"m/", "1/"},
-		{"%%%%", "January"},
-		{"&&&&", "Monday"},
+		{"m", "1"},
 	}
 	// It is the presence of the "am/pm" indicator that determins
 	// if this is a 12 hour or 24 hours time format, not the
 	// number of 'h' characters.
-	if is12HourTime(format) {
+	twelveHour := is12HourTime(format)
+	format = markAmPm(format)
+	format = markMinutes(format)
+	if twelveHour {
 		format = strings.Replace(format, "hh", "03", 1)
 		format = strings.Replace(format, "h", "3", 1)
 	} else {
 		format = strings.Replace(format, "hh", "15", 1)
-		format = strings.Replace(format, "h", "15", 1)
+		format = strings.Replace(format, "h", string(placeholderHour), 1)
 	}
 	for _, repl := range replacements {
 		format = strings.Replace(format, repl.xltime, repl.gotime, 1)
 	}
-	// If the hour is optional, strip it out, along with the
-	// possible dangling colon that would remain.
-	if val.Hour() < 1 {
-		format = strings.Replace(format, "]:", "]", 1)
-		format = strings.Replace(format, "[03]", "", 1)
-		format = strings.Replace(format, "[3]", "", 1)
-		format = strings.Replace(format, "[15]", "", 1)
-	} else {
-		format = strings.Replace(format, "[3]", "3", 1)
-		format = strings.Replace(format, "[15]", "15", 1)
+	return format
+}
+
+// markAmPm replaces the AM/PM and A/P indicators of a time format with
+// placeholders.  As in Excel, the letters can be in either case, and
+// the case of the first one is the case that the indicator is shown in.
+func markAmPm(format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		n, upper, short := amPmToken(format[i:])
+		if n == 0 {
+			b.WriteByte(format[i])
+			continue
+		}
+		switch {
+		case short && upper:
+			b.WriteRune(placeholderAP)
+		case short:
+			b.WriteRune(placeholderAPLower)
+		case upper:
+			b.WriteRune(placeholderAMPM)
+		default:
+			b.WriteRune(placeholderAMPMLower)
+		}
+		i += n - 1
+	}
+	return b.String()
+}
+
+// amPmToken returns the length of the AM/PM or A/P indicator at the
+// start of format, in any mix of cases, or zero if there isn't one.
+// upper is whether the indicator is shown in capitals, and short is
+// whether it is A/P.
+func amPmToken(format string) (n int, upper, short bool) {
+	for _, token := range []string{"am/pm", "a/p"} {
+		if len(format) >= len(token) && strings.EqualFold(format[:len(token)], token) {
+			return len(token), format[0] == 'A', token == "a/p"
+		}
+	}
+	return 0, false, false
+}
+
+// amPmMarker returns the text that an AM/PM or A/P indicator shows for
+// an hour of a 24-hour clock.
+func amPmMarker(hour int, upper, short bool) string {
+	marker := "AM"
+	if hour >= 12 {
+		marker = "PM"
+	}
+	if short {
+		marker = marker[:1]
+	}
+	if !upper {
+		marker = strings.ToLower(marker)
+	}
+	return marker
+}
+
+// markMinutes replaces the m and mm of a time format that stand for
+// minutes with their Go layouts.  As in Excel, they are minutes rather
+// than months when they come straight after the hours, or straight
+// before the seconds, whatever literal text is between them, as in
+// "h"時"mm"分"" or "h mm".
+func markMinutes(format string) string {
+	type unitRun struct {
+		unit       rune
+		start, end int
+	}
+	runes := []rune(format)
+	var runs []unitRun
+	for i := 0; i < len(runes); i++ {
+		lower := strings.ToLower(string(runes[i:]))
+		switch {
+		case strings.HasPrefix(lower, "am/pm"):
+			i += len("am/pm") - 1
+		case strings.HasPrefix(lower, "a/p"):
+			i += len("a/p") - 1
+		case strings.ContainsRune("ymdhs", runes[i]):
+			end := i + 1
+			for end < len(runes) && runes[end] == runes[i] {
+				end++
+			}
+			runs = append(runs, unitRun{unit: runes[i], start: i, end: end})
+			i = end - 1
+		}
+	}
+	var b strings.Builder
+	last := 0
+	for i, run := range runs {
+		if run.unit != 'm' || run.end-run.start > 2 {
+			continue
+		}
+		if (i == 0 || runs[i-1].unit != 'h') && (i+1 == len(runs) || runs[i+1].unit != 's') {
+			continue
+		}
+		b.WriteString(string(runes[last:run.start]))
+		if run.end-run.start == 2 {
+			b.WriteString("04")
+		} else {
+			b.WriteString("4")
+		}
+		last = run.end
+	}
+	b.WriteString(string(runes[last:]))
+	return b.String()
+}
+
+// durationPart is a part of a format for a duration.  A unit of 'h',
+// 'm' or 's' is a number of hours, minutes or seconds, and a unit of
+// '.' is the fraction of a second.  A unit of 'a' is an AM/PM or A/P
+// indicator, which is kept as it is written in literal, and puts the
+// hours that aren't elapsed on a 12-hour clock.  A part with no unit
+// is a literal.
+type durationPart struct {
+	unit byte
+	// width is the number of digits to pad the value to.
+	width int
+	// elapsed is set for a bracketed unit, such as [h], which counts
+	// the whole duration rather than wrapping around.
+	elapsed bool
+	literal string
+}
+
+// parseDurationFormat splits a time format that has no date in it into
+// durationParts.  It only succeeds for the formats that can't be
+// handled as a time of day: those with an elapsed time unit, such as
+// "[h]:mm:ss" or "[mm]:ss", or with fractions of a second, such as
+// "mmss.0".
+func parseDurationFormat(format string) ([]durationPart, bool) {
+	var parts []durationPart
+	special := false
+	literal := func(text string) {
+		parts = append(parts, durationPart{literal: text})
+	}
+	runes := []rune(format)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		lower := unicode.ToLower(c)
+		switch {
+		case c == '"':
+			end, err := skipToRune(runes[i:], '"')
+			if err != nil {
+				return nil, false
+			}
+			literal(string(runes[i+1 : i+end]))
+			i += end
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				literal(string(runes[i]))
+			}
+		case c == '_' || c == '*':
+			// Padding and fill characters have no width here.
+			i++
+		case c == '[':
+			end, err := skipToRune(runes[i:], ']')
+			if err != nil {
+				return nil, false
+			}
+			inner := strings.ToLower(string(runes[i+1 : i+end]))
+			i += end
+			if inner != "" && strings.Trim(inner, inner[:1]) == "" && strings.Contains("hms", inner[:1]) {
+				parts = append(parts, durationPart{unit: inner[0], width: len(inner), elapsed: true})
+				special = true
+			}
+			// Anything else in brackets is a colour, a condition or
+			// a locale, which don't affect the text.
+		case lower == 'h' || lower == 'm' || lower == 's':
+			n := 1
+			for i+n < len(runes) && unicode.ToLower(runes[i+n]) == lower {
+				n++
+			}
+			if n > 2 {
+				// mmm is the name of a month.
+				return nil, false
+			}
+			parts = append(parts, durationPart{unit: byte(lower), width: n})
+			i += n - 1
+		case c == '.' && len(parts) > 0 && parts[len(parts)-1].unit == 's':
+			n := 0
+			for i+1+n < len(runes) && runes[i+1+n] == '0' {
+				n++
+			}
+			if n == 0 {
+				literal(".")
+				continue
+			}
+			if n > 9 {
+				// Any more zeros are literals.
+				n = 9
+			}
+			parts = append(parts, durationPart{unit: '.', width: n})
+			special = true
+			i += n
+		case lower == 'a':
+			n, _, _ := amPmToken(string(runes[i:]))
+			if n == 0 {
+				return nil, false
+			}
+			parts = append(parts, durationPart{unit: 'a', literal: string(runes[i : i+n])})
+			i += n - 1
+		case strings.ContainsRune("ydebgr上午下", lower):
+			// A date, an era or the Japanese AM/PM.
+			return nil, false
+		default:
+			literal(string(c))
+		}
+	}
+	// An m is a month, unless it follows an hour or precedes a second.
+	for i, part := range parts {
+		if part.unit != 'm' || part.elapsed {
+			continue
+		}
+		minute := false
+		for j := i - 1; j >= 0; j-- {
+			if parts[j].unit != 0 {
+				minute = parts[j].unit == 'h'
+				break
+			}
+		}
+		for j := i + 1; j < len(parts) && !minute; j++ {
+			if parts[j].unit != 0 {
+				minute = parts[j].unit == 's'
+				break
+			}
+		}
+		if !minute {
+			return nil, false
+		}
+	}
+	return parts, special
+}
+
+// formatDuration formats a number of days as a duration.  An elapsed
+// unit counts the whole duration, and the units smaller than it wrap
+// around, so 2.25 days is "54:00" in the format "[h]:mm".  The duration
+// is rounded to the precision that is shown before it is split into
+// units, as Excel does.
+func formatDuration(parts []durationPart, days float64) string {
+	var b strings.Builder
+	if days < 0 {
+		b.WriteByte('-')
+		days = -days
+	}
+	scale := int64(1)
+	for _, part := range parts {
+		if part.unit == '.' {
+			for i := 0; i < part.width; i++ {
+				scale *= 10
+			}
+		}
+	}
+	twelveHour := false
+	for _, part := range parts {
+		if part.unit == 'a' {
+			twelveHour = true
+		}
+	}
+	total := int64(math.Round(days * 86400 * float64(scale)))
+	seconds := total / scale
+	hour := int(seconds / 3600 % 24)
+	for _, part := range parts {
+		var n int64
+		switch part.unit {
+		case 0:
+			b.WriteString(part.literal)
+			continue
+		case 'a':
+			_, upper, short := amPmToken(part.literal)
+			b.WriteString(amPmMarker(hour, upper, short))
+			continue
+		case 'h':
+			n = seconds / 3600
+			if !part.elapsed {
+				n %= 24
+				if twelveHour {
+					n %= 12
+					if n == 0 {
+						n = 12
+					}
+				}
+			}
+		case 'm':
+			n = seconds / 60
+			if !part.elapsed {
+				n %= 60
+			}
+		case 's':
+			n = seconds
+			if !part.elapsed {
+				n %= 60
+			}
+		case '.':
+			fraction := strconv.FormatInt(total%scale, 10)
+			b.WriteByte('.')
+			b.WriteString(strings.Repeat("0", part.width-len(fraction)))
+			b.WriteString(fraction)
+			continue
+		}
+		digits := strconv.FormatInt(n, 10)
+		if len(digits) < part.width {
+			b.WriteString(strings.Repeat("0", part.width-len(digits)))
+		}
+		b.WriteString(digits)
 	}
-	return val.Format(format), nil
+	return b.String()
 }
 
 func skipToRune(runes []rune, r rune) (int, error) {
@@ -607,13 +2182,22 @@ func isTimeFormat(format string) bool {
 			if err != nil {
 				return false
 			}
-			i += endQuoteIndex + 1
+			// skipToRune returns the index of the closing quote, which the loop steps over.
+			i += endQuoteIndex
 		case '$', '-', '+', '/', '(', ')', ':', '!', '^', '&', '\'', '~', '{', '}', '<', '>', '=', ' ':
 			// These symbols are allowed to be used as literal without escaping
+		case '.':
+			// Dates such as dd.mm.yyyy use a full stop as a separator. The fractions of
+			// a second, as in ss.00, are found with the s above.
 		case ',':
 			// This is not documented in the XLSX spec as far as I can tell, but Excel and Numbers will include
 			// commas in number formats without escaping them, so this should be supported.
 		default:
+			if n, _, _ := amPmToken(string(curReducedFormat)); n > 0 {
+				foundTimeFormatCharacters = true
+				i += n - 1
+				continue
+			}
 			foundInThisLoop := false
 			for _, special := range timeFormatCharacters {
 				if strings.HasPrefix(string(curReducedFormat), special) {
@@ -657,5 +2241,6 @@ func isTimeFormat(format string) bool {
 // is12HourTime checks whether an Excel time format string is a 12
 // hours form.
 func is12HourTime(format string) bool {
-	return strings.Contains(format, "am/pm") || strings.Contains(format, "AM/PM") || strings.Contains(format, "a/p") || strings.Contains(format, "A/P")
+	format = strings.ToLower(format)
+	return strings.Contains(format, "am/pm") || strings.Contains(format, "a/p")
 }
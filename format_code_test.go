@@ -1,6 +1,9 @@
 package xlsx
 
 import (
+	"bytes"
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
@@ -107,9 +110,9 @@ func TestCellFormatCode(t *testing.T) {
 				cellType:             CellTypeNumeric,
 			},
 			{
-				formatString:         "_[0",
+				formatString:         "_[0", // The underscore leaves a space as wide as the bracket.
 				value:                "18.989999999999998",
-				formattedValueOutput: "19",
+				formattedValueOutput: " 19",
 				cellType:             CellTypeNumeric,
 			},
 			{
@@ -245,6 +248,334 @@ func TestCellFormatCode(t *testing.T) {
 		}
 	})
 
+	// The expected values are as Excel displays them.  Whole numbers
+	// are padded with spaces to the width of the fraction, so that
+	// they line up with the fractions in the same column.
+	c.Run("TestFractionFormats", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			value        string
+			expected     string
+		}{
+			{builtInNumFmt[12], "0.5", " 1/2"},
+			{builtInNumFmt[12], "1.25", "1 1/4"},
+			{builtInNumFmt[12], "1", "1    "},
+			{builtInNumFmt[12], "0", "0    "},
+			{builtInNumFmt[12], "0.99", "1    "},
+			{builtInNumFmt[12], "0.05", "0    "},
+			{builtInNumFmt[12], "-1.5", "-1 1/2"},
+			{builtInNumFmt[13], "3.14159265", "3 14/99"},
+			{builtInNumFmt[13], "0.333333", "  1/3 "},
+			{"# ???/???", "3.14159265", "3  16/113"},
+			{"?/?", "0.5", "1/2"},
+			{"?/?", "1.5", "3/2"},
+			{"?/?", "0", "0/1"},
+			{"0 ?/?", "0.5", "0 1/2"},
+			{"# ?/8", "0.5", " 4/8"},
+			{"# ?/8", "2.99", "3    "},
+			{"# ?/16", "0.3", " 5/16"},
+			{"# ?/?;(# ?/?)", "-0.75", "( 3/4)"},
+			{`# ?/?" cups"`, "1.5", "1 1/2 cups"},
+		}
+		for _, testCase := range testCases {
+			cell := &Cell{
+				cellType: CellTypeNumeric,
+				NumFmt:   testCase.formatString,
+				Value:    testCase.value,
+			}
+			val, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+		}
+	})
+
+	// The expected values are as Excel displays them.
+	c.Run("TestScientificFormats", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			value        string
+			expected     string
+		}{
+			{builtInNumFmt[11], "12345", "1.23E+04"},
+			{builtInNumFmt[11], "-12345", "-1.23E+04"},
+			{builtInNumFmt[11], "0.000123", "1.23E-04"},
+			{builtInNumFmt[11], "0", "0.00E+00"},
+			{builtInNumFmt[11], "9.999", "1.00E+01"},
+			{builtInNumFmt[11], "1E+100", "1.00E+100"},
+			{builtInNumFmt[11], "1.5E-300", "1.50E-300"},
+			{builtInNumFmt[48], "12345", "12.3E+3"},
+			{builtInNumFmt[48], "123456", "123.5E+3"},
+			{builtInNumFmt[48], "1234567", "1.2E+6"},
+			{builtInNumFmt[48], "999999", "1.0E+6"},
+			{builtInNumFmt[48], "0.001234", "1.2E-3"},
+			{builtInNumFmt[48], "-0.5", "-500.0E-3"},
+			{builtInNumFmt[48], "0", "0.0E+0"},
+			{"0.00E-00", "12345", "1.23E04"},
+			{"0.00E-00", "0.00012", "1.20E-04"},
+			{"0.0#E+0", "1500", "1.5E+3"},
+			{"0.0#e+0", "1234", "1.23E+3"},
+			{"00.00E+00", "12345", "12.35E+03"},
+			{"0E+0", "5", "5E+0"},
+			{"0.00E+00;(0.00E+00)", "-12345", "(1.23E+04)"},
+		}
+		for _, testCase := range testCases {
+			cell := &Cell{
+				cellType: CellTypeNumeric,
+				NumFmt:   testCase.formatString,
+				Value:    testCase.value,
+			}
+			val, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+		}
+	})
+
+	// The expected values are as Excel displays them.
+	c.Run("TestDurationFormats", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			value        string
+			expected     string
+		}{
+			{builtInNumFmt[46], "2.2152777777777777", "53:10:00"},
+			{builtInNumFmt[46], "0", "0:00:00"},
+			{builtInNumFmt[46], "0.000723", "0:01:02"},
+			{builtInNumFmt[46], "-0.5", "-12:00:00"},
+			{builtInNumFmt[47], "0.000723", "0102.5"},
+			{"[hh]:mm", "0.25", "06:00"},
+			{"[h]:mm", "0.999999", "24:00"},
+			{"[mm]:ss", "0.0416666666666667", "60:00"},
+			{"[m]:ss.00", "0.0006943", "0:59.99"},
+			{"[m]:ss.00", "0.00069444", "1:00.00"},
+			{"[ss]", "0.0416666666666667", "3600"},
+			{"[s].0", "0.000723", "62.5"},
+			{"mm:ss.0", "0.000723", "01:02.5"},
+			{"mm:ss.0", "0.0006944", "01:00.0"},
+			{"h:mm:ss.000", "1.5", "12:00:00.000"},
+			{`[h] "hours" mm "minutes"`, "1.25", "30 hours 00 minutes"},
+			{`[Red][H]:MM`, "1.5", "36:00"},
+			// Elapsed hours stay elapsed next to AM/PM.
+			{"[h]:mm AM/PM", "1.5", "36:00 PM"},
+			{"[h]:mm AM/PM", "0", "0:00 AM"},
+		}
+		for _, testCase := range testCases {
+			cell := &Cell{
+				cellType: CellTypeNumeric,
+				NumFmt:   testCase.formatString,
+				Value:    testCase.value,
+			}
+			val, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+		}
+
+		// Formats with a date in them aren't durations.
+		for _, format := range []string{"mm:ss", "yyyy-mm-dd hh:mm:ss.0", "h:mm AM/PM", "mm.0"} {
+			_, ok := parseDurationFormat(format)
+			c.Assert(ok, qt.IsFalse, qt.Commentf(format))
+		}
+	})
+
+	// The expected values are as an English Excel displays them, which
+	// writes the names of months and days in English whatever the locale.
+	c.Run("TestLocaleFormats", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			value        string
+			expected     string
+		}{
+			{"[$-409]d-mmm-yy", "43831", "1-Jan-20"},
+			{"[$-409]h:mm AM/PM", "43831.5", "12:00 PM"},
+			{"[$-F800]dddd, mmmm dd, yyyy", "43831", "Wednesday, January 01, 2020"},
+			{"[$-F400]h:mm:ss AM/PM", "43831.75", "6:00:00 PM"},
+			{"[$-407]dddd, d. mmmm yyyy", "43831", "Wednesday, 1. January 2020"},
+			{"dd.mm.yyyy", "43831", "01.01.2020"},
+			{`h"h"mm`, "43831.75834", "18h12"},
+			{"mm/dd h mm", "43831.75834", "01/01 18 12"},
+			{"m ss", "43831.75834", "12 00"},
+			{`[$-411]yyyy"年"m"月"d"日"`, "43831", "2020年1月1日"},
+			{`d "de" mmmm`, "43831", "1 de January"},
+			{"[$-409]#,##0", "234.56", "235"},
+			{"[$€-407]#,##0.00", "234.5", "€234.50"},
+			{`#,##0.00\ [$€-40C]`, "234.5", "234.50 €"},
+			{"[$€-x-euro2] #,##0.00", "234.5", "€ 234.50"},
+			{"[$¥-411]#,##0", "234.56", "¥235"},
+			{"[$USD] #,##0", "234.56", "USD 235"},
+			{"[$€-2] #,##0.00;[RED]-[$€-2] #,##0.00", "-234.5", "-€ 234.50"},
+		}
+		for _, testCase := range testCases {
+			cell := &Cell{
+				cellType: CellTypeNumeric,
+				NumFmt:   testCase.formatString,
+				Value:    testCase.value,
+			}
+			val, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+		}
+	})
+
+	c.Run("TestLocalizedDateNames", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			expected     string
+		}{
+			{"[$-407]dddd, d. mmmm yyyy", "Mittwoch, 1. Januar 2020"},
+			{"[$-407]ddd, d. mmm yy", "Mi, 1. Jan 20"},
+			{"[$-40C]dddd d mmmm yyyy", "mercredi 1 janvier 2020"},
+			{"[$-410]d mmmm yyyy", "1 gennaio 2020"},
+			{"[$-C0A]dddd, d \"de\" mmmm \"de\" yyyy", "miércoles, 1 de enero de 2020"},
+			{`[$-411]mmmm d"日" (ddd)`, "1月 1日 (水)"},
+			{"[$-809]dddd d mmmm yyyy", "Wednesday 1 January 2020"},
+			{"[$-419]d mmmm yyyy", "1 January 2020"},
+			{"dddd, d. mmmm yyyy", "Wednesday, 1. January 2020"},
+		}
+		file := NewFile(LocalizedDateNames())
+		sheet, err := file.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		for _, testCase := range testCases {
+			cell, err := sheet.Cell(0, 0)
+			c.Assert(err, qt.IsNil)
+			cell.SetFloatWithFormat(43831, testCase.formatString)
+			val, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil, qt.Commentf(testCase.formatString))
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf(testCase.formatString))
+		}
+	})
+
+	c.Run("TestSectionColors", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			cellType     CellType
+			value        string
+			expected     string
+			color        string
+		}{
+			{"#,##0.00;[Red](#,##0.00)", CellTypeNumeric, "-5", "(5.00)", "FFFF0000"},
+			{"#,##0.00;[Red](#,##0.00)", CellTypeNumeric, "5", "5.00", ""},
+			{"[Blue]0;[Red]-0;[Green]0;[Magenta]@", CellTypeNumeric, "5", "5", "FF0000FF"},
+			{"[Blue]0;[Red]-0;[Green]0;[Magenta]@", CellTypeNumeric, "-5", "-5", "FFFF0000"},
+			{"[Blue]0;[Red]-0;[Green]0;[Magenta]@", CellTypeNumeric, "0", "0", "FF00FF00"},
+			{"[Blue]0;[Red]-0;[Green]0;[Magenta]@", CellTypeString, "text", "text", "FFFF00FF"},
+			{"[BLACK]0;[white]0", CellTypeNumeric, "-1", "1", "FFFFFFFF"},
+			{"[yellow]0", CellTypeNumeric, "-1", "-1", "FFFFFF00"},
+			{"[cyan]0", CellTypeNumeric, "1", "1", "FF00FFFF"},
+			{"[Color10]0", CellTypeNumeric, "1", "1", "FF008000"},
+			{"[color1]0", CellTypeNumeric, "1", "1", "FF000000"},
+			{"[Color56]0", CellTypeNumeric, "1", "1", "FF333333"},
+			{"[Color57]0", CellTypeNumeric, "1", "1", ""},
+			{"[$-409][Red]0.00", CellTypeNumeric, "1", "1.00", "FFFF0000"},
+			{`"[Red]"0`, CellTypeNumeric, "1", "[Red]1", ""},
+			{"[Red][h]:mm", CellTypeNumeric, "1.5", "36:00", "FFFF0000"},
+			{"[Blue]yyyy-mm-dd", CellTypeNumeric, "43831", "2020-01-01", "FF0000FF"},
+			{"0.00", CellTypeNumeric, "1", "1.00", ""},
+			{"[Red]0", CellTypeBool, "1", "TRUE", ""},
+		}
+		for _, testCase := range testCases {
+			cell := &Cell{
+				cellType: testCase.cellType,
+				NumFmt:   testCase.formatString,
+				Value:    testCase.value,
+			}
+			val, color, err := cell.FormattedValueWithColor()
+			c.Assert(err, qt.IsNil)
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+			c.Assert(color, qt.Equals, testCase.color, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+			formatted, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(formatted, qt.Equals, val)
+		}
+	})
+
+	c.Run("TestThousandsScaling", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			value        string
+			expected     string
+		}{
+			{"0,", "12345", "12"},
+			{"0,", "2500", "3"},
+			{"0,", "-2500", "-3"},
+			{"0,", "499", "0"},
+			{"#,##0,,", "12345678", "12"},
+			{"#,##0.0,,", "12345678", "12.3"},
+			{"#,##0.0,,", "12350000", "12.4"},
+			{`#,##0.0,,"M"`, "12345678", "12.3M"},
+			{`0.0,"K";(0.0,"K")`, "-1250", "(1.3K)"},
+			{"0.00,%", "1234", "123.40%"},
+			{"0,%", "25", "3%"},
+			{"#,##0", "1234", "1234"},
+			{"0.00", "2.5", "2.50"},
+		}
+		for _, testCase := range testCases {
+			cell := &Cell{
+				cellType: CellTypeNumeric,
+				NumFmt:   testCase.formatString,
+				Value:    testCase.value,
+			}
+			val, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+		}
+	})
+
+	c.Run("TestConditionalSections", func(c *qt.C) {
+		testCases := []struct {
+			formatString string
+			value        string
+			expected     string
+			color        string
+		}{
+			{"[>=1000]#,##0;[<1]0.00;0", "1500", "1500", ""},
+			{"[>=1000]#,##0;[<1]0.00;0", "0.5", "0.50", ""},
+			{"[>=1000]#,##0;[<1]0.00;0", "5.25", "5", ""},
+			{"[>=1000]#,##0;[<1]0.00;0", "-3", "-3.00", ""},
+			{"[Red][<=100]0;[Blue][>100]0", "50", "50", "FFFF0000"},
+			{"[Red][<=100]0;[Blue][>100]0", "150", "150", "FF0000FF"},
+			{"[Red][<=100]0;[Blue][>100]0", "-50", "-50", "FFFF0000"},
+			{"[>100][Green]0.0;0", "101", "101.0", "FF00FF00"},
+			{"[=1]\"one\";[<>1]0", "1", "one", ""},
+			{"[=1]\"one\";[<>1]0", "2", "2", ""},
+			{`[<0]"minus "0;"plus "0`, "-4", "minus 4", ""},
+			{`[<-10]"low "0;0`, "-20", "low 20", ""},
+			{`[<=-10]"low "0;0`, "-20", "low 20", ""},
+			{`[<10]"low "0;0`, "-20", "low -20", ""},
+			{"[>100]0;[<-100]0", "5", "5", ""},
+			{"[>100]0.0", "5.25", "5.25", ""},
+			{`[<=9999999]0;"big "0`, "5551234", "5551234", ""},
+			{`[<=9999999]0;"big "0`, "8885551234", "big 8885551234", ""},
+		}
+		for _, testCase := range testCases {
+			cell := &Cell{
+				cellType: CellTypeNumeric,
+				NumFmt:   testCase.formatString,
+				Value:    testCase.value,
+			}
+			val, color, err := cell.FormattedValueWithColor()
+			c.Assert(err, qt.IsNil, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+			c.Assert(val, qt.Equals, testCase.expected, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+			c.Assert(color, qt.Equals, testCase.color, qt.Commentf("%s %s", testCase.formatString, testCase.value))
+		}
+
+		// Text is shown with the fourth section, whatever the conditions.
+		cell := &Cell{cellType: CellTypeString, NumFmt: `[>0]0;[<0]0;0;"text: "@`, Value: "x"}
+		val, err := cell.FormattedValue()
+		c.Assert(err, qt.IsNil)
+		c.Assert(val, qt.Equals, "text: x")
+	})
+
+	c.Run("TestClosestFraction", func(c *qt.C) {
+		num, den := closestFraction(0.5, 9)
+		c.Assert([]int64{num, den}, qt.DeepEquals, []int64{1, 2})
+		num, den = closestFraction(0.14159265, 99)
+		c.Assert([]int64{num, den}, qt.DeepEquals, []int64{14, 99})
+		num, den = closestFraction(0.14159265, 999)
+		c.Assert([]int64{num, den}, qt.DeepEquals, []int64{16, 113})
+		num, den = closestFraction(0, 9)
+		c.Assert([]int64{num, den}, qt.DeepEquals, []int64{0, 1})
+		num, den = closestFraction(2, 9)
+		c.Assert([]int64{num, den}, qt.DeepEquals, []int64{2, 1})
+	})
 }
 
 func TestIsNumberFormat(t *testing.T) {
@@ -330,3 +661,542 @@ func TestIsNumberFormat(t *testing.T) {
 	c.Assert(isTimeFormat(`m/d/yy`), qt.Equals, true)
 	c.Assert(isTimeFormat(`m-d-yy`), qt.Equals, true)
 }
+
+// The fixtures have one formatted value in each row of column A, with
+// the number formats that German, French and Japanese versions of Excel
+// give such values.  They weren't saved by those versions of Excel but
+// were made by hand, with the format codes that they are documented to
+// write, so they check the formatting of those codes rather than that
+// the files that those versions write can be read.
+func TestLocaleFixtures(t *testing.T) {
+	c := qt.New(t)
+
+	testCases := []struct {
+		filename  string
+		english   []string
+		localized []string
+	}{
+		{
+			filename:  "./testdocs/locale_de.xlsx",
+			english:   []string{"Wednesday, 1. January 2020", "1. Jan 20", "01.01.2020", "234.50 €", "18:00"},
+			localized: []string{"Mittwoch, 1. Januar 2020", "1. Jan 20", "01.01.2020", "234.50 €", "18:00"},
+		},
+		{
+			filename:  "./testdocs/locale_fr.xlsx",
+			english:   []string{"Wednesday 1 January 2020", "1 Jan 20", "01/01/2020", "234.50 €", "18:00:00"},
+			localized: []string{"mercredi 1 janvier 2020", "1 janv. 20", "01/01/2020", "234.50 €", "18:00:00"},
+		},
+		{
+			filename:  "./testdocs/locale_ja.xlsx",
+			english:   []string{"2020年1月1日", "January 1日 (Wed)", "2020/1/1", "¥235", "18時00分"},
+			localized: []string{"2020年1月1日", "1月 1日 (水)", "2020/1/1", "¥235", "18時00分"},
+		},
+	}
+	formattedValues := func(c *qt.C, filename string, options ...FileOption) []string {
+		f, err := OpenFile(filename, options...)
+		c.Assert(err, qt.IsNil)
+		var values []string
+		err = f.Sheets[0].ForEachRow(func(r *Row) error {
+			value, err := r.GetCell(0).FormattedValue()
+			values = append(values, value)
+			return err
+		})
+		c.Assert(err, qt.IsNil)
+		return values
+	}
+	csRunO(c, "TestEnglishNames", func(c *qt.C, option FileOption) {
+		for _, testCase := range testCases {
+			c.Assert(formattedValues(c, testCase.filename, option), qt.DeepEquals, testCase.english)
+		}
+	})
+	csRunO(c, "TestLocalizedNames", func(c *qt.C, option FileOption) {
+		for _, testCase := range testCases {
+			c.Assert(formattedValues(c, testCase.filename, option, LocalizedDateNames()), qt.DeepEquals, testCase.localized)
+		}
+	})
+}
+
+func TestEastAsianBuiltInFormats(t *testing.T) {
+	c := qt.New(t)
+
+	expected := []string{
+		// 27 to 36
+		"2020.1.1", "2020年1月1日", "2020年1月1日", "1/1/20", "2020年1月1日",
+		"18時00分", "18時00分00秒", "2020年1月", "1月1日", "2020.1.1",
+		// 50 to 58
+		"2020.1.1", "2020年1月1日", "2020年1月", "1月1日", "2020年1月1日",
+		"2020年1月", "1月1日", "2020.1.1", "2020年1月1日",
+	}
+	formattedValues := func(c *qt.C, f *File) []string {
+		var values []string
+		err := f.Sheets[0].ForEachRow(func(r *Row) error {
+			value, err := r.GetCell(0).FormattedValue()
+			values = append(values, value)
+			return err
+		})
+		c.Assert(err, qt.IsNil)
+		return values
+	}
+
+	c.Run("getBuiltinNumberFormat", func(c *qt.C) {
+		c.Assert(getBuiltinNumberFormat(31), qt.Equals, `yyyy"年"m"月"d"日"`)
+		c.Assert(getBuiltinNumberFormat(58), qt.Equals, `[$-411]ggge"年"m"月"d"日"`)
+		c.Assert(getBuiltinNumberFormat(59), qt.Equals, "")
+	})
+
+	csRunO(c, "Fixture", func(c *qt.C, option FileOption) {
+		f, err := OpenFile("./testdocs/builtin_ja.xlsx", option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(formattedValues(c, f), qt.DeepEquals, expected)
+
+		// Each cell keeps the id that it was read with, though several
+		// ids share a code.
+		var ids []int
+		err = f.Sheets[0].ForEachRow(func(r *Row) error {
+			ids = append(ids, r.GetCell(0).NumFmtID())
+			return nil
+		})
+		c.Assert(err, qt.IsNil)
+		c.Assert(ids, qt.DeepEquals, []int{
+			27, 28, 29, 30, 31, 32, 33, 34, 35, 36,
+			50, 51, 52, 53, 54, 55, 56, 57, 58,
+		})
+
+		// The formats are written by their codes, which mean the same
+		// to any version of Excel, rather than by their ids.
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/styles.xml"], qt.Contains, `formatCode="[$-411]ggge&#34;年&#34;m&#34;月&#34;d&#34;日&#34;"`)
+		c.Assert(parts["xl/styles.xml"], qt.Not(qt.Contains), `numFmtId="31"`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(formattedValues(c, saved), qt.DeepEquals, expected)
+	})
+}
+
+func TestToGoTimeLayout(t *testing.T) {
+	c := qt.New(t)
+
+	testCases := []struct {
+		format string
+		layout string
+		ok     bool
+	}{
+		{format: "yyyy-mm-dd", layout: "2006-01-02", ok: true},
+		{format: "YYYY-MM-DD", layout: "2006-01-02", ok: true},
+		{format: "d-mmm-yy", layout: "2-Jan-06", ok: true},
+		{format: "dddd, mmmm dd", layout: "Monday, January 02", ok: true},
+		{format: "dd/mm/yyyy hh:mm AM/PM", layout: "02/01/2006 03:04 PM", ok: true},
+		{format: "h:mm am/pm", layout: "3:04 pm", ok: true},
+		{format: "h:mm:ss", layout: "15:04:05", ok: true},
+		{format: "mm:ss", layout: "04:05", ok: true},
+		{format: "hh:mm:ss.000", layout: "15:04:05.000", ok: true},
+		{format: `h "h" mm`, layout: "15 h 04", ok: true},
+		{format: `yyyy\-mm\-dd`, layout: "2006-01-02", ok: true},
+		{format: `d" of "mmmm`, layout: "2 of January", ok: true},
+		{format: `yyyy"年"m"月"d"日"`, layout: "2006年1月2日", ok: true},
+		{format: "[Red]yyyy-mm-dd", layout: "2006-01-02", ok: true},
+		{format: "[$-409]m/d/yy h:mm AM/PM;@", layout: "1/2/06 3:04 PM", ok: true},
+		// These can't be represented by a Go layout.
+		{format: "[h]:mm:ss"},
+		{format: "[mm]:ss"},
+		{format: "h:mm a/p"},
+		{format: "mmmmm d"},
+		{format: `d"-"MMMMM`},
+		{format: `[$-411]ggge"年"m"月"d"日"`},
+		{format: `"Mon" d`},
+		{format: `"0"m`},
+		// These aren't time formats.
+		{format: "General"},
+		{format: "0.00"},
+		{format: "@"},
+	}
+	for _, testCase := range testCases {
+		layout, ok := ToGoTimeLayout(testCase.format)
+		c.Check(ok, qt.Equals, testCase.ok, qt.Commentf("%s", testCase.format))
+		c.Check(layout, qt.Equals, testCase.layout, qt.Commentf("%s", testCase.format))
+	}
+}
+
+func TestValidateNumberFormat(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("BuiltIn", func(c *qt.C) {
+		for id, format := range builtInNumFmt {
+			c.Check(validateNumberFormat(format), qt.IsNil, qt.Commentf("%d: %s", id, format))
+		}
+	})
+
+	c.Run("Valid", func(c *qt.C) {
+		for _, format := range []string{
+			"",
+			"General",
+			"0.00E+00",
+			`#,##0.00 "kr";[Red]-#,##0.00 "kr"`,
+			`[>=1000]#,##0,"K";0`,
+			"[Color10]0;[Blue]-0;0;@",
+			`[$€-407] #,##0.00`,
+			"0.0_);(0.0)",
+			"* #,##0",
+			`yyyy\-mm\-dd h:mm AM/PM`,
+			"[h]:mm:ss",
+			"h:mm a/p",
+			`[$-411]ggge"年"m"月"d"日"`,
+			"###-####",
+			"0;;",
+		} {
+			c.Check(validateNumberFormat(format), qt.IsNil, qt.Commentf("%s", format))
+		}
+	})
+
+	c.Run("Invalid", func(c *qt.C) {
+		testCases := []struct {
+			format string
+			err    string
+		}{
+			{format: `0.00 "kr`, err: `invalid number format "0.00 \\"kr": unmatched double quote`},
+			{format: "0;0;0;@;0", err: `invalid number format "0;0;0;@;0": 5 sections, where at most 4 are allowed`},
+			{format: "[Red0.00", err: `invalid number format "\[Red0.00": unmatched '\['`},
+			{format: "0.00]", err: `invalid number format "0.00\]": unmatched '\]'`},
+			{format: "[]0", err: `invalid number format "\[\]0": empty brackets`},
+			{format: "[>=x]0", err: `invalid number format "\[>=x\]0": invalid condition \[>=x\]`},
+			{format: "[Color57]0", err: `invalid number format "\[Color57\]0": invalid color \[Color57\], the number must be from 1 to 56`},
+			{format: "0.00 kr", err: `invalid number format "0.00 kr": the letter 'k' must be quoted or escaped`},
+			{format: `0\`, err: `invalid number format "0\\\\": '\\\\' at the end of a section, without a character after it`},
+			{format: "0_;0", err: `invalid number format "0_;0": '_' at the end of a section, without a character after it`},
+		}
+		for _, testCase := range testCases {
+			c.Check(validateNumberFormat(testCase.format), qt.ErrorMatches, testCase.err)
+		}
+	})
+}
+
+func TestFormatValue(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("MatchesFormattedValue", func(c *qt.C) {
+		for _, code := range []string{"", "General", "0", "0.00", "#,##0.00;[Red](#,##0.00)", "0%", "0.00E+00", "# ?/?", `[>=1000]0,"K";0`, "yyyy-mm-dd", "h:mm AM/PM", "@"} {
+			for _, value := range []float64{0, 1.5, -1234.567, 43831.75, 1e12} {
+				for _, date1904 := range []bool{false, true} {
+					cell := &Cell{date1904: date1904}
+					cell.SetFloat(value)
+					cell.SetFormat(code)
+					expected, expectedErr := cell.FormattedValue()
+					got, err := FormatValue(code, value, date1904)
+					comment := qt.Commentf("%q %v %v", code, value, date1904)
+					c.Check(got, qt.Equals, expected, comment)
+					c.Check(err, qt.DeepEquals, expectedErr, comment)
+				}
+			}
+		}
+	})
+
+	c.Run("Date1904", func(c *qt.C) {
+		got, err := FormatValue("yyyy-mm-dd", 0, false)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.Equals, "1899-12-30")
+		got, err = FormatValue("yyyy-mm-dd", 0, true)
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.Equals, "1904-01-01")
+	})
+
+	c.Run("Text", func(c *qt.C) {
+		got, err := FormatText(`0;-0;0;"Name: "@`, "Ada")
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.Equals, "Name: Ada")
+		got, err = FormatText("0.00", "Ada")
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.Equals, "Ada")
+	})
+
+	c.Run("Cached", func(c *qt.C) {
+		_, err := FormatValue("0.000", 1, false)
+		c.Assert(err, qt.IsNil)
+		first := cachedNumberFormat("0.000")
+		c.Assert(cachedNumberFormat("0.000"), qt.Equals, first)
+
+		// The cache doesn't grow without bound.
+		for i := 0; i < 2*maxParsedNumFmtCache; i++ {
+			_, err := FormatValue(fmt.Sprintf(`0"%d"`, i), 1, false)
+			c.Assert(err, qt.IsNil)
+		}
+		parsedNumFmtCacheMU.RLock()
+		defer parsedNumFmtCacheMU.RUnlock()
+		c.Assert(len(parsedNumFmtCache) <= maxParsedNumFmtCache, qt.IsTrue)
+	})
+}
+
+func TestGeneralNumber(t *testing.T) {
+	c := qt.New(t)
+
+	// The expected values are what Excel shows for each number with the
+	// General format, in a column of the default width.
+	testCases := []struct {
+		value    float64
+		expected string
+	}{
+		{value: 0, expected: "0"},
+		{value: math.Copysign(0, -1), expected: "0"},
+		{value: 1, expected: "1"},
+		{value: -1, expected: "-1"},
+		{value: 100, expected: "100"},
+		{value: 1000, expected: "1000"},
+		{value: 0.1 + 0.2, expected: "0.3"},
+		{value: 1.1, expected: "1.1"},
+		{value: 18.989999999999998, expected: "18.99"},
+		{value: 2.0 / 3, expected: "0.666666667"},
+		{value: -2.0 / 3, expected: "-0.666666667"},
+		{value: 1.0 / 3 * 1000, expected: "333.3333333"},
+		{value: 3.14159265358979, expected: "3.141592654"},
+		{value: 1234567.891234, expected: "1234567.891"},
+		{value: 1234567890.5, expected: "1234567891"},
+		{value: 12345678901, expected: "12345678901"},
+		{value: -12345678901, expected: "-12345678901"},
+		{value: 99999999999.6, expected: "1E+11"},
+		{value: 123456789012, expected: "1.23457E+11"},
+		{value: -123456789012, expected: "-1.23457E+11"},
+		{value: 1e15, expected: "1E+15"},
+		{value: 1.23e18, expected: "1.23E+18"},
+		{value: 1.23456789e100, expected: "1.2346E+100"},
+		{value: 0.5, expected: "0.5"},
+		{value: 0.123456789012, expected: "0.123456789"},
+		{value: 0.000123456789, expected: "0.000123457"},
+		{value: 0.0001, expected: "0.0001"},
+		{value: 0.00001, expected: "0.00001"},
+		{value: 0.0000123456789, expected: "1.23457E-05"},
+		{value: 0.000000001, expected: "0.000000001"},
+		{value: 0.0000000015, expected: "1.5E-09"},
+		{value: 1e-10, expected: "1E-10"},
+		{value: -8e-15, expected: "-8E-15"},
+		{value: 43831.75, expected: "43831.75"},
+	}
+	for _, testCase := range testCases {
+		c.Check(generalNumber(testCase.value), qt.Equals, testCase.expected, qt.Commentf("%v", testCase.value))
+
+		// Cells with the General format show the same.
+		cell := &Cell{}
+		cell.SetFloat(testCase.value)
+		formatted, err := cell.FormattedValue()
+		c.Check(err, qt.IsNil)
+		c.Check(formatted, qt.Equals, testCase.expected, qt.Commentf("%v", testCase.value))
+	}
+}
+
+func TestFillAndPadding(t *testing.T) {
+	c := qt.New(t)
+
+	// The accounting formats show each number between a leading and a
+	// trailing space, or a parenthesis in their place, so that the
+	// digits of a column of numbers line up.
+	c.Run("Accounting", func(c *qt.C) {
+		testCases := []struct {
+			id       int
+			value    float64
+			expected string
+		}{
+			{id: 41, value: 1234, expected: " 1234 "},
+			{id: 41, value: -1234, expected: " (1234)"},
+			{id: 41, value: 0, expected: " - "},
+			{id: 42, value: 1234, expected: " $1234 "},
+			{id: 42, value: -1234, expected: " $(1234)"},
+			{id: 42, value: 0, expected: " $- "},
+			{id: 43, value: 1234.5, expected: " 1234.50 "},
+			{id: 43, value: -1234.5, expected: " (1234.50)"},
+			{id: 43, value: 0, expected: " -   "},
+			{id: 44, value: 1234.5, expected: " $1234.50 "},
+			{id: 44, value: -1234.5, expected: " $(1234.50)"},
+			{id: 44, value: 0, expected: " $-   "},
+		}
+		for _, testCase := range testCases {
+			got, err := FormatValue(builtInNumFmt[testCase.id], testCase.value, false)
+			c.Check(err, qt.IsNil)
+			c.Check(got, qt.Equals, testCase.expected, qt.Commentf("%d %v", testCase.id, testCase.value))
+		}
+		got, err := FormatText(builtInNumFmt[44], "n/a")
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.Equals, " n/a ")
+	})
+
+	c.Run("ExpandFill", func(c *qt.C) {
+		c.Assert(expandFill("abc", 10), qt.Equals, "abc")
+		c.Assert(expandFill(" $\x00 1234.50 ", 0), qt.Equals, " $1234.50 ")
+		c.Assert(expandFill(" $\x00 1234.50 ", 14), qt.Equals, " $    1234.50 ")
+		c.Assert(expandFill(" $\x00 1234.50 ", 5), qt.Equals, " $1234.50 ")
+		c.Assert(expandFill("\x00·€9", 4), qt.Equals, "··€9")
+	})
+
+	csRunO(c, "FillWidth", func(c *qt.C, option FileOption) {
+		f := NewFile(option, FillWidth(14))
+		sheet, err := f.AddSheet("Accounts")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		for _, value := range []float64{1234.5, -1234.5, 0} {
+			row.AddCell().SetFloatWithFormat(value, builtInNumFmt[44])
+		}
+		row.AddCell().SetFloatWithFormat(7, "0*.")
+
+		var got []string
+		err = row.ForEachCell(func(cell *Cell) error {
+			value, err := cell.FormattedValue()
+			got = append(got, value)
+			return err
+		})
+		c.Assert(err, qt.IsNil)
+		c.Assert(got, qt.DeepEquals, []string{
+			" $    1234.50 ",
+			" $   (1234.50)",
+			" $        -   ",
+			"7.............",
+		})
+	})
+}
+
+func TestNegativeSections(t *testing.T) {
+	c := qt.New(t)
+
+	testCases := []struct {
+		format   string
+		value    float64
+		expected string
+	}{
+		// The built-in formats with parentheses show negative numbers
+		// in them, without a minus sign or the name of the color.
+		{format: builtInNumFmt[37], value: 1234, expected: "1234 "},
+		{format: builtInNumFmt[37], value: -1234, expected: "(1234)"},
+		{format: builtInNumFmt[38], value: -1234, expected: "(1234)"},
+		{format: builtInNumFmt[39], value: 1234, expected: "1234.00"},
+		{format: builtInNumFmt[39], value: -1234, expected: "(1234.00)"},
+		{format: builtInNumFmt[39], value: -0.4, expected: "(0.40)"},
+		{format: builtInNumFmt[40], value: -1234, expected: "(1234.00)"},
+		{format: builtInNumFmt[40], value: 0, expected: "0.00"},
+		// With one section, the minus sign goes in front of it all.
+		{format: "$0.00", value: -5, expected: "-$5.00"},
+		{format: "(0.00)", value: -5, expected: "-(5.00)"},
+		{format: `"n/a"`, value: -5, expected: "-n/a"},
+		{format: "0%", value: -0.5, expected: "-50%"},
+		{format: "General", value: -5, expected: "-5"},
+		{format: "@", value: -5, expected: "-5"},
+		// The negative section shows the sign itself, if at all.
+		{format: "0;-0", value: -5, expected: "-5"},
+		{format: "0.0;[Red]0.0", value: -5, expected: "5.0"},
+		{format: "0;General", value: -5, expected: "5"},
+		// Zero uses the third section, when there is one.
+		{format: `0;(0);"zero"`, value: 0, expected: "zero"},
+		{format: `0;(0);"zero"`, value: -0.001, expected: "(0)"},
+		{format: `0;(0)`, value: 0, expected: "0"},
+		// An empty section hides the values it is for.
+		{format: "0;;", value: -5, expected: ""},
+		{format: "0;;", value: 0, expected: ""},
+		{format: "0;-0;", value: 0, expected: ""},
+		{format: "0;-0;", value: 5, expected: "5"},
+	}
+	for _, testCase := range testCases {
+		got, err := FormatValue(testCase.format, testCase.value, false)
+		c.Check(err, qt.IsNil, qt.Commentf("%s %v", testCase.format, testCase.value))
+		c.Check(got, qt.Equals, testCase.expected, qt.Commentf("%s %v", testCase.format, testCase.value))
+	}
+
+	got, err := FormatText("0;0;0;", "text")
+	c.Assert(err, qt.IsNil)
+	c.Assert(got, qt.Equals, "")
+}
+
+func TestFormatLiterals(t *testing.T) {
+	c := qt.New(t)
+
+	// These format codes are from files saved by Excel, and hold
+	// literal text in quotes, after backslashes, or in locale brackets.
+	testCases := []struct {
+		format   string
+		value    float64
+		expected string
+	}{
+		{format: `"$"#,##0.00`, value: 12.5, expected: "$12.50"},
+		{format: `0.0\%`, value: 12.5, expected: "12.5%"},
+		{format: `#,##0 "units"`, value: 12, expected: "12 units"},
+		{format: `0.00\ "EUR"`, value: 12.5, expected: "12.50 EUR"},
+		{format: `#,##0.00 [$€-407]`, value: 12.5, expected: "12.50 €"},
+		{format: `0\ \k\g`, value: 12, expected: "12 kg"},
+		{format: `000\-00\-0000`, value: 123456789, expected: "123-45-6789"},
+		{format: `[<=9999999]###\-####;\(###\)\ ###\-####`, value: 5551234, expected: "555-1234"},
+		{format: `[<=9999999]###\-####;\(###\)\ ###\-####`, value: 2125551234, expected: "(212) 555-1234"},
+		{format: `00000\-0000`, value: 123456789, expected: "12345-6789"},
+		{format: `0"x"0`, value: 1234, expected: "123x4"},
+		{format: `yyyy"年"m"月"d"日"`, value: 37947.75, expected: "2003年11月22日"},
+		{format: `yyyy\-mm\-dd`, value: 37947.75, expected: "2003-11-22"},
+		{format: `"Date: "yyyy-mm-dd`, value: 37947.75, expected: "Date: 2003-11-22"},
+		{format: `[$-409]mmmm\ d\,\ yyyy`, value: 37947.75, expected: "November 22, 2003"},
+		{format: `hh:mm\ "Uhr"`, value: 37947.75, expected: "18:00 Uhr"},
+	}
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Literals")
+		c.Assert(err, qt.IsNil)
+		for _, testCase := range testCases {
+			got, err := FormatValue(testCase.format, testCase.value, false)
+			c.Check(err, qt.IsNil, qt.Commentf("%s", testCase.format))
+			c.Check(got, qt.Equals, testCase.expected, qt.Commentf("%s", testCase.format))
+			sheet.AddRow().AddCell().SetFloatWithFormat(testCase.value, testCase.format)
+		}
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		sheet.Close()
+
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for i, testCase := range testCases {
+			cell, err := f.Sheets[0].Cell(i, 0)
+			c.Assert(err, qt.IsNil)
+			c.Check(cell.GetNumberFormat(), qt.Equals, testCase.format)
+			got, err := cell.FormattedValue()
+			c.Check(err, qt.IsNil, qt.Commentf("%s", testCase.format))
+			c.Check(got, qt.Equals, testCase.expected, qt.Commentf("%s", testCase.format))
+		}
+	})
+}
+
+func TestTwelveHourTimes(t *testing.T) {
+	c := qt.New(t)
+	// 0.2507523148148148 is 6:01:05 in the morning.
+	testCases := []struct {
+		format   string
+		value    float64
+		expected string
+	}{
+		{"h:mm AM/PM", 0, "12:00 AM"},
+		{"h:mm AM/PM", 0.5, "12:00 PM"},
+		{"h:mm AM/PM", 0.75, "6:00 PM"},
+		{"hh:mm AM/PM", 0.2507523148148148, "06:01 AM"},
+		{"h:mm am/pm", 0.75, "6:00 pm"},
+		{"h:mm Am/Pm", 0.75, "6:00 PM"},
+		{"h:mm aM/pM", 0.75, "6:00 pm"},
+		{"h:mm A/P", 0.2507523148148148, "6:01 A"},
+		{"h:mm a/p", 0.75, "6:00 p"},
+		{"d/m/yy h:mm a/p", 1.5, "31/12/99 12:00 p"},
+		{"h:mm:ss.0 AM/PM", 0.75, "6:00:00.0 PM"},
+		// Without an indicator, the hours are on a 24-hour clock, and
+		// h, m and s have no leading zero.
+		{"h:mm", 0.2507523148148148, "6:01"},
+		{"h:m:s", 0.2507523148148148, "6:1:5"},
+		{"h:m:s", 0, "0:0:0"},
+		{"hh:mm:ss", 0.75, "18:00:00"},
+		// Elapsed hours aren't put on a 12-hour clock.
+		{"[h]:mm AM/PM", 0.75, "18:00 PM"},
+		{"[h]:mm:ss", 1.5, "36:00:00"},
+	}
+	for _, testCase := range testCases {
+		got, err := FormatValue(testCase.format, testCase.value, false)
+		c.Check(err, qt.IsNil, qt.Commentf("%s", testCase.format))
+		c.Check(got, qt.Equals, testCase.expected, qt.Commentf("%s %v", testCase.format, testCase.value))
+	}
+
+	layout, ok := ToGoTimeLayout("h:mm Am/Pm")
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(layout, qt.Equals, "3:04 PM")
+	_, ok = ToGoTimeLayout("h:mm A/P")
+	c.Assert(ok, qt.IsFalse)
+}
@@ -0,0 +1,242 @@
+package xlsx
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseLocaleBracket interprets the text inside the brackets of a
+// currency or locale annotation in a number format, such as "$€-407",
+// "$-409", "$€-x-euro2" or "$USD".  It returns the currency symbol,
+// which may be empty, and the locale identifier (LCID), which is zero
+// if there isn't one or it isn't a hexadecimal number, as with the
+// "x-euro2" style of locale.  It returns false if inner isn't an
+// annotation of this kind.
+func parseLocaleBracket(inner string) (symbol string, lcid uint32, ok bool) {
+	if !strings.HasPrefix(inner, "$") {
+		return "", 0, false
+	}
+	inner = inner[1:]
+	dash := strings.IndexByte(inner, '-')
+	if dash < 0 {
+		return inner, 0, true
+	}
+	symbol, locale := inner[:dash], inner[dash+1:]
+	if n, err := strconv.ParseUint(locale, 16, 32); err == nil {
+		lcid = uint32(n)
+	}
+	return symbol, lcid, true
+}
+
+// dateNames are the names of the months and days of the week in a
+// language.
+type dateNames struct {
+	months      [12]string
+	shortMonths [12]string
+	days        [7]string
+	shortDays   [7]string
+}
+
+var englishDateNames = &dateNames{
+	months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	shortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+	days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+	shortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+}
+
+// localeDateNames are the names that Excel uses for the languages it
+// knows here, keyed by the primary language of an LCID, which is its
+// lowest 10 bits.  The month and day names of any other locale are in
+// English.
+var localeDateNames = map[uint32]*dateNames{
+	// German
+	0x07: {
+		months:      [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		shortMonths: [12]string{"Jan", "Feb", "Mrz", "Apr", "Mai", "Jun", "Jul", "Aug", "Sep", "Okt", "Nov", "Dez"},
+		days:        [7]string{"Sonntag", "Montag", "Dienstag", "Mittwoch", "Donnerstag", "Freitag", "Samstag"},
+		shortDays:   [7]string{"So", "Mo", "Di", "Mi", "Do", "Fr", "Sa"},
+	},
+	// English
+	0x09: englishDateNames,
+	// Spanish
+	0x0A: {
+		months:      [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		shortMonths: [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"},
+		days:        [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+	// French
+	0x0C: {
+		months:      [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		shortMonths: [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		days:        [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		shortDays:   [7]string{"dim.", "lun.", "mar.", "mer.", "jeu.", "ven.", "sam."},
+	},
+	// Italian
+	0x10: {
+		months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		shortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		shortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	},
+	// Japanese
+	0x11: {
+		months:      [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		shortMonths: [12]string{"1月", "2月", "3月", "4月", "5月", "6月", "7月", "8月", "9月", "10月", "11月", "12月"},
+		days:        [7]string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"},
+		shortDays:   [7]string{"日", "月", "火", "水", "木", "金", "土"},
+	},
+}
+
+// namesForLCID returns the month and day names for a locale, or the
+// English ones if there are none for it.
+func namesForLCID(lcid uint32) *dateNames {
+	if names, ok := localeDateNames[lcid&0x3FF]; ok {
+		return names
+	}
+	return englishDateNames
+}
+
+// The placeholders that parseTime puts in a Go time layout, for the
+// parts of a date that time.Format can't produce: names, which are
+// looked up in dateNames, and literal text, which might otherwise be
+// taken for part of the layout.  They are characters from Unicode's
+// private use area, which time.Format copies as they are.
+const (
+	placeholderMonth rune = 0xE000 + iota
+	placeholderShortMonth
+	placeholderDay
+	placeholderShortDay
+	// placeholderHour is the hour of a 24-hour clock, without the
+	// leading zero that the layout 15 gives it.
+	placeholderHour
+	// The AM/PM and A/P indicators, in capitals and in lower case.
+	placeholderAMPM
+	placeholderAMPMLower
+	placeholderAP
+	placeholderAPLower
+	// placeholderLiteral is the first of the placeholders for literal
+	// text.  The nth piece of literal text is placeholderLiteral+n.
+	placeholderLiteral rune = 0xE100
+)
+
+// protectTimeLiterals replaces the quoted text in a time format, and
+// the currency symbols of locale annotations, with placeholders, and
+// returns the text that each placeholder stands for.  The other bracketed parts of a format, such as colours, are removed,
+// except for elapsed time units such as [h].  It also returns the LCID
+// of the last locale annotation in the format, or zero.
+func protectTimeLiterals(format string) (string, []string, uint32) {
+	var b strings.Builder
+	var literals []string
+	var lcid uint32
+	literal := func(text string) {
+		if text == "" {
+			return
+		}
+		b.WriteRune(placeholderLiteral + rune(len(literals)))
+		literals = append(literals, text)
+	}
+	runes := []rune(format)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '"':
+			end, err := skipToRune(runes[i:], '"')
+			if err != nil {
+				literal(string(runes[i+1:]))
+				i = len(runes)
+				continue
+			}
+			literal(string(runes[i+1 : i+end]))
+			i += end
+		case '\\':
+			// A backslash escapes the character after it, which is shown as it is.
+			if i+1 < len(runes) {
+				literal(string(runes[i+1]))
+				i++
+			}
+		case '_':
+			// Padding is a space, as in number formats.
+			if i+1 < len(runes) {
+				literal(" ")
+				i++
+			}
+		case '*':
+			// Fill characters have no width here.
+			i++
+		case '[':
+			end, err := skipToRune(runes[i:], ']')
+			if err != nil {
+				b.WriteRune(runes[i])
+				continue
+			}
+			inner := string(runes[i+1 : i+end])
+			if symbol, id, ok := parseLocaleBracket(inner); ok {
+				literal(symbol)
+				if id != 0 {
+					lcid = id
+				}
+			} else if strings.Trim(strings.ToLower(inner), "hms") == "" {
+				b.WriteString(string(runes[i : i+end+1]))
+			}
+			i += end
+		default:
+			b.WriteRune(runes[i])
+		}
+	}
+	return b.String(), literals, lcid
+}
+
+// replaceEraTokens replaces the Japanese era of a time format, whose
+// literal text has been protected, with the Gregorian year, as eras
+// can't be shown here.  The era name (g, gg or ggg) is dropped and the
+// year of the era (e or ee) becomes the year (yyyy), so that
+// "ggge"年"m"月"d"日"" shows 2020年1月1日 rather than 令和2年1月1日.
+func replaceEraTokens(format string) string {
+	if !strings.ContainsAny(format, "ge") {
+		return format
+	}
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		switch format[i] {
+		case 'g':
+		case 'e':
+			for i+1 < len(format) && format[i+1] == 'e' {
+				i++
+			}
+			b.WriteString("yyyy")
+		default:
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+// restoreTimePlaceholders replaces the placeholders in the text of a
+// formatted time with the names and literal text that they stand for.
+func restoreTimePlaceholders(text string, t time.Time, names *dateNames, literals []string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == placeholderMonth:
+			b.WriteString(names.months[t.Month()-1])
+		case r == placeholderShortMonth:
+			b.WriteString(names.shortMonths[t.Month()-1])
+		case r == placeholderDay:
+			b.WriteString(names.days[t.Weekday()])
+		case r == placeholderShortDay:
+			b.WriteString(names.shortDays[t.Weekday()])
+		case r == placeholderHour:
+			b.WriteString(strconv.Itoa(t.Hour()))
+		case r >= placeholderAMPM && r <= placeholderAPLower:
+			upper := r == placeholderAMPM || r == placeholderAP
+			short := r == placeholderAP || r == placeholderAPLower
+			b.WriteString(amPmMarker(t.Hour(), upper, short))
+		case r >= placeholderLiteral && int(r-placeholderLiteral) < len(literals):
+			b.WriteString(literals[r-placeholderLiteral])
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
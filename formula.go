@@ -0,0 +1,792 @@
+package xlsx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// formulaTokenKind identifies the kind of a formulaToken.
+type formulaTokenKind int
+
+const (
+	formulaTokenWhitespace formulaTokenKind = iota
+	formulaTokenNumber
+	formulaTokenString
+	formulaTokenBool
+	formulaTokenError
+	// formulaTokenReference is a cell or range reference, including
+	// its sheet name if it has one, e.g. "'My Sheet'!$A$1:B2".
+	formulaTokenReference
+	// formulaTokenStructuredRef is a structured reference to a table,
+	// e.g. "Table1[[#All],[Amount]]" or "[@Amount]", including its
+	// sheet name if it has one.  It isn't a formulaTokenReference, so
+	// rewriting the A1 references of a formula leaves it alone.
+	formulaTokenStructuredRef
+	// formulaTokenName is any other name, such as a defined name.
+	formulaTokenName
+	// formulaTokenFunction is the name of a function.  The opening
+	// parenthesis that follows it is a token of its own.
+	formulaTokenFunction
+	formulaTokenOperator
+	formulaTokenOpenParen
+	formulaTokenCloseParen
+	formulaTokenSeparator
+)
+
+// formulaToken is a single token of a formula.  The text of the tokens
+// of a formula, joined together, is the formula exactly as it was
+// written, so formulas can be changed token by token and put back
+// together without disturbing the rest.
+type formulaToken struct {
+	kind formulaTokenKind
+	text string
+}
+
+// formulaErrorValues are the error values that can be written in a
+// formula.
+var formulaErrorValues = []string{"#NULL!", "#DIV/0!", "#VALUE!", "#REF!", "#NAME?", "#NUM!", "#N/A", "#GETTING_DATA"}
+
+// tokenizeFormula splits a formula, without its leading "=", into
+// tokens.
+func tokenizeFormula(formula string) ([]formulaToken, error) {
+	var tokens []formulaToken
+	for pos := 0; pos < len(formula); {
+		kind, n, err := scanFormulaToken(formula[pos:])
+		if err != nil {
+			return nil, fmt.Errorf("formula %q: %w at position %d", formula, err, pos)
+		}
+		tokens = append(tokens, formulaToken{kind: kind, text: formula[pos : pos+n]})
+		pos += n
+	}
+	return tokens, nil
+}
+
+// joinFormulaTokens puts a formula back together from its tokens.
+func joinFormulaTokens(tokens []formulaToken) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString(token.text)
+	}
+	return b.String()
+}
+
+// scanFormulaToken returns the kind and length of the token at the
+// start of s.
+func scanFormulaToken(s string) (formulaTokenKind, int, error) {
+	c := s[0]
+	switch {
+	case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		n := 1
+		for n < len(s) && strings.IndexByte(" \t\r\n", s[n]) >= 0 {
+			n++
+		}
+		return formulaTokenWhitespace, n, nil
+	case c == '"':
+		n, ok := scanQuoted(s, '"')
+		if !ok {
+			return 0, 0, errors.New("unterminated string")
+		}
+		return formulaTokenString, n, nil
+	case c == '#':
+		for _, e := range formulaErrorValues {
+			if len(s) >= len(e) && strings.EqualFold(s[:len(e)], e) {
+				return formulaTokenError, len(e), nil
+			}
+		}
+		return 0, 0, errors.New("unknown error value")
+	case c == '\'':
+		n, ok := scanQuoted(s, '\'')
+		if !ok || n >= len(s) || s[n] != '!' {
+			return 0, 0, errors.New("invalid sheet name")
+		}
+		kind, m, err := scanSheetReference(s[n+1:])
+		return kind, n + 1 + m, err
+	case c == '[':
+		if n := scanExternalPrefix(s); n > 0 {
+			kind, m, err := scanExternalReference(s[n:])
+			return kind, n + m, err
+		}
+		n, err := scanStructuredRef(s)
+		return formulaTokenStructuredRef, n, err
+	case isDigit(c) || c == '.':
+		if n := scanRowRange(s); n > 0 {
+			return formulaTokenReference, n, nil
+		}
+		return formulaTokenNumber, scanNumber(s), nil
+	case isNameStart(c):
+		n := 1
+		for n < len(s) && isNameChar(s[n]) {
+			n++
+		}
+		if n < len(s) && s[n] == '!' {
+			kind, m, err := scanSheetReference(s[n+1:])
+			return kind, n + 1 + m, err
+		}
+		if m := scan3DSheets(s); m > 0 {
+			kind, k, err := scanSheetReference(s[m:])
+			return kind, m + k, err
+		}
+		if n < len(s) && s[n] == '[' {
+			n, err := scanStructuredRef(s)
+			return formulaTokenStructuredRef, n, err
+		}
+		if n < len(s) && s[n] == '(' {
+			return formulaTokenFunction, n, nil
+		}
+		if word := s[:n]; strings.EqualFold(word, "TRUE") || strings.EqualFold(word, "FALSE") {
+			return formulaTokenBool, n, nil
+		}
+		if m := scanReference(s); m >= n {
+			return formulaTokenReference, m, nil
+		}
+		return formulaTokenName, n, nil
+	case c == '(':
+		return formulaTokenOpenParen, 1, nil
+	case c == ')':
+		return formulaTokenCloseParen, 1, nil
+	case c == ',':
+		return formulaTokenSeparator, 1, nil
+	}
+	for _, op := range []string{"<>", "<=", ">=", "+", "-", "*", "/", "^", "&", "=", "<", ">", "%"} {
+		if strings.HasPrefix(s, op) {
+			return formulaTokenOperator, len(op), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unexpected %q", c)
+}
+
+// scanQuoted returns the length of the quoted text at the start of s,
+// in which the quote character is escaped by doubling it.
+func scanQuoted(s string, quote byte) (int, bool) {
+	for n := 1; n < len(s); n++ {
+		if s[n] != quote {
+			continue
+		}
+		if n+1 < len(s) && s[n+1] == quote {
+			n++
+			continue
+		}
+		return n + 1, true
+	}
+	return 0, false
+}
+
+// scan3DSheets returns the length of the unquoted range of sheets,
+// such as "Sheet1:Sheet3", with the "!" after it, at the start of s, or
+// 0 if there isn't one.  A reference after it, as in
+// "SUM(Sheet1:Sheet3!A1)", is to the same cells on each of the sheets.
+func scan3DSheets(s string) int {
+	n := 0
+	for n < len(s) && isNameChar(s[n]) {
+		n++
+	}
+	if n == 0 || n >= len(s) || s[n] != ':' {
+		return 0
+	}
+	m := n + 1
+	for m < len(s) && isNameChar(s[m]) {
+		m++
+	}
+	if m == n+1 || m >= len(s) || s[m] != '!' {
+		return 0
+	}
+	return m + 1
+}
+
+// scanExternalPrefix returns the length of the bracketed workbook,
+// such as "[1]", at the start of s that makes a reference after it one
+// to another workbook, or 0 if s doesn't start with one.
+func scanExternalPrefix(s string) int {
+	end := strings.IndexAny(s[1:], "[]")
+	if end <= 0 || s[1+end] != ']' {
+		return 0
+	}
+	n := end + 2
+	if n < len(s) && (s[n] == '!' || isNameStart(s[n])) {
+		return n
+	}
+	return 0
+}
+
+// scanExternalReference returns the kind and length of the reference
+// that follows the bracketed workbook of a reference to another
+// workbook: a sheet, or range of sheets, and a reference on it, or a
+// "!" and a name defined in the workbook.
+func scanExternalReference(s string) (formulaTokenKind, int, error) {
+	if strings.HasPrefix(s, "!") {
+		n := 1
+		for n < len(s) && isNameChar(s[n]) {
+			n++
+		}
+		if n == 1 {
+			return 0, 0, errors.New("invalid name")
+		}
+		return formulaTokenName, n, nil
+	}
+	n := scan3DSheets(s)
+	if n == 0 {
+		for n < len(s) && isNameChar(s[n]) {
+			n++
+		}
+		if n >= len(s) || s[n] != '!' {
+			return 0, 0, errors.New("invalid reference to another workbook")
+		}
+		n++
+	}
+	kind, m, err := scanSheetReference(s[n:])
+	return kind, n + m, err
+}
+
+// scanSheetReference returns the kind and length of the reference
+// that follows the "!" after a sheet name.
+func scanSheetReference(s string) (formulaTokenKind, int, error) {
+	if n := scanReference(s); n > 0 {
+		return formulaTokenReference, n, nil
+	}
+	n := 0
+	for n < len(s) && isNameChar(s[n]) {
+		n++
+	}
+	if n > 0 && n < len(s) && s[n] == '[' {
+		n, err := scanStructuredRef(s)
+		return formulaTokenStructuredRef, n, err
+	}
+	return 0, 0, errors.New("invalid reference")
+}
+
+// scanStructuredRef returns the length of the structured reference,
+// with or without its table name, at the start of s.  Within the
+// brackets an apostrophe escapes the character after it, so a column
+// name can contain brackets.
+func scanStructuredRef(s string) (int, error) {
+	n := 0
+	for n < len(s) && isNameChar(s[n]) {
+		n++
+	}
+	depth := 0
+	for ; n < len(s); n++ {
+		switch s[n] {
+		case '\'':
+			if depth > 0 {
+				n++
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return n + 1, nil
+			}
+		}
+	}
+	return 0, errors.New("unterminated structured reference")
+}
+
+// scanNumber returns the length of the number at the start of s.
+func scanNumber(s string) int {
+	n := 0
+	for n < len(s) && (isDigit(s[n]) || s[n] == '.') {
+		n++
+	}
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		m := n + 1
+		if m < len(s) && (s[m] == '+' || s[m] == '-') {
+			m++
+		}
+		if m < len(s) && isDigit(s[m]) {
+			for m < len(s) && isDigit(s[m]) {
+				m++
+			}
+			n = m
+		}
+	}
+	return n
+}
+
+// scanReference returns the length of the cell or range reference at
+// the start of s, without a sheet name, or 0 if there isn't one.
+func scanReference(s string) int {
+	if n := scanCellRef(s); n > 0 {
+		if n < len(s) && s[n] == ':' {
+			if m := scanCellRef(s[n+1:]); m > 0 {
+				return n + 1 + m
+			}
+		}
+		return n
+	}
+	if n := scanColumnRef(s); n > 0 && n < len(s) && s[n] == ':' {
+		if m := scanColumnRef(s[n+1:]); m > 0 {
+			return n + 1 + m
+		}
+	}
+	return scanRowRange(s)
+}
+
+// scanCellRef returns the length of the reference to a single cell,
+// such as "B2" or "$B$2", at the start of s.
+func scanCellRef(s string) int {
+	n := scanColumnLetters(s)
+	if n == 0 {
+		return 0
+	}
+	m := scanRowDigits(s[n:])
+	if m == 0 {
+		return 0
+	}
+	n += m
+	if n < len(s) && (isNameChar(s[n]) || s[n] == '(' || s[n] == '[') {
+		return 0
+	}
+	return n
+}
+
+// scanColumnRef returns the length of the column, such as "B" or
+// "$B", at the start of s, which must not be followed by anything that
+// would make it part of a longer name.
+func scanColumnRef(s string) int {
+	n := scanColumnLetters(s)
+	if n == 0 || (n < len(s) && (isNameChar(s[n]) || s[n] == '(' || s[n] == '[')) {
+		return 0
+	}
+	return n
+}
+
+// scanRowRange returns the length of a range of whole rows, such as
+// "1:3" or "$1:$3", at the start of s.
+func scanRowRange(s string) int {
+	n := scanRowDigits(s)
+	if n == 0 || n >= len(s) || s[n] != ':' {
+		return 0
+	}
+	m := scanRowDigits(s[n+1:])
+	if m == 0 {
+		return 0
+	}
+	n += 1 + m
+	if n < len(s) && (isNameChar(s[n]) || s[n] == '(' || s[n] == '[') {
+		return 0
+	}
+	return n
+}
+
+// scanColumnLetters returns the length of an optionally fixed column
+// name of one to three letters at the start of s.
+func scanColumnLetters(s string) int {
+	n := 0
+	if n < len(s) && s[n] == '$' {
+		n++
+	}
+	start := n
+	for n < len(s) && n-start < 3 && isLetter(s[n]) {
+		n++
+	}
+	if n == start || (n < len(s) && isLetter(s[n])) {
+		return 0
+	}
+	return n
+}
+
+// scanRowDigits returns the length of an optionally fixed row number
+// at the start of s.
+func scanRowDigits(s string) int {
+	n := 0
+	if n < len(s) && s[n] == '$' {
+		n++
+	}
+	start := n
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	if n == start || s[start] == '0' {
+		return 0
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z')
+}
+
+func isNameStart(c byte) bool {
+	return isLetter(c) || c == '_' || c == '\\' || c == '$'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || isDigit(c) || c == '.' || c == '?'
+}
+
+// formulaRef is a parsed cell or range reference.  Whole columns have
+// a firstRow and lastRow of -1, and whole rows a firstCol and lastCol
+// of -1.
+type formulaRef struct {
+	// sheet is the name of the sheet, or empty for the sheet that
+	// the formula is on.
+	sheet    string
+	firstCol int
+	firstRow int
+	lastCol  int
+	lastRow  int
+}
+
+// parseFormulaRef parses the text of a formulaTokenReference.
+func parseFormulaRef(text string) (formulaRef, error) {
+	ref := formulaRef{}
+	if strings.HasPrefix(text, "'") {
+		n, _ := scanQuoted(text, '\'')
+		ref.sheet = strings.Replace(text[1:n-1], "''", "'", -1)
+		text = text[n+1:]
+	} else if i := strings.IndexByte(text, '!'); i >= 0 {
+		ref.sheet = text[:i]
+		text = text[i+1:]
+	}
+	text = strings.Replace(text, "$", "", -1)
+	first, last := text, text
+	if i := strings.IndexByte(text, ':'); i >= 0 {
+		first, last = text[:i], text[i+1:]
+	}
+	var err error
+	switch {
+	case isDigit(first[0]):
+		ref.firstCol, ref.lastCol = -1, -1
+		if ref.firstRow, err = strconv.Atoi(first); err != nil {
+			return ref, err
+		}
+		if ref.lastRow, err = strconv.Atoi(last); err != nil {
+			return ref, err
+		}
+		ref.firstRow--
+		ref.lastRow--
+	case !isDigit(first[len(first)-1]):
+		ref.firstRow, ref.lastRow = -1, -1
+		ref.firstCol = ColLettersToIndex(first)
+		ref.lastCol = ColLettersToIndex(last)
+	default:
+		if ref.firstCol, ref.firstRow, err = GetCoordsFromCellIDString(first); err != nil {
+			return ref, err
+		}
+		if ref.lastCol, ref.lastRow, err = GetCoordsFromCellIDString(last); err != nil {
+			return ref, err
+		}
+	}
+	if ref.firstRow > ref.lastRow {
+		ref.firstRow, ref.lastRow = ref.lastRow, ref.firstRow
+	}
+	if ref.firstCol > ref.lastCol {
+		ref.firstCol, ref.lastCol = ref.lastCol, ref.firstCol
+	}
+	return ref, nil
+}
+
+// formulaRefSheet returns the sheet name that the text of a
+// formulaTokenReference or formulaTokenStructuredRef starts with, and
+// the length of the name, with its quotes and the "!" that follows
+// it.  The length is 0 if the reference has no sheet name.
+func formulaRefSheet(text string) (string, int) {
+	if strings.HasPrefix(text, "'") {
+		n, _ := scanQuoted(text, '\'')
+		return strings.Replace(text[1:n-1], "''", "'", -1), n + 1
+	}
+	// A "!" within the brackets of a structured reference isn't the
+	// end of a sheet name.
+	if i := strings.IndexAny(text, "!["); i >= 0 && text[i] == '!' {
+		return text[:i], i + 1
+	}
+	return "", 0
+}
+
+// quoteSheetName returns name quoted, as it is written before the "!"
+// of a reference to a cell on the sheet.
+func quoteSheetName(name string) string {
+	return "'" + strings.Replace(name, "'", "''", -1) + "'"
+}
+
+// renameFormulaSheet returns formula, with or without its leading "=",
+// with its references to cells on the sheet oldName changed to refer
+// to newName.  Either end of a 3D reference, such as
+// "SUM(Old:Other!A1)", is changed if it is oldName.  References to
+// other workbooks, such as "[1]Old!A1", are left alone, as they are to
+// sheets of those workbooks.  Sheet names are matched regardless of
+// case, as Excel does.  Everything else in the formula is left exactly
+// as it was written.
+func renameFormulaSheet(formula, oldName, newName string) (string, error) {
+	body := strings.TrimPrefix(formula, "=")
+	tokens, err := tokenizeFormula(body)
+	if err != nil {
+		return formula, err
+	}
+	changed := false
+	for i, token := range tokens {
+		if token.kind != formulaTokenReference && token.kind != formulaTokenStructuredRef {
+			continue
+		}
+		sheet, n := formulaRefSheet(token.text)
+		// Sheet names can't have brackets in them, so a sheet name
+		// that does is that of another workbook.
+		if n == 0 || strings.ContainsAny(sheet, "[]") {
+			continue
+		}
+		sheets := strings.SplitN(sheet, ":", 2)
+		renamed := false
+		for j := range sheets {
+			if strings.EqualFold(sheets[j], oldName) {
+				sheets[j] = newName
+				renamed = true
+			}
+		}
+		if !renamed {
+			continue
+		}
+		tokens[i].text = quoteSheetName(strings.Join(sheets, ":")) + "!" + token.text[n:]
+		changed = true
+	}
+	if !changed {
+		return formula, nil
+	}
+	return formula[:len(formula)-len(body)] + joinFormulaTokens(tokens), nil
+}
+
+// formulaNode is a node of a parsed formula.
+type formulaNode interface{}
+
+type (
+	formulaLiteralNode struct {
+		value CellValue
+	}
+	formulaRefNode struct {
+		ref formulaRef
+	}
+	formulaStructuredRefNode struct {
+		ref structuredRef
+	}
+	formulaNameNode struct {
+		name string
+	}
+	formulaUnaryNode struct {
+		op      string
+		operand formulaNode
+	}
+	formulaPercentNode struct {
+		operand formulaNode
+	}
+	formulaBinaryNode struct {
+		op          string
+		left, right formulaNode
+	}
+	// formulaCallNode is a function call.  An argument that is left
+	// empty, as in IF(A1,,1), is a nil formulaNode.
+	formulaCallNode struct {
+		name string
+		args []formulaNode
+	}
+)
+
+// formulaParser builds the tree of formulaNodes for a formula.
+type formulaParser struct {
+	tokens []formulaToken
+	pos    int
+}
+
+// parseFormula parses a formula, with or without its leading "=".
+func parseFormula(formula string) (formulaNode, error) {
+	tokens, err := tokenizeFormula(strings.TrimPrefix(formula, "="))
+	if err != nil {
+		return nil, err
+	}
+	p := &formulaParser{}
+	for _, token := range tokens {
+		if token.kind != formulaTokenWhitespace {
+			p.tokens = append(p.tokens, token)
+		}
+	}
+	if len(p.tokens) == 0 {
+		return nil, fmt.Errorf("formula %q is empty", formula)
+	}
+	node, err := p.parseComparison()
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("formula %q: %w", formula, err)
+	}
+	return node, nil
+}
+
+// peek returns the next token, or a zero formulaToken at the end.
+func (p *formulaParser) peek() formulaToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return formulaToken{}
+}
+
+// acceptOperator consumes the next token and returns its text if it
+// is one of the operators in ops.
+func (p *formulaParser) acceptOperator(ops ...string) (string, bool) {
+	token := p.peek()
+	if token.kind != formulaTokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if token.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// binary parses a left associative sequence of operands produced by
+// next, joined by any of ops.
+func (p *formulaParser) binary(next func() (formulaNode, error), ops ...string) (formulaNode, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.acceptOperator(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &formulaBinaryNode{op: op, left: left, right: right}
+	}
+}
+
+// The operators, from the lowest precedence to the highest, are
+// comparison, concatenation, addition, multiplication, exponentiation,
+// percent and negation.
+func (p *formulaParser) parseComparison() (formulaNode, error) {
+	return p.binary(p.parseConcatenation, "=", "<>", "<", ">", "<=", ">=")
+}
+
+func (p *formulaParser) parseConcatenation() (formulaNode, error) {
+	return p.binary(p.parseAdditive, "&")
+}
+
+func (p *formulaParser) parseAdditive() (formulaNode, error) {
+	return p.binary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *formulaParser) parseMultiplicative() (formulaNode, error) {
+	return p.binary(p.parseExponent, "*", "/")
+}
+
+func (p *formulaParser) parseExponent() (formulaNode, error) {
+	return p.binary(p.parsePercent, "^")
+}
+
+func (p *formulaParser) parsePercent() (formulaNode, error) {
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.acceptOperator("%"); !ok {
+			return node, nil
+		}
+		node = &formulaPercentNode{operand: node}
+	}
+}
+
+func (p *formulaParser) parseUnary() (formulaNode, error) {
+	if op, ok := p.acceptOperator("-", "+"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &formulaUnaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *formulaParser) parsePrimary() (formulaNode, error) {
+	token := p.peek()
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of formula")
+	}
+	p.pos++
+	switch token.kind {
+	case formulaTokenNumber:
+		n, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token.text)
+		}
+		return &formulaLiteralNode{value: numberValue(n)}, nil
+	case formulaTokenString:
+		s := strings.Replace(token.text[1:len(token.text)-1], `""`, `"`, -1)
+		return &formulaLiteralNode{value: stringValue(s)}, nil
+	case formulaTokenBool:
+		return &formulaLiteralNode{value: boolValue(strings.EqualFold(token.text, "TRUE"))}, nil
+	case formulaTokenError:
+		return &formulaLiteralNode{value: errorValue(strings.ToUpper(token.text))}, nil
+	case formulaTokenReference:
+		ref, err := parseFormulaRef(token.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reference %q: %w", token.text, err)
+		}
+		return &formulaRefNode{ref: ref}, nil
+	case formulaTokenStructuredRef:
+		ref, err := parseStructuredRef(token.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reference %q: %w", token.text, err)
+		}
+		return &formulaStructuredRefNode{ref: ref}, nil
+	case formulaTokenName:
+		return &formulaNameNode{name: token.text}, nil
+	case formulaTokenFunction:
+		return p.parseCall(token.text)
+	case formulaTokenOpenParen:
+		node, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != formulaTokenCloseParen {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return node, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token.text)
+}
+
+// parseCall parses the arguments of a call to the named function.
+func (p *formulaParser) parseCall(name string) (formulaNode, error) {
+	// The function name is always followed by its parenthesis.
+	p.pos++
+	call := &formulaCallNode{name: name}
+	if p.peek().kind == formulaTokenCloseParen {
+		p.pos++
+		return call, nil
+	}
+	for {
+		var arg formulaNode
+		if kind := p.peek().kind; kind != formulaTokenSeparator && kind != formulaTokenCloseParen {
+			var err error
+			if arg, err = p.parseComparison(); err != nil {
+				return nil, err
+			}
+		}
+		call.args = append(call.args, arg)
+		switch p.peek().kind {
+		case formulaTokenSeparator:
+			p.pos++
+		case formulaTokenCloseParen:
+			p.pos++
+			return call, nil
+		default:
+			if p.pos >= len(p.tokens) {
+				return nil, fmt.Errorf("missing ) after arguments to %s", name)
+			}
+			return nil, fmt.Errorf("unexpected %q in arguments to %s", p.peek().text, name)
+		}
+	}
+}
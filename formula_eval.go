@@ -0,0 +1,591 @@
+package xlsx
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ValueType is the type of a CellValue.
+type ValueType int
+
+const (
+	// ValueBlank is the value of an empty cell.
+	ValueBlank ValueType = iota
+	ValueNumber
+	ValueString
+	ValueBool
+	// ValueError is an Excel error value, such as "#DIV/0!".
+	ValueError
+)
+
+// CellValue is a value that a formula works with, or produces.
+type CellValue struct {
+	Type   ValueType
+	Number float64
+	// String holds the text of a ValueString, or the error value of a
+	// ValueError, e.g. "#N/A".
+	String string
+	Bool   bool
+}
+
+func numberValue(n float64) CellValue {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return errorValue("#NUM!")
+	}
+	return CellValue{Type: ValueNumber, Number: n}
+}
+
+func stringValue(s string) CellValue {
+	return CellValue{Type: ValueString, String: s}
+}
+
+func boolValue(b bool) CellValue {
+	return CellValue{Type: ValueBool, Bool: b}
+}
+
+func errorValue(e string) CellValue {
+	return CellValue{Type: ValueError, String: e}
+}
+
+// Text returns the value as Excel shows it when it is used as text,
+// for example by the & operator.
+func (v CellValue) Text() string {
+	switch v.Type {
+	case ValueNumber:
+		return formatFormulaNumber(v.Number)
+	case ValueBool:
+		if v.Bool {
+			return "TRUE"
+		}
+		return "FALSE"
+	case ValueString, ValueError:
+		return v.String
+	}
+	return ""
+}
+
+// formatFormulaNumber formats n to at most 15 significant digits, as
+// Excel does when it turns a number into text.
+func formatFormulaNumber(n float64) string {
+	n, _ = strconv.ParseFloat(strconv.FormatFloat(n, 'g', 15, 64), 64)
+	if abs := math.Abs(n); n == 0 || (abs >= 1e-9 && abs < 1e15) {
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(n, 'E', -1, 64)
+}
+
+// FormulaArg is an argument passed to a FormulaFunction.
+type FormulaArg struct {
+	// Value is the value of the argument.  For a reference to a
+	// single cell it is the value of the cell, and for a larger range
+	// it is #VALUE!, as the range can't be used as a single value.
+	Value CellValue
+	// Range holds the values of the cells, row by row, when the
+	// argument is a reference.  It is nil for any other argument.
+	Range [][]CellValue
+}
+
+// values returns the values of the argument; the values of all of the
+// cells if it is a reference.
+func (a FormulaArg) values() []CellValue {
+	if a.Range == nil {
+		return []CellValue{a.Value}
+	}
+	var values []CellValue
+	for _, row := range a.Range {
+		values = append(values, row...)
+	}
+	return values
+}
+
+// FormulaFunction implements a function that can be called from a
+// formula.  Error values, such as #DIV/0!, should be returned as a
+// CellValue; a non-nil error stops the evaluation of the formula.
+type FormulaFunction func(args []FormulaArg) (CellValue, error)
+
+// ErrUnsupportedFunction is returned by Cell.Evaluate when a formula
+// calls a function that isn't available.
+type ErrUnsupportedFunction struct {
+	Name string
+}
+
+func (e ErrUnsupportedFunction) Error() string {
+	return fmt.Sprintf("unsupported function %s", e.Name)
+}
+
+// ErrCircularReference is returned by Cell.Evaluate when a formula
+// depends on its own value.
+var ErrCircularReference = errors.New("circular reference")
+
+// ErrEvaluationLimit is returned by Cell.Evaluate when evaluating a
+// formula would exceed EvalContext.MaxDepth or EvalContext.MaxSteps.
+var ErrEvaluationLimit = errors.New("formula evaluation limit exceeded")
+
+const (
+	// DefaultMaxEvalDepth is the EvalContext.MaxDepth that is used
+	// when none is given.
+	DefaultMaxEvalDepth = 1000
+	// DefaultMaxEvalSteps is the EvalContext.MaxSteps that is used
+	// when none is given.
+	DefaultMaxEvalSteps = 1000000
+)
+
+// EvalContext controls how Cell.Evaluate evaluates formulas.  The zero
+// value is ready to use.
+type EvalContext struct {
+	// Functions holds functions to make available in addition to,
+	// or in place of, those registered with RegisterFunction.  The
+	// names must be upper case.
+	Functions map[string]FormulaFunction
+	// MaxDepth limits how deeply formulas are evaluated in cells
+	// that are referred to by other formulas.
+	MaxDepth int
+	// MaxSteps limits the total number of operations, function
+	// calls and cell values that are evaluated.
+	MaxSteps int
+}
+
+// Evaluate calculates the value of the Cell's formula.  Any cells that
+// it refers to are read from the Cell's File, and those that contain
+// formulas are evaluated in turn, rather than relying on the results
+// cached in the file.  A Cell without a formula evaluates to its own
+// value.
+//
+// Formulas can use arithmetic, comparison and & operators, references
+// to cells and ranges on any sheet of the File, and the functions
+// registered with RegisterFunction or given in ctx.Functions.  Calling
+// any other function returns an ErrUnsupportedFunction.
+func (c *Cell) Evaluate(ctx EvalContext) (CellValue, error) {
+	if ctx.MaxDepth <= 0 {
+		ctx.MaxDepth = DefaultMaxEvalDepth
+	}
+	if ctx.MaxSteps <= 0 {
+		ctx.MaxSteps = DefaultMaxEvalSteps
+	}
+	e := &formulaEvaluator{
+		ctx:      ctx,
+		visiting: make(map[formulaCellKey]bool),
+		results:  make(map[formulaCellKey]CellValue),
+	}
+	if c.formula == "" {
+		return cellLiteralValue(c), nil
+	}
+	var sheet *Sheet
+	if c.Row != nil {
+		sheet = c.Row.Sheet
+	}
+	key := formulaCellKey{sheet: sheet, row: -1, col: -1}
+	if sheet != nil {
+		key.col, key.row = c.GetCoordinates()
+	}
+	v, err := e.evalCellFormula(key, c.formula)
+	if err != nil {
+		return CellValue{}, fmt.Errorf("Cell.Evaluate: %w", err)
+	}
+	return v, nil
+}
+
+// cellLiteralValue returns the value held in a cell, ignoring any
+// formula.
+func cellLiteralValue(c *Cell) CellValue {
+	switch c.cellType {
+	case CellTypeBool:
+		return boolValue(c.Value == "1")
+	case CellTypeError:
+		return errorValue(c.Value)
+	case CellTypeNumeric, CellTypeDate:
+		if c.Value == "" {
+			return CellValue{}
+		}
+		if n, err := strconv.ParseFloat(c.Value, 64); err == nil {
+			return numberValue(n)
+		}
+	}
+	if c.RichText != nil {
+		var text strings.Builder
+		for _, run := range c.RichText {
+			text.WriteString(run.Text)
+		}
+		return stringValue(text.String())
+	}
+	if c.Value == "" {
+		return CellValue{}
+	}
+	return stringValue(c.Value)
+}
+
+// formulaCellKey identifies a cell whilst formulas are evaluated.
+type formulaCellKey struct {
+	sheet    *Sheet
+	row, col int
+}
+
+// formulaEvaluator holds the state of a single call to Evaluate.
+type formulaEvaluator struct {
+	ctx      EvalContext
+	depth    int
+	steps    int
+	visiting map[formulaCellKey]bool
+	// results caches the values of the formulas in the cells that
+	// have been evaluated, as many formulas can refer to each.
+	results map[formulaCellKey]CellValue
+}
+
+// step counts an operation against EvalContext.MaxSteps.
+func (e *formulaEvaluator) step() error {
+	e.steps++
+	if e.steps > e.ctx.MaxSteps {
+		return fmt.Errorf("%w: more than %d steps", ErrEvaluationLimit, e.ctx.MaxSteps)
+	}
+	return nil
+}
+
+// evalCellFormula evaluates the formula of the cell identified by key.
+func (e *formulaEvaluator) evalCellFormula(key formulaCellKey, formula string) (CellValue, error) {
+	if v, ok := e.results[key]; ok {
+		return v, nil
+	}
+	ref := GetCellIDStringFromCoords(key.col, key.row)
+	if key.sheet != nil {
+		ref = key.sheet.Name + "!" + ref
+	}
+	if e.visiting[key] {
+		return CellValue{}, fmt.Errorf("%w at %s", ErrCircularReference, ref)
+	}
+	if e.depth >= e.ctx.MaxDepth {
+		return CellValue{}, fmt.Errorf("%w: formulas nested more than %d deep at %s", ErrEvaluationLimit, e.ctx.MaxDepth, ref)
+	}
+	node, err := parseFormula(formula)
+	if err != nil {
+		return CellValue{}, err
+	}
+	e.visiting[key] = true
+	e.depth++
+	arg, err := e.eval(node, key.sheet)
+	e.depth--
+	delete(e.visiting, key)
+	if err != nil {
+		return CellValue{}, err
+	}
+	v := arg.Value
+	// A formula that refers to an empty cell shows 0.
+	if v.Type == ValueBlank {
+		v = numberValue(0)
+	}
+	if key.sheet != nil {
+		e.results[key] = v
+	}
+	return v, nil
+}
+
+// eval evaluates a node of a formula on the given sheet.
+func (e *formulaEvaluator) eval(node formulaNode, sheet *Sheet) (FormulaArg, error) {
+	if err := e.step(); err != nil {
+		return FormulaArg{}, err
+	}
+	switch n := node.(type) {
+	case nil:
+		// An empty function argument.
+		return FormulaArg{}, nil
+	case *formulaLiteralNode:
+		return FormulaArg{Value: n.value}, nil
+	case *formulaNameNode:
+		return FormulaArg{Value: errorValue("#NAME?")}, nil
+	case *formulaRefNode:
+		return e.evalRef(n.ref, sheet)
+	case *formulaStructuredRefNode:
+		// There are no tables to resolve a structured reference
+		// against, so, as in Excel, it refers to nothing.
+		return FormulaArg{Value: errorValue("#REF!")}, nil
+	case *formulaUnaryNode:
+		operand, err := e.eval(n.operand, sheet)
+		if err != nil {
+			return FormulaArg{}, err
+		}
+		x, errv, ok := asNumber(operand.Value)
+		if !ok {
+			return FormulaArg{Value: errv}, nil
+		}
+		if n.op == "-" {
+			x = -x
+		}
+		return FormulaArg{Value: numberValue(x)}, nil
+	case *formulaPercentNode:
+		operand, err := e.eval(n.operand, sheet)
+		if err != nil {
+			return FormulaArg{}, err
+		}
+		x, errv, ok := asNumber(operand.Value)
+		if !ok {
+			return FormulaArg{Value: errv}, nil
+		}
+		return FormulaArg{Value: numberValue(x / 100)}, nil
+	case *formulaBinaryNode:
+		left, err := e.eval(n.left, sheet)
+		if err != nil {
+			return FormulaArg{}, err
+		}
+		right, err := e.eval(n.right, sheet)
+		if err != nil {
+			return FormulaArg{}, err
+		}
+		return FormulaArg{Value: evalBinary(n.op, left.Value, right.Value)}, nil
+	case *formulaCallNode:
+		return e.evalCall(n, sheet)
+	}
+	return FormulaArg{}, fmt.Errorf("unknown formula node %T", node)
+}
+
+// evalRef reads the values of the cells that ref refers to.
+func (e *formulaEvaluator) evalRef(ref formulaRef, sheet *Sheet) (FormulaArg, error) {
+	if ref.sheet != "" {
+		if sheet == nil || sheet.File == nil {
+			return FormulaArg{Value: errorValue("#REF!")}, nil
+		}
+		var ok bool
+		if sheet, ok = sheet.File.Sheet[ref.sheet]; !ok {
+			return FormulaArg{Value: errorValue("#REF!")}, nil
+		}
+	}
+	if sheet == nil {
+		return FormulaArg{}, errors.New("cell references can only be evaluated in a cell that belongs to a sheet")
+	}
+	// Whole rows and columns only extend as far as the sheet does.
+	if ref.firstRow < 0 {
+		ref.firstRow, ref.lastRow = 0, sheet.MaxRow-1
+	}
+	if ref.firstCol < 0 {
+		ref.firstCol, ref.lastCol = 0, sheet.MaxCol-1
+	}
+	// Reading other rows replaces the sheet's current row, so store it
+	// first, as AddRow does, to keep any changes made to it.
+	if sheet.currentRow != nil {
+		if err := sheet.cellStore.WriteRow(sheet.currentRow); err != nil {
+			return FormulaArg{}, err
+		}
+	}
+	arg := FormulaArg{Range: [][]CellValue{}}
+	for y := ref.firstRow; y <= ref.lastRow; y++ {
+		values := make([]CellValue, 0, ref.lastCol-ref.firstCol+1)
+		for x := ref.firstCol; x <= ref.lastCol; x++ {
+			v, err := e.cellValue(sheet, y, x)
+			if err != nil {
+				return FormulaArg{}, err
+			}
+			values = append(values, v)
+		}
+		arg.Range = append(arg.Range, values)
+	}
+	if len(arg.Range) == 1 && len(arg.Range[0]) == 1 {
+		arg.Value = arg.Range[0][0]
+	} else {
+		arg.Value = errorValue("#VALUE!")
+	}
+	return arg, nil
+}
+
+// cellValue returns the value of a cell, evaluating its formula if it
+// has one.  Cells beyond the end of the sheet are empty.
+func (e *formulaEvaluator) cellValue(sheet *Sheet, row, col int) (CellValue, error) {
+	if err := e.step(); err != nil {
+		return CellValue{}, err
+	}
+	if row >= sheet.MaxRow {
+		return CellValue{}, nil
+	}
+	r, err := sheet.Row(row)
+	if err != nil {
+		return CellValue{}, err
+	}
+	if col >= r.cellStoreRow.CellCount() {
+		return CellValue{}, nil
+	}
+	cell := r.GetCell(col)
+	if cell.formula == "" {
+		return cellLiteralValue(cell), nil
+	}
+	return e.evalCellFormula(formulaCellKey{sheet: sheet, row: row, col: col}, cell.formula)
+}
+
+// evalCall calls a function with its evaluated arguments.
+func (e *formulaEvaluator) evalCall(call *formulaCallNode, sheet *Sheet) (FormulaArg, error) {
+	name := strings.ToUpper(call.name)
+	// Functions added to Excel since 2007 are written with a prefix.
+	for _, prefix := range []string{"_XLFN.", "_XLWS."} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	fn, ok := e.ctx.Functions[name]
+	if !ok {
+		if fn, ok = lookupFunction(name); !ok {
+			return FormulaArg{}, ErrUnsupportedFunction{Name: name}
+		}
+	}
+	args := make([]FormulaArg, len(call.args))
+	for i, node := range call.args {
+		arg, err := e.eval(node, sheet)
+		if err != nil {
+			return FormulaArg{}, err
+		}
+		args[i] = arg
+	}
+	v, err := fn(args)
+	if err != nil {
+		return FormulaArg{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return FormulaArg{Value: v}, nil
+}
+
+// asNumber converts v to a number, as Excel does for arithmetic.  If v
+// can't be converted, the error value that results is returned with ok
+// set to false.
+func asNumber(v CellValue) (n float64, errv CellValue, ok bool) {
+	switch v.Type {
+	case ValueBlank:
+		return 0, CellValue{}, true
+	case ValueNumber:
+		return v.Number, CellValue{}, true
+	case ValueBool:
+		if v.Bool {
+			return 1, CellValue{}, true
+		}
+		return 0, CellValue{}, true
+	case ValueString:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v.String), 64)
+		if err != nil {
+			return 0, errorValue("#VALUE!"), false
+		}
+		return n, CellValue{}, true
+	}
+	return 0, v, false
+}
+
+// asBool converts v to a boolean, as Excel does for logical tests.
+func asBool(v CellValue) (b bool, errv CellValue, ok bool) {
+	switch v.Type {
+	case ValueBlank:
+		return false, CellValue{}, true
+	case ValueNumber:
+		return v.Number != 0, CellValue{}, true
+	case ValueBool:
+		return v.Bool, CellValue{}, true
+	case ValueString:
+		switch strings.ToUpper(v.String) {
+		case "TRUE":
+			return true, CellValue{}, true
+		case "FALSE":
+			return false, CellValue{}, true
+		}
+		return false, errorValue("#VALUE!"), false
+	}
+	return false, v, false
+}
+
+// evalBinary applies a binary operator to two values.
+func evalBinary(op string, left, right CellValue) CellValue {
+	if left.Type == ValueError {
+		return left
+	}
+	if right.Type == ValueError {
+		return right
+	}
+	switch op {
+	case "&":
+		return stringValue(left.Text() + right.Text())
+	case "=", "<>", "<", ">", "<=", ">=":
+		c := compareValues(left, right)
+		switch op {
+		case "=":
+			return boolValue(c == 0)
+		case "<>":
+			return boolValue(c != 0)
+		case "<":
+			return boolValue(c < 0)
+		case ">":
+			return boolValue(c > 0)
+		case "<=":
+			return boolValue(c <= 0)
+		}
+		return boolValue(c >= 0)
+	}
+	x, errv, ok := asNumber(left)
+	if !ok {
+		return errv
+	}
+	y, errv, ok := asNumber(right)
+	if !ok {
+		return errv
+	}
+	switch op {
+	case "+":
+		return numberValue(x + y)
+	case "-":
+		return numberValue(x - y)
+	case "*":
+		return numberValue(x * y)
+	case "/":
+		if y == 0 {
+			return errorValue("#DIV/0!")
+		}
+		return numberValue(x / y)
+	case "^":
+		if x == 0 && y == 0 {
+			return errorValue("#NUM!")
+		}
+		return numberValue(math.Pow(x, y))
+	}
+	return errorValue("#VALUE!")
+}
+
+// compareValues compares two values the way Excel's comparison
+// operators do: numbers sort before text, which sorts before booleans,
+// text is compared without regard to case, and an empty cell is equal
+// to 0, "" or FALSE.
+func compareValues(a, b CellValue) int {
+	if a.Type == ValueBlank {
+		a = blankAs(b.Type)
+	}
+	if b.Type == ValueBlank {
+		b = blankAs(a.Type)
+	}
+	if a.Type != b.Type {
+		order := map[ValueType]int{ValueNumber: 0, ValueString: 1, ValueBool: 2}
+		if order[a.Type] < order[b.Type] {
+			return -1
+		}
+		return 1
+	}
+	switch a.Type {
+	case ValueNumber:
+		switch {
+		case a.Number < b.Number:
+			return -1
+		case a.Number > b.Number:
+			return 1
+		}
+	case ValueString:
+		return strings.Compare(strings.ToLower(a.String), strings.ToLower(b.String))
+	case ValueBool:
+		switch {
+		case !a.Bool && b.Bool:
+			return -1
+		case a.Bool && !b.Bool:
+			return 1
+		}
+	}
+	return 0
+}
+
+// blankAs returns the value that an empty cell has when it is compared
+// with a value of type t.
+func blankAs(t ValueType) CellValue {
+	switch t {
+	case ValueString:
+		return stringValue("")
+	case ValueBool:
+		return boolValue(false)
+	}
+	return numberValue(0)
+}
@@ -0,0 +1,595 @@
+package xlsx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+var (
+	formulaFunctionsMU sync.RWMutex
+	formulaFunctions   = map[string]FormulaFunction{
+		"ABS":         mathFunction(math.Abs),
+		"AND":         fnAnd,
+		"AVERAGE":     fnAverage,
+		"CONCAT":      fnConcat,
+		"CONCATENATE": fnConcatenate,
+		"COUNT":       fnCount,
+		"COUNTA":      fnCountA,
+		"COUNTBLANK":  fnCountBlank,
+		"COUNTIF":     fnCountIf,
+		"IF":          fnIf,
+		"IFERROR":     fnIfError,
+		"INT":         mathFunction(math.Floor),
+		"ISBLANK":     isFunction(func(v CellValue) bool { return v.Type == ValueBlank }),
+		"ISERROR":     isFunction(func(v CellValue) bool { return v.Type == ValueError }),
+		"ISNA":        isFunction(func(v CellValue) bool { return v.Type == ValueError && v.String == "#N/A" }),
+		"ISNUMBER":    isFunction(func(v CellValue) bool { return v.Type == ValueNumber }),
+		"ISTEXT":      isFunction(func(v CellValue) bool { return v.Type == ValueString }),
+		"LEFT":        fnLeft,
+		"LEN":         fnLen,
+		"LOWER":       textFunction(strings.ToLower),
+		"MAX":         fnMax,
+		"MID":         fnMid,
+		"MIN":         fnMin,
+		"MOD":         fnMod,
+		"NOT":         fnNot,
+		"OR":          fnOr,
+		"POWER":       fnPower,
+		"PRODUCT":     fnProduct,
+		"RIGHT":       fnRight,
+		"ROUND":       roundFunction(math.Round),
+		"ROUNDDOWN":   roundFunction(math.Trunc),
+		"ROUNDUP":     roundFunction(roundAwayFromZero),
+		"SQRT":        fnSqrt,
+		"SUM":         fnSum,
+		"SUMIF":       fnSumIf,
+		"TRIM":        textFunction(trimSpaces),
+		"UPPER":       textFunction(strings.ToUpper),
+	}
+)
+
+// RegisterFunction makes fn available to every formula evaluated with
+// Cell.Evaluate, under the given name, replacing any function that
+// already has that name.  The name is not case sensitive.
+func RegisterFunction(name string, fn FormulaFunction) {
+	formulaFunctionsMU.Lock()
+	formulaFunctions[strings.ToUpper(name)] = fn
+	formulaFunctionsMU.Unlock()
+}
+
+// lookupFunction returns the registered function with the given upper
+// case name.
+func lookupFunction(name string) (FormulaFunction, bool) {
+	formulaFunctionsMU.RLock()
+	defer formulaFunctionsMU.RUnlock()
+	fn, ok := formulaFunctions[name]
+	return fn, ok
+}
+
+// checkArgs returns an error unless there are between min and max
+// args.  A max of -1 means any number.
+func checkArgs(args []FormulaArg, min, max int) error {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return fmt.Errorf("wrong number of arguments: %d", len(args))
+	}
+	return nil
+}
+
+// collectNumbers returns the numbers in args, following the rules of
+// SUM and similar functions: values given directly are converted to
+// numbers, whilst text, booleans and empty cells in references are
+// ignored.  Any error value is returned with ok set to false.
+func collectNumbers(args []FormulaArg) (numbers []float64, errv CellValue, ok bool) {
+	for _, arg := range args {
+		if arg.Range == nil {
+			if arg.Value.Type == ValueBlank {
+				continue
+			}
+			n, errv, ok := asNumber(arg.Value)
+			if !ok {
+				return nil, errv, false
+			}
+			numbers = append(numbers, n)
+			continue
+		}
+		for _, v := range arg.values() {
+			switch v.Type {
+			case ValueNumber:
+				numbers = append(numbers, v.Number)
+			case ValueError:
+				return nil, v, false
+			}
+		}
+	}
+	return numbers, CellValue{}, true
+}
+
+// numberArgs converts each of args to a number, as the arguments of
+// functions like ROUND and MOD are.
+func numberArgs(args []FormulaArg) (numbers []float64, errv CellValue, ok bool) {
+	numbers = make([]float64, len(args))
+	for i, arg := range args {
+		if numbers[i], errv, ok = asNumber(arg.Value); !ok {
+			return nil, errv, false
+		}
+	}
+	return numbers, CellValue{}, true
+}
+
+func fnSum(args []FormulaArg) (CellValue, error) {
+	numbers, errv, ok := collectNumbers(args)
+	if !ok {
+		return errv, nil
+	}
+	var sum float64
+	for _, n := range numbers {
+		sum += n
+	}
+	return numberValue(sum), nil
+}
+
+func fnProduct(args []FormulaArg) (CellValue, error) {
+	numbers, errv, ok := collectNumbers(args)
+	if !ok {
+		return errv, nil
+	}
+	if len(numbers) == 0 {
+		return numberValue(0), nil
+	}
+	product := 1.0
+	for _, n := range numbers {
+		product *= n
+	}
+	return numberValue(product), nil
+}
+
+func fnAverage(args []FormulaArg) (CellValue, error) {
+	numbers, errv, ok := collectNumbers(args)
+	if !ok {
+		return errv, nil
+	}
+	if len(numbers) == 0 {
+		return errorValue("#DIV/0!"), nil
+	}
+	var sum float64
+	for _, n := range numbers {
+		sum += n
+	}
+	return numberValue(sum / float64(len(numbers))), nil
+}
+
+func fnMin(args []FormulaArg) (CellValue, error) {
+	return extreme(args, func(a, b float64) bool { return a < b })
+}
+
+func fnMax(args []FormulaArg) (CellValue, error) {
+	return extreme(args, func(a, b float64) bool { return a > b })
+}
+
+// extreme returns the number in args for which better is true when
+// it is compared with every other, or 0 if there are no numbers.
+func extreme(args []FormulaArg, better func(a, b float64) bool) (CellValue, error) {
+	numbers, errv, ok := collectNumbers(args)
+	if !ok {
+		return errv, nil
+	}
+	if len(numbers) == 0 {
+		return numberValue(0), nil
+	}
+	result := numbers[0]
+	for _, n := range numbers[1:] {
+		if better(n, result) {
+			result = n
+		}
+	}
+	return numberValue(result), nil
+}
+
+func fnCount(args []FormulaArg) (CellValue, error) {
+	var count int
+	for _, arg := range args {
+		if arg.Range == nil {
+			if _, _, ok := asNumber(arg.Value); ok && arg.Value.Type != ValueBlank {
+				count++
+			}
+			continue
+		}
+		for _, v := range arg.values() {
+			if v.Type == ValueNumber {
+				count++
+			}
+		}
+	}
+	return numberValue(float64(count)), nil
+}
+
+func fnCountA(args []FormulaArg) (CellValue, error) {
+	var count int
+	for _, arg := range args {
+		for _, v := range arg.values() {
+			if v.Type != ValueBlank {
+				count++
+			}
+		}
+	}
+	return numberValue(float64(count)), nil
+}
+
+func fnCountBlank(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return CellValue{}, err
+	}
+	var count int
+	for _, v := range args[0].values() {
+		if v.Type == ValueBlank || (v.Type == ValueString && v.String == "") {
+			count++
+		}
+	}
+	return numberValue(float64(count)), nil
+}
+
+// formulaCriteria is a parsed criteria argument of COUNTIF or SUMIF,
+// such as ">=10" or "apples".
+type formulaCriteria struct {
+	op    string
+	value CellValue
+}
+
+func parseFormulaCriteria(v CellValue) formulaCriteria {
+	if v.Type != ValueString {
+		return formulaCriteria{op: "=", value: v}
+	}
+	c := formulaCriteria{op: "="}
+	s := v.String
+	for _, op := range []string{"<>", "<=", ">=", "=", "<", ">"} {
+		if strings.HasPrefix(s, op) {
+			c.op = op
+			s = s[len(op):]
+			break
+		}
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		c.value = numberValue(n)
+	} else {
+		c.value = stringValue(s)
+	}
+	return c
+}
+
+// matches returns true if v meets the criteria.  As in Excel, a
+// number only matches a numeric criteria, and text only a textual one.
+func (c formulaCriteria) matches(v CellValue) bool {
+	if c.value.Type == ValueString && c.value.String == "" {
+		empty := v.Type == ValueBlank || (v.Type == ValueString && v.String == "")
+		return empty == (c.op == "=")
+	}
+	if v.Type != c.value.Type {
+		return c.op == "<>"
+	}
+	r := evalBinary(c.op, v, c.value)
+	return r.Type == ValueBool && r.Bool
+}
+
+func fnCountIf(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return CellValue{}, err
+	}
+	criteria := parseFormulaCriteria(args[1].Value)
+	var count int
+	for _, v := range args[0].values() {
+		if criteria.matches(v) {
+			count++
+		}
+	}
+	return numberValue(float64(count)), nil
+}
+
+func fnSumIf(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return CellValue{}, err
+	}
+	criteria := parseFormulaCriteria(args[1].Value)
+	values := args[0].values()
+	sumValues := values
+	if len(args) == 3 {
+		sumValues = args[2].values()
+	}
+	var sum float64
+	for i, v := range values {
+		if i >= len(sumValues) || !criteria.matches(v) {
+			continue
+		}
+		switch s := sumValues[i]; s.Type {
+		case ValueNumber:
+			sum += s.Number
+		case ValueError:
+			return s, nil
+		}
+	}
+	return numberValue(sum), nil
+}
+
+// mathFunction makes a FormulaFunction of a function of one number.
+func mathFunction(f func(float64) float64) FormulaFunction {
+	return func(args []FormulaArg) (CellValue, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return CellValue{}, err
+		}
+		x, errv, ok := asNumber(args[0].Value)
+		if !ok {
+			return errv, nil
+		}
+		return numberValue(f(x)), nil
+	}
+}
+
+func roundAwayFromZero(x float64) float64 {
+	if x < 0 {
+		return math.Floor(x)
+	}
+	return math.Ceil(x)
+}
+
+// roundFunction makes a FormulaFunction that rounds a number to a
+// number of digits using round, which rounds to a whole number.
+func roundFunction(round func(float64) float64) FormulaFunction {
+	return func(args []FormulaArg) (CellValue, error) {
+		if err := checkArgs(args, 2, 2); err != nil {
+			return CellValue{}, err
+		}
+		numbers, errv, ok := numberArgs(args)
+		if !ok {
+			return errv, nil
+		}
+		scale := math.Pow(10, math.Trunc(numbers[1]))
+		// Excel works to 15 significant digits, so 2.675 rounds up to
+		// 2.68 even though it's held as 2.67499999...
+		scaled, _ := strconv.ParseFloat(strconv.FormatFloat(numbers[0]*scale, 'g', 15, 64), 64)
+		return numberValue(round(scaled) / scale), nil
+	}
+}
+
+func fnMod(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return CellValue{}, err
+	}
+	numbers, errv, ok := numberArgs(args)
+	if !ok {
+		return errv, nil
+	}
+	n, d := numbers[0], numbers[1]
+	if d == 0 {
+		return errorValue("#DIV/0!"), nil
+	}
+	// The result has the sign of the divisor.
+	return numberValue(n - d*math.Floor(n/d)), nil
+}
+
+func fnPower(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return CellValue{}, err
+	}
+	return evalBinary("^", args[0].Value, args[1].Value), nil
+}
+
+func fnSqrt(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return CellValue{}, err
+	}
+	x, errv, ok := asNumber(args[0].Value)
+	if !ok {
+		return errv, nil
+	}
+	if x < 0 {
+		return errorValue("#NUM!"), nil
+	}
+	return numberValue(math.Sqrt(x)), nil
+}
+
+func fnIf(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 1, 3); err != nil {
+		return CellValue{}, err
+	}
+	test, errv, ok := asBool(args[0].Value)
+	if !ok {
+		return errv, nil
+	}
+	switch {
+	case test && len(args) >= 2:
+		return args[1].Value, nil
+	case test:
+		return boolValue(true), nil
+	case len(args) == 3:
+		return args[2].Value, nil
+	}
+	return boolValue(false), nil
+}
+
+func fnIfError(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return CellValue{}, err
+	}
+	if args[0].Value.Type == ValueError {
+		return args[1].Value, nil
+	}
+	return args[0].Value, nil
+}
+
+// logical applies the logic of AND and OR, which combine every
+// boolean, number and text "TRUE" or "FALSE" in their arguments.
+func logical(args []FormulaArg, and bool) (CellValue, error) {
+	if err := checkArgs(args, 1, -1); err != nil {
+		return CellValue{}, err
+	}
+	result, seen := and, false
+	for _, arg := range args {
+		for _, v := range arg.values() {
+			if arg.Range != nil && (v.Type == ValueString || v.Type == ValueBlank) {
+				continue
+			}
+			b, errv, ok := asBool(v)
+			if !ok {
+				return errv, nil
+			}
+			seen = true
+			if and {
+				result = result && b
+			} else {
+				result = result || b
+			}
+		}
+	}
+	if !seen {
+		return errorValue("#VALUE!"), nil
+	}
+	return boolValue(result), nil
+}
+
+func fnAnd(args []FormulaArg) (CellValue, error) {
+	return logical(args, true)
+}
+
+func fnOr(args []FormulaArg) (CellValue, error) {
+	return logical(args, false)
+}
+
+func fnNot(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return CellValue{}, err
+	}
+	b, errv, ok := asBool(args[0].Value)
+	if !ok {
+		return errv, nil
+	}
+	return boolValue(!b), nil
+}
+
+// isFunction makes a FormulaFunction, like ISBLANK, that tests the
+// type of its argument.
+func isFunction(test func(CellValue) bool) FormulaFunction {
+	return func(args []FormulaArg) (CellValue, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return CellValue{}, err
+		}
+		return boolValue(test(args[0].Value)), nil
+	}
+}
+
+func fnConcat(args []FormulaArg) (CellValue, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		for _, v := range arg.values() {
+			if v.Type == ValueError {
+				return v, nil
+			}
+			b.WriteString(v.Text())
+		}
+	}
+	return stringValue(b.String()), nil
+}
+
+func fnConcatenate(args []FormulaArg) (CellValue, error) {
+	var b strings.Builder
+	for _, arg := range args {
+		if arg.Value.Type == ValueError {
+			return arg.Value, nil
+		}
+		b.WriteString(arg.Value.Text())
+	}
+	return stringValue(b.String()), nil
+}
+
+// textFunction makes a FormulaFunction of a function of one string.
+func textFunction(f func(string) string) FormulaFunction {
+	return func(args []FormulaArg) (CellValue, error) {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return CellValue{}, err
+		}
+		if args[0].Value.Type == ValueError {
+			return args[0].Value, nil
+		}
+		return stringValue(f(args[0].Value.Text())), nil
+	}
+}
+
+// trimSpaces removes spaces from the ends of s, and reduces each run
+// of spaces within it to one, as TRIM does.
+func trimSpaces(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == ' ' }), " ")
+}
+
+func fnLen(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return CellValue{}, err
+	}
+	if args[0].Value.Type == ValueError {
+		return args[0].Value, nil
+	}
+	return numberValue(float64(utf8.RuneCountInString(args[0].Value.Text()))), nil
+}
+
+// substring returns count characters of the text of v, starting from
+// the zero based start, or a #VALUE! error if either is negative.
+func substring(v CellValue, start, count float64) CellValue {
+	if v.Type == ValueError {
+		return v
+	}
+	if start < 0 || count < 0 {
+		return errorValue("#VALUE!")
+	}
+	runes := []rune(v.Text())
+	first := int(math.Min(start, float64(len(runes))))
+	last := int(math.Min(start+math.Trunc(count), float64(len(runes))))
+	return stringValue(string(runes[first:last]))
+}
+
+// textAndCount returns the arguments of LEFT and RIGHT, in which the
+// number of characters defaults to 1.
+func textAndCount(args []FormulaArg) (v CellValue, count float64, errv CellValue, ok bool) {
+	if len(args) == 1 {
+		return args[0].Value, 1, CellValue{}, true
+	}
+	count, errv, ok = asNumber(args[1].Value)
+	return args[0].Value, count, errv, ok
+}
+
+func fnLeft(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return CellValue{}, err
+	}
+	v, count, errv, ok := textAndCount(args)
+	if !ok {
+		return errv, nil
+	}
+	return substring(v, 0, count), nil
+}
+
+func fnRight(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return CellValue{}, err
+	}
+	v, count, errv, ok := textAndCount(args)
+	if !ok {
+		return errv, nil
+	}
+	length := float64(utf8.RuneCountInString(v.Text()))
+	return substring(v, math.Max(length-math.Trunc(count), 0), count), nil
+}
+
+func fnMid(args []FormulaArg) (CellValue, error) {
+	if err := checkArgs(args, 3, 3); err != nil {
+		return CellValue{}, err
+	}
+	numbers, errv, ok := numberArgs(args[1:])
+	if !ok {
+		return errv, nil
+	}
+	if numbers[0] < 1 {
+		return errorValue("#VALUE!"), nil
+	}
+	return substring(args[0].Value, math.Trunc(numbers[0])-1, numbers[1]), nil
+}
@@ -0,0 +1,277 @@
+package xlsx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// structuredRefItems are the special items that a structured reference
+// can select, in addition to its columns.
+var structuredRefItems = []string{"#All", "#Data", "#Headers", "#Totals", "#This Row"}
+
+// structuredRef is a parsed structured reference, such as
+// "Table1[[#Headers],[Amount]:[Total]]" or "[@Amount]".
+type structuredRef struct {
+	// prefix is the sheet name and "!" that the reference was
+	// qualified with, as it was written, or empty.
+	prefix string
+	// table is the name of the table, or empty for a reference that
+	// is written inside the table it refers to.
+	table string
+	// thisRow is set when the reference was written with the "@"
+	// shorthand for the [#This Row] item.
+	thisRow bool
+	// items are the special items, such as "#All", as they were
+	// written.
+	items []string
+	// columns holds no columns, one column, or the first and last
+	// column of a range of columns.  The names are unescaped.
+	columns []string
+	// nested is set when the items and columns are each written in
+	// brackets of their own, as in "Table1[[Amount]]" rather than
+	// "Table1[Amount]".
+	nested bool
+}
+
+// parseStructuredRef parses the text of a formulaTokenStructuredRef.
+func parseStructuredRef(text string) (structuredRef, error) {
+	ref := structuredRef{}
+	if strings.HasPrefix(text, "'") {
+		n, _ := scanQuoted(text, '\'')
+		ref.prefix = text[:n+1]
+		text = text[n+1:]
+	} else if i := strings.IndexByte(text, '!'); i >= 0 && i < strings.IndexByte(text, '[') {
+		ref.prefix = text[:i+1]
+		text = text[i+1:]
+	}
+	i := strings.IndexByte(text, '[')
+	ref.table = text[:i]
+	body := text[i+1 : len(text)-1]
+	if strings.HasPrefix(body, "@") {
+		ref.thisRow = true
+		body = body[1:]
+	}
+	switch {
+	case body == "":
+	case body[0] == '[':
+		ref.nested = true
+		if err := ref.parseSpecifiers(body); err != nil {
+			return ref, err
+		}
+	case body[0] == '#' && !ref.thisRow:
+		item, err := structuredRefItem(body)
+		if err != nil {
+			return ref, err
+		}
+		ref.items = []string{item}
+	default:
+		ref.columns = []string{unescapeStructuredRefName(body)}
+	}
+	return ref, nil
+}
+
+// parseSpecifiers parses a list of bracketed items and columns, such
+// as "[#Headers],[Amount]:[Total]".
+func (ref *structuredRef) parseSpecifiers(body string) error {
+	expectColumn := false
+	for body != "" {
+		body = strings.TrimLeft(body, " ")
+		if body == "" || body[0] != '[' {
+			return errors.New("expected [")
+		}
+		n, err := scanStructuredRef(body)
+		if err != nil {
+			return err
+		}
+		spec := body[1 : n-1]
+		body = strings.TrimLeft(body[n:], " ")
+		switch {
+		case strings.HasPrefix(spec, "#"):
+			if expectColumn {
+				return fmt.Errorf("expected a column after :, not %q", spec)
+			}
+			item, err := structuredRefItem(spec)
+			if err != nil {
+				return err
+			}
+			ref.items = append(ref.items, item)
+		case expectColumn:
+			ref.columns = append(ref.columns, unescapeStructuredRefName(spec))
+			expectColumn = false
+		case len(ref.columns) > 0:
+			return errors.New("more than one column specifier")
+		default:
+			ref.columns = append(ref.columns, unescapeStructuredRefName(spec))
+			if strings.HasPrefix(body, ":") {
+				expectColumn = true
+				body = body[1:]
+				continue
+			}
+		}
+		if strings.HasPrefix(body, ",") {
+			body = body[1:]
+		} else if body != "" {
+			return fmt.Errorf("unexpected %q", body)
+		}
+	}
+	if expectColumn {
+		return errors.New("missing the column after :")
+	}
+	return nil
+}
+
+// structuredRefItem checks that spec is one of the special items, in
+// any case, and returns it as it was written.
+func structuredRefItem(spec string) (string, error) {
+	for _, item := range structuredRefItems {
+		if strings.EqualFold(spec, item) {
+			return spec, nil
+		}
+	}
+	return "", fmt.Errorf("unknown item %q", spec)
+}
+
+// unescapeStructuredRefName removes the apostrophes that escape the
+// special characters of a column name.
+func unescapeStructuredRefName(name string) string {
+	if strings.IndexByte(name, '\'') < 0 {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\'' && i+1 < len(name) {
+			i++
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// escapeStructuredRefName escapes the characters of a column name that
+// have a meaning of their own in a structured reference.
+func escapeStructuredRefName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if strings.IndexByte("[]#'", name[i]) >= 0 {
+			b.WriteByte('\'')
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// structuredRefNeedsBrackets reports whether a column name has to be
+// written in brackets of its own.  The characters that are escaped with
+// an apostrophe don't need them, but a name after the "@" can't even
+// contain a space.
+func structuredRefNeedsBrackets(name string, thisRow bool) bool {
+	if thisRow && strings.ContainsAny(name, " \t") {
+		return true
+	}
+	return name == "" || strings.ContainsAny(name, "\n,:.\"{}$^&*+=-<>/")
+}
+
+// String returns the text of the structured reference.
+func (ref structuredRef) String() string {
+	var b strings.Builder
+	b.WriteString(ref.prefix)
+	b.WriteString(ref.table)
+	b.WriteByte('[')
+	if ref.thisRow {
+		b.WriteByte('@')
+	}
+	nested := ref.nested || len(ref.items)+len(ref.columns) > 1 ||
+		(len(ref.columns) == 1 && structuredRefNeedsBrackets(ref.columns[0], ref.thisRow))
+	if !nested {
+		for _, item := range ref.items {
+			b.WriteString(item)
+		}
+		for _, column := range ref.columns {
+			b.WriteString(escapeStructuredRefName(column))
+		}
+		b.WriteByte(']')
+		return b.String()
+	}
+	specs := make([]string, 0, len(ref.items)+1)
+	for _, item := range ref.items {
+		specs = append(specs, "["+item+"]")
+	}
+	columns := make([]string, len(ref.columns))
+	for i, column := range ref.columns {
+		columns[i] = "[" + escapeStructuredRefName(column) + "]"
+	}
+	if len(columns) > 0 {
+		specs = append(specs, strings.Join(columns, ":"))
+	}
+	b.WriteString(strings.Join(specs, ","))
+	b.WriteByte(']')
+	return b.String()
+}
+
+// rewriteStructuredRefs calls rewrite with the text of each structured
+// reference in formula, and the reference parsed, and replaces the ones
+// for which it returns true with the text it returns.  Everything else
+// in the formula is left exactly as it was written.
+func rewriteStructuredRefs(formula string, rewrite func(text string, ref structuredRef) (string, bool)) (string, error) {
+	body := strings.TrimPrefix(formula, "=")
+	tokens, err := tokenizeFormula(body)
+	if err != nil {
+		return formula, err
+	}
+	changed := false
+	for i, token := range tokens {
+		if token.kind != formulaTokenStructuredRef {
+			continue
+		}
+		ref, err := parseStructuredRef(token.text)
+		if err != nil {
+			return formula, fmt.Errorf("formula %q: invalid reference %q: %w", formula, token.text, err)
+		}
+		if text, ok := rewrite(token.text, ref); ok {
+			tokens[i].text = text
+			changed = true
+		}
+	}
+	if !changed {
+		return formula, nil
+	}
+	return formula[:len(formula)-len(body)] + joinFormulaTokens(tokens), nil
+}
+
+// renameFormulaTable returns formula with its structured references to
+// the table oldName changed to refer to newName.  Table names are
+// matched regardless of case, as Excel does.
+func renameFormulaTable(formula, oldName, newName string) (string, error) {
+	return rewriteStructuredRefs(formula, func(text string, ref structuredRef) (string, bool) {
+		if ref.table == "" || !strings.EqualFold(ref.table, oldName) {
+			return "", false
+		}
+		return ref.prefix + newName + text[len(ref.prefix)+len(ref.table):], true
+	})
+}
+
+// renameFormulaTableColumn returns formula with its structured
+// references to the column oldName of table changed to refer to
+// newName.  hostTable is the name of the table that the formula is in,
+// which references without a table name, such as "[@Amount]", refer
+// to, or empty if the formula isn't in a table.
+func renameFormulaTableColumn(formula, hostTable, table, oldName, newName string) (string, error) {
+	return rewriteStructuredRefs(formula, func(text string, ref structuredRef) (string, bool) {
+		refTable := ref.table
+		if refTable == "" {
+			refTable = hostTable
+		}
+		if refTable == "" || !strings.EqualFold(refTable, table) {
+			return "", false
+		}
+		changed := false
+		for i, column := range ref.columns {
+			if strings.EqualFold(column, oldName) {
+				ref.columns[i] = newName
+				changed = true
+			}
+		}
+		return ref.String(), changed
+	})
+}
@@ -0,0 +1,137 @@
+package xlsx
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseStructuredRef(t *testing.T) {
+	c := qt.New(t)
+
+	// parsed has the fields of a structuredRef, exported so that
+	// they can be compared.
+	type parsed struct {
+		Prefix, Table   string
+		ThisRow, Nested bool
+		Items, Columns  []string
+	}
+	cases := []struct {
+		text     string
+		expected parsed
+	}{
+		{"Table1[]", parsed{Table: "Table1"}},
+		{"Table1[Amount]", parsed{Table: "Table1", Columns: []string{"Amount"}}},
+		{"Table1[#Totals]", parsed{Table: "Table1", Items: []string{"#Totals"}}},
+		{"Table1[[#All],[Amount]]", parsed{Table: "Table1", Items: []string{"#All"}, Columns: []string{"Amount"}, Nested: true}},
+		{
+			"Table1[[#Headers],[#Data],[Unit Price]:[Total]]",
+			parsed{Table: "Table1", Items: []string{"#Headers", "#Data"}, Columns: []string{"Unit Price", "Total"}, Nested: true},
+		},
+		{"Table1[[#this row],[Amount]]", parsed{Table: "Table1", Items: []string{"#this row"}, Columns: []string{"Amount"}, Nested: true}},
+		{"Table1[Item '[Old']]", parsed{Table: "Table1", Columns: []string{"Item [Old]"}}},
+		{"Table1[[Rate '#2]]", parsed{Table: "Table1", Columns: []string{"Rate #2"}, Nested: true}},
+		{"Table1[It''s]", parsed{Table: "Table1", Columns: []string{"It's"}}},
+		{"[@]", parsed{ThisRow: true}},
+		{"[@Amount]", parsed{ThisRow: true, Columns: []string{"Amount"}}},
+		{"Table1[@[Unit Price]]", parsed{Table: "Table1", ThisRow: true, Columns: []string{"Unit Price"}, Nested: true}},
+		{"[@[Unit Price]:[Total]]", parsed{ThisRow: true, Columns: []string{"Unit Price", "Total"}, Nested: true}},
+		{"Sheet1!Table1[Amount]", parsed{Prefix: "Sheet1!", Table: "Table1", Columns: []string{"Amount"}}},
+		{"'It''s!'!Table1[Amount]", parsed{Prefix: "'It''s!'!", Table: "Table1", Columns: []string{"Amount"}}},
+	}
+	for _, tc := range cases {
+		ref, err := parseStructuredRef(tc.text)
+		c.Assert(err, qt.IsNil, qt.Commentf(tc.text))
+		c.Assert(parsed{
+			Prefix:  ref.prefix,
+			Table:   ref.table,
+			ThisRow: ref.thisRow,
+			Nested:  ref.nested,
+			Items:   ref.items,
+			Columns: ref.columns,
+		}, qt.DeepEquals, tc.expected, qt.Commentf(tc.text))
+		c.Assert(ref.String(), qt.Equals, tc.text, qt.Commentf(tc.text))
+	}
+
+	c.Run("Spaces", func(c *qt.C) {
+		ref, err := parseStructuredRef("Table1[[#Headers], [Amount] : [Total]]")
+		c.Assert(err, qt.IsNil)
+		c.Assert(ref.String(), qt.Equals, "Table1[[#Headers],[Amount]:[Total]]")
+	})
+
+	for _, text := range []string{
+		"Table1[#Everything]",
+		"Table1[[Amount],[Total]]",
+		"Table1[[Amount]:[#All]]",
+		"Table1[[Amount]:]",
+		"Table1[[Amount] x]",
+	} {
+		_, err := parseStructuredRef(text)
+		c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(text))
+	}
+}
+
+func TestRenameFormulaTable(t *testing.T) {
+	c := qt.New(t)
+
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"=SUM(Sales[Amount])", "=SUM(Revenue[Amount])"},
+		{"SUM(sales[[#All], [Amount]])/Sales[@Amount]", "SUM(Revenue[[#All], [Amount]])/Revenue[@Amount]"},
+		{"'My Data'!Sales[Amount]+Sheet1!Sales[#Totals]", "'My Data'!Revenue[Amount]+Sheet1!Revenue[#Totals]"},
+		// Other tables, the table's own unqualified references, names
+		// and strings are left alone.
+		{`SalesTax[Amount]+[@Amount]+Sales+"Sales[Amount]"`, `SalesTax[Amount]+[@Amount]+Sales+"Sales[Amount]"`},
+	}
+	for _, tc := range cases {
+		formula, err := renameFormulaTable(tc.formula, "Sales", "Revenue")
+		c.Assert(err, qt.IsNil, qt.Commentf(tc.formula))
+		c.Assert(formula, qt.Equals, tc.expected, qt.Commentf(tc.formula))
+	}
+
+	_, err := renameFormulaTable("Sales[[#Nothing]]", "Sales", "Revenue")
+	c.Assert(err, qt.ErrorMatches, `formula "Sales\[\[#Nothing\]\]": invalid reference .*`)
+}
+
+func TestRenameFormulaTableColumn(t *testing.T) {
+	c := qt.New(t)
+
+	cases := []struct {
+		formula   string
+		hostTable string
+		expected  string
+	}{
+		{"=SUM(Sales[Amount])", "", "=SUM(Sales[Net Amount])"},
+		{"Sales[[#All],[amount]]", "", "Sales[[#All],[Net Amount]]"},
+		{"SUM(Sales[[Price]:[Amount]])", "", "SUM(Sales[[Price]:[Net Amount]])"},
+		// "@" can't be followed by a name with a space in it.
+		{"[@Amount]*2", "Sales", "[@[Net Amount]]*2"},
+		{"Sales[@Amount]", "", "Sales[@[Net Amount]]"},
+		// Unqualified references belong to the table that the formula
+		// is in.
+		{"[@Amount]*2", "Other", "[@Amount]*2"},
+		{"[@Amount]*2", "", "[@Amount]*2"},
+		{"Other[Amount]+Sales[Price]", "Sales", "Other[Amount]+Sales[Price]"},
+		// The A1 reference and the rest of the formula are untouched.
+		{`IF( A1 > 0, Sales[[#This Row],[Amount]], "Amount" )`, "", `IF( A1 > 0, Sales[[#This Row],[Net Amount]], "Amount" )`},
+	}
+	for _, tc := range cases {
+		formula, err := renameFormulaTableColumn(tc.formula, tc.hostTable, "Sales", "Amount", "Net Amount")
+		c.Assert(err, qt.IsNil, qt.Commentf(tc.formula))
+		c.Assert(formula, qt.Equals, tc.expected, qt.Commentf(tc.formula))
+	}
+
+	c.Run("Escaping", func(c *qt.C) {
+		formula, err := renameFormulaTableColumn("Sales[Item '[Old']]", "", "Sales", "Item [Old]", "Item #1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(formula, qt.Equals, "Sales[Item '#1]")
+		formula, err = renameFormulaTableColumn(formula, "", "Sales", "Item #1", "Item: 1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(formula, qt.Equals, "Sales[[Item: 1]]")
+		formula, err = renameFormulaTableColumn(formula, "", "Sales", "Item: 1", "Item")
+		c.Assert(err, qt.IsNil)
+		c.Assert(formula, qt.Equals, "Sales[[Item]]")
+	})
+}
@@ -0,0 +1,336 @@
+package xlsx
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestTokenizeFormula(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Lossless", func(c *qt.C) {
+		formulas := []string{
+			`SUM(A1:B2)`,
+			`=  IF( $A$1 >= 10 , "a ""quoted"" string", #N/A )`,
+			`'My Sheet'!A1+Sheet2!$B$3:C4*2.5E-3%`,
+			`_xlfn.CONCAT(A:A, 1:1, TRUE)&-1`,
+			`ROUND(,2)`,
+			`SUM(Table1[[#All],[Amount]])+[@Amount]`,
+			`'Sales Data'!Sales[[#Headers], [Unit Price]:[Total]]`,
+			`COUNTA(Table1[Item '[Old']])&Table1[]`,
+		}
+		for _, formula := range formulas {
+			tokens, err := tokenizeFormula(formula)
+			c.Assert(err, qt.IsNil)
+			c.Assert(joinFormulaTokens(tokens), qt.Equals, formula)
+		}
+	})
+
+	c.Run("Kinds", func(c *qt.C) {
+		tokens, err := tokenizeFormula(`SUM(Data!A1:B2,"x",#DIV/0!,TRUE,name)>=1`)
+		c.Assert(err, qt.IsNil)
+		var kinds []formulaTokenKind
+		for _, token := range tokens {
+			kinds = append(kinds, token.kind)
+		}
+		c.Assert(kinds, qt.DeepEquals, []formulaTokenKind{
+			formulaTokenFunction, formulaTokenOpenParen, formulaTokenReference, formulaTokenSeparator,
+			formulaTokenString, formulaTokenSeparator, formulaTokenError, formulaTokenSeparator,
+			formulaTokenBool, formulaTokenSeparator, formulaTokenName, formulaTokenCloseParen,
+			formulaTokenOperator, formulaTokenNumber,
+		})
+	})
+
+	c.Run("StructuredReferences", func(c *qt.C) {
+		tokens, err := tokenizeFormula(`Sheet1!T1[[#This Row],[A1]]+T1[@B1]*A1`)
+		c.Assert(err, qt.IsNil)
+		var kinds []formulaTokenKind
+		var texts []string
+		for _, token := range tokens {
+			kinds = append(kinds, token.kind)
+			texts = append(texts, token.text)
+		}
+		c.Assert(kinds, qt.DeepEquals, []formulaTokenKind{
+			formulaTokenStructuredRef, formulaTokenOperator, formulaTokenStructuredRef,
+			formulaTokenOperator, formulaTokenReference,
+		})
+		c.Assert(texts, qt.DeepEquals, []string{"Sheet1!T1[[#This Row],[A1]]", "+", "T1[@B1]", "*", "A1"})
+	})
+
+	c.Run("Unterminated", func(c *qt.C) {
+		_, err := tokenizeFormula(`"abc`)
+		c.Assert(err, qt.Not(qt.IsNil))
+		_, err = tokenizeFormula(`Table1[[#All],[Amount]`)
+		c.Assert(err, qt.Not(qt.IsNil))
+		_, err = tokenizeFormula(`Table1[Amount']`)
+		c.Assert(err, qt.Not(qt.IsNil))
+	})
+}
+
+func TestParseFormulaRef(t *testing.T) {
+	c := qt.New(t)
+
+	cases := []struct {
+		text     string
+		expected formulaRef
+	}{
+		{"A1", formulaRef{firstCol: 0, firstRow: 0, lastCol: 0, lastRow: 0}},
+		{"$B$2:C10", formulaRef{firstCol: 1, firstRow: 1, lastCol: 2, lastRow: 9}},
+		{"Sheet2!D4", formulaRef{sheet: "Sheet2", firstCol: 3, firstRow: 3, lastCol: 3, lastRow: 3}},
+		{"'It''s'!A1", formulaRef{sheet: "It's", firstCol: 0, firstRow: 0, lastCol: 0, lastRow: 0}},
+		{"A:B", formulaRef{firstCol: 0, firstRow: -1, lastCol: 1, lastRow: -1}},
+		{"2:3", formulaRef{firstCol: -1, firstRow: 1, lastCol: -1, lastRow: 2}},
+	}
+	for _, tc := range cases {
+		ref, err := parseFormulaRef(tc.text)
+		c.Assert(err, qt.IsNil, qt.Commentf(tc.text))
+		c.Assert(ref, qt.Equals, tc.expected, qt.Commentf(tc.text))
+	}
+}
+
+func TestParseFormula(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Precedence", func(c *qt.C) {
+		node, err := parseFormula("=1+2*3")
+		c.Assert(err, qt.IsNil)
+		sum, ok := node.(*formulaBinaryNode)
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(sum.op, qt.Equals, "+")
+		product, ok := sum.right.(*formulaBinaryNode)
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(product.op, qt.Equals, "*")
+	})
+
+	c.Run("EmptyArgument", func(c *qt.C) {
+		node, err := parseFormula("IF(A1,,2)")
+		c.Assert(err, qt.IsNil)
+		call, ok := node.(*formulaCallNode)
+		c.Assert(ok, qt.IsTrue)
+		c.Assert(call.args, qt.HasLen, 3)
+		c.Assert(call.args[1], qt.IsNil)
+	})
+
+	c.Run("Invalid", func(c *qt.C) {
+		for _, formula := range []string{"1+", "SUM(1", "(1))", "*2"} {
+			_, err := parseFormula(formula)
+			c.Assert(err, qt.Not(qt.IsNil), qt.Commentf(formula))
+		}
+	})
+}
+
+func TestEvaluate(t *testing.T) {
+	c := qt.New(t)
+
+	// evaluate puts the given formula in A4 of a new sheet, whose B
+	// column holds 1, 2 and 3, and evaluates it.
+	evaluate := func(c *qt.C, option FileOption, formula string, ctx EvalContext) (CellValue, error) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		for i := 0; i < 3; i++ {
+			cell, err := sheet.Cell(i, 1)
+			c.Assert(err, qt.IsNil)
+			cell.SetInt(i + 1)
+		}
+		cell, err := sheet.Cell(3, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetFormula(formula)
+		return cell.Evaluate(ctx)
+	}
+
+	csRunO(c, "Operators", func(c *qt.C, option FileOption) {
+		cases := []struct {
+			formula  string
+			expected CellValue
+		}{
+			{"1+2*3", numberValue(7)},
+			{"(1+2)*3", numberValue(9)},
+			{"-2^2", numberValue(4)},
+			{"2^3^2", numberValue(64)},
+			{"10%", numberValue(0.1)},
+			{"B1+B2+B3", numberValue(6)},
+			{`"a"&B2&TRUE`, stringValue("a2TRUE")},
+			{`"10"+1`, numberValue(11)},
+			{`"x"+1`, errorValue("#VALUE!")},
+			{"1/0", errorValue("#DIV/0!")},
+			{"B1<B2", boolValue(true)},
+			{`"b">"A"`, boolValue(true)},
+			{`1<"1"`, boolValue(true)},
+			{"TRUE>1", boolValue(true)},
+			{"B5=0", boolValue(true)},
+			{`B5=""`, boolValue(true)},
+			{"B5", numberValue(0)},
+			{"SUM(B1:B3)", numberValue(6)},
+			{"SUM(B:B)", numberValue(6)},
+			{"B1:B3", errorValue("#VALUE!")},
+			{"Nowhere!A1", errorValue("#REF!")},
+			{"Table1[Amount]", errorValue("#REF!")},
+			{"undefined", errorValue("#NAME?")},
+		}
+		for _, tc := range cases {
+			v, err := evaluate(c, option, tc.formula, EvalContext{})
+			c.Assert(err, qt.IsNil, qt.Commentf(tc.formula))
+			c.Assert(v, qt.Equals, tc.expected, qt.Commentf(tc.formula))
+		}
+	})
+
+	csRunO(c, "CircularReference", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		a1, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		a1.SetFormula("B1+1")
+		b1, err := sheet.Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		b1.SetFormula("A1*2")
+		_, err = a1.Evaluate(EvalContext{})
+		c.Assert(errors.Is(err, ErrCircularReference), qt.IsTrue)
+	})
+
+	csRunO(c, "Limits", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		// Each cell in column A adds one to the cell below it.
+		var top *Cell
+		for i := 0; i < 20; i++ {
+			cell, err := sheet.Cell(i, 0)
+			c.Assert(err, qt.IsNil)
+			cell.SetFormula(GetCellIDStringFromCoords(0, i+1) + "+1")
+			if i == 0 {
+				top = cell
+			}
+		}
+		v, err := top.Evaluate(EvalContext{})
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.Equals, numberValue(20))
+		_, err = top.Evaluate(EvalContext{MaxDepth: 10})
+		c.Assert(errors.Is(err, ErrEvaluationLimit), qt.IsTrue)
+		_, err = top.Evaluate(EvalContext{MaxSteps: 30})
+		c.Assert(errors.Is(err, ErrEvaluationLimit), qt.IsTrue)
+	})
+
+	csRunO(c, "UnsupportedFunction", func(c *qt.C, option FileOption) {
+		_, err := evaluate(c, option, "1+VLOOKUP(1,B1:B3,1)", EvalContext{})
+		var unsupported ErrUnsupportedFunction
+		c.Assert(errors.As(err, &unsupported), qt.IsTrue)
+		c.Assert(unsupported.Name, qt.Equals, "VLOOKUP")
+	})
+
+	csRunO(c, "WrongArguments", func(c *qt.C, option FileOption) {
+		_, err := evaluate(c, option, "MOD(1)", EvalContext{})
+		c.Assert(err, qt.ErrorMatches, "Cell.Evaluate: MOD: wrong number of arguments: 1")
+	})
+
+	csRunO(c, "CustomFunction", func(c *qt.C, option FileOption) {
+		double := func(args []FormulaArg) (CellValue, error) {
+			n, errv, ok := asNumber(args[0].Value)
+			if !ok {
+				return errv, nil
+			}
+			return numberValue(n * 2), nil
+		}
+		ctx := EvalContext{Functions: map[string]FormulaFunction{"DOUBLE": double}}
+		v, err := evaluate(c, option, "double(B3)+1", ctx)
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.Equals, numberValue(7))
+
+		RegisterFunction("triple", func(args []FormulaArg) (CellValue, error) {
+			return numberValue(args[0].Value.Number * 3), nil
+		})
+		defer func() {
+			formulaFunctionsMU.Lock()
+			delete(formulaFunctions, "TRIPLE")
+			formulaFunctionsMU.Unlock()
+		}()
+		v, err = evaluate(c, option, "TRIPLE(B2)", EvalContext{})
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.Equals, numberValue(6))
+	})
+
+	csRunO(c, "NoFormula", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("hello")
+		v, err := cell.Evaluate(EvalContext{})
+		c.Assert(err, qt.IsNil)
+		c.Assert(v, qt.Equals, stringValue("hello"))
+	})
+}
+
+// TestEvaluateCachedResults checks that the formulas in formulas.xlsx
+// evaluate to the results cached for them in the file.  The file wasn't
+// saved by Excel: its results were written by hand, following Excel's
+// documentation of each function, so they check the evaluator against
+// that reading of Excel's behaviour rather than against Excel itself.
+func TestEvaluateCachedResults(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "Formulas", func(c *qt.C, option FileOption) {
+		f, err := OpenFile("./testdocs/formulas.xlsx", option)
+		c.Assert(err, qt.IsNil)
+		sheet := f.Sheet["Formulas"]
+		c.Assert(sheet, qt.Not(qt.IsNil))
+		var count int
+		err = sheet.ForEachRow(func(r *Row) error {
+			cell := r.GetCell(2)
+			formula := cell.Formula()
+			if formula == "" {
+				return nil
+			}
+			count++
+			expected := cellLiteralValue(cell)
+			v, err := cell.Evaluate(EvalContext{})
+			c.Assert(err, qt.IsNil, qt.Commentf(formula))
+			c.Assert(v.Type, qt.Equals, expected.Type, qt.Commentf(formula))
+			if v.Type == ValueNumber {
+				c.Assert(math.Abs(v.Number-expected.Number) < 1e-9, qt.IsTrue, qt.Commentf("%s = %v, not %v", formula, v.Number, expected.Number))
+			} else {
+				c.Assert(v, qt.Equals, expected, qt.Commentf(formula))
+			}
+			return nil
+		})
+		c.Assert(err, qt.IsNil)
+		c.Assert(count, qt.Equals, 43)
+	})
+}
+
+func TestRenameFormulaSheet(t *testing.T) {
+	c := qt.New(t)
+
+	cases := []struct {
+		formula  string
+		expected string
+	}{
+		{"=Old!A1+1", "='New Name'!A1+1"},
+		{"'old'!$A$1:B2", "'New Name'!$A$1:B2"},
+		{"SUM('Old'!A:A,Other!A1)", "SUM('New Name'!A:A,Other!A1)"},
+		// Other sheets, and strings, are left alone.
+		{`Older!A1&"Old!A1"`, `Older!A1&"Old!A1"`},
+		// Either end of a 3D reference can be the sheet.
+		{"Old!A1&SUM(Old:Other!A1)", "'New Name'!A1&SUM('New Name:Other'!A1)"},
+		{"SUM('Other:Old'!A1:B2)", "SUM('Other:New Name'!A1:B2)"},
+		// A sheet of another workbook isn't this one.
+		{"[1]Old!A1+'[1]Old'!B2+[1]!Old", "[1]Old!A1+'[1]Old'!B2+[1]!Old"},
+	}
+	for _, tc := range cases {
+		formula, err := renameFormulaSheet(tc.formula, "Old", "New Name")
+		c.Assert(err, qt.IsNil, qt.Commentf(tc.formula))
+		c.Assert(formula, qt.Equals, tc.expected, qt.Commentf(tc.formula))
+	}
+
+	formula, err := renameFormulaSheet("'It''s'!A1", "It's", "Its")
+	c.Assert(err, qt.IsNil)
+	c.Assert(formula, qt.Equals, "'Its'!A1")
+	formula, err = renameFormulaSheet("Old!A1", "Old", "It's")
+	c.Assert(err, qt.IsNil)
+	c.Assert(formula, qt.Equals, "'It''s'!A1")
+}
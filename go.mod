@@ -3,6 +3,7 @@ module github.com/xenking/xlsx/v3
 go 1.15
 
 require (
+	github.com/alicebob/miniredis/v2 v2.14.1
 	github.com/frankban/quicktest v1.11.2
 	github.com/google/btree v1.0.0 // indirect
 	github.com/klauspost/compress v1.11.3
@@ -0,0 +1,207 @@
+package xlsx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The codes that Excel replaces, in a printed header or footer, with
+// what they name.
+const (
+	HeaderFooterPageNumber = "&P"
+	HeaderFooterPageCount  = "&N"
+	HeaderFooterDate       = "&D"
+	HeaderFooterTime       = "&T"
+	HeaderFooterFileName   = "&F"
+	HeaderFooterFilePath   = "&Z"
+	HeaderFooterSheetName  = "&A"
+)
+
+// The codes that turn bold, italic and underline on and off for the
+// text of a header or footer that follows them.
+const (
+	HeaderFooterBold      = "&B"
+	HeaderFooterItalic    = "&I"
+	HeaderFooterUnderline = "&U"
+)
+
+// maxHeaderFooterLen is the most characters that Excel allows in a
+// header or footer, codes included.
+const maxHeaderFooterLen = 255
+
+// HeaderFooter holds the headers and footers of the pages that a Sheet
+// is printed on.  Each is a string of text and Excel's codes, which
+// HeaderFooterSections and the HeaderFooter constants and functions
+// build.
+type HeaderFooter struct {
+	OddHeader, OddFooter string
+	// EvenHeader and EvenFooter are used on even pages if
+	// DifferentOddEven is set.
+	EvenHeader, EvenFooter string
+	// FirstHeader and FirstFooter are used on the first page if
+	// DifferentFirst is set.
+	FirstHeader, FirstFooter string
+	DifferentOddEven         bool
+	DifferentFirst           bool
+	// ScaleWithDoc scales the headers and footers along with the
+	// Sheet, and AlignWithMargins lines them up with the left and
+	// right page margins.  Excel sets both by default.
+	ScaleWithDoc     bool
+	AlignWithMargins bool
+}
+
+// HeaderFooterEscape returns text with its ampersands doubled, so that
+// it is printed in a header or footer as it is, rather than read as
+// codes.
+func HeaderFooterEscape(text string) string {
+	return strings.Replace(text, "&", "&&", -1)
+}
+
+// HeaderFooterSections returns a header or footer made of the left,
+// centre and right sections given, leaving out those that are empty.
+func HeaderFooterSections(left, center, right string) string {
+	var b strings.Builder
+	for _, section := range [...]struct{ code, text string }{
+		{"&L", left}, {"&C", center}, {"&R", right},
+	} {
+		if section.text != "" {
+			b.WriteString(section.code)
+			b.WriteString(section.text)
+		}
+	}
+	return b.String()
+}
+
+// SplitHeaderFooterSections returns the left, centre and right
+// sections of a header or footer, so that one of them can be changed
+// and the header or footer put back together with
+// HeaderFooterSections.  Text before the first section code belongs to
+// the centre, as it does in Excel.
+func SplitHeaderFooterSections(text string) (left, center, right string) {
+	var sections [3]strings.Builder
+	current := &sections[1]
+	for i := 0; i < len(text); i++ {
+		if text[i] == '&' && i+1 < len(text) {
+			switch text[i+1] {
+			case 'L':
+				current = &sections[0]
+				i++
+				continue
+			case 'C':
+				current = &sections[1]
+				i++
+				continue
+			case 'R':
+				current = &sections[2]
+				i++
+				continue
+			case '&':
+				// An escaped ampersand, which mustn't be taken
+				// for the start of a code.
+				current.WriteString("&&")
+				i++
+				continue
+			}
+		}
+		current.WriteByte(text[i])
+	}
+	return sections[0].String(), sections[1].String(), sections[2].String()
+}
+
+// HeaderFooterFont returns the code that sets the font of the text of
+// a header or footer that follows it.  An empty name keeps the current
+// font, and an empty style, such as "Bold" or "Italic", is "Regular".
+func HeaderFooterFont(name, style string) string {
+	if name == "" {
+		name = "-"
+	}
+	if style == "" {
+		style = "Regular"
+	}
+	return `&"` + name + "," + style + `"`
+}
+
+// HeaderFooterFontSize returns the code that sets the size, in points,
+// of the text of a header or footer that follows it.  Text that starts
+// with a digit has to be separated from it by a space.
+func HeaderFooterFontSize(points int) string {
+	return "&" + strconv.Itoa(points)
+}
+
+// HeaderFooterColor returns the code that sets the colour of the text
+// of a header or footer that follows it, given as six hex digits, such
+// as "FF0000".
+func HeaderFooterColor(rgb string) string {
+	return "&K" + rgb
+}
+
+// SetHeaderFooter sets the headers and footers of the pages that the
+// Sheet is printed on.
+func (s *Sheet) SetHeaderFooter(hf HeaderFooter) error {
+	for _, text := range []string{hf.OddHeader, hf.OddFooter, hf.EvenHeader, hf.EvenFooter, hf.FirstHeader, hf.FirstFooter} {
+		if n := utf8.RuneCountInString(text); n > maxHeaderFooterLen {
+			return fmt.Errorf("SetHeaderFooter: %d characters is more than the %d that Excel allows in a header or footer", n, maxHeaderFooterLen)
+		}
+	}
+	s.headerFooter = &hf
+	return nil
+}
+
+// HeaderFooter returns the headers and footers of the pages that the
+// Sheet is printed on, as set by SetHeaderFooter or read from its file.
+// A Sheet without them has none, with Excel's defaults set.
+func (s *Sheet) HeaderFooter() HeaderFooter {
+	if s.headerFooter == nil {
+		return HeaderFooter{ScaleWithDoc: true, AlignWithMargins: true}
+	}
+	return *s.headerFooter
+}
+
+// makeHeaderFooter sets the headerFooter element of the worksheet.
+func (s *Sheet) makeHeaderFooter(worksheet *xlsxWorksheet) {
+	if s.headerFooter == nil {
+		return
+	}
+	hf := *s.headerFooter
+	xHF := &xlsxHeaderFooter{
+		DifferentOddEven: hf.DifferentOddEven,
+		DifferentFirst:   hf.DifferentFirst,
+		OddHeader:        hf.OddHeader,
+		OddFooter:        hf.OddFooter,
+		EvenHeader:       hf.EvenHeader,
+		EvenFooter:       hf.EvenFooter,
+		FirstHeader:      hf.FirstHeader,
+		FirstFooter:      hf.FirstFooter,
+	}
+	// Both attributes are true when they are absent.
+	if !hf.ScaleWithDoc {
+		xHF.ScaleWithDoc = &hf.ScaleWithDoc
+	}
+	if !hf.AlignWithMargins {
+		xHF.AlignWithMargins = &hf.AlignWithMargins
+	}
+	worksheet.HeaderFooter = xHF
+}
+
+// readHeaderFooter returns the HeaderFooter of the worksheet, or nil
+// if it has no headerFooter element.
+func readHeaderFooter(worksheet *xlsxWorksheet) *HeaderFooter {
+	xHF := worksheet.HeaderFooter
+	if xHF == nil {
+		return nil
+	}
+	return &HeaderFooter{
+		OddHeader:        xHF.OddHeader,
+		OddFooter:        xHF.OddFooter,
+		EvenHeader:       xHF.EvenHeader,
+		EvenFooter:       xHF.EvenFooter,
+		FirstHeader:      xHF.FirstHeader,
+		FirstFooter:      xHF.FirstFooter,
+		DifferentOddEven: xHF.DifferentOddEven,
+		DifferentFirst:   xHF.DifferentFirst,
+		ScaleWithDoc:     xHF.ScaleWithDoc == nil || *xHF.ScaleWithDoc,
+		AlignWithMargins: xHF.AlignWithMargins == nil || *xHF.AlignWithMargins,
+	}
+}
@@ -0,0 +1,91 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestHeaderFooterCodes(t *testing.T) {
+	c := qt.New(t)
+
+	c.Assert(HeaderFooterEscape("Smith & Sons"), qt.Equals, "Smith && Sons")
+	c.Assert(HeaderFooterSections("", "Page "+HeaderFooterPageNumber+" of "+HeaderFooterPageCount, HeaderFooterDate),
+		qt.Equals, "&CPage &P of &N&R&D")
+	c.Assert(HeaderFooterFont("Arial", "Bold"), qt.Equals, `&"Arial,Bold"`)
+	c.Assert(HeaderFooterFont("", ""), qt.Equals, `&"-,Regular"`)
+	c.Assert(HeaderFooterFontSize(14), qt.Equals, "&14")
+	c.Assert(HeaderFooterColor("FF0000"), qt.Equals, "&KFF0000")
+
+	left, center, right := SplitHeaderFooterSections("&LSmith && Sons&C&BReport&R&P")
+	c.Assert(left, qt.Equals, "Smith && Sons")
+	c.Assert(center, qt.Equals, "&BReport")
+	c.Assert(right, qt.Equals, "&P")
+	// Text before any section belongs to the centre.
+	left, center, right = SplitHeaderFooterSections("&&Co&RRight")
+	c.Assert(left, qt.Equals, "")
+	c.Assert(center, qt.Equals, "&&Co")
+	c.Assert(right, qt.Equals, "Right")
+}
+
+func TestHeaderFooter(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("TooLong", func(c *qt.C) {
+		sheet, err := NewSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		err = sheet.SetHeaderFooter(HeaderFooter{OddFooter: strings.Repeat("x", 256)})
+		c.Assert(err, qt.Not(qt.IsNil))
+		c.Assert(sheet.HeaderFooter(), qt.Equals, HeaderFooter{ScaleWithDoc: true, AlignWithMargins: true})
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("HeaderFooter")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		sheet.AddRow().AddCell().SetString("printed")
+		hf := HeaderFooter{
+			OddHeader: HeaderFooterSections(
+				HeaderFooterFont("Arial", "Bold")+HeaderFooterEscape("Smith & <Sons>"),
+				"",
+				HeaderFooterDate),
+			OddFooter:        HeaderFooterSections("", "Page "+HeaderFooterPageNumber+" of "+HeaderFooterPageCount, ""),
+			FirstHeader:      "&CCover",
+			DifferentFirst:   true,
+			AlignWithMargins: true,
+		}
+		c.Assert(sheet.SetHeaderFooter(hf), qt.IsNil)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		xml := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(xml, qt.Matches, `(?s).*<headerFooter differentFirst="(true|1)" scaleWithDoc="(false|0)">`+
+			`<oddHeader>&amp;L&amp;&(quot|#34);Arial,Bold&(quot|#34);Smith &amp;&amp; &lt;Sons&gt;&amp;R&amp;D</oddHeader>`+
+			`<oddFooter>&amp;CPage &amp;P of &amp;N</oddFooter><firstHeader>&amp;CCover</firstHeader></headerFooter>.*`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet2 := f2.Sheets[0]
+		c.Cleanup(sheet2.Close)
+		got := sheet2.HeaderFooter()
+		c.Assert(got, qt.Equals, hf)
+
+		// Adjust the footer of the opened file and write it again.
+		left, _, right := SplitHeaderFooterSections(got.OddFooter)
+		got.OddFooter = HeaderFooterSections(left, HeaderFooterSheetName, right)
+		c.Assert(sheet2.SetHeaderFooter(got), qt.IsNil)
+		buf.Reset()
+		c.Assert(f2.Write(&buf), qt.IsNil)
+		f3, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet3 := f3.Sheets[0]
+		c.Cleanup(sheet3.Close)
+		c.Assert(sheet3.HeaderFooter().OddFooter, qt.Equals, "&C&A")
+		c.Assert(sheet3.HeaderFooter().OddHeader, qt.Equals, hf.OddHeader)
+	})
+}
@@ -0,0 +1,216 @@
+package xlsx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// headerFlags contains flags that can be set by HeaderOption
+// implementations to modify the way HeaderIndex reads the header row.
+type headerFlags struct {
+	// trim indicates if whitespace around the headers is removed.
+	trim bool
+	// suffixDuplicates indicates if a header that appears more than
+	// once is given a numbered suffix, rather than being an error.
+	suffixDuplicates bool
+}
+
+// HeaderOption describes a function that can set values in a
+// headerFlags struct to affect the way HeaderIndex operates.
+type HeaderOption func(flags *headerFlags)
+
+// TrimHeaders can be passed as an option to Sheet.HeaderIndex in order
+// to remove the whitespace around the headers, and around the names
+// given to Row.CellByHeader and Sheet.AppendRecord.
+func TrimHeaders(flags *headerFlags) {
+	flags.trim = true
+}
+
+// SuffixDuplicateHeaders can be passed as an option to
+// Sheet.HeaderIndex in order to accept a header that appears more than
+// once.  The first column keeps the header, and the later ones are
+// named with a suffix, such as "Name_2" and "Name_3".  Without it, a
+// duplicate header is an error.
+func SuffixDuplicateHeaders(flags *headerFlags) {
+	flags.suffixDuplicates = true
+}
+
+// headerIndex is the header row of a Sheet, as read by HeaderIndex.
+type headerIndex struct {
+	flags   headerFlags
+	columns map[string]int
+}
+
+// name returns the key of header in the index.
+func (h *headerIndex) name(header string) string {
+	if h.flags.trim {
+		return strings.TrimSpace(header)
+	}
+	return header
+}
+
+// HeaderIndex treats the first row of the Sheet as a header row, and
+// returns a map from the text of each header to the index of its
+// column.  Empty headers are left out.  The header row is read once
+// and kept, so that Row.CellByHeader and Sheet.AppendRecord can use it
+// without reading it again, which matters for the lazy cell stores.
+// Calling HeaderIndex again reads the header row again, which is
+// needed if its cells have been changed directly.
+func (s *Sheet) HeaderIndex(options ...HeaderOption) (map[string]int, error) {
+	s.mustBeOpen()
+	index, err := s.readHeaderIndex(options...)
+	if err != nil {
+		return nil, fmt.Errorf("Sheet.HeaderIndex: %w", err)
+	}
+	s.headers = index
+	columns := make(map[string]int, len(index.columns))
+	for header, col := range index.columns {
+		columns[header] = col
+	}
+	return columns, nil
+}
+
+// readHeaderIndex reads the header row of the Sheet.
+func (s *Sheet) readHeaderIndex(options ...HeaderOption) (*headerIndex, error) {
+	index := &headerIndex{columns: make(map[string]int)}
+	for _, opt := range options {
+		opt(&index.flags)
+	}
+	if s.MaxRow == 0 {
+		return index, nil
+	}
+	row, err := s.Row(0)
+	if err != nil {
+		return nil, err
+	}
+	err = row.ForEachCell(func(c *Cell) error {
+		header := index.name(c.Value)
+		if header == "" {
+			return nil
+		}
+		col, ok := index.columns[header]
+		if !ok {
+			index.columns[header] = c.num
+			return nil
+		}
+		if !index.flags.suffixDuplicates {
+			return fmt.Errorf("the header %q is in both column %s and column %s",
+				header, ColIndexToLetters(col), ColIndexToLetters(c.num))
+		}
+		for n := 2; ; n++ {
+			suffixed := fmt.Sprintf("%s_%d", header, n)
+			if _, ok := index.columns[suffixed]; !ok {
+				index.columns[suffixed] = c.num
+				return nil
+			}
+		}
+	}, SkipEmptyCells)
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// cachedHeaderIndex returns the header row of the Sheet, reading it
+// with the default options if HeaderIndex hasn't been called yet.
+func (s *Sheet) cachedHeaderIndex() (*headerIndex, error) {
+	if s.headers == nil {
+		index, err := s.readHeaderIndex()
+		if err != nil {
+			return nil, err
+		}
+		s.headers = index
+	}
+	return s.headers, nil
+}
+
+// CellByHeader returns the Cell of the Row in the column whose header
+// is name, creating it if it doesn't exist.  The headers are those of
+// Sheet.HeaderIndex, which is called with no options if it hasn't been
+// called yet.
+func (r *Row) CellByHeader(name string) (*Cell, error) {
+	wrap := func(err error) (*Cell, error) {
+		return nil, fmt.Errorf("Row.CellByHeader(%q): %w", name, err)
+	}
+	if r.Sheet == nil {
+		return wrap(errors.New("the row doesn't belong to a sheet"))
+	}
+	s := r.Sheet
+	if s.headers == nil {
+		current := s.currentRow
+		if _, err := s.cachedHeaderIndex(); err != nil {
+			return wrap(err)
+		}
+		// Reading the header row mustn't leave this one behind
+		// in a lazy cell store.
+		if current == r && s.currentRow != r {
+			s.setCurrentRow(r)
+		}
+	}
+	col, ok := s.headers.columns[s.headers.name(name)]
+	if !ok {
+		return wrap(errors.New("there is no such header"))
+	}
+	return r.GetCell(col), nil
+}
+
+// AppendRecord adds a Row to the end of the Sheet, with each value of
+// record in the column whose header is its key, set with
+// Cell.SetValue.  A key that has no header yet is added to the header
+// row, in a new column after the last one, in the order of the keys.
+// The first row of an empty Sheet becomes its header row.
+func (s *Sheet) AppendRecord(record map[string]interface{}) (*Row, error) {
+	s.mustBeOpen()
+	wrap := func(err error) (*Row, error) {
+		return nil, fmt.Errorf("Sheet.AppendRecord: %w", err)
+	}
+	index, err := s.cachedHeaderIndex()
+	if err != nil {
+		return wrap(err)
+	}
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var missing []string
+	for _, key := range keys {
+		if index.name(key) == "" {
+			return wrap(fmt.Errorf("the key %q isn't a valid header", key))
+		}
+		if _, ok := index.columns[index.name(key)]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 || s.MaxRow == 0 {
+		header, err := s.Row(0)
+		if err != nil {
+			return wrap(err)
+		}
+		next := s.MaxCol
+		for _, col := range index.columns {
+			if col >= next {
+				next = col + 1
+			}
+		}
+		for _, key := range missing {
+			name := index.name(key)
+			if _, ok := index.columns[name]; ok {
+				// Another key with the same name once trimmed.
+				continue
+			}
+			header.GetCell(next).SetString(name)
+			index.columns[name] = next
+			next++
+		}
+	}
+
+	row := s.AddRow()
+	for _, key := range keys {
+		row.GetCell(index.columns[index.name(key)]).SetValue(record[key])
+	}
+	return row, nil
+}
@@ -0,0 +1,131 @@
+package xlsx
+
+import (
+	"bytes"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestHeaders(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "HeaderIndex", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("HeaderIndex")
+		c.Assert(err, qt.IsNil)
+		defer sheet.Close()
+
+		header := sheet.AddRow()
+		for _, h := range []string{"Name", " Email ", "", "Age"} {
+			header.AddCell().SetString(h)
+		}
+		row := sheet.AddRow()
+		for _, v := range []string{"Ann", "ann@example.com", "x", "31"} {
+			row.AddCell().SetString(v)
+		}
+
+		index, err := sheet.HeaderIndex()
+		c.Assert(err, qt.IsNil)
+		c.Assert(index, qt.DeepEquals, map[string]int{"Name": 0, " Email ": 1, "Age": 3})
+
+		index, err = sheet.HeaderIndex(TrimHeaders)
+		c.Assert(err, qt.IsNil)
+		c.Assert(index, qt.DeepEquals, map[string]int{"Name": 0, "Email": 1, "Age": 3})
+
+		row, err = sheet.Row(1)
+		c.Assert(err, qt.IsNil)
+		cell, err := row.CellByHeader(" Email")
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "ann@example.com")
+		_, err = row.CellByHeader("Phone")
+		c.Assert(err, qt.ErrorMatches, `Row.CellByHeader\("Phone"\): there is no such header`)
+	})
+
+	csRunO(c, "CellByHeaderWithoutIndex", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("CellByHeaderWithoutIndex")
+		c.Assert(err, qt.IsNil)
+		defer sheet.Close()
+
+		sheet.AddRow().AddCell().SetString("ID")
+		row := sheet.AddRow()
+		row.AddCell().SetInt(7)
+
+		cell, err := row.CellByHeader("ID")
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "7")
+		cell.SetInt(8)
+
+		row, err = sheet.Row(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.GetCell(0).Value, qt.Equals, "8")
+	})
+
+	csRunO(c, "DuplicateHeaders", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("DuplicateHeaders")
+		c.Assert(err, qt.IsNil)
+		defer sheet.Close()
+
+		header := sheet.AddRow()
+		for _, h := range []string{"Name", "Name", "Name_2", "Name"} {
+			header.AddCell().SetString(h)
+		}
+
+		_, err = sheet.HeaderIndex()
+		c.Assert(err, qt.ErrorMatches, `Sheet.HeaderIndex: the header "Name" is in both column A and column B`)
+
+		index, err := sheet.HeaderIndex(SuffixDuplicateHeaders)
+		c.Assert(err, qt.IsNil)
+		c.Assert(index, qt.DeepEquals, map[string]int{"Name": 0, "Name_2": 1, "Name_2_2": 2, "Name_3": 3})
+	})
+
+	csRunO(c, "AppendRecord", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("AppendRecord")
+		c.Assert(err, qt.IsNil)
+
+		_, err = sheet.AppendRecord(map[string]interface{}{"Name": "Ann", "Age": 31})
+		c.Assert(err, qt.IsNil)
+		_, err = sheet.AppendRecord(map[string]interface{}{"Email": "bob@example.com", "Name": "Bob"})
+		c.Assert(err, qt.IsNil)
+		_, err = sheet.AppendRecord(map[string]interface{}{"": 1})
+		c.Assert(err, qt.ErrorMatches, `Sheet.AppendRecord: the key "" isn't a valid header`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		sheet.Close()
+
+		f, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		output, err := f.ToSlice()
+		c.Assert(err, qt.IsNil)
+		c.Assert(output, qt.DeepEquals, [][][]string{{
+			{"Age", "Name", "Email"},
+			{"31", "Ann", ""},
+			{"", "Bob", "bob@example.com"},
+		}})
+	})
+
+	c.Run("HeaderRowRemoved", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+
+		sheet.AddRow().AddCell().SetString("Old")
+		sheet.AddRow().AddCell().SetString("New")
+		_, err = sheet.HeaderIndex()
+		c.Assert(err, qt.IsNil)
+
+		c.Assert(sheet.RemoveRowAtIndex(0), qt.IsNil)
+		index, err := sheet.HeaderIndex()
+		c.Assert(err, qt.IsNil)
+		c.Assert(index, qt.DeepEquals, map[string]int{"New": 0})
+
+		row, err := sheet.AppendRecord(map[string]interface{}{"New": true})
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.GetCoordinate(), qt.Equals, 1)
+		c.Assert(row.GetCell(0).Bool(), qt.IsTrue)
+	})
+}
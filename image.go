@@ -0,0 +1,633 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Registered for image.DecodeConfig.
+	_ "image/png"  // Registered for image.DecodeConfig.
+	"path"
+	"strings"
+)
+
+const (
+	drawingRelationshipType RelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing"
+	imageRelationshipType   RelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	drawingContentType                       = "application/vnd.openxmlformats-officedocument.drawing+xml"
+	// emusPerPixel is the number of English Metric Units, in which
+	// drawings are measured, in a pixel at 96 dots per inch.
+	emusPerPixel = 9525
+)
+
+// imageContentTypes are the content types of the images, by their
+// format, which is also the extension of the parts they are written
+// to.  The content type of an image in any other format that is read
+// from a file is taken to be "image/" followed by its format.
+var imageContentTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"bmp":  "image/bmp",
+	"tiff": "image/tiff",
+	"emf":  "image/x-emf",
+	"wmf":  "image/x-wmf",
+	"svg":  "image/svg+xml",
+}
+
+// ImageAnchorType is the way an image is anchored to the cells of a
+// sheet.
+type ImageAnchorType int
+
+const (
+	// OneCellAnchor anchors the top left corner of an image to a
+	// cell, so that it moves with the cell but keeps its size.
+	OneCellAnchor ImageAnchorType = iota
+	// TwoCellAnchor anchors the top left and bottom right corners of
+	// an image to two cells, so that it moves and is resized with
+	// them.
+	TwoCellAnchor
+)
+
+// ImageAnchorPoint is a point in a sheet: the top left corner of the
+// cell at the zero based Col and Row, moved right by ColOffset pixels
+// and down by RowOffset pixels.
+type ImageAnchorPoint struct {
+	Col       int
+	Row       int
+	ColOffset int
+	RowOffset int
+}
+
+// ImageAnchor is where an image is placed in a sheet.  The top left
+// corner of the image is at From.  With a OneCellAnchor, the image is
+// Width by Height pixels, or, if they are zero, its own size.  With a
+// TwoCellAnchor, its bottom right corner is at To.
+type ImageAnchor struct {
+	Type   ImageAnchorType
+	From   ImageAnchorPoint
+	To     ImageAnchorPoint
+	Width  int
+	Height int
+}
+
+// Image is an image placed in a sheet.  Format is the format of its
+// Data, such as "png" or "jpeg".
+type Image struct {
+	Data   []byte
+	Format string
+	Anchor ImageAnchor
+	// Name and Description are the name of the picture, such as
+	// "Picture 1", and its alternative text.
+	Name        string
+	Description string
+}
+
+// AddImage places an image in the sheet, where anchor says.  img is the
+// content of a PNG or JPEG file, and format is "png" or "jpeg" (or
+// "jpg").  The image is written to the file, with the drawing that
+// places it, when the file is saved.
+func (s *Sheet) AddImage(img []byte, format string, anchor ImageAnchor) error {
+	format = strings.ToLower(format)
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	if format != "png" && format != "jpeg" {
+		return fmt.Errorf("AddImage: unsupported image format %q, use \"png\" or \"jpeg\"", format)
+	}
+	config, decoded, err := image.DecodeConfig(bytes.NewReader(img))
+	if err != nil {
+		return fmt.Errorf("AddImage: image.DecodeConfig: %w", err)
+	}
+	if decoded != format {
+		return fmt.Errorf("AddImage: the image is %s, not %s", decoded, format)
+	}
+	if err := anchor.validate(); err != nil {
+		return fmt.Errorf("AddImage: %w", err)
+	}
+	if anchor.Type == OneCellAnchor && anchor.Width == 0 && anchor.Height == 0 {
+		anchor.Width, anchor.Height = config.Width, config.Height
+	}
+	s.images = append(s.images, &Image{
+		Data:   append([]byte(nil), img...),
+		Format: format,
+		Anchor: anchor,
+		Name:   fmt.Sprintf("Picture %d", len(s.images)+1),
+	})
+	return nil
+}
+
+// Images returns copies of the images in the sheet, those read from
+// the file first and then those added by AddImage.
+func (s *Sheet) Images() []Image {
+	var images []Image
+	for _, img := range s.images {
+		images = append(images, *img)
+	}
+	return images
+}
+
+// validate returns an error if the anchor isn't a place in a sheet.
+func (a ImageAnchor) validate() error {
+	points := []ImageAnchorPoint{a.From}
+	switch a.Type {
+	case OneCellAnchor:
+		if a.Width < 0 || a.Height < 0 {
+			return errors.New("the size of the image can't be negative")
+		}
+	case TwoCellAnchor:
+		points = append(points, a.To)
+		if a.To.Col < a.From.Col || a.To.Row < a.From.Row {
+			return errors.New("the bottom right corner of the image is above or left of its top left corner")
+		}
+	default:
+		return fmt.Errorf("unknown image anchor type %d", a.Type)
+	}
+	for _, p := range points {
+		if p.Col < 0 || p.Row < 0 || p.ColOffset < 0 || p.RowOffset < 0 {
+			return errors.New("an image can't be anchored to a negative column, row or offset")
+		}
+	}
+	return nil
+}
+
+// xlsxWsDr directly maps the wsDr element in the namespace
+// http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing,
+// as much as is needed to read the pictures in a drawing.  Its anchors
+// are kept in order, whatever their type.
+type xlsxWsDr struct {
+	XMLName xml.Name            `xml:"http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing wsDr"`
+	Anchors []xlsxDrawingAnchor `xml:",any"`
+}
+
+// xlsxDrawingAnchor directly maps the oneCellAnchor, twoCellAnchor and
+// absoluteAnchor elements of a drawing.
+type xlsxDrawingAnchor struct {
+	XMLName xml.Name
+	From    *xlsxDrawingMarker `xml:"from"`
+	To      *xlsxDrawingMarker `xml:"to"`
+	Ext     *xlsxDrawingExt    `xml:"ext"`
+	Pic     *xlsxDrawingPic    `xml:"pic"`
+}
+
+// xlsxDrawingMarker directly maps the from and to elements of an
+// anchor, whose offsets are in English Metric Units.
+type xlsxDrawingMarker struct {
+	Col    int   `xml:"col"`
+	ColOff int64 `xml:"colOff"`
+	Row    int   `xml:"row"`
+	RowOff int64 `xml:"rowOff"`
+}
+
+// xlsxDrawingExt directly maps the ext element of an anchor.
+type xlsxDrawingExt struct {
+	Cx int64 `xml:"cx,attr"`
+	Cy int64 `xml:"cy,attr"`
+}
+
+// xlsxDrawingPic directly maps the pic element of an anchor, which
+// refers to the image by the relationship in blip.
+type xlsxDrawingPic struct {
+	CNvPr struct {
+		Name  string `xml:"name,attr"`
+		Descr string `xml:"descr,attr"`
+	} `xml:"nvPicPr>cNvPr"`
+	Blip struct {
+		Embed string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships embed,attr"`
+	} `xml:"blipFill>blip"`
+	Ext *xlsxDrawingExt `xml:"spPr>xfrm>ext"`
+}
+
+// xlsxDrawing directly maps the drawing element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main, which
+// refers to the drawing that holds the images of a worksheet.
+type xlsxDrawing struct {
+	RelationshipId string `xml:"id,attr"`
+}
+
+// writeDrawingMarker writes the marker called name for p.
+func writeDrawingMarker(b *strings.Builder, name string, p ImageAnchorPoint) {
+	fmt.Fprintf(b, `<xdr:%s><xdr:col>%d</xdr:col><xdr:colOff>%d</xdr:colOff><xdr:row>%d</xdr:row><xdr:rowOff>%d</xdr:rowOff></xdr:%s>`,
+		name, p.Col, p.ColOffset*emusPerPixel, p.Row, p.RowOffset*emusPerPixel, name)
+}
+
+// size returns the size of img in pixels, which is that of its anchor
+// for a OneCellAnchor, and otherwise its own, if it can be decoded.
+func (img *Image) size() (int, int) {
+	if img.Anchor.Type == OneCellAnchor {
+		return img.Anchor.Width, img.Anchor.Height
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// drawingNamespaces declares the prefixes that writeDrawingAnchors
+// uses, for anchors added to a drawing that may use other ones.
+const drawingNamespaces = ` xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing"` +
+	` xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"` +
+	` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+
+// makeDrawing returns a drawing that places images and then charts,
+// which refer to their parts by the relationships with the ids relIDs.
+func makeDrawing(images []*Image, charts []*ChartSpec, relIDs []string) []byte {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<xdr:wsDr` + drawingNamespaces + `>`)
+	writeDrawingAnchors(&b, images, charts, relIDs, 2, "")
+	b.WriteString(`</xdr:wsDr>`)
+	return []byte(b.String())
+}
+
+// writeDrawingAnchors writes the anchors that place images and then
+// charts, which refer to their parts by the relationships with the ids
+// relIDs, and whose shapes have ids numbered from firstShapeID.  Each
+// anchor declares namespaces, which is empty unless the prefixes of the
+// drawing it is written to may not be the usual ones.
+func writeDrawingAnchors(b *strings.Builder, images []*Image, charts []*ChartSpec, relIDs []string, firstShapeID int, namespaces string) {
+	for i, img := range images {
+		width, height := img.size()
+		if img.Anchor.Type == TwoCellAnchor {
+			b.WriteString(`<xdr:twoCellAnchor` + namespaces + `>`)
+			writeDrawingMarker(b, "from", img.Anchor.From)
+			writeDrawingMarker(b, "to", img.Anchor.To)
+		} else {
+			b.WriteString(`<xdr:oneCellAnchor` + namespaces + `>`)
+			writeDrawingMarker(b, "from", img.Anchor.From)
+			fmt.Fprintf(b, `<xdr:ext cx="%d" cy="%d"/>`, width*emusPerPixel, height*emusPerPixel)
+		}
+		b.WriteString(`<xdr:pic><xdr:nvPicPr>`)
+		fmt.Fprintf(b, `<xdr:cNvPr id="%d" name="%s" descr="%s"/>`, firstShapeID+i, escapeXMLAttr(img.Name), escapeXMLAttr(img.Description))
+		b.WriteString(`<xdr:cNvPicPr><a:picLocks noChangeAspect="1"/></xdr:cNvPicPr></xdr:nvPicPr>`)
+		fmt.Fprintf(b, `<xdr:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></xdr:blipFill>`, relIDs[i])
+		fmt.Fprintf(b, `<xdr:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></xdr:spPr>`,
+			width*emusPerPixel, height*emusPerPixel)
+		b.WriteString(`</xdr:pic><xdr:clientData/>`)
+		if img.Anchor.Type == TwoCellAnchor {
+			b.WriteString(`</xdr:twoCellAnchor>`)
+		} else {
+			b.WriteString(`</xdr:oneCellAnchor>`)
+		}
+	}
+	for i, chart := range charts {
+		anchor := chart.Anchor
+		if anchor.Type == TwoCellAnchor {
+			b.WriteString(`<xdr:twoCellAnchor` + namespaces + `>`)
+			writeDrawingMarker(b, "from", anchor.From)
+			writeDrawingMarker(b, "to", anchor.To)
+		} else {
+			b.WriteString(`<xdr:oneCellAnchor` + namespaces + `>`)
+			writeDrawingMarker(b, "from", anchor.From)
+			fmt.Fprintf(b, `<xdr:ext cx="%d" cy="%d"/>`, anchor.Width*emusPerPixel, anchor.Height*emusPerPixel)
+		}
+		b.WriteString(`<xdr:graphicFrame macro=""><xdr:nvGraphicFramePr>`)
+		fmt.Fprintf(b, `<xdr:cNvPr id="%d" name="Chart %d"/><xdr:cNvGraphicFramePr/></xdr:nvGraphicFramePr>`, firstShapeID+len(images)+i, i+1)
+		b.WriteString(`<xdr:xfrm><a:off x="0" y="0"/><a:ext cx="0" cy="0"/></xdr:xfrm>`)
+		fmt.Fprintf(b, `<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/chart">`+
+			`<c:chart xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" r:id="%s"/></a:graphicData></a:graphic>`, relIDs[len(images)+i])
+		b.WriteString(`</xdr:graphicFrame><xdr:clientData/>`)
+		if anchor.Type == TwoCellAnchor {
+			b.WriteString(`</xdr:twoCellAnchor>`)
+		} else {
+			b.WriteString(`</xdr:oneCellAnchor>`)
+		}
+	}
+}
+
+// escapeXMLAttr returns s escaped for use as the value of an attribute.
+func escapeXMLAttr(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// drawingParts holds the numbers to give the next image and chart
+// parts, which are numbered across all the sheets of a File, and the
+// names of the parts that are used, which are those kept from the
+// file that was read and those written since.  It holds the blocks of
+// VML shape ids that are used in the same way.
+type drawingParts struct {
+	image int
+	chart int
+	used  map[string]bool
+	// vmlBlock is the next block of VML shape ids to try, and
+	// usedVMLBlocks has those that are used.
+	vmlBlock      int
+	usedVMLBlocks map[int]bool
+}
+
+// vmlBlocks returns the first n blocks of VML shape ids, counting up
+// from 1, that aren't used, and marks them as used.
+func (p *drawingParts) vmlBlocks(n int) []int {
+	if p.usedVMLBlocks == nil {
+		p.usedVMLBlocks = make(map[int]bool)
+	}
+	var blocks []int
+	for len(blocks) < n {
+		p.vmlBlock++
+		if !p.usedVMLBlocks[p.vmlBlock] {
+			p.usedVMLBlocks[p.vmlBlock] = true
+			blocks = append(blocks, p.vmlBlock)
+		}
+	}
+	return blocks
+}
+
+// partName returns the name made by filling in format with *n, and
+// then args, for the first *n, counting up, that gives a name that
+// isn't used, and moves *n on past it.
+func (p *drawingParts) partName(n *int, format string, args ...interface{}) string {
+	if p.used == nil {
+		p.used = make(map[string]bool)
+	}
+	for {
+		name := fmt.Sprintf(format, append([]interface{}{*n}, args...)...)
+		*n++
+		if !p.used[name] {
+			p.used[name] = true
+			return name
+		}
+	}
+}
+
+// addDrawing passes the images and charts of the Sheet, numbered from
+// those in next, the drawing that places them, and its relationships,
+// to writePart, and adds the relationship to the drawing to rels,
+// which it returns.  next is moved on past the parts that are written.
+// A drawing that was kept when the Sheet was read is written as it
+// was, with the images and charts added since placed after what was
+// in it.  It does nothing for a Sheet without a drawing, images or
+// charts.
+func (s *Sheet) addDrawing(rels *xlsxWorksheetRels, types *xlsxTypes, sheetIndex int, next *drawingParts, writePart func(partName string, part []byte) error) (*xlsxWorksheetRels, error) {
+	images := s.images
+	drawingRels := &xlsxWorksheetRels{XMLName: xml.Name{Local: "Relationships"}}
+	if s.drawing != nil {
+		images = images[s.drawing.images:]
+		drawingRels.Relationships = append(drawingRels.Relationships, s.drawing.rels...)
+	} else if len(images) == 0 && len(s.charts) == 0 {
+		return rels, nil
+	}
+	if rels == nil {
+		rels = &xlsxWorksheetRels{XMLName: xml.Name{Local: "Relationships"}}
+	}
+	var relIDs []string
+	for _, img := range images {
+		partName := next.partName(&next.image, "xl/media/image%d.%s", img.Format)
+		err := writePart(partName, img.Data)
+		if err != nil {
+			return rels, err
+		}
+		hasFormat := false
+		for _, def := range types.Defaults {
+			hasFormat = hasFormat || def.Extension == img.Format
+		}
+		if !hasFormat {
+			contentType, ok := imageContentTypes[img.Format]
+			if !ok {
+				contentType = "image/" + img.Format
+			}
+			types.Defaults = append(types.Defaults, xlsxDefault{
+				Extension:   img.Format,
+				ContentType: contentType,
+			})
+		}
+		id := newRelationshipID(drawingRels)
+		drawingRels.Relationships = append(drawingRels.Relationships, xlsxWorksheetRelation{
+			Id:     id,
+			Type:   imageRelationshipType,
+			Target: partTarget(partName),
+		})
+		relIDs = append(relIDs, id)
+	}
+	for _, chart := range s.charts {
+		partName := next.partName(&next.chart, "xl/charts/chart%d.xml")
+		err := writePart(partName, makeChart(chart))
+		if err != nil {
+			return rels, err
+		}
+		types.Overrides = append(types.Overrides, xlsxOverride{
+			PartName:    "/" + partName,
+			ContentType: chartContentType,
+		})
+		id := newRelationshipID(drawingRels)
+		drawingRels.Relationships = append(drawingRels.Relationships, xlsxWorksheetRelation{
+			Id:     id,
+			Type:   chartRelationshipType,
+			Target: partTarget(partName),
+		})
+		relIDs = append(relIDs, id)
+	}
+
+	var partName string
+	var drawing []byte
+	if s.drawing != nil {
+		partName = s.drawing.name
+		drawing = s.drawing.withAnchors(images, s.charts, relIDs)
+	} else {
+		n := sheetIndex
+		partName = next.partName(&n, "xl/drawings/drawing%d.xml")
+		drawing = makeDrawing(images, s.charts, relIDs)
+	}
+	err := writePart(partName, drawing)
+	if err != nil {
+		return rels, err
+	}
+	types.Overrides = append(types.Overrides, xlsxOverride{
+		PartName:    "/" + partName,
+		ContentType: drawingContentType,
+	})
+	body, err := xml.Marshal(drawingRels)
+	if err != nil {
+		return rels, fmt.Errorf("xml.Marshal: %w", err)
+	}
+	err = writePart(relsPartName(partName), append([]byte(xml.Header), body...))
+	if err != nil {
+		return rels, err
+	}
+	rels.Relationships = append(rels.Relationships, xlsxWorksheetRelation{
+		Id:     newRelationshipID(rels),
+		Type:   drawingRelationshipType,
+		Target: partTarget(partName),
+	})
+	return rels, nil
+}
+
+// makeDrawingElement refers the worksheet to the drawing of the
+// images, if relations has one.
+func (s *Sheet) makeDrawingElement(worksheet *xlsxWorksheet, relations *xlsxWorksheetRels) {
+	if relations == nil {
+		return
+	}
+	for _, rel := range relations.Relationships {
+		if rel.Type == drawingRelationshipType {
+			worksheet.Drawing = &xlsxDrawing{RelationshipId: rel.Id}
+			return
+		}
+	}
+}
+
+// readRels returns the relationships of the part called name, which
+// are in the part of the same name in the _rels directory next to it,
+// or nil if it hasn't any.
+func readRels(fi *File, name string) (*xlsxWorksheetRels, error) {
+	part, ok := fi.parts[relsPartName(name)]
+	if !ok {
+		return nil, nil
+	}
+	content, err := readZipPart(part)
+	if err != nil {
+		return nil, err
+	}
+	rels := new(xlsxWorksheetRels)
+	err = xml.Unmarshal(content, rels)
+	if err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	return rels, nil
+}
+
+// readImages returns the pictures in the drawing that the relationships
+// of a worksheet refer to.  Anchors that aren't pictures, such as
+// shapes and charts, or that are absolute, aren't read, but if the
+// drawing has any, it is returned as a keptDrawing as well, so that it
+// can be written back out as it was.
+func readImages(fi *File, rsheet xlsxSheet, sheetXMLMap map[string]string) ([]*Image, *keptDrawing, error) {
+	wrap := func(err error) ([]*Image, *keptDrawing, error) {
+		return nil, nil, fmt.Errorf("readImages: %w", err)
+	}
+
+	sheetName := worksheetNameForSheet(rsheet, sheetXMLMap)
+	worksheet, ok := fi.worksheets[sheetName]
+	if !ok {
+		return nil, nil, nil
+	}
+	worksheetName := normalisePartName(worksheet.Name)
+	rels, err := readRels(fi, worksheetName)
+	if err != nil {
+		return wrap(err)
+	}
+	if rels == nil {
+		return nil, nil, nil
+	}
+
+	// A worksheet has only the one drawing.
+	for _, rel := range rels.Relationships {
+		if rel.Type != drawingRelationshipType {
+			continue
+		}
+		drawingName := resolveRelationshipTarget(path.Dir(worksheetName), rel.Target)
+		part, ok := fi.parts[drawingName]
+		if !ok {
+			continue
+		}
+		content, err := readZipPart(part)
+		if err != nil {
+			return wrap(err)
+		}
+		wsDr := new(xlsxWsDr)
+		err = xml.Unmarshal(content, wsDr)
+		if err != nil {
+			return wrap(fmt.Errorf("xml.Unmarshal: %w", err))
+		}
+		drawingRels, err := readRels(fi, drawingName)
+		if err != nil {
+			return wrap(err)
+		}
+		if drawingRels == nil {
+			drawingRels = &xlsxWorksheetRels{}
+		}
+		targets := make(map[string]string)
+		for _, rel := range drawingRels.Relationships {
+			if rel.Type == imageRelationshipType {
+				targets[rel.Id] = resolveRelationshipTarget(path.Dir(drawingName), rel.Target)
+			}
+		}
+		var images []*Image
+		for _, anchor := range wsDr.Anchors {
+			img, err := readImage(fi, anchor, targets)
+			if err != nil {
+				return wrap(err)
+			}
+			if img != nil {
+				images = append(images, img)
+			}
+		}
+		if len(images) == len(wsDr.Anchors) {
+			return images, nil, nil
+		}
+		return images, &keptDrawing{
+			name:   drawingName,
+			data:   content,
+			rels:   drawingRels.Relationships,
+			images: len(images),
+		}, nil
+	}
+	return nil, nil, nil
+}
+
+// readImage returns the picture placed by anchor, whose image is in
+// the part that targets has for its relationship, or nil if it isn't
+// a picture.
+func readImage(fi *File, anchor xlsxDrawingAnchor, targets map[string]string) (*Image, error) {
+	if anchor.Pic == nil || anchor.From == nil {
+		return nil, nil
+	}
+	target, ok := targets[anchor.Pic.Blip.Embed]
+	if !ok {
+		return nil, nil
+	}
+	part, ok := fi.parts[target]
+	if !ok {
+		return nil, nil
+	}
+	data, err := readZipPart(part)
+	if err != nil {
+		return nil, err
+	}
+	format := strings.ToLower(strings.TrimPrefix(path.Ext(target), "."))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	img := &Image{
+		Data:        data,
+		Format:      format,
+		Name:        anchor.Pic.CNvPr.Name,
+		Description: anchor.Pic.CNvPr.Descr,
+	}
+	img.Anchor.From = anchor.From.point()
+	switch anchor.XMLName.Local {
+	case "oneCellAnchor":
+		img.Anchor.Type = OneCellAnchor
+		ext := anchor.Ext
+		if ext == nil {
+			ext = anchor.Pic.Ext
+		}
+		if ext != nil {
+			img.Anchor.Width = int(ext.Cx / emusPerPixel)
+			img.Anchor.Height = int(ext.Cy / emusPerPixel)
+		}
+	case "twoCellAnchor":
+		if anchor.To == nil {
+			return nil, nil
+		}
+		img.Anchor.Type = TwoCellAnchor
+		img.Anchor.To = anchor.To.point()
+	default:
+		return nil, nil
+	}
+	return img, nil
+}
+
+// point returns the point that the marker is at, with its offsets in
+// pixels.
+func (m *xlsxDrawingMarker) point() ImageAnchorPoint {
+	return ImageAnchorPoint{
+		Col:       m.Col,
+		Row:       m.Row,
+		ColOffset: int(m.ColOff / emusPerPixel),
+		RowOffset: int(m.RowOff / emusPerPixel),
+	}
+}
@@ -0,0 +1,135 @@
+package xlsx
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// makeTestImage returns a width by height image encoded as format,
+// "png" or "jpeg".
+func makeTestImage(c *qt.C, format string, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if format == "png" {
+		c.Assert(png.Encode(&buf, img), qt.IsNil)
+	} else {
+		c.Assert(jpeg.Encode(&buf, img, nil), qt.IsNil)
+	}
+	return buf.Bytes()
+}
+
+func TestImages(t *testing.T) {
+	c := qt.New(t)
+
+	readParts := func(c *qt.C, b []byte) map[string]string {
+		parts := make(map[string]string)
+		rewriteXLSX(c, b, func(name string, body []byte) (string, []byte) {
+			parts[name] = string(body)
+			return name, body
+		})
+		return parts
+	}
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		logo := makeTestImage(c, "png", 40, 20)
+		qr := makeTestImage(c, "jpeg", 16, 16)
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Report")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("Report")
+		cell.SetComment("Author", "A note")
+		err = sheet.AddImage(logo, "png", ImageAnchor{
+			From: ImageAnchorPoint{Col: 1, Row: 0, ColOffset: 4, RowOffset: 2},
+		})
+		c.Assert(err, qt.IsNil)
+		err = sheet.AddImage(qr, "jpg", ImageAnchor{
+			Type: TwoCellAnchor,
+			From: ImageAnchorPoint{Col: 3, Row: 2},
+			To:   ImageAnchorPoint{Col: 5, Row: 6, ColOffset: 10},
+		})
+		c.Assert(err, qt.IsNil)
+		images := sheet.Images()
+		c.Assert(images, qt.HasLen, 2)
+		// A one cell anchor without a size takes that of the image.
+		c.Assert(images[0].Anchor.Width, qt.Equals, 40)
+		c.Assert(images[0].Anchor.Height, qt.Equals, 20)
+		c.Assert(images[1].Format, qt.Equals, "jpeg")
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		streamParts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		for _, parts := range []map[string]string{readParts(c, buf.Bytes()), streamParts} {
+			c.Assert(parts["xl/media/image1.png"], qt.Equals, string(logo))
+			c.Assert(parts["xl/media/image2.jpeg"], qt.Equals, string(qr))
+			drawing := parts["xl/drawings/drawing1.xml"]
+			c.Assert(drawing, qt.Contains, `<xdr:oneCellAnchor><xdr:from><xdr:col>1</xdr:col><xdr:colOff>38100</xdr:colOff><xdr:row>0</xdr:row><xdr:rowOff>19050</xdr:rowOff></xdr:from><xdr:ext cx="381000" cy="190500"/>`)
+			c.Assert(drawing, qt.Contains, `<xdr:to><xdr:col>5</xdr:col><xdr:colOff>95250</xdr:colOff><xdr:row>6</xdr:row><xdr:rowOff>0</xdr:rowOff></xdr:to>`)
+			c.Assert(drawing, qt.Contains, `<a:blip r:embed="rId2"/>`)
+			c.Assert(parts["xl/drawings/_rels/drawing1.xml.rels"], qt.Contains, `Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="../media/image1.png"`)
+			c.Assert(parts["xl/drawings/_rels/drawing1.xml.rels"], qt.Contains, `Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="../media/image2.jpeg"`)
+			c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], qt.Contains, `Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="../drawings/drawing1.xml"`)
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*</sheetData>.*<drawing r:id="rId3">?(/>|</drawing>)<legacyDrawing r:id="rId2">?(/>|</legacyDrawing>)</worksheet>`)
+			c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Default Extension="png" ContentType="image/png">`)
+			c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Default Extension="jpeg" ContentType="image/jpeg">`)
+			c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Override PartName="/xl/drawings/drawing1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml">`)
+		}
+
+		// Saving a file that was read keeps its images.
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[0].Images(), qt.DeepEquals, images)
+		var resaved bytes.Buffer
+		c.Assert(f.Write(&resaved), qt.IsNil)
+		f, err = OpenBinary(resaved.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[0].Images(), qt.DeepEquals, images)
+	})
+
+	c.Run("ImagesInSeveralSheets", func(c *qt.C) {
+		f := NewFile()
+		for _, name := range []string{"One", "Two"} {
+			sheet, err := f.AddSheet(name)
+			c.Assert(err, qt.IsNil)
+			err = sheet.AddImage(makeTestImage(c, "png", 2, 2), "png", ImageAnchor{})
+			c.Assert(err, qt.IsNil)
+		}
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/drawings/_rels/drawing2.xml.rels"], qt.Contains, `Target="../media/image2.png"`)
+		c.Assert(parts["xl/worksheets/sheet2.xml"], qt.Contains, `<drawing r:id="rId1">`)
+	})
+
+	c.Run("Errors", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Errors")
+		c.Assert(err, qt.IsNil)
+		logo := makeTestImage(c, "png", 2, 2)
+		err = sheet.AddImage(logo, "gif", ImageAnchor{})
+		c.Assert(err, qt.ErrorMatches, `AddImage: unsupported image format "gif", use "png" or "jpeg"`)
+		err = sheet.AddImage(logo, "jpeg", ImageAnchor{})
+		c.Assert(err, qt.ErrorMatches, `AddImage: the image is png, not jpeg`)
+		err = sheet.AddImage([]byte("not an image"), "png", ImageAnchor{})
+		c.Assert(err, qt.ErrorMatches, `AddImage: image.DecodeConfig: .*`)
+		err = sheet.AddImage(logo, "png", ImageAnchor{
+			Type: TwoCellAnchor,
+			From: ImageAnchorPoint{Col: 3, Row: 3},
+			To:   ImageAnchorPoint{Col: 2, Row: 4},
+		})
+		c.Assert(err, qt.ErrorMatches, `AddImage: the bottom right corner of the image is above or left of its top left corner`)
+		err = sheet.AddImage(logo, "png", ImageAnchor{From: ImageAnchorPoint{Col: -1}})
+		c.Assert(err, qt.ErrorMatches, `AddImage: an image can't be anchored to a negative column, row or offset`)
+		c.Assert(sheet.Images(), qt.HasLen, 0)
+	})
+}
@@ -0,0 +1,572 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// unkeptWorkbookRelationships are the types of the relationships of a
+// workbook whose parts are read, or can't be kept because the elements
+// of the workbook that refer to them aren't.  The parts that the
+// workbook's other relationships lead to, such as pivot caches, are
+// kept.
+var unkeptWorkbookRelationships = map[string]bool{
+	worksheetRelationshipType:     true,
+	sharedStringsRelationshipType: true,
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles":       true,
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships/theme":        true,
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships/chartsheet":   true,
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships/calcChain":    true,
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships/externalLink": true,
+	"http://schemas.microsoft.com/office/2006/relationships/vbaProject":                true,
+}
+
+// unkeptWorksheetRelationships are the types of the relationships of a
+// worksheet whose parts are read.  A drawing is only kept, as a
+// keptDrawing, if it has more in it than the images that are read, and
+// a VML drawing, as a keptVML, if it has more than the boxes of
+// comments.
+var unkeptWorksheetRelationships = map[RelationshipType]bool{
+	RelationshipTypeHyperlink:      true,
+	commentsRelationshipType:       true,
+	vmlDrawingRelationshipType:     true,
+	drawingRelationshipType:        true,
+	tableRelationshipType:          true,
+	namedSheetViewRelationshipType: true,
+}
+
+// writtenParts are the names of the parts that are always written
+// afresh, which are never kept.
+var writtenParts = map[string]bool{
+	"xl/workbook.xml":     true,
+	sharedStringsPart:     true,
+	"xl/styles.xml":       true,
+	"xl/theme/theme1.xml": true,
+}
+
+// keptPart is a part of a package that isn't read, such as a chart, a
+// pivot table or a pivot cache, or the relationships of one, which is
+// kept as it was read so that it can be written back out untouched.
+// Kept parts aren't changed when the File is, so a chart or pivot
+// table that refers to a Sheet by name goes on using the old name if
+// the Sheet is renamed.
+type keptPart struct {
+	name        string
+	contentType string
+	data        []byte
+}
+
+// keptDrawing is the drawing of a sheet that has more in it than the
+// images that are read, such as charts or shapes.  It is written back
+// out as it was read, with the images and charts added to the sheet
+// since placed after what was already in it.
+type keptDrawing struct {
+	name string
+	data []byte
+	rels []xlsxWorksheetRelation
+	// images is the number of the images of the sheet that were read
+	// from the drawing, which come before any that were added.
+	images int
+}
+
+// xlsxPivotCaches directly maps the pivotCaches element in the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main,
+// which refers to the pivot caches of the pivot tables in a workbook.
+type xlsxPivotCaches struct {
+	PivotCache []xlsxPivotCache `xml:"pivotCache"`
+}
+
+// xlsxPivotCache directly maps the pivotCache element, which refers to
+// a pivot cache definition by the relationship RelationshipId.
+type xlsxPivotCache struct {
+	CacheId        int    `xml:"cacheId,attr"`
+	RelationshipId string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+}
+
+// relsPartName returns the name of the part that holds the
+// relationships of the part called name, in the _rels directory next
+// to it.
+func relsPartName(name string) string {
+	return path.Join(path.Dir(name), "_rels", path.Base(name)+".rels")
+}
+
+// partTarget returns the target by which a part in a directory of xl,
+// such as a worksheet or a drawing, refers to the part called name.
+func partTarget(name string) string {
+	if strings.HasPrefix(name, "xl/") {
+		return "../" + strings.TrimPrefix(name, "xl/")
+	}
+	return "/" + name
+}
+
+// newRelationshipID returns the first id of the form rId followed by a
+// number, counting on from the number of relationships in rels, that
+// none of them has.
+func newRelationshipID(rels *xlsxWorksheetRels) string {
+	for n := len(rels.Relationships) + 1; ; n++ {
+		id := fmt.Sprintf("rId%d", n)
+		used := false
+		for _, rel := range rels.Relationships {
+			used = used || rel.Id == id
+		}
+		if !used {
+			return id
+		}
+	}
+}
+
+// partContentType returns the content type that [Content_Types].xml
+// gave the part called name when the File was read, or "" if it gave
+// it none.
+func (f *File) partContentType(name string) string {
+	if f.contentTypes == nil {
+		return ""
+	}
+	for _, override := range f.contentTypes.Overrides {
+		if strings.EqualFold(strings.TrimPrefix(override.PartName, "/"), name) {
+			return override.ContentType
+		}
+	}
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	for _, def := range f.contentTypes.Defaults {
+		if strings.EqualFold(def.Extension, ext) {
+			return def.ContentType
+		}
+	}
+	return ""
+}
+
+// keepsPart reports whether the part called name can be kept, which
+// worksheets, and the parts that are always written afresh, can't.
+func (f *File) keepsPart(name string) bool {
+	if writtenParts[name] {
+		return false
+	}
+	for _, worksheet := range f.worksheets {
+		if normalisePartName(worksheet.Name) == name {
+			return false
+		}
+	}
+	return true
+}
+
+// readKeptParts returns the parts that rels, the relationships of the
+// part called owner, lead to, each followed by its own relationships,
+// and then the parts that those lead to in turn.  Parts that seen has
+// are left out, and those that are returned are added to it.
+func (f *File) readKeptParts(owner string, rels []xlsxWorksheetRelation, seen map[string]bool) ([]*keptPart, error) {
+	var parts []*keptPart
+	var queue []string
+	follow := func(owner string, rels []xlsxWorksheetRelation) {
+		for _, rel := range rels {
+			if rel.TargetMode == RelationshipTargetModeExternal {
+				continue
+			}
+			queue = append(queue, resolveRelationshipTarget(path.Dir(owner), rel.Target))
+		}
+	}
+	follow(owner, rels)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] || !f.keepsPart(name) {
+			continue
+		}
+		part, ok := f.parts[name]
+		if !ok {
+			continue
+		}
+		seen[name] = true
+		data, err := readZipPart(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &keptPart{name: name, contentType: f.partContentType(name), data: data})
+
+		relsName := relsPartName(name)
+		relsPart, ok := f.parts[relsName]
+		if !ok {
+			continue
+		}
+		data, err = readZipPart(relsPart)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, &keptPart{name: relsName, contentType: f.partContentType(relsName), data: data})
+		partRels := new(xlsxWorksheetRels)
+		err = xml.Unmarshal(data, partRels)
+		if err != nil {
+			return nil, fmt.Errorf("xml.Unmarshal: %w", err)
+		}
+		follow(name, partRels.Relationships)
+	}
+	return parts, nil
+}
+
+// readKeptWorkbookParts keeps the relationships of the workbook, which
+// is the part called workbookName, that aren't read, and the parts
+// that they lead to.
+func (f *File) readKeptWorkbookParts(workbookName string, rels []xlsxWorkbookRelation) error {
+	var kept []xlsxWorksheetRelation
+	for _, rel := range rels {
+		if unkeptWorkbookRelationships[rel.Type] {
+			continue
+		}
+		kept = append(kept, xlsxWorksheetRelation{
+			Id:         rel.Id,
+			Type:       RelationshipType(rel.Type),
+			Target:     rel.Target,
+			TargetMode: RelationshipTargetMode(rel.TargetMode),
+		})
+	}
+	parts, err := f.readKeptParts(workbookName, kept, make(map[string]bool))
+	if err != nil {
+		return fmt.Errorf("readKeptWorkbookParts: %w", err)
+	}
+	f.keptRels = kept
+	f.keptParts = parts
+	return nil
+}
+
+// readKeptSheetParts returns the relationships of a worksheet that
+// aren't read, and the parts that they, drawing, if the sheet's drawing
+// is kept, and vml, if its VML drawing is, lead to.
+func readKeptSheetParts(fi *File, rsheet xlsxSheet, sheetXMLMap map[string]string, drawing *keptDrawing, vml *keptVML) ([]xlsxWorksheetRelation, []*keptPart, error) {
+	wrap := func(err error) ([]xlsxWorksheetRelation, []*keptPart, error) {
+		return nil, nil, fmt.Errorf("readKeptSheetParts: %w", err)
+	}
+
+	worksheet, ok := fi.worksheets[worksheetNameForSheet(rsheet, sheetXMLMap)]
+	if !ok {
+		return nil, nil, nil
+	}
+	worksheetName := normalisePartName(worksheet.Name)
+	rels, err := readRels(fi, worksheetName)
+	if err != nil {
+		return wrap(err)
+	}
+	var kept []xlsxWorksheetRelation
+	if rels != nil {
+		for _, rel := range rels.Relationships {
+			if !unkeptWorksheetRelationships[rel.Type] {
+				kept = append(kept, rel)
+			}
+		}
+	}
+	seen := make(map[string]bool)
+	parts, err := fi.readKeptParts(worksheetName, kept, seen)
+	if err != nil {
+		return wrap(err)
+	}
+	if drawing != nil {
+		seen[drawing.name] = true
+		drawingParts, err := fi.readKeptParts(drawing.name, drawing.rels, seen)
+		if err != nil {
+			return wrap(err)
+		}
+		parts = append(parts, drawingParts...)
+	}
+	if vml != nil {
+		seen[vml.name] = true
+		vmlParts, err := fi.readKeptParts(vml.name, vml.rels, seen)
+		if err != nil {
+			return wrap(err)
+		}
+		parts = append(parts, vmlParts...)
+	}
+	return kept, parts, nil
+}
+
+// keptPartNames returns the names of the parts kept by the File and
+// its Sheets, which the parts that are made afresh mustn't be given.
+func (f *File) keptPartNames() map[string]bool {
+	names := make(map[string]bool)
+	for _, part := range f.keptParts {
+		names[part.name] = true
+	}
+	for _, sheet := range f.Sheets {
+		for _, part := range sheet.keptParts {
+			names[part.name] = true
+		}
+		if sheet.drawing != nil {
+			names[sheet.drawing.name] = true
+			names[relsPartName(sheet.drawing.name)] = true
+		}
+		if sheet.vml != nil {
+			names[sheet.vml.name] = true
+			names[relsPartName(sheet.vml.name)] = true
+		}
+	}
+	return names
+}
+
+// keptVMLBlocks returns the blocks of VML shape ids that the VML
+// drawings kept by the Sheets of the File claim, which the shapes of
+// new comments mustn't be given.
+func (f *File) keptVMLBlocks() map[int]bool {
+	blocks := make(map[int]bool)
+	for _, sheet := range f.Sheets {
+		if sheet.vml == nil {
+			continue
+		}
+		for _, block := range sheet.vml.shapeBlocks() {
+			blocks[block] = true
+		}
+	}
+	return blocks
+}
+
+// writeKeptParts passes those of parts that written hasn't got to
+// writePart, adding them to written, and adds their content types to
+// types.
+func writeKeptParts(parts []*keptPart, types *xlsxTypes, written map[string]bool, writePart func(partName string, part []byte) error) error {
+	for _, part := range parts {
+		if written[part.name] {
+			continue
+		}
+		written[part.name] = true
+		err := writePart(part.name, part.data)
+		if err != nil {
+			return err
+		}
+		if part.contentType == "" {
+			continue
+		}
+		ext := strings.TrimPrefix(path.Ext(part.name), ".")
+		hasDefault := false
+		for _, def := range types.Defaults {
+			hasDefault = hasDefault || strings.EqualFold(def.Extension, ext) && def.ContentType == part.contentType
+		}
+		if !hasDefault {
+			types.Overrides = append(types.Overrides, xlsxOverride{
+				PartName:    "/" + part.name,
+				ContentType: part.contentType,
+			})
+		}
+	}
+	return nil
+}
+
+// addKeptParts adds the relationships that the Sheet keeps to rels,
+// which it returns, giving them ids that rels hasn't used, and passes
+// the parts that they and its drawing lead to to writePart, unless
+// written has them already.
+func (s *Sheet) addKeptParts(rels *xlsxWorksheetRels, types *xlsxTypes, written map[string]bool, writePart func(partName string, part []byte) error) (*xlsxWorksheetRels, error) {
+	if len(s.keptRels) > 0 {
+		if rels == nil {
+			rels = &xlsxWorksheetRels{XMLName: xml.Name{Local: "Relationships"}}
+		}
+		for _, rel := range s.keptRels {
+			rel.Id = newRelationshipID(rels)
+			rels.Relationships = append(rels.Relationships, rel)
+		}
+	}
+	return rels, writeKeptParts(s.keptParts, types, written, writePart)
+}
+
+// makeKeptWorkbookRels returns the relationships that the File keeps
+// for its workbook, with ids numbered on from first, and refers the
+// pivot caches of workbook to them by their new ids.  Pivot caches
+// whose relationships aren't kept are left out.
+func (f *File) makeKeptWorkbookRels(workbook *xlsxWorkbook, first int) []xlsxWorkbookRelation {
+	ids := make(map[string]string, len(f.keptRels))
+	var rels []xlsxWorkbookRelation
+	for _, rel := range f.keptRels {
+		id := fmt.Sprintf("rId%d", first+len(rels))
+		ids[rel.Id] = id
+		rels = append(rels, xlsxWorkbookRelation{
+			Id:         id,
+			Target:     rel.Target,
+			Type:       string(rel.Type),
+			TargetMode: string(rel.TargetMode),
+		})
+	}
+	if f.pivotCaches != nil {
+		caches := &xlsxPivotCaches{}
+		for _, cache := range f.pivotCaches.PivotCache {
+			if id, ok := ids[cache.RelationshipId]; ok {
+				cache.RelationshipId = id
+				caches.PivotCache = append(caches.PivotCache, cache)
+			}
+		}
+		if len(caches.PivotCache) > 0 {
+			workbook.PivotCaches = caches
+		}
+	}
+	return rels
+}
+
+// drawingShapeID matches the ids of the shapes in a drawing.
+var drawingShapeID = regexp.MustCompile(`<(?:\w+:)?cNvPr\b[^>]*?\sid="(\d+)"`)
+
+// withAnchors returns the drawing with anchors for images and charts,
+// whose relationships have the ids relIDs, placed after what was
+// already in it.  Their shapes are given ids after those already used.
+func (d *keptDrawing) withAnchors(images []*Image, charts []*ChartSpec, relIDs []string) []byte {
+	end := bytes.LastIndex(d.data, []byte("</"))
+	if len(images)+len(charts) == 0 || end < 0 {
+		return d.data
+	}
+	firstShapeID := 1
+	for _, m := range drawingShapeID.FindAllSubmatch(d.data, -1) {
+		if id, err := strconv.Atoi(string(m[1])); err == nil && id >= firstShapeID {
+			firstShapeID = id + 1
+		}
+	}
+	var b strings.Builder
+	b.Write(d.data[:end])
+	writeDrawingAnchors(&b, images, charts, relIDs, firstShapeID, drawingNamespaces)
+	b.Write(d.data[end:])
+	return []byte(b.String())
+}
+
+// pivotTableRelationshipType is the type of the relationship of a
+// worksheet to a pivot table.
+const pivotTableRelationshipType RelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/pivotTable"
+
+// numberedPartName returns the name of the part called name with the
+// number at the end of its base name, if it has one, replaced by n,
+// so that xl/charts/chart1.xml with 2 gives xl/charts/chart2.xml.
+func numberedPartName(name string, n int) string {
+	ext := path.Ext(name)
+	stem := strings.TrimRight(strings.TrimSuffix(name, ext), "0123456789")
+	return fmt.Sprintf("%s%d%s", stem, n, ext)
+}
+
+// retargetRels returns a copy of rels, the relationships of a part in
+// dir, in which those that lead to parts that renamed has are changed
+// to lead to the parts' new names.
+func retargetRels(dir string, rels []xlsxWorksheetRelation, renamed map[string]string) []xlsxWorksheetRelation {
+	rels = append([]xlsxWorksheetRelation(nil), rels...)
+	for i, rel := range rels {
+		if rel.TargetMode == RelationshipTargetModeExternal {
+			continue
+		}
+		name := resolveRelationshipTarget(dir, rel.Target)
+		if newName, ok := renamed[name]; ok && newName != name {
+			// Parts are only renamed within their directory.
+			rels[i].Target = path.Join(path.Dir(rel.Target), path.Base(newName))
+		}
+	}
+	return rels
+}
+
+// importKeptParts gives dst, a Sheet of another File, the drawing,
+// relationships and parts that the Sheet kept when it was read, so
+// that they are written out with dst as they were read.  Parts whose
+// names the File of dst already keeps are given the first free number
+// in their directory, and the relationships that lead to them are
+// changed to match; the parts are otherwise copied as they are, so a
+// chart that refers to a sheet by name goes on doing so.  Pivot tables
+// are left out, as their pivot caches belong to the workbook.
+func (s *Sheet) importKeptParts(dst *Sheet) error {
+	parts := make(map[string]*keptPart, len(s.keptParts))
+	for _, part := range s.keptParts {
+		parts[part.name] = part
+	}
+	used := dst.File.keptPartNames()
+	renamed := make(map[string]string)
+	rename := func(name string) {
+		newName := name
+		for n := 1; used[newName] || used[relsPartName(newName)]; n++ {
+			newName = numberedPartName(name, n)
+		}
+		used[newName] = true
+		used[relsPartName(newName)] = true
+		renamed[name] = newName
+	}
+
+	// The parts that the kept relationships and the drawing lead to,
+	// and then those that their own relationships lead to, in turn.
+	var order, queue []string
+	follow := func(dir string, rels []xlsxWorksheetRelation) {
+		for _, rel := range rels {
+			if rel.TargetMode != RelationshipTargetModeExternal {
+				queue = append(queue, resolveRelationshipTarget(dir, rel.Target))
+			}
+		}
+	}
+	var keptRels []xlsxWorksheetRelation
+	for _, rel := range s.keptRels {
+		if rel.Type != pivotTableRelationshipType {
+			keptRels = append(keptRels, rel)
+		}
+	}
+	follow("xl/worksheets", keptRels)
+	if s.drawing != nil {
+		rename(s.drawing.name)
+		follow(path.Dir(s.drawing.name), s.drawing.rels)
+	}
+	if s.vml != nil {
+		rename(s.vml.name)
+		follow(path.Dir(s.vml.name), s.vml.rels)
+	}
+	partRels := make(map[string][]xlsxWorksheetRelation)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if _, ok := renamed[name]; ok || parts[name] == nil {
+			continue
+		}
+		rename(name)
+		order = append(order, name)
+		relsPart, ok := parts[relsPartName(name)]
+		if !ok {
+			continue
+		}
+		rels := new(xlsxWorksheetRels)
+		err := xml.Unmarshal(relsPart.data, rels)
+		if err != nil {
+			return fmt.Errorf("xml.Unmarshal: %w", err)
+		}
+		partRels[name] = rels.Relationships
+		follow(path.Dir(name), rels.Relationships)
+	}
+
+	dst.keptRels = retargetRels("xl/worksheets", keptRels, renamed)
+	for _, name := range order {
+		part := *parts[name]
+		part.name = renamed[name]
+		dst.keptParts = append(dst.keptParts, &part)
+		rels, ok := partRels[name]
+		if !ok {
+			continue
+		}
+		relsPart := *parts[relsPartName(name)]
+		relsPart.name = relsPartName(part.name)
+		retargeted := retargetRels(path.Dir(name), rels, renamed)
+		changed := false
+		for i := range rels {
+			changed = changed || retargeted[i].Target != rels[i].Target
+		}
+		if changed {
+			body, err := xml.Marshal(&xlsxWorksheetRels{
+				XMLName:       xml.Name{Local: "Relationships"},
+				Relationships: retargeted,
+			})
+			if err != nil {
+				return fmt.Errorf("xml.Marshal: %w", err)
+			}
+			relsPart.data = append([]byte(xml.Header), body...)
+		}
+		dst.keptParts = append(dst.keptParts, &relsPart)
+	}
+	if s.drawing != nil {
+		drawing := *s.drawing
+		drawing.name = renamed[s.drawing.name]
+		drawing.rels = retargetRels(path.Dir(s.drawing.name), s.drawing.rels, renamed)
+		dst.drawing = &drawing
+	}
+	if s.vml != nil {
+		vml := *s.vml
+		vml.name = renamed[s.vml.name]
+		vml.rels = retargetRels(path.Dir(s.vml.name), s.vml.rels, renamed)
+		dst.vml = &vml
+	}
+	return nil
+}
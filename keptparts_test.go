@@ -0,0 +1,136 @@
+package xlsx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestKeptParts(t *testing.T) {
+	c := qt.New(t)
+
+	readParts := func(c *qt.C, b []byte) map[string]string {
+		parts := make(map[string]string)
+		rewriteXLSX(c, b, func(name string, body []byte) (string, []byte) {
+			parts[name] = string(body)
+			return name, body
+		})
+		return parts
+	}
+	// chart_and_pivot.xlsx was made by hand, not saved by Excel, with
+	// the parts that Excel writes for a chart and a pivot table, so it
+	// checks that parts of those kinds are kept, not that every part
+	// of a file that Excel saves is.
+	fixture, err := ioutil.ReadFile("./testdocs/chart_and_pivot.xlsx")
+	c.Assert(err, qt.IsNil)
+	original := readParts(c, fixture)
+	keptNames := []string{
+		"xl/charts/chart1.xml",
+		"xl/drawings/drawing1.xml",
+		"xl/pivotTables/pivotTable1.xml",
+		"xl/pivotTables/_rels/pivotTable1.xml.rels",
+		"xl/pivotCache/pivotCacheDefinition1.xml",
+		"xl/pivotCache/_rels/pivotCacheDefinition1.xml.rels",
+		"xl/pivotCache/pivotCacheRecords1.xml",
+	}
+
+	csRunO(c, "ValueOnlyEdit", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(fixture, option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[1].Images(), qt.HasLen, 0)
+		cell, err := f.Sheet["Data"].Cell(1, 1)
+		c.Assert(err, qt.IsNil)
+		cell.SetInt(15)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		streamParts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		for _, parts := range []map[string]string{readParts(c, buf.Bytes()), streamParts} {
+			for _, name := range keptNames {
+				c.Assert(parts[name], qt.Equals, original[name], qt.Commentf("%s", name))
+			}
+			c.Assert(parts["xl/drawings/_rels/drawing1.xml.rels"], qt.Contains, `Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart1.xml"`)
+
+			// The worksheet refers to its drawing and pivot table by
+			// the ids of its new relationships.
+			c.Assert(parts["xl/worksheets/_rels/sheet2.xml.rels"], qt.Contains, `Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/drawing" Target="../drawings/drawing1.xml"`)
+			c.Assert(parts["xl/worksheets/_rels/sheet2.xml.rels"], qt.Contains, `Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/pivotTable" Target="../pivotTables/pivotTable1.xml"`)
+			c.Assert(parts["xl/worksheets/sheet2.xml"], qt.Matches, `(?s).*<drawing r:id="rId1">?(/>|</drawing>)</worksheet>`)
+
+			// The workbook's relationship to the pivot cache comes
+			// after those to its sheets, shared strings, theme and
+			// styles.
+			c.Assert(parts["xl/workbook.xml"], qt.Contains, `<pivotCaches><pivotCache cacheId="7" r:id="rId6"></pivotCache></pivotCaches>`)
+			c.Assert(parts["xl/_rels/workbook.xml.rels"], qt.Contains, `Id="rId6" Target="pivotCache/pivotCacheDefinition1.xml" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/pivotCacheDefinition"`)
+
+			types := parts["[Content_Types].xml"]
+			c.Assert(types, qt.Contains, `<Override PartName="/xl/charts/chart1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawingml.chart+xml">`)
+			c.Assert(types, qt.Contains, `<Override PartName="/xl/drawings/drawing1.xml" ContentType="application/vnd.openxmlformats-officedocument.drawing+xml">`)
+			c.Assert(types, qt.Contains, `<Override PartName="/xl/pivotTables/pivotTable1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.pivotTable+xml">`)
+			c.Assert(types, qt.Contains, `<Override PartName="/xl/pivotCache/pivotCacheDefinition1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.pivotCacheDefinition+xml">`)
+			c.Assert(types, qt.Contains, `<Override PartName="/xl/pivotCache/pivotCacheRecords1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.pivotCacheRecords+xml">`)
+			c.Assert(types, qt.Not(qt.Contains), `PartName="/xl/pivotTables/_rels/pivotTable1.xml.rels"`)
+		}
+
+		// The parts are kept again by a file that is saved twice.
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		cell, err = saved.Sheet["Data"].Cell(1, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "15")
+		var resaved bytes.Buffer
+		c.Assert(saved.Write(&resaved), qt.IsNil)
+		parts := readParts(c, resaved.Bytes())
+		for _, name := range keptNames {
+			c.Assert(parts[name], qt.Equals, original[name], qt.Commentf("%s", name))
+		}
+		c.Assert(parts["xl/workbook.xml"], qt.Contains, `<pivotCache cacheId="7" r:id="rId6">`)
+	})
+
+	csRunO(c, "AddToKeptDrawing", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(fixture, option)
+		c.Assert(err, qt.IsNil)
+		report := f.Sheet["Report"]
+		logo := makeTestImage(c, "png", 4, 4)
+		c.Assert(report.AddImage(logo, "png", ImageAnchor{From: ImageAnchorPoint{Col: 12}}), qt.IsNil)
+		c.Assert(report.AddChart(ChartSpec{
+			Type:   ChartTypePie,
+			Series: []ChartSeries{{ValuesRef: "Data!$B$2:$B$4"}},
+			Anchor: ImageAnchor{From: ImageAnchorPoint{Col: 12, Row: 20}},
+		}), qt.IsNil)
+		c.Assert(f.Sheet["Data"].AddChart(ChartSpec{
+			Series: []ChartSeries{{ValuesRef: "Data!$B$2:$B$4"}},
+			Anchor: ImageAnchor{From: ImageAnchorPoint{Col: 4}},
+		}), qt.IsNil)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/charts/chart1.xml"], qt.Equals, original["xl/charts/chart1.xml"])
+		drawing := parts["xl/drawings/drawing1.xml"]
+		c.Assert(drawing, qt.Contains, original["xl/drawings/drawing1.xml"][:len(original["xl/drawings/drawing1.xml"])-len("</xdr:wsDr>")])
+		c.Assert(drawing, qt.Contains, `<xdr:oneCellAnchor xmlns:xdr="http://schemas.openxmlformats.org/drawingml/2006/spreadsheetDrawing"`)
+		c.Assert(drawing, qt.Contains, `<xdr:cNvPr id="3" name="Picture 1" descr=""/>`)
+		c.Assert(drawing, qt.Contains, `<a:blip r:embed="rId2"/>`)
+		c.Assert(drawing, qt.Contains, `<xdr:cNvPr id="4" name="Chart 1"/>`)
+		c.Assert(drawing, qt.Contains, `r:id="rId3"/></a:graphicData>`)
+		drawingRels := parts["xl/drawings/_rels/drawing1.xml.rels"]
+		c.Assert(drawingRels, qt.Contains, `Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart1.xml"`)
+		c.Assert(drawingRels, qt.Contains, `Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="../media/image1.png"`)
+		c.Assert(drawingRels, qt.Contains, `Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/chart" Target="../charts/chart3.xml"`)
+
+		// The new parts of the Data sheet take names that the kept
+		// ones haven't.
+		c.Assert(parts["xl/charts/chart2.xml"], qt.Contains, `<c:f>Data!$B$2:$B$4</c:f>`)
+		c.Assert(parts["xl/worksheets/_rels/sheet1.xml.rels"], qt.Contains, `Target="../drawings/drawing2.xml"`)
+		c.Assert(parts["xl/drawings/_rels/drawing2.xml.rels"], qt.Contains, `Target="../charts/chart2.xml"`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(saved.Sheet["Report"].Images(), qt.HasLen, 1)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"path"
 	"path/filepath"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -22,6 +23,14 @@ const (
 	externalSheetBangChar = "!"
 )
 
+const (
+	sharedStringsPart             = "xl/sharedStrings.xml"
+	contentTypesPart              = "[Content_Types].xml"
+	worksheetRelationshipType     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"
+	sharedStringsRelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings"
+	worksheetContentType          = "application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"
+)
+
 // XLSXReaderError is the standard error type for otherwise undefined
 // errors in the XSLX reading process.
 type XLSXReaderError struct {
@@ -91,6 +100,64 @@ func ColIndexToLetters(n int) string {
 	return s
 }
 
+// ColLettersToIndexChecked converts a character based column
+// reference, such as "BD", to a zero based numeric column identifier,
+// as ColLettersToIndex does, but returns an error if the reference
+// isn't made of letters or is beyond the last column, XFD.
+func ColLettersToIndexChecked(letters string) (int, error) {
+	if letters == "" || len(letters) > 3 {
+		return -1, fmt.Errorf("invalid column %q", letters)
+	}
+	for _, c := range letters {
+		if letterOnlyMapF(c) < 0 {
+			return -1, fmt.Errorf("invalid column %q", letters)
+		}
+	}
+	n := ColLettersToIndex(letters)
+	if n > Excel2006MaxColIndex {
+		return -1, fmt.Errorf("column %q is beyond the last column, XFD", letters)
+	}
+	return n, nil
+}
+
+// ColIndexToLettersChecked converts a zero based, numeric column
+// identifier into a character code, as ColIndexToLetters does, but
+// returns an error if the column is beyond the last column, XFD.
+func ColIndexToLettersChecked(n int) (string, error) {
+	if n < 0 || n > Excel2006MaxColIndex {
+		return "", fmt.Errorf("column index %d is out of range", n)
+	}
+	return ColIndexToLetters(n), nil
+}
+
+// getCoordsFromCellRef returns the zero based cartesian coordinates of
+// an A1-style cell reference, such as "BD17" or "$BD$17", as
+// GetCoordsFromCellIDString does, but returns an error if the
+// reference isn't one, or is beyond the last column or row.
+func getCoordsFromCellRef(ref string) (x, y int, err error) {
+	wrap := func(err error) (int, int, error) {
+		return -1, -1, fmt.Errorf("invalid cell reference %q: %w", ref, err)
+	}
+	s := strings.TrimPrefix(ref, fixedCellRefChar)
+	i := strings.IndexFunc(s, func(r rune) bool { return letterOnlyMapF(r) < 0 })
+	if i < 0 {
+		return wrap(errors.New("it has no row"))
+	}
+	x, err = ColLettersToIndexChecked(s[:i])
+	if err != nil {
+		return wrap(err)
+	}
+	rowPart := strings.TrimPrefix(s[i:], fixedCellRefChar)
+	if rowPart == "" || strings.IndexFunc(rowPart, func(r rune) bool { return intOnlyMapF(r) < 0 }) >= 0 {
+		return wrap(fmt.Errorf("invalid row %q", rowPart))
+	}
+	y, err = strconv.Atoi(rowPart)
+	if err != nil || y < 1 || y > Excel2006MaxRowCount {
+		return wrap(fmt.Errorf("row %s is out of range", rowPart))
+	}
+	return x, y - 1, nil
+}
+
 // RowIndexToString is used to convert a zero based, numeric row
 // indentifier into its string representation.
 func RowIndexToString(rowRef int) string {
@@ -281,64 +348,122 @@ func formulaForCell(rawcell xlsxC, sharedFormulas map[int]sharedFormula) string
 		return ""
 	}
 	if f.T == "shared" {
+		si := 0
+		if f.Si != nil {
+			si = *f.Si
+		}
 		x, y, err := GetCoordsFromCellIDString(rawcell.R)
 		if err != nil {
 			res = f.Content
 		} else {
 			if f.Ref != "" {
 				res = f.Content
-				sharedFormulas[f.Si] = sharedFormula{x, y, res}
+				sharedFormulas[si] = sharedFormula{x, y, res}
 			} else {
-				sharedFormula := sharedFormulas[f.Si]
+				sharedFormula := sharedFormulas[si]
 				dx := x - sharedFormula.x
 				dy := y - sharedFormula.y
-				orig := []byte(sharedFormula.formula)
-				var start, end int
-				var stringLiteral bool
-				for end = 0; end < len(orig); end++ {
-					c := orig[end]
-
-					if c == '"' {
-						stringLiteral = !stringLiteral
-					}
+				res = shiftFormula(sharedFormula.formula, dx, dy)
+			}
+		}
+	} else {
+		res = f.Content
+	}
+	return strings.Trim(res, " \t\n\r")
+}
 
-					if stringLiteral {
-						continue // Skip characters in quotes
-					}
+// shiftFormula returns formula with its relative references shifted
+// according to dx and dy, as for a shared formula that is copied from
+// one cell to another.  Only A1 references are shifted, so structured
+// references to tables and the names of sheets, tables and columns are
+// left alone.
+func shiftFormula(formula string, dx, dy int) string {
+	tokens, err := tokenizeFormula(formula)
+	if err != nil {
+		return shiftFormulaText(formula, dx, dy)
+	}
+	for i, token := range tokens {
+		if token.kind == formulaTokenReference {
+			tokens[i].text = shiftReference(token.text, dx, dy)
+		}
+	}
+	return joinFormulaTokens(tokens)
+}
+
+// shiftReference shifts the text of a formulaTokenReference, keeping
+// its sheet name.
+func shiftReference(text string, dx, dy int) string {
+	prefix := ""
+	if strings.HasPrefix(text, "'") {
+		n, _ := scanQuoted(text, '\'')
+		prefix = text[:n+1]
+	} else if i := strings.IndexByte(text, '!'); i >= 0 {
+		prefix = text[:i+1]
+	}
+	parts := strings.Split(text[len(prefix):], ":")
+	for i, part := range parts {
+		fixed := strings.HasPrefix(part, fixedCellRefChar)
+		switch {
+		case scanCellRef(part) == len(part):
+			parts[i] = shiftCell(part, dx, dy)
+		case fixed:
+		case isDigit(part[0]):
+			row, _ := strconv.Atoi(part)
+			parts[i] = strconv.Itoa(row + dy)
+		default:
+			parts[i] = ColIndexToLetters(ColLettersToIndex(part) + dx)
+		}
+	}
+	return prefix + strings.Join(parts, ":")
+}
+
+// shiftFormulaText shifts the references in a formula that can't be
+// tokenized, by looking for anything that looks like one outside of
+// string literals.
+func shiftFormulaText(formula string, dx, dy int) string {
+	var res string
+	orig := []byte(formula)
+	var start, end int
+	var stringLiteral bool
+	for end = 0; end < len(orig); end++ {
+		c := orig[end]
+
+		if c == '"' {
+			stringLiteral = !stringLiteral
+		}
+
+		if stringLiteral {
+			continue // Skip characters in quotes
+		}
 
-					if c >= 'A' && c <= 'Z' || c == '$' {
-						res += string(orig[start:end])
-						start = end
-						end++
-						foundNum := false
-						for ; end < len(orig); end++ {
-							idc := orig[end]
-							if idc >= '0' && idc <= '9' || idc == '$' {
-								foundNum = true
-							} else if idc >= 'A' && idc <= 'Z' {
-								if foundNum {
-									break
-								}
-							} else {
-								break
-							}
-						}
-						if foundNum {
-							cellID := string(orig[start:end])
-							res += shiftCell(cellID, dx, dy)
-							start = end
-						}
+		if c >= 'A' && c <= 'Z' || c == '$' {
+			res += string(orig[start:end])
+			start = end
+			end++
+			foundNum := false
+			for ; end < len(orig); end++ {
+				idc := orig[end]
+				if idc >= '0' && idc <= '9' || idc == '$' {
+					foundNum = true
+				} else if idc >= 'A' && idc <= 'Z' {
+					if foundNum {
+						break
 					}
+				} else {
+					break
 				}
-				if start < len(orig) {
-					res += string(orig[start:])
-				}
+			}
+			if foundNum {
+				cellID := string(orig[start:end])
+				res += shiftCell(cellID, dx, dy)
+				start = end
 			}
 		}
-	} else {
-		res = f.Content
 	}
-	return strings.Trim(res, " \t\n\r")
+	if start < len(orig) {
+		res += string(orig[start:])
+	}
+	return res
 }
 
 // shiftCell returns the cell shifted according to dx and dy taking into consideration of absolute
@@ -390,21 +515,43 @@ func shiftCell(cellID string, dx, dy int) string {
 	return result
 }
 
-// fillCellData attempts to extract a valid value, usable in
-// CSV form from the raw cell value.  Note - this is not actually
-// general enough - we should support retaining tabs and newlines.
-func fillCellData(rawCell xlsxC, refTable *RefTable, sharedFormulas map[int]sharedFormula, cell *Cell) {
+// missingSharedStringPlaceholder is the format of the value given to a
+// cell that refers to a shared string that doesn't exist, with the
+// index of the string.
+const missingSharedStringPlaceholder = "[missing shared string %d]"
+
+// invalidSharedStringPlaceholder is the format of the value given to a
+// cell whose shared string index isn't a number, with the index.
+const invalidSharedStringPlaceholder = "[invalid shared string index %q]"
+
+// errInvalidSharedStringIndex is returned by fillCellData for a cell
+// whose shared string index isn't a number.
+var errInvalidSharedStringIndex = errors.New("the shared string index isn't a number")
+
+// fillCellData populates a Cell from the raw cell data.  If the cell
+// refers to a shared string that doesn't exist, it is given the value
+// of missingSharedStringPlaceholder and an error describing the
+// problem is returned; if its index isn't a number, it is given that of
+// invalidSharedStringPlaceholder and an errInvalidSharedStringIndex.
+func fillCellData(rawCell xlsxC, refTable *RefTable, sharedFormulas map[int]sharedFormula, cell *Cell) (err error) {
 	val := strings.Trim(rawCell.V, " \t\n\r")
 	cell.formula = formulaForCell(rawCell, sharedFormulas)
 	switch rawCell.T {
 	case "s": // Shared String
 		cell.cellType = CellTypeString
 		if val != "" {
-			ref, err := strconv.Atoi(val)
-			if err != nil {
-				panic(err)
+			ref, convErr := strconv.Atoi(val)
+			if convErr != nil {
+				cell.Value = fmt.Sprintf(invalidSharedStringPlaceholder, val)
+				return fmt.Errorf("%w: %q", errInvalidSharedStringIndex, val)
+			}
+			var ok bool
+			cell.Value, cell.RichText, ok = refTable.lookupSharedString(ref)
+			if !ok {
+				cell.Value = fmt.Sprintf(missingSharedStringPlaceholder, ref)
+				err = errMissingSharedString(refTable, ref)
 			}
-			cell.Value, cell.RichText = refTable.ResolveSharedString(ref)
+			cell.phonetic = refTable.sharedStringPhonetic(ref)
 		}
 	case "inlineStr":
 		cell.cellType = CellTypeInline
@@ -417,8 +564,9 @@ func fillCellData(rawCell xlsxC, refTable *RefTable, sharedFormulas map[int]shar
 		cell.cellType = CellTypeError
 	case "str":
 		// String Formula (special type for cells with formulas that return a string value)
-		// Unlike the other string cell types, the string is stored directly in the value.
-		cell.Value = val
+		// Unlike the other string cell types, the string is stored directly in the value,
+		// whose whitespace is part of the string.
+		cell.Value = rawCell.V
 		cell.cellType = CellTypeStringFormula
 	case "d": // Date: Cell contains a date in the ISO 8601 format.
 		cell.Value = val
@@ -434,6 +582,35 @@ func fillCellData(rawCell xlsxC, refTable *RefTable, sharedFormulas map[int]shar
 	cell.origValue = cell.Value
 	cell.origRichText = cell.RichText
 	cell.modified = false
+	return err
+}
+
+// errMissingSharedString describes a reference to a shared string that
+// isn't in the shared string table.
+func errMissingSharedString(refTable *RefTable, index int) error {
+	if refTable == nil {
+		return fmt.Errorf("shared string %d does not exist, the file has no shared string table", index)
+	}
+	return fmt.Errorf("shared string %d does not exist, the shared string table has %d entries", index, refTable.Length())
+}
+
+// missingSharedStrings records a Warning, the first time that it is
+// called, that the File's cells refer to shared strings but it has no
+// shared string table.  Like addWarning, it returns the Warning as an
+// error instead if the File's options ask for that.
+func (f *File) missingSharedStrings() error {
+	var err error
+	f.sharedStringsMissing.Do(func() {
+		cause := errors.New("cells refer to shared strings, but the file has no shared string table")
+		err = f.addWarning(Warning{
+			Code:     WarningMissingSharedStrings,
+			Severity: SeverityDataLoss,
+			Part:     sharedStringsPart,
+			Message:  fmt.Sprintf("%s; they were given values such as %q in place of the strings", cause, fmt.Sprintf(missingSharedStringPlaceholder, 0)),
+			Err:      cause,
+		})
+	})
+	return err
 }
 
 // fillCellDataFromInlineString attempts to get inline string data and put it into a Cell.
@@ -442,10 +619,16 @@ func fillCellDataFromInlineString(rawcell xlsxC, cell *Cell) {
 	cell.RichText = nil
 	if rawcell.Is != nil {
 		if rawcell.Is.T != nil {
-			cell.Value = strings.Trim(rawcell.Is.T.getText(), " \t\n\r")
+			cell.Value = rawcell.Is.T.getText()
 		} else {
 			cell.RichText = xmlToRichText(rawcell.Is.R)
+			cell.Value = richTextToPlainText(cell.RichText)
 		}
+		var styles *xlsxStyleSheet
+		if f := cell.file(); f != nil {
+			styles = f.styles
+		}
+		cell.phonetic = makePhonetic(rawcell.Is, styles)
 	}
 	cell.origValue = cell.Value
 	cell.origRichText = cell.RichText
@@ -486,8 +669,10 @@ func readRowsFromSheet(Worksheet *xlsxWorksheet, file *File, sheet *Sheet, rowLi
 	colCount = maxCol + 1
 
 	if Worksheet.Cols != nil {
-		// Columns can apply to a range, for convenience we expand the
-		// ranges out into individual column definitions.
+		// Columns can apply to a range.  The ColStore splits the
+		// ranges that overlap, so that a later definition takes
+		// the place of an earlier one for the columns they share,
+		// rather than both being written when the file is saved.
 		for _, rawcol := range Worksheet.Cols.Col {
 
 			col := &Col{
@@ -505,7 +690,11 @@ func readRowsFromSheet(Worksheet *xlsxWorksheet, file *File, sheet *Sheet, rowLi
 			if file.styles != nil {
 				if rawcol.Style != nil && *rawcol.Style > 0 {
 					col.style = file.styles.getStyle(*rawcol.Style)
-					col.numFmt, col.parsedNumFmt = file.styles.getNumberFormat(*rawcol.Style)
+					if file.rawCellValues {
+						col.numFmt = file.styles.getNumberFormatCode(*rawcol.Style)
+					} else {
+						col.numFmt, col.parsedNumFmt = file.styles.getNumberFormat(*rawcol.Style)
+					}
 				}
 			}
 			sheet.Cols.Add(col)
@@ -530,11 +719,22 @@ func readRowsFromSheet(Worksheet *xlsxWorksheet, file *File, sheet *Sheet, rowLi
 		}
 		row.isCustom = rawrow.CustomHeight
 		row.SetOutlineLevel(rawrow.OutlineLevel)
+		if rawrow.Collapsed {
+			row.SetCollapsed(true)
+		}
+		if rawrow.CustomFormat && file.styles != nil {
+			row.style = file.styles.getStyle(rawrow.S)
+			row.numFmt = file.styles.getNumberFormatCode(rawrow.S)
+			row.isCustom = true
+		}
 
 		for _, rawcell := range rawrow.C {
 			if rawcell.R == "" {
 				continue
 			}
+			if file.valueOnly && !rawcell.hasValue() {
+				continue
+			}
 			h, v, err := Worksheet.MergeCells.getExtent(rawcell.R)
 			if err != nil {
 				return wrap(err)
@@ -550,15 +750,44 @@ func readRowsFromSheet(Worksheet *xlsxWorksheet, file *File, sheet *Sheet, rowLi
 			row.PushCell(cell)
 			cell.HMerge = h
 			cell.VMerge = v
-			fillCellData(rawcell, reftable, sharedFormulas, cell)
+			err = fillCellData(rawcell, reftable, sharedFormulas, cell)
+			if err != nil && reftable == nil && !errors.Is(err, errInvalidSharedStringIndex) {
+				// Without a shared string table, every cell that
+				// refers to one is missing its string, so the
+				// problem is reported once, for the File.
+				err = file.missingSharedStrings()
+			} else if err != nil {
+				err = fmt.Errorf("cell %s in sheet %q: %w", rawcell.R, sheet.Name, err)
+				err = file.addWarning(Warning{
+					Code:     WarningInvalidCellValue,
+					Severity: SeverityDataLoss,
+					Part:     sharedStringsPart,
+					Location: sheet.Name + "!" + rawcell.R,
+					Message:  fmt.Sprintf("%s; the cell was given the value %q", err, cell.Value),
+					Err:      err,
+				})
+			}
+			if err != nil {
+				return wrap(err)
+			}
 			if file.styles != nil {
 				cell.SetStyle(file.styles.getStyle(rawcell.S))
-				cell.NumFmt, cell.parsedNumFmt = file.styles.getNumberFormat(rawcell.S)
+				if file.rawCellValues {
+					cell.NumFmt = file.styles.getNumberFormatCode(rawcell.S)
+				} else {
+					cell.NumFmt, cell.parsedNumFmt = file.styles.getNumberFormat(rawcell.S)
+				}
+				cell.numFmtId = file.styles.getNumFmtId(rawcell.S)
 			}
 			cell.date1904 = file.Date1904
 
 			if hyperlink, found := linkTable[coord{x: x, y: y}]; found {
 				cell.Hyperlink = hyperlink
+				if hyperlink.Link != "" {
+					// The relationship is written again when the
+					// File is saved.
+					sheet.addRelation(RelationshipTypeHyperlink, hyperlink.Link, RelationshipTargetModeExternal)
+				}
 			}
 
 			// Cell is considered hidden if the row or the column of this cell is hidden
@@ -661,11 +890,24 @@ func makeHyperlinkTable(worksheet *xlsxWorksheet, fi *File, rsheet *xlsxSheet) (
 			if xlsxLink.Location != "" {
 				newHyperLink.Location = xlsxLink.Location
 			}
-			cellRef := xlsxLink.Reference
+			// A link that covers a range of cells is held by the
+			// first of them.
+			cellRef, lastRef := xlsxLink.Reference, ""
+			if i := strings.IndexByte(cellRef, ':'); i >= 0 {
+				cellRef, lastRef = cellRef[:i], cellRef[i+1:]
+			}
 			x, y, err := GetCoordsFromCellIDString(cellRef)
 			if err != nil {
 				return wrap(err)
 			}
+			if lastRef != "" {
+				lastX, lastY, err := GetCoordsFromCellIDString(lastRef)
+				if err != nil {
+					return wrap(err)
+				}
+				newHyperLink.HSpan = lastX - x
+				newHyperLink.VSpan = lastY - y
+			}
 			table[coord{x: x, y: y}] = newHyperLink
 		}
 
@@ -719,19 +961,54 @@ func readSheetFromFile(rsheet xlsxSheet, fi *File, sheetXMLMap map[string]string
 	}
 
 	sheet.Hidden = rsheet.State == sheetStateHidden || rsheet.State == sheetStateVeryHidden
+	sheet.veryHidden = rsheet.State == sheetStateVeryHidden
 	sheet.SheetViews = readSheetViews(worksheet.SheetViews)
+	sheet.sheetViews = keepSheetViews(worksheet.SheetViews.SheetView)
+	sheet.protection = keepSheetProtection(worksheet.SheetProtection)
+	sheet.pageSetup = readPageSetup(worksheet)
+	sheet.pageMargins = worksheet.PageMargins
+	sheet.printOptions = worksheet.PrintOptions
+	sheet.headerFooter = readHeaderFooter(worksheet)
+	sheet.customSheetViews = keepCustomSheetViews(worksheet.CustomSheetViews)
+	sheet.extensions = keepExtensions(worksheet.ExtLst)
+	sheet.namedSheetViews, err = readNamedSheetViews(fi, rsheet, sheetXMLMap)
+	if err != nil {
+		return wrap(err)
+	}
+	sheet.comments, err = readComments(fi, rsheet, sheetXMLMap)
+	if err != nil {
+		return wrap(err)
+	}
+	sheet.images, sheet.drawing, err = readImages(fi, rsheet, sheetXMLMap)
+	if err != nil {
+		return wrap(err)
+	}
+	sheet.vml, err = readLegacyDrawing(fi, rsheet, sheetXMLMap, worksheet)
+	if err != nil {
+		return wrap(err)
+	}
+	sheet.keptRels, sheet.keptParts, err = readKeptSheetParts(fi, rsheet, sheetXMLMap, sheet.drawing, sheet.vml)
+	if err != nil {
+		return wrap(err)
+	}
+	sheet.tables, err = readTables(fi, rsheet, sheetXMLMap)
+	if err != nil {
+		return wrap(err)
+	}
 	if worksheet.AutoFilter != nil {
 		autoFilterBounds := strings.Split(worksheet.AutoFilter.Ref, ":")
 		sheet.AutoFilter = &AutoFilter{autoFilterBounds[0], autoFilterBounds[1]}
 	}
 
 	sheet.SheetFormat.DefaultColWidth = worksheet.SheetFormatPr.DefaultColWidth
-	sheet.SheetFormat.DefaultRowHeight = 12.85
+	sheet.SheetFormat.DefaultRowHeight = defaultRowHeight
 	if worksheet.SheetFormatPr.DefaultRowHeight > 0 {
 		sheet.SheetFormat.DefaultRowHeight = worksheet.SheetFormatPr.DefaultRowHeight
 	}
+	sheet.SheetFormat.CustomHeight = worksheet.SheetFormatPr.CustomHeight
 	sheet.SheetFormat.OutlineLevelCol = worksheet.SheetFormatPr.OutlineLevelCol
 	sheet.SheetFormat.OutlineLevelRow = worksheet.SheetFormatPr.OutlineLevelRow
+	sheet.outlinePr = worksheet.SheetPr.OutlinePr
 	if nil != worksheet.DataValidations {
 		for _, dd := range worksheet.DataValidations.DataValidation {
 			sheet.AddDataValidation(dd)
@@ -767,16 +1044,26 @@ func readSheetsFromZipFile(f *zip.File, file *File, sheetXMLMap map[string]strin
 		return wrap(fmt.Errorf("xml.Decoder.Decode: %w", err))
 	}
 	file.Date1904 = workbook.WorkbookPr.Date1904
+	file.workbookPr = workbook.WorkbookPr
+	file.customWorkbookViews = keepCustomWorkbookViews(workbook.CustomWorkbookViews)
+	file.pivotCaches = workbook.PivotCaches
 
 	for entryNum := range workbook.DefinedNames.DefinedName {
-		file.DefinedNames = append(file.DefinedNames, &workbook.DefinedNames.DefinedName[entryNum])
+		file.definedNames = append(file.definedNames, &workbook.DefinedNames.DefinedName[entryNum])
 	}
 
 	// Only try and read sheets that have corresponding files.
 	// Notably this excludes chartsheets don't right now
 	var workbookSheets []xlsxSheet
-	for _, sheet := range workbook.Sheets.Sheet {
+	activeTab, activeSheet := 0, -1
+	if len(workbook.BookViews.WorkBookView) > 0 {
+		activeTab = workbook.BookViews.WorkBookView[0].ActiveTab
+	}
+	for i, sheet := range workbook.Sheets.Sheet {
 		if f := worksheetFileForSheet(sheet, file.worksheets, sheetXMLMap); f != nil {
+			if i == activeTab {
+				activeSheet = len(workbookSheets)
+			}
 			workbookSheets = append(workbookSheets, sheet)
 		}
 	}
@@ -810,6 +1097,11 @@ func readSheetsFromZipFile(f *zip.File, file *File, sheetXMLMap map[string]strin
 		sheetsByName[sheetName] = sheet.Sheet
 		sheets[sheet.Index] = sheet.Sheet
 	}
+	// The activeTab counts the sheets that aren't read, such as
+	// chartsheets, too.
+	if activeSheet >= 0 {
+		sheets[activeSheet].Selected = true
+	}
 	return sheetsByName, sheets, nil
 }
 
@@ -874,14 +1166,22 @@ func readStylesFromZipFile(f *zip.File, theme *theme) (*xlsxStyleSheet, error) {
 	return style, nil
 }
 
+// buildNumFmtRefTable seeds the numFmtRefTable with the custom number
+// formats that were read into NumFmts, so that the ids of new formats
+// don't collide with them.  NumFmts itself is left as it is.
 func buildNumFmtRefTable(style *xlsxStyleSheet) {
-	if style.NumFmts != nil {
-		for _, numFmt := range style.NumFmts.NumFmt {
-			// We do this for the side effect of populating the NumFmtRefTable.
-			style.addNumFmt(numFmt)
-		}
-
+	style.numFmtRefTableMU.Lock()
+	defer style.numFmtRefTableMU.Unlock()
+	if style.NumFmts == nil {
+		return
 	}
+	if style.numFmtRefTable == nil {
+		style.numFmtRefTable = make(map[int]xlsxNumFmt)
+	}
+	for _, numFmt := range style.NumFmts.NumFmt {
+		style.numFmtRefTable[numFmt.NumFmtId] = numFmt
+	}
+	style.resetParsedNumFmtTable()
 }
 
 func readThemeFromZipFile(f *zip.File) (*theme, error) {
@@ -947,16 +1247,17 @@ func (w *WorkBookRels) MakeXLSXWorkbookRels() xlsxWorkbookRels {
 // readWorkbookRelationsFromZipFile is an internal helper function to
 // extract a map of relationship ID strings to the name of the
 // worksheet.xml file they refer to.  The resulting map can be used to
-// reliably derefence the worksheets in the XLSX file.
-func readWorkbookRelationsFromZipFile(workbookRels *zip.File) (WorkBookRels, error) {
+// reliably derefence the worksheets in the XLSX file.  The complete
+// set of workbook relationships is returned too.
+func readWorkbookRelationsFromZipFile(workbookRels *zip.File) (WorkBookRels, []xlsxWorkbookRelation, error) {
 	var sheetXMLMap WorkBookRels
 	var wbRelationships *xlsxWorkbookRels
 	var rc io.ReadCloser
 	var decoder *xml.Decoder
 	var err error
 
-	wrap := func(err error) (WorkBookRels, error) {
-		return nil, fmt.Errorf("readWorkbookRelationsFromZipFile :%w", err)
+	wrap := func(err error) (WorkBookRels, []xlsxWorkbookRelation, error) {
+		return nil, nil, fmt.Errorf("readWorkbookRelationsFromZipFile :%w", err)
 	}
 
 	rc, err = workbookRels.Open()
@@ -971,12 +1272,129 @@ func readWorkbookRelationsFromZipFile(workbookRels *zip.File) (WorkBookRels, err
 	}
 	sheetXMLMap = make(WorkBookRels)
 	for _, rel := range wbRelationships.Relationships {
-		if strings.HasSuffix(rel.Target, ".xml") && rel.Type == "http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" {
-			_, filename := path.Split(rel.Target)
-			sheetXMLMap[rel.Id] = strings.Replace(filename, ".xml", "", 1)
+		if strings.HasSuffix(rel.Target, ".xml") && rel.Type == worksheetRelationshipType {
+			sheetXMLMap[rel.Id] = worksheetNameFromTarget(rel.Target)
 		}
 	}
-	return sheetXMLMap, nil
+	return sheetXMLMap, wbRelationships.Relationships, nil
+}
+
+// worksheetNameFromTarget returns the name by which a worksheet part,
+// referred to by a workbook relationship, is known.
+func worksheetNameFromTarget(target string) string {
+	_, filename := path.Split(target)
+	return strings.Replace(filename, ".xml", "", 1)
+}
+
+// resolveRelationshipTarget returns the name of the zip entry that a
+// relationship target refers to.  Relative targets are resolved
+// against the directory of the part that owns the relationship.
+func resolveRelationshipTarget(dir, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(path.Clean(target), "/")
+	}
+	return path.Join(dir, target)
+}
+
+// resolveWorkbookParts follows the workbook relationships to locate
+// worksheets and the shared string table when they aren't stored
+// under their conventional names.  The relationships, rather than the
+// names of the parts, are authoritative.
+func resolveWorkbookParts(parts map[string]*zip.File, rels []xlsxWorkbookRelation, worksheets map[string]*zip.File, sharedStrings *zip.File) *zip.File {
+	for _, rel := range rels {
+		part, ok := parts[resolveRelationshipTarget("xl", rel.Target)]
+		if !ok {
+			continue
+		}
+		switch rel.Type {
+		case worksheetRelationshipType:
+			if !strings.HasSuffix(rel.Target, ".xml") {
+				continue
+			}
+			name := worksheetNameFromTarget(rel.Target)
+			if worksheets[name] == nil {
+				worksheets[name] = part
+			}
+		case sharedStringsRelationshipType:
+			if sharedStrings == nil {
+				sharedStrings = part
+			}
+		}
+	}
+	return sharedStrings
+}
+
+// checkWorksheetContentTypes verifies that [Content_Types].xml declares
+// every worksheet with the worksheet content type, and keeps it for the
+// content types of the parts that are kept.  Worksheets are
+// located via the workbook relationships, so a wrong content type is
+// only reported as a Warning, unless the File's options make it an error.
+func (f *File) checkWorksheetContentTypes(contentTypes *zip.File, worksheets map[string]*zip.File) error {
+	if contentTypes == nil {
+		err := fmt.Errorf("%s not found", contentTypesPart)
+		return f.addWarning(Warning{
+			Code:     WarningMissingContentTypes,
+			Severity: SeverityNotice,
+			Part:     contentTypesPart,
+			Message:  err.Error(),
+			Err:      err,
+		})
+	}
+	rc, err := contentTypes.Open()
+	if err != nil {
+		return fmt.Errorf("file.Open: %w", err)
+	}
+	defer rc.Close()
+	types := new(xlsxTypes)
+	err = xml.NewDecoder(rc).Decode(types)
+	if err != nil {
+		return fmt.Errorf("xml.Decoder.Decode: %w", err)
+	}
+	f.contentTypes = types
+
+	overrides := make(map[string]string, len(types.Overrides))
+	for _, override := range types.Overrides {
+		overrides[strings.ToLower(override.PartName)] = override.ContentType
+	}
+	defaults := make(map[string]string, len(types.Defaults))
+	for _, def := range types.Defaults {
+		defaults[strings.ToLower(def.Extension)] = def.ContentType
+	}
+
+	names := make([]string, 0, len(worksheets))
+	for name := range worksheets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		partName := "/" + normalisePartName(worksheets[name].Name)
+		contentType, ok := overrides[strings.ToLower(partName)]
+		if !ok {
+			contentType = defaults[strings.ToLower(strings.TrimPrefix(path.Ext(partName), "."))]
+		}
+		if contentType == worksheetContentType {
+			continue
+		}
+		err := fmt.Errorf("worksheet %s has content type %q, expected %q", partName, contentType, worksheetContentType)
+		err = f.addWarning(Warning{
+			Code:     WarningWrongContentType,
+			Severity: SeverityNotice,
+			Part:     contentTypesPart,
+			Message:  err.Error() + "; it was read as a worksheet because the workbook relationships refer to it",
+			Err:      err,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalisePartName converts the name of a zip entry to the form used
+// in relationship targets, i.e. with forward slashes and no leading
+// slash.
+func normalisePartName(name string) string {
+	return strings.TrimPrefix(strings.Replace(name, `\`, "/", -1), "/")
 }
 
 // ReadZip() takes a pointer to a zip.ReadCloser and returns a
@@ -998,6 +1416,9 @@ func ReadZipReader(r *zip.Reader, options ...FileOption) (*File, error) {
 	var file *File
 	var reftable *RefTable
 	var sharedStrings *zip.File
+	var contentTypes *zip.File
+	var parts map[string]*zip.File
+	var relationships []xlsxWorkbookRelation
 	var sheetXMLMap map[string]string
 	var sheetsByName map[string]*Sheet
 	var sheets []*Sheet
@@ -1015,11 +1436,19 @@ func ReadZipReader(r *zip.Reader, options ...FileOption) (*File, error) {
 	}
 
 	file = NewFile(options...)
+	// Reading the file isn't an edit of it, so the audit log is
+	// only attached once the workbook has been loaded.
+	audit := file.auditLog
+	file.auditLog = nil
 	worksheets = make(map[string]*zip.File, len(r.File))
 	worksheetRels = make(map[string]*zip.File, len(r.File))
+	parts = make(map[string]*zip.File, len(r.File))
 	for _, v = range r.File {
+		parts[normalisePartName(v.Name)] = v
 		_, name := filepath.Split(v.Name)
 		switch name {
+		case contentTypesPart:
+			contentTypes = v
 		case `sharedStrings.xml`:
 			sharedStrings = v
 		case `workbook.xml`:
@@ -1045,15 +1474,27 @@ func ReadZipReader(r *zip.Reader, options ...FileOption) (*File, error) {
 	if workbookRels == nil {
 		return wrap(fmt.Errorf("workbook.xml.rels not found in input xlsx."))
 	}
-	sheetXMLMap, err = readWorkbookRelationsFromZipFile(workbookRels)
+	sheetXMLMap, relationships, err = readWorkbookRelationsFromZipFile(workbookRels)
 	if err != nil {
 		return wrap(err)
 	}
+	sharedStrings = resolveWorkbookParts(parts, relationships, worksheets, sharedStrings)
 	if len(worksheets) == 0 {
 		return wrap(fmt.Errorf("Input xlsx contains no worksheets."))
 	}
+	err = file.checkWorksheetContentTypes(contentTypes, worksheets)
+	if err != nil {
+		return wrap(err)
+	}
 	file.worksheets = worksheets
 	file.worksheetRels = worksheetRels
+	file.parts = parts
+	if workbook != nil {
+		err = file.readKeptWorkbookParts(normalisePartName(workbook.Name), relationships)
+		if err != nil {
+			return wrap(err)
+		}
+	}
 	reftable, err = readSharedStringsFromZipFile(sharedStrings)
 	if err != nil {
 		return wrap(err)
@@ -1074,6 +1515,9 @@ func ReadZipReader(r *zip.Reader, options ...FileOption) (*File, error) {
 		}
 
 		file.styles = style
+		if reftable != nil {
+			reftable.resolvePhoneticFonts(style)
+		}
 	}
 	sheetsByName, sheets, err = readSheetsFromZipFile(workbook, file, sheetXMLMap, file.rowLimit)
 	if err != nil {
@@ -1086,6 +1530,7 @@ func ReadZipReader(r *zip.Reader, options ...FileOption) (*File, error) {
 	}
 	file.Sheet = sheetsByName
 	file.Sheets = sheets
+	file.auditLog = audit
 	return file, nil
 }
 
@@ -3,11 +3,17 @@ package xlsx
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"math/rand"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	qt "github.com/frankban/quicktest"
+	"github.com/klauspost/compress/zip"
 )
 
 func TestLib(t *testing.T) {
@@ -93,6 +99,144 @@ func TestLib(t *testing.T) {
 		c.Assert(val, qt.Equals, "HL Retail - North America - Activity by Day - MTD")
 	})
 
+	// Strings are written inline with the WriteInlineStrings option,
+	// and read back.
+	csRunO(c, "WriteInlineStrings", func(c *qt.C, option FileOption) {
+		f := NewFile(option, WriteInlineStrings())
+		sheet, err := f.AddSheet("InlineStrings")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetString(" padded ")
+		row.AddCell().SetRichText([]RichTextRun{
+			{Text: "bold", Font: &RichTextFont{Bold: true}},
+			{Text: " plain"},
+		})
+		row.AddCell().SetString("")
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			switch name {
+			case "xl/worksheets/sheet1.xml":
+				written = string(body)
+			case "xl/sharedStrings.xml":
+				c.Assert(string(body), qt.Not(qt.Contains), "<si>")
+			}
+			return name, body
+		})
+		streamed, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		for _, written := range []string{written, streamed["xl/worksheets/sheet1.xml"]} {
+			c.Assert(written, qt.Contains, `<c r="A1" t="inlineStr"><is><t xml:space="preserve"> padded </t></is></c>`)
+			c.Assert(written, qt.Contains, `<b></b></rPr><t>bold</t></r><r><t xml:space="preserve"> plain</t></r></is></c>`)
+		}
+
+		f, err = OpenBinary(buf.Bytes())
+		c.Assert(err, qt.IsNil)
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, " padded ")
+		cell, err = f.Sheets[0].Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "bold plain")
+		c.Assert(cell.RichText, qt.HasLen, 2)
+		c.Assert(cell.RichText[0].Font.Bold, qt.IsTrue)
+	})
+
+	// Leading and trailing whitespace, tabs and newlines survive a
+	// round trip, in shared strings, inline strings and the results
+	// of string formulas.
+	csRunO(c, "WhitespaceRoundTrip", func(c *qt.C, option FileOption) {
+		values := []string{
+			"  indented",
+			"trailing  ",
+			"   ",
+			"\t",
+			"\tbetween\ttabs\t",
+			"line one\nline two\n",
+			"\r\nwindows\r\n",
+		}
+		for _, inline := range []bool{false, true} {
+			options := []FileOption{option}
+			if inline {
+				options = append(options, WriteInlineStrings())
+			}
+			f := NewFile(options...)
+			sheet, err := f.AddSheet("Whitespace" + strconv.FormatBool(inline))
+			c.Assert(err, qt.IsNil)
+			for _, value := range values {
+				row := sheet.AddRow()
+				row.AddCell().SetString(value)
+				row.AddCell().SetFormulaAndString(`A1&""`, value)
+			}
+
+			var buf bytes.Buffer
+			c.Assert(f.Write(&buf), qt.IsNil)
+			sheet.Close()
+
+			f, err = OpenBinary(buf.Bytes())
+			c.Assert(err, qt.IsNil)
+			for i, value := range values {
+				for col := 0; col < 2; col++ {
+					cell, err := f.Sheets[0].Cell(i, col)
+					c.Assert(err, qt.IsNil)
+					c.Assert(cell.Value, qt.Equals, value, qt.Commentf("inline %v, column %d", inline, col))
+				}
+			}
+		}
+	})
+
+	// Arbitrary strings, made up mostly of control characters and of
+	// text that looks like the _xHHHH_ escapes they are written with,
+	// are read back as they were written, in shared strings, inline
+	// strings and rich text runs.  A string that isn't valid UTF-8
+	// can't be written to XML as it is, so only those that are, are
+	// compared.
+	c.Run("ControlCharacterRoundTrip", func(c *qt.C) {
+		pieces := []string{"_", "x", "_x", "00", "0D", "1f", "A", "\x00", "\x01", "\x08", "\x0b", "\x1f",
+			"\t", "\n", "\r", " ", "\u00e9", "\ufffe", "\uffff", "\U0001F600", "\xff", "\xe2\x82"}
+		rnd := rand.New(rand.NewSource(1))
+		values := make([]string, 200)
+		for i := range values {
+			var b strings.Builder
+			for n := rnd.Intn(12); n > 0; n-- {
+				b.WriteString(pieces[rnd.Intn(len(pieces))])
+			}
+			values[i] = b.String()
+		}
+
+		for _, inline := range []bool{false, true} {
+			var options []FileOption
+			if inline {
+				options = append(options, WriteInlineStrings())
+			}
+			f := NewFile(options...)
+			sheet, err := f.AddSheet("Sheet1")
+			c.Assert(err, qt.IsNil)
+			for _, value := range values {
+				row := sheet.AddRow()
+				row.AddCell().SetString(value)
+				row.AddCell().SetRichText([]RichTextRun{{Text: value, Font: &RichTextFont{Italic: true}}})
+			}
+
+			var buf bytes.Buffer
+			c.Assert(f.Write(&buf), qt.IsNil)
+			f, err = OpenBinary(buf.Bytes())
+			c.Assert(err, qt.IsNil)
+			for i, value := range values {
+				if !utf8.ValidString(value) {
+					continue
+				}
+				for col := 0; col < 2; col++ {
+					cell, err := f.Sheets[0].Cell(i, col)
+					c.Assert(err, qt.IsNil)
+					c.Assert(cell.Value, qt.Equals, value, qt.Commentf("inline %v, column %d", inline, col))
+				}
+			}
+		}
+	})
+
 	// which they are contained from the XLSX file, even when the
 	// worksheet files have arbitrary, non-numeric names.
 	csRunO(c, "ReadWorkbookRelationsFromZipFileWithFunnyNames", func(c *qt.C, option FileOption) {
@@ -157,6 +301,22 @@ func TestLib(t *testing.T) {
 
 	})
 
+	c.Run("CheckedColumnConversions", func(c *qt.C) {
+		n, err := ColLettersToIndexChecked("XFD")
+		c.Assert(err, qt.IsNil)
+		c.Assert(n, qt.Equals, Excel2006MaxColIndex)
+		_, err = ColLettersToIndexChecked("XFE")
+		c.Assert(err, qt.ErrorMatches, `column "XFE" is beyond the last column, XFD`)
+		_, err = ColLettersToIndexChecked("A1")
+		c.Assert(err, qt.ErrorMatches, `invalid column "A1"`)
+
+		letters, err := ColIndexToLettersChecked(Excel2006MaxColIndex)
+		c.Assert(err, qt.IsNil)
+		c.Assert(letters, qt.Equals, "XFD")
+		_, err = ColIndexToLettersChecked(Excel2006MaxColCount)
+		c.Assert(err, qt.ErrorMatches, `column index 16384 is out of range`)
+	})
+
 	c.Run("LetterOnlyMapFunction", func(c *qt.C) {
 		var input string = "ABC123"
 		var output string = strings.Map(letterOnlyMapF, input)
@@ -1230,6 +1390,9 @@ func TestLib(t *testing.T) {
 			"$AA1",
 			"AA$1",
 			"$AA$1",
+			"SUM(A:A)+$B:B+Data!2:$3",
+			"SUM(T1[Q1])+A1",
+			"[@Q1]*'Q1 Data'!Q1",
 		}
 
 		expected := []string{
@@ -1252,6 +1415,9 @@ func TestLib(t *testing.T) {
 			"$AA2",
 			"AB$1",
 			"$AA$1",
+			"SUM(B:B)+$B:C+Data!3:$3",
+			"SUM(T1[Q1])+B2",
+			"[@Q1]*'Q1 Data'!R2",
 		}
 
 		anchorCell := "C4"
@@ -1269,7 +1435,7 @@ func TestLib(t *testing.T) {
 				F: &xlsxF{
 					Content: formula,
 					T:       "shared",
-					Si:      i,
+					Si:      &i,
 				},
 			}
 
@@ -1822,3 +1988,208 @@ func TestIssueSheetsWithHyperlinksHaveLegibleValues(t *testing.T) {
 		return nil
 	})
 }
+
+// rewriteXLSX returns a copy of the XLSX file in src in which every part
+// has been passed through edit.  Parts for which edit returns an empty
+// name are dropped.
+func rewriteXLSX(c *qt.C, src []byte, edit func(name string, body []byte) (string, []byte)) []byte {
+	r, err := zip.NewReader(bytes.NewReader(src), int64(len(src)))
+	c.Assert(err, qt.IsNil)
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		c.Assert(err, qt.IsNil)
+		body, err := ioutil.ReadAll(rc)
+		c.Assert(err, qt.IsNil)
+		rc.Close()
+		name, body := edit(f.Name, body)
+		if name == "" {
+			continue
+		}
+		fw, err := w.Create(name)
+		c.Assert(err, qt.IsNil)
+		_, err = fw.Write(body)
+		c.Assert(err, qt.IsNil)
+	}
+	c.Assert(w.Close(), qt.IsNil)
+	return buf.Bytes()
+}
+
+func TestReadMalformedFiles(t *testing.T) {
+	c := qt.New(t)
+
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, qt.IsNil)
+	sheet.AddRow().AddCell().SetString("hello")
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), qt.IsNil)
+	valid := buf.Bytes()
+
+	replace := func(part, old, new string) func(string, []byte) (string, []byte) {
+		return func(name string, body []byte) (string, []byte) {
+			if name == part {
+				body = []byte(strings.Replace(string(body), old, new, -1))
+			}
+			return name, body
+		}
+	}
+
+	firstValue := func(c *qt.C, f *File) string {
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		return cell.Value
+	}
+
+	c.Run("Valid", func(c *qt.C) {
+		f, err := OpenBinary(valid, StrictParsing)
+		c.Assert(err, qt.IsNil)
+		c.Assert(firstValue(c, f), qt.Equals, "hello")
+		c.Assert(f.Warnings(), qt.HasLen, 0)
+	})
+
+	c.Run("MissingSharedStrings", func(c *qt.C) {
+		// A second sheet, and a second string in the first, also
+		// refer to the shared string table.
+		var twoSheets bytes.Buffer
+		f := NewFile()
+		for _, name := range []string{"Sheet1", "Sheet2"} {
+			sheet, err := f.AddSheet(name)
+			c.Assert(err, qt.IsNil)
+			row := sheet.AddRow()
+			row.AddCell().SetString("hello")
+			row.AddCell().SetString("world")
+		}
+		c.Assert(f.Write(&twoSheets), qt.IsNil)
+		broken := rewriteXLSX(c, twoSheets.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/sharedStrings.xml" {
+				return "", nil
+			}
+			return name, body
+		})
+
+		f, err := OpenBinary(broken)
+		c.Assert(err, qt.IsNil)
+		c.Assert(firstValue(c, f), qt.Equals, "[missing shared string 0]")
+		cell, err := f.Sheets[1].Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "[missing shared string 1]")
+		// The problem is reported once, however many cells it affects.
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 1)
+		c.Assert(warnings[0].Code, qt.Equals, WarningMissingSharedStrings)
+		c.Assert(warnings[0].Severity, qt.Equals, SeverityDataLoss)
+		c.Assert(warnings[0].Part, qt.Equals, "xl/sharedStrings.xml")
+		c.Assert(warnings[0].Location, qt.Equals, "")
+		c.Assert(warnings[0].Message, qt.Equals, `cells refer to shared strings, but the file has no shared string table; they were given values such as "[missing shared string 0]" in place of the strings`)
+		c.Assert(warnings[0].Err, qt.ErrorMatches, `cells refer to shared strings, but the file has no shared string table`)
+
+		_, err = OpenBinary(broken, StrictParsing)
+		c.Assert(err, qt.ErrorMatches, `.*cells refer to shared strings, but the file has no shared string table`)
+		_, err = OpenBinary(broken, WarningsAsErrors(WarningMissingSharedStrings))
+		var warningErr *WarningError
+		c.Assert(errors.As(err, &warningErr), qt.IsTrue)
+		c.Assert(warningErr.Warning.Code, qt.Equals, WarningMissingSharedStrings)
+	})
+
+	c.Run("SharedStringIndexOutOfRange", func(c *qt.C) {
+		broken := rewriteXLSX(c, valid, replace("xl/worksheets/sheet1.xml", "<v>0</v>", "<v>5</v>"))
+
+		f, err := OpenBinary(broken)
+		c.Assert(err, qt.IsNil)
+		c.Assert(firstValue(c, f), qt.Equals, "[missing shared string 5]")
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 1)
+		c.Assert(warnings[0].Code, qt.Equals, WarningInvalidCellValue)
+		c.Assert(warnings[0].Location, qt.Equals, "Sheet1!A1")
+		c.Assert(warnings[0].Message, qt.Equals, `cell A1 in sheet "Sheet1": shared string 5 does not exist, the shared string table has 1 entries; the cell was given the value "[missing shared string 5]"`)
+
+		_, err = OpenBinary(broken, StrictParsing)
+		c.Assert(err, qt.ErrorMatches, `.*cell A1 in sheet "Sheet1": shared string 5 does not exist, the shared string table has 1 entries`)
+	})
+
+	c.Run("SharedStringIndexNotANumber", func(c *qt.C) {
+		broken := rewriteXLSX(c, valid, replace("xl/worksheets/sheet1.xml", "<v>0</v>", "<v>x1</v>"))
+
+		f, err := OpenBinary(broken)
+		c.Assert(err, qt.IsNil)
+		c.Assert(firstValue(c, f), qt.Equals, `[invalid shared string index "x1"]`)
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 1)
+		c.Assert(warnings[0].Code, qt.Equals, WarningInvalidCellValue)
+		c.Assert(warnings[0].Location, qt.Equals, "Sheet1!A1")
+		c.Assert(warnings[0].Message, qt.Equals, `cell A1 in sheet "Sheet1": the shared string index isn't a number: "x1"; the cell was given the value "[invalid shared string index \"x1\"]"`)
+
+		_, err = OpenBinary(broken, StrictParsing)
+		c.Assert(err, qt.ErrorMatches, `.*cell A1 in sheet "Sheet1": the shared string index isn't a number: "x1"`)
+	})
+
+	c.Run("WrongWorksheetContentType", func(c *qt.C) {
+		broken := rewriteXLSX(c, valid, replace("[Content_Types].xml", "spreadsheetml.worksheet+xml", "spreadsheetml.chartsheet+xml"))
+
+		f, err := OpenBinary(broken)
+		c.Assert(err, qt.IsNil)
+		c.Assert(firstValue(c, f), qt.Equals, "hello")
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 1)
+		c.Assert(warnings[0].Code, qt.Equals, WarningWrongContentType)
+		c.Assert(warnings[0].Severity, qt.Equals, SeverityNotice)
+		c.Assert(warnings[0].Part, qt.Equals, "[Content_Types].xml")
+		c.Assert(warnings[0].Message, qt.Matches, `worksheet /xl/worksheets/sheet1.xml has content type ".*chartsheet\+xml", expected ".*worksheet\+xml"; .*`)
+
+		_, err = OpenBinary(broken, StrictParsing)
+		c.Assert(err, qt.ErrorMatches, `.*worksheet /xl/worksheets/sheet1.xml has content type ".*chartsheet\+xml", expected ".*worksheet\+xml"`)
+	})
+
+	c.Run("MissingContentTypes", func(c *qt.C) {
+		broken := rewriteXLSX(c, valid, func(name string, body []byte) (string, []byte) {
+			if name == "[Content_Types].xml" {
+				return "", nil
+			}
+			return name, body
+		})
+
+		f, err := OpenBinary(broken)
+		c.Assert(err, qt.IsNil)
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 1)
+		c.Assert(warnings[0].Code, qt.Equals, WarningMissingContentTypes)
+		c.Assert(warnings[0].Location, qt.Equals, "")
+	})
+
+	c.Run("WarningsAsErrors", func(c *qt.C) {
+		broken := rewriteXLSX(c, valid, replace("xl/worksheets/sheet1.xml", "<v>0</v>", "<v>5</v>"))
+
+		// Other codes are still only warnings.
+		f, err := OpenBinary(broken, WarningsAsErrors(WarningWrongContentType))
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Warnings(), qt.HasLen, 1)
+
+		_, err = OpenBinary(broken, WarningsAsErrors(WarningWrongContentType, WarningInvalidCellValue))
+		var warningErr *WarningError
+		c.Assert(errors.As(err, &warningErr), qt.IsTrue)
+		c.Assert(warningErr.Warning.Code, qt.Equals, WarningInvalidCellValue)
+		c.Assert(warningErr.Warning.Location, qt.Equals, "Sheet1!A1")
+	})
+
+	c.Run("PartsResolvedByRelationship", func(c *qt.C) {
+		moved := rewriteXLSX(c, valid, func(name string, body []byte) (string, []byte) {
+			switch name {
+			case "xl/worksheets/sheet1.xml":
+				return "xl/sheets/data.xml", body
+			case "xl/sharedStrings.xml":
+				return "xl/strings.xml", body
+			}
+			content := string(body)
+			content = strings.Replace(content, "worksheets/sheet1.xml", "sheets/data.xml", -1)
+			content = strings.Replace(content, "sharedStrings.xml", "strings.xml", -1)
+			return name, []byte(content)
+		})
+
+		f, err := OpenBinary(moved, StrictParsing)
+		c.Assert(err, qt.IsNil)
+		c.Assert(firstValue(c, f), qt.Equals, "hello")
+		c.Assert(f.Warnings(), qt.HasLen, 0)
+	})
+}
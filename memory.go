@@ -41,10 +41,30 @@ func (mr *MemoryRow) PushCell(c *Cell) {
 	mr.cells[c.num] = c
 }
 
+// removeCell removes the cell at colIdx, shrinking the row if it was
+// the rightmost one.
+func (mr *MemoryRow) removeCell(colIdx int) error {
+	if colIdx < len(mr.cells) {
+		mr.cells[colIdx] = nil
+	}
+	if colIdx == mr.maxCol {
+		for mr.maxCol >= 0 && (mr.maxCol >= len(mr.cells) || mr.cells[mr.maxCol] == nil) {
+			mr.maxCol--
+		}
+		mr.cells = mr.cells[:mr.maxCol+1]
+	}
+	return nil
+}
+
 func (mr *MemoryRow) growCellsSlice(newSize int) {
 	if newSize > (mr.maxCol + 1) {
 		mr.maxCol = (newSize - 1)
 	}
+	// A cell pushed in the middle of the row mustn't cut off the
+	// cells after it.
+	if newSize <= len(mr.cells) {
+		return
+	}
 
 	capacity := cap(mr.cells)
 	if newSize > capacity {
@@ -88,22 +108,24 @@ func (mr *MemoryRow) ForEachCell(cvf CellVisitorFunc, option ...CellVisitorOptio
 			}
 			c = mr.GetCell(ci)
 		}
-		if !c.Modified() && flags.skipEmptyCells {
+		if c.isEmpty() && flags.skipEmptyCells {
 			return nil
 		}
 		c.Row = mr.row
 		return cvf(c)
 	}
 
-	for ci, cell := range mr.cells {
-		err := fn(ci, cell)
+	from, to := flags.span(0, len(mr.cells))
+	for ci := from; ci < to; ci++ {
+		err := fn(ci, mr.cells[ci])
 		if err != nil {
 			return err
 		}
 	}
 	cellCount := len(mr.cells)
 	if !flags.skipEmptyCells {
-		for ci := cellCount; ci < mr.row.Sheet.MaxCol; ci++ {
+		from, to = flags.span(cellCount, mr.row.Sheet.MaxCol)
+		for ci := from; ci < to; ci++ {
 			c := mr.GetCell(ci)
 			err := cvf(c)
 			if err != nil {
@@ -174,6 +196,7 @@ func (mcs *MemoryCellStore) WriteRow(r *Row) error {
 	if r != nil {
 		key := r.key()
 		mcs.rows[key] = r
+		r.modified = false
 	}
 	return nil
 }
@@ -191,6 +214,19 @@ func (mcs *MemoryCellStore) MoveRow(r *Row, index int) error {
 	return nil
 }
 
+// renameSheet moves the rows keyed by oldName to newName.
+func (mcs *MemoryCellStore) renameSheet(oldName, newName string) error {
+	rows := make(map[string]*Row, len(mcs.rows))
+	for key, r := range mcs.rows {
+		if strings.HasPrefix(key, oldName+":") {
+			key = newName + key[len(oldName):]
+		}
+		rows[key] = r
+	}
+	mcs.rows = rows
+	return nil
+}
+
 // RemoveRow removes a row from the sheet, it doesn't specifically
 // move any following rows, leaving this decision to the user.
 func (mcs *MemoryCellStore) RemoveRow(key string) error {
@@ -0,0 +1,331 @@
+package xlsx
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// PageOrientation is the orientation of the pages that a Sheet is
+// printed on.
+type PageOrientation string
+
+const (
+	// OrientationDefault leaves the orientation to the printer,
+	// which is normally portrait.
+	OrientationDefault   PageOrientation = ""
+	OrientationPortrait  PageOrientation = "portrait"
+	OrientationLandscape PageOrientation = "landscape"
+)
+
+// PaperSize is the size of the paper that a Sheet is printed on, as
+// the code that the paperSize attribute of the pageSetup element
+// gives it.  The most common codes have constants of their own; the
+// others are listed under ST_PaperSize in the file format
+// specification.
+type PaperSize int
+
+const (
+	// PaperDefault leaves the paper size to the printer.
+	PaperDefault         PaperSize = 0
+	PaperLetter          PaperSize = 1  // 8.5 in by 11 in
+	PaperTabloid         PaperSize = 3  // 11 in by 17 in
+	PaperLedger          PaperSize = 4  // 17 in by 11 in
+	PaperLegal           PaperSize = 5  // 8.5 in by 14 in
+	PaperStatement       PaperSize = 6  // 5.5 in by 8.5 in
+	PaperExecutive       PaperSize = 7  // 7.25 in by 10.5 in
+	PaperA3              PaperSize = 8  // 297 mm by 420 mm
+	PaperA4              PaperSize = 9  // 210 mm by 297 mm
+	PaperA5              PaperSize = 11 // 148 mm by 210 mm
+	PaperB4              PaperSize = 12 // 250 mm by 353 mm
+	PaperB5              PaperSize = 13 // 176 mm by 250 mm
+	PaperFolio           PaperSize = 14 // 8.5 in by 13 in
+	PaperEnvelope10      PaperSize = 20 // 4.125 in by 9.5 in
+	PaperEnvelopeDL      PaperSize = 27 // 110 mm by 220 mm
+	PaperEnvelopeC5      PaperSize = 28 // 162 mm by 229 mm
+	PaperEnvelopeMonarch PaperSize = 37 // 3.875 in by 7.5 in
+	PaperA2              PaperSize = 66 // 420 mm by 594 mm
+	PaperA6              PaperSize = 70 // 105 mm by 148 mm
+)
+
+// PageSetup holds the settings that a Sheet is printed with.  The zero
+// value leaves all of them to the printer.
+type PageSetup struct {
+	Orientation PageOrientation
+	PaperSize   PaperSize
+	// Scale is the percentage the Sheet is printed at, from 10 to
+	// 400, or 0 for 100.  It is ignored when the Sheet is fitted to
+	// pages.
+	Scale int
+	// FitToWidth and FitToHeight are the number of pages wide and
+	// tall that the Sheet is shrunk to fit on, if either is set.  0
+	// leaves the other dimension as many pages as it takes, so that
+	// FitToWidth 1 and FitToHeight 0 fit the columns on one page.
+	FitToWidth  int
+	FitToHeight int
+	// FirstPageNumber is the number of the first page, or 0 to
+	// number the pages from 1.
+	FirstPageNumber int
+	BlackAndWhite   bool
+}
+
+// fitsToPage reports whether the Sheet is fitted to pages, rather
+// than scaled.
+func (p PageSetup) fitsToPage() bool {
+	return p.FitToWidth > 0 || p.FitToHeight > 0
+}
+
+// SetPageSetup sets the settings that the Sheet is printed with.
+func (s *Sheet) SetPageSetup(setup PageSetup) error {
+	switch setup.Orientation {
+	case OrientationDefault, OrientationPortrait, OrientationLandscape:
+	default:
+		return fmt.Errorf("SetPageSetup: invalid orientation %q", setup.Orientation)
+	}
+	if setup.PaperSize < 0 {
+		return fmt.Errorf("SetPageSetup: invalid paper size %d", setup.PaperSize)
+	}
+	if setup.Scale != 0 && (setup.Scale < 10 || setup.Scale > 400) {
+		return fmt.Errorf("SetPageSetup: scale %d is not between 10 and 400", setup.Scale)
+	}
+	if setup.FitToWidth < 0 || setup.FitToHeight < 0 {
+		return fmt.Errorf("SetPageSetup: invalid number of pages to fit to, %d by %d", setup.FitToWidth, setup.FitToHeight)
+	}
+	if setup.FirstPageNumber < 0 {
+		return fmt.Errorf("SetPageSetup: invalid first page number %d", setup.FirstPageNumber)
+	}
+	if s.pageMargins != nil {
+		if err := s.PageMargins().fit(setup); err != nil {
+			return fmt.Errorf("SetPageSetup: %w", err)
+		}
+	}
+	s.pageSetup = &setup
+	return nil
+}
+
+// PageSetup returns the settings that the Sheet is printed with, as
+// set by SetPageSetup or read from its file.
+func (s *Sheet) PageSetup() PageSetup {
+	if s.pageSetup == nil {
+		return PageSetup{}
+	}
+	return *s.pageSetup
+}
+
+// PageMargins holds the margins of the pages that a Sheet is printed
+// on, in inches, as Excel shows them.  Header and Footer are the
+// distances of the header and footer from the top and bottom edges of
+// the page.
+type PageMargins struct {
+	Left, Right, Top, Bottom float64
+	Header, Footer           float64
+}
+
+// DefaultPageMargins are the margins that Excel prints a Sheet with
+// when it has none of its own, the ones it calls Normal.
+var DefaultPageMargins = PageMargins{
+	Left: 0.7, Right: 0.7,
+	Top: 0.75, Bottom: 0.75,
+	Header: 0.3, Footer: 0.3,
+}
+
+// mm is the number of millimetres in an inch.
+const mm = 25.4
+
+// paperSizes holds the width and height, in inches, of the paper
+// sizes that have constants, held portrait.
+var paperSizes = map[PaperSize][2]float64{
+	// The paper size is left to the printer, so take the smaller of
+	// Letter and A4 each way.
+	PaperDefault:         {210 / mm, 11},
+	PaperLetter:          {8.5, 11},
+	PaperTabloid:         {11, 17},
+	PaperLedger:          {11, 17},
+	PaperLegal:           {8.5, 14},
+	PaperStatement:       {5.5, 8.5},
+	PaperExecutive:       {7.25, 10.5},
+	PaperA3:              {297 / mm, 420 / mm},
+	PaperA4:              {210 / mm, 297 / mm},
+	PaperA5:              {148 / mm, 210 / mm},
+	PaperB4:              {250 / mm, 353 / mm},
+	PaperB5:              {176 / mm, 250 / mm},
+	PaperFolio:           {8.5, 13},
+	PaperEnvelope10:      {4.125, 9.5},
+	PaperEnvelopeDL:      {110 / mm, 220 / mm},
+	PaperEnvelopeC5:      {162 / mm, 229 / mm},
+	PaperEnvelopeMonarch: {3.875, 7.5},
+	PaperA2:              {420 / mm, 594 / mm},
+	PaperA6:              {105 / mm, 148 / mm},
+}
+
+// fit returns an error if the margins leave no room on the pages of
+// the setup, which Excel warns about when the Sheet is printed.
+// Margins on paper sizes without a constant aren't checked.
+func (m PageMargins) fit(setup PageSetup) error {
+	size, ok := paperSizes[setup.PaperSize]
+	if !ok {
+		return nil
+	}
+	width, height := size[0], size[1]
+	if setup.Orientation == OrientationLandscape {
+		width, height = height, width
+	}
+	if m.Left+m.Right >= width {
+		return fmt.Errorf("left and right margins of %g in don't fit a page %.2f in wide", m.Left+m.Right, width)
+	}
+	if m.Top+m.Bottom >= height || m.Header+m.Footer >= height {
+		return fmt.Errorf("top and bottom margins don't fit a page %.2f in tall", height)
+	}
+	return nil
+}
+
+// SetPageMargins sets the margins of the pages that the Sheet is
+// printed on, in inches.  The margins must fit the paper size and
+// orientation of the Sheet's PageSetup, so set that first.
+func (s *Sheet) SetPageMargins(left, right, top, bottom, header, footer float64) error {
+	margins := PageMargins{
+		Left: left, Right: right,
+		Top: top, Bottom: bottom,
+		Header: header, Footer: footer,
+	}
+	for _, v := range []float64{left, right, top, bottom, header, footer} {
+		if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("SetPageMargins: invalid margin %g", v)
+		}
+	}
+	if err := margins.fit(s.PageSetup()); err != nil {
+		return fmt.Errorf("SetPageMargins: %w", err)
+	}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	s.pageMargins = &xlsxPageMargins{
+		Left:   format(left),
+		Right:  format(right),
+		Top:    format(top),
+		Bottom: format(bottom),
+		Header: format(header),
+		Footer: format(footer),
+	}
+	return nil
+}
+
+// PageMargins returns the margins of the pages that the Sheet is
+// printed on, as set by SetPageMargins or read from its file, or
+// DefaultPageMargins if it has none.
+func (s *Sheet) PageMargins() PageMargins {
+	if s.pageMargins == nil {
+		return DefaultPageMargins
+	}
+	parse := func(v string) float64 {
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	}
+	return PageMargins{
+		Left:   parse(s.pageMargins.Left),
+		Right:  parse(s.pageMargins.Right),
+		Top:    parse(s.pageMargins.Top),
+		Bottom: parse(s.pageMargins.Bottom),
+		Header: parse(s.pageMargins.Header),
+		Footer: parse(s.pageMargins.Footer),
+	}
+}
+
+// SetPrintCentered sets whether the Sheet is centred horizontally and
+// vertically between the margins of the pages it is printed on.
+func (s *Sheet) SetPrintCentered(horizontally, vertically bool) {
+	if s.printOptions == nil {
+		s.printOptions = &xlsxPrintOptions{}
+	}
+	s.printOptions.HorizontalCentered = horizontally
+	s.printOptions.VerticalCentered = vertically
+}
+
+// PrintCentered returns whether the Sheet is centred horizontally and
+// vertically between the margins of the pages it is printed on.
+func (s *Sheet) PrintCentered() (horizontally, vertically bool) {
+	if s.printOptions == nil {
+		return false, false
+	}
+	return s.printOptions.HorizontalCentered, s.printOptions.VerticalCentered
+}
+
+// SetPrintGridLines sets whether the grid lines between cells are
+// printed.
+func (s *Sheet) SetPrintGridLines(printed bool) {
+	if s.printOptions == nil {
+		s.printOptions = &xlsxPrintOptions{}
+	}
+	s.printOptions.GridLines = printed
+}
+
+// PrintGridLines returns whether the grid lines between cells are
+// printed.
+func (s *Sheet) PrintGridLines() bool {
+	return s.printOptions != nil && s.printOptions.GridLines
+}
+
+// makePageSetup sets the pageSetup, pageMargins and printOptions
+// elements of the worksheet, and the fitToPage attribute of its
+// sheetPr, which tells the two ways of sizing the printed Sheet apart.
+func (s *Sheet) makePageSetup(worksheet *xlsxWorksheet) {
+	worksheet.PageMargins = s.pageMargins
+	if s.printOptions != nil && *s.printOptions != (xlsxPrintOptions{}) {
+		worksheet.PrintOptions = s.printOptions
+	}
+	if s.pageSetup == nil || *s.pageSetup == (PageSetup{}) {
+		return
+	}
+	setup := s.pageSetup
+	xSetup := &xlsxPageSetUp{
+		PaperSize:     int(setup.PaperSize),
+		Orientation:   string(setup.Orientation),
+		BlackAndWhite: setup.BlackAndWhite,
+	}
+	if setup.fitsToPage() {
+		// Absent, either is taken to be 1, so 0 has to be written.
+		width, height := setup.FitToWidth, setup.FitToHeight
+		xSetup.FitToWidth = &width
+		xSetup.FitToHeight = &height
+		worksheet.SheetPr.PageSetUpPr = []xlsxPageSetUpPr{{FitToPage: true}}
+	} else {
+		xSetup.Scale = setup.Scale
+	}
+	if setup.FirstPageNumber > 0 {
+		xSetup.FirstPageNumber = setup.FirstPageNumber
+		xSetup.UseFirstPageNumber = true
+	}
+	worksheet.PageSetUp = xSetup
+}
+
+// readPageSetup returns the PageSetup of the worksheet, or nil if it
+// has no pageSetup element.
+func readPageSetup(worksheet *xlsxWorksheet) *PageSetup {
+	xSetup := worksheet.PageSetUp
+	if xSetup == nil {
+		return nil
+	}
+	setup := &PageSetup{
+		Orientation:   PageOrientation(xSetup.Orientation),
+		PaperSize:     PaperSize(xSetup.PaperSize),
+		Scale:         xSetup.Scale,
+		BlackAndWhite: xSetup.BlackAndWhite,
+	}
+	if xSetup.UseFirstPageNumber {
+		setup.FirstPageNumber = xSetup.FirstPageNumber
+	}
+	fitToPage := false
+	for _, pr := range worksheet.SheetPr.PageSetUpPr {
+		fitToPage = fitToPage || pr.FitToPage
+	}
+	if fitToPage {
+		setup.FitToWidth, setup.FitToHeight = 1, 1
+		if xSetup.FitToWidth != nil {
+			setup.FitToWidth = *xSetup.FitToWidth
+		}
+		if xSetup.FitToHeight != nil {
+			setup.FitToHeight = *xSetup.FitToHeight
+		}
+	}
+	return setup
+}
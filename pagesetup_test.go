@@ -0,0 +1,222 @@
+package xlsx
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPageSetup(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Invalid", func(c *qt.C) {
+		sheet, err := NewSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		for _, setup := range []PageSetup{
+			{Orientation: "sideways"},
+			{PaperSize: -1},
+			{Scale: 5},
+			{Scale: 401},
+			{FitToWidth: -1},
+			{FirstPageNumber: -1},
+		} {
+			c.Assert(sheet.SetPageSetup(setup), qt.Not(qt.IsNil))
+		}
+		c.Assert(sheet.PageSetup(), qt.Equals, PageSetup{})
+	})
+
+	csRunO(c, "FitToPage", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("PageSetupFit")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		cell := sheet.AddRow().AddCell()
+		cell.SetString("wide")
+		cell.SetHyperlink("https://example.com", "", "")
+		setup := PageSetup{
+			Orientation: OrientationLandscape,
+			PaperSize:   PaperA4,
+			FitToWidth:  1,
+		}
+		c.Assert(sheet.SetPageSetup(setup), qt.IsNil)
+		c.Assert(sheet.PageSetup(), qt.Equals, setup)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		xml := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(xml, qt.Matches, `(?s).*<sheetPr[^>]*><pageSetUpPr fitToPage="(true|1)"`+".*")
+		c.Assert(xml, qt.Matches, `(?s).*<pageSetup paperSize="9" fitToWidth="1" fitToHeight="0" orientation="landscape"`+".*")
+		c.Assert(xml, qt.Not(qt.Matches), `(?s).*scale=.*`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var body string
+		rewriteXLSX(c, buf.Bytes(), func(name string, b []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				body = string(b)
+			}
+			return name, b
+		})
+		// Both elements belong after sheetData, hyperlinks first.
+		sheetData := strings.Index(body, "</sheetData>")
+		hyperlinks := strings.Index(body, "<hyperlinks>")
+		pageSetup := strings.Index(body, "<pageSetup ")
+		c.Assert(sheetData >= 0, qt.IsTrue)
+		c.Assert(hyperlinks > sheetData, qt.IsTrue, qt.Commentf("%s", body))
+		c.Assert(pageSetup > hyperlinks, qt.IsTrue, qt.Commentf("%s", body))
+
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet2 := f2.Sheets[0]
+		c.Cleanup(sheet2.Close)
+		c.Assert(sheet2.PageSetup(), qt.Equals, setup)
+	})
+
+	csRunO(c, "Scale", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("PageSetupScale")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		sheet.AddRow().AddCell().SetString("small")
+		setup := PageSetup{
+			Orientation:     OrientationPortrait,
+			PaperSize:       PaperLetter,
+			Scale:           75,
+			FirstPageNumber: 3,
+			BlackAndWhite:   true,
+		}
+		c.Assert(sheet.SetPageSetup(setup), qt.IsNil)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		xml := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(xml, qt.Not(qt.Matches), `(?s).*fitToPage="(true|1)".*`)
+		c.Assert(xml, qt.Matches, `(?s).*<pageSetup [^>]*scale="75"`+".*")
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet2 := f2.Sheets[0]
+		c.Cleanup(sheet2.Close)
+		c.Assert(sheet2.PageSetup(), qt.Equals, setup)
+	})
+
+	c.Run("Unset", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell().SetString("plain")
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Not(qt.Matches), `(?s).*<pageSetup.*`)
+	})
+
+	c.Run("ReadFitToPageDefaults", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell().SetString("read")
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		data := rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				s := strings.Replace(string(body), `fitToPage="false"`, `fitToPage="1"`, 1)
+				s = strings.Replace(s, "</sheetData>", `</sheetData><pageSetup orientation="landscape"/>`, 1)
+				body = []byte(s)
+			}
+			return name, body
+		})
+		f2, err := OpenBinary(data)
+		c.Assert(err, qt.IsNil)
+		// Absent, the number of pages to fit to is 1 each way.
+		c.Assert(f2.Sheets[0].PageSetup(), qt.Equals, PageSetup{
+			Orientation: OrientationLandscape,
+			FitToWidth:  1,
+			FitToHeight: 1,
+		})
+	})
+}
+
+func TestPageMargins(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Invalid", func(c *qt.C) {
+		sheet, err := NewSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.PageMargins(), qt.Equals, DefaultPageMargins)
+		c.Assert(sheet.SetPageMargins(-1, 1, 1, 1, 0.5, 0.5), qt.Not(qt.IsNil))
+		c.Assert(sheet.SetPageMargins(1, 1, math.NaN(), 1, 0.5, 0.5), qt.Not(qt.IsNil))
+		// 8.4 inches of margin leave nothing of an A4 page's width.
+		c.Assert(sheet.SetPageMargins(4.2, 4.2, 1, 1, 0.5, 0.5), qt.Not(qt.IsNil))
+		c.Assert(sheet.SetPageSetup(PageSetup{Orientation: OrientationLandscape}), qt.IsNil)
+		c.Assert(sheet.SetPageMargins(4.2, 4.2, 1, 1, 0.5, 0.5), qt.IsNil)
+		// Turned back to portrait, the margins no longer fit.
+		c.Assert(sheet.SetPageSetup(PageSetup{PaperSize: PaperA4}), qt.Not(qt.IsNil))
+		c.Assert(sheet.PageSetup().Orientation, qt.Equals, OrientationLandscape)
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("PageMargins")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		sheet.AddRow().AddCell().SetString("margins")
+		c.Assert(sheet.SetPageMargins(0.25, 0.25, 1, 1, 0.5, 0.4), qt.IsNil)
+		sheet.SetPrintCentered(true, false)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		xml := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(xml, qt.Matches, `(?s).*<printOptions horizontalCentered="(true|1)"(/>|></printOptions>)<pageMargins left="0.25" right="0.25" top="1" bottom="1" header="0.5" footer="0.4"`+".*")
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet2 := f2.Sheets[0]
+		c.Cleanup(sheet2.Close)
+		c.Assert(sheet2.PageMargins(), qt.Equals, PageMargins{
+			Left: 0.25, Right: 0.25,
+			Top: 1, Bottom: 1,
+			Header: 0.5, Footer: 0.4,
+		})
+		horizontally, vertically := sheet2.PrintCentered()
+		c.Assert(horizontally, qt.IsTrue)
+		c.Assert(vertically, qt.IsFalse)
+	})
+
+	c.Run("Untouched", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell().SetString("read")
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		const margins = `<pageMargins left="0.78740157480314954" right="0.78740157480314954" top="1.0249999999999999" bottom="1.0249999999999999" header="0.78740157480314954" footer="0.78740157480314954"`
+		data := rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				body = []byte(strings.Replace(string(body), "</sheetData>", "</sheetData>"+margins+"/>", 1))
+			}
+			return name, body
+		})
+		f2, err := OpenBinary(data)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f2.Sheets[0].PageMargins().Top, qt.Equals, 1.0249999999999999)
+
+		parts, err := f2.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(strings.Contains(parts["xl/worksheets/sheet1.xml"], margins), qt.IsTrue)
+		buf.Reset()
+		c.Assert(f2.Write(&buf), qt.IsNil)
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				c.Assert(strings.Contains(string(body), margins), qt.IsTrue)
+			}
+			return name, body
+		})
+	})
+}
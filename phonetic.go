@@ -0,0 +1,139 @@
+package xlsx
+
+import "reflect"
+
+// PhoneticRun is a run of phonetic text, such as the furigana that
+// Japanese Excel shows above kanji, which gives the reading of the
+// characters of the text of a cell from Start up to, but not
+// including, End.  Start and End count characters, not bytes.
+type PhoneticRun struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// PhoneticProperties are the properties of the phonetic text of a
+// cell.  FontID is the index of the font it is shown in among the
+// fonts of the file it was read from.  Type is the kind of characters
+// it is written in, such as "Hiragana", and Alignment how it is
+// aligned over the text, such as "distributed".  Empty, they are
+// Excel's defaults, "fullwidthKatakana" and "left".
+type PhoneticProperties struct {
+	FontID    int
+	Type      string
+	Alignment string
+}
+
+// Phonetic is the phonetic text of a cell, as it was read from the
+// file.
+type Phonetic struct {
+	Runs       []PhoneticRun
+	Properties *PhoneticProperties
+	// text is the text of the cell that the runs are the reading of.
+	text string
+	// font is the font of FontID, which is written to the styles of
+	// the file with the phonetic text, so that its index is right
+	// whatever the other fonts that are written.
+	font *xlsxFont
+}
+
+// Phonetic returns the phonetic text of the cell, such as the furigana
+// of Japanese text, or nil if it hasn't any.  Phonetic text is read
+// from the file and written back unchanged when the file is saved,
+// unless the text of the cell is changed, since it is the reading of
+// that text.
+func (c *Cell) Phonetic() *Phonetic {
+	if !c.writesPhonetic() {
+		return nil
+	}
+	ph := *c.phonetic
+	ph.Runs = append([]PhoneticRun(nil), c.phonetic.Runs...)
+	if c.phonetic.Properties != nil {
+		props := *c.phonetic.Properties
+		ph.Properties = &props
+	}
+	return &ph
+}
+
+// writesPhonetic reports whether the cell has phonetic text, which is
+// the reading of its current text.
+func (c *Cell) writesPhonetic() bool {
+	return c.phonetic != nil && c.phonetic.text == c.Value
+}
+
+// addPhoneticString adds the text of the cell, with its phonetic text,
+// to refTable, and returns its index there.
+func (c *Cell) addPhoneticString(refTable *RefTable, styles *xlsxStyleSheet) int {
+	var richText []RichTextRun
+	if c.writesRichText() {
+		richText = c.RichText
+	}
+	return refTable.addPhonetic(c.Value, richText, c.phonetic, styles)
+}
+
+// equals reports whether ph and other are the same phonetic text.
+func (ph *Phonetic) equals(other *Phonetic) bool {
+	return reflect.DeepEqual(ph, other)
+}
+
+// makePhonetic returns the phonetic text of si, or nil if it hasn't
+// any.  The font of its properties is looked up in styles, if it
+// isn't nil.
+func makePhonetic(si *xlsxSI, styles *xlsxStyleSheet) *Phonetic {
+	if si == nil || len(si.RPh) == 0 && si.PhoneticPr == nil {
+		return nil
+	}
+	ph := &Phonetic{}
+	if si.T != nil {
+		ph.text = si.T.getText()
+	} else {
+		ph.text = richTextToPlainText(xmlToRichText(si.R))
+	}
+	for _, rPh := range si.RPh {
+		ph.Runs = append(ph.Runs, PhoneticRun{Start: rPh.Sb, End: rPh.Eb, Text: rPh.T.Text})
+	}
+	if si.PhoneticPr != nil {
+		ph.Properties = &PhoneticProperties{
+			FontID:    si.PhoneticPr.FontID,
+			Type:      si.PhoneticPr.Type,
+			Alignment: si.PhoneticPr.Alignment,
+		}
+		ph.resolveFont(styles)
+	}
+	return ph
+}
+
+// resolveFont looks up the font of the properties of ph in styles.
+func (ph *Phonetic) resolveFont(styles *xlsxStyleSheet) {
+	if styles == nil || ph.Properties == nil {
+		return
+	}
+	if id := ph.Properties.FontID; id >= 0 && id < len(styles.Fonts.Font) {
+		font := styles.Fonts.Font[id]
+		ph.font = &font
+	}
+}
+
+// addFont adds the font of the properties of ph to styles, and
+// returns its index there, or 0, the default font, if it hasn't one.
+func (ph *Phonetic) addFont(styles *xlsxStyleSheet) int {
+	if ph.font == nil || styles == nil {
+		return 0
+	}
+	return styles.addFont(*ph.font)
+}
+
+// addToXlsxSI adds the phonetic text to si, with fontID as the index of
+// the font of its properties.
+func (ph *Phonetic) addToXlsxSI(si *xlsxSI, fontID int) {
+	for _, run := range ph.Runs {
+		si.RPh = append(si.RPh, xlsxPhoneticRun{Sb: run.Start, Eb: run.End, T: xlsxT{Text: run.Text}})
+	}
+	if ph.Properties != nil {
+		si.PhoneticPr = &xlsxPhoneticPr{
+			FontID:    fontID,
+			Type:      ph.Properties.Type,
+			Alignment: ph.Properties.Alignment,
+		}
+	}
+}
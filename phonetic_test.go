@@ -0,0 +1,114 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// makePhoneticFile returns a file whose first cell, "東京", has the
+// furigana "トウキョウ" shown in the font of its bold second cell.
+func makePhoneticFile(c *qt.C, inline bool) []byte {
+	f := NewFile()
+	sheet, err := f.AddSheet("Phonetic")
+	c.Assert(err, qt.IsNil)
+	row := sheet.AddRow()
+	row.AddCell().SetString("東京")
+	cell := row.AddCell()
+	cell.SetString("bold")
+	style := NewStyle()
+	style.Font.Bold = true
+	cell.SetStyle(style)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), qt.IsNil)
+
+	const phonetic = `<rPh sb="0" eb="2"><t>トウキョウ</t></rPh><phoneticPr fontId="1" type="Hiragana"/>`
+	return rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+		switch {
+		case name == "xl/sharedStrings.xml" && !inline:
+			body = bytes.Replace(body, []byte(`<t>東京</t>`), []byte(`<t>東京</t>`+phonetic), 1)
+		case name == "xl/worksheets/sheet1.xml" && inline:
+			body = bytes.Replace(body, []byte(`<c r="A1" t="s"><v>0</v></c>`),
+				[]byte(`<c r="A1" t="inlineStr"><is><t>東京</t>`+phonetic+`</is></c>`), 1)
+		}
+		return name, body
+	})
+}
+
+func TestPhonetic(t *testing.T) {
+	c := qt.New(t)
+
+	checkPhonetic := func(c *qt.C, f *File) {
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "東京")
+		ph := cell.Phonetic()
+		c.Assert(ph, qt.Not(qt.IsNil))
+		c.Assert(ph.Runs, qt.DeepEquals, []PhoneticRun{{Start: 0, End: 2, Text: "トウキョウ"}})
+		c.Assert(ph.Properties.Type, qt.Equals, "Hiragana")
+		c.Assert(ph.Properties.Alignment, qt.Equals, "")
+		// Its font is the bold one, wherever that is written.
+		font := f.styles.Fonts.Font[ph.Properties.FontID]
+		c.Assert(font.B, qt.Not(qt.IsNil))
+	}
+
+	for _, inline := range []bool{false, true} {
+		name := "SharedString"
+		if inline {
+			name = "InlineString"
+		}
+		csRunO(c, name+"RoundTrip", func(c *qt.C, option FileOption) {
+			f, err := OpenBinary(makePhoneticFile(c, inline), option)
+			c.Assert(err, qt.IsNil)
+			checkPhonetic(c, f)
+
+			// The copy returned by Phonetic doesn't change the cell.
+			cell, err := f.Sheets[0].Cell(0, 0)
+			c.Assert(err, qt.IsNil)
+			cell.Phonetic().Runs[0].Text = "changed"
+			c.Assert(cell.Phonetic().Runs[0].Text, qt.Equals, "トウキョウ")
+
+			var buf bytes.Buffer
+			c.Assert(f.Write(&buf), qt.IsNil)
+			f, err = OpenBinary(buf.Bytes(), option)
+			c.Assert(err, qt.IsNil)
+			checkPhonetic(c, f)
+
+			// It is written in the shared strings again.
+			var sst string
+			rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+				if name == "xl/sharedStrings.xml" {
+					sst = string(body)
+				}
+				return name, body
+			})
+			c.Assert(sst, qt.Contains, `<si><t>東京</t><rPh sb="0" eb="2"><t>トウキョウ</t></rPh><phoneticPr fontId="`)
+			c.Assert(strings.Count(sst, "<rPh "), qt.Equals, 1)
+		})
+	}
+
+	csRunO(c, "ChangedTextDropsPhonetic", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(makePhoneticFile(c, false), option)
+		c.Assert(err, qt.IsNil)
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("大阪")
+		c.Assert(cell.Phonetic(), qt.IsNil)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/sharedStrings.xml"], qt.Not(qt.Contains), "<rPh")
+		c.Assert(parts["xl/sharedStrings.xml"], qt.Not(qt.Contains), "<phoneticPr")
+	})
+
+	csRunO(c, "WriteInlineStrings", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(makePhoneticFile(c, false), option, WriteInlineStrings())
+		c.Assert(err, qt.IsNil)
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains,
+			`<is><t>東京</t><rPh sb="0" eb="2"><t>トウキョウ</t></rPh><phoneticPr fontId="`)
+	})
+}
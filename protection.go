@@ -0,0 +1,278 @@
+package xlsx
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/shabbyrobe/xmlwriter"
+)
+
+// SheetProtection describes the protection applied to a Sheet, as
+// read from its sheetProtection element.
+//
+// As in the file format, each of the permission flags is true when
+// the corresponding action is locked whilst the sheet is protected,
+// and false when users may still perform it.  For example, if
+// InsertRows is false, rows can be inserted into the protected sheet.
+type SheetProtection struct {
+	// Sheet is true when the sheet is protected, the remaining flags
+	// only take effect when it is.
+	Sheet               bool
+	Objects             bool
+	Scenarios           bool
+	FormatCells         bool
+	FormatColumns       bool
+	FormatRows          bool
+	InsertColumns       bool
+	InsertRows          bool
+	InsertHyperlinks    bool
+	DeleteColumns       bool
+	DeleteRows          bool
+	SelectLockedCells   bool
+	Sort                bool
+	AutoFilter          bool
+	PivotTables         bool
+	SelectUnlockedCells bool
+
+	// AlgorithmName is the name of the hash algorithm used for the
+	// password, for example "SHA-512".  It is empty if the password
+	// uses the legacy 16 bit hash, or there is no password.
+	AlgorithmName string
+	// SaltValue is the base64 encoded salt that was hashed with the
+	// password.
+	SaltValue string
+	// SpinCount is the number of times the hash was iterated.
+	SpinCount int
+	// HasPassword is true when a password hash is present.
+	HasPassword bool
+
+	hashValue      string
+	legacyPassword string
+}
+
+// The values of the sheetProtection attributes when they are absent,
+// as given by the CT_SheetProtection schema type.
+var sheetProtectionDefaults = map[string]bool{
+	"sheet":               false,
+	"objects":             false,
+	"scenarios":           false,
+	"formatCells":         true,
+	"formatColumns":       true,
+	"formatRows":          true,
+	"insertColumns":       true,
+	"insertRows":          true,
+	"insertHyperlinks":    true,
+	"deleteColumns":       true,
+	"deleteRows":          true,
+	"selectLockedCells":   false,
+	"sort":                true,
+	"autoFilter":          true,
+	"pivotTables":         true,
+	"selectUnlockedCells": false,
+}
+
+// xlsxSheetProtection directly maps the sheetProtection element.  The
+// attributes are kept exactly as they were read, so that any that we
+// don't know about survive being written back out.
+type xlsxSheetProtection struct {
+	Attrs []xml.Attr `xml:",any,attr"`
+}
+
+// keepSheetProtection returns the parts of a sheetProtection element
+// read from a file that should be written back out.  All of its
+// attributes are kept, but for the declarations of namespaces, which
+// are made afresh for those of the attributes when they are written.
+func keepSheetProtection(p *xlsxSheetProtection) *xlsxSheetProtection {
+	if p == nil {
+		return nil
+	}
+	kept := &xlsxSheetProtection{}
+	for _, attr := range p.Attrs {
+		if attr.Name.Space != "xmlns" {
+			kept.Attrs = append(kept.Attrs, attr)
+		}
+	}
+	return kept
+}
+
+// xmlNamespace is the namespace of the attributes with the prefix xml,
+// such as xml:lang, which needn't be declared.
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// sheetProtectionAttrs returns the attributes of p to write.  Those
+// from other namespaces are given prefixes, which are declared on the
+// element.
+func sheetProtectionAttrs(p *xlsxSheetProtection) []xmlwriter.Attr {
+	var attrs []xmlwriter.Attr
+	prefixes := make(map[string]string)
+	for _, attr := range p.Attrs {
+		name := attr.Name.Local
+		switch attr.Name.Space {
+		case "":
+		case xmlNamespace:
+			name = "xml:" + name
+		default:
+			prefix, ok := prefixes[attr.Name.Space]
+			if !ok {
+				prefix = fmt.Sprintf("ns%d", len(prefixes)+1)
+				prefixes[attr.Name.Space] = prefix
+				attrs = append(attrs, xmlwriter.Attr{Name: "xmlns:" + prefix, Value: attr.Name.Space})
+			}
+			name = prefix + ":" + name
+		}
+		attrs = append(attrs, xmlwriter.Attr{Name: name, Value: attr.Value})
+	}
+	return attrs
+}
+
+// makeSheetProtection builds a SheetProtection from the attributes of
+// a sheetProtection element.
+func makeSheetProtection(p *xlsxSheetProtection) *SheetProtection {
+	values := make(map[string]string, len(p.Attrs))
+	for _, attr := range p.Attrs {
+		values[attr.Name.Local] = attr.Value
+	}
+	flag := func(name string) bool {
+		value, ok := values[name]
+		if !ok {
+			return sheetProtectionDefaults[name]
+		}
+		return value == "1" || value == "true"
+	}
+	protection := &SheetProtection{
+		Sheet:               flag("sheet"),
+		Objects:             flag("objects"),
+		Scenarios:           flag("scenarios"),
+		FormatCells:         flag("formatCells"),
+		FormatColumns:       flag("formatColumns"),
+		FormatRows:          flag("formatRows"),
+		InsertColumns:       flag("insertColumns"),
+		InsertRows:          flag("insertRows"),
+		InsertHyperlinks:    flag("insertHyperlinks"),
+		DeleteColumns:       flag("deleteColumns"),
+		DeleteRows:          flag("deleteRows"),
+		SelectLockedCells:   flag("selectLockedCells"),
+		Sort:                flag("sort"),
+		AutoFilter:          flag("autoFilter"),
+		PivotTables:         flag("pivotTables"),
+		SelectUnlockedCells: flag("selectUnlockedCells"),
+		AlgorithmName:       values["algorithmName"],
+		SaltValue:           values["saltValue"],
+		hashValue:           values["hashValue"],
+		legacyPassword:      values["password"],
+	}
+	protection.SpinCount, _ = strconv.Atoi(values["spinCount"])
+	protection.HasPassword = protection.hashValue != "" || protection.legacyPassword != ""
+	return protection
+}
+
+// Protection returns the protection applied to the Sheet, or nil if
+// the sheet has none.  The returned SheetProtection is a copy, changing
+// it has no effect on the Sheet.
+func (s *Sheet) Protection() *SheetProtection {
+	if s.protection == nil {
+		return nil
+	}
+	return makeSheetProtection(s.protection)
+}
+
+// VerifyPassword returns true if password matches the password hash
+// stored in the SheetProtection.  It returns false if there is no
+// password, or it was hashed with an algorithm that isn't supported.
+func (p *SheetProtection) VerifyPassword(password string) bool {
+	if p == nil {
+		return false
+	}
+	if p.hashValue != "" {
+		expected, err := base64.StdEncoding.DecodeString(p.hashValue)
+		if err != nil {
+			return false
+		}
+		actual, err := hashSheetPassword(password, p.AlgorithmName, p.SaltValue, p.SpinCount)
+		if err != nil {
+			return false
+		}
+		return bytes.Equal(expected, actual)
+	}
+	if p.legacyPassword != "" {
+		return strings.EqualFold(p.legacyPassword, legacySheetPasswordHash(password))
+	}
+	return false
+}
+
+// newSheetPasswordHash returns a new hash.Hash for the named
+// algorithm.
+func newSheetPasswordHash(algorithmName string) (hash.Hash, error) {
+	switch algorithmName {
+	case "SHA-512":
+		return sha512.New(), nil
+	case "SHA-384":
+		return sha512.New384(), nil
+	case "SHA-256":
+		return sha256.New(), nil
+	case "SHA-1":
+		return sha1.New(), nil
+	case "MD5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %q", algorithmName)
+}
+
+// hashSheetPassword hashes password the way Excel does when it
+// protects a sheet: the salt is hashed with the UTF-16LE encoded
+// password, and the result is then rehashed spinCount times, each
+// time with the little endian iteration number appended.
+func hashSheetPassword(password, algorithmName, saltValue string, spinCount int) ([]byte, error) {
+	h, err := newSheetPasswordHash(algorithmName)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := base64.StdEncoding.DecodeString(saltValue)
+	if err != nil {
+		return nil, err
+	}
+	encoded := utf16.Encode([]rune(password))
+	pw := make([]byte, 2*len(encoded))
+	for i, u := range encoded {
+		binary.LittleEndian.PutUint16(pw[2*i:], u)
+	}
+	h.Write(salt)
+	h.Write(pw)
+	sum := h.Sum(nil)
+	iterator := make([]byte, 4)
+	for i := 0; i < spinCount; i++ {
+		binary.LittleEndian.PutUint32(iterator, uint32(i))
+		h.Reset()
+		h.Write(sum)
+		h.Write(iterator)
+		sum = h.Sum(sum[:0])
+	}
+	return sum, nil
+}
+
+// legacySheetPasswordHash returns the 16 bit password hash, as
+// hexadecimal, that older versions of Excel store in the password
+// attribute.
+func legacySheetPasswordHash(password string) string {
+	var hash uint16
+	for i, char := range []byte(password) {
+		value := uint32(char) << uint(i+1)
+		rotated := value >> 15
+		value &= 0x7fff
+		hash ^= uint16(value | rotated)
+	}
+	hash ^= uint16(len(password))
+	hash ^= 0xCE4B
+	return fmt.Sprintf("%04X", hash)
+}
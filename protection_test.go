@@ -0,0 +1,137 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSheetProtection(t *testing.T) {
+	c := qt.New(t)
+
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, qt.IsNil)
+	sheet.AddRow().AddCell().SetString("locked")
+	c.Assert(sheet.Protection(), qt.IsNil)
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), qt.IsNil)
+	unprotected := buf.Bytes()
+
+	// protect adds a sheetProtection element to the first sheet.
+	protect := func(element string) []byte {
+		return rewriteXLSX(c, unprotected, func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				body = []byte(strings.Replace(string(body), "</sheetData>", "</sheetData>"+element, 1))
+			}
+			return name, body
+		})
+	}
+
+	c.Run("Defaults", func(c *qt.C) {
+		f, err := OpenBinary(protect(`<sheetProtection sheet="1"/>`))
+		c.Assert(err, qt.IsNil)
+		p := f.Sheets[0].Protection()
+		c.Assert(p, qt.Not(qt.IsNil))
+		c.Assert(p.Sheet, qt.IsTrue)
+		c.Assert(p.Objects, qt.IsFalse)
+		c.Assert(p.FormatCells, qt.IsTrue)
+		c.Assert(p.InsertRows, qt.IsTrue)
+		c.Assert(p.SelectLockedCells, qt.IsFalse)
+		c.Assert(p.HasPassword, qt.IsFalse)
+		c.Assert(p.VerifyPassword(""), qt.IsFalse)
+	})
+
+	c.Run("Permissions", func(c *qt.C) {
+		f, err := OpenBinary(protect(`<sheetProtection sheet="1" objects="1" scenarios="true" insertRows="0" deleteRows="0" sort="0" selectUnlockedCells="1"/>`))
+		c.Assert(err, qt.IsNil)
+		p := f.Sheets[0].Protection()
+		c.Assert(p.Objects, qt.IsTrue)
+		c.Assert(p.Scenarios, qt.IsTrue)
+		c.Assert(p.InsertRows, qt.IsFalse)
+		c.Assert(p.DeleteRows, qt.IsFalse)
+		c.Assert(p.Sort, qt.IsFalse)
+		c.Assert(p.InsertColumns, qt.IsTrue)
+		c.Assert(p.SelectUnlockedCells, qt.IsTrue)
+	})
+
+	c.Run("Hashed password", func(c *qt.C) {
+		f, err := OpenBinary(protect(`<sheetProtection algorithmName="SHA-512" hashValue="CuF5axNVXUBkO2qloE31bcdYHWdOluK7fApMpNlHDYFGW9qj/IRvc1titSnw4LZSDIf/LiR6uQJUpw/fHH0oWA==" saltValue="c2FsdHNhbHRzYWx0c2FsdA==" spinCount="100000" sheet="1"/>`))
+		c.Assert(err, qt.IsNil)
+		p := f.Sheets[0].Protection()
+		c.Assert(p.AlgorithmName, qt.Equals, "SHA-512")
+		c.Assert(p.SaltValue, qt.Equals, "c2FsdHNhbHRzYWx0c2FsdA==")
+		c.Assert(p.SpinCount, qt.Equals, 100000)
+		c.Assert(p.HasPassword, qt.IsTrue)
+		c.Assert(p.VerifyPassword("secret"), qt.IsTrue)
+		c.Assert(p.VerifyPassword("Secret"), qt.IsFalse)
+		c.Assert(p.VerifyPassword(""), qt.IsFalse)
+	})
+
+	c.Run("Legacy password", func(c *qt.C) {
+		f, err := OpenBinary(protect(`<sheetProtection password="83AF" sheet="1"/>`))
+		c.Assert(err, qt.IsNil)
+		p := f.Sheets[0].Protection()
+		c.Assert(p.HasPassword, qt.IsTrue)
+		c.Assert(p.VerifyPassword("password"), qt.IsTrue)
+		c.Assert(p.VerifyPassword("Password"), qt.IsFalse)
+	})
+
+	c.Run("Unsupported algorithm", func(c *qt.C) {
+		f, err := OpenBinary(protect(`<sheetProtection algorithmName="WHIRLPOOL" hashValue="AAAA" saltValue="AAAA" spinCount="1" sheet="1"/>`))
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[0].Protection().VerifyPassword("secret"), qt.IsFalse)
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		element := `<sheetProtection sheet="1" insertRows="0" futureFlag="1" algorithmName="SHA-512" hashValue="CuF5axNVXUBkO2qloE31bcdYHWdOluK7fApMpNlHDYFGW9qj/IRvc1titSnw4LZSDIf/LiR6uQJUpw/fHH0oWA==" saltValue="c2FsdHNhbHRzYWx0c2FsdA==" spinCount="100000"></sheetProtection>`
+		f, err := OpenBinary(protect(element), option)
+		c.Assert(err, qt.IsNil)
+
+		// Both ways of writing a sheet must keep the element.
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, element)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		p := f.Sheets[0].Protection()
+		c.Assert(p.InsertRows, qt.IsFalse)
+		c.Assert(p.VerifyPassword("secret"), qt.IsTrue)
+		c.Assert(f.Sheets[0].protection.Attrs, qt.HasLen, 7)
+		c.Assert(f.Sheets[0].protection.Attrs[2].Name.Local, qt.Equals, "futureFlag")
+	})
+
+	csRunO(c, "NamespacedAttributes", func(c *qt.C, option FileOption) {
+		const ac = "http://schemas.microsoft.com/office/spreadsheetml/2009/9/ac"
+		element := `<sheetProtection xmlns:x14ac="` + ac + `" sheet="1" x14ac:futureFlag="1" xml:lang="en"/>`
+		f, err := OpenBinary(protect(element), option)
+		c.Assert(err, qt.IsNil)
+		expected := []xml.Attr{
+			{Name: xml.Name{Local: "sheet"}, Value: "1"},
+			{Name: xml.Name{Space: ac, Local: "futureFlag"}, Value: "1"},
+			{Name: xml.Name{Space: xmlNamespace, Local: "lang"}, Value: "en"},
+		}
+		c.Assert(f.Sheets[0].protection.Attrs, qt.DeepEquals, expected)
+
+		// Both ways of writing a sheet must keep the attributes, in
+		// their namespaces.
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		var worksheet xlsxWorksheet
+		c.Assert(xml.Unmarshal([]byte(parts["xl/worksheets/sheet1.xml"]), &worksheet), qt.IsNil)
+		c.Assert(keepSheetProtection(worksheet.SheetProtection).Attrs, qt.DeepEquals, expected)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[0].protection.Attrs, qt.DeepEquals, expected)
+		c.Assert(f.Sheets[0].Protection().Sheet, qt.IsTrue)
+	})
+}
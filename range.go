@@ -0,0 +1,263 @@
+package xlsx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Range is a rectangular block of cells within a Sheet, such as the
+// cells referred to by "B2:F10".  The row and column indexes are zero
+// based and inclusive.
+type Range struct {
+	Sheet    *Sheet
+	FirstRow int
+	FirstCol int
+	LastRow  int
+	LastCol  int
+}
+
+// Range returns the Range of cells described by ref, which is either
+// a single cell reference such as "B2", or a pair of references
+// separated by a colon such as "B2:F10".
+func (s *Sheet) Range(ref string) (*Range, error) {
+	r, err := parseRange(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Sheet.Range(%q): %w", ref, err)
+	}
+	r.Sheet = s
+	return r, nil
+}
+
+// parseRange returns the Range described by ref, as Sheet.Range does,
+// without a Sheet.
+func parseRange(ref string) (*Range, error) {
+	first, last := ref, ref
+	if i := strings.IndexByte(ref, ':'); i >= 0 {
+		first, last = ref[:i], ref[i+1:]
+	}
+	firstCol, firstRow, err := getCoordsFromCellRef(first)
+	if err != nil {
+		return nil, err
+	}
+	lastCol, lastRow, err := getCoordsFromCellRef(last)
+	if err != nil {
+		return nil, err
+	}
+	if firstRow > lastRow {
+		firstRow, lastRow = lastRow, firstRow
+	}
+	if firstCol > lastCol {
+		firstCol, lastCol = lastCol, firstCol
+	}
+	return &Range{
+		FirstRow: firstRow,
+		FirstCol: firstCol,
+		LastRow:  lastRow,
+		LastCol:  lastCol,
+	}, nil
+}
+
+// contains reports whether the cell at col and row is in the Range.
+func (r *Range) contains(col, row int) bool {
+	return col >= r.FirstCol && col <= r.LastCol && row >= r.FirstRow && row <= r.LastRow
+}
+
+// sqrefString returns the Range in the form of an sqref, which is the
+// reference of its cell alone, such as "C3", if it has only one.
+func (r *Range) sqrefString() string {
+	if r.FirstCol == r.LastCol && r.FirstRow == r.LastRow {
+		return GetCellIDStringFromCoords(r.FirstCol, r.FirstRow)
+	}
+	return r.String()
+}
+
+// moveCols returns the Range as it is once a column is inserted at the
+// zero based col, if delta is 1, or removed from there, if delta is
+// -1.  The columns from col onwards move with the cells in them, and a
+// Range that spans col grows or shrinks.  ok is false if the Range was
+// only made of the removed column.
+func (r Range) moveCols(col, delta int) (moved Range, ok bool) {
+	if r.FirstCol > col || (delta > 0 && r.FirstCol == col) {
+		r.FirstCol += delta
+	}
+	if r.LastCol >= col {
+		r.LastCol += delta
+	}
+	return r, r.LastCol >= r.FirstCol
+}
+
+// moveRows returns the Range as it is once the row at the zero based
+// row is removed, as moveCols does for a column.
+func (r Range) moveRows(row, delta int) (moved Range, ok bool) {
+	if r.FirstRow > row || (delta > 0 && r.FirstRow == row) {
+		r.FirstRow += delta
+	}
+	if r.LastRow >= row {
+		r.LastRow += delta
+	}
+	return r, r.LastRow >= r.FirstRow
+}
+
+// moveSqref moves each range of sqref, a list of ranges separated by
+// spaces, with move, which is Range.moveCols or Range.moveRows bound to
+// a column or row.  The ranges for which move returns false are left
+// out.
+func moveSqref(sqref string, move func(r Range) (Range, bool)) string {
+	var refs []string
+	for _, ref := range strings.Fields(sqref) {
+		r, err := parseRange(ref)
+		if err != nil {
+			refs = append(refs, ref)
+			continue
+		}
+		if moved, ok := move(*r); ok {
+			refs = append(refs, moved.sqrefString())
+		}
+	}
+	return strings.Join(refs, " ")
+}
+
+// RangeRef returns the Range of cells described by an A1-style
+// reference, such as "A1:C10".  It is the same as Range.
+func (s *Sheet) RangeRef(ref string) (*Range, error) {
+	return s.Range(ref)
+}
+
+// CellAtRef returns the cell at an A1-style reference, such as "BD17",
+// creating it, and the rows before it, if it doesn't exist yet, as Cell
+// does.
+func (s *Sheet) CellAtRef(ref string) (*Cell, error) {
+	x, y, err := getCoordsFromCellRef(ref)
+	if err != nil {
+		return nil, fmt.Errorf("Sheet.CellAtRef: %w", err)
+	}
+	return s.Cell(y, x)
+}
+
+// String returns the Range in Excel format, e.g. "B2:F10".
+func (r *Range) String() string {
+	return GetCellIDStringFromCoords(r.FirstCol, r.FirstRow) + ":" + GetCellIDStringFromCoords(r.LastCol, r.LastRow)
+}
+
+// ForEachCell calls cvf for every cell in the Range, row by row,
+// creating any cells that don't exist yet.
+func (r *Range) ForEachCell(cvf CellVisitorFunc) error {
+	for y := r.FirstRow; y <= r.LastRow; y++ {
+		for x := r.FirstCol; x <= r.LastCol; x++ {
+			cell, err := r.Sheet.Cell(y, x)
+			if err != nil {
+				return err
+			}
+			if err = cvf(cell); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restyle replaces the Style of every cell in the Range for which
+// modify returns true.  modify is given a clone of the cell's current
+// Style to change, and a key that identifies the change being made;
+// cells that share a Style and a key end up sharing the new Style, so
+// that the minimum number of distinct styles is created.
+func (r *Range) restyle(key func(c *Cell) (int, bool), modify func(c *Cell, style *Style)) error {
+	type restyled struct {
+		style *Style
+		key   int
+	}
+	styles := make(map[restyled]*Style)
+	return r.ForEachCell(func(c *Cell) error {
+		k, ok := key(c)
+		if !ok {
+			return nil
+		}
+		// Cells without a Style share the default one.
+		old := restyled{style: c.style, key: k}
+		style, ok := styles[old]
+		if !ok {
+			if c.style == nil {
+				style = NewStyle()
+			} else {
+				style = c.style.Clone()
+			}
+			modify(c, style)
+			styles[old] = style
+		}
+		c.SetStyle(style)
+		return nil
+	})
+}
+
+// Sides of a cell that SetOutlineBorder draws on.
+const (
+	outlineLeft = 1 << iota
+	outlineRight
+	outlineTop
+	outlineBottom
+)
+
+// SetOutlineBorder draws a border of the given line style and ARGB
+// colour around the outside of the Range.  Only the outward facing
+// sides of the cells on the perimeter are changed, so corner cells
+// get two sides, any other borders those cells already have are kept
+// and the interior of the Range is left untouched.
+func (r *Range) SetOutlineBorder(style string, argb string) error {
+	sides := func(c *Cell) (int, bool) {
+		x, y := c.GetCoordinates()
+		var s int
+		if x == r.FirstCol {
+			s |= outlineLeft
+		}
+		if x == r.LastCol {
+			s |= outlineRight
+		}
+		if y == r.FirstRow {
+			s |= outlineTop
+		}
+		if y == r.LastRow {
+			s |= outlineBottom
+		}
+		return s, s != 0
+	}
+	return r.restyle(sides, func(c *Cell, s *Style) {
+		outline, _ := sides(c)
+		if outline&outlineLeft != 0 {
+			s.Border.Left = style
+			s.Border.LeftColor = argb
+		}
+		if outline&outlineRight != 0 {
+			s.Border.Right = style
+			s.Border.RightColor = argb
+		}
+		if outline&outlineTop != 0 {
+			s.Border.Top = style
+			s.Border.TopColor = argb
+		}
+		if outline&outlineBottom != 0 {
+			s.Border.Bottom = style
+			s.Border.BottomColor = argb
+		}
+		s.ApplyBorder = true
+	})
+}
+
+// SetFill applies fill to every cell in the Range, keeping the rest of
+// each cell's Style.
+func (r *Range) SetFill(fill Fill) error {
+	all := func(c *Cell) (int, bool) { return 0, true }
+	return r.restyle(all, func(c *Cell, s *Style) {
+		s.Fill = fill
+		s.ApplyFill = true
+	})
+}
+
+// SetFont applies font to every cell in the Range, keeping the rest of
+// each cell's Style.
+func (r *Range) SetFont(font Font) error {
+	all := func(c *Cell) (int, bool) { return 0, true }
+	return r.restyle(all, func(c *Cell, s *Style) {
+		s.Font = font
+		s.ApplyFont = true
+	})
+}
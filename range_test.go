@@ -0,0 +1,158 @@
+package xlsx
+
+import (
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRange(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Parse", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+
+		r, err := sheet.Range("B2:F10")
+		c.Assert(err, qt.IsNil)
+		c.Assert(r.Sheet, qt.Equals, sheet)
+		c.Assert([]int{r.FirstRow, r.FirstCol, r.LastRow, r.LastCol}, qt.DeepEquals, []int{1, 1, 9, 5})
+		c.Assert(r.String(), qt.Equals, "B2:F10")
+
+		r, err = sheet.Range("F10:B2")
+		c.Assert(err, qt.IsNil)
+		c.Assert(r.String(), qt.Equals, "B2:F10")
+
+		r, err = sheet.Range("C3")
+		c.Assert(err, qt.IsNil)
+		c.Assert(r.String(), qt.Equals, "C3:C3")
+
+		_, err = sheet.Range("B2:nonsense")
+		c.Assert(err, qt.Not(qt.IsNil))
+
+		r, err = sheet.RangeRef("$A$1:C10")
+		c.Assert(err, qt.IsNil)
+		c.Assert(r.String(), qt.Equals, "A1:C10")
+		for _, ref := range []string{"1A", "A0", "A1048577", "XFE1", "A1B"} {
+			_, err = sheet.RangeRef(ref)
+			c.Assert(err, qt.ErrorMatches, `Sheet.Range\("`+ref+`"\): invalid cell reference "`+ref+`": .*`)
+		}
+	})
+
+	csRunO(c, "CellAtRef", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("CellAtRef")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.CellAtRef("BD17")
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Ref(), qt.Equals, "BD17")
+		cell.SetString("here")
+		c.Assert(sheet.MaxRow, qt.Equals, 17)
+
+		cell, err = sheet.Cell(16, 55)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "here")
+		cell, err = sheet.CellAtRef("b2")
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Ref(), qt.Equals, "B2")
+
+		_, err = sheet.CellAtRef("B")
+		c.Assert(err, qt.ErrorMatches, `Sheet.CellAtRef: invalid cell reference "B": it has no row`)
+	})
+
+	csRunO(c, "SetOutlineBorder", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Outline")
+		c.Assert(err, qt.IsNil)
+		for y := 0; y < 5; y++ {
+			row := sheet.AddRow()
+			for x := 0; x < 5; x++ {
+				row.AddCell().SetString(GetCellIDStringFromCoords(x, y))
+			}
+		}
+
+		// C2 is on the top edge and already has a left border,
+		// which must survive the outline.
+		cell, err := sheet.Cell(1, 2)
+		c.Assert(err, qt.IsNil)
+		existing := NewStyle()
+		existing.Border.Left = "dashed"
+		existing.Border.LeftColor = "FF00FF00"
+		existing.ApplyBorder = true
+		cell.SetStyle(existing)
+
+		r, err := sheet.Range("B2:D4")
+		c.Assert(err, qt.IsNil)
+		c.Assert(r.SetOutlineBorder("thick", "FFFF0000"), qt.IsNil)
+
+		path := filepath.Join(c.Mkdir(), "outline.xlsx")
+		c.Assert(f.Save(path), qt.IsNil)
+		f, err = OpenFile(path, option)
+		c.Assert(err, qt.IsNil)
+		sheet = f.Sheets[0]
+
+		border := func(ref string) Border {
+			x, y, err := GetCoordsFromCellIDString(ref)
+			c.Assert(err, qt.IsNil)
+			cell, err := sheet.Cell(y, x)
+			c.Assert(err, qt.IsNil)
+			return cell.GetStyle().Border
+		}
+
+		// Corners get two sides.
+		b := border("B2")
+		c.Assert([]string{b.Left, b.Top, b.Right, b.Bottom}, qt.DeepEquals, []string{"thick", "thick", "none", "none"})
+		c.Assert(b.LeftColor, qt.Equals, "FFFF0000")
+		c.Assert(b.TopColor, qt.Equals, "FFFF0000")
+		b = border("D4")
+		c.Assert([]string{b.Left, b.Top, b.Right, b.Bottom}, qt.DeepEquals, []string{"none", "none", "thick", "thick"})
+
+		// Edges get one side, merged with what was already there.
+		b = border("C2")
+		c.Assert([]string{b.Left, b.Top, b.Right, b.Bottom}, qt.DeepEquals, []string{"dashed", "thick", "none", "none"})
+		c.Assert(b.LeftColor, qt.Equals, "FF00FF00")
+		b = border("B3")
+		c.Assert([]string{b.Left, b.Top, b.Right, b.Bottom}, qt.DeepEquals, []string{"thick", "none", "none", "none"})
+
+		// The interior is untouched.
+		b = border("C3")
+		for _, side := range []string{b.Left, b.Top, b.Right, b.Bottom} {
+			c.Assert(side == "" || side == "none", qt.IsTrue)
+		}
+	})
+
+	c.Run("Shares styles", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		r, err := sheet.Range("A1:C3")
+		c.Assert(err, qt.IsNil)
+		c.Assert(r.SetOutlineBorder("thin", "FF000000"), qt.IsNil)
+
+		styles := make(map[*Style]bool)
+		err = r.ForEachCell(func(cell *Cell) error {
+			styles[cell.GetStyle()] = true
+			return nil
+		})
+		c.Assert(err, qt.IsNil)
+		// Four corners, four edges and the untouched interior.
+		c.Assert(styles, qt.HasLen, 9)
+
+		r, err = sheet.Range("A1:C1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(r.SetFill(*NewFill(Solid_Cell_Fill, RGB_Light_Green, RGB_White)), qt.IsNil)
+		c.Assert(r.SetFont(Font{Name: Helvetica, Size: 12, Bold: true}), qt.IsNil)
+		err = r.ForEachCell(func(cell *Cell) error {
+			style := cell.GetStyle()
+			c.Assert(style.Fill.FgColor, qt.Equals, RGB_Light_Green)
+			c.Assert(style.ApplyFill, qt.IsTrue)
+			c.Assert(style.Font.Bold, qt.IsTrue)
+			c.Assert(style.ApplyFont, qt.IsTrue)
+			c.Assert(style.Border.Top, qt.Equals, "thin")
+			return nil
+		})
+		c.Assert(err, qt.IsNil)
+	})
+}
@@ -118,8 +118,9 @@ func (r *Row) ReadStruct(ptr interface{}) error {
 			}
 			fieldV.SetFloat(value)
 		case reflect.Bool:
-			value := cell.Bool()
-			fieldV.SetBool(value)
+			// Bool, rather than BoolChecked, so that text that isn't
+			// TRUE or FALSE is read as it always has been.
+			fieldV.SetBool(cell.Bool())
 		}
 	}
 	return nil
@@ -230,4 +230,21 @@ func TestRead(t *testing.T) {
 		c.Assert(readStruct.BoolVal, qt.Equals, structVal.BoolVal)
 	})
 
+	csRunO(c, "TestReadStructBoolText", func(c *qt.C, option FileOption) {
+		type structTest struct {
+			BoolVal bool `xlsx:"0"`
+		}
+		f := NewFile(option)
+		sheet, _ := f.AddSheet("TestRead")
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		row.AddCell().SetString("yes")
+
+		// Text that isn't a boolean reads as true, as Cell.Bool has it,
+		// rather than failing.
+		readStruct := &structTest{}
+		c.Assert(row.ReadStruct(readStruct), qt.IsNil)
+		c.Assert(readStruct.BoolVal, qt.IsTrue)
+	})
+
 }
@@ -2,8 +2,8 @@ package xlsx
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -11,6 +11,15 @@ import (
 	"github.com/xenking/redis"
 )
 
+// RedisRow is the CellStoreRow of the RedisCellStore.  Only one cell
+// of a row, the current cell, is held in memory at a time.  Changes to
+// the current cell are written to Redis when another cell of the row
+// becomes the current one, or when the row itself is written, so each
+// cell is persisted whole, with the last value written to each of its
+// fields.  Getting a cell that isn't the current one reads back what
+// was persisted for it, so writing to a cell more than once, with
+// other cells in between, has the same result as writing everything to
+// it in one go.
 type RedisRow struct {
 	row         *Row
 	maxCol      int
@@ -49,16 +58,37 @@ func (rr *RedisRow) AddCell() *Cell {
 	return cell
 }
 
+// errCellUndecodable is wrapped by the errors that readCell returns
+// for a cell whose record was read from Redis but can't be decoded.
+var errCellUndecodable = errors.New("the stored record of the cell can't be decoded")
+
+// readCell reads the persisted state of the cell at index, or returns
+// nil if nothing has been persisted for it.  An error that wraps
+// errCellUndecodable means the record was read but is malformed; any
+// other comes from Redis itself.
 func (rr *RedisRow) readCell(index int) (*Cell, error) {
-	var err error
-	var cellType int
-	var hasStyle, hasDataValidation bool
-	var cellIsNil bool
 	key := rr.CellKey(index)
 	b, err := rr.client.HGET(key, rr.row.makeRowNum())
 	if err != nil {
 		return nil, err
 	}
+	if b == nil {
+		return nil, nil
+	}
+	c, err := decodeRedisCell(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCellUndecodable, err)
+	}
+	return c, nil
+}
+
+// decodeRedisCell decodes the record of a cell written by writeCell,
+// or returns nil if the record is of a nil cell.
+func decodeRedisCell(b []byte) (*Cell, error) {
+	var err error
+	var cellType int
+	var hasStyle, hasDataValidation bool
+	var cellIsNil bool
 
 	buf := bytes.NewReader(b)
 	if cellIsNil, err = readBool(buf); err != nil {
@@ -83,6 +113,9 @@ func (rr *RedisRow) readCell(index int) (*Cell, error) {
 	if c.NumFmt, err = readString(buf); err != nil {
 		return c, err
 	}
+	if c.numFmtId, err = readInt(buf); err != nil {
+		return c, err
+	}
 	if c.date1904, err = readBool(buf); err != nil {
 		return c, err
 	}
@@ -111,12 +144,24 @@ func (rr *RedisRow) readCell(index int) (*Cell, error) {
 	if c.Hyperlink.Tooltip, err = readString(buf); err != nil {
 		return c, err
 	}
+	if c.Hyperlink.Location, err = readString(buf); err != nil {
+		return c, err
+	}
+	if c.Hyperlink.HSpan, err = readInt(buf); err != nil {
+		return c, err
+	}
+	if c.Hyperlink.VSpan, err = readInt(buf); err != nil {
+		return c, err
+	}
 	if c.num, err = readInt(buf); err != nil {
 		return c, err
 	}
 	if c.RichText, err = readRichText(buf); err != nil {
 		return c, err
 	}
+	if c.phonetic, err = readPhonetic(buf); err != nil {
+		return c, err
+	}
 	if err = readEndOfRecord(buf); err != nil {
 		return c, err
 	}
@@ -130,6 +175,8 @@ func (rr *RedisRow) readCell(index int) (*Cell, error) {
 			return c, err
 		}
 	}
+	// The cell is as it was last written to the store.
+	c.MarkClean()
 	return c, nil
 }
 
@@ -158,6 +205,9 @@ func (rr *RedisRow) writeCell(c *Cell) error {
 	if err = writeString(&rr.buf, c.NumFmt); err != nil {
 		return err
 	}
+	if err = writeInt(&rr.buf, c.numFmtId); err != nil {
+		return err
+	}
 	if err = writeBool(&rr.buf, c.date1904); err != nil {
 		return err
 	}
@@ -185,12 +235,24 @@ func (rr *RedisRow) writeCell(c *Cell) error {
 	if err = writeString(&rr.buf, c.Hyperlink.Tooltip); err != nil {
 		return err
 	}
+	if err = writeString(&rr.buf, c.Hyperlink.Location); err != nil {
+		return err
+	}
+	if err = writeInt(&rr.buf, c.Hyperlink.HSpan); err != nil {
+		return err
+	}
+	if err = writeInt(&rr.buf, c.Hyperlink.VSpan); err != nil {
+		return err
+	}
 	if err = writeInt(&rr.buf, c.num); err != nil {
 		return err
 	}
 	if err = writeRichText(&rr.buf, c.RichText); err != nil {
 		return err
 	}
+	if err = writePhonetic(&rr.buf, c.phonetic); err != nil {
+		return err
+	}
 	if err = writeEndOfRecord(&rr.buf); err != nil {
 		return err
 	}
@@ -219,9 +281,13 @@ func (rr *RedisRow) setCurrentCell(cell *Cell) {
 		if err != nil {
 			panic(err.Error())
 		}
+		// The cell is clean when it is read back, so the row keeps
+		// track of the change until it is written itself.
+		rr.row.modified = true
 	}
 	if cell.num > rr.maxCol {
 		rr.maxCol = cell.num
+		rr.row.modified = true
 	}
 	rr.currentCell = cell
 
@@ -232,20 +298,94 @@ func (rr *RedisRow) PushCell(c *Cell) {
 	rr.setCurrentCell(c)
 }
 
+// removeCell deletes the persisted cell at colIdx from the hash of its
+// column, and forgets it if it is the current cell, shrinking the row
+// if it was the rightmost one.
+func (rr *RedisRow) removeCell(colIdx int) error {
+	if rr.currentCell != nil && rr.currentCell.num == colIdx {
+		rr.currentCell = nil
+	}
+	if _, err := rr.client.HDEL(rr.CellKey(colIdx), rr.row.makeRowNum()); err != nil {
+		return err
+	}
+	if colIdx == rr.maxCol {
+		for rr.maxCol >= 0 {
+			if rr.currentCell != nil && rr.currentCell.num == rr.maxCol {
+				break
+			}
+			cell, err := rr.readCell(rr.maxCol)
+			if err != nil {
+				return err
+			}
+			if cell != nil {
+				break
+			}
+			rr.maxCol--
+		}
+	}
+	return nil
+}
+
+// GetCell makes the cell at colIdx the current cell and returns it.
+// If the cell has been persisted it is read back, so that what is
+// written to it is merged onto its persisted state.  Otherwise a new,
+// empty cell is returned, as it is, with a Warning recorded against
+// the File, if the persisted record of the cell can't be decoded.
+// GetCell panics if the cell can't be read from Redis, as it does if
+// the previous current cell can't be written, since an empty cell
+// would be written over the record; Sheet.Cell returns the error.
 func (rr *RedisRow) GetCell(colIdx int) *Cell {
+	cell, err := rr.getCell(colIdx)
+	if err != nil {
+		panic(err.Error())
+	}
+	return cell
+}
+
+// getCell is GetCell, but returns an error if the cell can't be read
+// from Redis, or its record can't be decoded and the File's options
+// make the Warning for that an error.
+func (rr *RedisRow) getCell(colIdx int) (*Cell, error) {
 	if rr.currentCell != nil {
 		if rr.currentCell.num == colIdx {
-			return rr.currentCell
+			return rr.currentCell, nil
 		}
 	}
 	cell, err := rr.readCell(colIdx)
-	if err == nil {
+	if errors.Is(err, errCellUndecodable) {
+		err = rr.cellUndecodable(colIdx, err)
+		cell = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cell != nil {
+		cell.Row = rr.row
 		rr.setCurrentCell(cell)
-		return cell
+		return cell, nil
 	}
 	cell = newCell(rr.row, colIdx)
 	rr.PushCell(cell)
-	return cell
+	return cell, nil
+}
+
+// cellUndecodable adds a Warning that the persisted record of the cell
+// at colIdx, which err describes, couldn't be decoded, returning the
+// error that File.addWarning does.
+func (rr *RedisRow) cellUndecodable(colIdx int, err error) error {
+	sheet := rr.row.Sheet
+	if sheet == nil || sheet.File == nil {
+		return nil
+	}
+	location := sheet.Name + "!" + GetCellIDStringFromCoords(colIdx, rr.row.num)
+	err = fmt.Errorf("reading cell %s from the Redis cell store: %w", location, err)
+	return sheet.File.addWarning(Warning{
+		Code:     WarningStoredCellUnreadable,
+		Severity: SeverityDataLoss,
+		Location: location,
+		Message:  err.Error() + "; an empty cell was used in its place",
+		Err:      err,
+	})
 }
 
 func (rr *RedisRow) ForEachCell(cvf CellVisitorFunc, option ...CellVisitorOption) error {
@@ -260,7 +400,7 @@ func (rr *RedisRow) ForEachCell(cvf CellVisitorFunc, option ...CellVisitorOption
 			}
 			c = rr.GetCell(ci)
 		}
-		if !c.Modified() && flags.skipEmptyCells {
+		if c.isEmpty() && flags.skipEmptyCells {
 			return nil
 		}
 		c.Row = rr.row
@@ -268,31 +408,26 @@ func (rr *RedisRow) ForEachCell(cvf CellVisitorFunc, option ...CellVisitorOption
 		return cvf(c)
 	}
 
-	for ci := 0; ci <= rr.maxCol; ci++ {
-		var cell *Cell
-		key := rr.CellKey(ci)
-		b, err := rr.client.HGET(key, rr.row.makeRowNum())
-		if err != nil {
-			// If the file doesn't exist that's fine, it was just an empty cell.
-			if !os.IsNotExist(err) {
-				return err
-			}
-
-		} else {
-			cell, err = readCell(bytes.NewReader(b))
-			if err != nil {
+	from, to := flags.span(0, rr.maxCol+1)
+	for ci := from; ci < to; ci++ {
+		// The current cell may have changes that haven't been
+		// persisted yet, so it mustn't be replaced by what was.
+		cell := rr.currentCell
+		if cell == nil || cell.num != ci {
+			var err error
+			if cell, err = rr.readCell(ci); err != nil {
 				return err
 			}
 		}
-
-		err = fn(ci, cell)
+		err := fn(ci, cell)
 		if err != nil {
 			return err
 		}
 	}
 
 	if !flags.skipEmptyCells {
-		for ci := rr.maxCol + 1; ci < rr.row.Sheet.MaxCol; ci++ {
+		from, to = flags.span(rr.maxCol+1, rr.row.Sheet.MaxCol)
+		for ci := from; ci < to; ci++ {
 			c := rr.GetCell(ci)
 			err := cvf(c)
 			if err != nil {
@@ -430,7 +565,7 @@ func (cs *RedisCellStore) MoveRow(r *Row, index int) error {
 		}
 	}
 	oldIdx := r.makeRowNum()
-	newIdx := strconv.Itoa(index)
+	newIdx := fmt.Sprintf("%06d", index)
 	val, err := cs.client.HGET(cs.SheetRowsName(), newIdx)
 	if err != nil {
 		return err
@@ -442,23 +577,29 @@ func (cs *RedisCellStore) MoveRow(r *Row, index int) error {
 	if err != nil {
 		return err
 	}
-	cs.buf.Reset()
-	var cBuf bytes.Buffer
-	err = r.ForEachCell(func(c *Cell) error {
-		cBuf.Reset()
-		k := cs.CellKey(c.num)
-		c.Row = r
-		err = writeCell(&cBuf, c)
-		_, err = cs.client.HSET(k, newIdx, cBuf.Bytes())
+	// Every persisted cell of the row is moved, including those
+	// that are empty, which would otherwise be left behind under the
+	// old index.
+	cells, err := cs.client.ZRANGEString(cs.SheetCellsName(), 0, -1)
+	if err != nil {
+		return err
+	}
+	for _, k := range cells {
+		b, err := cs.client.HGET(k, oldIdx)
 		if err != nil {
 			return err
 		}
-		_, err = cs.client.HDEL(k, oldIdx)
-		return err
-	}, SkipEmptyCells)
-	if err != nil {
-		return err
+		if b == nil {
+			continue
+		}
+		if _, err = cs.client.HSET(k, newIdx, b); err != nil {
+			return err
+		}
+		if _, err = cs.client.HDEL(k, oldIdx); err != nil {
+			return err
+		}
 	}
+	cs.buf.Reset()
 	r.num = index
 	err = writeRow(cs.buf, r)
 	if err != nil {
@@ -479,11 +620,25 @@ func (cs *RedisCellStore) RemoveRow(key string) error {
 		cs.sheetName = k[0]
 	}
 	cells, err := cs.client.ZRANGEString(cs.SheetCellsName(), 0, -1)
+	if err != nil {
+		return err
+	}
 	for _, cell := range cells {
 		_, err = cs.client.HDEL(cell, k[1])
 		if err != nil {
 			return err
 		}
+		// Redis deletes a hash once its last field is gone, so a
+		// column that has no cells left is forgotten too.
+		n, err := cs.client.HLEN(cell)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			if _, err = cs.client.ZREMString(cs.SheetCellsName(), cell); err != nil {
+				return err
+			}
+		}
 	}
 	_, err = cs.client.HDEL(cs.SheetRowsName(), k[1])
 	if err != nil {
@@ -545,13 +700,119 @@ func readRedisRow(reader *bytes.Reader) (*Row, int, error) {
 	if err != nil {
 		return nil, maxCol, err
 	}
+	hasStyle, err := readBool(reader)
+	if err != nil {
+		return nil, maxCol, err
+	}
+	r.numFmt, err = readString(reader)
+	if err != nil {
+		return nil, maxCol, err
+	}
+	r.collapsed, err = readBool(reader)
+	if err != nil {
+		return nil, maxCol, err
+	}
 	err = readEndOfRecord(reader)
 	if err != nil {
 		return r, maxCol, err
 	}
+	if hasStyle {
+		r.style, err = readStyle(reader)
+		if err != nil {
+			return r, maxCol, err
+		}
+	}
 	return r, maxCol, nil
 }
 
+// renameSheet moves the rows and cells keyed by oldName to newName.
+// Redis can't rename a key through this client, so each hash is copied
+// to its new key and the old one deleted.
+func (cs *RedisCellStore) renameSheet(oldName, newName string) error {
+	if cs.sheetName != oldName {
+		// Nothing has been written under oldName yet; the name is
+		// picked up from the Sheet when something is.
+		return nil
+	}
+	oldRows, oldCells := cs.SheetRowsName(), cs.SheetCellsName()
+	cells, err := cs.client.ZRANGEString(oldCells, 0, -1)
+	if err != nil {
+		return err
+	}
+	cs.sheetName = newName
+	scores := make([]int64, 0, len(cells))
+	keys := make([]string, 0, len(cells))
+	for _, key := range cells {
+		// The key of a column's hash is the sheet name followed by
+		// the column index.
+		col, err := strconv.ParseInt(strings.TrimPrefix(key, oldName), 10, 64)
+		if err != nil {
+			return fmt.Errorf("unexpected cell key %q: %w", key, err)
+		}
+		newKey := cs.CellKey(int(col))
+		if err := moveRedisHash(cs.client, key, newKey); err != nil {
+			return err
+		}
+		scores = append(scores, col)
+		keys = append(keys, newKey)
+	}
+	if err := moveRedisHash(cs.client, oldRows, cs.SheetRowsName()); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		if _, err := cs.client.ZADDStringArgs(cs.SheetCellsName(), scores, keys); err != nil {
+			return err
+		}
+	}
+	_, err = cs.client.DEL(oldCells)
+	return err
+}
+
+// moveRedisHash moves the fields of the hash at from to the hash at to.
+func moveRedisHash(client *redis.Client, from, to string) error {
+	fields, err := client.HKEYSString(from)
+	if err != nil || len(fields) == 0 {
+		return err
+	}
+	values, err := client.HMGET(from, fields...)
+	if err != nil {
+		return err
+	}
+	if err := client.HMSET(to, fields, values); err != nil {
+		return err
+	}
+	_, err = client.DEL(from)
+	return err
+}
+
+// redisKeysShared reports whether a Sheet called name, given a
+// CellStore by constructor, would keep its rows under the same Redis
+// keys as s.  The keys of a RedisCellStore are named after its sheet,
+// so Sheets of different Files that have the same name share them
+// when the Files use the same Redis server.
+func redisKeysShared(s *Sheet, name string, constructor CellStoreConstructor) (bool, error) {
+	cs, ok := s.cellStore.(*RedisCellStore)
+	if !ok {
+		return false, nil
+	}
+	store, err := constructor()
+	if err != nil {
+		return false, err
+	}
+	other, ok := store.(*RedisCellStore)
+	if !ok {
+		return false, store.Close()
+	}
+	defer other.client.Close()
+	keyName := func(cs *RedisCellStore, name string) string {
+		if cs.sheetName != "" {
+			return cs.sheetName
+		}
+		return name
+	}
+	return keyName(cs, s.Name) == keyName(other, name) && cs.client.Addr == other.client.Addr, nil
+}
+
 // Close will remove the persisant storage for a given Sheet completely.
 func (cs *RedisCellStore) Close() error {
 	cells, err := cs.client.ZRANGEString(cs.SheetCellsName(), 0, -1)
@@ -573,8 +834,12 @@ func (cs *RedisCellStore) Close() error {
 	return cs.client.Close()
 }
 
-// WriteRow writes a Row to persistent storage.
+// WriteRow writes a Row to persistent storage.  A nil Row, as is
+// the current Row of a Sheet with no rows, is ignored.
 func (cs *RedisCellStore) WriteRow(r *Row) error {
+	if r == nil {
+		return nil
+	}
 	if len(cs.sheetName) == 0 && r.Sheet != nil {
 		cs.sheetName = r.Sheet.Name
 	}
@@ -593,6 +858,7 @@ func (cs *RedisCellStore) WriteRow(r *Row) error {
 	if err != nil {
 		return err
 	}
+	r.modified = false
 	_, err = cs.client.HSET(cs.SheetRowsName(), r.makeRowNum(), cs.buf.Bytes())
 	return err
 }
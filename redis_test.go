@@ -1,8 +1,14 @@
 package xlsx
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	qt "github.com/frankban/quicktest"
 )
 
@@ -164,3 +170,334 @@ func TestRedisCellStore(t *testing.T) {
 
 	})
 }
+
+// TestRedisDuplicateCellWrites checks that the cells of a row end up
+// the same in Redis whatever order they were written in, even when
+// each cell is written more than once and so is flushed and read back
+// in between.
+func TestRedisDuplicateCellWrites(t *testing.T) {
+	c := qt.New(t)
+	opt := RedisCellStoreOption{RedisAddr: "localhost"}
+
+	boldStyle := NewStyle()
+	boldStyle.Font.Bold = true
+	fillStyle := NewStyle()
+	fillStyle.Fill = *NewFill(Solid_Cell_Fill, "FFFF0000", "")
+
+	// Each of the writes sets a different part of a cell, so that a
+	// write that is lost, or undone by one that follows it, shows in
+	// what is persisted.
+	type write struct {
+		col int
+		fn  func(cell *Cell)
+	}
+	writes := []write{
+		{0, func(cell *Cell) { cell.SetStyle(boldStyle) }},
+		{0, func(cell *Cell) { cell.SetString("first") }},
+		{1, func(cell *Cell) { cell.SetInt(42) }},
+		{1, func(cell *Cell) { cell.Merge(1, 0) }},
+		{2, func(cell *Cell) { cell.SetStyle(fillStyle) }},
+		{2, func(cell *Cell) { cell.SetFormula("A1&B1") }},
+	}
+	orders := [][]int{
+		{0, 1, 2, 3, 4, 5},
+		{5, 4, 3, 2, 1, 0},
+		// A, C, A, B, C, B
+		{0, 4, 1, 2, 5, 3},
+		// A, B, C, then each again in reverse.
+		{1, 3, 5, 4, 2, 0},
+		{4, 0, 3, 5, 1, 2},
+	}
+	// visit is a write that only reads the row, which makes each
+	// cell the current one in turn.
+	visit := func(row *Row) {
+		err := row.ForEachCell(func(*Cell) error { return nil })
+		c.Assert(err, qt.IsNil)
+	}
+
+	persisted := func(c *qt.C, name string, order []int, visitAfter int) [][]byte {
+		file := NewFile(UseRedisCellStore(opt))
+		sheet, err := file.AddSheet(name)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		for i, w := range order {
+			writes[w].fn(row.GetCell(writes[w].col))
+			if i == visitAfter {
+				visit(row)
+			}
+		}
+		c.Assert(sheet.cellStore.WriteRow(row), qt.IsNil)
+		rr := row.cellStoreRow.(*RedisRow)
+		var cells [][]byte
+		for col := 0; col < 3; col++ {
+			b, err := rr.client.HGET(rr.CellKey(col), row.makeRowNum())
+			c.Assert(err, qt.IsNil)
+			cells = append(cells, b)
+		}
+		return cells
+	}
+
+	expected := persisted(c, "DuplicateWrites", orders[0], -1)
+	for col, b := range expected {
+		c.Assert(b, qt.Not(qt.HasLen), 0, qt.Commentf("column %d", col))
+	}
+	for i, order := range orders {
+		for visitAfter := -1; visitAfter < len(order); visitAfter++ {
+			name := fmt.Sprintf("DuplicateWrites%d_%d", i, visitAfter+1)
+			cells := persisted(c, name, order, visitAfter)
+			for col := range cells {
+				c.Assert(cells[col], qt.DeepEquals, expected[col], qt.Commentf("order %v, visited after %d, column %d", order, visitAfter, col))
+			}
+		}
+	}
+
+	c.Run("ReadBack", func(c *qt.C) {
+		file := NewFile(UseRedisCellStore(opt))
+		sheet, err := file.AddSheet("DuplicateWritesReadBack")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		row.GetCell(0).SetStyle(boldStyle)
+		row.GetCell(2).SetString("C")
+		// A1 was flushed when C1 became the current cell, so getting
+		// it again reads back what was persisted.
+		cell := row.GetCell(0)
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+		cell.SetString("A")
+		c.Assert(row.GetCell(2).Value, qt.Equals, "C")
+		cell = row.GetCell(0)
+		c.Assert(cell.Value, qt.Equals, "A")
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+		// A cell that was never written is empty, not an error.
+		cell = row.GetCell(1)
+		c.Assert(cell.Value, qt.Equals, "")
+		c.Assert(cell.Row, qt.Equals, row)
+	})
+
+	c.Run("Unreadable", func(c *qt.C) {
+		file := NewFile(UseRedisCellStore(opt))
+		sheet, err := file.AddSheet("DuplicateWritesUnreadable")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		row.GetCell(0).SetString("A")
+		row.GetCell(2).SetString("C")
+		// A1 was persisted when C1 became the current cell; its record
+		// is cut short, as an old or damaged one might be.
+		rr := row.cellStoreRow.(*RedisRow)
+		b, err := rr.client.HGET(rr.CellKey(0), row.makeRowNum())
+		c.Assert(err, qt.IsNil)
+		_, err = rr.client.HSET(rr.CellKey(0), row.makeRowNum(), b[:3])
+		c.Assert(err, qt.IsNil)
+
+		// The cell is replaced by an empty one, rather than failing.
+		cell := row.GetCell(0)
+		c.Assert(cell.Value, qt.Equals, "")
+		c.Assert(cell.Row, qt.Equals, row)
+		cell.SetString("again")
+		c.Assert(row.GetCell(2).Value, qt.Equals, "C")
+		c.Assert(row.GetCell(0).Value, qt.Equals, "again")
+
+		warnings := file.Warnings()
+		c.Assert(warnings, qt.HasLen, 1)
+		c.Assert(warnings[0].Code, qt.Equals, WarningStoredCellUnreadable)
+		c.Assert(warnings[0].Severity, qt.Equals, SeverityDataLoss)
+		c.Assert(warnings[0].Location, qt.Equals, "DuplicateWritesUnreadable!A1")
+		c.Assert(warnings[0].Message, qt.Matches, `reading cell DuplicateWritesUnreadable!A1 from the Redis cell store: the stored record of the cell can't be decoded: .*; an empty cell was used in its place`)
+	})
+
+	c.Run("UnreadableStrict", func(c *qt.C) {
+		for _, option := range []FileOption{StrictParsing, WarningsAsErrors(WarningStoredCellUnreadable)} {
+			file := NewFile(UseRedisCellStore(opt), option)
+			sheet, err := file.AddSheet("DuplicateWritesStrict")
+			c.Assert(err, qt.IsNil)
+			row := sheet.AddRow()
+			row.GetCell(0).SetString("A")
+			row.GetCell(2).SetString("C")
+			rr := row.cellStoreRow.(*RedisRow)
+			b, err := rr.client.HGET(rr.CellKey(0), row.makeRowNum())
+			c.Assert(err, qt.IsNil)
+			_, err = rr.client.HSET(rr.CellKey(0), row.makeRowNum(), b[:3])
+			c.Assert(err, qt.IsNil)
+
+			_, err = sheet.Cell(0, 0)
+			var warningErr *WarningError
+			c.Assert(errors.As(err, &warningErr), qt.IsTrue)
+			c.Assert(warningErr.Warning.Code, qt.Equals, WarningStoredCellUnreadable)
+			c.Assert(file.Warnings(), qt.HasLen, 0)
+			c.Assert(func() { row.GetCell(0) }, qt.PanicMatches, `reading cell DuplicateWritesStrict!A1 .*`)
+			sheet.Close()
+		}
+	})
+}
+
+// A cell that can't be read because the Redis server fails isn't
+// replaced by an empty one, which would be written over its record.
+func TestRedisCellStoreServerFailure(t *testing.T) {
+	c := qt.New(t)
+	server, err := miniredis.Run()
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(server.Close)
+	file := NewFile(UseRedisCellStore(RedisCellStoreOption{
+		RedisAddr:      server.Addr(),
+		CommandTimeout: time.Second,
+		DialTimeout:    time.Second,
+	}))
+	sheet, err := file.AddSheet("ServerFailure")
+	c.Assert(err, qt.IsNil)
+	row := sheet.AddRow()
+	row.GetCell(0).SetString("A")
+	row.GetCell(2).SetString("C")
+	record, err := row.cellStoreRow.(*RedisRow).client.HGET("ServerFailure000000", row.makeRowNum())
+	c.Assert(err, qt.IsNil)
+
+	server.SetError("LOADING the server is busy")
+	_, err = sheet.Cell(0, 0)
+	c.Assert(err, qt.ErrorMatches, `.*LOADING the server is busy.*`)
+	c.Assert(func() { row.GetCell(0) }, qt.PanicMatches, `.*LOADING the server is busy.*`)
+	c.Assert(file.Warnings(), qt.HasLen, 0)
+
+	server.SetError("")
+	after, err := row.cellStoreRow.(*RedisRow).client.HGET("ServerFailure000000", row.makeRowNum())
+	c.Assert(err, qt.IsNil)
+	c.Assert(after, qt.DeepEquals, record)
+	cell, err := sheet.Cell(0, 0)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cell.Value, qt.Equals, "A")
+}
+
+func TestRedisRemoveRowAt(t *testing.T) {
+	c := qt.New(t)
+	// An in-process server of its own, so that the keys that are left
+	// can be listed.
+	server, err := miniredis.Run()
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(server.Close)
+	file := NewFile(UseRedisCellStore(RedisCellStoreOption{
+		RedisAddr:      server.Addr(),
+		CommandTimeout: time.Second,
+		DialTimeout:    time.Second,
+	}))
+	sheet, err := file.AddSheet("Big")
+	c.Assert(err, qt.IsNil)
+
+	const rows = 10000
+	const removed = rows / 2
+	for i := 0; i < rows; i++ {
+		row := sheet.AddRow()
+		row.AddCell().SetString(strconv.Itoa(i))
+		row.AddCell().SetInt(i)
+		if i == removed {
+			// The only cell in column C is in the removed row.
+			row.AddCell().SetString("gone")
+		}
+	}
+	c.Assert(sheet.RemoveRowAt(removed), qt.IsNil)
+	c.Assert(sheet.MaxRow, qt.Equals, rows-1)
+
+	i := 0
+	err = sheet.ForEachRow(func(r *Row) error {
+		want := i
+		if i >= removed {
+			want++
+		}
+		c.Assert(r.GetCoordinate(), qt.Equals, i)
+		c.Assert(r.GetCell(0).Value, qt.Equals, strconv.Itoa(want))
+		n, err := r.GetCell(1).Int()
+		c.Assert(err, qt.IsNil)
+		c.Assert(n, qt.Equals, want)
+		i++
+		return nil
+	}, SkipEmptyRows)
+	c.Assert(err, qt.IsNil)
+	c.Assert(i, qt.Equals, rows-1)
+
+	// Nothing is left of the removed row, nor of column C.
+	keys := server.Keys()
+	sort.Strings(keys)
+	c.Assert(keys, qt.DeepEquals, []string{"Big000000", "Big000001", "Big:cells", "Big:rows"})
+	members, err := server.ZMembers("Big:cells")
+	c.Assert(err, qt.IsNil)
+	c.Assert(members, qt.DeepEquals, []string{"Big000000", "Big000001"})
+	for _, key := range []string{"Big:rows", "Big000000", "Big000001"} {
+		fields, err := server.HKeys(key)
+		c.Assert(err, qt.IsNil)
+		c.Assert(fields, qt.HasLen, rows-1, qt.Commentf("%s", key))
+		c.Assert(server.HGet(key, strconv.Itoa(rows-1)), qt.Equals, "", qt.Commentf("%s", key))
+	}
+
+	sheet.Close()
+	c.Assert(server.Keys(), qt.HasLen, 0)
+}
+
+func TestRedisForEachCellRange(t *testing.T) {
+	c := qt.New(t)
+	server, err := miniredis.Run()
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(server.Close)
+	file := NewFile(UseRedisCellStore(RedisCellStoreOption{
+		RedisAddr:      server.Addr(),
+		CommandTimeout: time.Second,
+		DialTimeout:    time.Second,
+	}))
+	sheet, err := file.AddSheet("Wide")
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(sheet.Close)
+	row := sheet.AddRow()
+	for i := 0; i < 200; i++ {
+		row.AddCell().SetInt(i)
+	}
+	// Make another row current, so that all of the cells of the
+	// first come from the server.
+	sheet.AddRow()
+	row, err = sheet.Row(0)
+	c.Assert(err, qt.IsNil)
+
+	count := func(options ...CellVisitorOption) (visited, commands int) {
+		before := server.CommandCount()
+		c.Assert(row.ForEachCell(func(*Cell) error {
+			visited++
+			return nil
+		}, options...), qt.IsNil)
+		return visited, server.CommandCount() - before
+	}
+	all, allCommands := count()
+	c.Assert(all, qt.Equals, 200)
+	some, someCommands := count(FromCol(0), ToCol(5))
+	c.Assert(some, qt.Equals, 6)
+	c.Assert(someCommands < allCommands/10, qt.IsTrue, qt.Commentf("%d commands for 6 cells, %d for 200", someCommands, allCommands))
+}
+
+func TestRedisRenameSheet(t *testing.T) {
+	c := qt.New(t)
+	server, err := miniredis.Run()
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(server.Close)
+	file := NewFile(UseRedisCellStore(RedisCellStoreOption{
+		RedisAddr:      server.Addr(),
+		CommandTimeout: time.Second,
+		DialTimeout:    time.Second,
+	}))
+	sheet, err := file.AddSheet("Old")
+	c.Assert(err, qt.IsNil)
+	for i := 0; i < 3; i++ {
+		row := sheet.AddRow()
+		row.AddCell().SetInt(i)
+		row.AddCell().SetString("x")
+	}
+	c.Assert(file.RenameSheet("Old", "New"), qt.IsNil)
+
+	// The rows and cells are all kept under the new name.
+	keys := server.Keys()
+	sort.Strings(keys)
+	c.Assert(keys, qt.DeepEquals, []string{"New000000", "New000001", "New:cells", "New:rows"})
+	members, err := server.ZMembers("New:cells")
+	c.Assert(err, qt.IsNil)
+	c.Assert(members, qt.DeepEquals, []string{"New000000", "New000001"})
+	cell, err := sheet.Cell(2, 0)
+	c.Assert(err, qt.IsNil)
+	n, err := cell.Int()
+	c.Assert(err, qt.IsNil)
+	c.Assert(n, qt.Equals, 2)
+}
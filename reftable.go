@@ -4,12 +4,18 @@ type plainTextOrRichText struct {
 	plainText  string
 	isRichText bool
 	richText   []RichTextRun
+	// phonetic is the phonetic text of the string, if it has any,
+	// whose properties are written with phoneticFontID as the
+	// index of their font.
+	phonetic       *Phonetic
+	phoneticFontID int
 }
 
 type RefTable struct {
 	indexedStrings []plainTextOrRichText
 	knownStrings   map[string]int
 	knownRichTexts map[string][]int
+	knownPhonetics map[string][]int
 	isWrite        bool
 }
 
@@ -18,6 +24,7 @@ func NewSharedStringRefTable() *RefTable {
 	rt := RefTable{}
 	rt.knownStrings = make(map[string]int)
 	rt.knownRichTexts = make(map[string][]int)
+	rt.knownPhonetics = make(map[string][]int)
 	return &rt
 }
 
@@ -29,12 +36,15 @@ func MakeSharedStringRefTable(source *xlsxSST) *RefTable {
 	reftable := NewSharedStringRefTable()
 	reftable.isWrite = false
 	for _, si := range source.SI {
+		var index int
 		if len(si.R) > 0 {
 			richText := xmlToRichText(si.R)
-			reftable.AddRichText(richText)
+			index = reftable.AddRichText(richText)
 		} else {
-			reftable.AddString(si.T.getText())
+			index = reftable.AddString(si.T.getText())
 		}
+		// Its font is looked up once the styles have been read.
+		reftable.indexedStrings[index].phonetic = makePhonetic(&si, nil)
 	}
 	return reftable
 }
@@ -52,6 +62,9 @@ func (rt *RefTable) makeXLSXSST() xlsxSST {
 		} else {
 			si.T = &xlsxT{Text: ref.plainText}
 		}
+		if ref.phonetic != nil {
+			ref.phonetic.addToXlsxSI(&si, ref.phoneticFontID)
+		}
 		sst.SI = append(sst.SI, si)
 	}
 	return sst
@@ -59,16 +72,69 @@ func (rt *RefTable) makeXLSXSST() xlsxSST {
 
 // ResolveSharedString looks up a string value or the rich text by numeric index from
 // a provided reference table (just a slice of strings in the correct order).
-// If the rich text was found, non-empty slice will be returned in richText.
+// If the rich text was found, non-empty slice will be returned in richText,
+// and plainText is the text of its runs joined together.
 // This function only exists to provide clarity of purpose via it's name.
 func (rt *RefTable) ResolveSharedString(index int) (plainText string, richText []RichTextRun) {
 	ptrt := rt.indexedStrings[index]
 	if ptrt.isRichText {
 		richText = ptrt.richText
-	} else {
-		plainText = ptrt.plainText
 	}
-	return
+	return ptrt.plainText, richText
+}
+
+// lookupSharedString is like ResolveSharedString, but reports whether
+// the index exists rather than panicking when it doesn't.  It is safe
+// to call on a nil RefTable.
+func (rt *RefTable) lookupSharedString(index int) (plainText string, richText []RichTextRun, ok bool) {
+	if rt == nil || index < 0 || index >= len(rt.indexedStrings) {
+		return "", nil, false
+	}
+	plainText, richText = rt.ResolveSharedString(index)
+	return plainText, richText, true
+}
+
+// sharedStringPhonetic returns the phonetic text of the string at
+// index, or nil if it hasn't any.  It is safe to call on a nil
+// RefTable.
+func (rt *RefTable) sharedStringPhonetic(index int) *Phonetic {
+	if rt == nil || index < 0 || index >= len(rt.indexedStrings) {
+		return nil
+	}
+	return rt.indexedStrings[index].phonetic
+}
+
+// resolvePhoneticFonts looks up the fonts of the phonetic text of the
+// strings in styles, which are read after the strings.
+func (rt *RefTable) resolvePhoneticFonts(styles *xlsxStyleSheet) {
+	for _, ref := range rt.indexedStrings {
+		if ref.phonetic != nil {
+			ref.phonetic.resolveFont(styles)
+		}
+	}
+}
+
+// addPhonetic adds a string, or a set of rich text if richText isn't
+// empty, with its phonetic text, whose font is added to styles, to the
+// reference table and returns its numeric index.  If the same string
+// with the same phonetic text already exists then it simply returns
+// the existing index.
+func (rt *RefTable) addPhonetic(plainText string, richText []RichTextRun, ph *Phonetic, styles *xlsxStyleSheet) int {
+	if rt.isWrite {
+		for _, index := range rt.knownPhonetics[plainText] {
+			ref := rt.indexedStrings[index]
+			if ref.isRichText == (len(richText) > 0) && areRichTextsEqual(ref.richText, richText) && ref.phonetic.equals(ph) {
+				return index
+			}
+		}
+	}
+	ptrt := plainTextOrRichText{plainText: plainText, isRichText: len(richText) > 0, phonetic: ph}
+	ptrt.richText = append(ptrt.richText, richText...)
+	ptrt.phoneticFontID = ph.addFont(styles)
+	rt.indexedStrings = append(rt.indexedStrings, ptrt)
+	index := len(rt.indexedStrings) - 1
+	rt.knownPhonetics[plainText] = append(rt.knownPhonetics[plainText], index)
+	return index
 }
 
 // AddString adds a string to the reference table and return it's
@@ -103,7 +169,7 @@ func (rt *RefTable) AddRichText(r []RichTextRun) int {
 			}
 		}
 	}
-	ptrt := plainTextOrRichText{isRichText: true}
+	ptrt := plainTextOrRichText{plainText: plain, isRichText: true}
 	ptrt.richText = append(ptrt.richText, r...)
 	rt.indexedStrings = append(rt.indexedStrings, ptrt)
 	index := len(rt.indexedStrings) - 1
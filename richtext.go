@@ -1,6 +1,7 @@
 package xlsx
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 )
@@ -72,6 +73,29 @@ func NewRichTextColorFromThemeColor(themeColor int) *RichTextColor {
 	return &RichTextColor{coreColor: xlsxColor{Theme: &themeColor}}
 }
 
+// richTextColorJSON is how a RichTextColor is written in JSON.
+type richTextColorJSON struct {
+	RGB     string  `json:"rgb,omitempty"`
+	Theme   *int    `json:"theme,omitempty"`
+	Tint    float64 `json:"tint,omitempty"`
+	Indexed *int    `json:"indexed,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (c RichTextColor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(richTextColorJSON(c.coreColor))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *RichTextColor) UnmarshalJSON(data []byte) error {
+	var color richTextColorJSON
+	if err := json.Unmarshal(data, &color); err != nil {
+		return err
+	}
+	c.coreColor = xlsxColor(color)
+	return nil
+}
+
 // RichTextFont is the font spec of the RichTextRun.
 type RichTextFont struct {
 	// Name is the font name. If Name is empty, Size, Family and Charset will be ignored.
@@ -198,6 +222,34 @@ func xmlToRichText(r []xlsxR) []RichTextRun {
 	return richiText
 }
 
+// writesRichText reports whether the cell is written out as its
+// RichText.  Value holds the plain text of the runs, and the cell is
+// written as that instead if Value has since been changed.
+func (c *Cell) writesRichText() bool {
+	return len(c.RichText) > 0 && (c.Value == "" || c.Value == richTextToPlainText(c.RichText))
+}
+
+// writesInlineString reports whether the text of the cell is written
+// inline, because its File was created with WriteInlineStrings.
+func (c *Cell) writesInlineString() bool {
+	f := c.file()
+	return f != nil && f.writeInlineStrings && (c.Value != "" || len(c.RichText) > 0)
+}
+
+// makeXlsxInlineString returns the is element that holds the text of
+// the cell when it is written inline, with its phonetic text, whose
+// font is added to styles.
+func (c *Cell) makeXlsxInlineString(styles *xlsxStyleSheet) *xlsxSI {
+	si := &xlsxSI{T: &xlsxT{Text: c.Value}}
+	if c.writesRichText() {
+		si = &xlsxSI{R: richTextToXml(c.RichText)}
+	}
+	if c.writesPhonetic() {
+		c.phonetic.addToXlsxSI(si, c.phonetic.addFont(styles))
+	}
+	return si
+}
+
 func richTextToPlainText(richText []RichTextRun) string {
 	var s string
 	for _, r := range richText {
@@ -1,6 +1,11 @@
 package xlsx
 
 import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
 	. "gopkg.in/check.v1"
 )
 
@@ -386,3 +391,69 @@ func (s *RichTextSuite) TestRichTextToPlainTextEmpty(c *C) {
 	plainText := richTextToPlainText(rt)
 	c.Assert(plainText, Equals, "")
 }
+
+func TestRichTextSharedStrings(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Read", func(c *qt.C) {
+		const sharedStrings = `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="1" uniqueCount="1"><si><r><rPr><b/><i val="0"/><sz val="11"/><color rgb="FFFF0000"/><rFont val="Calibri"/><family val="2"/></rPr><t>H</t></r><r><rPr><vertAlign val="subscript"/><sz val="11"/></rPr><t>2</t></r><r><t>O</t></r></si></sst>`
+		var sst xlsxSST
+		c.Assert(xml.Unmarshal([]byte(sharedStrings), &sst), qt.IsNil)
+		plainText, richText := MakeSharedStringRefTable(&sst).ResolveSharedString(0)
+		c.Assert(plainText, qt.Equals, "H2O")
+		c.Assert(richText, qt.HasLen, 3)
+		red := NewRichTextColorFromARGB(255, 255, 0, 0)
+		c.Assert(areRichTextsEqual(richText, []RichTextRun{
+			{Font: &RichTextFont{Name: "Calibri", Size: 11, Family: RichTextFontFamilySwiss, Charset: RichTextCharsetUnspecified, Color: red, Bold: true}, Text: "H"},
+			{Font: &RichTextFont{Size: 11, Family: RichTextFontFamilyUnspecified, Charset: RichTextCharsetUnspecified, VertAlign: RichTextVertAlignSubscript}, Text: "2"},
+			{Text: "O"},
+		}), qt.IsTrue)
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		runs := []RichTextRun{
+			{Text: "plain "},
+			{Font: &RichTextFont{
+				Name:      "Arial",
+				Size:      12,
+				Family:    RichTextFontFamilySwiss,
+				Charset:   RichTextCharsetUnspecified,
+				Color:     NewRichTextColorFromARGB(255, 255, 0, 0),
+				Bold:      true,
+				Italic:    true,
+				VertAlign: RichTextVertAlignSuperscript,
+			}, Text: "bold"},
+		}
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetRichText(runs)
+		c.Assert(cell.Value, qt.Equals, "plain bold")
+
+		// Saving a file that was read keeps the runs, and Value is
+		// their plain text.
+		for i := 0; i < 2; i++ {
+			var buf bytes.Buffer
+			c.Assert(f.Write(&buf), qt.IsNil)
+			f, err = OpenBinary(buf.Bytes(), option)
+			c.Assert(err, qt.IsNil)
+			cell, err = f.Sheets[0].Cell(0, 0)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.Value, qt.Equals, "plain bold")
+			c.Assert(areRichTextsEqual(cell.RichText, runs), qt.IsTrue)
+		}
+
+		// Changing Value replaces the runs with plain text.
+		cell.Value = "replaced"
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		cell, err = f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "replaced")
+		c.Assert(cell.RichText, qt.HasLen, 0)
+	})
+}
@@ -10,9 +10,13 @@ type Row struct {
 	Sheet        *Sheet       // Sheet is a reference back to the Sheet that this Row is within.
 	height       float64      // Height is the current height of the Row in PostScript Points
 	outlineLevel uint8        // OutlineLevel contains the outline level of this Row.  Used for collapsing.
+	collapsed    bool         // collapsed is set on the summary row of a collapsed group of rows
 	isCustom     bool         // isCustom is a flag that is set to true when the Row has been modified
+	modified     bool         // modified is set when the Row, or one of its cells, has been changed since it was last written to its CellStore
 	num          int          // Num hold the positional number of the Row in the Sheet
 	cellStoreRow CellStoreRow // A reference to the underlying CellStoreRow which handles persistence of the cells
+	style        *Style       // style is the default Style of cells in the Row that don't have their own
+	numFmt       string       // numFmt is the default number format of cells in the Row that don't have their own
 }
 
 // GetCoordinate returns the y coordinate of the row (the row number). This number is zero based, i.e. the Excel CellID "A1" is in Row 0, not Row 1.
@@ -25,6 +29,7 @@ func (r *Row) SetHeight(ht float64) {
 	r.cellStoreRow.Updatable()
 	r.height = ht
 	r.isCustom = true
+	r.modified = true
 }
 
 // SetHeightCM sets the height of the Row in centimetres, inherently converting it to PostScript points.
@@ -32,10 +37,16 @@ func (r *Row) SetHeightCM(ht float64) {
 	r.cellStoreRow.Updatable()
 	r.height = ht * 28.3464567 // Convert CM to postscript points
 	r.isCustom = true
+	r.modified = true
 }
 
-// GetHeight returns the height of the Row in PostScript points.
+// GetHeight returns the height of the Row in PostScript points.  A
+// Row whose height hasn't been set has the default row height of its
+// Sheet.
 func (r *Row) GetHeight() float64 {
+	if r.height == 0 && r.Sheet != nil {
+		return r.Sheet.DefaultRowHeight()
+	}
 	return r.height
 }
 
@@ -49,6 +60,7 @@ func (r *Row) SetOutlineLevel(outlineLevel uint8) {
 		}
 	}
 	r.isCustom = true
+	r.modified = true
 }
 
 // GetOutlineLevel returns the outline level of the Row.
@@ -56,10 +68,93 @@ func (r *Row) GetOutlineLevel() uint8 {
 	return r.outlineLevel
 }
 
+// SetCollapsed marks the Row as the summary row of a collapsed group
+// of rows, or of an expanded one if collapsed is false.  Excel shows
+// the button that expands the group on the summary row, but it is the
+// rows of the group being hidden that folds it; Sheet.CollapseRowGroup
+// does both.
+func (r *Row) SetCollapsed(collapsed bool) {
+	r.cellStoreRow.Updatable()
+	r.collapsed = collapsed
+	r.isCustom = true
+	r.modified = true
+}
+
+// IsCollapsed reports whether the Row is the summary row of a
+// collapsed group of rows.
+func (r *Row) IsCollapsed() bool {
+	return r.collapsed
+}
+
+// setHidden hides or shows the Row, as SetCollapsed changes it.
+func (r *Row) setHidden(hidden bool) {
+	r.cellStoreRow.Updatable()
+	r.Hidden = hidden
+	r.isCustom = true
+	r.modified = true
+}
+
+// SetRowStyle sets the default Style of the Row, which is used for
+// any cell in the Row that doesn't have a Style of its own, including
+// those that are empty.  Pass nil to remove it.
+func (r *Row) SetRowStyle(style *Style) {
+	r.cellStoreRow.Updatable()
+	r.style = style
+	r.isCustom = true
+	r.modified = true
+}
+
+// SetStyle styles the whole Row with style, as Excel does when a row
+// is formatted: style becomes the default Style of the Row, as with
+// SetRowStyle, and replaces the Style of each of its cells that has
+// one of its own.  The other cells aren't touched, they take style
+// from the Row, which keeps the number of cell formats written down.
+func (r *Row) SetStyle(style *Style) error {
+	r.SetRowStyle(style)
+	return r.ForEachCell(func(c *Cell) error {
+		if c.style != nil {
+			c.SetStyle(style)
+		}
+		return nil
+	}, SkipEmptyCells)
+}
+
+// GetRowStyle returns the default Style of the Row, or nil if it
+// doesn't have one.
+func (r *Row) GetRowStyle() *Style {
+	return r.style
+}
+
+// hasOwnAttributes reports whether the Row has anything of its own
+// to write besides its cells: a height, an outline level, a default
+// style or number format, or being hidden or collapsed.  A Row without
+// any of these and without any non-empty cells isn't written at all.
+func (r *Row) hasOwnAttributes() bool {
+	return r.height > 0 || r.Hidden || r.collapsed || r.outlineLevel > 0 || r.style != nil || r.numFmt != ""
+}
+
+// makeXfId returns the index of the cellXfs entry for the Row's
+// default style, or -1 if it doesn't have one.
+func (r *Row) makeXfId(styles *xlsxStyleSheet) (int, error) {
+	if r.style == nil && r.numFmt == "" {
+		return -1, nil
+	}
+	style := r.style
+	if style == nil {
+		style = NewStyle()
+	}
+	xNumFmt, err := styles.newNumFmt(r.numFmt)
+	if err != nil {
+		return -1, err
+	}
+	return handleStyleForXLSX(style, xNumFmt.NumFmtId, styles)
+}
+
 // AddCell adds a new Cell to the end of the Row
 func (r *Row) AddCell() *Cell {
 	r.cellStoreRow.Updatable()
 	r.isCustom = true
+	r.modified = true
 	cell := r.cellStoreRow.AddCell()
 	if cell.num > r.Sheet.MaxCol-1 {
 		r.Sheet.MaxCol = cell.num + 1
@@ -71,9 +166,45 @@ func (r *Row) AddCell() *Cell {
 func (r *Row) PushCell(c *Cell) {
 	r.cellStoreRow.Updatable()
 	r.isCustom = true
+	r.modified = true
 	r.cellStoreRow.PushCell(c)
 }
 
+// RemoveCellAt removes the Cell at a given column index from the Row
+// altogether, so that nothing at all is written for it, unlike a Cell
+// that has been cleared with Cell.Clear or Cell.ClearAll.  A Cell
+// previously returned for that column mustn't be used afterwards;
+// GetCell returns a new, empty one.  It returns an error for a Row of
+// a custom CellStore, which can't remove cells.
+func (r *Row) RemoveCellAt(colIdx int) error {
+	remover, ok := r.cellStoreRow.(cellRemover)
+	if !ok {
+		return fmt.Errorf("Row.RemoveCellAt(%d): the CellStore of the Row can't remove cells", colIdx)
+	}
+	r.cellStoreRow.Updatable()
+	if err := remover.removeCell(colIdx); err != nil {
+		return fmt.Errorf("Row.RemoveCellAt(%d): %w", colIdx, err)
+	}
+	r.modified = true
+	return nil
+}
+
+// Modified reports whether the Row, or any of its cells, has been
+// modified since it was last written to its CellStore, or since it
+// was read if it hasn't been written since.  Its cells are visited to
+// find out, which makes each, in turn, the current cell of the Row.
+func (r *Row) Modified() bool {
+	if r.modified {
+		return true
+	}
+	modified := false
+	_ = r.ForEachCell(func(c *Cell) error {
+		modified = modified || c.Modified()
+		return nil
+	}, SkipEmptyCells)
+	return modified
+}
+
 func (r *Row) makeCellKey(colIdx int) string {
 	return fmt.Sprintf("%s:%06d:%06d", r.Sheet.Name, r.num, colIdx)
 }
@@ -99,6 +230,23 @@ func (r *Row) GetCell(colIdx int) *Cell {
 type cellVisitorFlags struct {
 	// skipEmptyCells indicates if we should skip nil cells.
 	skipEmptyCells bool
+	// fromCol and toCol are the first and last columns to visit,
+	// toCol only if hasToCol is set.
+	fromCol, toCol int
+	hasToCol       bool
+}
+
+// span narrows the columns from lo up to, but not including, hi down
+// to those ForEachCell should visit.  The result is empty if lo isn't
+// less than hi.
+func (f *cellVisitorFlags) span(lo, hi int) (int, int) {
+	if f.fromCol > lo {
+		lo = f.fromCol
+	}
+	if f.hasToCol && f.toCol+1 < hi {
+		hi = f.toCol + 1
+	}
+	return lo, hi
 }
 
 // CellVisitorOption describes a function that can set values in a
@@ -111,6 +259,26 @@ func SkipEmptyCells(flags *cellVisitorFlags) {
 	flags.skipEmptyCells = true
 }
 
+// FromCol can be passed as an option to Row.ForEachCell to make it
+// start at the cell at the zero based column index colIdx, rather than
+// at the first one.
+func FromCol(colIdx int) CellVisitorOption {
+	return func(flags *cellVisitorFlags) {
+		flags.fromCol = colIdx
+	}
+}
+
+// ToCol can be passed as an option to Row.ForEachCell to make it stop
+// after the cell at the zero based column index colIdx, rather than
+// at the last one.  Cells outside of the range aren't read from the
+// CellStore at all.
+func ToCol(colIdx int) CellVisitorOption {
+	return func(flags *cellVisitorFlags) {
+		flags.toCol = colIdx
+		flags.hasToCol = true
+	}
+}
+
 // ForEachCell will call the provided CellVisitorFunc for each
 // currently defined cell in the Row.  Optionally you may pass one or
 // more CellVisitorOption to affect how ForEachCell operates.  For
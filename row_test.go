@@ -1,6 +1,7 @@
 package xlsx
 
 import (
+	"bytes"
 	"testing"
 
 	qt "github.com/frankban/quicktest"
@@ -34,6 +35,105 @@ func TestRow(t *testing.T) {
 		c.Assert(cell.Value, qt.Equals, cell2.Value)
 	})
 
+	csRunO(c, "RemoveCellAt", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("RemoveCellAt")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		for _, v := range []string{"a", "b", "c", "d"} {
+			row.AddCell().SetString(v)
+		}
+		c.Assert(row.RemoveCellAt(1), qt.IsNil)
+		c.Assert(row.cellStoreRow.MaxCol(), qt.Equals, 3)
+		c.Assert(row.RemoveCellAt(3), qt.IsNil)
+		c.Assert(row.cellStoreRow.MaxCol(), qt.Equals, 2)
+		// Removing a cell that isn't there does nothing.
+		c.Assert(row.RemoveCellAt(7), qt.IsNil)
+		c.Assert(row.cellStoreRow.MaxCol(), qt.Equals, 2)
+
+		var values []string
+		err = row.ForEachCell(func(cell *Cell) error {
+			values = append(values, cell.Ref()+"="+cell.Value)
+			return nil
+		}, SkipEmptyCells)
+		c.Assert(err, qt.IsNil)
+		c.Assert(values, qt.DeepEquals, []string{"A1=a", "C1=c"})
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var sheetXML string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				sheetXML = string(body)
+			}
+			return name, body
+		})
+		c.Assert(sheetXML, qt.Contains, `<c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>`)
+
+		row, err = sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.RemoveCellAt(0), qt.IsNil)
+		c.Assert(row.RemoveCellAt(2), qt.IsNil)
+		c.Assert(row.cellStoreRow.MaxCol(), qt.Equals, -1)
+		c.Assert(row.GetCell(2).Value, qt.Equals, "")
+	})
+
+	csRunO(c, "Modified", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Modified")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		c.Assert(row.Modified(), qt.IsFalse)
+		row.AddCell().SetString("a")
+		c.Assert(row.Modified(), qt.IsTrue)
+
+		row = sheet.AddRow()
+		row.SetHeight(12)
+		c.Assert(row.Modified(), qt.IsTrue)
+	})
+
+	// Rows read back from the DiskV and Redis cell stores are clean, so
+	// that with SkipUnmodifiedRows only those that are changed are
+	// written back.
+	for name, option := range map[string]FileOption{
+		"DiskVCellStore": UseDiskVCellStore,
+		"RedisCellStore": UseRedisCellStore(RedisCellStoreOption{RedisAddr: "localhost"}),
+	} {
+		c.Run("SkipUnmodifiedRows/"+name, func(c *qt.C) {
+			f := NewFile(option, SkipUnmodifiedRows())
+			sheet, err := f.AddSheet("SkipUnmodifiedRows")
+			c.Assert(err, qt.IsNil)
+			c.Cleanup(sheet.Close)
+			sheet.AddRow().AddCell().SetString("a")
+			sheet.AddRow().AddCell().SetString("b")
+
+			row, err := sheet.Row(0)
+			c.Assert(err, qt.IsNil)
+			c.Assert(row.Modified(), qt.IsFalse)
+			// Changed without a setter, the row isn't modified, and
+			// so isn't written back.
+			row.height = 42
+			_, err = sheet.Row(1)
+			c.Assert(err, qt.IsNil)
+			row, err = sheet.Row(0)
+			c.Assert(err, qt.IsNil)
+			c.Assert(row.height, qt.Equals, 0.0)
+
+			row.SetHeight(42)
+			row.GetCell(0).SetString("c")
+			c.Assert(row.Modified(), qt.IsTrue)
+			_, err = sheet.Row(1)
+			c.Assert(err, qt.IsNil)
+			row, err = sheet.Row(0)
+			c.Assert(err, qt.IsNil)
+			c.Assert(row.GetHeight(), qt.Equals, 42.0)
+			c.Assert(row.GetCell(0).Value, qt.Equals, "c")
+			c.Assert(row.Modified(), qt.IsFalse)
+		})
+	}
+
 	csRunO(c, "TestForEachCell", func(c *qt.C, option FileOption) {
 		var f *File
 		f, err := OpenFile("./testdocs/empty_cells.xlsx", option)
@@ -88,3 +188,222 @@ func TestRow(t *testing.T) {
 
 	})
 }
+
+func TestRowStyle(t *testing.T) {
+	c := qt.New(t)
+
+	bold := func() *Style {
+		style := NewStyle()
+		style.Font.Bold = true
+		style.ApplyFont = true
+		return style
+	}
+
+	// makeFile returns a file whose second row has a bold default
+	// style, with one cell using it and another with its own style,
+	// and whose fourth row has the same default style and no cells.
+	makeFile := func(c *qt.C, option FileOption) *File {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("RowStyles")
+		c.Assert(err, qt.IsNil)
+		// The sheet's name is its key in the Redis cell store.
+		c.Cleanup(sheet.Close)
+		row, err := sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		row.AddCell().SetString("heading")
+		row, err = sheet.Row(1)
+		c.Assert(err, qt.IsNil)
+		row.SetRowStyle(bold())
+		c.Assert(row.GetRowStyle().Font.Bold, qt.IsTrue)
+		cell := row.AddCell()
+		cell.SetString("inherits")
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+		cell = row.AddCell()
+		cell.SetString("own style")
+		italic := NewStyle()
+		italic.Font.Italic = true
+		italic.ApplyFont = true
+		cell.SetStyle(italic)
+		_, err = sheet.Row(2)
+		c.Assert(err, qt.IsNil)
+		row, err = sheet.Row(3)
+		c.Assert(err, qt.IsNil)
+		row.SetRowStyle(bold())
+		// Move off the last row, so that it's stored.
+		_, err = sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		return f
+	}
+
+	csRunO(c, "Write", func(c *qt.C, option FileOption) {
+		f := makeFile(c, option)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var sheetXML string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				sheetXML = string(body)
+			}
+			return name, body
+		})
+		c.Assert(sheetXML, qt.Contains, `<row r="2" spans="1:2" s="1" customFormat="true"><c r="A2" s="1" t="s"><v>1</v>`)
+		c.Assert(sheetXML, qt.Contains, `<c r="B2" s="2" t="s"><v>2</v>`)
+		c.Assert(sheetXML, qt.Contains, `<row r="4" s="1" customFormat="true"/>`)
+		c.Assert(sheetXML, qt.Not(qt.Contains), `<row r="3"`)
+
+		f, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet := f.Sheet["RowStyles"]
+		c.Cleanup(sheet.Close)
+		for _, i := range []int{1, 3} {
+			row, err := sheet.Row(i)
+			c.Assert(err, qt.IsNil)
+			c.Assert(row.GetRowStyle(), qt.Not(qt.IsNil))
+			c.Assert(row.GetRowStyle().Font.Bold, qt.IsTrue)
+		}
+		row, err := sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.GetRowStyle(), qt.IsNil)
+		// A cell added to the empty row takes its style.
+		cell, err := sheet.Cell(3, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+	})
+
+	csRunO(c, "MakeStreamParts", func(c *qt.C, option FileOption) {
+		f := makeFile(c, option)
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		sheetXML := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(sheetXML, qt.Contains, `<row r="2" spans="1:2" s="1" customFormat="true"`)
+		c.Assert(sheetXML, qt.Contains, `<c r="A2" s="1" t="s"><v>1</v>`)
+		c.Assert(sheetXML, qt.Contains, `<row r="4" s="1" customFormat="true"`)
+	})
+
+	csRunO(c, "FormattedValue", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("RowStyles")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row, err := sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		row.numFmt = "0.00"
+		cell := row.AddCell()
+		cell.Value = "2.5"
+		cell.cellType = CellTypeNumeric
+		value, err := cell.FormattedValue()
+		c.Assert(err, qt.IsNil)
+		c.Assert(value, qt.Equals, "2.50")
+
+		// The Row's default takes precedence over the Col's.
+		col := NewColForRange(1, 3)
+		col.SetStyle(bold())
+		sheet.SetColParameters(col)
+		cell = row.AddCell()
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsFalse)
+		row.numFmt = ""
+		cell = row.AddCell()
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+	})
+
+	csRunO(c, "SetStyle", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("RowStyles")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		italic := NewStyle()
+		italic.Font.Italic = true
+		italic.ApplyFont = true
+		for i := 0; i < 3; i++ {
+			row := sheet.AddRow()
+			row.AddCell().SetString("plain")
+			cell := row.AddCell()
+			cell.SetString("own style")
+			cell.SetStyle(italic)
+		}
+
+		row, err := sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.SetStyle(bold()), qt.IsNil)
+		// Only the cell with a style of its own is restyled, the
+		// other takes the style of the row.
+		c.Assert(row.GetCell(0).style, qt.IsNil)
+		c.Assert(row.GetCell(0).GetStyle().Font.Bold, qt.IsTrue)
+		c.Assert(row.GetCell(1).style.Font.Bold, qt.IsTrue)
+		c.Assert(row.GetCell(1).style.Font.Italic, qt.IsFalse)
+
+		c.Assert(sheet.SetColStyle(1, bold()), qt.IsNil)
+		c.Assert(sheet.SetColStyle(-1, bold()), qt.ErrorMatches, `SetColStyle: index out of range: -1`)
+		for i := 1; i < 3; i++ {
+			cell, err := sheet.Cell(i, 1)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.style.Font.Bold, qt.IsTrue)
+			cell, err = sheet.Cell(i, 0)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.style, qt.IsNil)
+		}
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		sheetXML := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(sheetXML, qt.Contains, `<col max="2" min="2" style="1"`)
+		c.Assert(sheetXML, qt.Contains, `<row r="1" spans="1:2" s="1" customFormat="true"`)
+		c.Assert(sheetXML, qt.Contains, `<c r="B3" s="1" t="s">`)
+		c.Assert(sheetXML, qt.Contains, `<c r="A3" t="s">`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet = f.Sheet["RowStyles"]
+		c.Cleanup(sheet.Close)
+		c.Assert(sheet.Col(1).GetStyle().Font.Bold, qt.IsTrue)
+		// A cell without a style of its own reads as that of its
+		// column.
+		cell, err := sheet.Cell(3, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+	})
+}
+
+func TestForEachCellRange(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "Range", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("CellRange")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		for i := 0; i < 6; i++ {
+			cell := row.AddCell()
+			if i != 3 {
+				cell.SetInt(i)
+			}
+		}
+		// A longer row makes the sheet wider than the first.
+		other := sheet.AddRow()
+		for i := 0; i < 10; i++ {
+			other.AddCell()
+		}
+		row, err = sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+
+		visit := func(options ...CellVisitorOption) []int {
+			var got []int
+			c.Assert(row.ForEachCell(func(cell *Cell) error {
+				got = append(got, cell.num)
+				return nil
+			}, options...), qt.IsNil)
+			return got
+		}
+		c.Assert(visit(FromCol(2), ToCol(4)), qt.DeepEquals, []int{2, 3, 4})
+		c.Assert(visit(FromCol(2), ToCol(4), SkipEmptyCells), qt.DeepEquals, []int{2, 4})
+		c.Assert(visit(FromCol(4), SkipEmptyCells), qt.DeepEquals, []int{4, 5})
+		c.Assert(visit(ToCol(1)), qt.DeepEquals, []int{0, 1})
+		// Bounds outside of the sheet are clamped to it.
+		c.Assert(visit(FromCol(-3), ToCol(1)), qt.DeepEquals, []int{0, 1})
+		c.Assert(visit(FromCol(7), ToCol(100)), qt.DeepEquals, []int{7, 8, 9})
+		c.Assert(visit(FromCol(50)), qt.HasLen, 0)
+		c.Assert(visit(FromCol(4), ToCol(2)), qt.HasLen, 0)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/shabbyrobe/xmlwriter"
 )
@@ -19,7 +20,7 @@ type Sheet struct {
 	Cols            *ColStore
 	MaxRow          int
 	MaxCol          int
-	Hidden          bool
+	Hidden          bool // Hidden hides the Sheet, as SetVisibility does with SheetHidden.
 	Selected        bool
 	SheetViews      []SheetView
 	SheetFormat     SheetFormat
@@ -28,6 +29,66 @@ type Sheet struct {
 	DataValidations []*xlsxDataValidation
 	cellStore       CellStore
 	currentRow      *Row
+	protection      *xlsxSheetProtection
+	// customSheetViews and namedSheetViews hold the custom views and
+	// named sheet views read from the file, which are written back
+	// out unless structureChanged records that rows were inserted or
+	// removed since.
+	customSheetViews *xlsxCustomSheetViews
+	namedSheetViews  [][]byte
+	structureChanged bool
+	// comments holds the comments of the cells, by their coordinates.
+	comments map[coord]Comment
+	// images holds the images placed in the sheet, in the order they
+	// are drawn.
+	images []*Image
+	// charts holds the charts added to the sheet, which are drawn
+	// after its images.
+	charts []*ChartSpec
+	// drawing holds the drawing read with the sheet, if it had more
+	// in it than the images that are read, such as charts.  keptRels
+	// holds the relationships of the worksheet to parts that aren't
+	// read, such as pivot tables, and keptParts the parts that they
+	// and the drawing lead to, which are all written back out as they
+	// were read.
+	drawing   *keptDrawing
+	keptRels  []xlsxWorksheetRelation
+	keptParts []*keptPart
+	// vml holds the VML drawing read with the sheet, if it had more in
+	// it than the boxes of comments, such as form controls.
+	vml *keptVML
+	// tables holds the tables of the sheet, in the order they were
+	// added or read.
+	tables []*table
+	// extensions holds the ext elements read with the sheet, which
+	// are written back out unless structureChanged is set, and
+	// sparklineGroups the groups of sparklines added to it.
+	extensions      []string
+	sparklineGroups []*sparklineGroup
+	// outlinePr holds where the summary rows and columns of outlines
+	// are, if that has been set or read.
+	outlinePr *xlsxOutlinePr
+	// sharedFormulas holds the ranges given to SetSharedFormula.
+	sharedFormulas []*sharedFormulaRange
+	// headers holds the header row read by HeaderIndex.
+	headers *headerIndex
+	// veryHidden is set, along with Hidden, for a Sheet that can't be
+	// shown from Excel's user interface.
+	veryHidden bool
+	// pageSetup holds the settings the sheet is printed with, if they
+	// have been set or read.
+	pageSetup *PageSetup
+	// pageMargins and printOptions hold the pageMargins and
+	// printOptions elements of the sheet, if they have been set or
+	// read.
+	pageMargins  *xlsxPageMargins
+	printOptions *xlsxPrintOptions
+	// headerFooter holds the headers and footers of the printed
+	// sheet, if they have been set or read.
+	headerFooter *HeaderFooter
+	// sheetViews holds the sheetView elements read with the sheet or
+	// added by its view options, if any.
+	sheetViews []xlsxSheetView
 }
 
 // NewSheet constructs a Sheet with the default CellStore and returns
@@ -61,11 +122,330 @@ func (s *Sheet) StoreRowsCount() int {
 	return s.cellStore.RowsCount()
 }
 
+// copyTo copies the rows, cells, columns and settings of the Sheet into
+// dst, which must be a new, empty Sheet.  Styles are cloned, so that the
+// copy doesn't share them with the Sheet; a Style's colours are always
+// ARGB values, so they don't depend on the theme of either File.
+func (s *Sheet) copyTo(dst *Sheet) error {
+	s.mustBeOpen()
+	dst.mustBeOpen()
+
+	sameFile := s.File != nil && s.File == dst.File
+	copyStyle := func(style *Style) *Style {
+		style = style.Clone()
+		if style != nil && !sameFile {
+			// The named styles of the source File don't exist in dst.
+			style.NamedStyleIndex = nil
+		}
+		return style
+	}
+
+	s.Cols.ForEach(func(_ int, col *Col) {
+		c := *col
+		c.style = copyStyle(col.style)
+		dst.Cols.Add(&c)
+	})
+
+	err := s.ForEachRow(func(r *Row) error {
+		row := dst.AddRow()
+		row.Hidden = r.Hidden
+		row.height = r.height
+		row.outlineLevel = r.outlineLevel
+		row.collapsed = r.collapsed
+		row.isCustom = r.isCustom
+		row.style = copyStyle(r.style)
+		row.numFmt = r.numFmt
+		return r.ForEachCell(func(c *Cell) error {
+			cell := row.GetCell(c.num)
+			cell.Value = c.Value
+			cell.RichText = append([]RichTextRun(nil), c.RichText...)
+			cell.phonetic = c.phonetic
+			cell.formula = c.formula
+			cell.style = copyStyle(c.style)
+			cell.NumFmt = c.NumFmt
+			cell.numFmtId = c.numFmtId
+			cell.date1904 = c.date1904
+			cell.Hidden = c.Hidden
+			cell.HMerge = c.HMerge
+			cell.VMerge = c.VMerge
+			cell.cellType = c.cellType
+			cell.Hyperlink = c.Hyperlink
+			if c.DataValidation != nil {
+				dv := *c.DataValidation
+				cell.DataValidation = &dv
+			}
+			cell.modified = true
+			return nil
+		}, SkipEmptyCells)
+	})
+	if err != nil {
+		return err
+	}
+	if dst.currentRow != nil {
+		err = dst.cellStore.WriteRow(dst.currentRow)
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, comment := range s.comments {
+		if dst.comments == nil {
+			dst.comments = make(map[coord]Comment)
+		}
+		dst.comments[key] = comment
+	}
+	for _, img := range s.images {
+		img := *img
+		dst.images = append(dst.images, &img)
+	}
+	// The charts of the copy show its own cells where those of the
+	// Sheet show the Sheet's.
+	retarget := sheetRefRenamer{oldName: s.Name, newName: dst.Name}
+	for _, chart := range s.charts {
+		chart := *chart
+		chart.Series = append([]ChartSeries(nil), chart.Series...)
+		for i := range chart.Series {
+			ser := &chart.Series[i]
+			for _, ref := range []*string{&ser.NameRef, &ser.CategoriesRef, &ser.ValuesRef} {
+				if *ref, err = retarget.formula(*ref); err != nil {
+					return err
+				}
+			}
+		}
+		dst.charts = append(dst.charts, &chart)
+	}
+	if err = s.copySparklines(dst); err != nil {
+		return err
+	}
+
+	dst.MaxCol = s.MaxCol
+	dst.Hidden = s.Hidden
+	dst.veryHidden = s.veryHidden
+	dst.SheetFormat = s.SheetFormat
+	for _, view := range s.SheetViews {
+		if view.Pane != nil {
+			pane := *view.Pane
+			view.Pane = &pane
+		}
+		dst.SheetViews = append(dst.SheetViews, view)
+	}
+	if s.AutoFilter != nil {
+		autoFilter := *s.AutoFilter
+		dst.AutoFilter = &autoFilter
+	}
+	dst.Relations = append([]Relation(nil), s.Relations...)
+	if s.outlinePr != nil {
+		outlinePr := *s.outlinePr
+		dst.outlinePr = &outlinePr
+	}
+	for _, dv := range s.DataValidations {
+		dv := *dv
+		dst.DataValidations = append(dst.DataValidations, &dv)
+	}
+	if s.protection != nil {
+		protection := *s.protection
+		dst.protection = &protection
+	}
+	if s.pageSetup != nil {
+		pageSetup := *s.pageSetup
+		dst.pageSetup = &pageSetup
+	}
+	if s.pageMargins != nil {
+		pageMargins := *s.pageMargins
+		dst.pageMargins = &pageMargins
+	}
+	if s.printOptions != nil {
+		printOptions := *s.printOptions
+		dst.printOptions = &printOptions
+	}
+	if s.headerFooter != nil {
+		headerFooter := *s.headerFooter
+		dst.headerFooter = &headerFooter
+	}
+	dst.sheetViews = cloneSheetViews(s.sheetViews)
+	return nil
+}
+
+// Clone adds a copy of the Sheet, called name, to the end of dst,
+// which may be the Sheet's own File or another.  The copy has the
+// Sheet's rows, cells, columns, merged cells, data validations,
+// hyperlinks, comments, images, charts, sparklines and settings,
+// written to dst's own cell store, so that changing either Sheet leaves
+// the other alone.  The copy's charts and sparklines show its own cells
+// where the Sheet's show the Sheet's.  Styles are copied too, and get
+// their own entries in dst's style sheet when it is written.
+//
+// A Redis cell store keeps a Sheet's cells under its name, so a copy
+// in another File that uses the same Redis server needs a name that no
+// open Sheet there has.
+func (s *Sheet) Clone(dst *File, name string) (*Sheet, error) {
+	sheet, err := dst.AddSheet(name)
+	if err != nil {
+		return nil, fmt.Errorf("Clone: %w", err)
+	}
+	err = s.copyTo(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("Clone: %w", err)
+	}
+	return sheet, nil
+}
+
+// sheetRefRenamer changes references to the sheet oldName to newName.
+// With check set it changes nothing, and only returns the errors that
+// changing them would, so that RenameSheet can fail before it has
+// changed anything.
+type sheetRefRenamer struct {
+	oldName, newName string
+	check            bool
+}
+
+// formula returns formula with its references to the sheet oldName
+// changed to newName, or an error if the formula can't be read.
+func (r sheetRefRenamer) formula(formula string) (string, error) {
+	renamed, err := renameFormulaSheet(formula, r.oldName, r.newName)
+	if err != nil || r.check {
+		return formula, err
+	}
+	return renamed, nil
+}
+
+// chartRef returns ref, a reference of a ChartSeries, with a reference
+// to the sheet oldName, or to a name scoped to it, changed to newName.
+func (r sheetRefRenamer) chartRef(ref string) (string, error) {
+	sheetName, n := formulaRefSheet(ref)
+	if n > 0 && strings.EqualFold(sheetName, r.oldName) {
+		if tokens, err := tokenizeFormula(ref[n:]); err == nil && len(tokens) == 1 && tokens[0].kind == formulaTokenName {
+			if r.check {
+				return ref, nil
+			}
+			return quoteSheetName(r.newName) + "!" + ref[n:], nil
+		}
+	}
+	return r.formula(ref)
+}
+
+// renameSheetRefs changes the references to the sheet r.oldName in the
+// formulas, internal hyperlinks, data validations, sparklines and
+// charts of the Sheet to refer to r.newName, for File.RenameSheet.  It
+// returns an error for the first of them that can't be read.
+func (s *Sheet) renameSheetRefs(r sheetRefRenamer) error {
+	for _, dv := range s.DataValidations {
+		formula1, err := r.formula(dv.Formula1)
+		if err != nil {
+			return err
+		}
+		formula2, err := r.formula(dv.Formula2)
+		if err != nil {
+			return err
+		}
+		dv.Formula1, dv.Formula2 = formula1, formula2
+	}
+	if err := s.renameSparklineRefs(r); err != nil {
+		return err
+	}
+	for _, chart := range s.charts {
+		for i := range chart.Series {
+			ser := &chart.Series[i]
+			for _, ref := range []*string{&ser.NameRef, &ser.CategoriesRef, &ser.ValuesRef} {
+				renamed, err := r.chartRef(*ref)
+				if err != nil {
+					return err
+				}
+				*ref = renamed
+			}
+		}
+	}
+	return s.ForEachRow(func(row *Row) error {
+		return row.ForEachCell(func(c *Cell) error {
+			formula, err := r.formula(c.formula)
+			if err != nil {
+				return fmt.Errorf("cell %s: %w", c.Ref(), err)
+			}
+			location, err := r.formula(c.Hyperlink.Location)
+			if err != nil {
+				return fmt.Errorf("hyperlink of cell %s: %w", c.Ref(), err)
+			}
+			var formula1, formula2 string
+			if c.DataValidation != nil {
+				if formula1, err = r.formula(c.DataValidation.Formula1); err == nil {
+					formula2, err = r.formula(c.DataValidation.Formula2)
+				}
+				if err != nil {
+					return fmt.Errorf("data validation of cell %s: %w", c.Ref(), err)
+				}
+			}
+			if formula == c.formula && location == c.Hyperlink.Location &&
+				(c.DataValidation == nil || formula1 == c.DataValidation.Formula1 && formula2 == c.DataValidation.Formula2) {
+				return nil
+			}
+			c.updatable()
+			c.formula = formula
+			if c.Hyperlink.Link == c.Hyperlink.Location {
+				// SetHyperlink keeps a link within the workbook in both.
+				c.Hyperlink.Link = location
+			}
+			c.Hyperlink.Location = location
+			if c.DataValidation != nil {
+				dv := *c.DataValidation
+				dv.Formula1, dv.Formula2 = formula1, formula2
+				c.DataValidation = &dv
+			}
+			c.modified = true
+			return nil
+		}, SkipEmptyCells)
+	}, SkipEmptyRows)
+}
+
+// SheetVisibility is whether a Sheet is shown in the tabs of a
+// workbook.
+type SheetVisibility int
+
+const (
+	// SheetVisible is the visibility of a Sheet that is shown.
+	SheetVisible SheetVisibility = iota
+	// SheetHidden is the visibility of a Sheet that is hidden, but
+	// that can be unhidden from Excel's user interface.
+	SheetHidden
+	// SheetVeryHidden is the visibility of a Sheet that is hidden,
+	// and that can only be unhidden programmatically.
+	SheetVeryHidden
+)
+
+// SetVisibility shows or hides the Sheet.  A File can't be saved
+// unless at least one of its sheets is visible.
+func (s *Sheet) SetVisibility(visibility SheetVisibility) error {
+	switch visibility {
+	case SheetVisible, SheetHidden, SheetVeryHidden:
+	default:
+		return fmt.Errorf("SetVisibility: invalid visibility %d", visibility)
+	}
+	s.Hidden = visibility != SheetVisible
+	s.veryHidden = visibility == SheetVeryHidden
+	return nil
+}
+
+// Visibility returns whether the Sheet is shown, hidden or very
+// hidden.
+func (s *Sheet) Visibility() SheetVisibility {
+	switch {
+	case !s.Hidden:
+		return SheetVisible
+	case s.veryHidden:
+		return SheetVeryHidden
+	}
+	return SheetHidden
+}
+
+// getState returns the state attribute of the sheet element of the
+// Sheet in the workbook.
 func (s *Sheet) getState() string {
-	if s.Hidden {
-		return "hidden"
+	switch s.Visibility() {
+	case SheetHidden:
+		return sheetStateHidden
+	case SheetVeryHidden:
+		return sheetStateVeryHidden
 	}
-	return "visible"
+	return sheetStateVisible
 }
 
 type SheetView struct {
@@ -83,6 +463,7 @@ type Pane struct {
 type SheetFormat struct {
 	DefaultColWidth  float64
 	DefaultRowHeight float64
+	CustomHeight     bool // CustomHeight is set when DefaultRowHeight isn't that of the default font
 	OutlineLevelCol  uint8
 	OutlineLevelRow  uint8
 }
@@ -124,7 +505,7 @@ func (s *Sheet) setCurrentRow(r *Row) {
 	if r != nil && r == s.currentRow {
 		return
 	}
-	if s.currentRow != nil && s.currentRow.isCustom {
+	if s.currentRow != nil && (s.currentRow.isCustom || s.currentRow.cellStoreRow.CellCount() > 0) && !s.skipsRow(s.currentRow) {
 		err := s.cellStore.WriteRow(s.currentRow)
 		if err != nil {
 			panic(err)
@@ -133,9 +514,22 @@ func (s *Sheet) setCurrentRow(r *Row) {
 	s.currentRow = r
 }
 
+// skipsRow reports whether r isn't written back to the CellStore of
+// the Sheet when it stops being the current row, because its File was
+// opened with SkipUnmodifiedRows and it hasn't been modified.
+func (s *Sheet) skipsRow(r *Row) bool {
+	return s.File != nil && s.File.skipUnmodifiedRows && !r.Modified()
+}
+
 // rowVisitorFlags contains flags that can be set by a RowVisitorOption to affect the behaviour of sheet.ForEachRow
 type rowVisitorFlags struct {
-	skipEmptyRows bool
+	skipEmptyRows  bool
+	skipHiddenRows bool
+	reverse        bool
+	// start and end bound the Rows to visit, end only if hasEnd is
+	// set, as for RowWindow.
+	start, end int
+	hasEnd     bool
 }
 
 // RowVisitorOption defines the call signature of functions that can be passed as options to the Sheet.ForEachRow function to affect its behaviour.
@@ -147,6 +541,52 @@ func SkipEmptyRows(flags *rowVisitorFlags) {
 	flags.skipEmptyRows = true
 }
 
+// SkipHiddenRows can be passed to Sheet.ForEachRow or
+// Sheet.RowIterator to skip over hidden Rows.
+func SkipHiddenRows(flags *rowVisitorFlags) {
+	flags.skipHiddenRows = true
+}
+
+// Reverse can be passed to Sheet.ForEachRow or Sheet.RowIterator to
+// visit the Rows from the last one to the first.
+func Reverse(flags *rowVisitorFlags) {
+	flags.reverse = true
+}
+
+// RowWindow can be passed to Sheet.ForEachRow or Sheet.RowIterator to
+// only visit the Rows from the zero based index start up to, but not
+// including, end.  An end of 0 or less means up to the last Row of the
+// Sheet.
+func RowWindow(start, end int) RowVisitorOption {
+	return func(flags *rowVisitorFlags) {
+		flags.start = start
+		flags.end = end
+		flags.hasEnd = end > 0
+	}
+}
+
+// FromRow can be passed to Sheet.ForEachRow or Sheet.RowIterator to
+// start at the Row at the zero based index rowIdx, rather than at the
+// first one.
+func FromRow(rowIdx int) RowVisitorOption {
+	return func(flags *rowVisitorFlags) {
+		flags.start = rowIdx
+	}
+}
+
+// ToRow can be passed to Sheet.ForEachRow or Sheet.RowIterator to stop
+// after the Row at the zero based index rowIdx, rather than at the
+// last one.
+func ToRow(rowIdx int) RowVisitorOption {
+	return func(flags *rowVisitorFlags) {
+		if rowIdx < -1 {
+			rowIdx = -1
+		}
+		flags.end = rowIdx + 1
+		flags.hasEnd = true
+	}
+}
+
 // A RowVisitor function should be provided by the user when calling
 // Sheet.ForEachRow, it will be called once for every Row visited.
 type RowVisitor func(r *Row) error
@@ -158,41 +598,179 @@ func (s *Sheet) mustBeOpen() {
 }
 
 func (s *Sheet) ForEachRow(rv RowVisitor, options ...RowVisitorOption) error {
+	it := s.RowIterator(options...)
+	for {
+		r, err := it.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = rv(r)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RowIterator visits the Rows of a Sheet one at a time, in order, or
+// in reverse order with the Reverse option, as they are asked for,
+// rather than all of them in one go as Sheet.ForEachRow does.  Only
+// the Row it returned last is held, as the current row of the Sheet;
+// it is written back to the CellStore when the RowIterator moves on,
+// so that stopping early costs nothing.
+type RowIterator struct {
+	sheet   *Sheet
+	flags   rowVisitorFlags
+	idx     int
+	started bool
+	done    bool
+}
+
+// RowIterator returns a RowIterator over the Rows of the Sheet.  It
+// takes the same options as ForEachRow.  The Sheet shouldn't have
+// Rows inserted or removed while it is in use.
+func (s *Sheet) RowIterator(options ...RowVisitorOption) *RowIterator {
 	s.mustBeOpen()
-	flags := &rowVisitorFlags{}
+	it := &RowIterator{sheet: s}
 	for _, opt := range options {
-		opt(flags)
+		opt(&it.flags)
 	}
-	if s.currentRow != nil {
-		err := s.cellStore.WriteRow(s.currentRow)
-		if err != nil {
-			return err
+	if it.flags.start < 0 {
+		it.flags.start = 0
+	}
+	it.idx = it.flags.start
+	if it.flags.reverse {
+		// Set to the last Row to visit by the first call to next.
+		it.idx = -1
+	}
+	return it
+}
+
+// Next returns the next Row, making it the current row of the Sheet,
+// or io.EOF once there are no more Rows to visit, at which point the
+// last Row returned has been written back to the CellStore.
+func (it *RowIterator) Next() (*Row, error) {
+	r, err := it.next()
+	if err == io.EOF {
+		it.Close()
+	}
+	return r, err
+}
+
+// Close stops the RowIterator and writes the Row it returned last
+// back to the CellStore.  There is no need to call it once Next has
+// returned io.EOF.
+func (it *RowIterator) Close() {
+	if !it.done {
+		it.done = true
+		if it.started {
+			it.sheet.setCurrentRow(nil)
 		}
 	}
-	for i := 0; i < s.MaxRow; i++ {
+}
+
+// next returns the next Row as Next does, but leaves the last one as
+// the current row of the Sheet at the end.
+func (it *RowIterator) next() (*Row, error) {
+	if it.done {
+		return nil, io.EOF
+	}
+	s := it.sheet
+	s.mustBeOpen()
+	if !it.started {
+		it.started = true
+		if s.currentRow != nil {
+			err := s.cellStore.WriteRow(s.currentRow)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	lo, hi := it.flags.start, s.MaxRow
+	if it.flags.hasEnd && it.flags.end < hi {
+		hi = it.flags.end
+	}
+	step := 1
+	if it.flags.reverse {
+		step = -1
+		if it.idx == -1 {
+			it.idx = hi - 1
+		}
+	}
+	for ; it.idx >= lo && it.idx < hi; it.idx += step {
+		i := it.idx
 		r, err := s.cellStore.ReadRow(makeRowKey(s, i), s)
 		if err != nil {
 			if _, ok := err.(*RowNotFoundError); !ok {
-				return err
-
+				return nil, err
 			}
-			if flags.skipEmptyRows {
+			if it.flags.skipEmptyRows {
 				continue
 			}
 			r = s.cellStore.MakeRow(s)
 			r.num = i
 		}
-		if r.cellStoreRow.CellCount() == 0 && flags.skipEmptyRows {
+		// A Row with a default style isn't empty, even without cells.
+		if r.cellStoreRow.CellCount() == 0 && r.style == nil && r.numFmt == "" && it.flags.skipEmptyRows {
+			continue
+		}
+		if r.Hidden && it.flags.skipHiddenRows {
 			continue
 		}
 		r.Sheet = s
 		s.setCurrentRow(r)
-		err = rv(r)
-		if err != nil {
-			return err
-		}
+		it.idx += step
+		return r, nil
 	}
-	return nil
+	return nil, io.EOF
+}
+
+// LastRow returns the last Row of the Sheet that isn't empty, as for
+// SkipEmptyRows, making it the current row, or nil if all of them are
+// empty.  Only the Rows after it are read to find it.
+func (s *Sheet) LastRow() (*Row, error) {
+	it := s.RowIterator(Reverse, SkipEmptyRows)
+	r, err := it.next()
+	if err == io.EOF {
+		return nil, nil
+	}
+	return r, err
+}
+
+// CellsWithStyle calls cvf for each cell in the Sheet whose style and
+// number format are those of the style at index i of the File's
+// stylesheet, as returned by File.StyleAt.  Cells without a style
+// use the style at index 0.
+func (s *Sheet) CellsWithStyle(i int, cvf CellVisitorFunc) error {
+	s.mustBeOpen()
+	if s.File == nil {
+		return errors.New("CellsWithStyle: the sheet doesn't belong to a file")
+	}
+	style, err := s.File.StyleAt(i)
+	if err != nil {
+		return fmt.Errorf("CellsWithStyle: %w", err)
+	}
+	numFmt := s.File.styles.getNumberFormatCode(i)
+	return s.ForEachRow(func(r *Row) error {
+		return r.ForEachCell(func(c *Cell) error {
+			cellNumFmt := c.NumFmt
+			if cellNumFmt == "" {
+				cellNumFmt = builtInNumFmt[builtInNumFmtIndex_GENERAL]
+			}
+			if cellNumFmt != numFmt {
+				return nil
+			}
+			if c.style == nil && i != 0 {
+				return nil
+			}
+			if c.style != nil && !c.style.equals(style) {
+				return nil
+			}
+			return cvf(c)
+		}, SkipEmptyCells)
+	}, SkipEmptyRows)
 }
 
 // Add a new Row to a Sheet
@@ -206,6 +784,7 @@ func (s *Sheet) AddRow() *Row {
 	row.num = s.MaxRow
 	s.MaxRow++
 	s.setCurrentRow(row)
+	s.File.audit(AuditAddRow, s.Name, strconv.Itoa(row.num+1), "", "")
 	return row
 }
 
@@ -242,17 +821,117 @@ func (s *Sheet) AddRowAtIndex(index int) (*Row, error) {
 		return nil, err
 	}
 	s.MaxRow++
+	s.moveCommentRows(index, 1)
+	s.sharedFormulas = nil
+	if index == 0 {
+		s.headers = nil
+	}
+	s.structureChanged = true
+	s.File.audit(AuditAddRow, s.Name, strconv.Itoa(index+1), "", "")
 	return row, nil
 }
 
+// sharedFormulaRange is a range of cells that share a formula, which
+// is written out as a shared formula.  masterWritten records, while the
+// Sheet is being written, whether the first cell of the range still had
+// the formula, so that the other cells can refer to it.
+type sharedFormulaRange struct {
+	Range
+	formula       string
+	masterWritten bool
+}
+
+// SetSharedFormula gives every cell in rangeRef, such as "C2:C100",
+// formula, with its relative references shifted for each cell as
+// though it had been filled in from the first one.  The range is
+// written out as a shared formula, where only the first cell holds
+// the text of the formula, which keeps large sheets small.  A cell
+// whose formula is changed afterwards is written out with its own
+// formula, as are all of them if rows are inserted or removed.
+func (s *Sheet) SetSharedFormula(rangeRef, formula string) error {
+	s.mustBeOpen()
+	wrap := func(err error) error {
+		return fmt.Errorf("Sheet.SetSharedFormula: %w", err)
+	}
+	if formula == "" {
+		return wrap(errors.New("the formula is empty"))
+	}
+	r, err := s.Range(rangeRef)
+	if err != nil {
+		return wrap(err)
+	}
+	err = r.ForEachCell(func(c *Cell) error {
+		c.SetFormula(shiftFormula(formula, c.num-r.FirstCol, c.Row.num-r.FirstRow))
+		return nil
+	})
+	if err != nil {
+		return wrap(err)
+	}
+	// A cell can only belong to one shared formula.
+	kept := s.sharedFormulas[:0]
+	for _, shared := range s.sharedFormulas {
+		if shared.LastRow < r.FirstRow || shared.FirstRow > r.LastRow ||
+			shared.LastCol < r.FirstCol || shared.FirstCol > r.LastCol {
+			kept = append(kept, shared)
+		}
+	}
+	s.sharedFormulas = append(kept, &sharedFormulaRange{Range: *r, formula: formula})
+	return nil
+}
+
+// makeXlsxF returns the f element for the formula of the cell at col
+// and row.  The first cell of a range given to SetSharedFormula holds
+// the formula and the range, and the other cells refer to it by its
+// index, as long as their formulas haven't been changed since.  The
+// cells are written in order, so the first cell of a range always
+// comes before the others.
+func (s *Sheet) makeXlsxF(col, row int, formula string) *xlsxF {
+	for i, shared := range s.sharedFormulas {
+		if row < shared.FirstRow || row > shared.LastRow || col < shared.FirstCol || col > shared.LastCol {
+			continue
+		}
+		si := i
+		if row == shared.FirstRow && col == shared.FirstCol {
+			shared.masterWritten = formula == shared.formula
+			if shared.masterWritten {
+				return &xlsxF{Content: formula, T: "shared", Ref: shared.String(), Si: &si}
+			}
+			break
+		}
+		if shared.masterWritten && formula == shiftFormula(shared.formula, col-shared.FirstCol, row-shared.FirstRow) {
+			return &xlsxF{T: "shared", Si: &si}
+		}
+		break
+	}
+	return &xlsxF{Content: formula}
+}
+
+// resetSharedFormulas prepares the shared formulas for the Sheet to be
+// written out.
+func (s *Sheet) resetSharedFormulas() {
+	for _, shared := range s.sharedFormulas {
+		shared.masterWritten = false
+	}
+}
+
 // Add a DataValidation to a range of cells
 func (s *Sheet) AddDataValidation(dv *xlsxDataValidation) {
 	s.mustBeOpen()
 	s.DataValidations = append(s.DataValidations, dv)
 }
 
-// Removes a row at a specific index
+// Removes a row at a specific index, as RemoveRowAt does.
 func (s *Sheet) RemoveRowAtIndex(index int) error {
+	return s.RemoveRowAt(index)
+}
+
+// RemoveRowAt removes the row at the zero based index, with its cells,
+// from the Sheet and from its CellStore, and moves the rows after it up
+// by one.  Merged cells, hyperlinks, comments, data validations, the
+// auto filter and images move with the cells, those that span index
+// shrink, and those that were only in the removed row are removed
+// with it.  As with RemoveColAt, formulas aren't changed.
+func (s *Sheet) RemoveRowAt(index int) error {
 	s.mustBeOpen()
 	if index < 0 || index >= s.MaxRow {
 		return fmt.Errorf("Cannot remove row: index out of range: %d", index)
@@ -260,22 +939,312 @@ func (s *Sheet) RemoveRowAtIndex(index int) error {
 	if s.currentRow != nil {
 		s.setCurrentRow(nil)
 	}
-	err := s.cellStore.RemoveRow(makeRowKey(s, index))
+	// spans reports whether a merge or hyperlink of a cell in row y,
+	// span rows high, reaches the removed row from above.
+	spans := func(y, span int) bool {
+		return y < index && span > 0 && y+span >= index
+	}
+	for y := 0; y < index; y++ {
+		r, err := s.cellStore.ReadRow(makeRowKey(s, y), s)
+		if err != nil {
+			if _, ok := err.(*RowNotFoundError); !ok {
+				return err
+			}
+			continue
+		}
+		r.Sheet = s
+		s.setCurrentRow(r)
+		err = r.ForEachCell(func(c *Cell) error {
+			if spans(y, c.VMerge) || spans(y, c.Hyperlink.VSpan) {
+				c.updatable()
+				if spans(y, c.VMerge) {
+					c.VMerge--
+				}
+				if spans(y, c.Hyperlink.VSpan) {
+					c.Hyperlink.VSpan--
+				}
+				c.modified = true
+			}
+			return nil
+		}, SkipEmptyCells)
+		if err != nil {
+			return err
+		}
+	}
+	// A merge, or a hyperlink, that starts in the removed row starts in
+	// the next one instead.
+	var starts []Cell
+	r, err := s.cellStore.ReadRow(makeRowKey(s, index), s)
+	if err != nil {
+		if _, ok := err.(*RowNotFoundError); !ok {
+			return err
+		}
+	} else {
+		r.Sheet = s
+		s.setCurrentRow(r)
+		err = r.ForEachCell(func(c *Cell) error {
+			if c.VMerge > 0 || c.Hyperlink.VSpan > 0 {
+				starts = append(starts, *c)
+			}
+			return nil
+		}, SkipEmptyCells)
+		if err != nil {
+			return err
+		}
+	}
+	s.setCurrentRow(nil)
+
+	err = s.cellStore.RemoveRow(makeRowKey(s, index))
 	if err != nil {
 		return err
 	}
 	for i := index + 1; i < s.MaxRow; i++ {
 		nRow, err := s.cellStore.ReadRow(makeRowKey(s, i), s)
 		if err != nil {
+			if _, ok := err.(*RowNotFoundError); !ok {
+				return err
+			}
 			continue
 		}
 		nRow.Sheet = s
-		s.cellStore.MoveRow(nRow, i-1)
+		if err := s.cellStore.MoveRow(nRow, i-1); err != nil {
+			return err
+		}
 	}
 	s.MaxRow--
+	if len(starts) > 0 && index < s.MaxRow {
+		r, err := s.Row(index)
+		if err != nil {
+			return err
+		}
+		for _, start := range starts {
+			c := r.GetCell(start.num)
+			c.updatable()
+			if start.VMerge > 0 && c.HMerge == 0 && c.VMerge == 0 {
+				c.HMerge, c.VMerge = start.HMerge, start.VMerge-1
+			}
+			if start.Hyperlink.VSpan > 0 && c.Hyperlink == (Hyperlink{}) {
+				c.Hyperlink = start.Hyperlink
+				c.Hyperlink.VSpan--
+			}
+			c.modified = true
+		}
+	}
+	for key := range s.comments {
+		if key.y == index {
+			delete(s.comments, key)
+		}
+	}
+	s.moveCommentRows(index+1, -1)
+	s.moveRanges(func(r Range) (Range, bool) {
+		return r.moveRows(index, -1)
+	})
+	s.sharedFormulas = nil
+	if index == 0 {
+		s.headers = nil
+	}
+	s.structureChanged = true
+	s.File.audit(AuditRemoveRow, s.Name, strconv.Itoa(index+1), "", "")
+	return nil
+}
+
+// InsertColAt inserts an empty column at the zero based idx, as for
+// Sheet.Col, moving the cells from idx onwards, and the widths and
+// other settings of their columns, one column to the right.  Merged
+// cells, hyperlinks, comments, data validations, the auto filter and
+// images move with the cells, and those that span idx grow to include
+// the new column.  Cells in the last column that Excel allows are lost.
+// The rows are moved one at a time, so that the rows
+// of a Sheet with a CellStore that persists them aren't all loaded.
+// Formulas, and hyperlinks to locations in the workbook, aren't
+// changed and so may refer to the wrong cells afterwards.
+func (s *Sheet) InsertColAt(idx int) error {
+	s.mustBeOpen()
+	if idx < 0 || idx > Excel2006MaxColIndex {
+		return fmt.Errorf("InsertColAt: index out of range: %d", idx)
+	}
+	if err := s.moveCols(idx, 1); err != nil {
+		return fmt.Errorf("InsertColAt: %w", err)
+	}
+	s.File.audit(AuditInsertCol, s.Name, ColIndexToLetters(idx), "", "")
 	return nil
 }
 
+// RemoveColAt removes the column at the zero based idx, as for
+// Sheet.Col, with its cells, moving the cells after it, and the widths
+// and other settings of their columns, one column to the left.  Merged
+// cells, hyperlinks, comments, data validations, the auto filter and
+// images move with the cells, those that span idx shrink, and those
+// that were only in the removed column are removed with it.  As with
+// InsertColAt, formulas aren't changed.
+func (s *Sheet) RemoveColAt(idx int) error {
+	s.mustBeOpen()
+	if idx < 0 || idx > Excel2006MaxColIndex {
+		return fmt.Errorf("RemoveColAt: index out of range: %d", idx)
+	}
+	if err := s.moveCols(idx, -1); err != nil {
+		return fmt.Errorf("RemoveColAt: %w", err)
+	}
+	s.File.audit(AuditRemoveCol, s.Name, ColIndexToLetters(idx), "", "")
+	return nil
+}
+
+// moveCols inserts a column at idx, if delta is 1, or removes the one
+// at idx, if delta is -1, for InsertColAt and RemoveColAt.
+func (s *Sheet) moveCols(idx, delta int) error {
+	// spans reports whether a merge or hyperlink of the cell at col,
+	// span columns wide, reaches the column at idx from its left.
+	spans := func(col, span int) bool {
+		return col < idx && span > 0 && col+span >= idx
+	}
+	err := s.ForEachRow(func(r *Row) error {
+		var moving []Cell
+		err := r.ForEachCell(func(c *Cell) error {
+			if c.num >= idx {
+				moving = append(moving, *c)
+				return nil
+			}
+			if spans(c.num, c.HMerge) || spans(c.num, c.Hyperlink.HSpan) {
+				c.updatable()
+				if spans(c.num, c.HMerge) {
+					c.HMerge += delta
+				}
+				if spans(c.num, c.Hyperlink.HSpan) {
+					c.Hyperlink.HSpan += delta
+				}
+				c.modified = true
+			}
+			return nil
+		}, SkipEmptyCells)
+		if err != nil {
+			return err
+		}
+		if delta > 0 {
+			// The cells are moved right to left, so that none is
+			// put in the place of one that hasn't moved yet.
+			for i, j := 0, len(moving)-1; i < j; i, j = i+1, j-1 {
+				moving[i], moving[j] = moving[j], moving[i]
+			}
+		}
+		// moving may grow while it is walked.
+		for i := 0; i < len(moving); i++ {
+			c := &moving[i]
+			if err := r.RemoveCellAt(c.num); err != nil {
+				return err
+			}
+			if c.num == idx && delta < 0 {
+				// A merge, or a hyperlink, that starts in the
+				// removed column starts in the next one instead.
+				if c.HMerge > 0 || c.Hyperlink.HSpan > 0 {
+					if i+1 == len(moving) || moving[i+1].num != idx+1 {
+						moving = append(moving[:i+1], append([]Cell{{num: idx + 1}}, moving[i+1:]...)...)
+					}
+					next := &moving[i+1]
+					if c.HMerge > 0 && next.HMerge == 0 && next.VMerge == 0 {
+						next.HMerge, next.VMerge = c.HMerge-1, c.VMerge
+					}
+					if c.Hyperlink.HSpan > 0 && next.Hyperlink == (Hyperlink{}) {
+						next.Hyperlink = c.Hyperlink
+						next.Hyperlink.HSpan--
+					}
+				}
+				continue
+			}
+			c.num += delta
+			if c.num > Excel2006MaxColIndex {
+				continue
+			}
+			c.Row = r
+			c.modified = true
+			r.PushCell(c)
+		}
+		return nil
+	}, SkipEmptyRows)
+	if err != nil {
+		return err
+	}
+
+	s.moveColSettings(idx, delta)
+	if delta < 0 {
+		for key := range s.comments {
+			if key.x == idx {
+				delete(s.comments, key)
+			}
+		}
+		s.moveCommentCols(idx+1, -1)
+	} else {
+		s.moveCommentCols(idx, 1)
+	}
+	s.moveRanges(func(r Range) (Range, bool) {
+		return r.moveCols(idx, delta)
+	})
+	if idx < s.MaxCol {
+		s.MaxCol += delta
+	}
+	s.sharedFormulas = nil
+	s.headers = nil
+	s.structureChanged = true
+	return nil
+}
+
+// moveRanges moves the ranges of the data validations and the auto
+// filter of the Sheet, and the anchors of its images, with move, as
+// moveSqref does.  An image anchored in a removed column or row stays
+// where it is, in the one that takes its place.
+func (s *Sheet) moveRanges(move func(r Range) (Range, bool)) {
+	kept := s.DataValidations[:0]
+	for _, dv := range s.DataValidations {
+		dv.Sqref = moveSqref(dv.Sqref, move)
+		if dv.Sqref != "" {
+			kept = append(kept, dv)
+		}
+	}
+	s.DataValidations = kept
+	if s.AutoFilter != nil {
+		if r, err := parseRange(s.AutoFilter.TopLeftCell + ":" + s.AutoFilter.BottomRightCell); err == nil {
+			moved, ok := move(*r)
+			if !ok {
+				s.AutoFilter = nil
+			} else {
+				s.AutoFilter.TopLeftCell = GetCellIDStringFromCoords(moved.FirstCol, moved.FirstRow)
+				s.AutoFilter.BottomRightCell = GetCellIDStringFromCoords(moved.LastCol, moved.LastRow)
+			}
+		}
+	}
+	moveAnchor := func(p *ImageAnchorPoint) {
+		if moved, ok := move(Range{FirstCol: p.Col, LastCol: p.Col, FirstRow: p.Row, LastRow: p.Row}); ok {
+			p.Col, p.Row = moved.FirstCol, moved.FirstRow
+		}
+	}
+	for _, img := range s.images {
+		moveAnchor(&img.Anchor.From)
+		if img.Anchor.Type == TwoCellAnchor {
+			moveAnchor(&img.Anchor.To)
+		}
+	}
+}
+
+// moveColSettings moves the Cols of the Sheet as moveCols moves its
+// cells.  A Col that spans idx grows or shrinks, and one that only
+// applied to the removed column is removed.
+func (s *Sheet) moveColSettings(idx, delta int) {
+	if s.Cols == nil {
+		panic("trying to use uninitialised ColStore")
+	}
+	cols := &ColStore{}
+	s.Cols.ForEach(func(_ int, col *Col) {
+		r, ok := Range{FirstCol: col.Min - 1, LastCol: col.Max - 1}.moveCols(idx, delta)
+		if !ok || r.FirstCol > Excel2006MaxColIndex {
+			return
+		}
+		if r.LastCol > Excel2006MaxColIndex {
+			r.LastCol = Excel2006MaxColIndex
+		}
+		cols.Add(col.copyToRange(r.FirstCol+1, r.LastCol+1))
+	})
+	s.Cols = cols
+}
+
 // Make sure we always have as many Rows as we do cells.
 func (s *Sheet) maybeAddRow(rowCount int) {
 	s.mustBeOpen()
@@ -342,9 +1311,17 @@ func (s *Sheet) Cell(row, col int) (*Cell, error) {
 	if err != nil {
 		return nil, err
 	}
-	cell := r.GetCell(col)
+	var cell *Cell
+	if getter, ok := r.cellStoreRow.(cellGetter); ok {
+		cell, err = getter.getCell(col)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		cell = r.GetCell(col)
+	}
 	cell.Row = r
-	return cell, err
+	return cell, nil
 }
 
 //Set the parameters of a column.  Parameters are passed as a pointer
@@ -395,7 +1372,9 @@ func (s *Sheet) setCol(min, max int, setter func(col *Col)) {
 			setter(newCol)
 			s.Cols.Add(newCol)
 		default:
-			newCol := col.copyToRange(min, max)
+			// The column is within the range, which may
+			// span several of them.
+			newCol := col.copyToRange(col.Min, col.Max)
 			setter(newCol)
 			s.Cols.Add(newCol)
 
@@ -412,6 +1391,59 @@ func (s *Sheet) SetColWidth(min, max int, width float64) {
 	})
 }
 
+// SetColWidthRange sets the width of the columns from the zero based
+// min to max, inclusive, as for Sheet.Col, unlike SetColWidth whose
+// columns are numbered from 1.  The width, in characters as for
+// Col.SetWidth, must be from 0 to 255, the widest that Excel allows.
+// The other attributes of the columns, such as whether they are
+// hidden, are kept.
+func (s *Sheet) SetColWidthRange(min, max int, width float64) error {
+	s.mustBeOpen()
+	switch {
+	case min < 0 || max < min || max > Excel2006MaxColIndex:
+		return fmt.Errorf("SetColWidthRange: invalid range of columns %d to %d", min, max)
+	case width < 0 || width > maxColWidth:
+		return fmt.Errorf("SetColWidthRange: the width %g is not from 0 to %d", width, maxColWidth)
+	}
+	s.SetColWidth(min+1, max+1, width)
+	return nil
+}
+
+// SetColHidden hides the column at the zero based idx, as for
+// Sheet.Col, or shows it if hidden is false.  The other attributes of
+// the column, such as its width, are kept, and so the column has the
+// same width when it is shown again.
+func (s *Sheet) SetColHidden(idx int, hidden bool) {
+	s.mustBeOpen()
+	s.setCol(idx+1, idx+1, func(col *Col) {
+		col.SetHidden(hidden)
+	})
+}
+
+// SetColStyle styles the whole column at the zero based colIdx, as for
+// Sheet.Col, with style, as Row.SetStyle does for a row: style becomes
+// the Style of the Col, which is written as its style attribute, and
+// replaces the Style of each cell of the column that has one of its
+// own.  The rows are visited one at a time, so that the rows of a Sheet
+// with a CellStore that persists them aren't all loaded.
+func (s *Sheet) SetColStyle(colIdx int, style *Style) error {
+	s.mustBeOpen()
+	if colIdx < 0 || colIdx > Excel2006MaxColIndex {
+		return fmt.Errorf("SetColStyle: index out of range: %d", colIdx)
+	}
+	s.setCol(colIdx+1, colIdx+1, func(col *Col) {
+		col.SetStyle(style)
+	})
+	return s.ForEachRow(func(r *Row) error {
+		return r.ForEachCell(func(c *Cell) error {
+			if c.num == colIdx && c.style != nil {
+				c.SetStyle(style)
+			}
+			return nil
+		}, SkipEmptyCells)
+	}, SkipEmptyRows)
+}
+
 // This can be use as the default scale function for the autowidth.
 // It works well with the default font sizes.
 func DefaultAutoWidth(s string) float64 {
@@ -454,6 +1486,155 @@ func (s *Sheet) SetOutlineLevel(minCol, maxCol int, outlineLevel uint8) {
 	})
 }
 
+// maxOutlineLevel is the deepest outline level that Excel supports.
+const maxOutlineLevel = 7
+
+// SetColOutlineLevel groups the columns from startCol to endCol, which
+// are numbered from 1, as for SetColWidth, at level, from 1 to 7, or
+// ungroups them if level is 0.  The outlineLevelCol of the sheet is
+// the deepest level of its columns when it is written.
+func (s *Sheet) SetColOutlineLevel(startCol, endCol int, level uint8) error {
+	s.mustBeOpen()
+	if level > maxOutlineLevel {
+		return fmt.Errorf("SetColOutlineLevel: the outline level %d is deeper than %d", level, maxOutlineLevel)
+	}
+	s.setCol(startCol, endCol, func(col *Col) {
+		if level == 0 {
+			col.OutlineLevel = nil
+			return
+		}
+		col.SetOutlineLevel(level)
+	})
+	return nil
+}
+
+// SetColCollapsed collapses the group of the columns from startCol to
+// endCol, numbered from 1, or expands it if collapsed is false.  The
+// columns are hidden, or shown, and the column that summarises them,
+// which is right of them unless SetOutlineSummaryRight has been given
+// false, is marked collapsed, as Excel does.
+func (s *Sheet) SetColCollapsed(startCol, endCol int, collapsed bool) {
+	s.mustBeOpen()
+	s.setCol(startCol, endCol, func(col *Col) {
+		hidden := collapsed
+		col.Hidden = &hidden
+	})
+	summary := endCol + 1
+	if !s.OutlineSummaryRight() {
+		summary = startCol - 1
+	}
+	if summary < 1 {
+		return
+	}
+	s.setCol(summary, summary, func(col *Col) {
+		col.SetCollapsed(collapsed)
+	})
+}
+
+// SetOutlineSummaryRight sets whether the column that summarises each
+// group of columns, where Excel shows the button that expands and
+// collapses the group, is right of the group, which is the default, or
+// left of it.
+func (s *Sheet) SetOutlineSummaryRight(right bool) {
+	if s.outlinePr == nil {
+		s.outlinePr = &xlsxOutlinePr{}
+	}
+	s.outlinePr.SummaryRight = &right
+}
+
+// OutlineSummaryRight reports whether the column that summarises each
+// group of columns is right of the group.
+func (s *Sheet) OutlineSummaryRight() bool {
+	return s.outlinePr == nil || s.outlinePr.SummaryRight == nil || *s.outlinePr.SummaryRight
+}
+
+// SetOutlineSummaryBelow sets whether the row that summarises each
+// group of rows is below the group, which is the default, or above it.
+func (s *Sheet) SetOutlineSummaryBelow(below bool) {
+	if s.outlinePr == nil {
+		s.outlinePr = &xlsxOutlinePr{}
+	}
+	s.outlinePr.SummaryBelow = &below
+}
+
+// OutlineSummaryBelow reports whether the row that summarises each
+// group of rows is below the group.
+func (s *Sheet) OutlineSummaryBelow() bool {
+	return s.outlinePr == nil || s.outlinePr.SummaryBelow == nil || *s.outlinePr.SummaryBelow
+}
+
+// CollapseRowGroup collapses every group of rows at level, from 1 to
+// 7: the consecutive rows whose outline level is level or deeper are
+// hidden, and the row that summarises each group, which is below it
+// unless SetOutlineSummaryBelow has been given false, is marked
+// collapsed, as Excel does, so that the file opens with the groups
+// folded.
+func (s *Sheet) CollapseRowGroup(level uint8) error {
+	if err := s.setRowGroupsCollapsed(level, true); err != nil {
+		return fmt.Errorf("CollapseRowGroup: %w", err)
+	}
+	return nil
+}
+
+// ExpandRowGroup expands every group of rows at level, from 1 to 7,
+// and the groups within them, showing their rows.
+func (s *Sheet) ExpandRowGroup(level uint8) error {
+	if err := s.setRowGroupsCollapsed(level, false); err != nil {
+		return fmt.Errorf("ExpandRowGroup: %w", err)
+	}
+	return nil
+}
+
+// setRowGroupsCollapsed collapses or expands the groups of rows at
+// level.
+func (s *Sheet) setRowGroupsCollapsed(level uint8, collapsed bool) error {
+	s.mustBeOpen()
+	if level < 1 || level > maxOutlineLevel {
+		return fmt.Errorf("the outline level %d isn't from 1 to %d", level, maxOutlineLevel)
+	}
+	levels := make([]uint8, s.MaxRow)
+	for i := range levels {
+		row, err := s.Row(i)
+		if err != nil {
+			return err
+		}
+		levels[i] = row.GetOutlineLevel()
+	}
+	for start := 0; start < len(levels); start++ {
+		if levels[start] < level {
+			continue
+		}
+		end := start
+		for end+1 < len(levels) && levels[end+1] >= level {
+			end++
+		}
+		for i := start; i <= end; i++ {
+			row, err := s.Row(i)
+			if err != nil {
+				return err
+			}
+			row.setHidden(collapsed)
+			if !collapsed && row.collapsed {
+				// The groups within are expanded too.
+				row.SetCollapsed(false)
+			}
+		}
+		summary := end + 1
+		if !s.OutlineSummaryBelow() {
+			summary = start - 1
+		}
+		if summary >= 0 {
+			row, err := s.Row(summary)
+			if err != nil {
+				return err
+			}
+			row.SetCollapsed(collapsed)
+		}
+		start = end
+	}
+	return nil
+}
+
 // Set the type for a range of columns.
 func (s *Sheet) SetType(minCol, maxCol int, cellType CellType) {
 	s.mustBeOpen()
@@ -498,42 +1679,77 @@ func (s *Sheet) handleMerged() {
 	}
 }
 
-func (s *Sheet) makeSheetView(worksheet *xlsxWorksheet) {
-	for index, sheetView := range s.SheetViews {
-		if sheetView.Pane != nil {
-			worksheet.SheetViews.SheetView[index].Pane = &xlsxPane{
-				XSplit:      sheetView.Pane.XSplit,
-				YSplit:      sheetView.Pane.YSplit,
-				TopLeftCell: sheetView.Pane.TopLeftCell,
-				ActivePane:  sheetView.Pane.ActivePane,
-				State:       sheetView.Pane.State,
-			}
+// defaultRowHeight is the height, in points, of the rows of a Sheet
+// whose default row height hasn't been set.
+const defaultRowHeight = 12.85
 
-		}
+// SetDefaultRowHeight sets the height, in points, of the rows of the
+// Sheet whose height isn't set, as Row.SetHeight does for one row.
+func (s *Sheet) SetDefaultRowHeight(height float64) {
+	s.SheetFormat.DefaultRowHeight = height
+	s.SheetFormat.CustomHeight = true
+}
+
+// DefaultRowHeight returns the height, in points, of the rows of the
+// Sheet whose height isn't set.
+func (s *Sheet) DefaultRowHeight() float64 {
+	if s.SheetFormat.DefaultRowHeight == 0 {
+		return defaultRowHeight
 	}
-	if s.Selected {
-		worksheet.SheetViews.SheetView[0].TabSelected = true
+	return s.SheetFormat.DefaultRowHeight
+}
+
+// SetDefaultColWidth sets the width of the columns of the Sheet whose
+// width isn't set, in characters as for Col.SetWidth.
+func (s *Sheet) SetDefaultColWidth(width float64) {
+	s.SheetFormat.DefaultColWidth = width
+}
+
+// DefaultColWidth returns the width of the columns of the Sheet whose
+// width isn't set, which is ColWidth unless SetDefaultColWidth has been
+// called or the Sheet was read from a file that sets it.
+func (s *Sheet) DefaultColWidth() float64 {
+	if s.SheetFormat.DefaultColWidth == 0 {
+		return ColWidth
 	}
+	return s.SheetFormat.DefaultColWidth
+}
 
+// ColWidth returns the width of the column at the zero based idx, as
+// for Sheet.Col, which is the DefaultColWidth of the Sheet if the
+// column has no width of its own.
+func (s *Sheet) ColWidth(idx int) float64 {
+	if col := s.Col(idx); col != nil && col.Width != nil {
+		return *col.Width
+	}
+	return s.DefaultColWidth()
 }
 
 func (s *Sheet) makeSheetFormatPr(worksheet *xlsxWorksheet) {
-	worksheet.SheetFormatPr.DefaultRowHeight = 12.85
-	if s.SheetFormat.DefaultRowHeight != 0 {
-		worksheet.SheetFormatPr.DefaultRowHeight = s.SheetFormat.DefaultRowHeight
-	}
+	worksheet.SheetFormatPr.DefaultRowHeight = s.DefaultRowHeight()
+	worksheet.SheetFormatPr.CustomHeight = s.SheetFormat.CustomHeight
 	worksheet.SheetFormatPr.DefaultColWidth = s.SheetFormat.DefaultColWidth
+	// The outline properties are in sheetPr, but go with the outline
+	// levels of sheetFormatPr.
+	if s.outlinePr != nil {
+		outlinePr := *s.outlinePr
+		worksheet.SheetPr.OutlinePr = &outlinePr
+	}
 }
 
 //
-func (s *Sheet) makeCols(worksheet *xlsxWorksheet, styles *xlsxStyleSheet) (maxLevelCol uint8) {
+func (s *Sheet) makeCols(worksheet *xlsxWorksheet, styles *xlsxStyleSheet) (maxLevelCol uint8, err error) {
 	s.mustBeOpen()
 	maxLevelCol = 0
 	if s.Cols == nil {
 		panic("trying to use uninitialised ColStore")
 	}
+	var prev *Col
 	s.Cols.ForEach(
 		func(c int, col *Col) {
+			if err != nil {
+				return
+			}
 			XfId := 0
 			style := col.GetStyle()
 
@@ -543,19 +1759,36 @@ func (s *Sheet) makeCols(worksheet *xlsxWorksheet, styles *xlsxStyleSheet) (maxL
 					style = NewStyle()
 				}
 
-				xNumFmt := styles.newNumFmt(col.numFmt)
-				XfId = handleStyleForXLSX(style, xNumFmt.NumFmtId, styles)
+				var xNumFmt xlsxNumFmt
+				xNumFmt, err = styles.newNumFmt(col.numFmt)
+				if err == nil {
+					XfId, err = handleStyleForXLSX(style, xNumFmt.NumFmtId, styles)
+				}
 			} else {
 				if style != nil {
-					XfId = handleStyleForXLSX(style, 0, styles)
+					XfId, err = handleStyleForXLSX(style, 0, styles)
 				}
 			}
+			if err != nil {
+				err = fmt.Errorf("column %d: %w", col.Min, err)
+				return
+			}
 			col.outXfID = XfId
 
 			// When the cols content is empty, the cols flag is not output in the xml file.
 			if worksheet.Cols == nil {
 				worksheet.Cols = &xlsxCols{Col: []xlsxCol{}}
 			}
+			// Neighbouring Cols that define the same attributes,
+			// such as those left when a range read from a file is
+			// split by another, are written as one col element.
+			last := len(worksheet.Cols.Col) - 1
+			if prev != nil && last >= 0 && prev.Max+1 == col.Min && prev.sameAs(col) {
+				worksheet.Cols.Col[last].Max = col.Max
+				prev = col
+				return
+			}
+			prev = col
 			worksheet.Cols.Col = append(worksheet.Cols.Col,
 				xlsxCol{
 					Min:          col.Min,
@@ -575,7 +1808,7 @@ func (s *Sheet) makeCols(worksheet *xlsxWorksheet, styles *xlsxStyleSheet) (maxL
 			}
 		})
 
-	return maxLevelCol
+	return maxLevelCol, err
 }
 
 func (s *Sheet) prepSheetForMarshalling(maxLevelCol uint8) {
@@ -587,22 +1820,28 @@ func (s *Sheet) prepWorksheetFromRows(worksheet *xlsxWorksheet, relations *xlsxW
 	var maxCell, maxRow int
 
 	prepRow := func(row *Row) error {
-		if row.num > maxRow {
+		if row.hasOwnAttributes() && row.num > maxRow {
 			maxRow = row.num
 		}
 
 		prepCell := func(cell *Cell) error {
+			if cell.isBlank() {
+				return nil
+			}
 			if cell.num > maxCell {
 				maxCell = cell.num
 			}
+			if row.num > maxRow {
+				maxRow = row.num
+			}
 			cellID := GetCellIDStringFromCoords(cell.num, row.num)
 			if nil != cell.DataValidation {
 				if nil == worksheet.DataValidations {
 					worksheet.DataValidations = &xlsxDataValidations{}
 				}
-				cell.DataValidation.Sqref = cellID
-				worksheet.DataValidations.DataValidation = append(worksheet.DataValidations.DataValidation, cell.DataValidation)
-				worksheet.DataValidations.Count = len(worksheet.DataValidations.DataValidation)
+				dv := *cell.DataValidation
+				dv.Sqref = cellID
+				worksheet.DataValidations.DataValidation = append(worksheet.DataValidations.DataValidation, &dv)
 			}
 
 			if cell.Hyperlink != (Hyperlink{}) {
@@ -610,22 +1849,7 @@ func (s *Sheet) prepWorksheetFromRows(worksheet *xlsxWorksheet, relations *xlsxW
 					worksheet.Hyperlinks = &xlsxHyperlinks{HyperLinks: []xlsxHyperlink{}}
 				}
 
-				var relId string
-				if relations != nil && relations.Relationships != nil {
-					for _, rel := range relations.Relationships {
-						if rel.Target == cell.Hyperlink.Link {
-							relId = rel.Id
-						}
-					}
-				}
-
-				if relId != "" {
-
-					xlsxLink := xlsxHyperlink{
-						RelationshipId: relId,
-						Reference:      cellID,
-						DisplayString:  cell.Hyperlink.DisplayString,
-						Tooltip:        cell.Hyperlink.Tooltip}
+				if xlsxLink, ok := makeXlsxHyperlink(cell.Hyperlink, cell.num, row.num, relations); ok {
 					worksheet.Hyperlinks.HyperLinks = append(worksheet.Hyperlinks.HyperLinks, xlsxLink)
 				}
 			}
@@ -662,6 +1886,11 @@ func (s *Sheet) prepWorksheetFromRows(worksheet *xlsxWorksheet, relations *xlsxW
 	if s.AutoFilter != nil {
 		worksheet.AutoFilter = &xlsxAutoFilter{Ref: fmt.Sprintf("%v:%v", s.AutoFilter.TopLeftCell, s.AutoFilter.BottomRightCell)}
 	}
+	worksheet.SheetProtection = s.protection
+	if !s.structureChanged {
+		worksheet.CustomSheetViews = s.customSheetViews
+	}
+	worksheet.ExtLst = s.makeExtLst()
 
 	dimension := xlsxDimension{}
 	dimension.Ref = "A1:" + GetCellIDStringFromCoords(maxCell, maxRow)
@@ -672,6 +1901,31 @@ func (s *Sheet) prepWorksheetFromRows(worksheet *xlsxWorksheet, relations *xlsxW
 	return nil
 }
 
+// checkCellText records a Warning against the Sheet's File if the cell
+// holds more text than Excel allows, and returns an error instead if
+// the File's options ask for that.  ref is the cell's reference.
+func (s *Sheet) checkCellText(cell *Cell, ref string) error {
+	if s.File == nil {
+		return nil
+	}
+	length := utf8.RuneCountInString(cell.Value)
+	if cell.writesRichText() {
+		length = utf8.RuneCountInString(richTextToPlainText(cell.RichText))
+	}
+	if length <= maxCellTextLength {
+		return nil
+	}
+	err := fmt.Errorf("cell %s in sheet %q has %d characters, more than the %d that Excel allows", ref, s.Name, length, maxCellTextLength)
+	return s.File.addWarning(Warning{
+		Code:     WarningCellTextTooLong,
+		Severity: SeverityDataLoss,
+		Part:     sharedStringsPart,
+		Location: s.Name + "!" + ref,
+		Message:  err.Error() + "; Excel will truncate it",
+		Err:      err,
+	})
+}
+
 func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTable *RefTable, relations *xlsxWorksheetRels, maxLevelCol uint8) error {
 	s.mustBeOpen()
 	maxRow := 0
@@ -680,20 +1934,33 @@ func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTa
 	xSheet := xlsxSheetData{}
 	makeR := func(row *Row) error {
 		r := row.num
-		if r > maxRow {
-			maxRow = r
-		}
 		xRow := xlsxRow{}
 		xRow.R = r + 1
-		if row.isCustom {
+		// A row without a height of its own has the default row
+		// height of the sheet.
+		if row.isCustom && row.height > 0 {
 			xRow.CustomHeight = true
-			xRow.Ht = fmt.Sprintf("%g", row.GetHeight())
+			xRow.Ht = fmt.Sprintf("%g", row.height)
 		}
 		xRow.OutlineLevel = row.GetOutlineLevel()
+		xRow.Hidden = row.Hidden
+		xRow.Collapsed = row.collapsed
 		if xRow.OutlineLevel > maxLevelRow {
 			maxLevelRow = xRow.OutlineLevel
 		}
+		rowXfId, err := row.makeXfId(styles)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", r+1, err)
+		}
+		if rowXfId >= 0 {
+			xRow.S = rowXfId
+			xRow.CustomFormat = true
+		}
+		var first, last int
 		makeC := func(cell *Cell) error {
+			if cell.isBlank() {
+				return nil
+			}
 			var XfId int
 
 			c := cell.num
@@ -701,14 +1968,24 @@ func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTa
 			if col != nil {
 				XfId = col.outXfID
 			}
+			// The Row's default style takes precedence over the Col's.
+			if rowXfId >= 0 {
+				XfId = rowXfId
+			}
 
 			// generate NumFmtId and add new NumFmt
-			xNumFmt := styles.newNumFmt(cell.NumFmt)
+			xNumFmt, err := styles.newNumFmt(cell.NumFmt)
+			if err != nil {
+				return fmt.Errorf("cell %s: %w", GetCellIDStringFromCoords(c, r), err)
+			}
 
 			style := cell.style
 			switch {
 			case style != nil:
-				XfId = handleStyleForXLSX(style, xNumFmt.NumFmtId, styles)
+				XfId, err = handleStyleForXLSX(style, xNumFmt.NumFmtId, styles)
+				if err != nil {
+					return fmt.Errorf("cell %s: %w", GetCellIDStringFromCoords(c, r), err)
+				}
 			case len(cell.NumFmt) == 0:
 				// Do nothing
 			case col == nil:
@@ -725,20 +2002,36 @@ func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTa
 				R: GetCellIDStringFromCoords(c, r),
 			}
 			if cell.formula != "" {
-				xC.F = &xlsxF{Content: cell.formula}
+				xC.F = s.makeXlsxF(c, r, cell.formula)
+				s.File.noteFormula(cell)
 			}
 			switch cell.cellType {
 			case CellTypeInline:
 				// Inline strings are turned into shared strings since they are more efficient.
-				// This is what Excel does as well.
+				// This is what Excel does as well, unless the File was created with
+				// WriteInlineStrings.
 				fallthrough
 			case CellTypeString:
-				if len(cell.Value) > 0 {
-					xC.V = strconv.Itoa(refTable.AddString(cell.Value))
-				} else if len(cell.RichText) > 0 {
+				if err := s.checkCellText(cell, xC.R); err != nil {
+					return err
+				}
+				if cell.writesInlineString() {
+					xC.Is = cell.makeXlsxInlineString(styles)
+					xC.T = "inlineStr"
+					break
+				}
+				if cell.writesPhonetic() {
+					xC.V = strconv.Itoa(cell.addPhoneticString(refTable, styles))
+				} else if cell.writesRichText() {
 					xC.V = strconv.Itoa(refTable.AddRichText(cell.RichText))
+				} else if len(cell.Value) > 0 {
+					xC.V = strconv.Itoa(refTable.AddString(cell.Value))
+				}
+				// An empty cell, such as a styled one that has been
+				// cleared, is written without a type, as Excel does.
+				if xC.V != "" {
+					xC.T = "s"
 				}
-				xC.T = "s"
 			case CellTypeNumeric:
 				// Numeric is the default, so the type can be left blank
 				xC.V = cell.Value
@@ -758,14 +2051,18 @@ func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTa
 				panic(errors.New("unknown cell type cannot be marshaled"))
 			}
 
+			if len(xRow.C) == 0 {
+				first = c
+			}
+			last = c
 			xRow.C = append(xRow.C, xC)
 			if nil != cell.DataValidation {
 				if nil == worksheet.DataValidations {
 					worksheet.DataValidations = &xlsxDataValidations{}
 				}
-				cell.DataValidation.Sqref = xC.R
-				worksheet.DataValidations.DataValidation = append(worksheet.DataValidations.DataValidation, cell.DataValidation)
-				worksheet.DataValidations.Count = len(worksheet.DataValidations.DataValidation)
+				dv := *cell.DataValidation
+				dv.Sqref = xC.R
+				worksheet.DataValidations.DataValidation = append(worksheet.DataValidations.DataValidation, &dv)
 			}
 
 			if cell.Hyperlink != (Hyperlink{}) {
@@ -773,20 +2070,7 @@ func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTa
 					worksheet.Hyperlinks = &xlsxHyperlinks{HyperLinks: []xlsxHyperlink{}}
 				}
 
-				var relId string
-				for _, rel := range relations.Relationships {
-					if rel.Target == cell.Hyperlink.Link {
-						relId = rel.Id
-					}
-				}
-
-				if relId != "" {
-
-					xlsxLink := xlsxHyperlink{
-						RelationshipId: relId,
-						Reference:      xC.R,
-						DisplayString:  cell.Hyperlink.DisplayString,
-						Tooltip:        cell.Hyperlink.Tooltip}
+				if xlsxLink, ok := makeXlsxHyperlink(cell.Hyperlink, c, r, relations); ok {
 					worksheet.Hyperlinks.HyperLinks = append(worksheet.Hyperlinks.HyperLinks, xlsxLink)
 				}
 			}
@@ -807,10 +2091,19 @@ func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTa
 			}
 			return nil
 		}
-		err := row.ForEachCell(makeC, SkipEmptyCells)
+		err = row.ForEachCell(makeC, SkipEmptyCells)
 		if err != nil {
 			return err
 		}
+		if len(xRow.C) == 0 && !row.hasOwnAttributes() {
+			return nil
+		}
+		if len(xRow.C) > 0 {
+			xRow.Spans = makeSpans(first, last)
+		}
+		if r > maxRow {
+			maxRow = r
+		}
 		xSheet.Row = append(xSheet.Row, xRow)
 		return nil
 	}
@@ -833,6 +2126,11 @@ func (s *Sheet) makeRows(worksheet *xlsxWorksheet, styles *xlsxStyleSheet, refTa
 	if s.AutoFilter != nil {
 		worksheet.AutoFilter = &xlsxAutoFilter{Ref: fmt.Sprintf("%v:%v", s.AutoFilter.TopLeftCell, s.AutoFilter.BottomRightCell)}
 	}
+	worksheet.SheetProtection = s.protection
+	if !s.structureChanged {
+		worksheet.CustomSheetViews = s.customSheetViews
+	}
+	worksheet.ExtLst = s.makeExtLst()
 
 	worksheet.SheetData = xSheet
 	dimension := xlsxDimension{}
@@ -855,19 +2153,64 @@ func (s *Sheet) makeDataValidations(worksheet *xlsxWorksheet) {
 	}
 }
 
+// mergeDataValidations merges the validations of the Sheet and those of
+// its cells, once the rows have been added to the worksheet, so that
+// each rule is written once, with all the cells it applies to.
+func (s *Sheet) mergeDataValidations(worksheet *xlsxWorksheet) {
+	if worksheet.DataValidations == nil {
+		return
+	}
+	worksheet.DataValidations.DataValidation = mergeDataValidations(worksheet.DataValidations.DataValidation)
+	worksheet.DataValidations.Count = len(worksheet.DataValidations.DataValidation)
+}
+
+// DataValidationRules returns the data validations of the Sheet, both
+// those added with AddDataValidation and those of its cells, with the
+// validations that are the same rule merged into one, whose Ranges are
+// all the cells it applies to, as they are written to the file.  They
+// are copies, so changing them doesn't change the Sheet.
+func (s *Sheet) DataValidationRules() ([]*xlsxDataValidation, error) {
+	s.mustBeOpen()
+	dvs := append([]*xlsxDataValidation(nil), s.DataValidations...)
+	err := s.ForEachRow(func(r *Row) error {
+		return r.ForEachCell(func(c *Cell) error {
+			if c.DataValidation != nil {
+				dv := *c.DataValidation
+				dv.Sqref = GetCellIDStringFromCoords(c.num, r.num)
+				dvs = append(dvs, &dv)
+			}
+			return nil
+		}, SkipEmptyCells)
+	}, SkipEmptyRows)
+	if err != nil {
+		return nil, fmt.Errorf("Sheet.DataValidationRules: %w", err)
+	}
+	return mergeDataValidations(dvs), nil
+}
+
 func (s *Sheet) MarshalSheet(w io.Writer, refTable *RefTable, styles *xlsxStyleSheet, relations *xlsxWorksheetRels) error {
 	worksheet := newXlsxWorksheet()
 
 	s.handleMerged()
 	s.makeSheetView(worksheet)
 	s.makeSheetFormatPr(worksheet)
-	maxLevelCol := s.makeCols(worksheet, styles)
+	s.makePageSetup(worksheet)
+	s.makeHeaderFooter(worksheet)
+	maxLevelCol, err := s.makeCols(worksheet, styles)
+	if err != nil {
+		return err
+	}
 	s.makeDataValidations(worksheet)
+	s.makeDrawingElement(worksheet, relations)
+	s.makeLegacyDrawing(worksheet, relations)
+	s.makeTableParts(worksheet, relations)
+	s.resetSharedFormulas()
 	s.prepSheetForMarshalling(maxLevelCol)
-	err := s.prepWorksheetFromRows(worksheet, relations)
+	err = s.prepWorksheetFromRows(worksheet, relations)
 	if err != nil {
 		return err
 	}
+	s.mergeDataValidations(worksheet)
 	xw := xmlwriter.Open(w)
 
 	err = xw.StartDoc(xmlwriter.Doc{})
@@ -883,7 +2226,7 @@ func (s *Sheet) MarshalSheet(w io.Writer, refTable *RefTable, styles *xlsxStyleS
 }
 
 // Dump sheet to its XML representation, intended for internal use only
-func (s *Sheet) makeXLSXSheet(refTable *RefTable, styles *xlsxStyleSheet, relations *xlsxWorksheetRels) *xlsxWorksheet {
+func (s *Sheet) makeXLSXSheet(refTable *RefTable, styles *xlsxStyleSheet, relations *xlsxWorksheetRels) (*xlsxWorksheet, error) {
 	s.mustBeOpen()
 	worksheet := newXlsxWorksheet()
 
@@ -894,15 +2237,49 @@ func (s *Sheet) makeXLSXSheet(refTable *RefTable, styles *xlsxStyleSheet, relati
 
 	s.makeSheetView(worksheet)
 	s.makeSheetFormatPr(worksheet)
-	maxLevelCol := s.makeCols(worksheet, styles)
+	s.makePageSetup(worksheet)
+	s.makeHeaderFooter(worksheet)
+	maxLevelCol, err := s.makeCols(worksheet, styles)
+	if err != nil {
+		return nil, err
+	}
 	s.makeDataValidations(worksheet)
-	s.makeRows(worksheet, styles, refTable, relations, maxLevelCol)
+	s.makeDrawingElement(worksheet, relations)
+	s.makeLegacyDrawing(worksheet, relations)
+	s.makeTableParts(worksheet, relations)
+	s.resetSharedFormulas()
+	err = s.makeRows(worksheet, styles, refTable, relations, maxLevelCol)
+	if err != nil {
+		return nil, err
+	}
+	s.mergeDataValidations(worksheet)
 
-	return worksheet
+	return worksheet, nil
 }
 
-func handleStyleForXLSX(style *Style, NumFmtId int, styles *xlsxStyleSheet) (XfId int) {
+func handleStyleForXLSX(style *Style, NumFmtId int, styles *xlsxStyleSheet) (XfId int, err error) {
+	key := makeXfIdKey(style, NumFmtId)
+	if XfId, ok := styles.xfIds[key]; ok {
+		return XfId, nil
+	}
+	// Excel refuses to open a file containing an unknown border or
+	// pattern type, so catch them before they're written.
+	if err = style.Border.Validate(); err != nil {
+		return 0, err
+	}
+	if err = style.Fill.Validate(); err != nil {
+		return 0, err
+	}
 	xFont, xFill, xBorder, xCellXf := style.makeXLSXStyleElements()
+	// Write theme and indexed colours that were read from the file
+	// back out as they were, rather than as the ARGB values they
+	// resolve to.
+	xFill.PatternFill.FgColor = styles.sourceColor(xFill.PatternFill.FgColor)
+	xFill.PatternFill.BgColor = styles.sourceColor(xFill.PatternFill.BgColor)
+	xBorder.Left.Color = styles.sourceColor(xBorder.Left.Color)
+	xBorder.Right.Color = styles.sourceColor(xBorder.Right.Color)
+	xBorder.Top.Color = styles.sourceColor(xBorder.Top.Color)
+	xBorder.Bottom.Color = styles.sourceColor(xBorder.Bottom.Color)
 	fontId := styles.addFont(xFont)
 	fillId := styles.addFill(xFill)
 
@@ -923,12 +2300,18 @@ func handleStyleForXLSX(style *Style, NumFmtId int, styles *xlsxStyleSheet) (XfI
 
 	xCellXf.Alignment.Horizontal = style.Alignment.Horizontal
 	xCellXf.Alignment.Indent = style.Alignment.Indent
+	xCellXf.Alignment.JustifyLastLine = style.Alignment.JustifyLastLine
+	xCellXf.Alignment.ReadingOrder = style.Alignment.ReadingOrder
 	xCellXf.Alignment.ShrinkToFit = style.Alignment.ShrinkToFit
 	xCellXf.Alignment.TextRotation = style.Alignment.TextRotation
 	xCellXf.Alignment.Vertical = style.Alignment.Vertical
 	xCellXf.Alignment.WrapText = style.Alignment.WrapText
 
 	XfId = styles.addCellXf(xCellXf)
+	if styles.xfIds == nil {
+		styles.xfIds = make(map[xfIdKey]int)
+	}
+	styles.xfIds[key] = XfId
 	return
 }
 
@@ -3,8 +3,11 @@ package xlsx
 import (
 	"bytes"
 	"encoding/xml"
+	"errors"
+	"io"
 	"io/ioutil"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -198,7 +201,7 @@ func TestSheet(t *testing.T) {
 		c.Assert(len(xSheet.SheetData.Row), qt.Equals, 1)
 		xRow := xSheet.SheetData.Row[0]
 		c.Assert(xRow.R, qt.Equals, 1)
-		c.Assert(xRow.Spans, qt.Equals, "")
+		c.Assert(xRow.Spans, qt.Equals, "1:1")
 		c.Assert(len(xRow.C), qt.Equals, 1)
 		xC := xRow.C[0]
 		c.Assert(xC.R, qt.Equals, "A1")
@@ -232,7 +235,7 @@ func TestSheet(t *testing.T) {
 		c.Assert(len(xSheet.SheetData.Row), qt.Equals, 1)
 		xRow := xSheet.SheetData.Row[0]
 		c.Assert(xRow.R, qt.Equals, 1)
-		c.Assert(xRow.Spans, qt.Equals, "")
+		c.Assert(xRow.Spans, qt.Equals, "1:1")
 		c.Assert(len(xRow.C), qt.Equals, 1)
 		xC := xRow.C[0]
 		c.Assert(xC.R, qt.Equals, "A1")
@@ -310,7 +313,7 @@ func TestSheet(t *testing.T) {
 		c.Assert(err, qt.IsNil)
 
 		expectedXLSXSheet := `<?xml version="1.0" encoding="UTF-8"?>
-<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"/></sheetPr><dimension ref="A1"/><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="true" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"/></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"/><sheetData><row r="1" ht="0" customHeight="true"><c r="A1" t="s"><v>0</v></c></row></sheetData></worksheet>`
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"/></sheetPr><dimension ref="A1"/><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="true" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"/></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"/><sheetData><row r="1" spans="1:1" ht="0" customHeight="true"><c r="A1" t="s"><v>0</v></c></row></sheetData></worksheet>`
 
 		c.Assert(output.String(), qt.Equals, expectedXLSXSheet)
 	})
@@ -331,7 +334,7 @@ func TestSheet(t *testing.T) {
 		c.Assert(err, qt.Equals, nil)
 
 		expectedXLSXSheet := `<?xml version="1.0" encoding="UTF-8"?>
-<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"/></sheetPr><dimension ref="A1:B1"/><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="true" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"/></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"/><sheetData><row r="1" ht="0" customHeight="true"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row></sheetData></worksheet>`
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheetPr filterMode="false"><pageSetUpPr fitToPage="false"/></sheetPr><dimension ref="A1:B1"/><sheetViews><sheetView windowProtection="false" showFormulas="false" showGridLines="true" showRowColHeaders="true" showZeros="true" rightToLeft="false" tabSelected="true" showOutlineSymbols="true" defaultGridColor="true" view="normal" topLeftCell="A1" colorId="64" zoomScale="100" zoomScaleNormal="100" zoomScalePageLayoutView="100" workbookViewId="0"><selection pane="topLeft" activeCell="A1" activeCellId="0" sqref="A1"/></sheetView></sheetViews><sheetFormatPr defaultRowHeight="12.85"/><sheetData><row r="1" spans="1:2" ht="0" customHeight="true"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row></sheetData></worksheet>`
 		c.Assert(buf.String(), qt.Equals, expectedXLSXSheet)
 	})
 	csRunO(c, "TestSetRowHeightCM", func(c *qt.C, option FileOption) {
@@ -721,7 +724,8 @@ func TestMakeXLSXSheet(t *testing.T) {
 		refTable := NewSharedStringRefTable()
 		styles := newXlsxStyleSheet(nil)
 
-		xSheet := sheet.makeXLSXSheet(refTable, styles, nil)
+		xSheet, err := sheet.makeXLSXSheet(refTable, styles, nil)
+		c.Assert(err, qt.IsNil)
 		// err := sheet.MarshalSheet(&buf, refTable, styles, nil)
 		// c.Assert(err, qt.Equals, nil)
 		// var xSheet xlsxWorksheet
@@ -737,6 +741,247 @@ func TestMakeXLSXSheet(t *testing.T) {
 		c.Assert(xSheet.SheetData.Row[1].OutlineLevel, qt.Equals, uint8(2))
 		c.Assert(xSheet.SheetData.Row[2].OutlineLevel, qt.Equals, uint8(0))
 	})
+
+	csRunO(c, "ColOutline", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("A1")
+		c.Assert(sheet.SetColOutlineLevel(2, 4, 1), qt.IsNil)
+		c.Assert(sheet.SetColOutlineLevel(3, 3, 2), qt.IsNil)
+		c.Assert(sheet.SetColOutlineLevel(1, 1, 8), qt.ErrorMatches, `SetColOutlineLevel: the outline level 8 is deeper than 7`)
+		sheet.SetOutlineSummaryRight(false)
+		c.Assert(sheet.OutlineSummaryRight(), qt.IsFalse)
+		c.Assert(sheet.OutlineSummaryBelow(), qt.IsTrue)
+		// With the summary column left of the group, that is the one
+		// that is marked collapsed.
+		sheet.SetColCollapsed(2, 4, true)
+
+		parts, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				written = string(body)
+			}
+			return name, body
+		})
+		for _, sheetXML := range []string{parts["xl/worksheets/sheet1.xml"], written} {
+			c.Assert(sheetXML, qt.Matches, `(?s).*<sheetPr[^>]*><outlinePr summaryRight="(false|0)".*`)
+			c.Assert(sheetXML, qt.Contains, `outlineLevelCol="2"`)
+			c.Assert(sheetXML, qt.Matches, `(?s).*<col collapsed="(true|1)" max="1" min="1".*`)
+			c.Assert(sheetXML, qt.Matches, `(?s).*<col hidden="(true|1)" max="3" min="3" style="0" outlineLevel="2"/?>.*`)
+			c.Assert(sheetXML, qt.Not(qt.Matches), `(?s).*<col collapsed="(true|1)" max="5" min="5".*`)
+		}
+
+		file, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet = file.Sheets[0]
+		c.Assert(sheet.Col(0).IsCollapsed(), qt.IsTrue)
+		c.Assert(sheet.Col(1).GetOutlineLevel(), qt.Equals, uint8(1))
+		c.Assert(sheet.Col(2).GetOutlineLevel(), qt.Equals, uint8(2))
+		c.Assert(*sheet.Col(2).Hidden, qt.IsTrue)
+		c.Assert(sheet.OutlineSummaryRight(), qt.IsFalse)
+		c.Assert(sheet.SheetFormat.OutlineLevelCol, qt.Equals, uint8(2))
+
+		// Ungrouping the deepest level lowers outlineLevelCol.
+		c.Assert(sheet.SetColOutlineLevel(3, 3, 0), qt.IsNil)
+		parts, err = file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `outlineLevelCol="1"`)
+	})
+
+	csRunO(c, "RowGroups", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		// Rows 2 to 4 are a group, with row 3 in a group of its own,
+		// and row 5 sums them up.
+		for i, level := range []uint8{0, 1, 2, 1, 0} {
+			row := sheet.AddRow()
+			row.AddCell().SetInt(i)
+			row.SetOutlineLevel(level)
+		}
+		c.Assert(sheet.CollapseRowGroup(1), qt.IsNil)
+		c.Assert(sheet.CollapseRowGroup(8), qt.ErrorMatches, `CollapseRowGroup: the outline level 8 isn't from 1 to 7`)
+
+		parts, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				written = string(body)
+			}
+			return name, body
+		})
+		for _, sheetXML := range []string{parts["xl/worksheets/sheet1.xml"], written} {
+			c.Assert(sheetXML, qt.Not(qt.Matches), `(?s).*<row r="1"[^>]*hidden.*`)
+			c.Assert(sheetXML, qt.Matches, `(?s).*<row r="3"[^>]*hidden="(true|1)"[^>]*outlineLevel="2".*`)
+			c.Assert(sheetXML, qt.Matches, `(?s).*<row r="5"[^>]*collapsed="(true|1)".*`)
+			c.Assert(sheetXML, qt.Not(qt.Matches), `(?s).*<row r="5"[^>]*hidden.*`)
+		}
+
+		file, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet = file.Sheets[0]
+		var hidden, collapsed []bool
+		c.Assert(sheet.ForEachRow(func(r *Row) error {
+			hidden = append(hidden, r.Hidden)
+			collapsed = append(collapsed, r.IsCollapsed())
+			return nil
+		}), qt.IsNil)
+		c.Assert(hidden, qt.DeepEquals, []bool{false, true, true, true, false})
+		c.Assert(collapsed, qt.DeepEquals, []bool{false, false, false, false, true})
+
+		// Expanding the outer group expands the inner one too.
+		c.Assert(sheet.CollapseRowGroup(2), qt.IsNil)
+		c.Assert(sheet.ExpandRowGroup(1), qt.IsNil)
+		hidden, collapsed = nil, nil
+		c.Assert(sheet.ForEachRow(func(r *Row) error {
+			hidden = append(hidden, r.Hidden)
+			collapsed = append(collapsed, r.IsCollapsed())
+			return nil
+		}), qt.IsNil)
+		c.Assert(hidden, qt.DeepEquals, []bool{false, false, false, false, false})
+		c.Assert(collapsed, qt.DeepEquals, []bool{false, false, false, false, false})
+
+		// With the summary rows above, the row before a group is
+		// marked collapsed.
+		sheet.SetOutlineSummaryBelow(false)
+		c.Assert(sheet.CollapseRowGroup(2), qt.IsNil)
+		row, err := sheet.Row(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.IsCollapsed(), qt.IsTrue)
+		c.Assert(row.Hidden, qt.IsFalse)
+		row, err = sheet.Row(2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.Hidden, qt.IsTrue)
+	})
+
+	csRunO(c, "ColFidelity", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetString("A1")
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		// Column C is defined twice, in overlapping ranges, as
+		// some writers do.
+		b := rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				body = regexp.MustCompile(`(?s)<cols>.*</cols>`).ReplaceAll(body, nil)
+				body = bytes.Replace(body, []byte("<sheetData"), []byte(`<cols>`+
+					`<col min="2" max="5" width="0" hidden="1" customWidth="1"/>`+
+					`<col min="3" max="3" width="20" customWidth="1" bestFit="1"/>`+
+					`<col min="7" max="9" width="12.5" customWidth="1" outlineLevel="1"/>`+
+					`</cols><sheetData`), 1)
+			}
+			return name, body
+		})
+
+		file, err = OpenBinary(b, option)
+		c.Assert(err, qt.IsNil)
+		sheet = file.Sheets[0]
+		c.Assert(sheet.Col(1).IsHidden(), qt.IsTrue)
+		c.Assert(sheet.Col(2).IsHidden(), qt.IsFalse)
+		c.Assert(*sheet.Col(2).Width, qt.Equals, 20.0)
+		c.Assert(*sheet.Col(2).BestFit, qt.IsTrue)
+		c.Assert(sheet.Col(4).IsHidden(), qt.IsTrue)
+		c.Assert(sheet.Col(7).GetOutlineLevel(), qt.Equals, uint8(1))
+
+		// Showing column D and hiding it again splits it from
+		// column E, but as they are the same again they are
+		// written as one range.
+		sheet.SetColHidden(3, false)
+		sheet.SetColHidden(3, true)
+		c.Assert(sheet.SetColWidthRange(7, 8, 15), qt.IsNil)
+		c.Assert(sheet.SetColWidthRange(2, 1, 15), qt.ErrorMatches, `SetColWidthRange: invalid range of columns 2 to 1`)
+		c.Assert(sheet.SetColWidthRange(0, 0, 256), qt.ErrorMatches, `SetColWidthRange: the width 256 is not from 0 to 255`)
+
+		parts, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		buf.Reset()
+		c.Assert(file.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				written = string(body)
+			}
+			return name, body
+		})
+		for _, sheetXML := range []string{parts["xl/worksheets/sheet1.xml"], written} {
+			cols := regexp.MustCompile(`<col [^>]*>`).FindAllString(sheetXML, -1)
+			c.Assert(cols, qt.HasLen, 5)
+			c.Assert(cols[0], qt.Matches, `<col hidden="(true|1)" max="2" min="2" style="0" width="0" customWidth="(true|1)"/?>`)
+			c.Assert(cols[1], qt.Matches, `<col max="3" min="3" style="0" width="20" customWidth="(true|1)" bestFit="(true|1)"/?>`)
+			c.Assert(cols[2], qt.Matches, `<col hidden="(true|1)" max="5" min="4" style="0" width="0" customWidth="(true|1)"/?>`)
+			c.Assert(cols[3], qt.Matches, `<col max="7" min="7" style="0" width="12.5" customWidth="(true|1)" outlineLevel="1"/?>`)
+			c.Assert(cols[4], qt.Matches, `<col max="9" min="8" style="0" width="15" customWidth="(true|1)" outlineLevel="1"/?>`)
+		}
+
+		file, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet = file.Sheets[0]
+		c.Assert(sheet.Col(3).IsHidden(), qt.IsTrue)
+		c.Assert(*sheet.Col(3).Width, qt.Equals, 0.0)
+		c.Assert(*sheet.Col(8).Width, qt.Equals, 15.0)
+	})
+
+	csRunO(c, "DefaultSizes", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.DefaultRowHeight(), qt.Equals, 12.85)
+		c.Assert(sheet.DefaultColWidth(), qt.Equals, ColWidth)
+		sheet.SetDefaultRowHeight(20)
+		sheet.SetDefaultColWidth(14.5)
+		sheet.SetColWidth(2, 2, 30)
+		sheet.AddRow().AddCell().SetString("A1")
+		row := sheet.AddRow()
+		row.AddCell().SetString("A2")
+		row.SetHeight(40)
+
+		parts, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		var buf bytes.Buffer
+		c.Assert(file.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				written = string(body)
+			}
+			return name, body
+		})
+		for _, sheetXML := range []string{parts["xl/worksheets/sheet1.xml"], written} {
+			c.Assert(sheetXML, qt.Matches, `(?s).*<sheetFormatPr defaultColWidth="14.5" defaultRowHeight="20" customHeight="(true|1)"[ />].*`)
+			c.Assert(sheetXML, qt.Not(qt.Matches), `(?s).*<row r="1"[^>]* ht=.*`)
+		}
+
+		file, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet = file.Sheets[0]
+		c.Assert(sheet.DefaultRowHeight(), qt.Equals, 20.0)
+		c.Assert(sheet.SheetFormat.CustomHeight, qt.IsTrue)
+		c.Assert(sheet.DefaultColWidth(), qt.Equals, 14.5)
+		// Rows and columns without a size of their own have the
+		// default one of the sheet.
+		row, err = sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.GetHeight(), qt.Equals, 20.0)
+		row, err = sheet.Row(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(row.GetHeight(), qt.Equals, 40.0)
+		c.Assert(sheet.ColWidth(0), qt.Equals, 14.5)
+		c.Assert(sheet.ColWidth(1), qt.Equals, 30.0)
+	})
 }
 
 func TestTemp(t *testing.T) {
@@ -762,7 +1007,7 @@ func TestTemp(t *testing.T) {
 	c.Assert(len(xSheet.SheetData.Row), qt.Equals, 1)
 	xRow := xSheet.SheetData.Row[0]
 	c.Assert(xRow.R, qt.Equals, 1)
-	c.Assert(xRow.Spans, qt.Equals, "")
+	c.Assert(xRow.Spans, qt.Equals, "1:1")
 	c.Assert(len(xRow.C), qt.Equals, 1)
 	xC := xRow.C[0]
 	c.Assert(xC.R, qt.Equals, "A1")
@@ -778,3 +1023,491 @@ func TestTemp(t *testing.T) {
 	c.Assert(xSI.R, qt.HasLen, 0)
 
 }
+
+func TestSetSharedFormula(t *testing.T) {
+	c := qt.New(t)
+
+	// sheetXML returns the worksheet part written for the File through
+	// both of the ways of writing one.
+	sheetXML := func(c *qt.C, f *File) []string {
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var written string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				written = string(body)
+			}
+			return name, body
+		})
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		return []string{written, parts["xl/worksheets/sheet1.xml"]}
+	}
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("SharedFormulaRoundTrip")
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.SetSharedFormula("C1:C3", "A1*$B$1"), qt.IsNil)
+		for row, expected := range []string{"A1*$B$1", "A2*$B$1", "A3*$B$1"} {
+			cell, err := sheet.Cell(row, 2)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.Formula(), qt.Equals, expected)
+		}
+
+		for _, written := range sheetXML(c, f) {
+			c.Assert(written, qt.Contains, `<c r="C1"><f t="shared" ref="C1:C3" si="0">A1*$B$1</f></c>`)
+			c.Assert(written, qt.Contains, `<c r="C2"><f t="shared" si="0"></f></c>`)
+			c.Assert(written, qt.Contains, `<c r="C3"><f t="shared" si="0"></f></c>`)
+		}
+
+		// The sheet is closed before the file is read back, as the
+		// cells that the disk and Redis stores keep under its name
+		// would otherwise be shared with those read.
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		sheet.Close()
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		cell, err := f.Sheets[0].Cell(2, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Formula(), qt.Equals, "A3*$B$1")
+	})
+
+	csRunO(c, "ChangedCells", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("SharedFormulaChanged")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		c.Assert(sheet.SetSharedFormula("A2:B2", "A1+1"), qt.IsNil)
+		c.Assert(sheet.SetSharedFormula("A3:B3", "SUM(A1:A2)"), qt.IsNil)
+		cell, err := sheet.Cell(1, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Formula(), qt.Equals, "B1+1")
+		cell.SetFormula("B1*2")
+		cell, err = sheet.Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetFormula("0")
+
+		for _, written := range sheetXML(c, f) {
+			c.Assert(written, qt.Contains, `<c r="A2"><f t="shared" ref="A2:B2" si="0">A1+1</f></c>`)
+			c.Assert(written, qt.Contains, `<c r="B2"><f>B1*2</f></c>`)
+			// Without its first cell, the other cells of a range
+			// have their own formulas.
+			c.Assert(written, qt.Contains, `<c r="A3"><f>0</f></c>`)
+			c.Assert(written, qt.Contains, `<c r="B3"><f>SUM(B1:B2)</f></c>`)
+		}
+	})
+
+	c.Run("Errors", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("SharedFormula")
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.SetSharedFormula("A1:A2", ""), qt.ErrorMatches, "Sheet.SetSharedFormula: the formula is empty")
+		c.Assert(sheet.SetSharedFormula("A0", "A1"), qt.ErrorMatches, `Sheet.SetSharedFormula: Sheet.Range\("A0"\): .*`)
+	})
+}
+
+func TestInsertAndRemoveCol(t *testing.T) {
+	c := qt.New(t)
+
+	// values returns the values of the cells of the first row of sheet.
+	values := func(c *qt.C, sheet *Sheet) []string {
+		row, err := sheet.Row(0)
+		c.Assert(err, qt.IsNil)
+		var vals []string
+		c.Assert(row.ForEachCell(func(cell *Cell) error {
+			vals = append(vals, cell.Value)
+			return nil
+		}), qt.IsNil)
+		return vals
+	}
+
+	makeSheet := func(c *qt.C, option FileOption) (*File, *Sheet) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("MovedCols")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		for i, v := range []string{"a", "b", "c", "d"} {
+			cell, err := sheet.Cell(0, i)
+			c.Assert(err, qt.IsNil)
+			cell.SetString(v)
+		}
+		cell, err := sheet.Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		cell.Merge(1, 1)
+		cell, err = sheet.Cell(0, 3)
+		c.Assert(err, qt.IsNil)
+		cell.SetComment("Author", "On d")
+		cell, err = sheet.Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetHyperlink("http://example.com", "link", "")
+		cell.Hyperlink.HSpan = 2
+		sheet.SetColWidth(2, 2, 20)
+		sheet.SetColWidth(4, 6, 30)
+		dv := NewDataValidation(0, 1, 0, 3, true)
+		c.Assert(dv.AddRange("C4"), qt.IsNil)
+		sheet.AddDataValidation(dv)
+		sheet.AutoFilter = &AutoFilter{TopLeftCell: "A1", BottomRightCell: "D3"}
+		return file, sheet
+	}
+
+	csRunO(c, "InsertColAt", func(c *qt.C, option FileOption) {
+		file, sheet := makeSheet(c, option)
+		c.Assert(sheet.InsertColAt(1), qt.IsNil)
+		c.Assert(sheet.InsertColAt(-1), qt.ErrorMatches, `InsertColAt: index out of range: -1`)
+		c.Assert(values(c, sheet), qt.DeepEquals, []string{"a", "", "b", "c", "d"})
+		cell, err := sheet.Cell(0, 2)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.HMerge, qt.Equals, 1)
+		c.Assert(cell.VMerge, qt.Equals, 1)
+		cell, err = sheet.Cell(0, 4)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Comment(), qt.Not(qt.IsNil))
+		// The hyperlink spans the new column.
+		cell, err = sheet.Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Hyperlink.HSpan, qt.Equals, 3)
+		c.Assert(sheet.ColWidth(1), qt.Equals, sheet.DefaultColWidth())
+		c.Assert(sheet.ColWidth(2), qt.Equals, 20.0)
+		c.Assert(sheet.ColWidth(4), qt.Equals, 30.0)
+		c.Assert(sheet.ColWidth(6), qt.Equals, 30.0)
+		c.Assert(sheet.ColWidth(7), qt.Equals, sheet.DefaultColWidth())
+		c.Assert(sheet.DataValidations[0].Sqref, qt.Equals, "C1:E1 D4")
+		c.Assert(*sheet.AutoFilter, qt.Equals, AutoFilter{TopLeftCell: "A1", BottomRightCell: "E3"})
+
+		parts, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `<mergeCell ref="C1:D2">`)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, `ref="A3:D3"`)
+		c.Assert(parts["xl/comments1.xml"], qt.Contains, `<comment ref="E1"`)
+	})
+
+	csRunO(c, "RemoveColAt", func(c *qt.C, option FileOption) {
+		file, sheet := makeSheet(c, option)
+		c.Assert(sheet.RemoveColAt(Excel2006MaxColCount), qt.ErrorMatches, `RemoveColAt: index out of range: 16384`)
+		// The merge, and the hyperlink, start in the next column.
+		c.Assert(sheet.RemoveColAt(1), qt.IsNil)
+		c.Assert(values(c, sheet), qt.DeepEquals, []string{"a", "c", "d"})
+		cell, err := sheet.Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.HMerge, qt.Equals, 0)
+		c.Assert(cell.VMerge, qt.Equals, 1)
+		cell, err = sheet.Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Hyperlink.HSpan, qt.Equals, 1)
+		// Column B is removed with its width.
+		c.Assert(sheet.ColWidth(1), qt.Equals, sheet.DefaultColWidth())
+		c.Assert(sheet.ColWidth(2), qt.Equals, 30.0)
+		c.Assert(sheet.ColWidth(4), qt.Equals, 30.0)
+		c.Assert(sheet.ColWidth(5), qt.Equals, sheet.DefaultColWidth())
+		c.Assert(sheet.DataValidations[0].Sqref, qt.Equals, "B1:C1 B4")
+
+		// Removing the only column of a validation removes it.
+		c.Assert(sheet.RemoveColAt(0), qt.IsNil)
+		c.Assert(sheet.RemoveColAt(0), qt.IsNil)
+		c.Assert(sheet.RemoveColAt(0), qt.IsNil)
+		c.Assert(sheet.DataValidations, qt.HasLen, 0)
+		c.Assert(sheet.AutoFilter, qt.IsNil)
+
+		parts, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Not(qt.Contains), `<mergeCell `)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Not(qt.Contains), `<hyperlink `)
+	})
+}
+
+func TestRemoveRowAt(t *testing.T) {
+	c := qt.New(t)
+	csRunO(c, "References", func(c *qt.C, option FileOption) {
+		file := NewFile(option)
+		sheet, err := file.AddSheet("RemovedRows")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		for i := 0; i < 6; i++ {
+			sheet.AddRow().AddCell().SetInt(i)
+		}
+		// A1:B3 spans the removed row, and C3:C5 starts in it.
+		cell, err := sheet.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.Merge(1, 2)
+		cell, err = sheet.Cell(2, 2)
+		c.Assert(err, qt.IsNil)
+		cell.Merge(0, 2)
+		cell, err = sheet.Cell(1, 3)
+		c.Assert(err, qt.IsNil)
+		cell.SetHyperlink("http://example.com", "link", "")
+		cell.Hyperlink.VSpan = 3
+		sheet.AddDataValidation(NewDataValidation(1, 4, 4, 4, true))
+		sheet.AddDataValidation(NewDataValidation(2, 5, 2, 5, true))
+		sheet.AutoFilter = &AutoFilter{TopLeftCell: "A1", BottomRightCell: "F6"}
+
+		c.Assert(sheet.RemoveRowAt(2), qt.IsNil)
+		c.Assert(sheet.RemoveRowAt(5), qt.ErrorMatches, `Cannot remove row: index out of range: 5`)
+		c.Assert(sheet.MaxRow, qt.Equals, 5)
+		var values []string
+		c.Assert(sheet.ForEachRow(func(r *Row) error {
+			values = append(values, r.GetCell(0).Value)
+			return nil
+		}), qt.IsNil)
+		c.Assert(values, qt.DeepEquals, []string{"0", "1", "3", "4", "5"})
+		c.Assert(sheet.DataValidations, qt.HasLen, 1)
+		c.Assert(sheet.DataValidations[0].Sqref, qt.Equals, "E2:E4")
+		c.Assert(*sheet.AutoFilter, qt.Equals, AutoFilter{TopLeftCell: "A1", BottomRightCell: "F5"})
+
+		parts, err := file.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		sheetXML := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(sheetXML, qt.Contains, `<mergeCell ref="A1:B2">`)
+		c.Assert(sheetXML, qt.Contains, `<mergeCell ref="C3:C4">`)
+		c.Assert(sheetXML, qt.Contains, `ref="D2:D4"`)
+	})
+}
+
+// failingCellStore is a CellStore whose ReadRow fails for the row with
+// readKey, and whose MoveRow fails once moveErr is set.
+type failingCellStore struct {
+	CellStore
+	readKey string
+	moveErr error
+}
+
+func (cs *failingCellStore) ReadRow(key string, s *Sheet) (*Row, error) {
+	if key == cs.readKey {
+		return nil, errors.New("can't read " + key)
+	}
+	return cs.CellStore.ReadRow(key, s)
+}
+
+func (cs *failingCellStore) MoveRow(r *Row, newIndex int) error {
+	if cs.moveErr != nil {
+		return cs.moveErr
+	}
+	return cs.CellStore.MoveRow(r, newIndex)
+}
+
+func TestRemoveRowAtCellStoreErrors(t *testing.T) {
+	c := qt.New(t)
+	var store *failingCellStore
+	newSheet := func(c *qt.C) *Sheet {
+		sheet, err := NewSheetWithCellStore("Failing", func() (CellStore, error) {
+			cs, err := NewMemoryCellStore()
+			store = &failingCellStore{CellStore: cs}
+			return store, err
+		})
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		for i := 0; i < 4; i++ {
+			sheet.AddRow().AddCell().SetInt(i)
+		}
+		return sheet
+	}
+
+	c.Run("ReadRow", func(c *qt.C) {
+		for _, y := range []int{0, 1, 3} {
+			sheet := newSheet(c)
+			store.readKey = makeRowKey(sheet, y)
+			c.Assert(sheet.RemoveRowAt(1), qt.ErrorMatches, `can't read .*`)
+		}
+	})
+
+	c.Run("MoveRow", func(c *qt.C) {
+		sheet := newSheet(c)
+		store.moveErr = errors.New("can't move")
+		c.Assert(sheet.RemoveRowAt(1), qt.ErrorMatches, `can't move`)
+	})
+}
+
+func TestRowIterator(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "Iterate", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Iterated")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		for i := 0; i < 6; i++ {
+			row := sheet.AddRow()
+			if i == 3 {
+				continue
+			}
+			row.AddCell().SetInt(i)
+		}
+		row, err := sheet.Row(4)
+		c.Assert(err, qt.IsNil)
+		row.Hidden = true
+
+		values := func(options ...RowVisitorOption) []int {
+			var got []int
+			it := sheet.RowIterator(options...)
+			for {
+				r, err := it.Next()
+				if err == io.EOF {
+					break
+				}
+				c.Assert(err, qt.IsNil)
+				v := -1
+				if r.cellStoreRow.CellCount() > 0 {
+					v, err = r.GetCell(0).Int()
+					c.Assert(err, qt.IsNil)
+				}
+				got = append(got, v)
+			}
+			return got
+		}
+		c.Assert(values(), qt.DeepEquals, []int{0, 1, 2, -1, 4, 5})
+		c.Assert(values(SkipEmptyRows), qt.DeepEquals, []int{0, 1, 2, 4, 5})
+		c.Assert(values(SkipHiddenRows, SkipEmptyRows), qt.DeepEquals, []int{0, 1, 2, 5})
+		c.Assert(values(RowWindow(1, 4)), qt.DeepEquals, []int{1, 2, -1})
+		c.Assert(values(RowWindow(4, 0)), qt.DeepEquals, []int{4, 5})
+		c.Assert(values(RowWindow(2, 100), SkipEmptyRows), qt.DeepEquals, []int{2, 4, 5})
+		c.Assert(values(FromRow(1), ToRow(3), SkipEmptyRows), qt.DeepEquals, []int{1, 2})
+		c.Assert(values(FromRow(-2), ToRow(0)), qt.DeepEquals, []int{0})
+		c.Assert(values(FromRow(5), ToRow(50)), qt.DeepEquals, []int{5})
+		c.Assert(values(ToRow(-4)), qt.HasLen, 0)
+
+		var visited []int
+		c.Assert(sheet.ForEachRow(func(r *Row) error {
+			visited = append(visited, r.GetCoordinate())
+			return nil
+		}, FromRow(2), ToRow(4)), qt.IsNil)
+		c.Assert(visited, qt.DeepEquals, []int{2, 3, 4})
+
+		// Stopping early; a change to the last Row returned is kept
+		// once the iterator is closed.
+		it := sheet.RowIterator()
+		for {
+			r, err := it.Next()
+			c.Assert(err, qt.IsNil)
+			if r.GetCoordinate() == 1 {
+				r.GetCell(0).SetInt(10)
+				break
+			}
+		}
+		it.Close()
+		r, err := it.Next()
+		c.Assert(r, qt.IsNil)
+		c.Assert(err, qt.Equals, io.EOF)
+		c.Assert(values(RowWindow(0, 2)), qt.DeepEquals, []int{0, 10})
+	})
+}
+
+func TestLastRow(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "LastRow", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Trailing")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		r, err := sheet.LastRow()
+		c.Assert(err, qt.IsNil)
+		c.Assert(r, qt.IsNil)
+
+		for i := 0; i < 5; i++ {
+			sheet.AddRow().AddCell().SetInt(i)
+		}
+		lastValue := func() int {
+			r, err := sheet.LastRow()
+			c.Assert(err, qt.IsNil)
+			c.Assert(r, qt.Not(qt.IsNil))
+			v, err := r.GetCell(0).Int()
+			c.Assert(err, qt.IsNil)
+			return v
+		}
+		c.Assert(lastValue(), qt.Equals, 4)
+
+		// Appending after the last row.
+		sheet.AddRow().AddCell().SetInt(5)
+		c.Assert(lastValue(), qt.Equals, 5)
+
+		c.Assert(sheet.RemoveRowAt(sheet.MaxRow-1), qt.IsNil)
+		c.Assert(sheet.MaxRow, qt.Equals, 5)
+		c.Assert(lastValue(), qt.Equals, 4)
+
+		// Empty rows at the end aren't populated.
+		sheet.AddRow()
+		sheet.AddRow()
+		c.Assert(lastValue(), qt.Equals, 4)
+
+		// Reading the trailing rows from the bottom.
+		var got []int
+		c.Assert(sheet.ForEachRow(func(r *Row) error {
+			v, err := r.GetCell(0).Int()
+			c.Assert(err, qt.IsNil)
+			got = append(got, v)
+			if len(got) == 3 {
+				return io.EOF
+			}
+			return nil
+		}, Reverse, SkipEmptyRows), qt.Equals, io.EOF)
+		c.Assert(got, qt.DeepEquals, []int{4, 3, 2})
+
+		got = nil
+		c.Assert(sheet.ForEachRow(func(r *Row) error {
+			got = append(got, r.GetCoordinate())
+			return nil
+		}, Reverse, FromRow(1), ToRow(3)), qt.IsNil)
+		c.Assert(got, qt.DeepEquals, []int{3, 2, 1})
+	})
+}
+
+func TestSparseRows(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "BlankCellsAndSpans", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sparse")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		row := sheet.AddRow()
+		for i := 0; i < 10; i++ {
+			row.AddCell().SetString("")
+		}
+		row.GetCell(2).SetInt(2)
+		row.GetCell(7).SetString("seven")
+		cleared := row.GetCell(4)
+		cleared.SetString("gone")
+		cleared.Clear()
+		// A cell with nothing but a style is kept.
+		styled := row.GetCell(8)
+		styled.SetStyle(NewStyle())
+		styled.GetStyle().Font.Bold = true
+		// A row of blank cells isn't written at all.
+		row = sheet.AddRow()
+		row.AddCell().SetString("")
+		sheet.AddRow().AddCell().SetInt(1)
+
+		check := func(sheetXML string) {
+			c.Assert(sheetXML, qt.Matches, `(?s).*<row r="1" spans="3:9"><c r="C1"><v>2</v></c><c r="H1" t="s"><v>0</v></c><c r="I1" s="1"(/>|></c>)</row>.*`)
+			c.Assert(sheetXML, qt.Not(qt.Contains), `<row r="2"`)
+			c.Assert(sheetXML, qt.Contains, `<row r="3" spans="1:1">`)
+		}
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		check(parts["xl/worksheets/sheet1.xml"])
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				check(string(body))
+			}
+			return name, body
+		})
+
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet = f.Sheet["Sparse"]
+		c.Cleanup(sheet.Close)
+		cell, err := sheet.Cell(0, 7)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "seven")
+		cell, err = sheet.Cell(0, 8)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.GetStyle().Font.Bold, qt.IsTrue)
+		cell, err = sheet.Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "1")
+	})
+}
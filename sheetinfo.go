@@ -0,0 +1,186 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// SheetInfo describes a sheet in a workbook, without its contents.
+type SheetInfo struct {
+	// Name is the name of the sheet.
+	Name string
+	// Index is the position of the sheet in File.Sheets, were the
+	// workbook to be opened.
+	Index int
+	// State is the visibility of the sheet: "visible", "hidden" or
+	// "veryHidden".
+	State string
+	// Dimension is the range of cells that the sheet claims to use,
+	// for example "A1:F200".  It is empty if the sheet doesn't say.
+	Dimension string
+	// MaxRow and MaxCol are the number of rows and columns covered by
+	// Dimension.  They are taken from the file as is and, like
+	// Dimension, are only as accurate as the application that wrote
+	// it.  Both are zero if the sheet has no dimension.
+	MaxRow int
+	MaxCol int
+}
+
+// ReadSheetInfo returns a SheetInfo for each worksheet in the XLSX file
+// at path.  Only the workbook, its relationships and the start of each
+// worksheet are read, so this is much cheaper than OpenFile when all
+// you need is the list of sheets.
+func ReadSheetInfo(path string) ([]SheetInfo, error) {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("ReadSheetInfo: %w", err)
+	}
+	defer z.Close()
+	infos, err := readSheetInfo(&z.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("ReadSheetInfo: %w", err)
+	}
+	return infos, nil
+}
+
+// ReadSheetInfoFromReaderAt is ReadSheetInfo for an XLSX file that is
+// read from an io.ReaderAt.
+func ReadSheetInfoFromReaderAt(r io.ReaderAt, size int64) ([]SheetInfo, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("ReadSheetInfoFromReaderAt: %w", err)
+	}
+	infos, err := readSheetInfo(z)
+	if err != nil {
+		return nil, fmt.Errorf("ReadSheetInfoFromReaderAt: %w", err)
+	}
+	return infos, nil
+}
+
+func readSheetInfo(r *zip.Reader) ([]SheetInfo, error) {
+	var workbook, workbookRels *zip.File
+	parts := make(map[string]*zip.File, len(r.File))
+	worksheets := make(map[string]*zip.File)
+	for _, v := range r.File {
+		name := normalisePartName(v.Name)
+		parts[name] = v
+		dir, base := path.Split(name)
+		switch {
+		case base == "workbook.xml":
+			workbook = v
+		case base == "workbook.xml.rels":
+			workbookRels = v
+		case dir == "xl/worksheets/" && strings.HasSuffix(base, ".xml"):
+			worksheets[worksheetNameFromTarget(base)] = v
+		}
+	}
+	if workbook == nil {
+		return nil, fmt.Errorf("workbook.xml not found in input xlsx")
+	}
+	if workbookRels == nil {
+		return nil, fmt.Errorf("workbook.xml.rels not found in input xlsx")
+	}
+	sheetXMLMap, relationships, err := readWorkbookRelationsFromZipFile(workbookRels)
+	if err != nil {
+		return nil, err
+	}
+	resolveWorkbookParts(parts, relationships, worksheets, nil)
+
+	rc, err := workbook.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	xWorkbook := new(xlsxWorkbook)
+	if err = xml.NewDecoder(rc).Decode(xWorkbook); err != nil {
+		return nil, err
+	}
+
+	var infos []SheetInfo
+	for _, sheet := range xWorkbook.Sheets.Sheet {
+		// Skip chartsheets, just as reading the whole file does.
+		f := worksheetFileForSheet(sheet, worksheets, sheetXMLMap)
+		if f == nil {
+			continue
+		}
+		info := SheetInfo{
+			Name:  sheet.Name,
+			Index: len(infos),
+			State: sheet.State,
+		}
+		if info.State == "" {
+			info.State = sheetStateVisible
+		}
+		info.Dimension, err = readWorksheetDimension(f)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %q: %w", sheet.Name, err)
+		}
+		if info.Dimension != "" {
+			info.MaxRow, info.MaxCol = dimensionSize(info.Dimension)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// dimensionScanHook, when set, is called with the name of every
+// element that readWorksheetDimension reads.
+var dimensionScanHook func(name string)
+
+// readWorksheetDimension returns the ref of a worksheet's dimension
+// element.  The dimension precedes sheetData, so the worksheet is read
+// token by token and reading stops before any cell data is reached.
+func readWorksheetDimension(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	decoder := xml.NewDecoder(rc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if dimensionScanHook != nil {
+			dimensionScanHook(start.Name.Local)
+		}
+		switch start.Name.Local {
+		case "dimension":
+			for _, attr := range start.Attr {
+				if attr.Name.Local == "ref" {
+					return attr.Value, nil
+				}
+			}
+			return "", nil
+		case "sheetData":
+			return "", nil
+		}
+	}
+}
+
+// dimensionSize returns the number of rows and columns that the
+// dimension ref extends to, or zero if it can't be understood.
+func dimensionSize(ref string) (rows, cols int) {
+	last := ref
+	if i := strings.LastIndexByte(ref, ':'); i >= 0 {
+		last = ref[i+1:]
+	}
+	x, y, err := GetCoordsFromCellIDString(last)
+	if err != nil || x < 0 || y < 0 {
+		return 0, 0
+	}
+	return y + 1, x + 1
+}
@@ -0,0 +1,103 @@
+package xlsx
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestReadSheetInfo(t *testing.T) {
+	c := qt.New(t)
+
+	f := NewFile()
+	first, err := f.AddSheet("First")
+	c.Assert(err, qt.IsNil)
+	for i := 0; i < 3; i++ {
+		row := first.AddRow()
+		row.AddCell().SetInt(i)
+		row.AddCell().SetString("x")
+	}
+	hidden, err := f.AddSheet("Hidden")
+	c.Assert(err, qt.IsNil)
+	hidden.Hidden = true
+	hidden.AddRow().AddCell().SetString("secret")
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), qt.IsNil)
+	data := buf.Bytes()
+
+	expected := []SheetInfo{
+		{Name: "First", Index: 0, State: "visible", Dimension: "A1:B3", MaxRow: 3, MaxCol: 2},
+		{Name: "Hidden", Index: 1, State: "hidden", Dimension: "A1", MaxRow: 1, MaxCol: 1},
+	}
+
+	c.Run("ReaderAt", func(c *qt.C) {
+		var seen []string
+		dimensionScanHook = func(name string) { seen = append(seen, name) }
+		defer func() { dimensionScanHook = nil }()
+
+		infos, err := ReadSheetInfoFromReaderAt(bytes.NewReader(data), int64(len(data)))
+		c.Assert(err, qt.IsNil)
+		c.Assert(infos, qt.DeepEquals, expected)
+		for _, name := range seen {
+			c.Assert(name, qt.Not(qt.Equals), "sheetData")
+			c.Assert(name, qt.Not(qt.Equals), "row")
+			c.Assert(name, qt.Not(qt.Equals), "c")
+		}
+	})
+
+	c.Run("Path", func(c *qt.C) {
+		path := filepath.Join(c.Mkdir(), "info.xlsx")
+		c.Assert(f.Save(path), qt.IsNil)
+		infos, err := ReadSheetInfo(path)
+		c.Assert(err, qt.IsNil)
+		c.Assert(infos, qt.DeepEquals, expected)
+	})
+
+	c.Run("SheetDataIsNotRead", func(c *qt.C) {
+		// Anything after the start of sheetData is garbage, which
+		// would fail to parse if it were read.
+		broken := rewriteXLSX(c, data, func(name string, body []byte) (string, []byte) {
+			if strings.HasPrefix(name, "xl/worksheets/sheet") {
+				s := string(body)
+				body = []byte(s[:strings.Index(s, "<sheetData>")+len("<sheetData>")] + "<<<not xml")
+			}
+			return name, body
+		})
+		infos, err := ReadSheetInfoFromReaderAt(bytes.NewReader(broken), int64(len(broken)))
+		c.Assert(err, qt.IsNil)
+		c.Assert(infos, qt.DeepEquals, expected)
+	})
+
+	c.Run("NoDimension", func(c *qt.C) {
+		stripped := rewriteXLSX(c, data, func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				body = regexp.MustCompile(`<dimension[^>]*>(</dimension>)?`).ReplaceAll(body, nil)
+			}
+			return name, body
+		})
+		infos, err := ReadSheetInfoFromReaderAt(bytes.NewReader(stripped), int64(len(stripped)))
+		c.Assert(err, qt.IsNil)
+		c.Assert(infos[0], qt.DeepEquals, SheetInfo{Name: "First", Index: 0, State: "visible"})
+	})
+
+	c.Run("MatchesOpenFile", func(c *qt.C) {
+		infos, err := ReadSheetInfo("./testdocs/testfile.xlsx")
+		c.Assert(err, qt.IsNil)
+		f, err := OpenFile("./testdocs/testfile.xlsx")
+		c.Assert(err, qt.IsNil)
+		c.Assert(infos, qt.HasLen, len(f.Sheets))
+		for i, sheet := range f.Sheets {
+			c.Assert(infos[i].Name, qt.Equals, sheet.Name)
+			c.Assert(infos[i].Index, qt.Equals, i)
+		}
+	})
+
+	c.Run("NotAnXLSX", func(c *qt.C) {
+		_, err := ReadSheetInfo("./testdocs/does-not-exist.xlsx")
+		c.Assert(err, qt.ErrorMatches, "ReadSheetInfo: .*")
+	})
+}
@@ -0,0 +1,215 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// keepSheetViews returns the parts of the sheetView elements read from
+// a file that should be written back out.  Attributes from other
+// namespaces are dropped, because their prefixes aren't known.
+func keepSheetViews(views []xlsxSheetView) []xlsxSheetView {
+	var kept []xlsxSheetView
+	for _, view := range views {
+		attrs := view.Attrs
+		view.Attrs = nil
+		for _, attr := range attrs {
+			if attr.Name.Space == "" {
+				view.Attrs = append(view.Attrs, attr)
+			}
+		}
+		kept = append(kept, view)
+	}
+	return kept
+}
+
+// cloneSheetViews returns a copy of views that shares nothing with it.
+func cloneSheetViews(views []xlsxSheetView) []xlsxSheetView {
+	var cloned []xlsxSheetView
+	for _, view := range views {
+		view.Attrs = append([]xml.Attr(nil), view.Attrs...)
+		view.Selection = append([]xlsxSelection(nil), view.Selection...)
+		if view.Pane != nil {
+			pane := *view.Pane
+			view.Pane = &pane
+		}
+		cloned = append(cloned, view)
+	}
+	return cloned
+}
+
+// sheetView returns the first view of the Sheet, which its view
+// options apply to, adding it if the Sheet has none.
+func (s *Sheet) sheetView() *xlsxSheetView {
+	if len(s.sheetViews) == 0 {
+		s.sheetViews = []xlsxSheetView{newXlsxSheetView()}
+	}
+	return &s.sheetViews[0]
+}
+
+// firstSheetView returns a copy of the first view of the Sheet, or the
+// one that a new Sheet is written with if it has none.
+func (s *Sheet) firstSheetView() xlsxSheetView {
+	if len(s.sheetViews) == 0 {
+		return newXlsxSheetView()
+	}
+	return s.sheetViews[0]
+}
+
+// SetShowGridLines sets whether the grid lines between cells are shown
+// when the Sheet is viewed.  Whether they are printed is set by
+// SetPrintGridLines.
+func (s *Sheet) SetShowGridLines(show bool) {
+	s.sheetView().ShowGridLines = show
+}
+
+// ShowGridLines returns whether the grid lines between cells are shown
+// when the Sheet is viewed.
+func (s *Sheet) ShowGridLines() bool {
+	return s.firstSheetView().ShowGridLines
+}
+
+// SetShowRowColHeaders sets whether the row numbers and column letters
+// are shown when the Sheet is viewed.
+func (s *Sheet) SetShowRowColHeaders(show bool) {
+	s.sheetView().ShowRowColHeaders = show
+}
+
+// ShowRowColHeaders returns whether the row numbers and column letters
+// are shown when the Sheet is viewed.
+func (s *Sheet) ShowRowColHeaders() bool {
+	return s.firstSheetView().ShowRowColHeaders
+}
+
+// SetZoomScale sets the percentage that the Sheet is viewed at, from 10
+// to 400.
+func (s *Sheet) SetZoomScale(percent int) error {
+	if percent < 10 || percent > 400 {
+		return fmt.Errorf("SetZoomScale: zoom %d%% is not between 10%% and 400%%", percent)
+	}
+	view := s.sheetView()
+	view.ZoomScale = float64(percent)
+	// Excel keeps the zoom of each kind of view, and restores the
+	// one of the kind it shows the Sheet in.
+	switch view.View {
+	case "", "normal":
+		view.ZoomScaleNormal = float64(percent)
+	case "pageLayout":
+		view.ZoomScalePageLayoutView = float64(percent)
+	}
+	return nil
+}
+
+// ZoomScale returns the percentage that the Sheet is viewed at.
+func (s *Sheet) ZoomScale() int {
+	return int(s.firstSheetView().ZoomScale)
+}
+
+// SetRightToLeft sets whether the Sheet is viewed right to left, with
+// column A on the right.
+func (s *Sheet) SetRightToLeft(rightToLeft bool) {
+	s.sheetView().RightToLeft = rightToLeft
+}
+
+// RightToLeft returns whether the Sheet is viewed right to left.
+func (s *Sheet) RightToLeft() bool {
+	return s.firstSheetView().RightToLeft
+}
+
+// activePane returns the pane of the first view of the Sheet that has
+// the cursor, which is the top left one unless the view is split.
+func (s *Sheet) activePane() string {
+	if len(s.SheetViews) > 0 && s.SheetViews[0].Pane != nil && s.SheetViews[0].Pane.ActivePane != "" {
+		return s.SheetViews[0].Pane.ActivePane
+	}
+	return "topLeft"
+}
+
+// SetSelection sets the cells that are selected when the Sheet is
+// opened, and the active cell among them that has the cursor.  sqref
+// holds the references of the selected cells and ranges, separated by
+// spaces, such as "B2:C4 E2", and must include activeCell.  An empty
+// sqref selects activeCell alone.  The selection is made in the active
+// pane of the Sheet's first SheetView, so set that first.
+func (s *Sheet) SetSelection(activeCell string, sqref string) error {
+	col, row, err := GetCoordsFromCellIDString(activeCell)
+	if err != nil {
+		return fmt.Errorf("SetSelection: %w", err)
+	}
+	if sqref == "" {
+		sqref = activeCell
+	}
+	activeCellID := -1
+	for i, ref := range strings.Fields(sqref) {
+		r, err := parseRange(ref)
+		if err != nil {
+			return fmt.Errorf("SetSelection: %w", err)
+		}
+		if activeCellID < 0 && r.contains(col, row) {
+			activeCellID = i
+		}
+	}
+	if activeCellID < 0 {
+		return fmt.Errorf("SetSelection: active cell %s is not in the selection %q", activeCell, sqref)
+	}
+	s.sheetView().Selection = []xlsxSelection{{
+		Pane:         s.activePane(),
+		ActiveCell:   activeCell,
+		ActiveCellId: activeCellID,
+		SQRef:        sqref,
+	}}
+	return nil
+}
+
+// Selection returns the active cell and the selected cells of the
+// Sheet, as set by SetSelection or read from its file.
+func (s *Sheet) Selection() (activeCell string, sqref string) {
+	selections := s.firstSheetView().Selection
+	if len(selections) == 0 {
+		return "A1", "A1"
+	}
+	// A split view has a selection in each pane, of which the one in
+	// the active pane has the cursor.
+	selection := selections[0]
+	for _, sel := range selections {
+		pane := sel.Pane
+		if pane == "" {
+			pane = "topLeft"
+		}
+		if pane == s.activePane() {
+			selection = sel
+			break
+		}
+	}
+	return selection.ActiveCell, selection.SQRef
+}
+
+// makeSheetView sets the sheetView elements of the worksheet from the
+// views read with the Sheet or set by its view options, with the panes
+// of its SheetViews.
+func (s *Sheet) makeSheetView(worksheet *xlsxWorksheet) {
+	views := worksheet.SheetViews.SheetView
+	if len(s.sheetViews) > 0 {
+		views = append([]xlsxSheetView(nil), s.sheetViews...)
+	}
+	for len(views) < len(s.SheetViews) {
+		views = append(views, newXlsxSheetView())
+	}
+	for index := range views {
+		views[index].Pane = nil
+		if index >= len(s.SheetViews) || s.SheetViews[index].Pane == nil {
+			continue
+		}
+		pane := s.SheetViews[index].Pane
+		views[index].Pane = &xlsxPane{
+			XSplit:      pane.XSplit,
+			YSplit:      pane.YSplit,
+			TopLeftCell: pane.TopLeftCell,
+			ActivePane:  pane.ActivePane,
+			State:       pane.State,
+		}
+	}
+	views[0].TabSelected = s.Selected
+	worksheet.SheetViews.SheetView = views
+}
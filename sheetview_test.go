@@ -0,0 +1,146 @@
+package xlsx
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSheetViewOptions(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Defaults", func(c *qt.C) {
+		sheet, err := NewSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		c.Assert(sheet.ShowGridLines(), qt.IsTrue)
+		c.Assert(sheet.ShowRowColHeaders(), qt.IsTrue)
+		c.Assert(sheet.ZoomScale(), qt.Equals, 100)
+		c.Assert(sheet.RightToLeft(), qt.IsFalse)
+		c.Assert(sheet.PrintGridLines(), qt.IsFalse)
+		c.Assert(sheet.SetZoomScale(5), qt.Not(qt.IsNil))
+		c.Assert(sheet.SetZoomScale(401), qt.Not(qt.IsNil))
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("SheetView")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		sheet.AddRow().AddCell().SetString("header")
+		sheet.AddRow().AddCell().SetString("body")
+		sheet.SheetViews = []SheetView{{Pane: &Pane{
+			YSplit:      1,
+			TopLeftCell: "A2",
+			ActivePane:  "bottomLeft",
+			State:       "frozen",
+		}}}
+		sheet.SetShowGridLines(false)
+		sheet.SetShowRowColHeaders(false)
+		c.Assert(sheet.SetZoomScale(85), qt.IsNil)
+		sheet.SetRightToLeft(true)
+		sheet.SetPrintGridLines(true)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		xml := parts["xl/worksheets/sheet1.xml"]
+		c.Assert(xml, qt.Matches, `(?s).*<sheetView [^>]*showGridLines="false" showRowColHeaders="false" [^>]*rightToLeft="true" [^>]*zoomScale="85" zoomScaleNormal="85" [^>]*><pane xSplit="0" ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"`+".*")
+		c.Assert(xml, qt.Matches, `(?s).*<printOptions gridLines="true"`+".*")
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet2 := f2.Sheets[0]
+		c.Cleanup(sheet2.Close)
+		c.Assert(sheet2.ShowGridLines(), qt.IsFalse)
+		c.Assert(sheet2.ShowRowColHeaders(), qt.IsFalse)
+		c.Assert(sheet2.ZoomScale(), qt.Equals, 85)
+		c.Assert(sheet2.RightToLeft(), qt.IsTrue)
+		c.Assert(sheet2.PrintGridLines(), qt.IsTrue)
+		c.Assert(sheet2.SheetViews, qt.HasLen, 1)
+		c.Assert(sheet2.SheetViews[0].Pane, qt.Not(qt.IsNil))
+		c.Assert(sheet2.SheetViews[0].Pane.TopLeftCell, qt.Equals, "A2")
+	})
+
+	c.Run("KeepsUnknownAttributes", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell().SetString("read")
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		sheetView := regexp.MustCompile(`<sheetView [^>]*>`)
+		data := rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				// Only the attributes that aren't defaults, and two
+				// that aren't mapped.
+				body = sheetView.ReplaceAll(body, []byte(`<sheetView showZeros="0" showRuler="0" zoomScaleSheetLayoutView="90" workbookViewId="0">`))
+			}
+			return name, body
+		})
+		f2, err := OpenBinary(data)
+		c.Assert(err, qt.IsNil)
+		sheet2 := f2.Sheets[0]
+		c.Assert(sheet2.ShowGridLines(), qt.IsTrue)
+		c.Assert(sheet2.ZoomScale(), qt.Equals, 100)
+		c.Assert(sheet2.SetZoomScale(120), qt.IsNil)
+
+		parts, err := f2.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*<sheetView [^>]*showGridLines="true" [^>]*showZeros="false" [^>]*zoomScale="120" [^>]*showRuler="0" zoomScaleSheetLayoutView="90"`+".*")
+		buf.Reset()
+		c.Assert(f2.Write(&buf), qt.IsNil)
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				c.Assert(string(body), qt.Matches, `(?s).*<sheetView [^>]*showGridLines="true" [^>]*showZeros="false" [^>]*zoomScale="120" [^>]*showRuler="0" zoomScaleSheetLayoutView="90"`+".*")
+			}
+			return name, body
+		})
+	})
+}
+
+func TestSheetSelection(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Invalid", func(c *qt.C) {
+		sheet, err := NewSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		activeCell, sqref := sheet.Selection()
+		c.Assert(activeCell, qt.Equals, "A1")
+		c.Assert(sqref, qt.Equals, "A1")
+		c.Assert(sheet.SetSelection("not a cell", ""), qt.Not(qt.IsNil))
+		c.Assert(sheet.SetSelection("B2", "C3:D4"), qt.Not(qt.IsNil))
+		c.Assert(sheet.SetSelection("B2", "B2 C3:"), qt.Not(qt.IsNil))
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Selection")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		sheet.AddRow().AddCell().SetString("header")
+		sheet.SheetViews = []SheetView{{Pane: &Pane{
+			YSplit:      1,
+			TopLeftCell: "A2",
+			ActivePane:  "bottomLeft",
+			State:       "frozen",
+		}}}
+		c.Assert(sheet.SetSelection("C5", "A2:B3 C4:D6"), qt.IsNil)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*</pane><selection pane="bottomLeft" activeCell="C5" activeCellId="1" sqref="A2:B3 C4:D6"(/>|></selection>)</sheetView>.*`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		sheet2 := f2.Sheets[0]
+		c.Cleanup(sheet2.Close)
+		activeCell, sqref := sheet2.Selection()
+		c.Assert(activeCell, qt.Equals, "C5")
+		c.Assert(sqref, qt.Equals, "A2:B3 C4:D6")
+	})
+}
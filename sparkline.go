@@ -0,0 +1,398 @@
+package xlsx
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+const (
+	// sparklineExtURI identifies the extension of a worksheet that
+	// holds its sparkline groups.
+	sparklineExtURI = "{05C60535-1F16-4fd2-B633-F4F36F0B64E0}"
+	x14Namespace    = "http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"
+	xmNamespace     = "http://schemas.microsoft.com/office/excel/2006/main"
+)
+
+// SparklineType is the kind of the sparklines in a group.
+type SparklineType int
+
+const (
+	// SparklineLine draws each sparkline as a line.
+	SparklineLine SparklineType = iota
+	// SparklineColumn draws each sparkline as columns.
+	SparklineColumn
+	// SparklineWinLoss draws each sparkline as columns of the same
+	// height, up for positive values and down for negative ones.
+	SparklineWinLoss
+)
+
+// SparklineOptions says how the sparklines added by
+// Sheet.AddSparklineGroup are drawn.  Colors are given as RRGGBB or
+// AARRGGBB hex, such as "376092"; those left empty are those of
+// Excel's first sparkline style.
+type SparklineOptions struct {
+	Type SparklineType
+	// SeriesColor is the color of the lines or columns.
+	SeriesColor string
+	// NegativeColor is the color of the columns of negative values,
+	// when Negative is set, and of all the down columns of a win/loss
+	// sparkline.
+	NegativeColor string
+	// AxisColor is the color of the horizontal axis, when ShowAxis is
+	// set.
+	AxisColor string
+	// MarkersColor is the color of the markers on every point of a
+	// line sparkline, when Markers is set.
+	MarkersColor string
+	// FirstColor, LastColor, HighColor and LowColor are the colors of
+	// the first, last, highest and lowest points, when First, Last,
+	// High and Low are set.
+	FirstColor string
+	LastColor  string
+	HighColor  string
+	LowColor   string
+	Markers    bool
+	Negative   bool
+	First      bool
+	Last       bool
+	High       bool
+	Low        bool
+	ShowAxis   bool
+	// LineWeight is the weight of the lines of a line sparkline in
+	// points, or 0 for Excel's 0.75.
+	LineWeight float64
+}
+
+// sparkline is a sparkline of the values in the cells that Data refers
+// to, drawn in the cell Location.
+type sparkline struct {
+	Data     string
+	Location string
+}
+
+// sparklineGroup is a group of sparklines added to a Sheet, which are
+// all drawn the same way.
+type sparklineGroup struct {
+	Options    SparklineOptions
+	Sparklines []sparkline
+}
+
+// sparklineRefEscaper escapes the range of a sparkline as the text of
+// an element, leaving the quotes around sheet names as Excel does.
+var sparklineRefEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// sparklineColor matches a color given in SparklineOptions.
+var sparklineColor = regexp.MustCompile(`^([0-9A-Fa-f]{2})?[0-9A-Fa-f]{6}$`)
+
+// argb returns color as AARRGGBB hex, opaque unless it says otherwise,
+// or def if it is empty.
+func argb(color, def string) string {
+	if color == "" {
+		return def
+	}
+	if len(color) == 6 {
+		color = "FF" + color
+	}
+	return strings.ToUpper(color)
+}
+
+// AddSparklineGroup adds a group of sparklines to the sheet, one for
+// each cell of locationRange, such as "N2:N13", which is a row or
+// column of cells in the sheet.  dataRange, such as "B2:M13" or
+// "Sales!B2:M13", holds the values the sparklines show: one of its
+// rows for each of the cells in a column of locations, or one of its
+// columns for each of the cells in a row of them, either way round if
+// the numbers of rows and columns leave no doubt.  A dataRange without
+// a sheet name is taken to be on this sheet.
+//
+// The sparklines are written in an extension to the worksheet, which
+// Excel 2010 and later show.  Like tables, they aren't moved when rows
+// or columns are inserted or removed.
+func (s *Sheet) AddSparklineGroup(dataRange, locationRange string, opts SparklineOptions) error {
+	switch opts.Type {
+	case SparklineLine, SparklineColumn, SparklineWinLoss:
+	default:
+		return fmt.Errorf("AddSparklineGroup: unknown sparkline type %d", opts.Type)
+	}
+	for _, color := range []string{opts.SeriesColor, opts.NegativeColor, opts.AxisColor, opts.MarkersColor,
+		opts.FirstColor, opts.LastColor, opts.HighColor, opts.LowColor} {
+		if color != "" && !sparklineColor.MatchString(color) {
+			return fmt.Errorf("AddSparklineGroup: invalid color %q, use RRGGBB or AARRGGBB hex", color)
+		}
+	}
+	if opts.LineWeight < 0 {
+		return errors.New("AddSparklineGroup: the line weight can't be negative")
+	}
+
+	location, err := parseRange(locationRange)
+	if err != nil {
+		return fmt.Errorf("AddSparklineGroup: %w", err)
+	}
+	rows := location.LastRow - location.FirstRow + 1
+	cols := location.LastCol - location.FirstCol + 1
+	if rows > 1 && cols > 1 {
+		return fmt.Errorf("AddSparklineGroup: location %q isn't a single row or column", locationRange)
+	}
+	sheetPrefix := quoteSheetName(s.Name) + "!"
+	if _, n := formulaRefSheet(dataRange); n > 0 {
+		sheetPrefix, dataRange = dataRange[:n], dataRange[n:]
+	}
+	data, err := parseRange(dataRange)
+	if err != nil {
+		return fmt.Errorf("AddSparklineGroup: %w", err)
+	}
+	count := rows * cols
+	dataRows := data.LastRow - data.FirstRow + 1
+	dataCols := data.LastCol - data.FirstCol + 1
+	byRow := dataRows == count && (cols == 1 || dataCols != count)
+	if !byRow && dataCols != count {
+		return fmt.Errorf("AddSparklineGroup: data %q doesn't have a row or column for each of the %d cells of %q", dataRange, count, locationRange)
+	}
+
+	group := &sparklineGroup{Options: opts}
+	for i := 0; i < count; i++ {
+		x, y := location.FirstCol, location.FirstRow
+		if cols > 1 {
+			x += i
+		} else {
+			y += i
+		}
+		r := *data
+		if byRow {
+			r.FirstRow += i
+			r.LastRow = r.FirstRow
+		} else {
+			r.FirstCol += i
+			r.LastCol = r.FirstCol
+		}
+		group.Sparklines = append(group.Sparklines, sparkline{
+			Data:     sheetPrefix + GetCellIDStringFromCoords(r.FirstCol, r.FirstRow) + ":" + GetCellIDStringFromCoords(r.LastCol, r.LastRow),
+			Location: GetCellIDStringFromCoords(x, y),
+		})
+	}
+	s.sparklineGroups = append(s.sparklineGroups, group)
+	return nil
+}
+
+// writeSparklineGroup writes a sparklineGroup element for group, which
+// declares namespaces, unless that is empty because an enclosing
+// element declares the x14 and xm prefixes.
+func writeSparklineGroup(b *strings.Builder, group *sparklineGroup, namespaces string) {
+	opts := group.Options
+	b.WriteString(`<x14:sparklineGroup` + namespaces)
+	switch opts.Type {
+	case SparklineColumn:
+		b.WriteString(` type="column"`)
+	case SparklineWinLoss:
+		b.WriteString(` type="stacked"`)
+	}
+	if opts.LineWeight > 0 {
+		fmt.Fprintf(b, ` lineWeight="%g"`, opts.LineWeight)
+	}
+	b.WriteString(` displayEmptyCellsAs="gap"`)
+	for _, flag := range []struct {
+		name string
+		set  bool
+	}{
+		{"markers", opts.Markers},
+		{"high", opts.High},
+		{"low", opts.Low},
+		{"first", opts.First},
+		{"last", opts.Last},
+		{"negative", opts.Negative},
+		{"displayXAxis", opts.ShowAxis},
+	} {
+		if flag.set {
+			fmt.Fprintf(b, ` %s="1"`, flag.name)
+		}
+	}
+	b.WriteString(`>`)
+	for _, color := range []struct {
+		name, value, def string
+	}{
+		{"colorSeries", opts.SeriesColor, "FF376092"},
+		{"colorNegative", opts.NegativeColor, "FFD00000"},
+		{"colorAxis", opts.AxisColor, "FF000000"},
+		{"colorMarkers", opts.MarkersColor, "FFD00000"},
+		{"colorFirst", opts.FirstColor, "FFD00000"},
+		{"colorLast", opts.LastColor, "FFD00000"},
+		{"colorHigh", opts.HighColor, "FFD00000"},
+		{"colorLow", opts.LowColor, "FFD00000"},
+	} {
+		fmt.Fprintf(b, `<x14:%s rgb="%s"/>`, color.name, argb(color.value, color.def))
+	}
+	b.WriteString(`<x14:sparklines>`)
+	for _, sl := range group.Sparklines {
+		fmt.Fprintf(b, `<x14:sparkline><xm:f>%s</xm:f><xm:sqref>%s</xm:sqref></x14:sparkline>`, sparklineRefEscaper.Replace(sl.Data), sl.Location)
+	}
+	b.WriteString(`</x14:sparklines></x14:sparklineGroup>`)
+}
+
+// keepExtensions returns the ext elements of extLst, read from a
+// worksheet, that can be written back out verbatim, which are those
+// that declare the namespace prefixes that they use.  Excel's own
+// extensions, such as those of sparklines, do.
+func keepExtensions(extLst *xlsxExtLst) []string {
+	if extLst == nil {
+		return nil
+	}
+	var kept []string
+ext:
+	for _, ext := range extLst.Ext {
+		var b strings.Builder
+		fmt.Fprintf(&b, `<ext uri="%s"`, escapeXMLAttr(ext.URI))
+		for _, attr := range ext.Attrs {
+			switch {
+			case attr.Name.Space == "xmlns":
+				fmt.Fprintf(&b, ` xmlns:%s="%s"`, attr.Name.Local, escapeXMLAttr(attr.Value))
+			case attr.Name.Space == "":
+				fmt.Fprintf(&b, ` %s="%s"`, attr.Name.Local, escapeXMLAttr(attr.Value))
+			default:
+				// The prefix of the attribute isn't known.
+				continue ext
+			}
+		}
+		b.WriteString(`>` + ext.Content + `</ext>`)
+		if content := keepRawXML(b.String()); content != nil {
+			kept = append(kept, *content)
+		}
+	}
+	return kept
+}
+
+// extensionFormula matches a formula in an extension, such as the range
+// of a sparkline or of a conditional format, which is the text of an
+// element called f in the xm namespace.
+var extensionFormula = regexp.MustCompile(`(<(\w+:)?f>)([^<]*)(</(\w+:)?f>)`)
+
+// renameExtensionRefs returns ext, an extension kept by keepExtensions,
+// with the references to the sheet r.oldName in its formulas changed to
+// r.newName.  The rest of ext is left as it was read.
+func renameExtensionRefs(ext string, r sheetRefRenamer) (string, error) {
+	var err error
+	renamed := extensionFormula.ReplaceAllStringFunc(ext, func(match string) string {
+		parts := extensionFormula.FindStringSubmatch(match)
+		formula := html.UnescapeString(parts[3])
+		renamed, ferr := r.formula(formula)
+		if ferr != nil && err == nil {
+			err = ferr
+		}
+		if renamed == formula {
+			return match
+		}
+		return parts[1] + sparklineRefEscaper.Replace(renamed) + parts[4]
+	})
+	if err != nil {
+		return ext, err
+	}
+	return renamed, nil
+}
+
+// renameSparklineRefs changes the references to the sheet r.oldName in
+// the sparklines and the extensions of the Sheet to refer to
+// r.newName.
+func (s *Sheet) renameSparklineRefs(r sheetRefRenamer) error {
+	for _, group := range s.sparklineGroups {
+		for i := range group.Sparklines {
+			data, err := r.formula(group.Sparklines[i].Data)
+			if err != nil {
+				return err
+			}
+			group.Sparklines[i].Data = data
+		}
+	}
+	for i, ext := range s.extensions {
+		ext, err := renameExtensionRefs(ext, r)
+		if err != nil {
+			return err
+		}
+		s.extensions[i] = ext
+	}
+	return nil
+}
+
+// copySparklines gives dst, a copy of the Sheet, copies of its
+// sparkline groups and extensions, which show dst's cells where those
+// of the Sheet show the Sheet's.
+func (s *Sheet) copySparklines(dst *Sheet) error {
+	for _, group := range s.sparklineGroups {
+		group := *group
+		group.Sparklines = append([]sparkline(nil), group.Sparklines...)
+		dst.sparklineGroups = append(dst.sparklineGroups, &group)
+	}
+	dst.extensions = append([]string(nil), s.extensions...)
+	return dst.renameSparklineRefs(sheetRefRenamer{oldName: s.Name, newName: dst.Name})
+}
+
+// sparklineGroupsEnd matches the end tag of the sparklineGroups element
+// of the sparkline extension.
+var sparklineGroupsEnd = regexp.MustCompile(`</(\w+:)?sparklineGroups>`)
+
+// makeExtLst returns the extLst element of the Sheet, with the
+// extensions read with it, unless rows have been inserted or removed
+// since, and the sparkline groups added to it, or nil if it has none.
+// The groups are added to the sparkline extension that was read, if
+// there is one.
+func (s *Sheet) makeExtLst() *xlsxExtLst {
+	var exts []string
+	if !s.structureChanged {
+		exts = append(exts, s.extensions...)
+	}
+	if len(s.sparklineGroups) > 0 {
+		added := false
+		for i, ext := range exts {
+			if !strings.Contains(strings.ToUpper(ext), strings.ToUpper(sparklineExtURI)) {
+				continue
+			}
+			loc := sparklineGroupsEnd.FindAllStringIndex(ext, -1)
+			if loc == nil {
+				continue
+			}
+			end := loc[len(loc)-1][0]
+			var b strings.Builder
+			b.WriteString(ext[:end])
+			for _, group := range s.sparklineGroups {
+				writeSparklineGroup(&b, group, ` xmlns:x14="`+x14Namespace+`" xmlns:xm="`+xmNamespace+`"`)
+			}
+			b.WriteString(ext[end:])
+			exts[i] = b.String()
+			added = true
+			break
+		}
+		if !added {
+			var b strings.Builder
+			b.WriteString(`<ext uri="` + sparklineExtURI + `" xmlns:x14="` + x14Namespace + `">`)
+			b.WriteString(`<x14:sparklineGroups xmlns:xm="` + xmNamespace + `">`)
+			for _, group := range s.sparklineGroups {
+				writeSparklineGroup(&b, group, "")
+			}
+			b.WriteString(`</x14:sparklineGroups></ext>`)
+			exts = append(exts, b.String())
+		}
+	}
+	if len(exts) == 0 {
+		return nil
+	}
+	return &xlsxExtLst{Content: strings.Join(exts, "")}
+}
+
+// checkExtensions records a Warning if the extensions read with the
+// Sheet won't be written out, because rows have been inserted or
+// removed since, against partName, the name of the Sheet's part.
+func (s *Sheet) checkExtensions(partName string) error {
+	if len(s.extensions) == 0 || !s.structureChanged || s.File == nil {
+		return nil
+	}
+	err := fmt.Errorf("rows of sheet %q were inserted or removed, so the cell references of its extensions are out of date", s.Name)
+	return s.File.addWarning(Warning{
+		Code:     WarningExtensionsDropped,
+		Severity: SeverityDataLoss,
+		Part:     partName,
+		Location: s.Name,
+		Message:  err.Error() + "; the extensions, such as its sparklines, were dropped",
+		Err:      err,
+	})
+}
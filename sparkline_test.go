@@ -0,0 +1,258 @@
+package xlsx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAddSparklineGroup(t *testing.T) {
+	c := qt.New(t)
+
+	readParts := func(c *qt.C, b []byte) map[string]string {
+		parts := make(map[string]string)
+		rewriteXLSX(c, b, func(name string, body []byte) (string, []byte) {
+			parts[name] = string(body)
+			return name, body
+		})
+		return parts
+	}
+	write := func(c *qt.C, f *File) []map[string]string {
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		streamParts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		return []map[string]string{readParts(c, buf.Bytes()), streamParts}
+	}
+
+	// dashboard returns a file with a sheet of the monthly sales of
+	// five products, with a sparkline for each of them.
+	dashboard := func(c *qt.C, option FileOption) *File {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Dashboard")
+		c.Assert(err, qt.IsNil)
+		header := sheet.AddRow()
+		header.AddCell().SetString("Product")
+		for _, month := range []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"} {
+			header.AddCell().SetString(month)
+		}
+		header.AddCell().SetString("Trend")
+		for p := 1; p <= 5; p++ {
+			row := sheet.AddRow()
+			row.AddCell().SetString("Product " + string(rune('A'+p-1)))
+			for m := 1; m <= 12; m++ {
+				row.AddCell().SetInt(p*m%7 + m)
+			}
+		}
+		c.Assert(sheet.AddSparklineGroup("B2:M6", "N2:N6", SparklineOptions{
+			SeriesColor: "1F4E79",
+			High:        true,
+			Low:         true,
+			HighColor:   "00B050",
+			LowColor:    "80FF0000",
+			Markers:     true,
+		}), qt.IsNil)
+		return f
+	}
+
+	csRunO(c, "Dashboard", func(c *qt.C, option FileOption) {
+		f := dashboard(c, option)
+		c.Cleanup(f.Sheets[0].Close)
+		for _, parts := range write(c, f) {
+			sheet := parts["xl/worksheets/sheet1.xml"]
+			c.Assert(sheet, qt.Matches, `(?s).*</sheetData>.*<extLst><ext uri="\{05C60535-1F16-4fd2-B633-F4F36F0B64E0\}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:sparklineGroups xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main">.*</extLst></worksheet>`)
+			c.Assert(sheet, qt.Contains, `<x14:sparklineGroup displayEmptyCellsAs="gap" markers="1" high="1" low="1"><x14:colorSeries rgb="FF1F4E79"/><x14:colorNegative rgb="FFD00000"/><x14:colorAxis rgb="FF000000"/><x14:colorMarkers rgb="FFD00000"/><x14:colorFirst rgb="FFD00000"/><x14:colorLast rgb="FFD00000"/><x14:colorHigh rgb="FF00B050"/><x14:colorLow rgb="80FF0000"/><x14:sparklines>`)
+			for r := 2; r <= 6; r++ {
+				n := string(rune('0' + r))
+				c.Assert(sheet, qt.Contains, `<x14:sparkline><xm:f>'Dashboard'!B`+n+`:M`+n+`</xm:f><xm:sqref>N`+n+`</xm:sqref></x14:sparkline>`)
+			}
+			c.Assert(strings.Count(sheet, `<x14:sparkline>`), qt.Equals, 5)
+		}
+	})
+
+	csRunO(c, "TypesAndRanges", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		data, err := f.AddSheet("Data")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(data.Close)
+		sheet, err := f.AddSheet("Summary")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		// A row of locations takes a column of the data each.
+		c.Assert(sheet.AddSparklineGroup("Data!$A$1:$C$12", "A1:C1", SparklineOptions{Type: SparklineColumn, Negative: true, LineWeight: 1.5}), qt.IsNil)
+		c.Assert(sheet.AddSparklineGroup("A5:L5", "M5", SparklineOptions{Type: SparklineWinLoss, ShowAxis: true, AxisColor: "ff0000"}), qt.IsNil)
+
+		for _, parts := range write(c, f) {
+			summary := parts["xl/worksheets/sheet2.xml"]
+			c.Assert(summary, qt.Contains, `<x14:sparklineGroup type="column" lineWeight="1.5" displayEmptyCellsAs="gap" negative="1">`)
+			c.Assert(summary, qt.Contains, `<xm:f>Data!A1:A12</xm:f><xm:sqref>A1</xm:sqref></x14:sparkline><x14:sparkline><xm:f>Data!B1:B12</xm:f><xm:sqref>B1</xm:sqref>`)
+			c.Assert(summary, qt.Contains, `<x14:sparklineGroup type="stacked" displayEmptyCellsAs="gap" displayXAxis="1"><x14:colorSeries rgb="FF376092"/><x14:colorNegative rgb="FFD00000"/><x14:colorAxis rgb="FFFF0000"/>`)
+			c.Assert(summary, qt.Contains, `<xm:f>'Summary'!A5:L5</xm:f><xm:sqref>M5</xm:sqref>`)
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Not(qt.Contains), `extLst`)
+		}
+
+		// The sparklines follow the sheets they show when those are
+		// renamed.
+		c.Assert(f.RenameSheet("Data", "Sales"), qt.IsNil)
+		c.Assert(f.RenameSheet("Summary", "Overview"), qt.IsNil)
+		for _, parts := range write(c, f) {
+			summary := parts["xl/worksheets/sheet2.xml"]
+			c.Assert(summary, qt.Contains, `<xm:f>'Sales'!A1:A12</xm:f>`)
+			c.Assert(summary, qt.Contains, `<xm:f>'Overview'!A5:L5</xm:f>`)
+		}
+	})
+
+	c.Run("Errors", func(c *qt.C) {
+		f := NewFile()
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		for _, test := range []struct {
+			data, location string
+			opts           SparklineOptions
+			err            string
+		}{
+			{"A1:L1", "M1", SparklineOptions{Type: SparklineType(7)}, `AddSparklineGroup: unknown sparkline type 7`},
+			{"A1:L1", "M1", SparklineOptions{HighColor: "green"}, `AddSparklineGroup: invalid color "green", use RRGGBB or AARRGGBB hex`},
+			{"A1:L1", "M1", SparklineOptions{LineWeight: -1}, `AddSparklineGroup: the line weight can't be negative`},
+			{"A1:L2", "M1:N2", SparklineOptions{}, `AddSparklineGroup: location "M1:N2" isn't a single row or column`},
+			{"A1:L3", "M1:M2", SparklineOptions{}, `AddSparklineGroup: data "A1:L3" doesn't have a row or column for each of the 2 cells of "M1:M2"`},
+			{"A1:L1", "1M", SparklineOptions{}, `AddSparklineGroup: .*`},
+		} {
+			c.Assert(sheet.AddSparklineGroup(test.data, test.location, test.opts), qt.ErrorMatches, test.err)
+		}
+		c.Assert(sheet.sparklineGroups, qt.HasLen, 0)
+	})
+
+	// excelExtensions is the extLst of a worksheet saved by Excel, with
+	// a sparkline group and a conditional format of its own.
+	const excelExtensions = `<extLst>` +
+		`<ext uri="{78C0D931-6437-407d-A8EE-F0AAD7539E65}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:conditionalFormattings><x14:conditionalFormatting xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main"><x14:cfRule type="dataBar" id="{00000000-000E-0000-0000-000001000000}"><x14:dataBar minLength="0" maxLength="100"><x14:cfvo type="autoMin"/><x14:cfvo type="autoMax"/></x14:dataBar></x14:cfRule><xm:sqref>B2:B6</xm:sqref></x14:conditionalFormatting></x14:conditionalFormattings></ext>` +
+		`<ext uri="{05C60535-1F16-4fd2-B633-F4F36F0B64E0}" xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main"><x14:sparklineGroups xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main"><x14:sparklineGroup displayEmptyCellsAs="gap"><x14:colorSeries theme="4" tint="-0.499984740745262"/><x14:colorNegative theme="5"/><x14:colorAxis rgb="FF000000"/><x14:colorMarkers theme="4" tint="-0.499984740745262"/><x14:colorFirst theme="4" tint="0.39997558519241921"/><x14:colorLast theme="4" tint="0.39997558519241921"/><x14:colorHigh theme="4"/><x14:colorLow theme="4"/><x14:sparklines><x14:sparkline><xm:f>Dashboard!B2:M2</xm:f><xm:sqref>N2</xm:sqref></x14:sparkline></x14:sparklines></x14:sparklineGroup></x14:sparklineGroups></ext>` +
+		`</extLst>`
+	// excelFile returns the dashboard as if it had been saved by Excel.
+	excelFile := func(c *qt.C) []byte {
+		f := NewFile()
+		sheet, err := f.AddSheet("Dashboard")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		for r := 0; r < 6; r++ {
+			sheet.AddRow().AddCell().SetInt(r)
+		}
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		return rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/worksheets/sheet1.xml" {
+				body = []byte(strings.Replace(string(body), `</worksheet>`, excelExtensions+`</worksheet>`, 1))
+			}
+			return name, body
+		})
+	}
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(excelFile(c), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		cell, err := f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		cell.SetInt(42)
+		for _, parts := range write(c, f) {
+			c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Contains, excelExtensions+`</worksheet>`)
+		}
+		c.Assert(f.Warnings(), qt.HasLen, 0)
+	})
+
+	csRunO(c, "AddToExisting", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(excelFile(c), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		c.Assert(f.Sheets[0].AddSparklineGroup("B3:M3", "N3", SparklineOptions{}), qt.IsNil)
+		for _, parts := range write(c, f) {
+			sheet := parts["xl/worksheets/sheet1.xml"]
+			// The group is added to the sparkline extension that was
+			// read, after the group that it held.
+			c.Assert(strings.Count(sheet, `{05C60535-1F16-4fd2-B633-F4F36F0B64E0}`), qt.Equals, 1)
+			c.Assert(sheet, qt.Contains, `<xm:sqref>N2</xm:sqref></x14:sparkline></x14:sparklines></x14:sparklineGroup><x14:sparklineGroup xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main" displayEmptyCellsAs="gap">`)
+			c.Assert(sheet, qt.Contains, `<xm:f>'Dashboard'!B3:M3</xm:f><xm:sqref>N3</xm:sqref></x14:sparkline></x14:sparklines></x14:sparklineGroup></x14:sparklineGroups></ext></extLst></worksheet>`)
+		}
+
+		// The file that was written is read back with both groups.
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		saved, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(saved.Sheets[0].Close)
+		c.Assert(saved.Sheets[0].extensions, qt.HasLen, 2)
+		c.Assert(strings.Count(saved.Sheets[0].extensions[1], `<x14:sparklineGroup `), qt.Equals, 2)
+	})
+
+	csRunO(c, "RowInserted", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(excelFile(c), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		_, err = f.Sheets[0].AddRowAtIndex(1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets[0].AddSparklineGroup("B3:M3", "N3", SparklineOptions{}), qt.IsNil)
+		for _, parts := range write(c, f) {
+			sheet := parts["xl/worksheets/sheet1.xml"]
+			// Only the group added since is written.
+			c.Assert(sheet, qt.Not(qt.Contains), `conditionalFormattings`)
+			c.Assert(sheet, qt.Not(qt.Contains), `Dashboard!B2:M2`)
+			c.Assert(sheet, qt.Contains, `<xm:f>'Dashboard'!B3:M3</xm:f>`)
+		}
+		warnings := f.Warnings()
+		c.Assert(warnings, qt.HasLen, 2)
+		for _, w := range warnings {
+			c.Assert(w.Code, qt.Equals, WarningExtensionsDropped)
+			c.Assert(w.Severity, qt.Equals, SeverityDataLoss)
+			c.Assert(w.Part, qt.Equals, "xl/worksheets/sheet1.xml")
+			c.Assert(w.Message, qt.Equals, `rows of sheet "Dashboard" were inserted or removed, so the cell references of its extensions are out of date; the extensions, such as its sparklines, were dropped`)
+		}
+	})
+
+	csRunO(c, "Clone", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(excelFile(c), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		c.Assert(f.Sheets[0].AddSparklineGroup("B3:M3", "N3", SparklineOptions{}), qt.IsNil)
+		c.Assert(f.Sheets[0].AddSparklineGroup("Other!B1:M1", "N4", SparklineOptions{}), qt.IsNil)
+		dst, err := f.Sheets[0].Clone(f, "Dashboard Copy")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(dst.Close)
+		// Changing the copy's sparklines leaves the Sheet's alone.
+		dst.sparklineGroups[0].Options.Type = SparklineColumn
+		c.Assert(f.Sheets[0].sparklineGroups[0].Options.Type, qt.Equals, SparklineLine)
+
+		for _, parts := range write(c, f) {
+			src := parts["xl/worksheets/sheet1.xml"]
+			c.Assert(src, qt.Contains, `<xm:f>Dashboard!B2:M2</xm:f>`)
+			c.Assert(src, qt.Contains, `<xm:f>'Dashboard'!B3:M3</xm:f>`)
+			c.Assert(src, qt.Not(qt.Contains), `Dashboard Copy`)
+
+			copied := parts["xl/worksheets/sheet2.xml"]
+			// The extensions that were read, and the sparklines that
+			// were added, show the copy's cells.
+			c.Assert(copied, qt.Contains, `<xm:f>'Dashboard Copy'!B2:M2</xm:f><xm:sqref>N2</xm:sqref>`)
+			c.Assert(copied, qt.Contains, `<x14:conditionalFormattings>`)
+			c.Assert(copied, qt.Contains, `<x14:sparklineGroup xmlns:x14="http://schemas.microsoft.com/office/spreadsheetml/2009/9/main" xmlns:xm="http://schemas.microsoft.com/office/excel/2006/main" type="column" displayEmptyCellsAs="gap">`)
+			c.Assert(copied, qt.Contains, `<xm:f>'Dashboard Copy'!B3:M3</xm:f><xm:sqref>N3</xm:sqref>`)
+			c.Assert(copied, qt.Contains, `<xm:f>Other!B1:M1</xm:f><xm:sqref>N4</xm:sqref>`)
+			c.Assert(strings.Count(copied, `<x14:sparkline>`), qt.Equals, 3)
+		}
+	})
+
+	csRunO(c, "RenameKept", func(c *qt.C, option FileOption) {
+		f, err := OpenBinary(excelFile(c), option)
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(f.Sheets[0].Close)
+		c.Assert(f.RenameSheet("Dashboard", "Board & Co"), qt.IsNil)
+		for _, parts := range write(c, f) {
+			sheet := parts["xl/worksheets/sheet1.xml"]
+			c.Assert(sheet, qt.Contains, `<xm:f>'Board &amp; Co'!B2:M2</xm:f>`)
+			// The rest of the extension is kept as it was read.
+			c.Assert(sheet, qt.Contains, `<xm:sqref>B2:B6</xm:sqref></x14:conditionalFormatting>`)
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package xlsx
 
-import "strconv"
+import (
+	"fmt"
+	"strconv"
+)
 
 // Several popular font names that can be used to create fonts
 const (
@@ -25,6 +28,86 @@ const (
 	Solid_Cell_Fill = "solid"
 )
 
+// Border line styles that can be used for the sides of a Border.
+const (
+	BorderStyleNone             = "none"
+	BorderStyleThin             = "thin"
+	BorderStyleMedium           = "medium"
+	BorderStyleThick            = "thick"
+	BorderStyleDashed           = "dashed"
+	BorderStyleDotted           = "dotted"
+	BorderStyleDouble           = "double"
+	BorderStyleHair             = "hair"
+	BorderStyleMediumDashed     = "mediumDashed"
+	BorderStyleDashDot          = "dashDot"
+	BorderStyleMediumDashDot    = "mediumDashDot"
+	BorderStyleDashDotDot       = "dashDotDot"
+	BorderStyleMediumDashDotDot = "mediumDashDotDot"
+	BorderStyleSlantDashDot     = "slantDashDot"
+)
+
+// Pattern types that can be used for Fill.PatternType.
+const (
+	PatternTypeNone            = "none"
+	PatternTypeSolid           = Solid_Cell_Fill
+	PatternTypeMediumGray      = "mediumGray"
+	PatternTypeDarkGray        = "darkGray"
+	PatternTypeLightGray       = "lightGray"
+	PatternTypeDarkHorizontal  = "darkHorizontal"
+	PatternTypeDarkVertical    = "darkVertical"
+	PatternTypeDarkDown        = "darkDown"
+	PatternTypeDarkUp          = "darkUp"
+	PatternTypeDarkGrid        = "darkGrid"
+	PatternTypeDarkTrellis     = "darkTrellis"
+	PatternTypeLightHorizontal = "lightHorizontal"
+	PatternTypeLightVertical   = "lightVertical"
+	PatternTypeLightDown       = "lightDown"
+	PatternTypeLightUp         = "lightUp"
+	PatternTypeLightGrid       = "lightGrid"
+	PatternTypeLightTrellis    = "lightTrellis"
+	PatternTypeGray125         = "gray125"
+	PatternTypeGray0625        = "gray0625"
+)
+
+var validBorderStyles = map[string]bool{
+	BorderStyleNone:             true,
+	BorderStyleThin:             true,
+	BorderStyleMedium:           true,
+	BorderStyleThick:            true,
+	BorderStyleDashed:           true,
+	BorderStyleDotted:           true,
+	BorderStyleDouble:           true,
+	BorderStyleHair:             true,
+	BorderStyleMediumDashed:     true,
+	BorderStyleDashDot:          true,
+	BorderStyleMediumDashDot:    true,
+	BorderStyleDashDotDot:       true,
+	BorderStyleMediumDashDotDot: true,
+	BorderStyleSlantDashDot:     true,
+}
+
+var validPatternTypes = map[string]bool{
+	PatternTypeNone:            true,
+	PatternTypeSolid:           true,
+	PatternTypeMediumGray:      true,
+	PatternTypeDarkGray:        true,
+	PatternTypeLightGray:       true,
+	PatternTypeDarkHorizontal:  true,
+	PatternTypeDarkVertical:    true,
+	PatternTypeDarkDown:        true,
+	PatternTypeDarkUp:          true,
+	PatternTypeDarkGrid:        true,
+	PatternTypeDarkTrellis:     true,
+	PatternTypeLightHorizontal: true,
+	PatternTypeLightVertical:   true,
+	PatternTypeLightDown:       true,
+	PatternTypeLightUp:         true,
+	PatternTypeLightGrid:       true,
+	PatternTypeLightTrellis:    true,
+	PatternTypeGray125:         true,
+	PatternTypeGray0625:        true,
+}
+
 // Style is a high level structure intended to provide user access to
 // the contents of Style within an XLSX file.
 type Style struct {
@@ -37,6 +120,9 @@ type Style struct {
 	ApplyAlignment  bool
 	Alignment       Alignment
 	NamedStyleIndex *int
+	// QuotePrefix marks the value of a cell as literal text, as
+	// Excel does when text is entered with a leading apostrophe.
+	QuotePrefix bool
 }
 
 // Return a new Style structure initialised with the default values.
@@ -49,6 +135,26 @@ func NewStyle() *Style {
 	}
 }
 
+// Clone returns a copy of the Style, which can be modified without
+// affecting the original or any cell that shares it.  NamedStyleIndex
+// still refers to the same named style; assign a new pointer to change it.
+func (style *Style) Clone() *Style {
+	if style == nil {
+		return nil
+	}
+	clone := *style
+	return &clone
+}
+
+// equals returns true if the Style formats cells in the same way as
+// other.  The named styles they are based on aren't compared, as the
+// formatting they give is already included in each Style.
+func (style *Style) equals(other *Style) bool {
+	a, b := *style, *other
+	a.NamedStyleIndex, b.NamedStyleIndex = nil, nil
+	return a == b
+}
+
 // Generate the underlying XLSX style elements that correspond to the Style.
 func (style *Style) makeXLSXStyleElements() (xFont xlsxFont, xFill xlsxFill, xBorder xlsxBorder, xCellXf xlsxXf) {
 	if style == nil {
@@ -111,6 +217,7 @@ func (style *Style) makeXLSXStyleElements() (xFont xlsxFont, xFill xlsxFill, xBo
 	xCellXf.ApplyFill = style.ApplyFill
 	xCellXf.ApplyFont = style.ApplyFont
 	xCellXf.ApplyAlignment = style.ApplyAlignment
+	xCellXf.QuotePrefix = style.QuotePrefix
 	if style.NamedStyleIndex != nil {
 		xCellXf.XfId = style.NamedStyleIndex
 	}
@@ -135,6 +242,24 @@ type Border struct {
 	BottomColor string
 }
 
+// Validate returns an error if any side of the Border has a line
+// style that isn't one of the BorderStyle constants.  An empty side
+// is valid, and is written as no border at all.
+func (b Border) Validate() error {
+	sides := []struct{ name, style string }{
+		{"left", b.Left},
+		{"right", b.Right},
+		{"top", b.Top},
+		{"bottom", b.Bottom},
+	}
+	for _, side := range sides {
+		if side.style != "" && !validBorderStyles[side.style] {
+			return fmt.Errorf("invalid %s border style %q", side.name, side.style)
+		}
+	}
+	return nil
+}
+
 func NewBorder(left, right, top, bottom string) *Border {
 	return &Border{
 		Left:   left,
@@ -152,6 +277,15 @@ type Fill struct {
 	FgColor     string
 }
 
+// Validate returns an error if the PatternType of the Fill isn't one
+// of the PatternType constants.  An empty PatternType is valid.
+func (f Fill) Validate() error {
+	if f.PatternType != "" && !validPatternTypes[f.PatternType] {
+		return fmt.Errorf("invalid fill pattern type %q", f.PatternType)
+	}
+	return nil
+}
+
 func NewFill(patternType, fgColor, bgColor string) *Fill {
 	return &Fill{
 		PatternType: patternType,
@@ -176,13 +310,22 @@ func NewFont(size float64, name string) *Font {
 	return &Font{Size: size, Name: name}
 }
 
+// Reading orders that can be used for Alignment.ReadingOrder.
+const (
+	ReadingOrderContextDependent = 0
+	ReadingOrderLeftToRight      = 1
+	ReadingOrderRightToLeft      = 2
+)
+
 type Alignment struct {
-	Horizontal   string
-	Indent       int
-	ShrinkToFit  bool
-	TextRotation int
-	Vertical     string
-	WrapText     bool
+	Horizontal      string
+	Indent          int
+	JustifyLastLine bool
+	ReadingOrder    int
+	ShrinkToFit     bool
+	TextRotation    int
+	Vertical        string
+	WrapText        bool
 }
 
 var defaultFontSize = 12.0
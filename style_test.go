@@ -1,6 +1,9 @@
 package xlsx
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"testing"
 
 	qt "github.com/frankban/quicktest"
@@ -57,6 +60,26 @@ func TestStyle(t *testing.T) {
 		c.Assert(xCellXf.ApplyFont, qt.Equals, true)
 
 	})
+
+	c.Run("TestClone", func(c *qt.C) {
+		namedStyleIndex := 1
+		style := NewStyle()
+		style.Font.Bold = true
+		style.NamedStyleIndex = &namedStyleIndex
+
+		clone := style.Clone()
+		c.Assert(clone, qt.DeepEquals, style)
+		c.Assert(clone, qt.Not(qt.Equals), style)
+
+		clone.Font.Bold = false
+		clone.Fill.PatternType = "solid"
+		c.Assert(style.Font.Bold, qt.Equals, true)
+		c.Assert(style.Fill.PatternType, qt.Equals, "none")
+		c.Assert(clone.NamedStyleIndex, qt.Equals, style.NamedStyleIndex)
+
+		var nilStyle *Style
+		c.Assert(nilStyle.Clone(), qt.IsNil)
+	})
 }
 
 func TestReadCellColorBackground(t *testing.T) {
@@ -89,3 +112,141 @@ func TestNewFont(t *testing.T) {
 	c.Assert(font.Name, qt.Equals, "Verdana")
 	c.Assert(font.Size, qt.Equals, 12.2)
 }
+
+func TestValidateBorderAndFill(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Border", func(c *qt.C) {
+		c.Assert(DefaultBorder().Validate(), qt.IsNil)
+		c.Assert(Border{}.Validate(), qt.IsNil)
+		for style := range validBorderStyles {
+			c.Assert(NewBorder(style, style, style, style).Validate(), qt.IsNil)
+		}
+		err := NewBorder(BorderStyleThin, BorderStyleThin, "thinn", BorderStyleThin).Validate()
+		c.Assert(err, qt.ErrorMatches, `invalid top border style "thinn"`)
+	})
+
+	c.Run("Fill", func(c *qt.C) {
+		c.Assert(DefaultFill().Validate(), qt.IsNil)
+		c.Assert(Fill{}.Validate(), qt.IsNil)
+		for patternType := range validPatternTypes {
+			c.Assert(NewFill(patternType, "", "").Validate(), qt.IsNil)
+		}
+		err := NewFill("sollid", RGB_Light_Green, RGB_White).Validate()
+		c.Assert(err, qt.ErrorMatches, `invalid fill pattern type "sollid"`)
+	})
+
+	c.Run("Save", func(c *qt.C) {
+		save := func(decorate func(style *Style)) error {
+			f := NewFile()
+			sheet, err := f.AddSheet("Sheet1")
+			c.Assert(err, qt.IsNil)
+			style := NewStyle()
+			decorate(style)
+			sheet.AddRow().AddCell().SetStyle(style)
+			return f.Write(ioutil.Discard)
+		}
+		err := save(func(style *Style) {
+			style.Border.Left = "thinn"
+		})
+		c.Assert(err, qt.ErrorMatches, `.*cell A1: invalid left border style "thinn"`)
+		err = save(func(style *Style) {
+			style.Fill.PatternType = "sollid"
+		})
+		c.Assert(err, qt.ErrorMatches, `.*cell A1: invalid fill pattern type "sollid"`)
+		err = save(func(style *Style) {
+			style.Border = *NewBorder(BorderStyleThick, BorderStyleDouble, BorderStyleHair, BorderStyleSlantDashDot)
+			style.Fill.PatternType = PatternTypeGray125
+		})
+		c.Assert(err, qt.IsNil)
+	})
+}
+
+// Styles are only registered in the stylesheet when the file is saved,
+// so styles that were set on cells and then replaced leave no trace.
+func TestStylesRegisteredOnSave(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes a million cells")
+	}
+	c := qt.New(t)
+
+	makeStyle := func(argb string) *Style {
+		style := NewStyle()
+		style.Fill = *NewFill(PatternTypeSolid, argb, argb)
+		style.ApplyFill = true
+		return style
+	}
+	transient := make([]*Style, 16)
+	for i := range transient {
+		transient[i] = makeStyle(fmt.Sprintf("FF0000%02X", i))
+	}
+	final := []*Style{makeStyle("FFFF0000"), makeStyle("FF00FF00"), makeStyle("FF0000FF")}
+
+	f := NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, qt.IsNil)
+	const rows, cols = 1000, 1000
+	for y := 0; y < rows; y++ {
+		row := sheet.AddRow()
+		for x := 0; x < cols; x++ {
+			cell := row.AddCell()
+			cell.SetInt(x)
+			cell.SetStyle(transient[(x+y)%len(transient)])
+			cell.SetStyle(transient[(x*y)%len(transient)])
+		}
+	}
+	// Replace every style that has been set so far, and throw away
+	// cells that held other styles.
+	err = sheet.ForEachRow(func(row *Row) error {
+		return row.ForEachCell(func(cell *Cell) error {
+			x, y := cell.GetCoordinates()
+			cell.SetStyle(final[(x+y)%len(final)])
+			return nil
+		})
+	})
+	c.Assert(err, qt.IsNil)
+	sheet.AddRow().AddCell().SetStyle(transient[0])
+	c.Assert(sheet.RemoveRowAtIndex(rows), qt.IsNil)
+
+	var buf bytes.Buffer
+	c.Assert(f.Write(&buf), qt.IsNil)
+	// The default xf, and one for each of the final styles.
+	c.Assert(f.styles.CellXfs.Count, qt.Equals, len(final)+1)
+
+	f, err = OpenBinary(buf.Bytes())
+	c.Assert(err, qt.IsNil)
+	cell, err := f.Sheets[0].Cell(rows-1, cols-1)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cell.GetStyle().Fill.FgColor, qt.Equals, final[(rows+cols-2)%len(final)].Fill.FgColor)
+	c.Assert(f.styles.CellXfs.Count, qt.Equals, len(final)+1)
+}
+
+// The DiskV and Redis cell stores make a new Style for every cell they
+// read, so the Styles written are remembered by their content.
+func TestStylesRememberedByContent(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "Write", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("StylesByContent")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		style := NewStyle()
+		style.Font.Bold = true
+		style.ApplyFont = true
+		const rows, cols = 100, 10
+		for y := 0; y < rows; y++ {
+			row := sheet.AddRow()
+			for x := 0; x < cols; x++ {
+				cell := row.AddCell()
+				cell.SetInt(x)
+				cell.SetStyle(style)
+			}
+		}
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		c.Assert(f.styles.CellXfs.Count, qt.Equals, 2)
+		c.Assert(f.styles.xfIds, qt.HasLen, 1)
+	})
+}
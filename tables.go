@@ -0,0 +1,523 @@
+package xlsx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	tableRelationshipType RelationshipType = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/table"
+	tableContentType                       = "application/vnd.openxmlformats-officedocument.spreadsheetml.table+xml"
+)
+
+// TableTotalsFunction is a function that the totals row of a table
+// applies to a column, as Excel's drop down in the totals row offers.
+type TableTotalsFunction string
+
+const (
+	TableTotalsSum       TableTotalsFunction = "sum"
+	TableTotalsAverage   TableTotalsFunction = "average"
+	TableTotalsCount     TableTotalsFunction = "count"
+	TableTotalsCountNums TableTotalsFunction = "countNums"
+	TableTotalsMax       TableTotalsFunction = "max"
+	TableTotalsMin       TableTotalsFunction = "min"
+	TableTotalsStdDev    TableTotalsFunction = "stdDev"
+	TableTotalsVar       TableTotalsFunction = "var"
+)
+
+// subtotalFunctions are the function numbers that SUBTOTAL is called
+// with in the totals row for each TableTotalsFunction.  They are the
+// ones that ignore rows hidden by the table's filter.
+var subtotalFunctions = map[TableTotalsFunction]int{
+	TableTotalsAverage:   101,
+	TableTotalsCountNums: 102,
+	TableTotalsCount:     103,
+	TableTotalsMax:       104,
+	TableTotalsMin:       105,
+	TableTotalsStdDev:    107,
+	TableTotalsSum:       109,
+	TableTotalsVar:       110,
+}
+
+// TableOptions are the settings of a table made by Sheet.AddTable.
+type TableOptions struct {
+	// StyleName is the name of one of Excel's built in table styles,
+	// such as "TableStyleMedium2" or "TableStyleLight9".  Empty means
+	// TableStyleMedium2, which Excel gives new tables.
+	StyleName string
+	// BandedRows and BandedColumns shade every other row or column of
+	// the table, as the style gives.  Excel's new tables have banded
+	// rows.
+	BandedRows    bool
+	BandedColumns bool
+	// FirstColumn and LastColumn emphasise the first or last column,
+	// as the style gives.
+	FirstColumn bool
+	LastColumn  bool
+	// TotalsRow makes the last row of the range the table's totals
+	// row, rather than a row of data.
+	TotalsRow bool
+	// TotalsRowLabel is written in the first column of the totals row,
+	// such as "Total".
+	TotalsRowLabel string
+	// TotalsRowFunctions are the functions that the totals row applies
+	// to the columns, by column name.  The cells of the totals row are
+	// given the formulas that compute them.
+	TotalsRowFunctions map[string]TableTotalsFunction
+}
+
+// Table describes a table, or ListObject, on a Sheet, as returned by
+// Sheet.Tables.
+type Table struct {
+	// Name is the name of the table, which structured references in
+	// formulas use, as in Sales[Amount].
+	Name string
+	// Ref is the range of the table, including its header and totals
+	// rows, such as "A1:D20".
+	Ref string
+	// Columns are the names of the columns of the table, in order.
+	Columns []string
+	// StyleName is the name of the table's style, or empty if it has
+	// none.
+	StyleName     string
+	BandedRows    bool
+	BandedColumns bool
+	FirstColumn   bool
+	LastColumn    bool
+	// TotalsRow is true if the last row of the table is a totals row.
+	TotalsRow bool
+}
+
+// xlsxTable directly maps the table element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
+// currently I have not checked it for completeness - it does as much
+// as I need.
+type xlsxTable struct {
+	XMLName        xml.Name            `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main table"`
+	ID             int                 `xml:"id,attr"`
+	Name           string              `xml:"name,attr"`
+	DisplayName    string              `xml:"displayName,attr"`
+	Ref            string              `xml:"ref,attr"`
+	HeaderRowCount *int                `xml:"headerRowCount,attr,omitempty"`
+	TotalsRowCount int                 `xml:"totalsRowCount,attr,omitempty"`
+	TotalsRowShown *bool               `xml:"totalsRowShown,attr,omitempty"`
+	AutoFilter     *xlsxAutoFilter     `xml:"autoFilter,omitempty"`
+	TableColumns   xlsxTableColumns    `xml:"tableColumns"`
+	TableStyleInfo *xlsxTableStyleInfo `xml:"tableStyleInfo,omitempty"`
+}
+
+// xlsxTableColumns directly maps the tableColumns element in the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main.
+type xlsxTableColumns struct {
+	Count        int               `xml:"count,attr"`
+	TableColumns []xlsxTableColumn `xml:"tableColumn"`
+}
+
+// xlsxTableColumn directly maps the tableColumn element in the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main.
+type xlsxTableColumn struct {
+	ID                int    `xml:"id,attr"`
+	Name              string `xml:"name,attr"`
+	TotalsRowFunction string `xml:"totalsRowFunction,attr,omitempty"`
+	TotalsRowLabel    string `xml:"totalsRowLabel,attr,omitempty"`
+}
+
+// xlsxTableStyleInfo directly maps the tableStyleInfo element in the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main.
+type xlsxTableStyleInfo struct {
+	Name              string `xml:"name,attr,omitempty"`
+	ShowFirstColumn   bool   `xml:"showFirstColumn,attr"`
+	ShowLastColumn    bool   `xml:"showLastColumn,attr"`
+	ShowRowStripes    bool   `xml:"showRowStripes,attr"`
+	ShowColumnStripes bool   `xml:"showColumnStripes,attr"`
+}
+
+// xlsxTableParts directly maps the tableParts element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main, which
+// refers to the tables of a worksheet.
+type xlsxTableParts struct {
+	Count int             `xml:"count,attr"`
+	Parts []xlsxTablePart `xml:"tablePart"`
+}
+
+// xlsxTablePart directly maps the tablePart element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main.
+type xlsxTablePart struct {
+	RelationshipId string `xml:"id,attr"`
+}
+
+// table is a table of a Sheet.  The tables read with a File are
+// written back out exactly as they were read, from raw.
+type table struct {
+	xlsxTable
+	raw []byte
+}
+
+// Tables returns the tables of the Sheet, whether added by AddTable or
+// read with its File.  Changing them doesn't change the tables.
+func (s *Sheet) Tables() []Table {
+	tables := make([]Table, 0, len(s.tables))
+	for _, t := range s.tables {
+		table := Table{
+			Name:      t.DisplayName,
+			Ref:       t.Ref,
+			TotalsRow: t.TotalsRowCount > 0,
+		}
+		for _, column := range t.TableColumns.TableColumns {
+			table.Columns = append(table.Columns, column.Name)
+		}
+		if info := t.TableStyleInfo; info != nil {
+			table.StyleName = info.Name
+			table.BandedRows = info.ShowRowStripes
+			table.BandedColumns = info.ShowColumnStripes
+			table.FirstColumn = info.ShowFirstColumn
+			table.LastColumn = info.ShowLastColumn
+		}
+		tables = append(tables, table)
+	}
+	return tables
+}
+
+// checkTableName returns an error if name can't be the name of a new
+// table.  Tables are named as defined names are, and share their
+// names with them, so no table or defined name of the File may have
+// the name already, whatever its case.
+func (s *Sheet) checkTableName(name string) error {
+	if err := checkDefinedName(name); err != nil {
+		return err
+	}
+	if s.File != nil {
+		return s.File.checkTableNameUnused(name)
+	}
+	for _, t := range s.tables {
+		if strings.EqualFold(t.DisplayName, name) {
+			return fmt.Errorf("there is already a table called %q", name)
+		}
+	}
+	return nil
+}
+
+// checkTableNameUnused returns an error if a table or defined name of
+// the File has the name already, whatever its case.
+func (f *File) checkTableNameUnused(name string) error {
+	for _, dn := range f.definedNames {
+		if strings.EqualFold(dn.Name, name) {
+			return fmt.Errorf("there is already a defined name called %q", name)
+		}
+	}
+	for _, sheet := range f.Sheets {
+		for _, t := range sheet.tables {
+			if strings.EqualFold(t.DisplayName, name) {
+				return fmt.Errorf("there is already a table called %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// tableColumnNames returns the names that Excel gives columns with the
+// headers: an empty header gets the name "Column" followed by the
+// number of the column, and a name that an earlier column has,
+// whatever its case, gets the lowest number from 2 up that makes it
+// unique.
+func tableColumnNames(headers []string) []string {
+	names := make([]string, len(headers))
+	taken := make(map[string]bool)
+	for i, header := range headers {
+		name := header
+		if name == "" {
+			name = "Column" + strconv.Itoa(i+1)
+		}
+		for n := 2; taken[strings.ToLower(name)]; n++ {
+			base := header
+			if base == "" {
+				base = "Column"
+			}
+			name = base + strconv.Itoa(n)
+		}
+		taken[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// AddTable makes the cells of rangeRef, such as "A1:D20", a table
+// called name, which formulas can refer to with structured references,
+// as in SUM(Sales[Amount]).  The first row of the range is the table's
+// header row: its cells name the columns, and are changed to the names
+// that Excel would give them when they are empty or repeated.  The
+// range must have a row of data after the header row, and, if opts
+// asks for a totals row, another for that.  The table can't overlap
+// another, and nor should it overlap merged cells.
+//
+// The table keeps its range, so rows or columns shouldn't be inserted
+// into it or removed from it after it is added.
+func (s *Sheet) AddTable(rangeRef, name string, opts TableOptions) error {
+	s.mustBeOpen()
+	r, err := parseRange(rangeRef)
+	if err != nil {
+		return fmt.Errorf("AddTable: %w", err)
+	}
+	if err := s.checkTableName(name); err != nil {
+		return fmt.Errorf("AddTable: %w", err)
+	}
+	minRows := 2
+	if opts.TotalsRow {
+		minRows++
+	}
+	if r.LastRow-r.FirstRow+1 < minRows {
+		return fmt.Errorf("AddTable: range %s has no rows for data", r.String())
+	}
+	for _, t := range s.tables {
+		other, err := parseRange(t.Ref)
+		if err != nil {
+			continue
+		}
+		if r.FirstCol <= other.LastCol && other.FirstCol <= r.LastCol &&
+			r.FirstRow <= other.LastRow && other.FirstRow <= r.LastRow {
+			return fmt.Errorf("AddTable: range %s overlaps table %q", r.String(), t.DisplayName)
+		}
+	}
+
+	headers := make([]string, 0, r.LastCol-r.FirstCol+1)
+	for col := r.FirstCol; col <= r.LastCol; col++ {
+		cell, err := s.Cell(r.FirstRow, col)
+		if err != nil {
+			return fmt.Errorf("AddTable: %w", err)
+		}
+		header, err := cell.FormattedValue()
+		if err != nil {
+			header = cell.Value
+		}
+		headers = append(headers, header)
+	}
+	names := tableColumnNames(headers)
+	columnIndex := make(map[string]int, len(names))
+	for i, name := range names {
+		columnIndex[strings.ToLower(name)] = i
+	}
+	for column := range opts.TotalsRowFunctions {
+		if _, ok := columnIndex[strings.ToLower(column)]; !ok {
+			return fmt.Errorf("AddTable: table %q has no column %q", name, column)
+		}
+		if _, ok := subtotalFunctions[opts.TotalsRowFunctions[column]]; !ok {
+			return fmt.Errorf("AddTable: unknown totals row function %q", opts.TotalsRowFunctions[column])
+		}
+	}
+
+	// The header cells have to hold the names of the columns, as text.
+	for i, name := range names {
+		cell, err := s.Cell(r.FirstRow, r.FirstCol+i)
+		if err != nil {
+			return fmt.Errorf("AddTable: %w", err)
+		}
+		if cell.Type() != CellTypeString || cell.Value != name {
+			cell.SetString(name)
+		}
+	}
+
+	xTable := xlsxTable{
+		Name:        name,
+		DisplayName: name,
+		Ref:         r.String(),
+		TableColumns: xlsxTableColumns{
+			Count:        len(names),
+			TableColumns: make([]xlsxTableColumn, len(names)),
+		},
+		TableStyleInfo: &xlsxTableStyleInfo{
+			Name:              opts.StyleName,
+			ShowFirstColumn:   opts.FirstColumn,
+			ShowLastColumn:    opts.LastColumn,
+			ShowRowStripes:    opts.BandedRows,
+			ShowColumnStripes: opts.BandedColumns,
+		},
+	}
+	if xTable.TableStyleInfo.Name == "" {
+		xTable.TableStyleInfo.Name = "TableStyleMedium2"
+	}
+	filter := *r
+	for i, name := range names {
+		xTable.TableColumns.TableColumns[i] = xlsxTableColumn{ID: i + 1, Name: name}
+	}
+	if opts.TotalsRow {
+		xTable.TotalsRowCount = 1
+		filter.LastRow--
+		if opts.TotalsRowLabel != "" {
+			xTable.TableColumns.TableColumns[0].TotalsRowLabel = opts.TotalsRowLabel
+			cell, err := s.Cell(r.LastRow, r.FirstCol)
+			if err != nil {
+				return fmt.Errorf("AddTable: %w", err)
+			}
+			cell.SetString(opts.TotalsRowLabel)
+		}
+		for column, function := range opts.TotalsRowFunctions {
+			i := columnIndex[strings.ToLower(column)]
+			xTable.TableColumns.TableColumns[i].TotalsRowFunction = string(function)
+			cell, err := s.Cell(r.LastRow, r.FirstCol+i)
+			if err != nil {
+				return fmt.Errorf("AddTable: %w", err)
+			}
+			ref := structuredRef{table: name, columns: []string{names[i]}}
+			cell.SetFormula(fmt.Sprintf("SUBTOTAL(%d,%s)", subtotalFunctions[function], ref.String()))
+		}
+	} else {
+		shown := false
+		xTable.TotalsRowShown = &shown
+	}
+	xTable.AutoFilter = &xlsxAutoFilter{Ref: filter.String()}
+	s.tables = append(s.tables, &table{xlsxTable: xTable})
+	return nil
+}
+
+// readTables returns the tables in the table parts that the
+// relationships of a worksheet refer to.
+func readTables(fi *File, rsheet xlsxSheet, sheetXMLMap map[string]string) ([]*table, error) {
+	wrap := func(err error) ([]*table, error) {
+		return nil, fmt.Errorf("readTables: %w", err)
+	}
+
+	sheetName := worksheetNameForSheet(rsheet, sheetXMLMap)
+	worksheet, ok := fi.worksheets[sheetName]
+	if !ok {
+		return nil, nil
+	}
+	name := normalisePartName(worksheet.Name)
+	rels, err := readRels(fi, name)
+	if err != nil {
+		return wrap(err)
+	}
+	if rels == nil {
+		return nil, nil
+	}
+	var tables []*table
+	for _, rel := range rels.Relationships {
+		if rel.Type != tableRelationshipType {
+			continue
+		}
+		part, ok := fi.parts[resolveRelationshipTarget(path.Dir(name), rel.Target)]
+		if !ok {
+			continue
+		}
+		content, err := readZipPart(part)
+		if err != nil {
+			return wrap(err)
+		}
+		t := &table{raw: content}
+		err = xml.Unmarshal(content, &t.xlsxTable)
+		if err != nil {
+			return wrap(fmt.Errorf("xml.Unmarshal: %w", err))
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// firstNewTableID returns the id to give the first of the tables added
+// by AddTable when the File is written, which follows those of the
+// tables read with it, as the ids of a workbook's tables have to be
+// unique.
+func (f *File) firstNewTableID() int {
+	id := 1
+	for _, sheet := range f.Sheets {
+		for _, t := range sheet.tables {
+			if t.raw != nil && t.ID >= id {
+				id = t.ID + 1
+			}
+		}
+	}
+	return id
+}
+
+// tablePartID matches the id of the table in a table part.
+var tablePartID = regexp.MustCompile(`(<(?:\w+:)?table\b[^>]*?\sid=")(\d+)(")`)
+
+// importTables gives dst, a Sheet of another File, copies of the tables
+// of the Sheet.  The parts of the tables read with the Sheet are
+// copied as they were read, except that a table whose id a table of
+// the File of dst already has is given the next free id.
+func (s *Sheet) importTables(dst *Sheet) {
+	ids := make(map[int]bool)
+	nextID := dst.File.firstNewTableID()
+	for _, sheet := range dst.File.Sheets {
+		for _, t := range sheet.tables {
+			if t.raw != nil {
+				ids[t.ID] = true
+			}
+		}
+	}
+	for _, t := range s.tables {
+		t := *t
+		if t.raw != nil && ids[t.ID] {
+			t.ID = nextID
+			t.raw = tablePartID.ReplaceAll(t.raw, []byte("${1}"+strconv.Itoa(nextID)+"${3}"))
+		}
+		if t.raw != nil {
+			ids[t.ID] = true
+			if t.ID >= nextID {
+				nextID = t.ID + 1
+			}
+		}
+		dst.tables = append(dst.tables, &t)
+	}
+}
+
+// addTables passes a part for each of the tables of the Sheet to
+// writePart, numbering them from next, and adds the relationships to
+// them to rels, which it returns with the number of the next part.
+// The tables added by AddTable are given ids from firstID on, offset
+// by the number of their part.
+func (s *Sheet) addTables(rels *xlsxWorksheetRels, types *xlsxTypes, firstID, next int, writePart func(partName string, part []byte) error) (*xlsxWorksheetRels, int, error) {
+	for _, t := range s.tables {
+		if rels == nil {
+			rels = &xlsxWorksheetRels{XMLName: xml.Name{Local: "Relationships"}}
+		}
+		part := t.raw
+		if part == nil {
+			xTable := t.xlsxTable
+			xTable.ID = firstID + next - 1
+			body, err := xml.Marshal(xTable)
+			if err != nil {
+				return rels, next, fmt.Errorf("xml.Marshal: %w", err)
+			}
+			part = append([]byte(xml.Header), body...)
+		}
+		partName := fmt.Sprintf("xl/tables/table%d.xml", next)
+		err := writePart(partName, part)
+		if err != nil {
+			return rels, next, err
+		}
+		types.Overrides = append(types.Overrides, xlsxOverride{
+			PartName:    "/" + partName,
+			ContentType: tableContentType,
+		})
+		rels.Relationships = append(rels.Relationships, xlsxWorksheetRelation{
+			Id:     fmt.Sprintf("rId%d", len(rels.Relationships)+1),
+			Type:   tableRelationshipType,
+			Target: fmt.Sprintf("../tables/table%d.xml", next),
+		})
+		next++
+	}
+	return rels, next, nil
+}
+
+// makeTableParts refers the worksheet to its tables, if relations has
+// any.
+func (s *Sheet) makeTableParts(worksheet *xlsxWorksheet, relations *xlsxWorksheetRels) {
+	if relations == nil {
+		return
+	}
+	for _, rel := range relations.Relationships {
+		if rel.Type != tableRelationshipType {
+			continue
+		}
+		if worksheet.TableParts == nil {
+			worksheet.TableParts = &xlsxTableParts{}
+		}
+		worksheet.TableParts.Parts = append(worksheet.TableParts.Parts, xlsxTablePart{RelationshipId: rel.Id})
+		worksheet.TableParts.Count++
+	}
+}
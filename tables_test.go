@@ -0,0 +1,145 @@
+package xlsx
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestTableColumnNames(t *testing.T) {
+	c := qt.New(t)
+
+	names := tableColumnNames([]string{"Item", "Amount", "amount", "", "Amount", ""})
+	c.Assert(names, qt.DeepEquals, []string{"Item", "Amount", "amount2", "Column4", "Amount3", "Column6"})
+}
+
+func TestAddTable(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("TableSales")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(sheet.Close)
+		header := sheet.AddRow()
+		header.AddCell().SetString("Item")
+		header.AddCell().SetString("Amount")
+		header.AddCell().SetString("amount")
+		header.AddCell()
+		for i, item := range []string{"tea", "cake", "jam"} {
+			row := sheet.AddRow()
+			row.AddCell().SetString(item)
+			row.AddCell().SetInt(i + 1)
+			row.AddCell().SetInt(10 * (i + 1))
+			row.AddCell().SetString("x")
+		}
+		other, err := f.AddSheet("TableOther")
+		c.Assert(err, qt.IsNil)
+		c.Cleanup(other.Close)
+		other.AddRow().AddCell().SetInt(2021)
+		other.AddRow().AddCell().SetInt(1)
+
+		opts := TableOptions{
+			BandedRows:         true,
+			TotalsRow:          true,
+			TotalsRowLabel:     "Total",
+			TotalsRowFunctions: map[string]TableTotalsFunction{"Amount": TableTotalsSum},
+		}
+		c.Assert(sheet.AddTable("A1:D2", "Sales", opts), qt.ErrorMatches, `AddTable: range A1:D2 has no rows for data`)
+		c.Assert(sheet.AddTable("A1:D5", "A1", opts), qt.Not(qt.IsNil))
+		opts.TotalsRowFunctions["Price"] = TableTotalsSum
+		c.Assert(sheet.AddTable("A1:D5", "Sales", opts), qt.ErrorMatches, `AddTable: table "Sales" has no column "Price"`)
+		delete(opts.TotalsRowFunctions, "Price")
+		c.Assert(sheet.AddTable("A1:D5", "Sales", opts), qt.IsNil)
+		c.Assert(sheet.AddTable("D5:E9", "Overlap", TableOptions{}), qt.ErrorMatches, `AddTable: range D5:E9 overlaps table "Sales"`)
+		c.Assert(other.AddTable("A1:A2", "SALES", TableOptions{}), qt.ErrorMatches, `AddTable: there is already a table called "SALES"`)
+		c.Assert(f.SetDefinedName("sales", "1"), qt.Not(qt.IsNil))
+		c.Assert(other.AddTable("A1:A2", "Years", TableOptions{StyleName: "TableStyleLight9"}), qt.IsNil)
+
+		// The header cells hold the names of the columns, and the
+		// totals row its label and formulas.
+		for col, name := range []string{"Item", "Amount", "amount2", "Column4"} {
+			cell, err := sheet.Cell(0, col)
+			c.Assert(err, qt.IsNil)
+			c.Assert(cell.Value, qt.Equals, name)
+		}
+		year, err := other.Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(year.Type(), qt.Equals, CellTypeString)
+		c.Assert(year.Value, qt.Equals, "2021")
+		label, err := sheet.Cell(4, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(label.Value, qt.Equals, "Total")
+		total, err := sheet.Cell(4, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(total.Formula(), qt.Equals, "SUBTOTAL(109,Sales[Amount])")
+
+		expected := []Table{{
+			Name:       "Sales",
+			Ref:        "A1:D5",
+			Columns:    []string{"Item", "Amount", "amount2", "Column4"},
+			StyleName:  "TableStyleMedium2",
+			BandedRows: true,
+			TotalsRow:  true,
+		}}
+		c.Assert(sheet.Tables(), qt.DeepEquals, expected)
+
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		c.Assert(parts["xl/tables/table1.xml"], qt.Equals, xml.Header+
+			`<table xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" id="1" name="Sales" displayName="Sales" ref="A1:D5" totalsRowCount="1">`+
+			`<autoFilter ref="A1:D4"></autoFilter><tableColumns count="4">`+
+			`<tableColumn id="1" name="Item" totalsRowLabel="Total"></tableColumn>`+
+			`<tableColumn id="2" name="Amount" totalsRowFunction="sum"></tableColumn>`+
+			`<tableColumn id="3" name="amount2"></tableColumn><tableColumn id="4" name="Column4"></tableColumn></tableColumns>`+
+			`<tableStyleInfo name="TableStyleMedium2" showFirstColumn="false" showLastColumn="false" showRowStripes="true" showColumnStripes="false"></tableStyleInfo></table>`)
+		c.Assert(parts["xl/tables/table2.xml"], qt.Contains, `id="2" name="Years" displayName="Years" ref="A1:A2" totalsRowShown="false">`)
+		c.Assert(parts["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*<tableParts count="1"><tablePart r:id="rId1"></tablePart></tableParts></worksheet>`)
+		c.Assert(parts["xl/worksheets/_rels/sheet2.xml.rels"], qt.Contains, `Target="../tables/table2.xml"`)
+		c.Assert(parts["[Content_Types].xml"], qt.Contains, `<Override PartName="/xl/tables/table1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.table+xml">`)
+
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		written := map[string]string{}
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			written[name] = string(body)
+			return name, body
+		})
+		c.Assert(written["xl/tables/table1.xml"], qt.Equals, parts["xl/tables/table1.xml"])
+		c.Assert(written["xl/worksheets/sheet1.xml"], qt.Matches, `(?s).*<tableParts count="1"><tablePart r:id="rId1"(/>|></tablePart>)</tableParts></worksheet>`)
+
+		// The tables of an opened file are kept as they were, and
+		// new ones follow them.
+		f2, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, sheet := range f2.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		sheet2 := f2.Sheet["TableSales"]
+		c.Assert(sheet2.Tables(), qt.DeepEquals, expected)
+		c.Assert(f2.Sheet["TableOther"].Tables(), qt.HasLen, 1)
+		c.Assert(sheet2.AddTable("F1:F2", "sales", TableOptions{}), qt.Not(qt.IsNil))
+		c.Assert(sheet2.AddTable("F1:F2", "Notes", TableOptions{}), qt.IsNil)
+		buf.Reset()
+		c.Assert(f2.Write(&buf), qt.IsNil)
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			switch name {
+			case "xl/tables/table1.xml":
+				c.Assert(string(body), qt.Equals, written[name])
+			case "xl/tables/table2.xml":
+				c.Assert(string(body), qt.Contains, `id="4" name="Notes"`)
+			case "xl/tables/table3.xml":
+				c.Assert(string(body), qt.Equals, written["xl/tables/table2.xml"])
+			}
+			return name, body
+		})
+		f3, err := OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, sheet := range f3.Sheets {
+			c.Cleanup(sheet.Close)
+		}
+		c.Assert(f3.Sheet["TableSales"].Tables(), qt.HasLen, 2)
+	})
+}
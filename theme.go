@@ -3,6 +3,7 @@ package xlsx
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type theme struct {
@@ -28,20 +29,36 @@ func newTheme(themeXml xlsxTheme) *theme {
 }
 
 func (t *theme) themeColor(index int64, tint float64) string {
-	baseColor := t.colors[index]
+	return applyTint("FF"+t.colors[index], tint)
+}
+
+// applyTint lightens (tint > 0) or darkens (tint < 0) an ARGB colour in
+// the way that Excel does, by moving its luminance towards white or
+// black by the given fraction.  The alpha channel is left as it is.  A
+// colour that isn't a valid ARGB or RGB value is returned unchanged.
+func applyTint(argb string, tint float64) string {
 	if tint == 0 {
-		return "FF" + baseColor
+		return argb
+	}
+	alpha, rgb := "FF", argb
+	if len(argb) == 8 {
+		alpha, rgb = argb[0:2], argb[2:]
+	}
+	if len(rgb) != 6 {
+		return argb
+	}
+	r, errR := strconv.ParseUint(rgb[0:2], 16, 8)
+	g, errG := strconv.ParseUint(rgb[2:4], 16, 8)
+	b, errB := strconv.ParseUint(rgb[4:6], 16, 8)
+	if errR != nil || errG != nil || errB != nil {
+		return argb
+	}
+	h, s, l := RGBToHSL(uint8(r), uint8(g), uint8(b))
+	if tint < 0 {
+		l *= 1 + tint
 	} else {
-		r, _ := strconv.ParseInt(baseColor[0:2], 16, 64)
-		g, _ := strconv.ParseInt(baseColor[2:4], 16, 64)
-		b, _ := strconv.ParseInt(baseColor[4:6], 16, 64)
-		h, s, l := RGBToHSL(uint8(r), uint8(g), uint8(b))
-		if tint < 0 {
-			l *= (1 + tint)
-		} else {
-			l = l*(1-tint) + (1 - (1 - tint))
-		}
-		br, bg, bb := HSLToRGB(h, s, l)
-		return fmt.Sprintf("FF%02X%02X%02X", br, bg, bb)
+		l = l*(1-tint) + tint
 	}
+	br, bg, bb := HSLToRGB(h, s, l)
+	return fmt.Sprintf("%s%02X%02X%02X", strings.ToUpper(alpha), br, bg, bb)
 }
@@ -0,0 +1,78 @@
+package xlsx
+
+// version is the semantic version of this build of the library.
+const version = "3.0.0"
+
+// Version returns the semantic version of the xlsx library that has
+// been linked into the program.
+func Version() string {
+	return version
+}
+
+// Feature identifies an optional capability of the library, so that
+// callers can check at runtime whether the linked build supports it.
+type Feature int
+
+// The Feature set is maintained alongside the capabilities themselves:
+// when a new capability is added, add a Feature for it and mark it as
+// supported in supportedFeatures.
+const (
+	FeatureMemoryCellStore Feature = iota
+	FeatureDiskVCellStore
+	FeatureRedisCellStore
+	FeatureDataValidation
+	FeatureRichText
+	FeatureHyperlinks
+	FeatureComments
+	FeatureStreamingWriter
+	FeatureEncryption
+)
+
+// allFeatures lists every Feature constant, in declaration order.
+var allFeatures = []Feature{
+	FeatureMemoryCellStore,
+	FeatureDiskVCellStore,
+	FeatureRedisCellStore,
+	FeatureDataValidation,
+	FeatureRichText,
+	FeatureHyperlinks,
+	FeatureComments,
+	FeatureStreamingWriter,
+	FeatureEncryption,
+}
+
+var featureNames = map[Feature]string{
+	FeatureMemoryCellStore: "MemoryCellStore",
+	FeatureDiskVCellStore:  "DiskVCellStore",
+	FeatureRedisCellStore:  "RedisCellStore",
+	FeatureDataValidation:  "DataValidation",
+	FeatureRichText:        "RichText",
+	FeatureHyperlinks:      "Hyperlinks",
+	FeatureComments:        "Comments",
+	FeatureStreamingWriter: "StreamingWriter",
+	FeatureEncryption:      "Encryption",
+}
+
+var supportedFeatures = map[Feature]bool{
+	FeatureMemoryCellStore: true,
+	FeatureDiskVCellStore:  true,
+	FeatureRedisCellStore:  true,
+	FeatureDataValidation:  true,
+	FeatureRichText:        true,
+	FeatureHyperlinks:      true,
+	FeatureComments:        true,
+}
+
+// String returns the name of the Feature.
+func (f Feature) String() string {
+	if name, ok := featureNames[f]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// Supports returns true if this build of the library supports the
+// given Feature.
+func Supports(feature Feature) bool {
+	return supportedFeatures[feature]
+}
@@ -0,0 +1,102 @@
+package xlsx
+
+import (
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestVersion(t *testing.T) {
+	c := qt.New(t)
+	c.Assert(Version(), qt.Matches, `\d+\.\d+\.\d+`)
+}
+
+// roundTripFeature writes a single cell, decorated by decorate, to a
+// file using the given option, and returns that cell after reading the
+// file back.
+func roundTripFeature(c *qt.C, option FileOption, decorate func(cell *Cell)) *Cell {
+	f := NewFile(option)
+	sheet, err := f.AddSheet("Sheet1")
+	c.Assert(err, qt.IsNil)
+	cell := sheet.AddRow().AddCell()
+	cell.SetString("feature")
+	decorate(cell)
+
+	path := filepath.Join(c.Mkdir(), "feature.xlsx")
+	err = f.Save(path)
+	c.Assert(err, qt.IsNil)
+
+	f, err = OpenFile(path, option)
+	c.Assert(err, qt.IsNil)
+	cell, err = f.Sheets[0].Cell(0, 0)
+	c.Assert(err, qt.IsNil)
+	return cell
+}
+
+func TestSupports(t *testing.T) {
+	c := qt.New(t)
+
+	noop := func(cell *Cell) {}
+
+	// Every supported Feature must have a probe here that exercises
+	// the code path it advertises.
+	probes := map[Feature]func(c *qt.C){
+		FeatureMemoryCellStore: func(c *qt.C) {
+			cell := roundTripFeature(c, UseMemoryCellStore, noop)
+			c.Assert(cell.Value, qt.Equals, "feature")
+		},
+		FeatureDiskVCellStore: func(c *qt.C) {
+			cell := roundTripFeature(c, UseDiskVCellStore, noop)
+			c.Assert(cell.Value, qt.Equals, "feature")
+		},
+		FeatureRedisCellStore: func(c *qt.C) {
+			cell := roundTripFeature(c, UseRedisCellStore(RedisCellStoreOption{RedisAddr: "localhost"}), noop)
+			c.Assert(cell.Value, qt.Equals, "feature")
+		},
+		FeatureDataValidation: func(c *qt.C) {
+			f := NewFile()
+			sheet, err := f.AddSheet("Sheet1")
+			c.Assert(err, qt.IsNil)
+			dv := NewDataValidation(0, 0, 0, 0, true)
+			c.Assert(dv.SetDropList([]string{"a", "b"}), qt.IsNil)
+			sheet.AddDataValidation(dv)
+			c.Assert(sheet.DataValidations, qt.HasLen, 1)
+		},
+		FeatureRichText: func(c *qt.C) {
+			cell := roundTripFeature(c, UseMemoryCellStore, func(cell *Cell) {
+				cell.SetRichText([]RichTextRun{{Text: "rich"}, {Text: "text"}})
+			})
+			c.Assert(cell.RichText, qt.HasLen, 2)
+		},
+		FeatureHyperlinks: func(c *qt.C) {
+			cell := roundTripFeature(c, UseMemoryCellStore, func(cell *Cell) {
+				cell.SetHyperlink("https://example.com", "example", "")
+			})
+			c.Assert(cell.Hyperlink.Link, qt.Equals, "https://example.com")
+		},
+		FeatureComments: func(c *qt.C) {
+			cell := roundTripFeature(c, UseMemoryCellStore, func(cell *Cell) {
+				cell.SetComment("Reviewer", "note")
+			})
+			c.Assert(cell.Comment(), qt.DeepEquals, &Comment{Author: "Reviewer", Text: "note"})
+		},
+	}
+
+	for _, feature := range allFeatures {
+		feature := feature
+		c.Run(feature.String(), func(c *qt.C) {
+			c.Assert(feature.String(), qt.Not(qt.Equals), "Unknown")
+			probe, ok := probes[feature]
+			if !Supports(feature) {
+				c.Assert(ok, qt.IsFalse, qt.Commentf("%s has a probe but is not marked as supported", feature))
+				return
+			}
+			c.Assert(ok, qt.IsTrue, qt.Commentf("%s is supported but has no probe", feature))
+			probe(c)
+		})
+	}
+
+	c.Assert(Supports(Feature(-1)), qt.IsFalse)
+	c.Assert(Feature(-1).String(), qt.Equals, "Unknown")
+}
@@ -0,0 +1,170 @@
+package xlsx
+
+import "fmt"
+
+// WarningCode identifies the kind of problem that a Warning describes.
+// The codes are part of the API: once released, a code keeps its value
+// and meaning, so programs can safely compare against them.  New codes
+// may be added over time.
+type WarningCode string
+
+const (
+	// WarningMissingContentTypes means that the file has no
+	// [Content_Types].xml part.
+	WarningMissingContentTypes WarningCode = "missing-content-types"
+	// WarningWrongContentType means that [Content_Types].xml declares
+	// a part with a content type that doesn't match how it is used.
+	WarningWrongContentType WarningCode = "wrong-content-type"
+	// WarningInvalidCellValue means that the value of a cell couldn't
+	// be read, such as a shared string that doesn't exist, and the
+	// cell was given a placeholder value.
+	WarningInvalidCellValue WarningCode = "invalid-cell-value"
+	// WarningMissingSharedStrings means that the cells of the file
+	// refer to shared strings, but it has no shared string table.  It
+	// is recorded once for the file, and the cells are given
+	// placeholder values.
+	WarningMissingSharedStrings WarningCode = "missing-shared-strings"
+	// WarningCellTextTooLong means that a cell holds more text than
+	// the 32767 characters that Excel allows, and Excel will truncate
+	// it when opening the saved file.
+	WarningCellTextTooLong WarningCode = "cell-text-too-long"
+	// WarningCustomViewsDropped means that the custom views or named
+	// sheet views of a sheet weren't written, because its rows were
+	// inserted or removed after the file was read.
+	WarningCustomViewsDropped WarningCode = "custom-views-dropped"
+	// WarningExtensionsDropped means that the extensions of a sheet
+	// read from a file, such as its sparklines, weren't written,
+	// because its rows were inserted or removed after it was read.
+	WarningExtensionsDropped WarningCode = "extensions-dropped"
+	// WarningStoredCellUnreadable means that the record of a cell
+	// read back from the Redis cell store was malformed, and an empty
+	// cell was used in its place.
+	WarningStoredCellUnreadable WarningCode = "stored-cell-unreadable"
+)
+
+// WarningSeverity says how much a problem described by a Warning
+// affects the content of a file.
+type WarningSeverity int
+
+const (
+	// SeverityNotice is for problems that were worked around without
+	// losing any content.
+	SeverityNotice WarningSeverity = iota
+	// SeverityDataLoss is for problems that cause some content to be
+	// lost or changed.
+	SeverityDataLoss
+)
+
+// String returns the name of the WarningSeverity.
+func (s WarningSeverity) String() string {
+	switch s {
+	case SeverityNotice:
+		return "notice"
+	case SeverityDataLoss:
+		return "data loss"
+	}
+	return fmt.Sprintf("WarningSeverity(%d)", int(s))
+}
+
+// maxCellTextLength is the most characters that Excel allows in a cell.
+const maxCellTextLength = 32767
+
+// Warning describes a problem that was found in a file, and recovered
+// from, whilst reading or writing it.  Reading a file with the
+// StrictParsing option turns these problems into errors instead, as
+// does the WarningsAsErrors option for selected codes.
+type Warning struct {
+	// Code identifies the kind of problem.
+	Code WarningCode
+	// Severity says whether any content was lost because of the problem.
+	Severity WarningSeverity
+	// Part is the name of the package part in which the problem was
+	// found, for example "xl/sharedStrings.xml".
+	Part string
+	// Location is the place in the workbook that the problem affects,
+	// as a reference such as "Sheet1!A1", or empty if the problem
+	// doesn't belong to any one place.
+	Location string
+	// Message describes the problem and how it was handled.
+	Message string
+	// Err is the underlying error, if there is one.
+	Err error
+}
+
+// String returns a human readable description of the Warning.
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Part, w.Message)
+}
+
+// WarningError is the error returned in place of recording a Warning,
+// when the StrictParsing or WarningsAsErrors options ask for problems
+// of its code to be treated as errors.
+type WarningError struct {
+	Warning Warning
+}
+
+// Error returns the description of the underlying error, or, if there
+// isn't one, the Warning's message.
+func (e *WarningError) Error() string {
+	if e.Warning.Err != nil {
+		return e.Warning.Err.Error()
+	}
+	return e.Warning.Message
+}
+
+// Unwrap returns the underlying error of the Warning.
+func (e *WarningError) Unwrap() error {
+	return e.Warning.Err
+}
+
+// StrictParsing is a FileOption that makes reading or writing a file
+// fail when it is malformed in a way that would otherwise be recovered
+// from, with a Warning.
+func StrictParsing(f *File) {
+	f.strict = true
+}
+
+// WarningsAsErrors returns a FileOption that makes reading or writing
+// a file fail, with a *WarningError, when it runs into a problem with
+// one of the given codes.  Problems with other codes are still
+// recorded as Warnings.
+func WarningsAsErrors(codes ...WarningCode) FileOption {
+	return func(f *File) {
+		if f.warningErrors == nil {
+			f.warningErrors = make(map[WarningCode]bool, len(codes))
+		}
+		for _, code := range codes {
+			f.warningErrors[code] = true
+		}
+	}
+}
+
+// Warnings returns the problems that were recovered from whilst
+// reading or writing the File.
+func (f *File) Warnings() []Warning {
+	f.warningsMU.Lock()
+	defer f.warningsMU.Unlock()
+	warnings := make([]Warning, len(f.warnings))
+	copy(warnings, f.warnings)
+	return warnings
+}
+
+// addWarning records a Warning against the File or, if the options of
+// the File ask for its code to be treated as an error, returns it as a
+// *WarningError.  It is safe to call from the goroutines that read
+// sheets concurrently.
+func (f *File) addWarning(w Warning) error {
+	if f.strict || f.warningErrors[w.Code] {
+		return &WarningError{Warning: w}
+	}
+	f.recordWarning(w)
+	return nil
+}
+
+// recordWarning records a Warning against the File whatever its
+// options, for problems found where there's no way to return an error.
+func (f *File) recordWarning(w Warning) {
+	f.warningsMU.Lock()
+	f.warnings = append(f.warnings, w)
+	f.warningsMU.Unlock()
+}
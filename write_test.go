@@ -1,13 +1,18 @@
 package xlsx
 
 import (
+	"bytes"
 	"database/sql"
+	"fmt"
+	"io/ioutil"
 	"math"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	qt "github.com/frankban/quicktest"
+	"github.com/klauspost/compress/zip"
 	"github.com/pkg/profile"
 )
 
@@ -341,3 +346,105 @@ func TestWriteFileWithUnvisitedSheets(t *testing.T) {
 		c.Assert(err, qt.IsNil)
  	})
 }
+
+func TestWriteEmptySheetsAndRows(t *testing.T) {
+	c := qt.New(t)
+
+	// makeFile returns a File with an empty sheet, a sheet whose only
+	// non-empty cell is in its third row, and a sheet whose only row
+	// with anything in it has a default style but no cells.
+	makeFile := func(c *qt.C, option FileOption) *File {
+		f := NewFile(option)
+		_, err := f.AddSheet("EmptySheet")
+		c.Assert(err, qt.IsNil)
+		sheet, err := f.AddSheet("EmptyRowsSheet")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow()
+		sheet.AddRow().AddCell()
+		sheet.AddRow().AddCell().SetString("x")
+		sheet.AddRow().AddCell()
+		sheet, err = f.AddSheet("RowStyleOnlySheet")
+		c.Assert(err, qt.IsNil)
+		sheet.AddRow().AddCell()
+		style := NewStyle()
+		style.Font.Bold = true
+		style.ApplyFont = true
+		sheet.AddRow().SetRowStyle(style)
+		return f
+	}
+
+	assertSheets := func(c *qt.C, sheets []string) {
+		c.Assert(sheets, qt.HasLen, 3)
+		c.Assert(sheets[0], qt.Matches, `(?s).*<dimension ref="A1"/?>.*`)
+		c.Assert(sheets[0], qt.Matches, `(?s).*(<sheetData/>|<sheetData></sheetData>).*`)
+		c.Assert(strings.Contains(sheets[0], "<row"), qt.IsFalse)
+
+		c.Assert(sheets[1], qt.Matches, `(?s).*<dimension ref="A1:A3"/?>.*`)
+		c.Assert(strings.Count(sheets[1], "<row"), qt.Equals, 1)
+		c.Assert(strings.Count(sheets[1], "<c "), qt.Equals, 1)
+		c.Assert(sheets[1], qt.Contains, `<row r="3"`)
+
+		c.Assert(sheets[2], qt.Matches, `(?s).*<dimension ref="A1:A2"/?>.*`)
+		c.Assert(strings.Count(sheets[2], "<row"), qt.Equals, 1)
+		c.Assert(sheets[2], qt.Contains, `<row r="2" s="`)
+	}
+
+	assertReopened := func(c *qt.C, b []byte, option FileOption) {
+		f, err := OpenBinary(b, option, StrictParsing)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.Sheets, qt.HasLen, 3)
+		c.Assert(f.Sheets[0].MaxRow, qt.Equals, 0)
+		c.Assert(f.Sheets[1].MaxRow, qt.Equals, 3)
+		cell, err := f.Sheets[1].Cell(2, 0)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "x")
+		c.Assert(f.Sheets[2].MaxRow, qt.Equals, 2)
+	}
+
+	csRunO(c, "MakeStreamParts", func(c *qt.C, option FileOption) {
+		f := makeFile(c, option)
+		parts, err := f.MakeStreamParts()
+		c.Assert(err, qt.IsNil)
+		assertSheets(c, []string{
+			parts["xl/worksheets/sheet1.xml"],
+			parts["xl/worksheets/sheet2.xml"],
+			parts["xl/worksheets/sheet3.xml"],
+		})
+
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, part := range parts {
+			w, err := zw.Create(name)
+			c.Assert(err, qt.IsNil)
+			_, err = w.Write([]byte(part))
+			c.Assert(err, qt.IsNil)
+		}
+		c.Assert(zw.Close(), qt.IsNil)
+		assertReopened(c, buf.Bytes(), option)
+	})
+
+	csRunO(c, "Write", func(c *qt.C, option FileOption) {
+		f := makeFile(c, option)
+		var buf bytes.Buffer
+		err := f.Write(&buf)
+		c.Assert(err, qt.IsNil)
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		c.Assert(err, qt.IsNil)
+		sheets := make([]string, 3)
+		for _, zf := range zr.File {
+			var i int
+			if _, err := fmt.Sscanf(zf.Name, "xl/worksheets/sheet%d.xml", &i); err != nil {
+				continue
+			}
+			rc, err := zf.Open()
+			c.Assert(err, qt.IsNil)
+			b, err := ioutil.ReadAll(rc)
+			rc.Close()
+			c.Assert(err, qt.IsNil)
+			sheets[i-1] = string(b)
+		}
+		assertSheets(c, sheets)
+		assertReopened(c, buf.Bytes(), option)
+	})
+}
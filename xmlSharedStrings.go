@@ -3,7 +3,10 @@ package xlsx
 import (
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // xlsxSST directly maps the sst element from the namespace
@@ -21,8 +24,28 @@ type xlsxSST struct {
 // currently I have not checked this for completeness - it does as
 // much as I need.
 type xlsxSI struct {
-	T *xlsxT  `xml:"t"`
-	R []xlsxR `xml:"r"`
+	T          *xlsxT            `xml:"t"`
+	R          []xlsxR           `xml:"r"`
+	RPh        []xlsxPhoneticRun `xml:"rPh"`
+	PhoneticPr *xlsxPhoneticPr   `xml:"phoneticPr"`
+}
+
+// xlsxPhoneticRun directly maps the rPh element from the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main, which is
+// a run of phonetic text, such as furigana, for the characters of the
+// text from sb up to eb.
+type xlsxPhoneticRun struct {
+	Sb int   `xml:"sb,attr"`
+	Eb int   `xml:"eb,attr"`
+	T  xlsxT `xml:"t"`
+}
+
+// xlsxPhoneticPr directly maps the phoneticPr element from the
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
+type xlsxPhoneticPr struct {
+	FontID    int    `xml:"fontId,attr"`
+	Type      string `xml:"type,attr,omitempty"`
+	Alignment string `xml:"alignment,attr,omitempty"`
 }
 
 // xlsxR directly maps the r element from the namespace
@@ -109,13 +132,15 @@ type xlsxFloatVal struct {
 
 // xlsxT represents a text. It will be serialized as a XML tag which has character data.
 // Attribute xml:space="preserve" will be added to the XML tag if needed.
+// Characters that XML can't hold are escaped as _xHHHH_, and unescaped again when it is read.
 type xlsxT struct {
 	Text string `xml:",chardata"`
 }
 
 // MarshalXML implements xml.Marshaler interface for xlsxT
 func (t *xlsxT) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
-	if needPreserve(t.Text) {
+	text := escapeXstring(t.Text)
+	if needPreserve(text) {
 		attr := xml.Attr{
 			Name:  xml.Name{Local: "xml:space"},
 			Value: "preserve",
@@ -126,7 +151,7 @@ func (t *xlsxT) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	if err := e.EncodeToken(start); err != nil {
 		return err
 	}
-	if err := e.EncodeToken(xml.CharData(t.Text)); err != nil {
+	if err := e.EncodeToken(xml.CharData(text)); err != nil {
 		return err
 	}
 	if err := e.EncodeToken(xml.EndElement{Name: start.Name}); err != nil {
@@ -135,6 +160,18 @@ func (t *xlsxT) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	return nil
 }
 
+// UnmarshalXML implements xml.Unmarshaler interface for xlsxT
+func (t *xlsxT) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Text string `xml:",chardata"`
+	}
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	t.Text = unescapeXstring(raw.Text)
+	return nil
+}
+
 // getText is a nil-safe utility function that gets a string from xlsxT.
 // If the pointer of xlsxT was nil, returns an empty string.
 func (t *xlsxT) getText() string {
@@ -145,20 +182,92 @@ func (t *xlsxT) getText() string {
 }
 
 // needPreserve determines whether xml:space="preserve" is needed.
+// Without it, Excel strips the whitespace at either end of the text,
+// including a TAB or CR, even though they are serialized as "&#x9;"
+// and "&#xD;", so a string that is all whitespace needs it too.
 func needPreserve(s string) bool {
 	if len(s) == 0 {
 		return false
 	}
-	// Note:
-	// xml:space="preserve" is not needed for CR and TAB
-	// because they are serialized as "&#xD;" and "&#x9;".
-	c := s[0]
-	if c <= 32 && c != 9 && c != 13 {
-		return true
-	}
-	c = s[len(s)-1]
-	if c <= 32 && c != 9 && c != 13 {
+	if s[0] <= 32 || s[len(s)-1] <= 32 {
 		return true
 	}
 	return strings.ContainsRune(s, '\u000a')
 }
+
+// isXMLChar reports whether r can appear in an XML document.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// isXstringEscape reports whether s starts with an escaped character,
+// which is "_x" followed by four hexadecimal digits and "_".
+func isXstringEscape(s string) bool {
+	if len(s) < 7 || s[0] != '_' || s[1] != 'x' || s[6] != '_' {
+		return false
+	}
+	for _, c := range s[2:6] {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// escapeXstring escapes the characters of s that XML can't hold, such
+// as control characters, as _xHHHH_, where HHHH is the code of the
+// character in hexadecimal, which is how Excel stores them.  The
+// underscore of text in s that would be read as such an escape is
+// itself escaped as _x005F_.  Invalid UTF-8 is left as it is.
+func escapeXstring(s string) string {
+	i := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' || c == '_' || c == 0xEF {
+			break
+		}
+	}
+	if i == len(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteString(s[:i])
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteByte(s[i])
+		case !isXMLChar(r):
+			fmt.Fprintf(&b, "_x%04X_", r)
+		case r == '_' && isXstringEscape(s[i:]):
+			b.WriteString("_x005F_")
+		default:
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// unescapeXstring reverses escapeXstring, replacing each _xHHHH_ in s
+// with the character it stands for.
+func unescapeXstring(s string) string {
+	if !strings.Contains(s, "_x") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if isXstringEscape(s[i:]) {
+			n, _ := strconv.ParseUint(s[i+2:i+6], 16, 32)
+			b.WriteRune(rune(n))
+			i += 7
+			continue
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
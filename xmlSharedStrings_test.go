@@ -3,7 +3,9 @@ package xlsx
 import (
 	"bytes"
 	"encoding/xml"
+	"testing"
 
+	qt "github.com/frankban/quicktest"
 	. "gopkg.in/check.v1"
 )
 
@@ -143,6 +145,10 @@ func (s *SharedStringsSuite) TestMarshalSI_T(c *C) {
 	testMarshalSIT(c, "\nabc", "<xlsxSI><t xml:space=\"preserve\">\nabc</t></xlsxSI>")
 	testMarshalSIT(c, "abc\n", "<xlsxSI><t xml:space=\"preserve\">abc\n</t></xlsxSI>")
 	testMarshalSIT(c, "ab\nc", "<xlsxSI><t xml:space=\"preserve\">ab\nc</t></xlsxSI>")
+	testMarshalSIT(c, "\tabc", "<xlsxSI><t xml:space=\"preserve\">&#x9;abc</t></xlsxSI>")
+	testMarshalSIT(c, "abc\r", "<xlsxSI><t xml:space=\"preserve\">abc&#xD;</t></xlsxSI>")
+	testMarshalSIT(c, "a\tb", "<xlsxSI><t>a&#x9;b</t></xlsxSI>")
+	testMarshalSIT(c, "   ", "<xlsxSI><t xml:space=\"preserve\">   </t></xlsxSI>")
 }
 
 func testMarshalSIT(c *C, t string, expected string) {
@@ -208,3 +214,40 @@ func testMarshalSIR(c *C, r xlsxR, expected string) {
 	c.Assert(err, IsNil)
 	c.Assert(string(bytes), Equals, expected)
 }
+
+// TestXstringEscapes tests that characters XML can't hold are escaped
+// as _xHHHH_, and that such escapes are unescaped when they are read.
+func TestXstringEscapes(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Marshal", func(c *qt.C) {
+		for text, expected := range map[string]string{
+			"a\x01b":           "<t>a_x0001_b</t>",
+			"\x00\x1f":         "<t>_x0000__x001F_</t>",
+			"\uffff":           "<t>_xFFFF_</t>",
+			"_x0041_":          "<t>_x005F_x0041_</t>",
+			"_x_ and _x004_":   "<t>_x_ and _x004_</t>",
+			"\x0b padded \x0b": "<t>_x000B_ padded _x000B_</t>",
+			"tab\there":        "<t>tab&#x9;here</t>",
+		} {
+			var b bytes.Buffer
+			err := xml.NewEncoder(&b).EncodeElement(&xlsxT{Text: text}, xml.StartElement{Name: xml.Name{Local: "t"}})
+			c.Assert(err, qt.IsNil)
+			c.Assert(b.String(), qt.Equals, expected, qt.Commentf("%q", text))
+		}
+	})
+
+	c.Run("Unmarshal", func(c *qt.C) {
+		var si xlsxSI
+		err := xml.Unmarshal([]byte(`<si><r><t>line_x000D__x000a_end</t></r><r><t>_x005F_x0041_ _x004_</t></r></si>`), &si)
+		c.Assert(err, qt.IsNil)
+		c.Assert(si.R[0].T.Text, qt.Equals, "line\r\nend")
+		c.Assert(si.R[1].T.Text, qt.Equals, "_x0041_ _x004_")
+	})
+
+	c.Run("RoundTrip", func(c *qt.C) {
+		for _, text := range []string{"", "plain", "\x01\x02", "_x005F_", "__x0041__", "tab\tnew\nline\r", "\ufffe", "\xff_x0041_"} {
+			c.Assert(unescapeXstring(escapeXstring(text)), qt.Equals, text)
+		}
+	})
+}
@@ -46,12 +46,25 @@ var builtInNumFmt = map[int]string{
 	20: "h:mm",
 	21: "h:mm:ss",
 	22: "m/d/yy h:mm",
+	// 27 to 36 and 50 to 58 are the date and time formats of East
+	// Asian versions of Excel, whose codes depend on the language
+	// that Excel runs in.  These are the Japanese ones.
+	27: `[$-411]ge.m.d`,
+	28: `[$-411]ggge"年"m"月"d"日"`,
+	29: `[$-411]ggge"年"m"月"d"日"`,
+	30: "m/d/yy",
+	31: `yyyy"年"m"月"d"日"`,
+	32: `h"時"mm"分"`,
+	33: `h"時"mm"分"ss"秒"`,
+	34: `yyyy"年"m"月"`,
+	35: `m"月"d"日"`,
+	36: `[$-411]ge.m.d`,
 	37: "#,##0 ;(#,##0)",
 	38: "#,##0 ;[red](#,##0)",
 	39: "#,##0.00;(#,##0.00)",
 	40: "#,##0.00;[red](#,##0.00)",
 	41: `_(* #,##0_);_(* \(#,##0\);_(* "-"_);_(@_)`,
-	42: `_("$"* #,##0_);_("$* \(#,##0\);_("$"* "-"_);_(@_)`,
+	42: `_("$"* #,##0_);_("$"* \(#,##0\);_("$"* "-"_);_(@_)`,
 	43: `_(* #,##0.00_);_(* \(#,##0.00\);_(* "-"??_);_(@_)`,
 	44: `_("$"* #,##0.00_);_("$"* \(#,##0.00\);_("$"* "-"??_);_(@_)`,
 	45: "mm:ss",
@@ -59,6 +72,23 @@ var builtInNumFmt = map[int]string{
 	47: "mmss.0",
 	48: "##0.0e+0",
 	49: "@",
+	50: `[$-411]ge.m.d`,
+	51: `[$-411]ggge"年"m"月"d"日"`,
+	52: `yyyy"年"m"月"`,
+	53: `m"月"d"日"`,
+	54: `[$-411]ggge"年"m"月"d"日"`,
+	55: `yyyy"年"m"月"`,
+	56: `m"月"d"日"`,
+	57: `[$-411]ge.m.d`,
+	58: `[$-411]ggge"年"m"月"d"日"`,
+}
+
+// isLocaleBuiltInNumFmt reports whether a built-in number format is
+// one of those whose code depends on the language that Excel runs in.
+// Cells with these formats are written with the format code, rather
+// than the id, so that they look the same in any version of Excel.
+func isLocaleBuiltInNumFmt(numFmtId int) bool {
+	return (numFmtId >= 27 && numFmtId <= 36) || (numFmtId >= 50 && numFmtId <= 58)
 }
 
 // These are the color annotations from number format codes that contain color names.
@@ -78,6 +108,9 @@ var builtInNumFmtInv = make(map[string]int, 40)
 
 func init() {
 	for k, v := range builtInNumFmt {
+		if isLocaleBuiltInNumFmt(k) {
+			continue
+		}
 		builtInNumFmtInv[v] = k
 	}
 }
@@ -184,6 +217,24 @@ type xlsxStyleSheet struct {
 	numFmtRefTable      map[int]xlsxNumFmt
 	parsedNumFmtTableMU sync.RWMutex
 	parsedNumFmtTable   map[string]*parsedNumberFormat
+	// xfIds maps the content of each Style written since the last
+	// reset, with its number format, to the XfId that it was
+	// registered as, so that every distinct Style is turned into xlsx
+	// elements just once per save.  It is keyed by content rather
+	// than by *Style because the DiskV and Redis cell stores make a
+	// new Style for every cell they read, so that the map only grows
+	// with the number of distinct styles, not with that of cells.
+	xfIds map[xfIdKey]int
+	// defaultFontName and defaultFontSize give the font that reset
+	// makes the first in the stylesheet, which is used for every
+	// cell without a style of its own.  They default to Arial 11;
+	// MarshalMinimal defaults to Calibri 11 instead.
+	defaultFontName string
+	defaultFontSize float64
+	// colorSources survives reset, so that the colours of styles
+	// read from the file can still be found when it is saved.
+	colorSourcesMU sync.Mutex
+	colorSources   map[string]xlsxColor
 }
 
 func newXlsxStyleSheet(t *theme) *xlsxStyleSheet {
@@ -199,15 +250,7 @@ func (styles *xlsxStyleSheet) reset() {
 	styles.Borders = xlsxBorders{}
 
 	// Microsoft seems to want Arial 11 defined by default.
-	styles.addFont(
-		xlsxFont{
-			Sz:     xlsxVal{"11"},
-			Family: xlsxVal{"2"},
-			Color:  xlsxColor{Theme: &defaultTheme},
-			Name:   xlsxVal{"Arial"},
-			Scheme: &xlsxVal{"minor"},
-		},
-	)
+	styles.addFont(styles.defaultFont())
 
 	styles.addFill(xlsxFill{PatternFill: xlsxPatternFill{PatternType: "none"}})
 	styles.addFill(xlsxFill{PatternFill: xlsxPatternFill{PatternType: "gray125"}})
@@ -230,6 +273,94 @@ func (styles *xlsxStyleSheet) reset() {
 	styles.numFmtRefTableMU.Lock()
 	styles.numFmtRefTable = nil
 	styles.numFmtRefTableMU.Unlock()
+	styles.resetParsedNumFmtTable()
+	styles.invalidateStyleCache()
+	styles.xfIds = nil
+}
+
+// defaultFont returns the font that cells without a style are shown
+// in.
+func (styles *xlsxStyleSheet) defaultFont() xlsxFont {
+	name, size := "Arial", 11.0
+	if styles.defaultFontName != "" {
+		name = styles.defaultFontName
+	}
+	if styles.defaultFontSize > 0 {
+		size = styles.defaultFontSize
+	}
+	return xlsxFont{
+		Sz:     xlsxVal{strconv.FormatFloat(size, 'f', -1, 64)},
+		Family: xlsxVal{"2"},
+		Color:  xlsxColor{Theme: &defaultTheme},
+		Name:   xlsxVal{name},
+		Scheme: &xlsxVal{"minor"},
+	}
+}
+
+// unformatted returns true if none of the cells written since the
+// last reset needed anything but the default xf.
+func (styles *xlsxStyleSheet) unformatted() bool {
+	return styles.CellXfs.Count <= 1 &&
+		(styles.NumFmts == nil || styles.NumFmts.Count == 0) &&
+		styles.DXfs.Count == 0
+}
+
+// minimalStyleSheet is the stylesheet that Excel writes for a workbook
+// without any formatting, less its extension list.  The %s verbs are
+// the size and name of the default font.
+const minimalStyleSheet = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><fonts count="1"><font><sz val="%s"/><color theme="1"/><name val="%s"/><family val="2"/><scheme val="minor"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/></cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles><dxfs count="0"/><tableStyles count="0" defaultTableStyle="TableStyleMedium2" defaultPivotStyle="PivotStyleLight16"/></styleSheet>`
+
+// MarshalMinimal returns the stylesheet that Excel would write for an
+// unformatted workbook.  Unlike reset, the default font is Calibri 11,
+// as it is in Excel, unless another default font has been set.
+func (styles *xlsxStyleSheet) MarshalMinimal() []byte {
+	name, size := "Calibri", 11.0
+	if styles.defaultFontName != "" {
+		name = styles.defaultFontName
+	}
+	if styles.defaultFontSize > 0 {
+		size = styles.defaultFontSize
+	}
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(name))
+	return []byte(fmt.Sprintf(minimalStyleSheet, strconv.FormatFloat(size, 'f', -1, 64), escaped.String()))
+}
+
+// xfIdKey identifies the content of a Style written with a given
+// number format.  The style's NamedStyleIndex is held as namedStyle,
+// -1 when it is nil, so that equal styles give equal keys.
+type xfIdKey struct {
+	style      Style
+	namedStyle int
+	numFmtId   int
+}
+
+// makeXfIdKey returns the xfIdKey of style written with numFmtId.
+func makeXfIdKey(style *Style, numFmtId int) xfIdKey {
+	key := xfIdKey{style: *style, namedStyle: -1, numFmtId: numFmtId}
+	if style.NamedStyleIndex != nil {
+		key.namedStyle = *style.NamedStyleIndex
+		key.style.NamedStyleIndex = nil
+	}
+	return key
+}
+
+// invalidateStyleCache discards every cached Style, so that subsequent
+// calls to getStyle see the current state of the stylesheet.  It must
+// be called whenever fonts, fills, borders or xfs are changed.
+func (styles *xlsxStyleSheet) invalidateStyleCache() {
+	styles.styleCacheMU.Lock()
+	styles.styleCache = make(map[int]*Style)
+	styles.styleCacheMU.Unlock()
+}
+
+// resetParsedNumFmtTable discards every parsed number format.  It must
+// be called whenever the numFmtRefTable changes.
+func (styles *xlsxStyleSheet) resetParsedNumFmtTable() {
+	styles.parsedNumFmtTableMU.Lock()
+	styles.parsedNumFmtTable = nil
+	styles.parsedNumFmtTableMU.Unlock()
 }
 
 //
@@ -238,25 +369,26 @@ func (styles *xlsxStyleSheet) populateStyleFromXf(style *Style, xf xlsxXf) {
 	style.ApplyFill = xf.ApplyFill
 	style.ApplyFont = xf.ApplyFont
 	style.ApplyAlignment = xf.ApplyAlignment
+	style.QuotePrefix = xf.QuotePrefix
 
 	if xf.BorderId > -1 && xf.BorderId < styles.Borders.Count {
 		var border xlsxBorder
 		border = styles.Borders.Border[xf.BorderId]
 		style.Border.Left = border.Left.Style
-		style.Border.LeftColor = border.Left.Color.RGB
+		style.Border.LeftColor = styles.sourceARGBValue(border.Left.Color)
 		style.Border.Right = border.Right.Style
-		style.Border.RightColor = border.Right.Color.RGB
+		style.Border.RightColor = styles.sourceARGBValue(border.Right.Color)
 		style.Border.Top = border.Top.Style
-		style.Border.TopColor = border.Top.Color.RGB
+		style.Border.TopColor = styles.sourceARGBValue(border.Top.Color)
 		style.Border.Bottom = border.Bottom.Style
-		style.Border.BottomColor = border.Bottom.Color.RGB
+		style.Border.BottomColor = styles.sourceARGBValue(border.Bottom.Color)
 	}
 
 	if xf.FillId > -1 && xf.FillId < styles.Fills.Count {
 		xFill := styles.Fills.Fill[xf.FillId]
 		style.Fill.PatternType = xFill.PatternFill.PatternType
-		style.Fill.FgColor = styles.argbValue(xFill.PatternFill.FgColor)
-		style.Fill.BgColor = styles.argbValue(xFill.PatternFill.BgColor)
+		style.Fill.FgColor = styles.sourceARGBValue(xFill.PatternFill.FgColor)
+		style.Fill.BgColor = styles.sourceARGBValue(xFill.PatternFill.BgColor)
 	}
 
 	if xf.FontId > -1 && xf.FontId < styles.Fonts.Count {
@@ -291,6 +423,8 @@ func (styles *xlsxStyleSheet) populateStyleFromXf(style *Style, xf xlsxXf) {
 	style.Alignment.ShrinkToFit = xf.Alignment.ShrinkToFit
 	style.Alignment.WrapText = xf.Alignment.WrapText
 	style.Alignment.TextRotation = xf.Alignment.TextRotation
+	style.Alignment.ReadingOrder = xf.Alignment.ReadingOrder
+	style.Alignment.JustifyLastLine = xf.Alignment.JustifyLastLine
 
 	if xf.Alignment.Indent != 0 {
 		style.Alignment.Indent = xf.Alignment.Indent
@@ -298,12 +432,15 @@ func (styles *xlsxStyleSheet) populateStyleFromXf(style *Style, xf xlsxXf) {
 
 }
 
+// getStyle returns the Style for the given cellXfs index. The result is
+// always a copy of the cached Style, so callers are free to modify it
+// without changing the appearance of other cells using the same index.
 func (styles *xlsxStyleSheet) getStyle(styleIndex int) *Style {
 	styles.styleCacheMU.RLock()
 	style, ok := styles.styleCache[styleIndex]
 	styles.styleCacheMU.RUnlock()
 	if ok {
-		return style
+		return style.Clone()
 	}
 
 	style = &Style{}
@@ -311,15 +448,11 @@ func (styles *xlsxStyleSheet) getStyle(styleIndex int) *Style {
 	xfCount := styles.CellXfs.Count
 	if styleIndex > -1 && xfCount > 0 && styleIndex < xfCount {
 		xf := styles.CellXfs.Xf[styleIndex]
-		styles.populateStyleFromXf(style, xf)
-		if xf.XfId != nil && styles.CellStyleXfs != nil && *xf.XfId < len(styles.CellStyleXfs.Xf) {
+		if namedStyleXf, ok := styles.namedStyleXf(xf); ok {
 			style.NamedStyleIndex = xf.XfId
-			namedStyleXf := styles.CellStyleXfs.Xf[*xf.XfId]
-			style.ApplyBorder = style.ApplyBorder || namedStyleXf.ApplyBorder
-			style.ApplyFill = style.ApplyFill || namedStyleXf.ApplyFill
-			style.ApplyFont = style.ApplyFont || namedStyleXf.ApplyFont
-			style.ApplyAlignment = style.ApplyAlignment || namedStyleXf.ApplyAlignment
+			xf = inheritNamedStyleXf(xf, namedStyleXf)
 		}
+		styles.populateStyleFromXf(style, xf)
 
 		if xf.Alignment.Vertical != "" {
 			style.Alignment.Vertical = xf.Alignment.Vertical
@@ -330,18 +463,93 @@ func (styles *xlsxStyleSheet) getStyle(styleIndex int) *Style {
 		styles.styleCacheMU.Lock()
 		styles.styleCache[styleIndex] = style
 		styles.styleCacheMU.Unlock()
+		return style.Clone()
 	}
 	return style
 }
 
+// namedStyleXf returns the cellStyleXfs entry that the given cellXfs
+// entry refers to via its xfId, if any.
+func (styles *xlsxStyleSheet) namedStyleXf(xf xlsxXf) (xlsxXf, bool) {
+	if xf.XfId == nil || styles.CellStyleXfs == nil {
+		return xlsxXf{}, false
+	}
+	if *xf.XfId < 0 || *xf.XfId >= len(styles.CellStyleXfs.Xf) {
+		return xlsxXf{}, false
+	}
+	return styles.CellStyleXfs.Xf[*xf.XfId], true
+}
+
+// inheritNamedStyleXf resolves the effective formatting of a cellXfs
+// entry that is based on a named style.  Each of the font, fill, border
+// and number format is taken from the named style when the named style
+// applies it and the cell xf doesn't override it; otherwise the cell
+// xf's own value is used.
+func inheritNamedStyleXf(xf, namedStyleXf xlsxXf) xlsxXf {
+	if namedStyleXf.ApplyFont && !xf.ApplyFont {
+		xf.FontId = namedStyleXf.FontId
+	}
+	if namedStyleXf.ApplyFill && !xf.ApplyFill {
+		xf.FillId = namedStyleXf.FillId
+	}
+	if namedStyleXf.ApplyBorder && !xf.ApplyBorder {
+		xf.BorderId = namedStyleXf.BorderId
+	}
+	if namedStyleXf.ApplyNumberFormat && !xf.ApplyNumberFormat {
+		xf.NumFmtId = namedStyleXf.NumFmtId
+	}
+	xf.ApplyBorder = xf.ApplyBorder || namedStyleXf.ApplyBorder
+	xf.ApplyFill = xf.ApplyFill || namedStyleXf.ApplyFill
+	xf.ApplyFont = xf.ApplyFont || namedStyleXf.ApplyFont
+	xf.ApplyAlignment = xf.ApplyAlignment || namedStyleXf.ApplyAlignment
+	xf.ApplyNumberFormat = xf.ApplyNumberFormat || namedStyleXf.ApplyNumberFormat
+	return xf
+}
+
 func (styles *xlsxStyleSheet) argbValue(color xlsxColor) string {
 	if color.Theme != nil && styles.theme != nil {
 		return styles.theme.themeColor(int64(*color.Theme), color.Tint)
 	}
 	if color.Indexed != nil && styles.Colors != nil {
-		return styles.Colors.indexedColor(*color.Indexed)
+		return applyTint(styles.Colors.indexedColor(*color.Indexed), color.Tint)
 	}
-	return color.RGB
+	if color.RGB == "" {
+		return ""
+	}
+	return applyTint(color.RGB, color.Tint)
+}
+
+// sourceARGBValue is argbValue for the colours of fills and borders.
+// When a theme, indexed or tinted colour is resolved, the colour is
+// remembered so that sourceColor can write it back out as it was read.
+func (styles *xlsxStyleSheet) sourceARGBValue(color xlsxColor) string {
+	argb := styles.argbValue(color)
+	if argb == "" || (color.Theme == nil && color.Indexed == nil && color.Tint == 0) {
+		return argb
+	}
+	styles.colorSourcesMU.Lock()
+	if styles.colorSources == nil {
+		styles.colorSources = make(map[string]xlsxColor)
+	}
+	if _, ok := styles.colorSources[argb]; !ok {
+		styles.colorSources[argb] = color
+	}
+	styles.colorSourcesMU.Unlock()
+	return argb
+}
+
+// sourceColor returns the colour that was read for an ARGB value
+// returned by sourceARGBValue, or color itself if there is none.
+func (styles *xlsxStyleSheet) sourceColor(color xlsxColor) xlsxColor {
+	if color.RGB == "" || color.Theme != nil || color.Indexed != nil {
+		return color
+	}
+	styles.colorSourcesMU.Lock()
+	defer styles.colorSourcesMU.Unlock()
+	if source, ok := styles.colorSources[color.RGB]; ok {
+		return source
+	}
+	return color
 }
 
 // Excel styles can reference number formats that are built-in, all of which
@@ -356,23 +564,7 @@ func getBuiltinNumberFormat(numFmtId int) string {
 }
 
 func (styles *xlsxStyleSheet) getNumberFormat(styleIndex int) (string, *parsedNumberFormat) {
-	var numberFormat string = "general"
-	if styles.CellXfs.Xf != nil {
-		if styleIndex > -1 && styleIndex < styles.CellXfs.Count {
-			xf := styles.CellXfs.Xf[styleIndex]
-			if builtin := getBuiltinNumberFormat(xf.NumFmtId); builtin != "" {
-				numberFormat = builtin
-			} else {
-				styles.numFmtRefTableMU.RLock()
-				if styles.numFmtRefTable != nil {
-					numFmt := styles.numFmtRefTable[xf.NumFmtId]
-					numberFormat = numFmt.FormatCode
-				}
-				styles.numFmtRefTableMU.RUnlock()
-
-			}
-		}
-	}
+	numberFormat := styles.getNumberFormatCode(styleIndex)
 	styles.parsedNumFmtTableMU.RLock()
 	parsedFmt, ok := styles.parsedNumFmtTable[numberFormat]
 	styles.parsedNumFmtTableMU.RUnlock()
@@ -389,6 +581,36 @@ func (styles *xlsxStyleSheet) getNumberFormat(styleIndex int) (string, *parsedNu
 	return numberFormat, parsedFmt
 }
 
+// getNumberFormatCode returns the format code of the number format of
+// the style at styleIndex, without parsing it as getNumberFormat does.
+func (styles *xlsxStyleSheet) getNumberFormatCode(styleIndex int) string {
+	numFmtId := styles.getNumFmtId(styleIndex)
+	if builtin := getBuiltinNumberFormat(numFmtId); builtin != "" {
+		return builtin
+	}
+	var numberFormat string = "general"
+	styles.numFmtRefTableMU.RLock()
+	if styles.numFmtRefTable != nil {
+		numFmt := styles.numFmtRefTable[numFmtId]
+		numberFormat = numFmt.FormatCode
+	}
+	styles.numFmtRefTableMU.RUnlock()
+	return numberFormat
+}
+
+// getNumFmtId returns the id of the number format of the style at
+// styleIndex, or 0, for General, if there is no such style.
+func (styles *xlsxStyleSheet) getNumFmtId(styleIndex int) int {
+	if styles.CellXfs.Xf == nil || styleIndex < 0 || styleIndex >= styles.CellXfs.Count {
+		return 0
+	}
+	xf := styles.CellXfs.Xf[styleIndex]
+	if namedStyleXf, ok := styles.namedStyleXf(xf); ok {
+		xf = inheritNamedStyleXf(xf, namedStyleXf)
+	}
+	return xf.NumFmtId
+}
+
 func (styles *xlsxStyleSheet) addFont(xFont xlsxFont) (index int) {
 	var font xlsxFont
 	if xFont.Name.Val == "" {
@@ -402,6 +624,7 @@ func (styles *xlsxStyleSheet) addFont(xFont xlsxFont) (index int) {
 	styles.Fonts.Font = append(styles.Fonts.Font, xFont)
 	index = styles.Fonts.Count
 	styles.Fonts.Count++
+	styles.invalidateStyleCache()
 	return
 }
 
@@ -415,6 +638,7 @@ func (styles *xlsxStyleSheet) addFill(xFill xlsxFill) (index int) {
 	styles.Fills.Fill = append(styles.Fills.Fill, xFill)
 	index = styles.Fills.Count
 	styles.Fills.Count++
+	styles.invalidateStyleCache()
 	return
 }
 
@@ -427,8 +651,8 @@ func (styles *xlsxStyleSheet) addBorder(xBorder xlsxBorder) (index int) {
 	}
 	styles.Borders.Border = append(styles.Borders.Border, xBorder)
 	index = styles.Borders.Count
-
 	styles.Borders.Count++
+	styles.invalidateStyleCache()
 	return
 }
 
@@ -445,6 +669,7 @@ func (styles *xlsxStyleSheet) addCellStyleXf(xCellStyleXf xlsxXf) (index int) {
 	styles.CellStyleXfs.Xf = append(styles.CellStyleXfs.Xf, xCellStyleXf)
 	index = styles.CellStyleXfs.Count
 	styles.CellStyleXfs.Count++
+	styles.invalidateStyleCache()
 	return
 }
 
@@ -459,46 +684,49 @@ func (styles *xlsxStyleSheet) addCellXf(xCellXf xlsxXf) (index int) {
 	styles.CellXfs.Xf = append(styles.CellXfs.Xf, xCellXf)
 	index = styles.CellXfs.Count
 	styles.CellXfs.Count++
+	styles.invalidateStyleCache()
 	return
 }
 
 // newNumFmt generate a xlsxNumFmt according the format code. When the FormatCode is built in, it will return a xlsxNumFmt with the NumFmtId defined in ECMA document, otherwise it will generate a new NumFmtId greater than 164.
-func (styles *xlsxStyleSheet) newNumFmt(formatCode string) xlsxNumFmt {
+// A format code that isn't already in the stylesheet is only added if it is valid; otherwise an error is returned.
+func (styles *xlsxStyleSheet) newNumFmt(formatCode string) (xlsxNumFmt, error) {
 	if compareFormatString(formatCode, "general") {
-		return xlsxNumFmt{NumFmtId: 0, FormatCode: "general"}
+		return xlsxNumFmt{NumFmtId: 0, FormatCode: "general"}, nil
 	}
 	// built in NumFmts in xmlStyle.go, traverse from the const.
 	numFmtId, ok := builtInNumFmtInv[formatCode]
 	if ok {
-		return xlsxNumFmt{NumFmtId: numFmtId, FormatCode: formatCode}
+		return xlsxNumFmt{NumFmtId: numFmtId, FormatCode: formatCode}, nil
+	}
+
+	if err := validateNumberFormat(formatCode); err != nil {
+		return xlsxNumFmt{}, fmt.Errorf("newNumFmt: %w", err)
 	}
 
+	// The lookup, the choice of an unused NumFmtId and the insertion
+	// all happen under the one lock, so that concurrent calls can
+	// neither add the same format twice nor give two formats one id.
+	styles.numFmtRefTableMU.Lock()
+	defer styles.numFmtRefTableMU.Unlock()
+
 	// find the exist xlsxNumFmt
 	if styles.NumFmts != nil {
 		for _, numFmt := range styles.NumFmts.NumFmt {
 			if formatCode == numFmt.FormatCode {
-				return numFmt
+				return numFmt, nil
 			}
 		}
 	}
 
 	// The user define NumFmtId. The one less than 164 in built in.
 	numFmtId = builtinNumFmtsCount + 1
-
-	for {
-		// get a unused NumFmtId
-		styles.numFmtRefTableMU.RLock()
-		_, ok := styles.numFmtRefTable[numFmtId]
-		styles.numFmtRefTableMU.RUnlock()
-		if ok {
-			numFmtId++
-		} else {
-			// addNumFmt contains locking code, so we don't lock around it.
-			styles.addNumFmt(xlsxNumFmt{NumFmtId: numFmtId, FormatCode: formatCode})
-			break
-		}
+	for styles.numFmtIdInUse(numFmtId) {
+		numFmtId++
 	}
-	return xlsxNumFmt{NumFmtId: numFmtId, FormatCode: formatCode}
+	xNumFmt := xlsxNumFmt{NumFmtId: numFmtId, FormatCode: formatCode}
+	styles.insertNumFmt(xNumFmt)
+	return xNumFmt, nil
 }
 
 // addNumFmt add xlsxNumFmt if its not exist.
@@ -507,24 +735,43 @@ func (styles *xlsxStyleSheet) addNumFmt(xNumFmt xlsxNumFmt) {
 	if xNumFmt.NumFmtId <= builtinNumFmtsCount {
 		return
 	}
-	styles.numFmtRefTableMU.RLock()
-	_, ok := styles.numFmtRefTable[xNumFmt.NumFmtId]
-	styles.numFmtRefTableMU.RUnlock()
-	if !ok {
-		if styles.numFmtRefTable == nil {
-			styles.numFmtRefTableMU.Lock()
-			styles.numFmtRefTable = make(map[int]xlsxNumFmt)
-			styles.numFmtRefTableMU.Unlock()
-		}
-		if styles.NumFmts == nil {
-			styles.NumFmts = &xlsxNumFmts{}
+	styles.numFmtRefTableMU.Lock()
+	defer styles.numFmtRefTableMU.Unlock()
+	if !styles.numFmtIdInUse(xNumFmt.NumFmtId) {
+		styles.insertNumFmt(xNumFmt)
+	}
+}
+
+// numFmtIdInUse returns true if a custom number format already has the
+// given id, whether it is in the numFmtRefTable or only in NumFmts.
+// The caller must hold numFmtRefTableMU.
+func (styles *xlsxStyleSheet) numFmtIdInUse(numFmtId int) bool {
+	if _, ok := styles.numFmtRefTable[numFmtId]; ok {
+		return true
+	}
+	if styles.NumFmts != nil {
+		for _, numFmt := range styles.NumFmts.NumFmt {
+			if numFmt.NumFmtId == numFmtId {
+				return true
+			}
 		}
-		styles.NumFmts.NumFmt = append(styles.NumFmts.NumFmt, xNumFmt)
-		styles.numFmtRefTableMU.Lock()
-		styles.numFmtRefTable[xNumFmt.NumFmtId] = xNumFmt
-		styles.numFmtRefTableMU.Unlock()
-		styles.NumFmts.Count++
 	}
+	return false
+}
+
+// insertNumFmt adds a custom number format to NumFmts and to the
+// numFmtRefTable.  The caller must hold numFmtRefTableMU.
+func (styles *xlsxStyleSheet) insertNumFmt(xNumFmt xlsxNumFmt) {
+	if styles.numFmtRefTable == nil {
+		styles.numFmtRefTable = make(map[int]xlsxNumFmt)
+	}
+	if styles.NumFmts == nil {
+		styles.NumFmts = &xlsxNumFmts{}
+	}
+	styles.NumFmts.NumFmt = append(styles.NumFmts.NumFmt, xNumFmt)
+	styles.numFmtRefTable[xNumFmt.NumFmtId] = xNumFmt
+	styles.NumFmts.Count++
+	styles.resetParsedNumFmtTable()
 }
 
 func (styles *xlsxStyleSheet) Marshal() (string, error) {
@@ -538,36 +785,33 @@ func (styles *xlsxStyleSheet) Marshal() (string, error) {
 		result += xNumFmts
 	}
 
-	outputFontMap := make(map[int]int)
-	xfonts, err := styles.Fonts.Marshal(outputFontMap)
+	xfonts, err := styles.Fonts.Marshal()
 	if err != nil {
 		return "", err
 	}
 	result += xfonts
 
-	outputFillMap := make(map[int]int)
-	xfills, err := styles.Fills.Marshal(outputFillMap)
+	xfills, err := styles.Fills.Marshal()
 	if err != nil {
 		return "", err
 	}
 	result += xfills
 
-	outputBorderMap := make(map[int]int)
-	xborders, err := styles.Borders.Marshal(outputBorderMap)
+	xborders, err := styles.Borders.Marshal()
 	if err != nil {
 		return "", err
 	}
 	result += xborders
 
 	if styles.CellStyleXfs != nil {
-		xcellStyleXfs, err := styles.CellStyleXfs.Marshal(outputBorderMap, outputFillMap, outputFontMap)
+		xcellStyleXfs, err := styles.CellStyleXfs.Marshal()
 		if err != nil {
 			return "", err
 		}
 		result += xcellStyleXfs
 	}
 
-	xcellXfs, err := styles.CellXfs.Marshal(outputBorderMap, outputFillMap, outputFontMap)
+	xcellXfs, err := styles.CellXfs.Marshal()
 	if err != nil {
 		return "", err
 	}
@@ -586,7 +830,6 @@ func (styles *xlsxStyleSheet) Marshal() (string, error) {
 
 func (styles *xlsxStyleSheet) MarshalBytes() ([]byte, error) {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	b.Write(xmlHeader)
 	b.WriteString(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
 
@@ -598,24 +841,21 @@ func (styles *xlsxStyleSheet) MarshalBytes() ([]byte, error) {
 		b.Write(xNumFmts)
 	}
 
-	outputFontMap := make(map[int]int)
-	xfonts := styles.Fonts.MarshalBytes(outputFontMap)
+	xfonts := styles.Fonts.MarshalBytes()
 	b.Write(xfonts)
 
-	outputFillMap := make(map[int]int)
-	xfills := styles.Fills.MarshalBytes(outputFillMap)
+	xfills := styles.Fills.MarshalBytes()
 	b.Write(xfills)
 
-	outputBorderMap := make(map[int]int)
-	xborders := styles.Borders.MarshalBytes(outputBorderMap)
+	xborders := styles.Borders.MarshalBytes()
 	b.Write(xborders)
 
 	if styles.CellStyleXfs != nil {
-		xcellStyleXfs := styles.CellStyleXfs.MarshalBytes(outputBorderMap, outputFillMap, outputFontMap)
+		xcellStyleXfs := styles.CellStyleXfs.MarshalBytes()
 		b.Write(xcellStyleXfs)
 	}
 
-	xcellXfs := styles.CellXfs.MarshalBytes(outputBorderMap, outputFillMap, outputFontMap)
+	xcellXfs := styles.CellXfs.MarshalBytes()
 
 	b.Write(xcellXfs)
 
@@ -627,7 +867,7 @@ func (styles *xlsxStyleSheet) MarshalBytes() ([]byte, error) {
 		b.Write(xcellStyles)
 	}
 	b.WriteString("</styleSheet>")
-	return b.B, nil
+	return releaseBuffer(b), nil
 }
 
 type xlsxDXFs struct {
@@ -661,7 +901,6 @@ func (numFmts *xlsxNumFmts) Marshal() (result string, err error) {
 
 func (numFmts *xlsxNumFmts) MarshalBytes() (result []byte, err error) {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	if numFmts.Count > 0 {
 		b.WriteString(`<numFmts count="`)
 		b.WriteString(strconv.Itoa(numFmts.Count))
@@ -676,7 +915,7 @@ func (numFmts *xlsxNumFmts) MarshalBytes() (result []byte, err error) {
 		}
 		b.WriteString(`</numFmts>`)
 	}
-	return b.B, nil
+	return releaseBuffer(b), nil
 }
 
 // xlsxNumFmt directly maps the numFmt element in the namespace
@@ -699,9 +938,8 @@ func (numFmt *xlsxNumFmt) Marshal() (result string, err error) {
 
 func (numFmt *xlsxNumFmt) MarshalBytes() ([]byte, error) {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	formatCode := bytebufferpool.Get()
-	bytebufferpool.Put(formatCode)
+	defer bytebufferpool.Put(formatCode)
 	if err := xml.EscapeText(formatCode, []byte(numFmt.FormatCode)); err != nil {
 		return nil, err
 	}
@@ -709,7 +947,8 @@ func (numFmt *xlsxNumFmt) MarshalBytes() ([]byte, error) {
 	b.WriteString(strconv.Itoa(numFmt.NumFmtId))
 	b.WriteString(`" formatCode="`)
 	b.Write(formatCode.B)
-	return b.B, nil
+	b.WriteString(`"/>`)
+	return releaseBuffer(b), nil
 }
 
 // xlsxFonts directly maps the fonts element in the namespace
@@ -729,53 +968,35 @@ func (fonts *xlsxFonts) addFont(font xlsxFont) {
 	fonts.Count++
 }
 
-func (fonts *xlsxFonts) Marshal(outputFontMap map[int]int) (result string, err error) {
-	var emittedCount int
-	subparts := ""
-
-	for i, font := range fonts.Font {
+func (fonts *xlsxFonts) Marshal() (result string, err error) {
+	if len(fonts.Font) == 0 {
+		return
+	}
+	result = fmt.Sprintf(`<fonts count="%d">`, len(fonts.Font))
+	for _, font := range fonts.Font {
 		var xfont string
 		xfont, err = font.Marshal()
 		if err != nil {
 			return
 		}
-		if xfont != "" {
-			outputFontMap[i] = emittedCount
-			emittedCount++
-			subparts += xfont
-		}
-	}
-	if emittedCount > 0 {
-		result = fmt.Sprintf(`<fonts count="%d">`, fonts.Count)
-		result += subparts
-		result += `</fonts>`
+		result += xfont
 	}
+	result += `</fonts>`
 	return
 }
 
-func (fonts *xlsxFonts) MarshalBytes(outputFontMap map[int]int) []byte {
+func (fonts *xlsxFonts) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
-	subparts := bytebufferpool.Get()
-	bytebufferpool.Put(subparts)
-	emittedCount := 0
-
-	for i, font := range fonts.Font {
-		xfont := font.MarshalBytes()
-		if len(xfont) > 0 {
-			outputFontMap[i] = emittedCount
-			emittedCount++
-			subparts.Write(xfont)
-		}
-	}
-	if emittedCount > 0 {
+	if len(fonts.Font) > 0 {
 		b.WriteString(`<fonts count="`)
-		b.WriteString(strconv.Itoa(fonts.Count))
+		b.WriteString(strconv.Itoa(len(fonts.Font)))
 		b.WriteString(`">`)
-		b.Write(subparts.B)
+		for _, font := range fonts.Font {
+			b.Write(font.MarshalBytes())
+		}
 		b.WriteString(`</fonts>`)
 	}
-	return b.B
+	return releaseBuffer(b)
 }
 
 // xlsxFont directly maps the font element in the namespace
@@ -848,7 +1069,6 @@ func (font *xlsxFont) Marshal() (result string, err error) {
 
 func (font *xlsxFont) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	b.WriteString("<font>")
 	if font.Sz.Val != "" {
 		b.WriteString(`<sz val="`)
@@ -878,7 +1098,7 @@ func (font *xlsxFont) MarshalBytes() []byte {
 	if font.Color.Theme != nil {
 		b.WriteString(`<color theme="`)
 		b.WriteString(strconv.Itoa(*font.Color.Theme))
-		b.WriteString(`"/>`)
+		b.WriteString(`" />`)
 	}
 	if font.Scheme != nil && font.Scheme.Val != "" {
 		b.WriteString(`<scheme val="`)
@@ -898,7 +1118,7 @@ func (font *xlsxFont) MarshalBytes() []byte {
 		b.WriteString("<strike/>")
 	}
 	b.WriteString("</font>")
-	return b.Bytes()
+	return releaseBuffer(b)
 }
 
 // xlsxVal directly maps the val element in the namespace
@@ -928,53 +1148,33 @@ func (fills *xlsxFills) addFill(fill xlsxFill) {
 	fills.Count++
 }
 
-func (fills *xlsxFills) Marshal(outputFillMap map[int]int) (string, error) {
-	var subparts string
-	var emittedCount int
-	for i, fill := range fills.Fill {
+func (fills *xlsxFills) Marshal() (string, error) {
+	if len(fills.Fill) == 0 {
+		return "", nil
+	}
+	result := fmt.Sprintf(`<fills count="%d">`, len(fills.Fill))
+	for _, fill := range fills.Fill {
 		xfill, err := fill.Marshal()
 		if err != nil {
 			return "", err
 		}
-		if xfill != "" {
-			outputFillMap[i] = emittedCount
-			emittedCount++
-			subparts += xfill
-		}
-	}
-	var result string
-	if emittedCount > 0 {
-		result = fmt.Sprintf(`<fills count="%d">`, emittedCount)
-		result += subparts
-		result += `</fills>`
+		result += xfill
 	}
-	return result, nil
+	return result + `</fills>`, nil
 }
 
-func (fills *xlsxFills) MarshalBytes(outputFillMap map[int]int) []byte {
+func (fills *xlsxFills) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
-	subparts := bytebufferpool.Get()
-	bytebufferpool.Put(subparts)
-	var emittedCount int
-
-	for i, fill := range fills.Fill {
-		xfill := fill.MarshalBytes()
-
-		if len(xfill) > 0 {
-			outputFillMap[i] = emittedCount
-			emittedCount++
-			subparts.Write(xfill)
-		}
-	}
-	if emittedCount > 0 {
+	if len(fills.Fill) > 0 {
 		b.WriteString(`<fills count="`)
-		b.WriteString(strconv.Itoa(emittedCount))
+		b.WriteString(strconv.Itoa(len(fills.Fill)))
 		b.WriteString(`">`)
-		b.Write(subparts.B)
+		for _, fill := range fills.Fill {
+			b.Write(fill.MarshalBytes())
+		}
 		b.WriteString(`</fills>`)
 	}
-	return b.B
+	return releaseBuffer(b)
 }
 
 // xlsxFill directly maps the fill element in the namespace
@@ -989,31 +1189,34 @@ func (fill *xlsxFill) Equals(other xlsxFill) bool {
 	return fill.PatternFill.Equals(other.PatternFill)
 }
 
+// An empty fill is still emitted (as <fill/>) so that the position of
+// every fill, and therefore every fillId that refers to it, is preserved.
 func (fill *xlsxFill) Marshal() (result string, err error) {
-	if fill.PatternFill.PatternType != "" {
-		var xpatternFill string
-		result = `<fill>`
-
-		xpatternFill, err = fill.PatternFill.Marshal()
-		if err != nil {
-			return
-		}
-		result += xpatternFill
-		result += `</fill>`
+	if fill.PatternFill.PatternType == "" {
+		return `<fill/>`, nil
 	}
+	var xpatternFill string
+	result = `<fill>`
+	xpatternFill, err = fill.PatternFill.Marshal()
+	if err != nil {
+		return
+	}
+	result += xpatternFill
+	result += `</fill>`
 	return
 }
 
 func (fill *xlsxFill) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
-	if fill.PatternFill.PatternType != "" {
-		b.WriteString(`<fill>`)
-		xpatternFill := fill.PatternFill.MarshalBytes()
-		b.Write(xpatternFill)
-		b.WriteString(`</fill>`)
+	if fill.PatternFill.PatternType == "" {
+		b.WriteString(`<fill/>`)
+		return releaseBuffer(b)
 	}
-	return b.B
+	b.WriteString(`<fill>`)
+	xpatternFill := fill.PatternFill.MarshalBytes()
+	b.Write(xpatternFill)
+	b.WriteString(`</fill>`)
+	return releaseBuffer(b)
 }
 
 // xlsxPatternFill directly maps the patternFill element in the namespace
@@ -1034,16 +1237,10 @@ func (patternFill *xlsxPatternFill) Marshal() (result string, err error) {
 	result = fmt.Sprintf(`<patternFill patternType="%s"`, patternFill.PatternType)
 	ending := `/>`
 	terminator := ""
-	subparts := ""
-	if patternFill.FgColor.RGB != "" {
-		ending = `>`
-		terminator = "</patternFill>"
-		subparts += fmt.Sprintf(`<fgColor rgb="%s"/>`, patternFill.FgColor.RGB)
-	}
-	if patternFill.BgColor.RGB != "" {
+	subparts := patternFill.FgColor.marshal("fgColor") + patternFill.BgColor.marshal("bgColor")
+	if subparts != "" {
 		ending = `>`
 		terminator = "</patternFill>"
-		subparts += fmt.Sprintf(`<bgColor rgb="%s"/>`, patternFill.BgColor.RGB)
 	}
 	result += ending
 	result += subparts
@@ -1053,7 +1250,6 @@ func (patternFill *xlsxPatternFill) Marshal() (result string, err error) {
 
 func (patternFill *xlsxPatternFill) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	b.WriteString(`<patternFill patternType="`)
 	b.WriteString(patternFill.PatternType)
 	b.WriteByte('"')
@@ -1061,25 +1257,17 @@ func (patternFill *xlsxPatternFill) MarshalBytes() []byte {
 	ending := `/>`
 	terminator := ""
 	subparts := bytebufferpool.Get()
-	bytebufferpool.Put(subparts)
-	if patternFill.FgColor.RGB != "" {
-		ending = `>`
-		terminator = "</patternFill>"
-		subparts.WriteString(`<fgColor rgb="`)
-		subparts.WriteString(patternFill.FgColor.RGB)
-		subparts.WriteString(`"/>`)
-	}
-	if patternFill.BgColor.RGB != "" {
+	defer bytebufferpool.Put(subparts)
+	patternFill.FgColor.marshalBytes(subparts, "fgColor")
+	patternFill.BgColor.marshalBytes(subparts, "bgColor")
+	if subparts.Len() > 0 {
 		ending = `>`
 		terminator = "</patternFill>"
-		subparts.WriteString(`<bgColor rgb="`)
-		subparts.WriteString(patternFill.BgColor.RGB)
-		subparts.WriteString(`"/>`)
 	}
 	b.WriteString(ending)
 	b.Write(subparts.B)
 	b.WriteString(terminator)
-	return b.B
+	return releaseBuffer(b)
 }
 
 // xlsxColor is a common mapping used for both the fgColor and bgColor
@@ -1095,7 +1283,72 @@ type xlsxColor struct {
 }
 
 func (color *xlsxColor) Equals(other xlsxColor) bool {
-	return color.RGB == other.RGB
+	return color.RGB == other.RGB &&
+		intPointerEquals(color.Theme, other.Theme) &&
+		color.Tint == other.Tint &&
+		intPointerEquals(color.Indexed, other.Indexed)
+}
+
+func intPointerEquals(a, b *int) bool {
+	return a == b || (a != nil && b != nil && *a == *b)
+}
+
+// isSet returns true if the colour is given in any of the ways that
+// Excel allows: as an RGB value, a theme colour or an indexed colour.
+func (color *xlsxColor) isSet() bool {
+	return color.RGB != "" || color.Theme != nil || color.Indexed != nil
+}
+
+// marshal returns the colour as an element with the given name, or an
+// empty string if no colour is set.
+func (color *xlsxColor) marshal(name string) string {
+	if !color.isSet() {
+		return ""
+	}
+	result := "<" + name
+	if color.RGB != "" {
+		result += fmt.Sprintf(` rgb="%s"`, color.RGB)
+	}
+	if color.Theme != nil {
+		result += fmt.Sprintf(` theme="%d"`, *color.Theme)
+	}
+	if color.Tint != 0 {
+		result += fmt.Sprintf(` tint="%s"`, strconv.FormatFloat(color.Tint, 'g', -1, 64))
+	}
+	if color.Indexed != nil {
+		result += fmt.Sprintf(` indexed="%d"`, *color.Indexed)
+	}
+	return result + "/>"
+}
+
+// marshalBytes writes the same output as marshal to b.
+func (color *xlsxColor) marshalBytes(b *bytebufferpool.ByteBuffer, name string) {
+	if !color.isSet() {
+		return
+	}
+	b.WriteByte('<')
+	b.WriteString(name)
+	if color.RGB != "" {
+		b.WriteString(` rgb="`)
+		b.WriteString(color.RGB)
+		b.WriteByte('"')
+	}
+	if color.Theme != nil {
+		b.WriteString(` theme="`)
+		b.WriteString(strconv.Itoa(*color.Theme))
+		b.WriteByte('"')
+	}
+	if color.Tint != 0 {
+		b.WriteString(` tint="`)
+		b.WriteString(strconv.FormatFloat(color.Tint, 'g', -1, 64))
+		b.WriteByte('"')
+	}
+	if color.Indexed != nil {
+		b.WriteString(` indexed="`)
+		b.WriteString(strconv.Itoa(*color.Indexed))
+		b.WriteByte('"')
+	}
+	b.WriteString("/>")
 }
 
 // xlsxBorders directly maps the borders element in the namespace
@@ -1113,52 +1366,35 @@ func (borders *xlsxBorders) addBorder(border xlsxBorder) {
 	borders.Count++
 }
 
-func (borders *xlsxBorders) Marshal(outputBorderMap map[int]int) (result string, err error) {
-	result = ""
-	emittedCount := 0
-	subparts := ""
-	for i, border := range borders.Border {
+func (borders *xlsxBorders) Marshal() (result string, err error) {
+	if len(borders.Border) == 0 {
+		return
+	}
+	result = fmt.Sprintf(`<borders count="%d">`, len(borders.Border))
+	for _, border := range borders.Border {
 		var xborder string
 		xborder, err = border.Marshal()
 		if err != nil {
 			return
 		}
-		if xborder != "" {
-			outputBorderMap[i] = emittedCount
-			emittedCount++
-			subparts += xborder
-		}
-	}
-	if emittedCount > 0 {
-		result += fmt.Sprintf(`<borders count="%d">`, emittedCount)
-		result += subparts
-		result += `</borders>`
+		result += xborder
 	}
+	result += `</borders>`
 	return
 }
 
-func (borders *xlsxBorders) MarshalBytes(outputBorderMap map[int]int) []byte {
+func (borders *xlsxBorders) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
-	subparts := bytebufferpool.Get()
-	bytebufferpool.Put(subparts)
-	var emittedCount int
-	for i, border := range borders.Border {
-		xborder := border.MarshalBytes()
-		if len(xborder) > 0 {
-			outputBorderMap[i] = emittedCount
-			emittedCount++
-			subparts.Write(xborder)
-		}
-	}
-	if emittedCount > 0 {
+	if len(borders.Border) > 0 {
 		b.WriteString(`<borders count="`)
-		b.WriteString(strconv.Itoa(emittedCount))
-		b.WriteString(`">"`)
-		b.Write(subparts.B)
+		b.WriteString(strconv.Itoa(len(borders.Border)))
+		b.WriteString(`">`)
+		for _, border := range borders.Border {
+			b.Write(border.MarshalBytes())
+		}
 		b.WriteString(`</borders>`)
 	}
-	return b.B
+	return releaseBuffer(b)
 }
 
 // xlsxBorder directly maps the border element in the namespace
@@ -1183,38 +1419,31 @@ func (border *xlsxBorder) marshalBorderLine(line xlsxLine, name string) string {
 	}
 	subparts := ""
 	subparts += fmt.Sprintf(`<%s style="%s">`, name, line.Style)
-	if line.Color.RGB != "" {
-		subparts += fmt.Sprintf(`<color rgb="%s"/>`, line.Color.RGB)
-	}
+	subparts += line.Color.marshal("color")
 	subparts += fmt.Sprintf(`</%s>`, name)
 	return subparts
 }
 
 func (border *xlsxBorder) marshalBorderLineBytes(line xlsxLine, name string) []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	if line.Style == "" {
 		b.WriteByte('<')
 		b.WriteString(name)
 		b.WriteByte('/')
 		b.WriteByte('>')
-		return b.B
+		return releaseBuffer(b)
 	}
 	b.WriteByte('<')
 	b.WriteString(name)
 	b.WriteString(` style="`)
 	b.WriteString(line.Style)
 	b.WriteString(`">`)
-	if line.Color.RGB != "" {
-		b.WriteString(`<color rgb="`)
-		b.WriteString(line.Color.RGB)
-		b.WriteString(`"/>`)
-	}
+	line.Color.marshalBytes(b, "color")
 	b.WriteByte('<')
 	b.WriteByte('/')
 	b.WriteString(name)
 	b.WriteByte('>')
-	return b.B
+	return releaseBuffer(b)
 }
 
 // To get borders to work correctly in Excel, you have to always start with an
@@ -1233,14 +1462,13 @@ func (border *xlsxBorder) Marshal() (result string, err error) {
 
 func (border *xlsxBorder) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	b.WriteString(`<border>`)
 	b.Write(border.marshalBorderLineBytes(border.Left, "left"))
 	b.Write(border.marshalBorderLineBytes(border.Right, "right"))
 	b.Write(border.marshalBorderLineBytes(border.Top, "top"))
 	b.Write(border.marshalBorderLineBytes(border.Bottom, "bottom"))
 	b.WriteString(`</border>`)
-	return b.B
+	return releaseBuffer(b)
 }
 
 // xlsxLine directly maps the line style element in the namespace
@@ -1281,7 +1509,6 @@ func (cellStyles *xlsxCellStyles) Marshal() (result string, err error) {
 
 func (cellStyles *xlsxCellStyles) MarshalBytes() ([]byte, error) {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	if cellStyles.Count > 0 {
 		b.WriteString(`<cellStyles count="`)
 		b.WriteString(strconv.Itoa(cellStyles.Count))
@@ -1295,7 +1522,7 @@ func (cellStyles *xlsxCellStyles) MarshalBytes() ([]byte, error) {
 		}
 		b.WriteString(`</cellStyles>`)
 	}
-	return b.B, nil
+	return releaseBuffer(b), nil
 
 }
 
@@ -1324,12 +1551,12 @@ func (cellStyleXfs *xlsxCellStyleXfs) addXf(Xf xlsxXf) {
 	cellStyleXfs.Count++
 }
 
-func (cellStyleXfs *xlsxCellStyleXfs) Marshal(outputBorderMap, outputFillMap, outputFontMap map[int]int) (result string, err error) {
+func (cellStyleXfs *xlsxCellStyleXfs) Marshal() (result string, err error) {
 	if cellStyleXfs.Count > 0 {
 		result = fmt.Sprintf(`<cellStyleXfs count="%d">`, cellStyleXfs.Count)
 		for _, xf := range cellStyleXfs.Xf {
 			var xxf string
-			xxf, err = xf.Marshal(outputBorderMap, outputFillMap, outputFontMap)
+			xxf, err = xf.Marshal()
 			if err != nil {
 				return
 			}
@@ -1340,20 +1567,19 @@ func (cellStyleXfs *xlsxCellStyleXfs) Marshal(outputBorderMap, outputFillMap, ou
 	return
 }
 
-func (cellStyleXfs *xlsxCellStyleXfs) MarshalBytes(outputBorderMap, outputFillMap, outputFontMap map[int]int) []byte {
+func (cellStyleXfs *xlsxCellStyleXfs) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	if cellStyleXfs.Count > 0 {
 		b.WriteString(`<cellStyleXfs count="`)
 		b.WriteString(strconv.Itoa(cellStyleXfs.Count))
 		b.WriteString(`">`)
 		for _, xf := range cellStyleXfs.Xf {
-			xxf := xf.MarshalBytes(outputBorderMap, outputFillMap, outputFontMap)
+			xxf := xf.MarshalBytes()
 			b.Write(xxf)
 		}
 		b.WriteString(`</cellStyleXfs>`)
 	}
-	return b.B
+	return releaseBuffer(b)
 }
 
 // xlsxCellXfs directly maps the cellXfs element in the namespace
@@ -1370,12 +1596,12 @@ func (cellXfs *xlsxCellXfs) addXf(Xf xlsxXf) {
 	cellXfs.Count++
 }
 
-func (cellXfs *xlsxCellXfs) Marshal(outputBorderMap, outputFillMap, outputFontMap map[int]int) (result string, err error) {
+func (cellXfs *xlsxCellXfs) Marshal() (result string, err error) {
 	if cellXfs.Count > 0 {
 		result = fmt.Sprintf(`<cellXfs count="%d">`, cellXfs.Count)
 		for _, xf := range cellXfs.Xf {
 			var xxf string
-			xxf, err = xf.Marshal(outputBorderMap, outputFillMap, outputFontMap)
+			xxf, err = xf.Marshal()
 			if err != nil {
 				return
 			}
@@ -1386,20 +1612,19 @@ func (cellXfs *xlsxCellXfs) Marshal(outputBorderMap, outputFillMap, outputFontMa
 	return
 }
 
-func (cellXfs *xlsxCellXfs) MarshalBytes(outputBorderMap, outputFillMap, outputFontMap map[int]int) []byte {
+func (cellXfs *xlsxCellXfs) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	if cellXfs.Count > 0 {
 		b.WriteString(`<cellXfs count="`)
 		b.WriteString(strconv.Itoa(cellXfs.Count))
 		b.WriteString(`">`)
 		for _, xf := range cellXfs.Xf {
-			xxf := xf.MarshalBytes(outputBorderMap, outputFillMap, outputFontMap)
+			xxf := xf.MarshalBytes()
 			b.Write(xxf)
 		}
 		b.WriteString(`</cellXfs>`)
 	}
-	return b.B
+	return releaseBuffer(b)
 }
 
 // xlsxXf directly maps the xf element in the namespace
@@ -1417,6 +1642,7 @@ type xlsxXf struct {
 	FillId            int           `xml:"fillId,attr"`
 	FontId            int           `xml:"fontId,attr"`
 	NumFmtId          int           `xml:"numFmtId,attr"`
+	QuotePrefix       bool          `xml:"quotePrefix,attr,omitempty"`
 	XfId              *int          `xml:"xfId,attr,omitempty"`
 	Alignment         xlsxAlignment `xml:"alignment"`
 }
@@ -1431,14 +1657,18 @@ func (xf *xlsxXf) Equals(other xlsxXf) bool {
 		xf.FillId == other.FillId &&
 		xf.FontId == other.FontId &&
 		xf.NumFmtId == other.NumFmtId &&
+		xf.QuotePrefix == other.QuotePrefix &&
 		(xf.XfId == other.XfId ||
 			((xf.XfId != nil && other.XfId != nil) &&
 				*xf.XfId == *other.XfId)) &&
 		xf.Alignment.Equals(other.Alignment)
 }
 
-func (xf *xlsxXf) Marshal(outputBorderMap, outputFillMap, outputFontMap map[int]int) (result string, err error) {
-	result = fmt.Sprintf(`<xf applyAlignment="%b" applyBorder="%b" applyFont="%b" applyFill="%b" applyNumberFormat="%b" applyProtection="%b" borderId="%d" fillId="%d" fontId="%d" numFmtId="%d"`, bool2Int(xf.ApplyAlignment), bool2Int(xf.ApplyBorder), bool2Int(xf.ApplyFont), bool2Int(xf.ApplyFill), bool2Int(xf.ApplyNumberFormat), bool2Int(xf.ApplyProtection), outputBorderMap[xf.BorderId], outputFillMap[xf.FillId], outputFontMap[xf.FontId], xf.NumFmtId)
+func (xf *xlsxXf) Marshal() (result string, err error) {
+	result = fmt.Sprintf(`<xf applyAlignment="%b" applyBorder="%b" applyFont="%b" applyFill="%b" applyNumberFormat="%b" applyProtection="%b" borderId="%d" fillId="%d" fontId="%d" numFmtId="%d"`, bool2Int(xf.ApplyAlignment), bool2Int(xf.ApplyBorder), bool2Int(xf.ApplyFont), bool2Int(xf.ApplyFill), bool2Int(xf.ApplyNumberFormat), bool2Int(xf.ApplyProtection), xf.BorderId, xf.FillId, xf.FontId, xf.NumFmtId)
+	if xf.QuotePrefix {
+		result += ` quotePrefix="1"`
+	}
 	if xf.XfId != nil {
 		result += fmt.Sprintf(` xfId="%d"`, *xf.XfId)
 	}
@@ -1449,9 +1679,8 @@ func (xf *xlsxXf) Marshal(outputBorderMap, outputFillMap, outputFontMap map[int]
 	}
 	return result + xAlignment + "</xf>", nil
 }
-func (xf *xlsxXf) MarshalBytes(outputBorderMap, outputFillMap, outputFontMap map[int]int) []byte {
+func (xf *xlsxXf) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	b.WriteString(`<xf applyAlignment="`)
 	b.WriteString(strconv.Itoa(bool2Int(xf.ApplyAlignment)))
 	b.WriteString(`" applyBorder="`)
@@ -1465,14 +1694,17 @@ func (xf *xlsxXf) MarshalBytes(outputBorderMap, outputFillMap, outputFontMap map
 	b.WriteString(`" applyProtection="`)
 	b.WriteString(strconv.Itoa(bool2Int(xf.ApplyProtection)))
 	b.WriteString(`" borderId="`)
-	b.WriteString(strconv.Itoa(outputBorderMap[xf.BorderId]))
+	b.WriteString(strconv.Itoa(xf.BorderId))
 	b.WriteString(`" fillId="`)
-	b.WriteString(strconv.Itoa(outputFillMap[xf.FillId]))
+	b.WriteString(strconv.Itoa(xf.FillId))
 	b.WriteString(`" fontId="`)
-	b.WriteString(strconv.Itoa(outputFontMap[xf.FontId]))
-	b.WriteString(` numFmtId="`)
+	b.WriteString(strconv.Itoa(xf.FontId))
+	b.WriteString(`" numFmtId="`)
 	b.WriteString(strconv.Itoa(xf.NumFmtId))
 	b.WriteByte('"')
+	if xf.QuotePrefix {
+		b.WriteString(` quotePrefix="1"`)
+	}
 	if xf.XfId != nil {
 		b.WriteString(` xfId="`)
 		b.WriteString(strconv.Itoa(*xf.XfId))
@@ -1482,21 +1714,25 @@ func (xf *xlsxXf) MarshalBytes(outputBorderMap, outputFillMap, outputFontMap map
 	xAlignment := xf.Alignment.MarshalBytes()
 	b.Write(xAlignment)
 	b.WriteString("</xf>")
-	return b.B
+	return releaseBuffer(b)
 }
 
 type xlsxAlignment struct {
-	Horizontal   string `xml:"horizontal,attr"`
-	Indent       int    `xml:"indent,attr"`
-	ShrinkToFit  bool   `xml:"shrinkToFit,attr"`
-	TextRotation int    `xml:"textRotation,attr"`
-	Vertical     string `xml:"vertical,attr"`
-	WrapText     bool   `xml:"wrapText,attr"`
+	Horizontal      string `xml:"horizontal,attr"`
+	Indent          int    `xml:"indent,attr"`
+	JustifyLastLine bool   `xml:"justifyLastLine,attr,omitempty"`
+	ReadingOrder    int    `xml:"readingOrder,attr,omitempty"`
+	ShrinkToFit     bool   `xml:"shrinkToFit,attr"`
+	TextRotation    int    `xml:"textRotation,attr"`
+	Vertical        string `xml:"vertical,attr"`
+	WrapText        bool   `xml:"wrapText,attr"`
 }
 
 func (alignment *xlsxAlignment) Equals(other xlsxAlignment) bool {
 	return alignment.Horizontal == other.Horizontal &&
 		alignment.Indent == other.Indent &&
+		alignment.JustifyLastLine == other.JustifyLastLine &&
+		alignment.ReadingOrder == other.ReadingOrder &&
 		alignment.ShrinkToFit == other.ShrinkToFit &&
 		alignment.TextRotation == other.TextRotation &&
 		alignment.Vertical == other.Vertical &&
@@ -1510,11 +1746,20 @@ func (alignment *xlsxAlignment) Marshal() (result string, err error) {
 	if alignment.Vertical == "" {
 		alignment.Vertical = "bottom"
 	}
-	return fmt.Sprintf(`<alignment horizontal="%s" indent="%d" shrinkToFit="%b" textRotation="%d" vertical="%s" wrapText="%b"/>`, alignment.Horizontal, alignment.Indent, bool2Int(alignment.ShrinkToFit), alignment.TextRotation, alignment.Vertical, bool2Int(alignment.WrapText)), nil
+	result = fmt.Sprintf(`<alignment horizontal="%s" indent="%d"`, alignment.Horizontal, alignment.Indent)
+	// justifyLastLine and readingOrder are only written when they
+	// differ from their defaults.
+	if alignment.JustifyLastLine {
+		result += ` justifyLastLine="1"`
+	}
+	if alignment.ReadingOrder != 0 {
+		result += fmt.Sprintf(` readingOrder="%d"`, alignment.ReadingOrder)
+	}
+	result += fmt.Sprintf(` shrinkToFit="%b" textRotation="%d" vertical="%s" wrapText="%b"/>`, bool2Int(alignment.ShrinkToFit), alignment.TextRotation, alignment.Vertical, bool2Int(alignment.WrapText))
+	return result, nil
 }
 func (alignment *xlsxAlignment) MarshalBytes() []byte {
 	b := bytebufferpool.Get()
-	bytebufferpool.Put(b)
 	if alignment.Horizontal == "" {
 		alignment.Horizontal = "general"
 	}
@@ -1523,8 +1768,15 @@ func (alignment *xlsxAlignment) MarshalBytes() []byte {
 	}
 	b.WriteString(`<alignment horizontal="`)
 	b.WriteString(alignment.Horizontal)
-	b.WriteString(` indent="`)
+	b.WriteString(`" indent="`)
 	b.WriteString(strconv.Itoa(alignment.Indent))
+	if alignment.JustifyLastLine {
+		b.WriteString(`" justifyLastLine="1`)
+	}
+	if alignment.ReadingOrder != 0 {
+		b.WriteString(`" readingOrder="`)
+		b.WriteString(strconv.Itoa(alignment.ReadingOrder))
+	}
 	b.WriteString(`" shrinkToFit="`)
 	b.WriteString(strconv.Itoa(bool2Int(alignment.ShrinkToFit)))
 	b.WriteString(`" textRotation="`)
@@ -1534,7 +1786,16 @@ func (alignment *xlsxAlignment) MarshalBytes() []byte {
 	b.WriteString(`" wrapText="`)
 	b.WriteString(strconv.Itoa(bool2Int(alignment.WrapText)))
 	b.WriteString(`"/>`)
-	return b.B
+	return releaseBuffer(b)
+}
+
+// releaseBuffer copies the contents of a pooled buffer and returns the
+// buffer to the pool, so the result stays valid once the buffer is reused.
+func releaseBuffer(b *bytebufferpool.ByteBuffer) []byte {
+	result := make([]byte, b.Len())
+	copy(result, b.B)
+	bytebufferpool.Put(b)
+	return result
 }
 
 func bool2Int(b bool) int {
@@ -1,7 +1,14 @@
 package xlsx
 
 import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
 	qt "github.com/frankban/quicktest"
@@ -21,6 +28,48 @@ func TestIndexedColor(t *testing.T) {
 	})
 }
 
+func TestApplyTint(t *testing.T) {
+	c := qt.New(t)
+
+	// The expected values are those that Excel shows for the tints
+	// it offers in its colour picker.
+	cases := []struct {
+		argb     string
+		tint     float64
+		expected string
+	}{
+		{"FF4F81BD", 0, "FF4F81BD"},
+		{"FF4F81BD", 1, "FFFFFFFF"},
+		{"FF4F81BD", -1, "FF000000"},
+		{"FF4F81BD", 0.3999755851924192, "FF95B3D7"},
+		{"FF1F497D", 0.7999816888943144, "FFC6D9F1"},
+		{"FFFFFFFF", -0.149998474074526, "FFD9D9D9"},
+		{"FFFFFFFF", -0.3499862666707358, "FFA6A6A6"},
+		{"804F81BD", 0.3999755851924192, "8095B3D7"},
+		{"4F81BD", 0.3999755851924192, "FF95B3D7"},
+		{"bogus", 0.5, "bogus"},
+	}
+	for _, tc := range cases {
+		c.Assert(applyTint(tc.argb, tc.tint), qt.Equals, tc.expected, qt.Commentf("%s %v", tc.argb, tc.tint))
+	}
+
+	c.Run("ARGBValue", func(c *qt.C) {
+		styles := newXlsxStyleSheet(&theme{colors: []string{
+			"FFFFFF", "000000", "EEECE1", "1F497D", "4F81BD", "C0504D",
+			"9BBB59", "8064A2", "4BACC6", "F79646", "0000FF", "800080",
+		}})
+		styles.Colors = &xlsxColors{IndexedColors: []xlsxRgbColor{{Rgb: "FF4F81BD"}}}
+		themeIndex, indexed := 4, 1
+		tint := 0.3999755851924192
+
+		c.Assert(styles.argbValue(xlsxColor{Theme: &themeIndex, Tint: tint}), qt.Equals, "FF95B3D7")
+		c.Assert(styles.argbValue(xlsxColor{Indexed: &indexed, Tint: tint}), qt.Equals, "FF95B3D7")
+		c.Assert(styles.argbValue(xlsxColor{RGB: "FF4F81BD", Tint: tint}), qt.Equals, "FF95B3D7")
+		c.Assert(styles.argbValue(xlsxColor{RGB: "FF4F81BD"}), qt.Equals, "FF4F81BD")
+		c.Assert(styles.argbValue(xlsxColor{Tint: tint}), qt.Equals, "")
+	})
+}
+
 func TestXMLStyle(t *testing.T) {
 	c := qt.New(t)
 
@@ -366,10 +415,19 @@ func TestStyleSheet(t *testing.T) {
 		styles.NumFmts = &xlsxNumFmts{}
 		styles.NumFmts.NumFmt = make([]xlsxNumFmt, 0)
 
-		c.Assert(styles.newNumFmt("0"), qt.DeepEquals, xlsxNumFmt{1, "0"})
-		c.Assert(styles.newNumFmt("0.00e+00"), qt.DeepEquals, xlsxNumFmt{11, "0.00e+00"})
-		c.Assert(styles.newNumFmt("mm-dd-yy"), qt.DeepEquals, xlsxNumFmt{14, "mm-dd-yy"})
-		c.Assert(styles.newNumFmt("hh:mm:ss"), qt.DeepEquals, xlsxNumFmt{164, "hh:mm:ss"})
+		newNumFmt := func(formatCode string) xlsxNumFmt {
+			numFmt, err := styles.newNumFmt(formatCode)
+			c.Assert(err, qt.IsNil)
+			return numFmt
+		}
+		c.Assert(newNumFmt("0"), qt.DeepEquals, xlsxNumFmt{1, "0"})
+		c.Assert(newNumFmt("0.00e+00"), qt.DeepEquals, xlsxNumFmt{11, "0.00e+00"})
+		c.Assert(newNumFmt("mm-dd-yy"), qt.DeepEquals, xlsxNumFmt{14, "mm-dd-yy"})
+		c.Assert(newNumFmt("hh:mm:ss"), qt.DeepEquals, xlsxNumFmt{164, "hh:mm:ss"})
+		c.Assert(len(styles.NumFmts.NumFmt), qt.Equals, 1)
+
+		_, err := styles.newNumFmt(`0.00 "kr`)
+		c.Assert(err, qt.ErrorMatches, `newNumFmt: invalid number format "0.00 \\"kr": unmatched double quote`)
 		c.Assert(len(styles.NumFmts.NumFmt), qt.Equals, 1)
 	})
 
@@ -390,6 +448,56 @@ func TestStyleSheet(t *testing.T) {
 		c.Assert(styles.NumFmts.Count, qt.Equals, 2)
 	})
 
+	c.Run("NewNumFmtSkipsLoadedIds", func(c *qt.C) {
+		styles := &xlsxStyleSheet{}
+		styles.NumFmts = &xlsxNumFmts{Count: 2, NumFmt: []xlsxNumFmt{{164, "0.000"}, {165, "0.0000"}}}
+		buildNumFmtRefTable(styles)
+		c.Assert(styles.NumFmts.Count, qt.Equals, 2)
+		c.Assert(len(styles.NumFmts.NumFmt), qt.Equals, 2)
+
+		numFmt, err := styles.newNumFmt("0.00000")
+		c.Assert(err, qt.IsNil)
+		c.Assert(numFmt, qt.DeepEquals, xlsxNumFmt{166, "0.00000"})
+
+		// A format that is only in NumFmts is still taken into account.
+		styles.NumFmts.NumFmt = append(styles.NumFmts.NumFmt, xlsxNumFmt{167, "0.0%"})
+		numFmt, err = styles.newNumFmt("0.000%")
+		c.Assert(err, qt.IsNil)
+		c.Assert(numFmt.NumFmtId, qt.Equals, 168)
+	})
+
+	c.Run("NewNumFmtConcurrently", func(c *qt.C) {
+		styles := newXlsxStyleSheet(nil)
+		const goroutines, perGoroutine = 10, 10
+		ids := make([][]int, goroutines)
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < perGoroutine; i++ {
+					numFmt, err := styles.newNumFmt(fmt.Sprintf(`0.00 "unit %d"`, g*perGoroutine+i))
+					if err != nil {
+						panic(err)
+					}
+					ids[g] = append(ids[g], numFmt.NumFmtId)
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		seen := make(map[int]bool)
+		for _, goroutineIds := range ids {
+			for _, id := range goroutineIds {
+				c.Assert(seen[id], qt.IsFalse, qt.Commentf("duplicate id %d", id))
+				seen[id] = true
+			}
+		}
+		c.Assert(seen, qt.HasLen, goroutines*perGoroutine)
+		c.Assert(styles.NumFmts.Count, qt.Equals, goroutines*perGoroutine)
+		c.Assert(len(styles.NumFmts.NumFmt), qt.Equals, goroutines*perGoroutine)
+	})
+
 	c.Run("GetStyle", func(c *qt.C) {
 		c.Run("NoNamedStyleIndex", func(c *qt.C) {
 			styles := newXlsxStyleSheet(nil)
@@ -430,6 +538,63 @@ func TestStyleSheet(t *testing.T) {
 			c.Assert(s0.ApplyFont, qt.Equals, true)
 		})
 
+		c.Run("InheritsFromNamedStyle", func(c *qt.C) {
+			styles := newXlsxStyleSheet(nil)
+			styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Arial"}})
+			styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Courier"}, B: &xlsxVal{}})
+			styles.Fills.addFill(xlsxFill{PatternFill: xlsxPatternFill{PatternType: "none"}})
+			styles.Fills.addFill(xlsxFill{PatternFill: xlsxPatternFill{PatternType: "solid", FgColor: xlsxColor{RGB: "FFFF0000"}}})
+			styles.Borders.addBorder(xlsxBorder{})
+			styles.Borders.addBorder(xlsxBorder{Left: xlsxLine{Style: "thin"}})
+			csXfs := xlsxCellStyleXfs{}
+			csXfs.addXf(xlsxXf{})
+			csXfs.addXf(xlsxXf{
+				ApplyFont:         true,
+				ApplyFill:         true,
+				ApplyBorder:       true,
+				ApplyNumberFormat: true,
+				FontId:            1,
+				FillId:            1,
+				BorderId:          1,
+				NumFmtId:          14,
+			})
+			styles.CellStyleXfs = &csXfs
+			styles.CellXfs.addXf(xlsxXf{XfId: iPtr(1)})
+
+			s0 := styles.getStyle(0)
+			c.Assert(s0.ApplyFont, qt.Equals, true)
+			c.Assert(s0.Font.Name, qt.Equals, "Courier")
+			c.Assert(s0.Font.Bold, qt.Equals, true)
+			c.Assert(s0.Fill.PatternType, qt.Equals, "solid")
+			c.Assert(s0.Fill.FgColor, qt.Equals, "FFFF0000")
+			c.Assert(s0.Border.Left, qt.Equals, "thin")
+
+			numFmt, parsed := styles.getNumberFormat(0)
+			c.Assert(numFmt, qt.Equals, builtInNumFmt[14])
+			c.Assert(parsed.isTimeFormat, qt.Equals, true)
+		})
+
+		c.Run("CellXfOverridesNamedStyle", func(c *qt.C) {
+			styles := newXlsxStyleSheet(nil)
+			styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Arial"}})
+			styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Courier"}})
+			csXfs := xlsxCellStyleXfs{}
+			csXfs.addXf(xlsxXf{ApplyFont: true, ApplyNumberFormat: true, FontId: 1, NumFmtId: 14})
+			styles.CellStyleXfs = &csXfs
+			styles.CellXfs.addXf(xlsxXf{
+				XfId:              iPtr(0),
+				ApplyFont:         true,
+				ApplyNumberFormat: true,
+				FontId:            0,
+				NumFmtId:          2,
+			})
+
+			s0 := styles.getStyle(0)
+			c.Assert(s0.Font.Name, qt.Equals, "Arial")
+			numFmt, _ := styles.getNumberFormat(0)
+			c.Assert(numFmt, qt.Equals, builtInNumFmt[2])
+		})
+
 	})
 
 	c.Run("PopulateStyleFromXf", func(c *qt.C) {
@@ -604,12 +769,14 @@ func TestStyleSheet(t *testing.T) {
 			style := &Style{}
 
 			alignment := xlsxAlignment{
-				Horizontal:   "left",
-				Indent:       10,
-				ShrinkToFit:  true,
-				TextRotation: 80,
-				Vertical:     "top",
-				WrapText:     true,
+				Horizontal:      "left",
+				Indent:          10,
+				JustifyLastLine: true,
+				ReadingOrder:    ReadingOrderRightToLeft,
+				ShrinkToFit:     true,
+				TextRotation:    80,
+				Vertical:        "top",
+				WrapText:        true,
 			}
 			xf := xlsxXf{
 				ApplyAlignment: true,
@@ -622,7 +789,408 @@ func TestStyleSheet(t *testing.T) {
 			c.Assert(style.Alignment.TextRotation, qt.Equals, alignment.TextRotation)
 			c.Assert(style.Alignment.Vertical, qt.Equals, alignment.Vertical)
 			c.Assert(style.Alignment.WrapText, qt.Equals, alignment.WrapText)
+			c.Assert(style.Alignment.ReadingOrder, qt.Equals, alignment.ReadingOrder)
+			c.Assert(style.Alignment.JustifyLastLine, qt.Equals, alignment.JustifyLastLine)
+		})
+
+	})
+}
+
+// Empty fonts, fills and borders must still be written, otherwise the
+// fontId, fillId and borderId references in the xfs would point at the
+// wrong element once the stylesheet is read back.
+func TestStyleSheetRoundTripKeepsIndexes(t *testing.T) {
+	c := qt.New(t)
+
+	makeStyles := func() *xlsxStyleSheet {
+		styles := newXlsxStyleSheet(nil)
+		styles.Fonts.addFont(xlsxFont{})
+		styles.Fonts.addFont(xlsxFont{
+			Sz:   xlsxVal{"10"},
+			Name: xlsxVal{"Courier New"},
+			B:    &xlsxVal{},
+		})
+		styles.Fills.addFill(xlsxFill{})
+		styles.Fills.addFill(xlsxFill{PatternFill: xlsxPatternFill{
+			PatternType: "solid",
+			FgColor:     xlsxColor{RGB: "FF00FF00"},
+		}})
+		styles.Borders.addBorder(xlsxBorder{})
+		styles.Borders.addBorder(xlsxBorder{Left: xlsxLine{Style: "thin"}})
+		styles.CellXfs.addXf(xlsxXf{})
+		styles.CellXfs.addXf(xlsxXf{
+			ApplyBorder: true,
+			ApplyFill:   true,
+			ApplyFont:   true,
+			BorderId:    1,
+			FillId:      1,
+			FontId:      1,
+		})
+		return styles
+	}
+
+	check := func(c *qt.C, output []byte) {
+		styles := newXlsxStyleSheet(nil)
+		err := xml.Unmarshal(output, styles)
+		c.Assert(err, qt.IsNil)
+		c.Assert(styles.Fonts.Font, qt.HasLen, 2)
+		c.Assert(styles.Fills.Fill, qt.HasLen, 2)
+		c.Assert(styles.Borders.Border, qt.HasLen, 2)
+
+		style := styles.getStyle(1)
+		c.Assert(style.Font.Name, qt.Equals, "Courier New")
+		c.Assert(style.Font.Bold, qt.Equals, true)
+		c.Assert(style.Fill.PatternType, qt.Equals, "solid")
+		c.Assert(style.Fill.FgColor, qt.Equals, "FF00FF00")
+		c.Assert(style.Border.Left, qt.Equals, "thin")
+
+		style = styles.getStyle(0)
+		c.Assert(style.Font.Name, qt.Equals, "")
+		c.Assert(style.Fill.PatternType, qt.Equals, "")
+	}
+
+	c.Run("Marshal", func(c *qt.C) {
+		output, err := makeStyles().Marshal()
+		c.Assert(err, qt.IsNil)
+		check(c, []byte(output))
+	})
+
+	c.Run("MarshalBytes", func(c *qt.C) {
+		output, err := makeStyles().MarshalBytes()
+		c.Assert(err, qt.IsNil)
+		check(c, output)
+	})
+
+	c.Run("MarshalAndMarshalBytesAgree", func(c *qt.C) {
+		str, err := makeStyles().Marshal()
+		c.Assert(err, qt.IsNil)
+		b, err := makeStyles().MarshalBytes()
+		c.Assert(err, qt.IsNil)
+		c.Assert(string(b), qt.Equals, str)
+	})
+
+	csRunO(c, "SaveAndReload", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		row := sheet.AddRow()
+		row.AddCell().SetString("plain")
+		cell := row.AddCell()
+		cell.SetString("styled")
+		style := NewStyle()
+		style.Font = Font{Name: "Courier New", Size: 10, Bold: true}
+		style.Fill = Fill{PatternType: "solid", FgColor: "FF00FF00"}
+		style.ApplyFont = true
+		style.ApplyFill = true
+		cell.SetStyle(style)
+
+		path := filepath.Join(c.Mkdir(), "styles.xlsx")
+		err = f.Save(path)
+		c.Assert(err, qt.IsNil)
+
+		f, err = OpenFile(path, option)
+		c.Assert(err, qt.IsNil)
+		cell, err = f.Sheets[0].Cell(0, 1)
+		c.Assert(err, qt.IsNil)
+		c.Assert(cell.Value, qt.Equals, "styled")
+		style = cell.GetStyle()
+		c.Assert(style.Font.Name, qt.Equals, "Courier New")
+		c.Assert(style.Font.Bold, qt.Equals, true)
+		c.Assert(style.Fill.PatternType, qt.Equals, "solid")
+		c.Assert(style.Fill.FgColor, qt.Equals, "FF00FF00")
+	})
+}
+
+func TestGetStyleReturnsACopy(t *testing.T) {
+	c := qt.New(t)
+
+	styles := newXlsxStyleSheet(nil)
+	styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Arial"}})
+	styles.CellXfs.addXf(xlsxXf{ApplyFont: true})
+
+	first := styles.getStyle(0)
+	second := styles.getStyle(0)
+	c.Assert(first, qt.Not(qt.Equals), second)
+	c.Assert(first, qt.DeepEquals, second)
+
+	row := &Row{}
+	cellA := newCell(row, 0)
+	cellB := newCell(row, 1)
+	cellA.SetStyle(first)
+	cellB.SetStyle(second)
+
+	cellA.GetStyle().Font.Bold = true
+	c.Assert(cellA.GetStyle().Font.Bold, qt.Equals, true)
+	c.Assert(cellB.GetStyle().Font.Bold, qt.Equals, false)
+	c.Assert(styles.getStyle(0).Font.Bold, qt.Equals, false)
+}
+
+func TestStyleCacheInvalidation(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("AddFont", func(c *qt.C) {
+		styles := newXlsxStyleSheet(nil)
+		styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Arial"}})
+		styles.CellXfs.addXf(xlsxXf{})
+		styles.CellXfs.addXf(xlsxXf{ApplyFont: true, FontId: 1})
+
+		// Font 1 doesn't exist yet, so the cached style has no font.
+		c.Assert(styles.getStyle(1).Font.Name, qt.Equals, "")
+
+		index := styles.addFont(xlsxFont{Name: xlsxVal{"Courier"}})
+		c.Assert(index, qt.Equals, 1)
+		c.Assert(styles.getStyle(1).Font.Name, qt.Equals, "Courier")
+	})
+
+	c.Run("AddCellXf", func(c *qt.C) {
+		styles := newXlsxStyleSheet(nil)
+		styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Arial"}})
+		styles.CellXfs.addXf(xlsxXf{})
+		c.Assert(styles.getStyle(0).ApplyFont, qt.Equals, false)
+
+		// After a reset, index 1 refers to a freshly added xf.
+		styles.reset()
+		index := styles.addCellXf(xlsxXf{ApplyFont: true})
+		c.Assert(index, qt.Equals, 1)
+		c.Assert(styles.getStyle(0).ApplyFont, qt.Equals, false)
+		c.Assert(styles.getStyle(1).ApplyFont, qt.Equals, true)
+	})
+
+	c.Run("Reset", func(c *qt.C) {
+		styles := newXlsxStyleSheet(nil)
+		styles.Fonts.addFont(xlsxFont{Name: xlsxVal{"Courier"}})
+		styles.CellXfs.addXf(xlsxXf{ApplyFont: true})
+		c.Assert(styles.getStyle(0).Font.Name, qt.Equals, "Courier")
+
+		styles.reset()
+		c.Assert(styles.getStyle(0).Font.Name, qt.Equals, "Arial")
+	})
+
+	c.Run("AddNumFmt", func(c *qt.C) {
+		styles := newXlsxStyleSheet(nil)
+		styles.CellXfs.addXf(xlsxXf{NumFmtId: 164})
+		code, _ := styles.getNumberFormat(0)
+		c.Assert(code, qt.Equals, "general")
+		c.Assert(styles.parsedNumFmtTable, qt.HasLen, 1)
+
+		styles.addNumFmt(xlsxNumFmt{NumFmtId: 164, FormatCode: "0.000"})
+		c.Assert(styles.parsedNumFmtTable, qt.HasLen, 0)
+		code, parsed := styles.getNumberFormat(0)
+		c.Assert(code, qt.Equals, "0.000")
+		c.Assert(parsed.numFmt, qt.Equals, "0.000")
+	})
+}
+
+func TestAlignmentReadingOrderAndJustifyLastLine(t *testing.T) {
+	c := qt.New(t)
+
+	c.Run("Marshal", func(c *qt.C) {
+		alignment := xlsxAlignment{
+			Horizontal:      "distributed",
+			JustifyLastLine: true,
+			ReadingOrder:    ReadingOrderRightToLeft,
+			Vertical:        "top",
+		}
+		expected := `<alignment horizontal="distributed" indent="0" justifyLastLine="1" readingOrder="2" shrinkToFit="0" textRotation="0" vertical="top" wrapText="0"/>`
+		output, err := alignment.Marshal()
+		c.Assert(err, qt.IsNil)
+		c.Assert(output, qt.Equals, expected)
+		outputBytes := alignment.MarshalBytes()
+		c.Assert(string(outputBytes), qt.Equals, expected)
+	})
+
+	c.Run("Equals", func(c *qt.C) {
+		a := xlsxAlignment{Horizontal: "left"}
+		b := a
+		b.ReadingOrder = ReadingOrderRightToLeft
+		c.Assert(a.Equals(b), qt.IsFalse)
+		b = a
+		b.JustifyLastLine = true
+		c.Assert(a.Equals(b), qt.IsFalse)
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("Sheet1")
+		c.Assert(err, qt.IsNil)
+		cell := sheet.AddRow().AddCell()
+		cell.SetString("שלום")
+		style := NewStyle()
+		style.ApplyAlignment = true
+		style.Alignment.Horizontal = "distributed"
+		style.Alignment.ReadingOrder = ReadingOrderRightToLeft
+		style.Alignment.JustifyLastLine = true
+		cell.SetStyle(style)
+
+		dir := c.Mkdir()
+		path := filepath.Join(dir, "first.xlsx")
+		c.Assert(f.Save(path), qt.IsNil)
+
+		// Saving the file a second time must not lose either attribute.
+		f, err = OpenFile(path, option)
+		c.Assert(err, qt.IsNil)
+		path = filepath.Join(dir, "second.xlsx")
+		c.Assert(f.Save(path), qt.IsNil)
+
+		f, err = OpenFile(path, option)
+		c.Assert(err, qt.IsNil)
+		cell, err = f.Sheets[0].Cell(0, 0)
+		c.Assert(err, qt.IsNil)
+		got := cell.GetStyle()
+		c.Assert(got.Alignment.ReadingOrder, qt.Equals, ReadingOrderRightToLeft)
+		c.Assert(got.Alignment.JustifyLastLine, qt.IsTrue)
+	})
+}
+
+func TestXfQuotePrefix(t *testing.T) {
+	c := qt.New(t)
+	xf := xlsxXf{QuotePrefix: true}
+	expected := `<xf applyAlignment="0" applyBorder="0" applyFont="0" applyFill="0" applyNumberFormat="0" applyProtection="0" borderId="0" fillId="0" fontId="0" numFmtId="0" quotePrefix="1"><alignment horizontal="general" indent="0" shrinkToFit="0" textRotation="0" vertical="bottom" wrapText="0"/></xf>`
+	output, err := xf.Marshal()
+	c.Assert(err, qt.IsNil)
+	c.Assert(output, qt.Equals, expected)
+	c.Assert(string(xf.MarshalBytes()), qt.Equals, expected)
+
+	other := xf
+	other.QuotePrefix = false
+	c.Assert(xf.Equals(other), qt.IsFalse)
+
+	var parsed xlsxXf
+	c.Assert(xml.Unmarshal([]byte(expected), &parsed), qt.IsNil)
+	c.Assert(parsed.QuotePrefix, qt.IsTrue)
+}
+
+func TestThemeAndIndexedColors(t *testing.T) {
+	c := qt.New(t)
+	theme := 4
+	indexed := 64
+
+	c.Run("PatternFill", func(c *qt.C) {
+		fill := xlsxPatternFill{
+			PatternType: "solid",
+			FgColor:     xlsxColor{Theme: &theme, Tint: 0.5999938962981048},
+			BgColor:     xlsxColor{Indexed: &indexed},
+		}
+		expected := `<patternFill patternType="solid"><fgColor theme="4" tint="0.5999938962981048"/><bgColor indexed="64"/></patternFill>`
+		output, err := fill.Marshal()
+		c.Assert(err, qt.IsNil)
+		c.Assert(output, qt.Equals, expected)
+		c.Assert(string(fill.MarshalBytes()), qt.Equals, expected)
+	})
+
+	c.Run("Border", func(c *qt.C) {
+		border := xlsxBorder{
+			Left:   xlsxLine{Style: "thin", Color: xlsxColor{Theme: &theme, Tint: -0.25}},
+			Right:  xlsxLine{Style: "thin", Color: xlsxColor{Indexed: &indexed}},
+			Top:    xlsxLine{Style: "thin", Color: xlsxColor{RGB: "FF000000"}},
+			Bottom: xlsxLine{Style: "thin"},
+		}
+		expected := `<border><left style="thin"><color theme="4" tint="-0.25"/></left><right style="thin"><color indexed="64"/></right><top style="thin"><color rgb="FF000000"/></top><bottom style="thin"></bottom></border>`
+		output, err := border.Marshal()
+		c.Assert(err, qt.IsNil)
+		c.Assert(output, qt.Equals, expected)
+		c.Assert(string(border.MarshalBytes()), qt.Equals, expected)
+	})
+
+	c.Run("Equals", func(c *qt.C) {
+		other := 5
+		c.Assert((&xlsxColor{Theme: &theme}).Equals(xlsxColor{Theme: &theme}), qt.IsTrue)
+		c.Assert((&xlsxColor{Theme: &theme}).Equals(xlsxColor{Theme: &other}), qt.IsFalse)
+		c.Assert((&xlsxColor{Theme: &theme}).Equals(xlsxColor{Theme: &theme, Tint: 0.5}), qt.IsFalse)
+		c.Assert((&xlsxColor{Indexed: &indexed}).Equals(xlsxColor{}), qt.IsFalse)
+	})
+
+	csRunO(c, "RoundTrip", func(c *qt.C, option FileOption) {
+		f := NewFile(option)
+		sheet, err := f.AddSheet("ThemeColors")
+		c.Assert(err, qt.IsNil)
+		cell := sheet.AddRow().AddCell()
+		cell.SetString("themed")
+		style := NewStyle()
+		style.Fill = Fill{PatternType: "solid", FgColor: "FF00FF00"}
+		style.Border = Border{Left: "thin", LeftColor: "FF0000FF"}
+		style.ApplyFill = true
+		style.ApplyBorder = true
+		cell.SetStyle(style)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+
+		// Swap the RGB colours for theme colours, as Excel would have
+		// written them.
+		themed := rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/styles.xml" {
+				s := strings.Replace(string(body), `<fgColor rgb="FF00FF00"/>`, `<fgColor theme="4" tint="0.5999938962981048"/>`, 1)
+				s = strings.Replace(s, `<color rgb="FF0000FF"/>`, `<color theme="1" tint="-0.25"/>`, 1)
+				body = []byte(s)
+			}
+			return name, body
+		})
+
+		f, err = OpenBinary(themed, option)
+		c.Assert(err, qt.IsNil)
+		buf.Reset()
+		c.Assert(f.Write(&buf), qt.IsNil)
+		var styles string
+		rewriteXLSX(c, buf.Bytes(), func(name string, body []byte) (string, []byte) {
+			if name == "xl/styles.xml" {
+				styles = string(body)
+			}
+			return name, body
 		})
+		c.Assert(styles, qt.Contains, `<fgColor theme="4" tint="0.5999938962981048"/>`)
+		c.Assert(styles, qt.Contains, `<left style="thin"><color theme="1" tint="-0.25"/></left>`)
+	})
+}
 
+// The stylesheet is rebuilt from the cells' styles whenever a file is
+// saved, so duplicate styles read from a file are merged.
+func TestSaveMergesDuplicateStyles(t *testing.T) {
+	c := qt.New(t)
+
+	csRunO(c, "Save", func(c *qt.C, option FileOption) {
+		// duplicate_styles.xlsx has 300 identical xfs, each with its
+		// own identical font, fill, border and number format, and a
+		// cell using each of them.
+		const duplicates = 300
+		original, err := ioutil.ReadFile("./testdocs/duplicate_styles.xlsx")
+		c.Assert(err, qt.IsNil)
+		partSize := func(xlsx []byte, part string) int {
+			size := -1
+			rewriteXLSX(c, xlsx, func(name string, body []byte) (string, []byte) {
+				if name == part {
+					size = len(body)
+				}
+				return name, body
+			})
+			return size
+		}
+
+		f, err := OpenBinary(original, option)
+		c.Assert(err, qt.IsNil)
+		c.Assert(f.styles.CellXfs.Count, qt.Equals, duplicates+1)
+		var buf bytes.Buffer
+		c.Assert(f.Write(&buf), qt.IsNil)
+		c.Assert(partSize(buf.Bytes(), "xl/styles.xml") < partSize(original, "xl/styles.xml")/10, qt.IsTrue)
+		// The default xf, and one each for the unstyled and the
+		// styled cells read from the file.
+		c.Assert(f.styles.CellXfs.Count, qt.Equals, 3)
+		c.Assert(f.styles.NumFmts.Count, qt.Equals, 1)
+		c.Assert(f.styles.Fills.Count, qt.Equals, 4)
+		c.Assert(f.styles.Borders.Count, qt.Equals, 2)
+
+		f, err = OpenBinary(buf.Bytes(), option)
+		c.Assert(err, qt.IsNil)
+		for _, y := range []int{0, duplicates / 2, duplicates - 1} {
+			cell, err := f.Sheets[0].Cell(y, 0)
+			c.Assert(err, qt.IsNil)
+			value, err := cell.FormattedValue()
+			c.Assert(err, qt.IsNil)
+			c.Assert(value, qt.Equals, fmt.Sprintf("%d.500", y))
+			style := cell.GetStyle()
+			c.Assert(style.Font.Bold, qt.IsTrue)
+			c.Assert(style.Font.Color, qt.Equals, "FFFF0000")
+			c.Assert(style.Fill.FgColor, qt.Equals, "FFFFFF00")
+			c.Assert(style.Border.Left, qt.Equals, "thin")
+		}
 	})
 }
@@ -25,9 +25,10 @@ type xlsxWorkbookRels struct {
 
 // xmlxWorkbookRelation maps sheet id and xl/worksheets/sheet%d.xml
 type xlsxWorkbookRelation struct {
-	Id     string `xml:",attr"`
-	Target string `xml:",attr"`
-	Type   string `xml:",attr"`
+	Id         string `xml:",attr"`
+	Target     string `xml:",attr"`
+	Type       string `xml:",attr"`
+	TargetMode string `xml:",attr,omitempty"`
 }
 
 // xlsxWorkbook directly maps the workbook element from the namespace
@@ -35,14 +36,24 @@ type xlsxWorkbookRelation struct {
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxWorkbook struct {
-	XMLName            xml.Name               `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main workbook"`
-	FileVersion        xlsxFileVersion        `xml:"fileVersion"`
-	WorkbookPr         xlsxWorkbookPr         `xml:"workbookPr"`
-	WorkbookProtection xlsxWorkbookProtection `xml:"workbookProtection"`
-	BookViews          xlsxBookViews          `xml:"bookViews"`
-	Sheets             xlsxSheets             `xml:"sheets"`
-	DefinedNames       xlsxDefinedNames       `xml:"definedNames"`
-	CalcPr             xlsxCalcPr             `xml:"calcPr"`
+	XMLName             xml.Name                 `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main workbook"`
+	FileVersion         xlsxFileVersion          `xml:"fileVersion"`
+	WorkbookPr          xlsxWorkbookPr           `xml:"workbookPr"`
+	WorkbookProtection  xlsxWorkbookProtection   `xml:"workbookProtection"`
+	BookViews           xlsxBookViews            `xml:"bookViews"`
+	Sheets              xlsxSheets               `xml:"sheets"`
+	DefinedNames        xlsxDefinedNames         `xml:"definedNames"`
+	CalcPr              xlsxCalcPr               `xml:"calcPr"`
+	CustomWorkbookViews *xlsxCustomWorkbookViews `xml:"customWorkbookViews,omitempty"`
+	PivotCaches         *xlsxPivotCaches         `xml:"pivotCaches,omitempty"`
+}
+
+// xlsxCustomWorkbookViews holds the content of the customWorkbookViews
+// element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main verbatim,
+// as the custom views are only ever written back out as they were read.
+type xlsxCustomWorkbookViews struct {
+	Content string `xml:",innerxml"`
 }
 
 // xlsxWorkbookProtection directly maps the workbookProtection element from the
@@ -65,14 +76,17 @@ type xlsxFileVersion struct {
 }
 
 // xlsxWorkbookPr directly maps the workbookPr element from the
-// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main
-// - currently I have not checked it for completeness - it does as
-// much as I need.
+// namespace http://schemas.openxmlformats.org/spreadsheetml/2006/main.
+// The attributes that aren't mapped to fields, such as
+// checkCompatibility, are kept in Attrs, so that they survive being
+// written back out.
 type xlsxWorkbookPr struct {
-	DefaultThemeVersion string `xml:"defaultThemeVersion,attr,omitempty"`
-	BackupFile          bool   `xml:"backupFile,attr,omitempty"`
-	ShowObjects         string `xml:"showObjects,attr,omitempty"`
-	Date1904            bool   `xml:"date1904,attr"`
+	DefaultThemeVersion string     `xml:"defaultThemeVersion,attr,omitempty"`
+	BackupFile          bool       `xml:"backupFile,attr,omitempty"`
+	ShowObjects         string     `xml:"showObjects,attr,omitempty"`
+	CodeName            string     `xml:"codeName,attr,omitempty"`
+	Date1904            bool       `xml:"date1904,attr"`
+	Attrs               []xml.Attr `xml:",any,attr"`
 }
 
 // xlsxBookViews directly maps the bookViews element from the
@@ -142,7 +156,7 @@ type xlsxDefinedName struct {
 	Help              string `xml:"help,attr,omitempty"`
 	ShortcutKey       string `xml:"shortcutKey,attr,omitempty"`
 	StatusBar         string `xml:"statusBar,attr,omitempty"`
-	LocalSheetID      int    `xml:"localSheetId,attr,omitempty"`
+	LocalSheetID      *int   `xml:"localSheetId,attr,omitempty"`
 	FunctionGroupID   int    `xml:"functionGroupId,attr,omitempty"`
 	Function          bool   `xml:"function,attr,omitempty"`
 	Hidden            bool   `xml:"hidden,attr,omitempty"`
@@ -157,15 +171,22 @@ type xlsxDefinedName struct {
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxCalcPr struct {
-	CalcId       string  `xml:"calcId,attr,omitempty"`
-	IterateCount int     `xml:"iterateCount,attr,omitempty"`
-	RefMode      string  `xml:"refMode,attr,omitempty"`
-	Iterate      bool    `xml:"iterate,attr,omitempty"`
-	IterateDelta float64 `xml:"iterateDelta,attr,omitempty"`
+	CalcId         string  `xml:"calcId,attr,omitempty"`
+	IterateCount   int     `xml:"iterateCount,attr,omitempty"`
+	RefMode        string  `xml:"refMode,attr,omitempty"`
+	Iterate        bool    `xml:"iterate,attr,omitempty"`
+	IterateDelta   float64 `xml:"iterateDelta,attr,omitempty"`
+	FullCalcOnLoad bool    `xml:"fullCalcOnLoad,attr,omitempty"`
 }
 
 // Helper function to lookup the file corresponding to a xlsxSheet object in the worksheets map
 func worksheetFileForSheet(sheet xlsxSheet, worksheets map[string]*zip.File, sheetXMLMap map[string]string) *zip.File {
+	return worksheets[worksheetNameForSheet(sheet, sheetXMLMap)]
+}
+
+// worksheetNameForSheet returns the name, without its directory or
+// extension, of the worksheet part that holds a sheet.
+func worksheetNameForSheet(sheet xlsxSheet, sheetXMLMap map[string]string) string {
 	sheetName, ok := sheetXMLMap[sheet.Id]
 	if !ok {
 		if sheet.SheetId != "" {
@@ -174,7 +195,7 @@ func worksheetFileForSheet(sheet xlsxSheet, worksheets map[string]*zip.File, she
 			sheetName = fmt.Sprintf("sheet%s", sheet.Id)
 		}
 	}
-	return worksheets[sheetName]
+	return sheetName
 }
 
 // getWorksheetFromSheet() is an internal helper function to open a
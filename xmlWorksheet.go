@@ -41,49 +41,69 @@ type xlsxWorksheetRelation struct {
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxWorksheet struct {
-	XMLName         xml.Name             `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main worksheet"`
-	XMLNSR          string               `xml:"xmlns:r,attr"`
-	SheetPr         xlsxSheetPr          `xml:"sheetPr"`
-	Dimension       xlsxDimension        `xml:"dimension"`
-	SheetViews      xlsxSheetViews       `xml:"sheetViews"`
-	SheetFormatPr   xlsxSheetFormatPr    `xml:"sheetFormatPr"`
-	Cols            *xlsxCols            `xml:"cols,omitempty"`
-	SheetData       xlsxSheetData        `xml:"sheetData"`
-	Hyperlinks      *xlsxHyperlinks      `xml:"hyperlinks,omitempty"`
-	DataValidations *xlsxDataValidations `xml:"dataValidations"`
-	AutoFilter      *xlsxAutoFilter      `xml:"autoFilter,omitempty"`
-	MergeCells      *xlsxMergeCells      `xml:"mergeCells,omitempty"`
-	PrintOptions    *xlsxPrintOptions    `xml:"printOptions,omitempty"`
-	PageMargins     *xlsxPageMargins     `xml:"pageMargins,omitempty"`
-	PageSetUp       *xlsxPageSetUp       `xml:"pageSetup,omitempty"`
-	HeaderFooter    *xlsxHeaderFooter    `xml:"headerFooter,omitempty"`
+	XMLName          xml.Name              `xml:"http://schemas.openxmlformats.org/spreadsheetml/2006/main worksheet"`
+	XMLNSR           string                `xml:"xmlns:r,attr"`
+	SheetPr          xlsxSheetPr           `xml:"sheetPr"`
+	Dimension        xlsxDimension         `xml:"dimension"`
+	SheetViews       xlsxSheetViews        `xml:"sheetViews"`
+	SheetFormatPr    xlsxSheetFormatPr     `xml:"sheetFormatPr"`
+	Cols             *xlsxCols             `xml:"cols,omitempty"`
+	SheetData        xlsxSheetData         `xml:"sheetData"`
+	SheetProtection  *xlsxSheetProtection  `xml:"sheetProtection,omitempty"`
+	AutoFilter       *xlsxAutoFilter       `xml:"autoFilter,omitempty"`
+	CustomSheetViews *xlsxCustomSheetViews `xml:"customSheetViews,omitempty"`
+	MergeCells       *xlsxMergeCells       `xml:"mergeCells,omitempty"`
+	DataValidations  *xlsxDataValidations  `xml:"dataValidations"`
+	Hyperlinks       *xlsxHyperlinks       `xml:"hyperlinks,omitempty"`
+	PrintOptions     *xlsxPrintOptions     `xml:"printOptions,omitempty"`
+	PageMargins      *xlsxPageMargins      `xml:"pageMargins,omitempty"`
+	PageSetUp        *xlsxPageSetUp        `xml:"pageSetup,omitempty"`
+	HeaderFooter     *xlsxHeaderFooter     `xml:"headerFooter,omitempty"`
+	Drawing          *xlsxDrawing          `xml:"drawing,omitempty"`
+	LegacyDrawing    *xlsxLegacyDrawing    `xml:"legacyDrawing,omitempty"`
+	TableParts       *xlsxTableParts       `xml:"tableParts,omitempty"`
+	ExtLst           *xlsxExtLst           `xml:"extLst,omitempty"`
 }
 
-// xlsxHeaderFooter directly maps the headerFooter element in the namespace
-// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
-// currently I have not checked it for completeness - it does as much
-// as I need.
-type xlsxHeaderFooter struct {
-	DifferentFirst   *bool           `xml:"differentFirst,attr,omitempty"`
-	DifferentOddEven *bool           `xml:"differentOddEven,attr,omitempty"`
-	OddHeader        []xlsxOddHeader `xml:"oddHeader"`
-	OddFooter        []xlsxOddFooter `xml:"oddFooter"`
+// xlsxCustomSheetViews holds the content of the customSheetViews
+// element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main verbatim,
+// as the custom views are only ever written back out as they were read.
+type xlsxCustomSheetViews struct {
+	Content string `xml:",innerxml"`
 }
 
-// xlsxOddHeader directly maps the oddHeader element in the namespace
-// http://schemas.openxmlformats.org/spreadsheetml/2006/main -
-// currently I have not checked it for completeness - it does as much
-// as I need.
-type xlsxOddHeader struct {
-	Content string `xml:",chardata"`
+// xlsxExtLst directly maps the extLst element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main.  Its ext
+// elements are read, but it is written from Content, verbatim.
+type xlsxExtLst struct {
+	Ext     []xlsxExt `xml:"ext"`
+	Content string    `xml:",innerxml"`
+}
+
+// xlsxExt directly maps the ext element, an extension to the worksheet
+// identified by its URI.
+type xlsxExt struct {
+	URI     string     `xml:"uri,attr"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Content string     `xml:",innerxml"`
 }
 
-// xlsxOddFooter directly maps the oddFooter element in the namespace
+// xlsxHeaderFooter directly maps the headerFooter element in the namespace
 // http://schemas.openxmlformats.org/spreadsheetml/2006/main -
 // currently I have not checked it for completeness - it does as much
 // as I need.
-type xlsxOddFooter struct {
-	Content string `xml:",chardata"`
+type xlsxHeaderFooter struct {
+	DifferentOddEven bool   `xml:"differentOddEven,attr,omitempty"`
+	DifferentFirst   bool   `xml:"differentFirst,attr,omitempty"`
+	ScaleWithDoc     *bool  `xml:"scaleWithDoc,attr,omitempty"`
+	AlignWithMargins *bool  `xml:"alignWithMargins,attr,omitempty"`
+	OddHeader        string `xml:"oddHeader,omitempty"`
+	OddFooter        string `xml:"oddFooter,omitempty"`
+	EvenHeader       string `xml:"evenHeader,omitempty"`
+	EvenFooter       string `xml:"evenFooter,omitempty"`
+	FirstHeader      string `xml:"firstHeader,omitempty"`
+	FirstFooter      string `xml:"firstFooter,omitempty"`
 }
 
 // xlsxPageSetUp directly maps the pageSetup element in the namespace
@@ -91,21 +111,21 @@ type xlsxOddFooter struct {
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxPageSetUp struct {
-	PaperSize          string  `xml:"paperSize,attr"`
-	Scale              int     `xml:"scale,attr"`
-	FirstPageNumber    int     `xml:"firstPageNumber,attr"`
-	FitToWidth         int     `xml:"fitToWidth,attr"`
-	FitToHeight        int     `xml:"fitToHeight,attr"`
-	PageOrder          string  `xml:"pageOrder,attr"`
-	Orientation        string  `xml:"orientation,attr"`
-	UsePrinterDefaults bool    `xml:"usePrinterDefaults,attr"`
-	BlackAndWhite      bool    `xml:"blackAndWhite,attr"`
-	Draft              bool    `xml:"draft,attr"`
-	CellComments       string  `xml:"cellComments,attr"`
-	UseFirstPageNumber bool    `xml:"useFirstPageNumber,attr"`
-	HorizontalDPI      float32 `xml:"horizontalDpi,attr"`
-	VerticalDPI        float32 `xml:"verticalDpi,attr"`
-	Copies             int     `xml:"copies,attr"`
+	PaperSize          int     `xml:"paperSize,attr,omitempty"`
+	Scale              int     `xml:"scale,attr,omitempty"`
+	FirstPageNumber    int     `xml:"firstPageNumber,attr,omitempty"`
+	FitToWidth         *int    `xml:"fitToWidth,attr,omitempty"`
+	FitToHeight        *int    `xml:"fitToHeight,attr,omitempty"`
+	PageOrder          string  `xml:"pageOrder,attr,omitempty"`
+	Orientation        string  `xml:"orientation,attr,omitempty"`
+	UsePrinterDefaults bool    `xml:"usePrinterDefaults,attr,omitempty"`
+	BlackAndWhite      bool    `xml:"blackAndWhite,attr,omitempty"`
+	Draft              bool    `xml:"draft,attr,omitempty"`
+	CellComments       string  `xml:"cellComments,attr,omitempty"`
+	UseFirstPageNumber bool    `xml:"useFirstPageNumber,attr,omitempty"`
+	HorizontalDPI      float32 `xml:"horizontalDpi,attr,omitempty"`
+	VerticalDPI        float32 `xml:"verticalDpi,attr,omitempty"`
+	Copies             int     `xml:"copies,attr,omitempty"`
 }
 
 // xlsxPrintOptions directly maps the printOptions element in the namespace
@@ -113,24 +133,25 @@ type xlsxPageSetUp struct {
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxPrintOptions struct {
-	Headings           bool `xml:"headings,attr"`
-	GridLines          bool `xml:"gridLines,attr"`
-	GridLinesSet       bool `xml:"gridLinesSet,attr"`
-	HorizontalCentered bool `xml:"horizontalCentered,attr"`
-	VerticalCentered   bool `xml:"verticalCentered,attr"`
+	Headings           bool `xml:"headings,attr,omitempty"`
+	GridLines          bool `xml:"gridLines,attr,omitempty"`
+	GridLinesSet       bool `xml:"gridLinesSet,attr,omitempty"`
+	HorizontalCentered bool `xml:"horizontalCentered,attr,omitempty"`
+	VerticalCentered   bool `xml:"verticalCentered,attr,omitempty"`
 }
 
 // xlsxPageMargins directly maps the pageMargins element in the namespace
 // http://schemas.openxmlformats.org/spreadsheetml/2006/main -
 // currently I have not checked it for completeness - it does as much
-// as I need.
+// as I need.  The margins are kept as they are written, so that those
+// of an opened file are written back unchanged.
 type xlsxPageMargins struct {
-	Left   float64 `xml:"left,attr"`
-	Right  float64 `xml:"right,attr"`
-	Top    float64 `xml:"top,attr"`
-	Bottom float64 `xml:"bottom,attr"`
-	Header float64 `xml:"header,attr"`
-	Footer float64 `xml:"footer,attr"`
+	Left   string `xml:"left,attr"`
+	Right  string `xml:"right,attr"`
+	Top    string `xml:"top,attr"`
+	Bottom string `xml:"bottom,attr"`
+	Header string `xml:"header,attr"`
+	Footer string `xml:"footer,attr"`
 }
 
 // xlsxSheetFormatPr directly maps the sheetFormatPr element in the namespace
@@ -140,6 +161,7 @@ type xlsxPageMargins struct {
 type xlsxSheetFormatPr struct {
 	DefaultColWidth  float64 `xml:"defaultColWidth,attr,omitempty"`
 	DefaultRowHeight float64 `xml:"defaultRowHeight,attr"`
+	CustomHeight     bool    `xml:"customHeight,attr,omitempty"`
 	OutlineLevelCol  uint8   `xml:"outlineLevelCol,attr,omitempty"`
 	OutlineLevelRow  uint8   `xml:"outlineLevelRow,attr,omitempty"`
 }
@@ -155,7 +177,8 @@ type xlsxSheetViews struct {
 // xlsxSheetView directly maps the sheetView element in the namespace
 // http://schemas.openxmlformats.org/spreadsheetml/2006/main -
 // currently I have not checked it for completeness - it does as much
-// as I need.
+// as I need.  The attributes that aren't mapped to fields are kept in
+// Attrs, so that they survive being written back out.
 type xlsxSheetView struct {
 	WindowProtection        bool            `xml:"windowProtection,attr"`
 	ShowFormulas            bool            `xml:"showFormulas,attr"`
@@ -167,22 +190,45 @@ type xlsxSheetView struct {
 	ShowOutlineSymbols      bool            `xml:"showOutlineSymbols,attr"`
 	DefaultGridColor        bool            `xml:"defaultGridColor,attr"`
 	View                    string          `xml:"view,attr"`
-	TopLeftCell             string          `xml:"topLeftCell,attr"`
+	TopLeftCell             string          `xml:"topLeftCell,attr,omitempty"`
 	ColorId                 int             `xml:"colorId,attr"`
 	ZoomScale               float64         `xml:"zoomScale,attr"`
 	ZoomScaleNormal         float64         `xml:"zoomScaleNormal,attr"`
 	ZoomScalePageLayoutView float64         `xml:"zoomScalePageLayoutView,attr"`
 	WorkbookViewId          int             `xml:"workbookViewId,attr"`
+	Attrs                   []xml.Attr      `xml:",any,attr"`
 	Pane                    *xlsxPane       `xml:"pane"`
 	Selection               []xlsxSelection `xml:"selection"`
 }
 
+// UnmarshalXML implements xml.Unmarshaler for xlsxSheetView, so that
+// the attributes that are absent take their defaults, rather than the
+// zero values of their fields.
+func (v *xlsxSheetView) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain xlsxSheetView
+	view := plain{
+		ShowGridLines:      true,
+		ShowRowColHeaders:  true,
+		ShowZeros:          true,
+		ShowOutlineSymbols: true,
+		DefaultGridColor:   true,
+		View:               "normal",
+		ColorId:            64,
+		ZoomScale:          100,
+	}
+	if err := d.DecodeElement(&view, &start); err != nil {
+		return err
+	}
+	*v = xlsxSheetView(view)
+	return nil
+}
+
 // xlsxSelection directly maps the selection element in the namespace
 // http://schemas.openxmlformats.org/spreadsheetml/2006/main -
 // currently I have not checked it for completeness - it does as much
 // as I need.
 type xlsxSelection struct {
-	Pane         string `xml:"pane,attr"`
+	Pane         string `xml:"pane,attr,omitempty"`
 	ActiveCell   string `xml:"activeCell,attr"`
 	ActiveCellId int    `xml:"activeCellId,attr"`
 	SQRef        string `xml:"sqref,attr"`
@@ -206,9 +252,19 @@ type xlsxPane struct {
 // as I need.
 type xlsxSheetPr struct {
 	FilterMode  bool              `xml:"filterMode,attr"`
+	OutlinePr   *xlsxOutlinePr    `xml:"outlinePr,omitempty"`
 	PageSetUpPr []xlsxPageSetUpPr `xml:"pageSetUpPr"`
 }
 
+// xlsxOutlinePr directly maps the outlinePr element in the namespace
+// http://schemas.openxmlformats.org/spreadsheetml/2006/main, which says
+// whether the summary rows and columns of outlines are below and right
+// of the rows and columns they summarise, which is the default.
+type xlsxOutlinePr struct {
+	SummaryBelow *bool `xml:"summaryBelow,attr,omitempty"`
+	SummaryRight *bool `xml:"summaryRight,attr,omitempty"`
+}
+
 // xlsxPageSetUpPr directly maps the pageSetupPr element in the namespace
 // http://schemas.openxmlformats.org/spreadsheetml/2006/main -
 // currently I have not checked it for completeness - it does as much
@@ -316,11 +372,14 @@ type xlsxDataValidation struct {
 type xlsxRow struct {
 	R            int     `xml:"r,attr"`
 	Spans        string  `xml:"spans,attr,omitempty"`
+	S            int     `xml:"s,attr,omitempty"`
+	CustomFormat bool    `xml:"customFormat,attr,omitempty"`
 	Hidden       bool    `xml:"hidden,attr,omitempty"`
 	C            []xlsxC `xml:"c"`
 	Ht           string  `xml:"ht,attr,omitempty"`
 	CustomHeight bool    `xml:"customHeight,attr,omitempty"`
 	OutlineLevel uint8   `xml:"outlineLevel,attr,omitempty"`
+	Collapsed    bool    `xml:"collapsed,attr,omitempty"`
 }
 
 type xlsxAutoFilter struct {
@@ -351,13 +410,42 @@ type xlsxHyperlinks struct {
 }
 
 type xlsxHyperlink struct {
-	RelationshipId string `xml:"id,attr"`
+	RelationshipId string `xml:"id,attr,omitempty"`
 	Reference      string `xml:"ref,attr"`
 	DisplayString  string `xml:"display,attr,omitempty"`
 	Tooltip        string `xml:"tooltip,attr,omitempty"`
 	Location       string `xml:"location,attr,omitempty"`
 }
 
+// makeXlsxHyperlink returns the hyperlink element for the Hyperlink
+// of the cell at col and row, and false if there's nothing to write.
+// An external link refers to the relationship with its target, and
+// an internal one has only a location.
+func makeXlsxHyperlink(link Hyperlink, col, row int, relations *xlsxWorksheetRels) (xlsxHyperlink, bool) {
+	xLink := xlsxHyperlink{
+		Reference:     GetCellIDStringFromCoords(col, row),
+		DisplayString: link.DisplayString,
+		Tooltip:       link.Tooltip,
+		Location:      link.Location,
+	}
+	if link.HSpan > 0 || link.VSpan > 0 {
+		xLink.Reference += ":" + GetCellIDStringFromCoords(col+link.HSpan, row+link.VSpan)
+	}
+	if link.Link != "" && relations != nil {
+		for _, rel := range relations.Relationships {
+			if rel.Type == RelationshipTypeHyperlink && rel.Target == link.Link {
+				xLink.RelationshipId = rel.Id
+			}
+		}
+	}
+	if xLink.Location == link.Link {
+		// SetHyperlink keeps a link that isn't a URL as its location
+		// too, but it's written as the target of the relationship.
+		xLink.Location = ""
+	}
+	return xLink, xLink.RelationshipId != "" || xLink.Location != ""
+}
+
 // Return the cartesian extent of a merged cell range from its origin
 // cell (the closest merged cell to the to left of the sheet.
 func (mc *xlsxMergeCells) getExtent(cellRef string) (int, int, error) {
@@ -405,7 +493,7 @@ type xlsxF struct {
 	Content string `xml:",chardata"`
 	T       string `xml:"t,attr,omitempty"`   // Formula type
 	Ref     string `xml:"ref,attr,omitempty"` // Shared formula ref
-	Si      int    `xml:"si,attr,omitempty"`  // Shared formula index
+	Si      *int   `xml:"si,attr,omitempty"`  // Shared formula index
 }
 
 // Create a new XLSX Worksheet with default values populated.
@@ -416,12 +504,19 @@ func newXlsxWorksheet() (worksheet *xlsxWorksheet) {
 	worksheet.SheetPr.FilterMode = false
 	worksheet.SheetPr.PageSetUpPr = make([]xlsxPageSetUpPr, 1)
 	worksheet.SheetPr.PageSetUpPr[0] = xlsxPageSetUpPr{FitToPage: false}
-	worksheet.SheetViews.SheetView = make([]xlsxSheetView, 1)
-	worksheet.SheetViews.SheetView[0] = xlsxSheetView{
+	worksheet.SheetViews.SheetView = []xlsxSheetView{newXlsxSheetView()}
+	worksheet.SheetFormatPr.DefaultRowHeight = defaultRowHeight
+
+	return
+}
+
+// newXlsxSheetView returns the sheetView element that a new worksheet
+// is written with.
+func newXlsxSheetView() xlsxSheetView {
+	return xlsxSheetView{
 		ColorId:                 64,
 		DefaultGridColor:        true,
 		RightToLeft:             false,
-		Selection:               make([]xlsxSelection, 1),
 		ShowFormulas:            false,
 		ShowGridLines:           true,
 		ShowOutlineSymbols:      true,
@@ -434,15 +529,14 @@ func newXlsxWorksheet() (worksheet *xlsxWorksheet) {
 		WorkbookViewId:          0,
 		ZoomScale:               100,
 		ZoomScaleNormal:         100,
-		ZoomScalePageLayoutView: 100}
-	worksheet.SheetViews.SheetView[0].Selection[0] = xlsxSelection{
-		Pane:         "topLeft",
-		ActiveCell:   "A1",
-		ActiveCellId: 0,
-		SQRef:        "A1"}
-	worksheet.SheetFormatPr.DefaultRowHeight = 12.85
-
-	return
+		ZoomScalePageLayoutView: 100,
+		Selection: []xlsxSelection{{
+			Pane:         "topLeft",
+			ActiveCell:   "A1",
+			ActiveCellId: 0,
+			SQRef:        "A1",
+		}},
+	}
 }
 
 // setup the CellsMap so that we can rapidly calculate extents
@@ -567,13 +661,21 @@ func emitStructAsXML(v reflect.Value, name, xmlNS string) (xmlwriter.Elem, error
 			// This name means we shouldn't emit this element.
 			continue
 		}
+		if isAttr && name == "" {
+			// The attributes kept by an ",any,attr" field, which
+			// have had those from other namespaces dropped.
+			for _, attr := range fv.Interface().([]xml.Attr) {
+				output.Attrs = append(output.Attrs, xmlwriter.Attr{Name: attr.Name.Local, Value: attr.Value})
+			}
+			continue
+		}
 		if isAttr {
 			if omitempty && reflect.Zero(fv.Type()).Interface() == fv.Interface() {
 				// The value is this types zero value
 				continue
 			}
 
-			if output.Name == "hyperlink" && name == "id" {
+			if (output.Name == "hyperlink" || output.Name == "drawing" || output.Name == "legacyDrawing" || output.Name == "tablePart") && name == "id" {
 				// Hack to respect the relationship namespace
 				name = "r:id"
 			}
@@ -595,12 +697,18 @@ func emitStructAsXML(v reflect.Value, name, xmlNS string) (xmlwriter.Elem, error
 				Name:  "xmlns",
 				Value: xmlNS,
 			})
-		case "SheetData", "MergeCells", "DataValidations":
+		case "SheetData", "SheetProtection", "AutoFilter", "CustomSheetViews", "MergeCells", "DataValidations",
+			"Hyperlinks", "PrintOptions", "PageMargins", "PageSetUp", "HeaderFooter", "Drawing", "LegacyDrawing",
+			"TableParts", "ExtLst":
 			// Skip SheetData here, we explicitly generate this in writeXML below
 			// Microsoft Excel considers a mergeCells element before a sheetData element to be
 			// an error and will fail to open the document, so we'll be back with this data
-			// from writeXml later.
+			// from writeXml later.  The same goes for the other
+			// elements that follow sheetData.
 
+			continue
+		case "Is":
+			// Inline strings are written by writeXlsxRow.
 			continue
 		default:
 			if fv.Kind() == reflect.Ptr {
@@ -626,6 +734,9 @@ func emitStructAsXML(v reflect.Value, name, xmlNS string) (xmlwriter.Elem, error
 					output.Content = append(output.Content, elem)
 				}
 			case reflect.String:
+				if omitempty && fv.String() == "" {
+					continue
+				}
 				elem := xmlwriter.Elem{Name: name}
 				if xmlNS != "" {
 					elem.Attrs = append(elem.Attrs, xmlwriter.Attr{
@@ -648,7 +759,7 @@ func (worksheet *xlsxWorksheet) makeXlsxRowFromRow(row *Row, styles *xlsxStyleSh
 	xRow := &xlsxRow{}
 	xRow.R = row.num + 1
 	if row.isCustom {
-		h := row.GetHeight()
+		h := row.height
 		if h > 0 {
 			xRow.CustomHeight = true
 			xRow.Ht = fmt.Sprintf("%g", h)
@@ -656,22 +767,48 @@ func (worksheet *xlsxWorksheet) makeXlsxRowFromRow(row *Row, styles *xlsxStyleSh
 	}
 	xRow.OutlineLevel = row.GetOutlineLevel()
 	xRow.Hidden = row.Hidden
+	xRow.Collapsed = row.collapsed
+	rowXfId, err := row.makeXfId(styles)
+	if err != nil {
+		return nil, fmt.Errorf("row %d: %w", row.num+1, err)
+	}
+	if rowXfId >= 0 {
+		xRow.S = rowXfId
+		xRow.CustomFormat = true
+	}
 
-	err := row.ForEachCell(func(cell *Cell) error {
+	if row.cellStoreRow.CellCount() == 0 {
+		return xRow, nil
+	}
+	var first, last int
+	err = row.ForEachCell(func(cell *Cell) error {
+		if cell.isBlank() {
+			return nil
+		}
 		var XfId int
 
 		col := row.Sheet.Col(cell.num)
 		if col != nil {
 			XfId = col.outXfID
 		}
+		// The Row's default style takes precedence over the Col's.
+		if rowXfId >= 0 {
+			XfId = rowXfId
+		}
 
 		// generate NumFmtId and add new NumFmt
-		xNumFmt := styles.newNumFmt(cell.NumFmt)
+		xNumFmt, err := styles.newNumFmt(cell.NumFmt)
+		if err != nil {
+			return fmt.Errorf("cell %s: %w", GetCellIDStringFromCoords(cell.num, row.num), err)
+		}
 
 		style := cell.style
 		switch {
 		case style != nil:
-			XfId = handleStyleForXLSX(style, xNumFmt.NumFmtId, styles)
+			XfId, err = handleStyleForXLSX(style, xNumFmt.NumFmtId, styles)
+			if err != nil {
+				return fmt.Errorf("cell %s: %w", GetCellIDStringFromCoords(cell.num, row.num), err)
+			}
 		case len(cell.NumFmt) == 0:
 			// Do nothing
 		case col == nil:
@@ -684,20 +821,36 @@ func (worksheet *xlsxWorksheet) makeXlsxRowFromRow(row *Row, styles *xlsxStyleSh
 			R: GetCellIDStringFromCoords(cell.num, row.num),
 		}
 		if cell.formula != "" {
-			xC.F = &xlsxF{Content: cell.formula}
+			xC.F = row.Sheet.makeXlsxF(cell.num, row.num, cell.formula)
+			row.Sheet.File.noteFormula(cell)
 		}
 		switch cell.cellType {
 		case CellTypeInline:
 			// Inline strings are turned into shared strings since they are more efficient.
-			// This is what Excel does as well.
+			// This is what Excel does as well, unless the File was created with
+			// WriteInlineStrings.
 			fallthrough
 		case CellTypeString:
-			if len(cell.Value) > 0 {
-				xC.V = strconv.Itoa(refTable.AddString(cell.Value))
-			} else if len(cell.RichText) > 0 {
+			if err := row.Sheet.checkCellText(cell, xC.R); err != nil {
+				return err
+			}
+			if cell.writesInlineString() {
+				xC.Is = cell.makeXlsxInlineString(styles)
+				xC.T = "inlineStr"
+				break
+			}
+			if cell.writesPhonetic() {
+				xC.V = strconv.Itoa(cell.addPhoneticString(refTable, styles))
+			} else if cell.writesRichText() {
 				xC.V = strconv.Itoa(refTable.AddRichText(cell.RichText))
+			} else if len(cell.Value) > 0 {
+				xC.V = strconv.Itoa(refTable.AddString(cell.Value))
+			}
+			// An empty cell, such as a styled one that has been
+			// cleared, is written without a type, as Excel does.
+			if xC.V != "" {
+				xC.T = "s"
 			}
-			xC.T = "s"
 		case CellTypeNumeric:
 			// Numeric is the default, so the type can be left blank
 			xC.V = cell.Value
@@ -716,14 +869,85 @@ func (worksheet *xlsxWorksheet) makeXlsxRowFromRow(row *Row, styles *xlsxStyleSh
 		default:
 			return errors.New("unknown cell type cannot be marshaled")
 		}
+		if len(xRow.C) == 0 {
+			first = cell.num
+		}
+		last = cell.num
 		xRow.C = append(xRow.C, xC)
 
 		return nil
-	})
+	}, SkipEmptyCells)
+	if len(xRow.C) > 0 {
+		xRow.Spans = makeSpans(first, last)
+	}
 
 	return xRow, err
 }
 
+// makeSpans returns the spans attribute of a row whose cells are in
+// the zero based columns first to last.  Excel only takes it as a
+// hint of how many cells to expect, but reads a row faster with it.
+func makeSpans(first, last int) string {
+	return fmt.Sprintf("%d:%d", first+1, last+1)
+}
+
+// writeXlsxRow writes the row element of xRow.  Cells with inline
+// strings, or with a CR in their text, are marshalled as they are by
+// MakeStreamParts and written as raw XML: the runs of rich text would
+// nest deeper than the xmlwriter can write a tree of elements, and it
+// doesn't escape a CR, which a reader would then see as a LF.
+func writeXlsxRow(xw *xmlwriter.Writer, xRow *xlsxRow) error {
+	output, err := emitStructAsXML(reflect.ValueOf(xRow), "row", "")
+	if err != nil {
+		return err
+	}
+	writesRaw := func(xC xlsxC) bool {
+		return xC.Is != nil || strings.ContainsRune(xC.V, '\r') ||
+			(xC.F != nil && strings.ContainsRune(xC.F.Content, '\r'))
+	}
+	hasRawCells := false
+	for _, xC := range xRow.C {
+		hasRawCells = hasRawCells || writesRaw(xC)
+	}
+	if !hasRawCells {
+		return xw.Write(output)
+	}
+
+	ec := xmlwriter.ErrCollector{}
+	ec.Do(xw.StartElem(xmlwriter.Elem{Name: output.Name, Attrs: output.Attrs}))
+	// The row has no child elements other than its cells.
+	for i, content := range output.Content {
+		if !writesRaw(xRow.C[i]) {
+			ec.Do(xw.Write(content))
+			continue
+		}
+		var c strings.Builder
+		ec.Do(
+			xml.NewEncoder(&c).EncodeElement(xRow.C[i], xml.StartElement{Name: xml.Name{Local: "c"}}),
+			// Raw XML doesn't close the start tag of the row, so
+			// an empty text node is written first to do so.
+			xw.Write(xmlwriter.Text(""), xmlwriter.Raw(c.String())),
+		)
+	}
+	ec.Do(xw.EndElem(output.Name))
+	return ec.Err
+}
+
+// writeElem writes the element name, whose content is the struct that
+// v points to, unless v is nil.  The elements that follow sheetData
+// are written with it, in the order that the schema gives them.
+func writeElem(xw *xmlwriter.Writer, name string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.IsNil() {
+		return nil
+	}
+	elem, err := emitStructAsXML(rv, name, "")
+	if err != nil {
+		return err
+	}
+	return xw.Write(elem)
+}
+
 func (worksheet *xlsxWorksheet) WriteXML(xw *xmlwriter.Writer, s *Sheet, styles *xlsxStyleSheet, refTable *RefTable) (err error) {
 	var output xmlwriter.Elem
 	worksheet.XMLNSR = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
@@ -734,7 +958,13 @@ func (worksheet *xlsxWorksheet) WriteXML(xw *xmlwriter.Writer, s *Sheet, styles
 	}
 
 	ec := xmlwriter.ErrCollector{}
-	defer ec.Set(&err)
+	defer func() {
+		// The ErrCollector can't be unwrapped, so return the error it
+		// collected, so that callers can still inspect it.
+		if ec.Err != nil {
+			err = ec.Err
+		}
+	}()
 	ec.Do(
 		xw.StartElem(output),
 		xw.StartElem(xmlwriter.Elem{Name: "sheetData"}),
@@ -743,12 +973,10 @@ func (worksheet *xlsxWorksheet) WriteXML(xw *xmlwriter.Writer, s *Sheet, styles
 			if err != nil {
 				return err
 			}
-			elem := reflect.ValueOf(xRow)
-			output, err := emitStructAsXML(elem, "row", "")
-			if err != nil {
-				return err
+			if len(xRow.C) == 0 && !row.hasOwnAttributes() {
+				return nil
 			}
-			err = xw.Write(output)
+			err = writeXlsxRow(xw, xRow)
 			if err != nil {
 				return err
 			}
@@ -757,21 +985,60 @@ func (worksheet *xlsxWorksheet) WriteXML(xw *xmlwriter.Writer, s *Sheet, styles
 		}, SkipEmptyRows),
 		xw.EndElem("sheetData"),
 		func() error {
-			if worksheet.MergeCells != nil {
-				mergeCells, err := emitStructAsXML(reflect.ValueOf(worksheet.MergeCells), "mergeCells", "")
-				if err != nil {
-					return err
-				}
-				return xw.Write(mergeCells)
+			// sheetProtection must directly follow sheetData.
+			if worksheet.SheetProtection == nil {
+				return nil
 			}
-			if worksheet.DataValidations != nil {
-				dataValidation, err := emitStructAsXML(reflect.ValueOf(worksheet.DataValidations), "dataValidations", "")
-				if err != nil {
-					return err
-				}
-				return xw.Write(dataValidation)
+			protection := xmlwriter.Elem{
+				Name:  "sheetProtection",
+				Attrs: sheetProtectionAttrs(worksheet.SheetProtection),
 			}
-			return nil
+			return xw.Write(protection)
+		}(),
+		writeElem(xw, "autoFilter", worksheet.AutoFilter),
+		func() error {
+			if worksheet.CustomSheetViews == nil {
+				return nil
+			}
+			// The views are kept verbatim, as raw XML.  Raw XML
+			// doesn't close the start tag, so an empty text node is
+			// written first to do so.
+			err := xw.StartElem(xmlwriter.Elem{Name: "customSheetViews"})
+			if err != nil {
+				return err
+			}
+			err = xw.Write(xmlwriter.Text(""), xmlwriter.Raw(worksheet.CustomSheetViews.Content))
+			if err != nil {
+				return err
+			}
+			return xw.EndElem("customSheetViews")
+		}(),
+		writeElem(xw, "mergeCells", worksheet.MergeCells),
+		writeElem(xw, "dataValidations", worksheet.DataValidations),
+		writeElem(xw, "hyperlinks", worksheet.Hyperlinks),
+		writeElem(xw, "printOptions", worksheet.PrintOptions),
+		writeElem(xw, "pageMargins", worksheet.PageMargins),
+		writeElem(xw, "pageSetup", worksheet.PageSetUp),
+		writeElem(xw, "headerFooter", worksheet.HeaderFooter),
+		// drawing, legacyDrawing and tableParts come after everything
+		// else that is written but the extensions.
+		writeElem(xw, "drawing", worksheet.Drawing),
+		writeElem(xw, "legacyDrawing", worksheet.LegacyDrawing),
+		writeElem(xw, "tableParts", worksheet.TableParts),
+		func() error {
+			if worksheet.ExtLst == nil {
+				return nil
+			}
+			// Like the custom views, the extensions are raw XML.
+			err := xw.StartElem(xmlwriter.Elem{Name: "extLst"})
+			if err != nil {
+				return err
+			}
+			err = xw.Write(xmlwriter.Text(""), xmlwriter.Raw(worksheet.ExtLst.Content))
+			if err != nil {
+				return err
+			}
+			return xw.EndElem("extLst")
 		}(),
 		xw.EndElem(output.Name),
 		xw.Flush(),